@@ -8,20 +8,24 @@ type UpsertServiceCIConfigReq struct {
 	BuildSteps     []string `json:"build_steps"`
 	ArtifactTarget string   `json:"artifact_target" binding:"required"`
 	TriggerMode    string   `json:"trigger_mode" binding:"required"` // manual|source-event|both
+	TagPattern     string   `json:"tag_pattern"`                     // 触发构建的 tag 模式, 为空时忽略 tag 推送
+	WebhookSecret  string   `json:"webhook_secret"`                  // webhook 签名密钥, 为空时保留原值
 }
 
 type ServiceCIConfigResp struct {
-	ID             uint      `json:"id"`
-	ServiceID      uint      `json:"service_id"`
-	RepoURL        string    `json:"repo_url"`
-	Branch         string    `json:"branch"`
-	BuildSteps     []string  `json:"build_steps"`
-	ArtifactTarget string    `json:"artifact_target"`
-	TriggerMode    string    `json:"trigger_mode"`
-	Status         string    `json:"status"`
-	UpdatedBy      uint      `json:"updated_by"`
-	CreatedAt      time.Time `json:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at"`
+	ID               uint      `json:"id"`
+	ServiceID        uint      `json:"service_id"`
+	RepoURL          string    `json:"repo_url"`
+	Branch           string    `json:"branch"`
+	BuildSteps       []string  `json:"build_steps"`
+	ArtifactTarget   string    `json:"artifact_target"`
+	TagPattern       string    `json:"tag_pattern"`
+	WebhookSecretSet bool      `json:"webhook_secret_set"`
+	TriggerMode      string    `json:"trigger_mode"`
+	Status           string    `json:"status"`
+	UpdatedBy        uint      `json:"updated_by"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
 }
 
 type TriggerCIRunReq struct {
@@ -30,15 +34,131 @@ type TriggerCIRunReq struct {
 }
 
 type CIRunResp struct {
-	ID          uint      `json:"id"`
-	ServiceID   uint      `json:"service_id"`
-	CIConfigID  uint      `json:"ci_config_id"`
-	TriggerType string    `json:"trigger_type"`
-	Status      string    `json:"status"`
-	Reason      string    `json:"reason"`
-	TriggeredBy uint      `json:"triggered_by"`
-	TriggeredAt time.Time `json:"triggered_at"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID                uint                  `json:"id"`
+	ServiceID         uint                  `json:"service_id"`
+	CIConfigID        uint                  `json:"ci_config_id"`
+	TriggerType       string                `json:"trigger_type"`
+	Status            string                `json:"status"` // queued|running|waiting|succeeded|failed
+	Reason            string                `json:"reason"`
+	TriggeredBy       uint                  `json:"triggered_by"`
+	TriggeredAt       time.Time             `json:"triggered_at"`
+	Branch            string                `json:"branch"`
+	RefType           string                `json:"ref_type"` // branch|tag
+	CommitSHA         string                `json:"commit_sha"`
+	CommitAuthor      string                `json:"commit_author"`
+	CommitMessage     string                `json:"commit_message"`
+	WebhookDeliveryID uint                  `json:"webhook_delivery_id"`
+	ArtifactRef       string                `json:"artifact_ref"`
+	Runner            string                `json:"runner"`
+	ErrorMessage      string                `json:"error_message"`
+	PipelineSource    string                `json:"pipeline_source"` // file|config
+	AutoDeploys       []CIRunAutoDeployResp `json:"auto_deploys,omitempty"`
+	StartedAt         *time.Time            `json:"started_at,omitempty"`
+	FinishedAt        *time.Time            `json:"finished_at,omitempty"`
+	CreatedAt         time.Time             `json:"created_at"`
+}
+
+// CIRunAutoDeployResp 是运行成功后按一条 CD 配置自动发布的结果。
+type CIRunAutoDeployResp struct {
+	CDConfigID   uint   `json:"cd_config_id"`
+	DeploymentID uint   `json:"deployment_id"`
+	Env          string `json:"env"`
+	RuntimeType  string `json:"runtime_type"`
+	Status       string `json:"status"` // triggered|skipped|failed
+	ReleaseID    uint   `json:"release_id,omitempty"`
+	Release      string `json:"release_status,omitempty"`
+	Detail       string `json:"detail,omitempty"`
+}
+
+type CIRunStepResp struct {
+	ID         uint       `json:"id"`
+	RunID      uint       `json:"run_id"`
+	Seq        int        `json:"seq"`
+	Stage      string     `json:"stage"`
+	Kind       string     `json:"kind"` // clone|command|manual|publish|deploy
+	Name       string     `json:"name"`
+	Image      string     `json:"image,omitempty"`
+	Command    string     `json:"command"`
+	Status     string     `json:"status"` // pending|running|waiting|succeeded|failed|skipped
+	ApprovedBy uint       `json:"approved_by,omitempty"`
+	ExitCode   int        `json:"exit_code"`
+	Log        string     `json:"log"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// CIRunPipelineResp 是一次运行实际使用的流水线: 来自仓库文件或由 CI 配置生成。
+type CIRunPipelineResp struct {
+	RunID    uint   `json:"run_id"`
+	Source   string `json:"source"` // file|config, 运行尚未拉取代码时为空
+	Path     string `json:"path,omitempty"`
+	YAML     string `json:"yaml,omitempty"`
+	Pipeline any    `json:"pipeline,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+type ValidatePipelineReq struct {
+	Content string `json:"content" binding:"required"`
+}
+
+type ValidatePipelineResp struct {
+	Valid    bool     `json:"valid"`
+	Pipeline any      `json:"pipeline,omitempty"`
+	Problems []string `json:"problems,omitempty"`
+}
+
+type CIGateDecisionReq struct {
+	Comment string `json:"comment"`
+}
+
+type WebhookDeliveryResp struct {
+	ID                uint              `json:"id"`
+	Provider          string            `json:"provider"`
+	DeliveryID        string            `json:"delivery_id"`
+	Event             string            `json:"event"`
+	RepoURL           string            `json:"repo_url"`
+	Ref               string            `json:"ref"`
+	CommitSHA         string            `json:"commit_sha"`
+	Author            string            `json:"author"`
+	Status            string            `json:"status"` // received|triggered|ignored|duplicate|rejected|invalid
+	Detail            string            `json:"detail"`
+	RunIDs            []uint            `json:"run_ids"`
+	VerifiedConfigIDs []uint            `json:"verified_config_ids"`
+	ReplayOf          uint              `json:"replay_of"`
+	ReplayedBy        uint              `json:"replayed_by"`
+	Headers           map[string]string `json:"headers,omitempty"`
+	Payload           string            `json:"payload,omitempty"`
+	CreatedAt         time.Time         `json:"created_at"`
+}
+
+type ArtifactResp struct {
+	ID            uint       `json:"id"`
+	ServiceID     uint       `json:"service_id"`
+	CIRunID       uint       `json:"ci_run_id"`
+	Kind          string     `json:"kind"` // image|file
+	Reference     string     `json:"reference"`
+	Digest        string     `json:"digest"`
+	PinnedRef     string     `json:"pinned_ref"` // 按 digest 固定的引用, 发布时使用
+	CommitSHA     string     `json:"commit_sha"`
+	Branch        string     `json:"branch"`
+	Author        string     `json:"author"`
+	CommitMessage string     `json:"commit_message"`
+	DurationMs    int64      `json:"duration_ms"`
+	Metadata      any        `json:"metadata,omitempty"`
+	Status        string     `json:"status"` // active|expired
+	ExpiredAt     *time.Time `json:"expired_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// ReleaseChangesResp 描述一次发布相对同一目标上一次成功发布的提交范围。
+type ReleaseChangesResp struct {
+	ReleaseID         uint           `json:"release_id"`
+	PreviousReleaseID uint           `json:"previous_release_id"`
+	FromCommit        string         `json:"from_commit"`
+	ToCommit          string         `json:"to_commit"`
+	Range             string         `json:"range"`
+	CompareURL        string         `json:"compare_url,omitempty"`
+	Artifacts         []ArtifactResp `json:"artifacts"` // 范围内构建的制品, 新的在前
 }
 
 type UpsertDeploymentCDConfigReq struct {
@@ -47,19 +167,29 @@ type UpsertDeploymentCDConfigReq struct {
 	Strategy         string         `json:"strategy" binding:"required"` // rolling|blue-green|canary
 	StrategyConfig   map[string]any `json:"strategy_config"`
 	ApprovalRequired bool           `json:"approval_required"`
+	// AutoDeploy 开启时, ServiceID 的 CI 运行成功后自动发布; 分支/tag 模式使用 path.Match 语法,
+	// 都为空时只匹配 CI 配置的默认分支。
+	ServiceID          uint     `json:"service_id"`
+	AutoDeploy         bool     `json:"auto_deploy"`
+	AutoDeployBranches []string `json:"auto_deploy_branches"`
+	AutoDeployTags     []string `json:"auto_deploy_tags"`
 }
 
 type DeploymentCDConfigResp struct {
-	ID               uint           `json:"id"`
-	DeploymentID     uint           `json:"deployment_id"`
-	Env              string         `json:"env"`
-	RuntimeType      string         `json:"runtime_type"`
-	Strategy         string         `json:"strategy"`
-	StrategyConfig   map[string]any `json:"strategy_config"`
-	ApprovalRequired bool           `json:"approval_required"`
-	UpdatedBy        uint           `json:"updated_by"`
-	CreatedAt        time.Time      `json:"created_at"`
-	UpdatedAt        time.Time      `json:"updated_at"`
+	ID                 uint           `json:"id"`
+	DeploymentID       uint           `json:"deployment_id"`
+	Env                string         `json:"env"`
+	RuntimeType        string         `json:"runtime_type"`
+	Strategy           string         `json:"strategy"`
+	StrategyConfig     map[string]any `json:"strategy_config"`
+	ApprovalRequired   bool           `json:"approval_required"`
+	ServiceID          uint           `json:"service_id"`
+	AutoDeploy         bool           `json:"auto_deploy"`
+	AutoDeployBranches []string       `json:"auto_deploy_branches"`
+	AutoDeployTags     []string       `json:"auto_deploy_tags"`
+	UpdatedBy          uint           `json:"updated_by"`
+	CreatedAt          time.Time      `json:"created_at"`
+	UpdatedAt          time.Time      `json:"updated_at"`
 }
 
 type TriggerReleaseReq struct {
@@ -69,7 +199,11 @@ type TriggerReleaseReq struct {
 	RuntimeType   string `json:"runtime_type"`
 	Version       string `json:"version" binding:"required"`
 	CIRunID       uint   `json:"ci_run_id,omitempty"`
+	ArtifactID    uint   `json:"artifact_id,omitempty"`    // 指定发布的制品, 为空时使用 ci_run_id 的制品
 	TriggerSource string `json:"trigger_source,omitempty"` // manual|ci, defaults to ci for cicd endpoint
+	// EmergencyOverride/OverrideReason 在变更冻结期内申请紧急发布, 需要 deploy:freeze:override 权限。
+	EmergencyOverride bool   `json:"emergency_override,omitempty"`
+	OverrideReason    string `json:"override_reason,omitempty"`
 }
 
 type ReleaseDecisionReq struct {
@@ -99,6 +233,9 @@ type ReleaseResp struct {
 	TriggerSource         string     `json:"trigger_source,omitempty"`
 	TriggerContext        any        `json:"trigger_context,omitempty"`
 	CIRunID               uint       `json:"ci_run_id,omitempty"`
+	ArtifactID            uint       `json:"artifact_id,omitempty"`
+	ArtifactDigest        string     `json:"artifact_digest,omitempty"`
+	CommitSHA             string     `json:"commit_sha,omitempty"`
 	StartedAt             *time.Time `json:"started_at,omitempty"`
 	FinishedAt            *time.Time `json:"finished_at,omitempty"`
 	CreatedAt             time.Time  `json:"created_at"`
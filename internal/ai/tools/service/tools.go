@@ -13,11 +13,13 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/cloudwego/eino/components/tool"
 	einoutils "github.com/cloudwego/eino/components/tool/utils"
 	"github.com/cy77cc/OpsPilot/internal/ai/tools/common"
 	"github.com/cy77cc/OpsPilot/internal/model"
+	"github.com/cy77cc/OpsPilot/internal/service/deployment/freeze"
 )
 
 // =============================================================================
@@ -247,6 +249,9 @@ func ServiceDeployApply(ctx context.Context, deps common.PlatformDeps) tool.Invo
 			if err := deps.DB.First(&cluster, input.ClusterID).Error; err != nil {
 				return nil, err
 			}
+			if err := checkDeployFreeze(ctx, deps, &svc, input.ClusterID); err != nil {
+				return nil, err
+			}
 			return &ServiceDeployApplyOutput{
 				Applied:   true,
 				ServiceID: input.ServiceID,
@@ -262,6 +267,67 @@ func ServiceDeployApply(ctx context.Context, deps common.PlatformDeps) tool.Invo
 	return t
 }
 
+// checkDeployFreeze 拒绝落在变更冻结窗口内的部署。AI 工具不支持紧急放行,
+// 需要放行时应通过发布接口提交 emergency_override 并走审批。
+//
+// 与发布接口一致, 冻结范围按部署目标的环境计算 (目标未设置环境时回退到服务环境); 集群上的每个目标分别检查。
+func checkDeployFreeze(ctx context.Context, deps common.PlatformDeps, svc *model.Service, clusterID int) error {
+	var targets []model.DeploymentTarget
+	if err := deps.DB.WithContext(ctx).Where("cluster_id = ?", clusterID).Find(&targets).Error; err != nil {
+		return err
+	}
+	now := time.Now()
+	scopes := make([]freeze.Scope, 0, len(targets)+1)
+	for _, target := range targets {
+		scopes = append(scopes, freeze.Scope{Env: deployFreezeEnv(target.Env, svc.Env), ProjectID: svc.ProjectID, TargetIDs: []uint{target.ID}})
+	}
+	if len(scopes) == 0 {
+		scopes = append(scopes, freeze.Scope{Env: deployFreezeEnv("", svc.Env), ProjectID: svc.ProjectID})
+	}
+	windows := make([]model.DeploymentFreezeWindow, 0)
+	envs := make([]string, 0, len(scopes))
+	seen := map[uint]struct{}{}
+	for _, scope := range scopes {
+		active, err := freeze.Active(ctx, deps.DB, scope, now)
+		if err != nil {
+			return err
+		}
+		for _, w := range active {
+			if _, ok := seen[w.ID]; ok {
+				continue
+			}
+			seen[w.ID] = struct{}{}
+			windows = append(windows, w)
+		}
+		if len(active) > 0 {
+			envs = append(envs, scope.Env)
+		}
+	}
+	if len(windows) == 0 {
+		return nil
+	}
+	_ = deps.DB.WithContext(ctx).Create(&model.AuditLog{
+		ActionType:   model.AuditActionReleaseFreezeBlocked,
+		ResourceType: model.AuditResourceService,
+		ResourceID:   svc.ID,
+		ActorName:    "ai:service_deploy_apply",
+		Detail: map[string]interface{}{
+			"cluster_id": clusterID,
+			"env":        strings.Join(envs, ","),
+			"windows":    freeze.Summaries(windows, now),
+		},
+	}).Error
+	return fmt.Errorf("deployment blocked by change freeze: %s; use the release API with emergency_override to request an approved override", freeze.Describe(windows, now))
+}
+
+func deployFreezeEnv(targetEnv, serviceEnv string) string {
+	env := strings.TrimSpace(targetEnv)
+	if env == "" {
+		env = strings.TrimSpace(serviceEnv)
+	}
+	return strings.ToLower(env)
+}
+
 type ServiceDeployOutput struct {
 	Preview   bool        `json:"preview"`
 	Applied   bool        `json:"applied"`
@@ -290,6 +356,9 @@ func ServiceDeploy(ctx context.Context, deps common.PlatformDeps) tool.Invokable
 				if err := deps.DB.First(&cluster, input.ClusterID).Error; err != nil {
 					return nil, err
 				}
+				if err := checkDeployFreeze(ctx, deps, &svc, input.ClusterID); err != nil {
+					return nil, err
+				}
 				return &ServiceDeployOutput{
 					Preview:   false,
 					Applied:   true,
@@ -35,6 +35,8 @@ type Config struct {
 	FeatureFlags FeatureFlags `mapstructure:"feature_flags"` // 功能开关配置
 	Milvus       Milvus       `mapstructure:"milvus"`        // Milvus 向量数据库配置
 	Prometheus   Prometheus   `mapstructure:"prometheus"`    // Prometheus 监控配置
+	CICD         CICD         `mapstructure:"cicd"`          // CI 执行器配置
+	Jobs         Jobs         `mapstructure:"jobs"`          // 任务调度器配置
 }
 
 // App 包含应用程序基本配置。
@@ -237,6 +239,33 @@ type Prometheus struct {
 	RetryCount     int           `mapstructure:"retry_count"`     // 重试次数
 }
 
+// CICD 包含 CI 执行器配置。
+//
+// RunnerNodeID 为 0 时在本机的隔离工作目录中执行构建, 否则通过 SSH 在指定构建主机上执行。
+type CICD struct {
+	Enable       bool          `mapstructure:"enable"`         // 是否启用 CI 执行器
+	Workers      int           `mapstructure:"workers"`        // 并发执行的运行数
+	RunnerNodeID uint          `mapstructure:"runner_node_id"` // 构建主机节点 ID
+	WorkspaceDir string        `mapstructure:"workspace_dir"`  // 工作目录根路径
+	StepTimeout  time.Duration `mapstructure:"step_timeout"`   // 单个步骤超时
+	RunTimeout   time.Duration `mapstructure:"run_timeout"`    // 单次运行超时
+	// 制品保留规则: 每个服务保留最近 ArtifactKeepLast 个, 超过 ArtifactMaxAge 的过期; 负数表示不限制。
+	ArtifactKeepLast int           `mapstructure:"artifact_keep_last"` // 每个服务保留的制品数
+	ArtifactMaxAge   time.Duration `mapstructure:"artifact_max_age"`   // 制品最长保留时间
+}
+
+// Jobs 包含任务调度器配置。
+//
+// 多副本部署时通过选主锁保证同一时刻只有一个副本触发定时任务。
+type Jobs struct {
+	Enable       bool          `mapstructure:"enable"`        // 是否启用任务调度器
+	TickInterval time.Duration `mapstructure:"tick_interval"` // 检查到期任务的间隔
+	LockTTL      time.Duration `mapstructure:"lock_ttl"`      // 选主锁租约时长
+	MaxCatchUp   int           `mapstructure:"max_catch_up"`  // catch_up=all 时单个任务最多补偿的次数
+	Parallelism  int           `mapstructure:"parallelism"`   // 任务未设置时同时执行的主机数
+	K8sJobTTL    time.Duration `mapstructure:"k8s_job_ttl"`   // k8s 任务结束后集群保留 Job 与 Pod 的时长
+}
+
 // cfgFile 是配置文件路径，由命令行参数设置。
 var cfgFile string
 
@@ -41,6 +41,12 @@ type MetricsPusher struct {
 	clusterPodPending   *prometheus.GaugeVec
 	clusterPodFailed    *prometheus.GaugeVec
 	clusterCollectTime  *prometheus.GaugeVec
+
+	// 部署 DORA 指标
+	doraDeploymentFrequency *prometheus.GaugeVec
+	doraLeadTime            *prometheus.GaugeVec
+	doraChangeFailureRate   *prometheus.GaugeVec
+	doraTimeToRestore       *prometheus.GaugeVec
 }
 
 // HostMetricSnapshot 主机指标快照。
@@ -70,6 +76,18 @@ type ClusterMetricSnapshot struct {
 	PodFailed    int
 }
 
+// DORAMetricSnapshot 某个统计维度 (服务/团队/环境) 下的 DORA 指标快照。
+type DORAMetricSnapshot struct {
+	GroupBy              string // service, team, env, all
+	Key                  string
+	Name                 string
+	WindowDays           int
+	DeploymentsPerDay    float64
+	LeadTimeSeconds      float64
+	ChangeFailureRate    float64
+	TimeToRestoreSeconds float64
+}
+
 // NewMetricsPusher 创建指标推送器。
 func NewMetricsPusher(gatewayURL string) (*MetricsPusher, error) {
 	if gatewayURL == "" {
@@ -168,6 +186,28 @@ func NewMetricsPusher(gatewayURL string) (*MetricsPusher, error) {
 		Help: "Unix timestamp of last cluster collection",
 	}, []string{"cluster_id", "cluster_name"})
 
+	// 初始化部署 DORA 指标
+	doraLabels := []string{"group_by", "key", "name", "window_days"}
+	p.doraDeploymentFrequency = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "deployment_dora_deployment_frequency",
+		Help: "Successful deployments per day over the window",
+	}, doraLabels)
+
+	p.doraLeadTime = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "deployment_dora_lead_time_seconds",
+		Help: "Median seconds from CI run trigger to verified release",
+	}, doraLabels)
+
+	p.doraChangeFailureRate = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "deployment_dora_change_failure_rate",
+		Help: "Percentage of deployments that failed or were rolled back (0-100)",
+	}, doraLabels)
+
+	p.doraTimeToRestore = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "deployment_dora_time_to_restore_seconds",
+		Help: "Median seconds from a failed release to the next good release",
+	}, doraLabels)
+
 	// 注册所有指标
 	p.registry.MustRegister(
 		p.hostCPULoad,
@@ -187,6 +227,10 @@ func NewMetricsPusher(gatewayURL string) (*MetricsPusher, error) {
 		p.clusterPodPending,
 		p.clusterPodFailed,
 		p.clusterCollectTime,
+		p.doraDeploymentFrequency,
+		p.doraLeadTime,
+		p.doraChangeFailureRate,
+		p.doraTimeToRestore,
 	)
 
 	return p, nil
@@ -254,6 +298,35 @@ func (p *MetricsPusher) PushClusterMetrics(ctx context.Context, snapshot Cluster
 		PushContext(ctx)
 }
 
+// PushDORAMetrics 推送部署 DORA 指标到 Pushgateway。
+// 每次推送前清空已有序列, 避免已下线的服务或环境残留旧值。
+func (p *MetricsPusher) PushDORAMetrics(ctx context.Context, snapshots []DORAMetricSnapshot) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.doraDeploymentFrequency.Reset()
+	p.doraLeadTime.Reset()
+	p.doraChangeFailureRate.Reset()
+	p.doraTimeToRestore.Reset()
+	for _, snapshot := range snapshots {
+		labels := prometheus.Labels{
+			"group_by":    snapshot.GroupBy,
+			"key":         snapshot.Key,
+			"name":        snapshot.Name,
+			"window_days": strconv.Itoa(snapshot.WindowDays),
+		}
+		p.doraDeploymentFrequency.With(labels).Set(snapshot.DeploymentsPerDay)
+		p.doraLeadTime.With(labels).Set(snapshot.LeadTimeSeconds)
+		p.doraChangeFailureRate.With(labels).Set(snapshot.ChangeFailureRate)
+		p.doraTimeToRestore.With(labels).Set(snapshot.TimeToRestoreSeconds)
+	}
+
+	// 推送到 Pushgateway
+	return push.New(p.gatewayURL, "deployment_dora").
+		Gatherer(p.registry).
+		PushContext(ctx)
+}
+
 // healthStateToFloat 将健康状态字符串转换为数值。
 func healthStateToFloat(state string) float64 {
 	switch state {
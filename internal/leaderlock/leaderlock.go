@@ -0,0 +1,141 @@
+// Package leaderlock 实现多副本间的选主锁, 保证同一时刻只有一个进程执行单例后台任务 (如任务调度器)。
+//
+// 锁以租约形式存在: 持有者需要在 TTL 内续约, 进程崩溃后租约自然过期, 其他副本即可接手。
+// 锁优先保存在 Redis 中, Redis 未配置或不可用时回退到 leader_locks 表。
+package leaderlock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cy77cc/OpsPilot/internal/model"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+const keyPrefix = "leader:"
+
+// 续约与释放只在值与持有者匹配时生效, 避免误删已被他人接手的锁。
+var (
+	renewScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0`)
+	releaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  return redis.call('DEL', KEYS[1])
+end
+return 0`)
+)
+
+// Lock 是一个具名的选主锁。
+type Lock struct {
+	db    *gorm.DB
+	rdb   redis.UniversalClient
+	name  string
+	owner string
+	ttl   time.Duration
+}
+
+// New 创建选主锁, owner 为空时使用 "主机名:进程号"。
+func New(db *gorm.DB, rdb redis.UniversalClient, name, owner string, ttl time.Duration) *Lock {
+	if strings.TrimSpace(owner) == "" {
+		host, _ := os.Hostname()
+		owner = fmt.Sprintf("%s:%d", host, os.Getpid())
+	}
+	return &Lock{db: db, rdb: rdb, name: name, owner: owner, ttl: ttl}
+}
+
+// Owner 返回本进程的持有者标识。
+func (l *Lock) Owner() string { return l.owner }
+
+func (l *Lock) key() string { return keyPrefix + l.name }
+
+// redisFailed 判断 Redis 错误是否应回退到数据库。redis.Nil 表示键不存在, 不属于故障。
+func redisFailed(err error) bool {
+	return err != nil && !errors.Is(err, redis.Nil)
+}
+
+// TryAcquire 尝试成为持有者; 已经持有时续约。返回本进程当前是否持有锁。
+// 调用方应以小于 TTL 的间隔反复调用, 返回 false 时停止执行单例任务。
+func (l *Lock) TryAcquire(ctx context.Context) (bool, error) {
+	if l.rdb != nil {
+		ok, err := l.acquireRedis(ctx)
+		if !redisFailed(err) {
+			return ok, err
+		}
+	}
+	return l.acquireDB(ctx)
+}
+
+func (l *Lock) acquireRedis(ctx context.Context) (bool, error) {
+	// Redis 恢复前在数据库中获得的锁仍然有效, 先检查数据库后备记录。
+	if holder, err := l.holderDB(ctx); err == nil && holder != "" && holder != l.owner {
+		return false, nil
+	}
+	n, err := renewScript.Run(ctx, l.rdb, []string{l.key()}, l.owner, l.ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	if n == 1 {
+		return true, nil
+	}
+	ok, err := l.rdb.SetNX(ctx, l.key(), l.owner, l.ttl).Result()
+	if err != nil {
+		return false, err
+	}
+	if ok {
+		// 切换到 Redis 后清理本进程在数据库中的后备记录。
+		_ = l.db.WithContext(ctx).Where("name = ? AND owner = ?", l.name, l.owner).Delete(&model.LeaderLock{}).Error
+	}
+	return ok, nil
+}
+
+func (l *Lock) acquireDB(ctx context.Context) (bool, error) {
+	now := time.Now()
+	res := l.db.WithContext(ctx).Model(&model.LeaderLock{}).
+		Where("name = ? AND (expires_at < ? OR owner = ?)", l.name, now, l.owner).
+		Updates(map[string]any{"owner": l.owner, "acquired_at": now, "expires_at": now.Add(l.ttl)})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	if res.RowsAffected > 0 {
+		return true, nil
+	}
+	row := model.LeaderLock{Name: l.name, Owner: l.owner, AcquiredAt: now, ExpiresAt: now.Add(l.ttl)}
+	if err := l.db.WithContext(ctx).Create(&row).Error; err != nil {
+		// 唯一索引冲突: 锁已被他人持有。
+		if holder, herr := l.holderDB(ctx); herr == nil && holder != "" {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Release 放弃持有的锁, 锁已属于其他进程时不做任何操作。
+func (l *Lock) Release(ctx context.Context) error {
+	if l.rdb != nil {
+		// Redis 不可用时锁只可能在数据库中, 无论结果如何都继续清理数据库记录。
+		_, _ = releaseScript.Run(ctx, l.rdb, []string{l.key()}, l.owner).Result()
+	}
+	return l.db.WithContext(ctx).Where("name = ? AND owner = ?", l.name, l.owner).Delete(&model.LeaderLock{}).Error
+}
+
+// holderDB 返回数据库中未过期的持有者, 无人持有时返回空字符串。
+func (l *Lock) holderDB(ctx context.Context) (string, error) {
+	var row model.LeaderLock
+	err := l.db.WithContext(ctx).Where("name = ? AND expires_at >= ?", l.name, time.Now()).First(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return row.Owner, nil
+}
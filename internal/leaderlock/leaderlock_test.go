@@ -0,0 +1,100 @@
+package leaderlock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/cy77cc/OpsPilot/internal/model"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:leaderlock_"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&model.LeaderLock{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+func TestLock_RedisSingleLeader(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	db := newTestDB(t)
+	ctx := context.Background()
+	a := New(db, rdb, "jobs:scheduler", "node-a", time.Minute)
+	b := New(db, rdb, "jobs:scheduler", "node-b", time.Minute)
+
+	if ok, err := a.TryAcquire(ctx); err != nil || !ok {
+		t.Fatalf("expected node-a to lead, ok=%v err=%v", ok, err)
+	}
+	if ok, _ := b.TryAcquire(ctx); ok {
+		t.Fatal("expected a single leader")
+	}
+	// 持有者重复调用即续约。
+	mr.FastForward(40 * time.Second)
+	if ok, err := a.TryAcquire(ctx); err != nil || !ok {
+		t.Fatalf("expected leader to renew, ok=%v err=%v", ok, err)
+	}
+	mr.FastForward(40 * time.Second)
+	if ok, _ := b.TryAcquire(ctx); ok {
+		t.Fatal("renewed lease must not be taken over")
+	}
+
+	// 持有者崩溃: 租约过期后其他副本接手。
+	mr.FastForward(2 * time.Minute)
+	if ok, err := b.TryAcquire(ctx); err != nil || !ok {
+		t.Fatalf("expected node-b to take over, ok=%v err=%v", ok, err)
+	}
+	if err := a.Release(ctx); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if ok, _ := a.TryAcquire(ctx); ok {
+		t.Fatal("releasing a lost lock must not drop the new leader")
+	}
+	_ = b.Release(ctx)
+	if ok, _ := a.TryAcquire(ctx); !ok {
+		t.Fatal("expected lock to be free after release")
+	}
+}
+
+func TestLock_FallsBackToDatabase(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	// 不可达的 Redis: 所有操作回退到数据库。
+	down := redis.NewClient(&redis.Options{Addr: "127.0.0.1:0", MaxRetries: -1})
+	a := New(db, down, "jobs:scheduler", "node-a", time.Minute)
+	b := New(db, nil, "jobs:scheduler", "node-b", time.Minute)
+
+	if ok, err := a.TryAcquire(ctx); err != nil || !ok {
+		t.Fatalf("expected db lock, ok=%v err=%v", ok, err)
+	}
+	if ok, err := b.TryAcquire(ctx); err != nil || ok {
+		t.Fatalf("expected db lock to be exclusive, ok=%v err=%v", ok, err)
+	}
+	if ok, _ := a.TryAcquire(ctx); !ok {
+		t.Fatal("expected db renew")
+	}
+
+	db.Model(&model.LeaderLock{}).Where("name = ?", "jobs:scheduler").Update("expires_at", time.Now().Add(-time.Second))
+	if ok, err := b.TryAcquire(ctx); err != nil || !ok {
+		t.Fatalf("expected expired db lock to be taken over, ok=%v err=%v", ok, err)
+	}
+	if ok, _ := a.TryAcquire(ctx); ok {
+		t.Fatal("previous leader must not renew after takeover")
+	}
+
+	// Redis 恢复后, 数据库中的有效租约仍然独占。
+	mr := miniredis.RunT(t)
+	c := New(db, redis.NewClient(&redis.Options{Addr: mr.Addr()}), "jobs:scheduler", "node-c", time.Minute)
+	if ok, _ := c.TryAcquire(ctx); ok {
+		t.Fatal("expected db lease to stay exclusive when redis comes back")
+	}
+}
@@ -0,0 +1,188 @@
+package logstream
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cy77cc/OpsPilot/internal/logger"
+)
+
+const (
+	// flushInterval 是缓冲的日志行写入存储的最长间隔。
+	flushInterval = 300 * time.Millisecond
+	// maxChunkLines 行缓冲满后立即写入。
+	maxChunkLines = 500
+)
+
+// Appender 为一个流分配序号并批量写入日志行, 可被多个 goroutine 并发使用。
+// nil 的 Appender 丢弃所有日志, 打开流失败时调用方可以照常执行。
+type Appender struct {
+	store  *Store
+	stream string
+
+	mu      sync.Mutex
+	next    int64
+	pending []string
+	first   int64
+	dropped bool
+	flushMu sync.Mutex
+	kick    chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// Open 打开流用于写入, 序号接在流中已有的行之后。
+func (s *Store) Open(ctx context.Context, stream string) (*Appender, error) {
+	last, err := s.LastSeq(ctx, stream)
+	if err != nil {
+		return nil, err
+	}
+	a := &Appender{
+		store:   s,
+		stream:  stream,
+		next:    last + 1,
+		kick:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go a.loop()
+	return a, nil
+}
+
+// Stream 返回流名称。
+func (a *Appender) Stream() string { return a.stream }
+
+// Line 追加一行日志, 超过 MaxLineBytes 的部分截断, 非法的 UTF-8 字节被丢弃。
+func (a *Appender) Line(text string) {
+	if a == nil {
+		return
+	}
+	if len(text) > MaxLineBytes {
+		text = text[:MaxLineBytes] + " [truncated]"
+	}
+	text = strings.ToValidUTF8(text, "")
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.next > MaxLines {
+		if !a.dropped {
+			a.dropped = true
+			a.push(fmt.Sprintf("[opspilot] log exceeds %d lines, further output dropped", MaxLines))
+		}
+		return
+	}
+	a.push(text)
+	if len(a.pending) >= maxChunkLines {
+		select {
+		case a.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Linef 按格式追加一行日志。
+func (a *Appender) Linef(format string, args ...any) {
+	a.Line(fmt.Sprintf(format, args...))
+}
+
+func (a *Appender) push(text string) {
+	if len(a.pending) == 0 {
+		a.first = a.next
+	}
+	a.pending = append(a.pending, text)
+	a.next++
+}
+
+// Flush 立即写入缓冲的日志行。
+func (a *Appender) Flush(ctx context.Context) error {
+	if a == nil {
+		return nil
+	}
+	// 串行写入, 保证分段按序号顺序到达存储。
+	a.flushMu.Lock()
+	defer a.flushMu.Unlock()
+	a.mu.Lock()
+	first, lines := a.first, a.pending
+	a.pending = nil
+	a.mu.Unlock()
+	return a.store.Append(ctx, a.stream, first, lines)
+}
+
+func (a *Appender) loop() {
+	defer close(a.stopped)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.done:
+			return
+		case <-ticker.C:
+		case <-a.kick:
+		}
+		if err := a.Flush(context.Background()); err != nil {
+			logger.L().Warn("flush log stream failed", logger.String("stream", a.stream), logger.Error(err))
+		}
+	}
+}
+
+// Close 停止后台写入并写入剩余的日志行。Close 之后不应再追加日志。
+func (a *Appender) Close() error {
+	if a == nil {
+		return nil
+	}
+	a.once.Do(func() { close(a.done) })
+	<-a.stopped
+	return a.Flush(context.Background())
+}
+
+// Writer 返回按行切分输出的 io.Writer, 每行加上 prefix 后追加到流中。
+// 最后不以换行结束的内容在 LineWriter.Close 时写入。
+func (a *Appender) Writer(prefix string) *LineWriter {
+	return &LineWriter{appender: a, prefix: prefix}
+}
+
+// LineWriter 把输出按行写入 Appender。
+type LineWriter struct {
+	appender *Appender
+	prefix   string
+	mu       sync.Mutex
+	partial  []byte
+}
+
+func (w *LineWriter) Write(p []byte) (int, error) {
+	if w.appender == nil {
+		return len(p), nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		w.appender.Line(w.prefix + string(bytes.TrimSuffix(w.partial[:i], []byte("\r"))))
+		w.partial = w.partial[i+1:]
+	}
+	// 没有换行的超长输出按行长上限切分, 避免缓冲无限增长。
+	for len(w.partial) > MaxLineBytes {
+		w.appender.Line(w.prefix + string(w.partial[:MaxLineBytes]))
+		w.partial = w.partial[MaxLineBytes:]
+	}
+	return len(p), nil
+}
+
+// Close 写入最后不完整的一行。
+func (w *LineWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.partial) > 0 {
+		w.appender.Line(w.prefix + string(bytes.TrimSuffix(w.partial, []byte("\r"))))
+		w.partial = nil
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package logstream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cy77cc/OpsPilot/internal/config"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// pollInterval 是跟随时读取新日志的间隔。
+	pollInterval = 500 * time.Millisecond
+	// keepAliveInterval 内没有新日志时发送心跳, 避免代理断开空闲连接。
+	keepAliveInterval = 15 * time.Second
+	// finishGrace 是发现运行结束后继续读取的时间, 等待写入方刷新缓冲的日志行。
+	finishGrace = 2 * flushInterval
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+	CheckOrigin:     checkOrigin,
+}
+
+// checkOrigin 只接受同源或 cors.allow_origins 中明确列出的来源的 WebSocket 升级,
+// 避免其他站点借用户的登录态跨站读取日志。通配符 * 不放行跨源的 WebSocket;
+// 没有 Origin 头的请求来自非浏览器客户端, 直接放行。
+func checkOrigin(r *http.Request) bool {
+	origin := strings.TrimSpace(r.Header.Get("Origin"))
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range config.CFG.Cors.AllowOrigins {
+		if allowed = strings.TrimSuffix(strings.TrimSpace(allowed), "/"); allowed != "*" && strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// FinishedFunc 报告流所属的运行是否已经结束。运行结束后流可能因归档失败而没有归档,
+// 跟随时据此结束, 而不是一直等待。
+type FinishedFunc func(ctx context.Context) (bool, error)
+
+// Frame 是跟随时推送给客户端的消息。Offset 为已推送的最后一行序号, 重连时作为 after 传回。
+type Frame struct {
+	Type   string `json:"type"` // lines|end|error
+	Offset int64  `json:"offset"`
+	Lines  []Line `json:"lines,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Follow 把流中序号大于 after 的日志推送给客户端, 直到流完成、所属运行结束或客户端断开。
+// finished 为 nil 时只在流完成 (已归档) 时结束。
+func (s *Store) Follow(ctx context.Context, stream string, after int64, finished FinishedFunc, send func(Frame) error) error {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	var endAt time.Time
+	for {
+		if endAt.IsZero() && finished != nil {
+			ended, err := finished(ctx)
+			if err != nil {
+				return err
+			}
+			if ended {
+				endAt = time.Now().Add(finishGrace)
+			}
+		}
+		for {
+			lines, done, err := s.Read(ctx, stream, after, DefaultReadLimit)
+			if err != nil {
+				return err
+			}
+			if len(lines) > 0 {
+				after = lines[len(lines)-1].Seq
+				if err := send(Frame{Type: "lines", Offset: after, Lines: lines}); err != nil {
+					return err
+				}
+			}
+			if done {
+				return send(Frame{Type: "end", Offset: after})
+			}
+			if len(lines) < DefaultReadLimit {
+				break
+			}
+		}
+		if !endAt.IsZero() && !time.Now().Before(endAt) {
+			return send(Frame{Type: "end", Offset: after})
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// ServeFollow 处理跟随日志流的 HTTP 请求: WebSocket 升级请求使用 WebSocket, 其余使用 SSE。
+// 起始位置取查询参数 after, SSE 断线重连时取 Last-Event-ID。finished 见 Follow。
+func (s *Store) ServeFollow(c *gin.Context, stream string, finished FinishedFunc) {
+	after, _ := strconv.ParseInt(strings.TrimSpace(c.Query("after")), 10, 64)
+	if id := strings.TrimSpace(c.GetHeader("Last-Event-ID")); id != "" {
+		after, _ = strconv.ParseInt(id, 10, 64)
+	}
+	after = max(after, 0)
+	if websocket.IsWebSocketUpgrade(c.Request) {
+		s.serveWebSocket(c, stream, after, finished)
+		return
+	}
+	s.serveSSE(c, stream, after, finished)
+}
+
+func (s *Store) serveSSE(c *gin.Context, stream string, after int64, finished FinishedFunc) {
+	flusher, ok := c.Writer.(http.Flusher)
+	if !ok {
+		c.String(http.StatusInternalServerError, "streaming unsupported")
+		return
+	}
+	c.Writer.Header().Set("Content-Type", "text/event-stream")
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+	c.Writer.Header().Set("Connection", "keep-alive")
+	c.Writer.Header().Set("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	flusher.Flush()
+
+	ctx := c.Request.Context()
+	frames := make(chan Frame)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- s.Follow(ctx, stream, after, finished, func(f Frame) error {
+			select {
+			case frames <- f:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}()
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case f := <-frames:
+			data, _ := json.Marshal(f)
+			fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", f.Offset, f.Type, data)
+			flusher.Flush()
+		case err := <-errc:
+			if err != nil && ctx.Err() == nil {
+				data, _ := json.Marshal(Frame{Type: "error", Error: err.Error()})
+				fmt.Fprintf(c.Writer, "event: error\ndata: %s\n\n", data)
+				flusher.Flush()
+			}
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(c.Writer, ": ping\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+func (s *Store) serveWebSocket(c *gin.Context, stream string, after int64, finished FinishedFunc) {
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+	// 客户端只接收消息, 读取循环用于感知断开。
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	err = s.Follow(ctx, stream, after, finished, func(f Frame) error {
+		return conn.WriteJSON(f)
+	})
+	if err != nil && ctx.Err() == nil {
+		_ = conn.WriteJSON(Frame{Type: "error", Error: err.Error()})
+	}
+	_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+}
@@ -0,0 +1,230 @@
+package logstream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/cy77cc/OpsPilot/internal/model"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:logstream_"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&model.LogChunk{}, &model.LogArchive{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+func writeLines(t *testing.T, s *Store, stream string, prefix string, n int) {
+	t.Helper()
+	a, err := s.Open(context.Background(), stream)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	w := a.Writer(prefix)
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(w, "line %d\r\n", i)
+	}
+	fmt.Fprint(w, "tail")
+	_ = w.Close()
+	if err := a.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+}
+
+func TestStore_RedisStreamResumeAndCompact(t *testing.T) {
+	mr := miniredis.RunT(t)
+	db := newTestDB(t)
+	s := New(db, redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	ctx := context.Background()
+
+	writeLines(t, s, "cicd:run:1", "", 1200)
+	var chunks int64
+	db.Model(&model.LogChunk{}).Count(&chunks)
+	if !mr.Exists(redisKey("cicd:run:1")) || chunks != 0 {
+		t.Fatalf("expected lines in redis only, db chunks=%d", chunks)
+	}
+	lines, done, err := s.Read(ctx, "cicd:run:1", 0, 0)
+	if err != nil || done || len(lines) != DefaultReadLimit || lines[0].Text != "line 1" || lines[999].Seq != 1000 {
+		t.Fatalf("unexpected first page: %d lines done=%v err=%v", len(lines), done, err)
+	}
+	lines, _, _ = s.Read(ctx, "cicd:run:1", 1150, 0)
+	if len(lines) != 51 || lines[0].Seq != 1151 || lines[50].Text != "tail" {
+		t.Fatalf("expected resume from offset, got %d lines %+v", len(lines), lines[:1])
+	}
+
+	// 追加写入接在已有序号之后。
+	a, _ := s.Open(ctx, "cicd:run:1")
+	a.Line("appended")
+	_ = a.Close()
+	if last, _ := s.LastSeq(ctx, "cicd:run:1"); last != 1202 {
+		t.Fatalf("expected last seq 1202, got %d", last)
+	}
+
+	if err := s.Complete(ctx, "cicd:run:1"); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	if mr.Exists(redisKey("cicd:run:1")) {
+		t.Fatal("expected redis stream to be removed after compaction")
+	}
+	lines, done, _ = s.Read(ctx, "cicd:run:1", 1200, 0)
+	if !done || len(lines) != 2 || lines[0].Text != "tail" || lines[1].Seq != 1202 {
+		t.Fatalf("expected archived tail, got %+v done=%v", lines, done)
+	}
+	if lines, done, _ = s.Read(ctx, "cicd:run:1", 1202, 0); !done || len(lines) != 0 {
+		t.Fatalf("expected finished stream, got %+v done=%v", lines, done)
+	}
+}
+
+func TestStore_FallsBackToDatabase(t *testing.T) {
+	db := newTestDB(t)
+	down := redis.NewClient(&redis.Options{Addr: "127.0.0.1:0", MaxRetries: -1})
+	s := New(db, down)
+	ctx := context.Background()
+
+	writeLines(t, s, "jobs:execution:7", "[web-1] ", 3)
+	var chunks int64
+	db.Model(&model.LogChunk{}).Where("stream = ?", "jobs:execution:7").Count(&chunks)
+	if chunks == 0 {
+		t.Fatal("expected chunks in the database")
+	}
+	text, err := s.Text(ctx, "jobs:execution:7")
+	if err != nil || text != "[web-1] line 1\n[web-1] line 2\n[web-1] line 3\n[web-1] tail" {
+		t.Fatalf("unexpected text %q %v", text, err)
+	}
+	// 缺失的分段在压缩时以空行补齐, 序号保持不变。
+	_ = s.Append(ctx, "jobs:execution:7", 7, []string{"late"})
+	if lines, _, _ := s.Read(ctx, "jobs:execution:7", 4, 0); len(lines) != 0 {
+		t.Fatalf("expected read to stop at a gap, got %+v", lines)
+	}
+	if err := s.Complete(ctx, "jobs:execution:7"); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	db.Model(&model.LogChunk{}).Where("stream = ?", "jobs:execution:7").Count(&chunks)
+	lines, done, _ := s.Read(ctx, "jobs:execution:7", 4, 0)
+	if chunks != 0 || !done || len(lines) != 3 || lines[2].Seq != 7 || lines[2].Text != "late" {
+		t.Fatalf("expected compacted archive, chunks=%d lines=%+v", chunks, lines)
+	}
+}
+
+func TestServeFollow(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := New(newTestDB(t), nil)
+	ctx := context.Background()
+	a, _ := s.Open(ctx, "automation:run:x")
+	a.Line("first")
+	a.Line("second")
+	_ = a.Flush(ctx)
+
+	r := gin.New()
+	r.GET("/logs", func(c *gin.Context) { s.ServeFollow(c, "automation:run:x", nil) })
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	// 流完成后 SSE 推送剩余的行和结束事件。
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		a.Line("third")
+		_ = a.Close()
+		_ = s.Complete(ctx, "automation:run:x")
+	}()
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/logs", nil)
+	req.Header.Set("Last-Event-ID", "1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("sse request: %v", err)
+	}
+	var body strings.Builder
+	buf := make([]byte, 4096)
+	for {
+		n, err := resp.Body.Read(buf)
+		body.Write(buf[:n])
+		if err != nil {
+			break
+		}
+	}
+	resp.Body.Close()
+	out := body.String()
+	if strings.Contains(out, `"first"`) || !strings.Contains(out, `"second"`) || !strings.Contains(out, `"third"`) ||
+		!strings.Contains(out, "event: end") || !strings.Contains(out, "id: 3") {
+		t.Fatalf("unexpected sse output:\n%s", out)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/logs?after=2", nil)
+	if err != nil {
+		t.Fatalf("websocket dial: %v", err)
+	}
+	defer conn.Close()
+	var frames []Frame
+	for {
+		_, raw, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		var f Frame
+		_ = json.Unmarshal(raw, &f)
+		frames = append(frames, f)
+	}
+	if len(frames) != 2 || frames[0].Lines[0].Text != "third" || frames[1].Type != "end" || frames[1].Offset != 3 {
+		t.Fatalf("unexpected websocket frames %+v", frames)
+	}
+}
+
+func TestFollowEndsWhenRunFinishedWithoutArchive(t *testing.T) {
+	s := New(newTestDB(t), nil)
+	ctx := context.Background()
+	a, _ := s.Open(ctx, "cicd:run:9")
+	a.Line("only")
+	_ = a.Close()
+
+	// 归档失败时流没有完成, 运行已结束时仍应推送结束帧。
+	done := make(chan []Frame, 1)
+	go func() {
+		var frames []Frame
+		_ = s.Follow(ctx, "cicd:run:9", 0, func(context.Context) (bool, error) { return true, nil }, func(f Frame) error {
+			frames = append(frames, f)
+			return nil
+		})
+		done <- frames
+	}()
+	select {
+	case frames := <-done:
+		if len(frames) != 2 || frames[0].Lines[0].Text != "only" || frames[1].Type != "end" || frames[1].Offset != 1 {
+			t.Fatalf("unexpected frames %+v", frames)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected follow to end once the run finished")
+	}
+}
+
+func TestCheckOrigin(t *testing.T) {
+	req := func(host, origin string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "http://"+host+"/logs", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		return r
+	}
+	if !checkOrigin(req("ops.local", "")) || !checkOrigin(req("ops.local", "https://ops.local")) {
+		t.Fatal("expected requests without origin and same-origin requests to be accepted")
+	}
+	if checkOrigin(req("ops.local", "https://evil.example")) {
+		t.Fatal("expected cross-origin request to be rejected")
+	}
+}
@@ -0,0 +1,302 @@
+// Package logstream 实现运行日志的实时流。
+//
+// 执行器通过 Appender 按行写入日志, 每行在流内有从 1 开始递增的序号, 多行合并为一段批量写入:
+// 优先写入 Redis Stream, Redis 未配置或不可用时写入 log_chunks 表。
+// 客户端按序号从任意位置读取或跟随 (SSE / WebSocket), 断线后从上次的序号继续。
+// 运行结束时调用 Complete 把全部日志压缩为一条 log_archives 记录并删除分段。
+//
+// CI 运行、任务执行和自动化运行共用本包, 流名称由各模块自行约定, 如 cicd:run:12。
+package logstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/cy77cc/OpsPilot/internal/model"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	keyPrefix = "logstream:"
+	// redisTTL 之后未完成的 Redis 流自动删除, 避免执行器崩溃后残留。
+	redisTTL = 24 * time.Hour
+	// redisRetryAfter 内不再访问出错的 Redis, 期间只使用数据库。
+	redisRetryAfter = 30 * time.Second
+
+	// DefaultReadLimit 是单次读取返回的最大行数。
+	DefaultReadLimit = 1000
+	// MaxLineBytes 是单行的最大字节数, 超出部分截断。
+	MaxLineBytes = 8 << 10
+	// MaxLines 是单个流的最大行数, 超出后丢弃并记录一行提示。
+	MaxLines = 200000
+)
+
+// Line 是日志流中的一行。
+type Line struct {
+	Seq  int64  `json:"seq"`
+	Text string `json:"text"`
+}
+
+// Store 读写日志流。
+type Store struct {
+	db       *gorm.DB
+	rdb      redis.UniversalClient
+	downTill atomic.Int64 // Redis 出错后暂停使用直到该时间 (UnixNano)
+}
+
+// New 创建日志流存储, rdb 为 nil 时只使用数据库。
+func New(db *gorm.DB, rdb redis.UniversalClient) *Store {
+	return &Store{db: db, rdb: rdb}
+}
+
+func redisKey(stream string) string { return keyPrefix + stream }
+
+// redis 返回可用的 Redis 客户端, 未配置或暂停使用时返回 nil。
+func (s *Store) redis() redis.UniversalClient {
+	if s.rdb == nil || time.Now().UnixNano() < s.downTill.Load() {
+		return nil
+	}
+	return s.rdb
+}
+
+// redisOK 检查 Redis 调用结果, 出错时暂停使用 Redis。redis.Nil 表示键不存在, 不属于故障。
+func (s *Store) redisOK(err error) bool {
+	if err != nil && !errors.Is(err, redis.Nil) {
+		s.downTill.Store(time.Now().Add(redisRetryAfter).UnixNano())
+		return false
+	}
+	return true
+}
+
+// chunk 是一段连续的日志行, 第一行序号为 seq。
+type chunk struct {
+	seq   int64
+	lines []string
+}
+
+func (c chunk) last() int64 { return c.seq + int64(len(c.lines)) - 1 }
+
+// Append 写入从序号 first 开始的连续日志行。
+func (s *Store) Append(ctx context.Context, stream string, first int64, lines []string) error {
+	if len(lines) == 0 {
+		return nil
+	}
+	if first < 1 {
+		return fmt.Errorf("logstream: invalid sequence %d", first)
+	}
+	c := chunk{seq: first, lines: lines}
+	data := strings.Join(lines, "\n")
+	if rdb := s.redis(); rdb != nil {
+		err := rdb.XAdd(ctx, &redis.XAddArgs{
+			Stream: redisKey(stream),
+			ID:     fmt.Sprintf("%d-0", first),
+			Values: map[string]any{"last": c.last(), "data": data},
+		}).Err()
+		if s.redisOK(err) {
+			_ = rdb.Expire(ctx, redisKey(stream), redisTTL).Err()
+			return nil
+		}
+	}
+	row := model.LogChunk{Stream: stream, Seq: first, LastSeq: c.last(), Data: data}
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&row).Error
+}
+
+// LastSeq 返回流中最后一行的序号, 流不存在时返回 0。
+func (s *Store) LastSeq(ctx context.Context, stream string) (int64, error) {
+	archive, err := s.archive(ctx, stream)
+	if err != nil {
+		return 0, err
+	}
+	if archive != nil {
+		return archive.Lines, nil
+	}
+	var last int64
+	if rdb := s.redis(); rdb != nil {
+		msgs, err := rdb.XRevRangeN(ctx, redisKey(stream), "+", "-", 1).Result()
+		if s.redisOK(err) && len(msgs) > 0 {
+			last = parseChunk(msgs[0]).last()
+		}
+	}
+	var row model.LogChunk
+	err = s.db.WithContext(ctx).Where("stream = ?", stream).Order("last_seq DESC").Limit(1).Find(&row).Error
+	if err != nil {
+		return 0, err
+	}
+	return max(last, row.LastSeq), nil
+}
+
+// Read 返回序号大于 after 的最多 limit 行 (limit <= 0 时为 DefaultReadLimit)。
+// done 表示流已完成且没有更多的行。
+func (s *Store) Read(ctx context.Context, stream string, after int64, limit int) ([]Line, bool, error) {
+	return s.read(ctx, stream, after, limit, false)
+}
+
+// read 实现 Read。fillGaps 为 true 时缺失的行以空行补齐, 用于写入已经结束的流。
+func (s *Store) read(ctx context.Context, stream string, after int64, limit int, fillGaps bool) ([]Line, bool, error) {
+	if limit <= 0 {
+		limit = DefaultReadLimit
+	}
+	archive, err := s.archive(ctx, stream)
+	if err != nil {
+		return nil, false, err
+	}
+	if archive != nil {
+		lines := archiveLines(archive)
+		if after >= int64(len(lines)) {
+			return nil, true, nil
+		}
+		out := make([]Line, 0, min(limit, len(lines)-int(after)))
+		for i := after; i < int64(len(lines)) && len(out) < limit; i++ {
+			out = append(out, Line{Seq: i + 1, Text: lines[i]})
+		}
+		return out, after+int64(len(out)) >= int64(len(lines)), nil
+	}
+
+	chunks, err := s.chunks(ctx, stream, after, limit)
+	if err != nil {
+		return nil, false, err
+	}
+	out := make([]Line, 0)
+	next := after + 1
+	for _, c := range chunks {
+		for i, text := range c.lines {
+			seq := c.seq + int64(i)
+			if seq < next {
+				continue
+			}
+			for fillGaps && seq > next && len(out) < limit {
+				out = append(out, Line{Seq: next})
+				next++
+			}
+			if seq > next || len(out) >= limit {
+				// 中间的段尚未写入 (并发写入时可能短暂出现), 下次读取再继续。
+				return out, false, nil
+			}
+			out = append(out, Line{Seq: seq, Text: text})
+			next++
+		}
+	}
+	return out, false, nil
+}
+
+// chunks 返回可能包含序号大于 after 的行的分段, 按序号排序。
+func (s *Store) chunks(ctx context.Context, stream string, after int64, limit int) ([]chunk, error) {
+	out := make([]chunk, 0)
+	if rdb := s.redis(); rdb != nil {
+		key := redisKey(stream)
+		start := "-"
+		// 从包含 after+1 的段开始读取。
+		prev, err := rdb.XRevRangeN(ctx, key, fmt.Sprintf("%d-0", after+1), "-", 1).Result()
+		if s.redisOK(err) && len(prev) > 0 {
+			start = prev[0].ID
+		}
+		if err == nil {
+			msgs, err := rdb.XRangeN(ctx, key, start, "+", int64(limit)).Result()
+			if s.redisOK(err) {
+				for _, msg := range msgs {
+					out = append(out, parseChunk(msg))
+				}
+			}
+		}
+	}
+	rows := make([]model.LogChunk, 0)
+	if err := s.db.WithContext(ctx).Where("stream = ? AND last_seq > ?", stream, after).
+		Order("seq ASC").Limit(limit).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		out = append(out, chunk{seq: row.Seq, lines: strings.Split(row.Data, "\n")})
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].seq < out[j].seq })
+	return out, nil
+}
+
+func parseChunk(msg redis.XMessage) chunk {
+	seq, _ := strconv.ParseInt(strings.TrimSuffix(msg.ID, "-0"), 10, 64)
+	data, _ := msg.Values["data"].(string)
+	return chunk{seq: seq, lines: strings.Split(data, "\n")}
+}
+
+// Complete 把流中的全部日志压缩保存到 log_archives, 并删除 Redis 与数据库中的分段。
+// 流已完成时不做任何操作。
+func (s *Store) Complete(ctx context.Context, stream string) error {
+	if archive, err := s.archive(ctx, stream); err != nil || archive != nil {
+		return err
+	}
+	content, lines, err := s.collect(ctx, stream)
+	if err != nil {
+		return err
+	}
+	row := model.LogArchive{Stream: stream, Lines: lines, Size: int64(len(content)), Content: content}
+	if err := s.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&row).Error; err != nil {
+		return err
+	}
+	if rdb := s.redis(); rdb != nil {
+		s.redisOK(rdb.Del(ctx, redisKey(stream)).Err())
+	}
+	return s.db.WithContext(ctx).Where("stream = ?", stream).Delete(&model.LogChunk{}).Error
+}
+
+// Text 返回流中的全部日志, 行之间以换行分隔。
+func (s *Store) Text(ctx context.Context, stream string) (string, error) {
+	archive, err := s.archive(ctx, stream)
+	if err != nil {
+		return "", err
+	}
+	if archive != nil {
+		return archive.Content, nil
+	}
+	content, _, err := s.collect(ctx, stream)
+	return content, err
+}
+
+// collect 读取尚未完成的流中的全部日志, 返回内容与最后一行的序号。
+func (s *Store) collect(ctx context.Context, stream string) (string, int64, error) {
+	var (
+		b     strings.Builder
+		after int64
+	)
+	for {
+		lines, _, err := s.read(ctx, stream, after, DefaultReadLimit, true)
+		if err != nil {
+			return "", 0, err
+		}
+		if len(lines) == 0 {
+			return b.String(), after, nil
+		}
+		for _, line := range lines {
+			if after > 0 {
+				b.WriteByte('\n')
+			}
+			b.WriteString(line.Text)
+			after = line.Seq
+		}
+	}
+}
+
+func (s *Store) archive(ctx context.Context, stream string) (*model.LogArchive, error) {
+	var row model.LogArchive
+	err := s.db.WithContext(ctx).Where("stream = ?", stream).First(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+func archiveLines(row *model.LogArchive) []string {
+	if row.Lines == 0 {
+		return nil
+	}
+	return strings.Split(row.Content, "\n")
+}
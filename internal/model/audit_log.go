@@ -20,21 +20,23 @@ func (AuditLog) TableName() string {
 
 // AuditLog action types
 const (
-	AuditActionReleaseApply    = "release_apply"
-	AuditActionReleaseApprove  = "release_approve"
-	AuditActionReleaseReject   = "release_reject"
-	AuditActionReleaseRollback = "release_rollback"
-	AuditActionTargetCreate    = "target_create"
-	AuditActionTargetUpdate    = "target_update"
-	AuditActionTargetDelete    = "target_delete"
-	AuditActionClusterBootstrap = "cluster_bootstrap"
-	AuditActionCredentialCreate = "credential_create"
-	AuditActionCredentialTest   = "credential_test"
+	AuditActionReleaseApply         = "release_apply"
+	AuditActionReleaseApprove       = "release_approve"
+	AuditActionReleaseReject        = "release_reject"
+	AuditActionReleaseRollback      = "release_rollback"
+	AuditActionReleaseFreezeBlocked = "release_freeze_blocked"
+	AuditActionTargetCreate         = "target_create"
+	AuditActionTargetUpdate         = "target_update"
+	AuditActionTargetDelete         = "target_delete"
+	AuditActionClusterBootstrap     = "cluster_bootstrap"
+	AuditActionCredentialCreate     = "credential_create"
+	AuditActionCredentialTest       = "credential_test"
 )
 
 // AuditLog resource types
 const (
 	AuditResourceRelease    = "release"
+	AuditResourceService    = "service"
 	AuditResourceTarget     = "target"
 	AuditResourceCluster    = "cluster"
 	AuditResourceCredential = "credential"
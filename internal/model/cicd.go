@@ -9,6 +9,8 @@ type CICDServiceCIConfig struct {
 	Branch         string    `gorm:"column:branch;type:varchar(128);default:'main'" json:"branch"`
 	BuildStepsJSON string    `gorm:"column:build_steps_json;type:longtext" json:"build_steps_json"`
 	ArtifactTarget string    `gorm:"column:artifact_target;type:varchar(512);not null" json:"artifact_target"`
+	TagPattern     string    `gorm:"column:tag_pattern;type:varchar(128);default:''" json:"tag_pattern"`
+	WebhookSecret  string    `gorm:"column:webhook_secret;type:varchar(255);default:''" json:"-"`
 	TriggerMode    string    `gorm:"column:trigger_mode;type:varchar(32);not null;default:'manual'" json:"trigger_mode"`
 	Status         string    `gorm:"column:status;type:varchar(32);not null;default:'active'" json:"status"`
 	UpdatedBy      uint      `gorm:"column:updated_by;not null;default:0" json:"updated_by"`
@@ -19,31 +21,99 @@ type CICDServiceCIConfig struct {
 func (CICDServiceCIConfig) TableName() string { return "cicd_service_ci_configs" }
 
 type CICDServiceCIRun struct {
-	ID          uint      `gorm:"primaryKey;column:id" json:"id"`
-	ServiceID   uint      `gorm:"column:service_id;not null;index:idx_cicd_ci_runs_service" json:"service_id"`
-	CIConfigID  uint      `gorm:"column:ci_config_id;not null;index" json:"ci_config_id"`
-	TriggerType string    `gorm:"column:trigger_type;type:varchar(32);not null" json:"trigger_type"`
-	Status      string    `gorm:"column:status;type:varchar(32);not null;default:'queued'" json:"status"`
-	Reason      string    `gorm:"column:reason;type:varchar(512);default:''" json:"reason"`
-	TriggeredBy uint      `gorm:"column:triggered_by;not null;default:0;index" json:"triggered_by"`
-	TriggeredAt time.Time `gorm:"column:triggered_at;not null" json:"triggered_at"`
-	CreatedAt   time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
-	UpdatedAt   time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+	ID                uint       `gorm:"primaryKey;column:id" json:"id"`
+	ServiceID         uint       `gorm:"column:service_id;not null;index:idx_cicd_ci_runs_service" json:"service_id"`
+	CIConfigID        uint       `gorm:"column:ci_config_id;not null;index" json:"ci_config_id"`
+	TriggerType       string     `gorm:"column:trigger_type;type:varchar(32);not null" json:"trigger_type"`
+	Status            string     `gorm:"column:status;type:varchar(32);not null;default:'queued'" json:"status"`
+	Reason            string     `gorm:"column:reason;type:varchar(512);default:''" json:"reason"`
+	TriggeredBy       uint       `gorm:"column:triggered_by;not null;default:0;index" json:"triggered_by"`
+	TriggeredAt       time.Time  `gorm:"column:triggered_at;not null" json:"triggered_at"`
+	Branch            string     `gorm:"column:branch;type:varchar(128);default:''" json:"branch"`
+	RefType           string     `gorm:"column:ref_type;type:varchar(16);default:'branch'" json:"ref_type"` // branch|tag
+	CommitSHA         string     `gorm:"column:commit_sha;type:varchar(64);default:''" json:"commit_sha"`
+	CommitAuthor      string     `gorm:"column:commit_author;type:varchar(128);default:''" json:"commit_author"`
+	CommitMessage     string     `gorm:"column:commit_message;type:text" json:"commit_message"`
+	WebhookDeliveryID uint       `gorm:"column:webhook_delivery_id;not null;default:0;index" json:"webhook_delivery_id"`
+	ArtifactRef       string     `gorm:"column:artifact_ref;type:varchar(512);default:''" json:"artifact_ref"`
+	Runner            string     `gorm:"column:runner;type:varchar(128);default:''" json:"runner"`
+	Workspace         string     `gorm:"column:workspace;type:varchar(512);default:''" json:"workspace"` // 运行挂起在人工卡点时保留的工作目录
+	ErrorMessage      string     `gorm:"column:error_message;type:text" json:"error_message"`
+	PipelineSource    string     `gorm:"column:pipeline_source;type:varchar(16);default:''" json:"pipeline_source"` // file|config
+	PipelineYAML      string     `gorm:"column:pipeline_yaml;type:mediumtext" json:"pipeline_yaml"`
+	PipelineJSON      string     `gorm:"column:pipeline_json;type:mediumtext" json:"pipeline_json"`
+	AutoDeployJSON    string     `gorm:"column:auto_deploy_json;type:text" json:"auto_deploy_json"` // 运行成功后自动发布的结果 (JSON)
+	StartedAt         *time.Time `gorm:"column:started_at" json:"started_at"`
+	FinishedAt        *time.Time `gorm:"column:finished_at" json:"finished_at"`
+	HeartbeatAt       *time.Time `gorm:"column:heartbeat_at;index" json:"heartbeat_at"`
+	CreatedAt         time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt         time.Time  `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
 }
 
 func (CICDServiceCIRun) TableName() string { return "cicd_service_ci_runs" }
 
+// CICDServiceCIRunStep 是 CI 运行中的单个步骤 (拉取代码、构建、推送制品、人工卡点、部署) 及其日志。
+type CICDServiceCIRunStep struct {
+	ID         uint       `gorm:"primaryKey;column:id" json:"id"`
+	RunID      uint       `gorm:"column:run_id;not null;index:idx_cicd_ci_run_steps_run" json:"run_id"`
+	Seq        int        `gorm:"column:seq;not null;default:0" json:"seq"`
+	Stage      string     `gorm:"column:stage;type:varchar(64);default:''" json:"stage"`
+	Kind       string     `gorm:"column:kind;type:varchar(16);default:'command'" json:"kind"` // clone|command|manual|publish|deploy
+	Name       string     `gorm:"column:name;type:varchar(128);not null" json:"name"`
+	Image      string     `gorm:"column:image;type:varchar(255);default:''" json:"image"`
+	Command    string     `gorm:"column:command;type:text" json:"command"`
+	ApprovedBy uint       `gorm:"column:approved_by;not null;default:0" json:"approved_by"`
+	Status     string     `gorm:"column:status;type:varchar(32);not null;default:'pending'" json:"status"`
+	ExitCode   int        `gorm:"column:exit_code;not null;default:0" json:"exit_code"`
+	Log        string     `gorm:"column:log;type:longtext" json:"log"`
+	StartedAt  *time.Time `gorm:"column:started_at" json:"started_at"`
+	FinishedAt *time.Time `gorm:"column:finished_at" json:"finished_at"`
+	CreatedAt  time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt  time.Time  `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+func (CICDServiceCIRunStep) TableName() string { return "cicd_service_ci_run_steps" }
+
+// CICDWebhookDelivery 是一次 Git 服务器 webhook 投递记录, 保留原始请求用于重放和排查。
+type CICDWebhookDelivery struct {
+	ID                    uint      `gorm:"primaryKey;column:id" json:"id"`
+	Provider              string    `gorm:"column:provider;type:varchar(16);not null;index:idx_cicd_webhook_deliveries_delivery,priority:1" json:"provider"`
+	DeliveryID            string    `gorm:"column:delivery_id;type:varchar(128);not null;default:'';index:idx_cicd_webhook_deliveries_delivery,priority:2" json:"delivery_id"`
+	Event                 string    `gorm:"column:event;type:varchar(64);default:''" json:"event"`
+	RepoURL               string    `gorm:"column:repo_url;type:varchar(512);default:''" json:"repo_url"`
+	Ref                   string    `gorm:"column:ref;type:varchar(255);default:''" json:"ref"`
+	CommitSHA             string    `gorm:"column:commit_sha;type:varchar(64);default:''" json:"commit_sha"`
+	Author                string    `gorm:"column:author;type:varchar(128);default:''" json:"author"`
+	Status                string    `gorm:"column:status;type:varchar(32);not null;default:'received';index" json:"status"` // received|triggered|ignored|duplicate|rejected|invalid
+	Detail                string    `gorm:"column:detail;type:varchar(512);default:''" json:"detail"`
+	HeadersJSON           string    `gorm:"column:headers_json;type:longtext" json:"headers_json"`
+	Payload               string    `gorm:"column:payload;type:longtext" json:"payload"`
+	VerifiedConfigIDsJSON string    `gorm:"column:verified_config_ids_json;type:text" json:"verified_config_ids_json"`
+	RunIDsJSON            string    `gorm:"column:run_ids_json;type:text" json:"run_ids_json"`
+	ClaimKey              *string   `gorm:"column:claim_key;type:varchar(160);uniqueIndex:uk_cicd_webhook_deliveries_claim" json:"-"` // provider:delivery_id, 同一投递只能由一条验证通过的记录占用
+	ReplayOf              uint      `gorm:"column:replay_of;not null;default:0;index" json:"replay_of"`
+	ReplayedBy            uint      `gorm:"column:replayed_by;not null;default:0" json:"replayed_by"`
+	CreatedAt             time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt             time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+func (CICDWebhookDelivery) TableName() string { return "cicd_webhook_deliveries" }
+
 type CICDDeploymentCDConfig struct {
-	ID                 uint      `gorm:"primaryKey;column:id" json:"id"`
-	DeploymentID       uint      `gorm:"column:deployment_id;not null;index:uk_cicd_deploy_env,priority:1" json:"deployment_id"`
-	Env                string    `gorm:"column:env;type:varchar(32);not null;index:uk_cicd_deploy_env_runtime,priority:2" json:"env"`
-	RuntimeType        string    `gorm:"column:runtime_type;type:varchar(16);not null;default:'k8s';index:uk_cicd_deploy_env_runtime,priority:3" json:"runtime_type"`
-	Strategy           string    `gorm:"column:strategy;type:varchar(32);not null;default:'rolling'" json:"strategy"`
-	StrategyConfigJSON string    `gorm:"column:strategy_config_json;type:longtext" json:"strategy_config_json"`
-	ApprovalRequired   bool      `gorm:"column:approval_required;not null;default:false" json:"approval_required"`
-	UpdatedBy          uint      `gorm:"column:updated_by;not null;default:0" json:"updated_by"`
-	CreatedAt          time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
-	UpdatedAt          time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+	ID                     uint      `gorm:"primaryKey;column:id" json:"id"`
+	DeploymentID           uint      `gorm:"column:deployment_id;not null;index:uk_cicd_deploy_env,priority:1" json:"deployment_id"`
+	Env                    string    `gorm:"column:env;type:varchar(32);not null;index:uk_cicd_deploy_env_runtime,priority:2" json:"env"`
+	RuntimeType            string    `gorm:"column:runtime_type;type:varchar(16);not null;default:'k8s';index:uk_cicd_deploy_env_runtime,priority:3" json:"runtime_type"`
+	Strategy               string    `gorm:"column:strategy;type:varchar(32);not null;default:'rolling'" json:"strategy"`
+	StrategyConfigJSON     string    `gorm:"column:strategy_config_json;type:longtext" json:"strategy_config_json"`
+	ApprovalRequired       bool      `gorm:"column:approval_required;not null;default:false" json:"approval_required"`
+	ServiceID              uint      `gorm:"column:service_id;not null;default:0;index" json:"service_id"`
+	AutoDeploy             bool      `gorm:"column:auto_deploy;not null;default:false" json:"auto_deploy"` // 开启后 ServiceID 的 CI 运行在匹配的分支/tag 上成功时自动发布
+	AutoDeployBranchesJSON string    `gorm:"column:auto_deploy_branches_json;type:text" json:"auto_deploy_branches_json"`
+	AutoDeployTagsJSON     string    `gorm:"column:auto_deploy_tags_json;type:text" json:"auto_deploy_tags_json"`
+	UpdatedBy              uint      `gorm:"column:updated_by;not null;default:0" json:"updated_by"`
+	CreatedAt              time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt              time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
 }
 
 func (CICDDeploymentCDConfig) TableName() string { return "cicd_deployment_cd_configs" }
@@ -99,3 +169,25 @@ type CICDAuditEvent struct {
 }
 
 func (CICDAuditEvent) TableName() string { return "cicd_audit_events" }
+
+// CICDArtifact 是 CI 运行成功后推送的制品, 发布通过 digest 固定到具体制品。
+type CICDArtifact struct {
+	ID            uint       `gorm:"primaryKey;column:id" json:"id"`
+	ServiceID     uint       `gorm:"column:service_id;not null;index:idx_cicd_artifacts_service" json:"service_id"`
+	CIRunID       uint       `gorm:"column:ci_run_id;not null;uniqueIndex:uk_cicd_artifacts_run" json:"ci_run_id"`
+	Kind          string     `gorm:"column:kind;type:varchar(16);not null" json:"kind"` // image|file
+	Reference     string     `gorm:"column:reference;type:varchar(512);not null" json:"reference"`
+	Digest        string     `gorm:"column:digest;type:varchar(128);not null;index" json:"digest"`
+	CommitSHA     string     `gorm:"column:commit_sha;type:varchar(64);default:''" json:"commit_sha"`
+	Branch        string     `gorm:"column:branch;type:varchar(128);default:''" json:"branch"`
+	Author        string     `gorm:"column:author;type:varchar(128);default:''" json:"author"`
+	CommitMessage string     `gorm:"column:commit_message;type:text" json:"commit_message"`
+	DurationMs    int64      `gorm:"column:duration_ms;not null;default:0" json:"duration_ms"`
+	MetadataJSON  string     `gorm:"column:metadata_json;type:longtext" json:"metadata_json"`
+	Status        string     `gorm:"column:status;type:varchar(16);not null;default:'active';index" json:"status"` // active|expired
+	ExpiredAt     *time.Time `gorm:"column:expired_at" json:"expired_at"`
+	CreatedAt     time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt     time.Time  `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+func (CICDArtifact) TableName() string { return "cicd_artifacts" }
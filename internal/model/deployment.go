@@ -3,7 +3,11 @@
 // 本文件定义部署管理相关的数据模型，包括部署目标、发布记录和审批流程。
 package model
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 // DeploymentTarget 是部署目标表模型，定义服务部署的目标环境。
 //
@@ -15,22 +19,23 @@ import "time"
 //   - RuntimeType: k8s / compose
 //   - ClusterSource: platform_managed / external_managed
 type DeploymentTarget struct {
-	ID              uint      `gorm:"primaryKey;column:id" json:"id"`                                                // 目标 ID
-	Name            string    `gorm:"column:name;type:varchar(128);not null" json:"name"`                           // 目标名称
-	TargetType      string    `gorm:"column:target_type;type:varchar(16);not null;index" json:"target_type"`       // 目标类型: k8s/compose
-	RuntimeType     string    `gorm:"column:runtime_type;type:varchar(16);not null;default:'k8s';index" json:"runtime_type"` // 运行时类型: k8s/compose
-	ClusterID       uint      `gorm:"column:cluster_id;default:0;index" json:"cluster_id"`                          // 集群 ID
-	ClusterSource   string    `gorm:"column:cluster_source;type:varchar(32);not null;default:'platform_managed';index" json:"cluster_source"` // 集群来源
-	CredentialID    uint      `gorm:"column:credential_id;default:0;index" json:"credential_id"`                    // 凭证 ID
-	BootstrapJobID  string    `gorm:"column:bootstrap_job_id;type:varchar(64);default:''" json:"bootstrap_job_id"` // 初始化任务 ID
-	ProjectID       uint      `gorm:"column:project_id;default:0;index" json:"project_id"`                         // 项目 ID
-	TeamID          uint      `gorm:"column:team_id;default:0;index" json:"team_id"`                              // 团队 ID
-	Env             string    `gorm:"column:env;type:varchar(32);default:'staging';index" json:"env"`             // 环境: development/staging/production
-	Status          string    `gorm:"column:status;type:varchar(32);default:'active'" json:"status"`              // 状态: active/inactive
-	ReadinessStatus string    `gorm:"column:readiness_status;type:varchar(32);default:'unknown'" json:"readiness_status"` // 就绪状态: ready/not_ready/unknown
-	CreatedBy       uint      `gorm:"column:created_by;default:0" json:"created_by"`                              // 创建人 ID
-	CreatedAt       time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`                         // 创建时间
-	UpdatedAt       time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`                         // 更新时间
+	ID                   uint      `gorm:"primaryKey;column:id" json:"id"`                                                                         // 目标 ID
+	Name                 string    `gorm:"column:name;type:varchar(128);not null" json:"name"`                                                     // 目标名称
+	TargetType           string    `gorm:"column:target_type;type:varchar(16);not null;index" json:"target_type"`                                  // 目标类型: k8s/compose
+	RuntimeType          string    `gorm:"column:runtime_type;type:varchar(16);not null;default:'k8s';index" json:"runtime_type"`                  // 运行时类型: k8s/compose
+	ClusterID            uint      `gorm:"column:cluster_id;default:0;index" json:"cluster_id"`                                                    // 集群 ID
+	ClusterSource        string    `gorm:"column:cluster_source;type:varchar(32);not null;default:'platform_managed';index" json:"cluster_source"` // 集群来源
+	CredentialID         uint      `gorm:"column:credential_id;default:0;index" json:"credential_id"`                                              // 凭证 ID
+	BootstrapJobID       string    `gorm:"column:bootstrap_job_id;type:varchar(64);default:''" json:"bootstrap_job_id"`                            // 初始化任务 ID
+	ProjectID            uint      `gorm:"column:project_id;default:0;index" json:"project_id"`                                                    // 项目 ID
+	TeamID               uint      `gorm:"column:team_id;default:0;index" json:"team_id"`                                                          // 团队 ID
+	Env                  string    `gorm:"column:env;type:varchar(32);default:'staging';index" json:"env"`                                         // 环境: development/staging/production
+	Status               string    `gorm:"column:status;type:varchar(32);default:'active'" json:"status"`                                          // 状态: active/inactive
+	ReadinessStatus      string    `gorm:"column:readiness_status;type:varchar(32);default:'unknown'" json:"readiness_status"`                     // 就绪状态: ready/not_ready/unknown
+	VerifyTimeoutSeconds int       `gorm:"column:verify_timeout_seconds;default:300" json:"verify_timeout_seconds"`                                // 发布验证超时时间 (秒)
+	CreatedBy            uint      `gorm:"column:created_by;default:0" json:"created_by"`                                                          // 创建人 ID
+	CreatedAt            time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`                                                     // 创建时间
+	UpdatedAt            time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`                                                     // 更新时间
 }
 
 // TableName 返回部署目标表名。
@@ -65,59 +70,116 @@ func (DeploymentTargetNode) TableName() string { return "deployment_target_nodes
 //   - pending_approval: 等待审批
 //   - approved: 已批准
 //   - deploying: 部署中
+//   - verifying: 发布后验证中 (等待工作负载滚动完成)
+//   - paused: 金丝雀/蓝绿发布暂停, 等待推进
+//   - aborted: 金丝雀/蓝绿发布已中止
 //   - success: 部署成功
 //   - failed: 部署失败
 //   - rolled_back: 已回滚
 type DeploymentRelease struct {
-	ID                 uint       `gorm:"primaryKey;column:id" json:"id"`                                              // 发布 ID
-	ServiceID          uint       `gorm:"column:service_id;not null;index" json:"service_id"`                         // 服务 ID
-	TargetID           uint       `gorm:"column:target_id;not null;index" json:"target_id"`                           // 目标 ID
-	NamespaceOrProject string     `gorm:"column:namespace_or_project;type:varchar(128);default:''" json:"namespace_or_project"` // 命名空间/项目
-	RuntimeType        string     `gorm:"column:runtime_type;type:varchar(16);not null;index" json:"runtime_type"`    // 运行时类型: k8s/compose
-	Strategy           string     `gorm:"column:strategy;type:varchar(16);default:'rolling'" json:"strategy"`        // 部署策略: rolling/recreate
+	ID                 uint       `gorm:"primaryKey;column:id" json:"id"`                                                               // 发布 ID
+	ServiceID          uint       `gorm:"column:service_id;not null;index" json:"service_id"`                                           // 服务 ID
+	TargetID           uint       `gorm:"column:target_id;not null;index" json:"target_id"`                                             // 目标 ID
+	NamespaceOrProject string     `gorm:"column:namespace_or_project;type:varchar(128);default:''" json:"namespace_or_project"`         // 命名空间/项目
+	RuntimeType        string     `gorm:"column:runtime_type;type:varchar(16);not null;index" json:"runtime_type"`                      // 运行时类型: k8s/compose
+	Strategy           string     `gorm:"column:strategy;type:varchar(16);default:'rolling'" json:"strategy"`                           // 部署策略: rolling/recreate/canary/blue-green
 	TriggerSource      string     `gorm:"column:trigger_source;type:varchar(32);not null;default:'manual';index" json:"trigger_source"` // 触发来源: manual/ci/scheduled
-	RevisionID         uint       `gorm:"column:revision_id;default:0;index" json:"revision_id"`                     // 配置版本 ID
-	SourceReleaseID    uint       `gorm:"column:source_release_id;default:0;index" json:"source_release_id"`         // 源发布 ID (回滚场景)
-	TargetRevision     string     `gorm:"column:target_revision;type:varchar(128);default:''" json:"target_revision"` // 目标版本号
-	PreviewContextHash string     `gorm:"column:preview_context_hash;type:varchar(128);default:''" json:"preview_context_hash"` // 预览上下文哈希
-	PreviewTokenHash   string     `gorm:"column:preview_token_hash;type:varchar(128);default:''" json:"preview_token_hash"` // 预览令牌哈希
-	PreviewExpiresAt   *time.Time `gorm:"column:preview_expires_at" json:"preview_expires_at"`                       // 预览过期时间
-	Status             string     `gorm:"column:status;type:varchar(32);default:'pending_approval';index" json:"status"` // 状态
-	ManifestSnapshot   string     `gorm:"column:manifest_snapshot;type:longtext" json:"manifest_snapshot"`           // 清单快照 (YAML)
-	RuntimeContextJSON string     `gorm:"column:runtime_context_json;type:longtext" json:"runtime_context_json"`     // 运行时上下文 (JSON)
-	TriggerContextJSON string     `gorm:"column:trigger_context_json;type:longtext" json:"trigger_context_json"`     // 触发上下文 (JSON)
-	ChecksJSON         string     `gorm:"column:checks_json;type:longtext" json:"checks_json"`                       // 检查项 (JSON)
-	WarningsJSON       string     `gorm:"column:warnings_json;type:longtext" json:"warnings_json"`                   // 警告项 (JSON)
-	DiagnosticsJSON    string     `gorm:"column:diagnostics_json;type:longtext" json:"diagnostics_json"`             // 诊断信息 (JSON)
-	VerificationJSON   string     `gorm:"column:verification_json;type:longtext" json:"verification_json"`           // 验证结果 (JSON)
-	Operator           uint       `gorm:"column:operator;default:0;index" json:"operator"`                           // 操作人 ID
-	CIRunID            uint       `gorm:"column:ci_run_id;default:0;index:idx_deploy_release_ci_run" json:"ci_run_id"` // CI 运行 ID
-	CreatedAt          time.Time  `gorm:"column:created_at;autoCreateTime;index" json:"created_at"`                  // 创建时间
-	UpdatedAt          time.Time  `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`                        // 更新时间
+	RevisionID         uint       `gorm:"column:revision_id;default:0;index" json:"revision_id"`                                        // 配置版本 ID
+	SourceReleaseID    uint       `gorm:"column:source_release_id;default:0;index" json:"source_release_id"`                            // 源发布 ID (回滚/晋级场景)
+	TargetRevision     string     `gorm:"column:target_revision;type:varchar(128);default:''" json:"target_revision"`                   // 目标版本号
+	PreviewContextHash string     `gorm:"column:preview_context_hash;type:varchar(128);default:''" json:"preview_context_hash"`         // 预览上下文哈希
+	PreviewTokenHash   string     `gorm:"column:preview_token_hash;type:varchar(128);default:''" json:"preview_token_hash"`             // 预览令牌哈希
+	PreviewExpiresAt   *time.Time `gorm:"column:preview_expires_at" json:"preview_expires_at"`                                          // 预览过期时间
+	Status             string     `gorm:"column:status;type:varchar(32);default:'pending_approval';index" json:"status"`                // 状态
+	ManifestSnapshot   string     `gorm:"column:manifest_snapshot;type:longtext" json:"manifest_snapshot"`                              // 清单快照 (YAML)
+	TemplateSnapshot   string     `gorm:"column:template_snapshot;type:longtext" json:"template_snapshot"`                              // 变量替换前的清单模板 (晋级时复用)
+	VariablesJSON      string     `gorm:"column:variables_json;type:longtext" json:"variables_json"`                                    // 渲染变量 (JSON, 请求变量与环境变量键)
+	RuntimeContextJSON string     `gorm:"column:runtime_context_json;type:longtext" json:"runtime_context_json"`                        // 运行时上下文 (JSON)
+	TriggerContextJSON string     `gorm:"column:trigger_context_json;type:longtext" json:"trigger_context_json"`                        // 触发上下文 (JSON)
+	ChecksJSON         string     `gorm:"column:checks_json;type:longtext" json:"checks_json"`                                          // 检查项 (JSON)
+	WarningsJSON       string     `gorm:"column:warnings_json;type:longtext" json:"warnings_json"`                                      // 警告项 (JSON)
+	DiagnosticsJSON    string     `gorm:"column:diagnostics_json;type:longtext" json:"diagnostics_json"`                                // 诊断信息 (JSON)
+	VerificationJSON   string     `gorm:"column:verification_json;type:longtext" json:"verification_json"`                              // 验证结果 (JSON)
+	StrategyStateJSON  string     `gorm:"column:strategy_state_json;type:longtext" json:"strategy_state_json"`                          // 发布策略执行状态 (JSON, 金丝雀/蓝绿)
+	InventoryJSON      string     `gorm:"column:inventory_json;type:longtext" json:"inventory_json"`                                    // 本次发布应用的对象清单 (JSON, GVK/命名空间/名称)
+	PrunedJSON         string     `gorm:"column:pruned_json;type:longtext" json:"pruned_json"`                                          // 本次发布清理的对象 (JSON)
+	Operator           uint       `gorm:"column:operator;default:0;index" json:"operator"`                                              // 操作人 ID
+	CIRunID            uint       `gorm:"column:ci_run_id;default:0;index:idx_deploy_release_ci_run" json:"ci_run_id"`                  // CI 运行 ID
+	ArtifactID         uint       `gorm:"column:artifact_id;default:0;index" json:"artifact_id"`                                        // 固定的 CI 制品 ID
+	ArtifactDigest     string     `gorm:"column:artifact_digest;type:varchar(128);default:''" json:"artifact_digest"`                   // 固定的制品 digest
+	CommitSHA          string     `gorm:"column:commit_sha;type:varchar(64);default:''" json:"commit_sha"`                              // 制品对应的提交
+	FinishedAt         *time.Time `gorm:"column:finished_at;index" json:"finished_at"`                                                  // 进入终态的时间
+	CreatedAt          time.Time  `gorm:"column:created_at;autoCreateTime;index" json:"created_at"`                                     // 创建时间
+	UpdatedAt          time.Time  `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`                                           // 更新时间
 }
 
 // TableName 返回部署发布记录表名。
 func (DeploymentRelease) TableName() string { return "deployment_releases" }
 
+// deploymentReleaseFinalStatuses 是发布的终态, 进入终态时记录 FinishedAt。
+var deploymentReleaseFinalStatuses = map[string]struct{}{
+	"applied": {}, "failed": {}, "rejected": {}, "aborted": {}, "cancelled": {}, "rollback": {}, "rolled_back": {},
+}
+
+// BeforeSave 是 GORM 钩子，发布首次进入终态时记录完成时间。
+//
+// DORA 指标按完成时间计算前置时间与恢复时间, 终态之后的更新 (如回滚标记、策略状态) 不影响该时间。
+func (r *DeploymentRelease) BeforeSave(tx *gorm.DB) error {
+	if r.FinishedAt != nil {
+		return nil
+	}
+	if _, ok := deploymentReleaseFinalStatuses[r.Status]; ok {
+		now := time.Now()
+		r.FinishedAt = &now
+	}
+	return nil
+}
+
 // DeploymentReleaseApproval 是部署发布审批表模型，记录审批流程。
 //
 // 表名: deployment_release_approvals
 // 状态: pending / approved / rejected
+// 投票: 每位审批人的投票记录在 DeploymentReleaseApprovalVote, 通过票数达到 RequiredApprovals 后审批通过
 type DeploymentReleaseApproval struct {
-	ID          uint      `gorm:"primaryKey;column:id" json:"id"`                                     // 审批 ID
-	ReleaseID   uint      `gorm:"column:release_id;not null;index" json:"release_id"`                 // 发布 ID
-	Ticket      string    `gorm:"column:ticket;type:varchar(96);not null;uniqueIndex" json:"ticket"` // 审批单号
-	Decision    string    `gorm:"column:decision;type:varchar(32);not null;default:'pending';index" json:"decision"` // 决定: pending/approved/rejected
-	Comment     string    `gorm:"column:comment;type:varchar(1024);default:''" json:"comment"`       // 审批意见
-	RequestedBy uint      `gorm:"column:requested_by;default:0" json:"requested_by"`                 // 请求人 ID
-	ApproverID  uint      `gorm:"column:approver_id;default:0" json:"approver_id"`                   // 审批人 ID
-	CreatedAt   time.Time `gorm:"column:created_at;autoCreateTime;index" json:"created_at"`           // 创建时间
-	UpdatedAt   time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`                 // 更新时间
+	ID                uint      `gorm:"primaryKey;column:id" json:"id"`                                                    // 审批 ID
+	ReleaseID         uint      `gorm:"column:release_id;not null;index" json:"release_id"`                                // 发布 ID
+	Ticket            string    `gorm:"column:ticket;type:varchar(96);not null;uniqueIndex" json:"ticket"`                 // 审批单号
+	Decision          string    `gorm:"column:decision;type:varchar(32);not null;default:'pending';index" json:"decision"` // 决定: pending/approved/rejected
+	Comment           string    `gorm:"column:comment;type:varchar(1024);default:''" json:"comment"`                       // 审批意见
+	RequestedBy       uint      `gorm:"column:requested_by;default:0" json:"requested_by"`                                 // 请求人 ID
+	ApproverID        uint      `gorm:"column:approver_id;default:0" json:"approver_id"`                                   // 审批人 ID
+	RequiredApprovals int       `gorm:"column:required_approvals;not null;default:1" json:"required_approvals"`            // 通过所需票数
+	ApprovedCount     int       `gorm:"column:approved_count;not null;default:0" json:"approved_count"`                    // 已获得的通过票数
+	PolicyID          uint      `gorm:"column:policy_id;default:0;index" json:"policy_id"`                                 // 命中的审批策略 ID (0 表示默认规则)
+	RuleJSON          string    `gorm:"column:rule_json;type:longtext" json:"rule_json"`                                   // 审批规则快照 (JSON)
+	CreatedAt         time.Time `gorm:"column:created_at;autoCreateTime;index" json:"created_at"`                          // 创建时间
+	UpdatedAt         time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`                                // 更新时间
 }
 
 // TableName 返回部署发布审批表名。
 func (DeploymentReleaseApproval) TableName() string { return "deployment_release_approvals" }
 
+// DeploymentReleaseApprovalVote 是部署发布审批投票表模型，记录每位审批人的投票。
+//
+// 表名: deployment_release_approval_votes
+// 关联:
+//   - DeploymentReleaseApproval (多对一，通过 approval_id)
+//
+// 约束: 同一审批单每位审批人只能投票一次
+type DeploymentReleaseApprovalVote struct {
+	ID         uint      `gorm:"primaryKey;column:id" json:"id"`                                                                  // 投票 ID
+	ApprovalID uint      `gorm:"column:approval_id;not null;uniqueIndex:uk_release_approval_voter,priority:1" json:"approval_id"` // 审批单 ID
+	ReleaseID  uint      `gorm:"column:release_id;not null;index" json:"release_id"`                                              // 发布 ID
+	VoterID    uint      `gorm:"column:voter_id;not null;uniqueIndex:uk_release_approval_voter,priority:2" json:"voter_id"`       // 投票人 ID
+	Decision   string    `gorm:"column:decision;type:varchar(32);not null" json:"decision"`                                       // 投票: approved/rejected
+	Comment    string    `gorm:"column:comment;type:varchar(1024);default:''" json:"comment"`                                     // 投票意见
+	VoterRoles string    `gorm:"column:voter_roles;type:varchar(512);default:''" json:"voter_roles"`                              // 投票时的角色编码 (逗号分隔)
+	CreatedAt  time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`                                              // 投票时间
+}
+
+// TableName 返回部署发布审批投票表名。
+func (DeploymentReleaseApprovalVote) TableName() string { return "deployment_release_approval_votes" }
+
 // DeploymentReleaseAudit 是部署发布审计表模型，记录发布操作日志。
 //
 // 表名: deployment_release_audits
@@ -136,6 +198,86 @@ type DeploymentReleaseAudit struct {
 // TableName 返回部署发布审计表名。
 func (DeploymentReleaseAudit) TableName() string { return "deployment_release_audits" }
 
+// DeploymentFreezeWindow 是变更冻结窗口表模型，冻结期内禁止发布 (紧急放行除外)。
+//
+// 表名: deployment_freeze_windows
+// 用途: 变更日历
+//
+// 窗口类型:
+//   - one_off: 一次性窗口, [start_at, end_at)
+//   - recurring: 周期窗口, 每次 cron 触发后持续 duration_minutes; start_at/end_at 可选, 限定生效期
+//
+// 作用域: env / project_id / target_id 为空或 0 时表示不限, 多个条件同时生效。
+type DeploymentFreezeWindow struct {
+	ID              uint       `gorm:"primaryKey;column:id" json:"id"`                                           // 窗口 ID
+	Name            string     `gorm:"column:name;type:varchar(128);not null" json:"name"`                       // 窗口名称
+	Reason          string     `gorm:"column:reason;type:varchar(1024);default:''" json:"reason"`                // 冻结原因
+	Env             string     `gorm:"column:env;type:varchar(32);default:'';index" json:"env"`                  // 环境作用域
+	ProjectID       uint       `gorm:"column:project_id;default:0;index" json:"project_id"`                      // 项目作用域
+	TargetID        uint       `gorm:"column:target_id;default:0;index" json:"target_id"`                        // 部署目标作用域
+	WindowType      string     `gorm:"column:window_type;type:varchar(16);not null" json:"window_type"`          // 窗口类型: one_off/recurring
+	StartAt         *time.Time `gorm:"column:start_at" json:"start_at,omitempty"`                                // 开始时间
+	EndAt           *time.Time `gorm:"column:end_at" json:"end_at,omitempty"`                                    // 结束时间
+	Cron            string     `gorm:"column:cron;type:varchar(64);default:''" json:"cron"`                      // 周期窗口的 cron 表达式
+	DurationMinutes int        `gorm:"column:duration_minutes;default:0" json:"duration_minutes"`                // 周期窗口每次持续分钟数
+	Timezone        string     `gorm:"column:timezone;type:varchar(64);default:''" json:"timezone"`              // cron 计算时区, 默认 UTC
+	OverrideRoles   string     `gorm:"column:override_roles;type:varchar(512);default:''" json:"override_roles"` // 紧急放行的审批角色编码 (逗号分隔)
+	Enabled         bool       `gorm:"column:enabled;not null" json:"enabled"`                                   // 是否启用
+	CreatedBy       uint       `gorm:"column:created_by;default:0" json:"created_by"`                            // 创建人 ID
+	CreatedAt       time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`                       // 创建时间
+	UpdatedAt       time.Time  `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`                       // 更新时间
+}
+
+// TableName 返回变更冻结窗口表名。
+func (DeploymentFreezeWindow) TableName() string { return "deployment_freeze_windows" }
+
+// DeploymentTargetLock 是部署目标发布锁的数据库后备存储。
+//
+// 表名: deployment_target_locks
+// 正常情况下锁保存在 Redis 中, Redis 不可用时回退到本表; ExpiresAt 之前未续约的锁视为持有进程已崩溃。
+type DeploymentTargetLock struct {
+	ID         uint      `gorm:"primaryKey;column:id" json:"id"`                         // 锁记录 ID
+	TargetID   uint      `gorm:"column:target_id;not null;uniqueIndex" json:"target_id"` // 部署目标 ID
+	ReleaseID  uint      `gorm:"column:release_id;not null;index" json:"release_id"`     // 持有锁的发布 ID
+	Owner      string    `gorm:"column:owner;type:varchar(128);default:''" json:"owner"` // 持有进程标识
+	AcquiredAt time.Time `gorm:"column:acquired_at" json:"acquired_at"`                  // 获得锁的时间
+	ExpiresAt  time.Time `gorm:"column:expires_at;index" json:"expires_at"`              // 租约到期时间
+	UpdatedAt  time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`     // 更新时间
+}
+
+// TableName 返回部署目标发布锁表名。
+func (DeploymentTargetLock) TableName() string { return "deployment_target_locks" }
+
+// DeploymentReleaseHook 是发布钩子表模型，部署目标或服务声明的、在发布前后按顺序执行的动作。
+//
+// 表名: deployment_release_hooks
+//
+// 阶段:
+//   - pre: 应用清单之前执行, 失败时中止发布 (on_failure=ignore 除外)
+//   - post: 验证通过之后执行, 失败时发布标记为失败, on_failure=rollback 时自动回滚
+//
+// 类型: k8s_job / ssh / http / wait, 具体参数见 config_json。
+// 作用域: service_id 与 target_id 至少设置一个, 同时设置时仅作用于该服务在该目标上的发布。
+type DeploymentReleaseHook struct {
+	ID             uint      `gorm:"primaryKey;column:id" json:"id"`                                  // 钩子 ID
+	Name           string    `gorm:"column:name;type:varchar(128);not null" json:"name"`              // 钩子名称
+	ServiceID      uint      `gorm:"column:service_id;default:0;index" json:"service_id"`             // 服务作用域
+	TargetID       uint      `gorm:"column:target_id;default:0;index" json:"target_id"`               // 部署目标作用域
+	Phase          string    `gorm:"column:phase;type:varchar(16);not null" json:"phase"`             // 执行阶段: pre/post
+	Kind           string    `gorm:"column:kind;type:varchar(32);not null" json:"kind"`               // 钩子类型: k8s_job/ssh/http/wait
+	SortOrder      int       `gorm:"column:sort_order;default:0" json:"sort_order"`                   // 执行顺序, 升序
+	ConfigJSON     string    `gorm:"column:config_json;type:longtext" json:"config_json"`             // 钩子参数 (JSON)
+	TimeoutSeconds int       `gorm:"column:timeout_seconds;default:300" json:"timeout_seconds"`       // 超时秒数
+	OnFailure      string    `gorm:"column:on_failure;type:varchar(16);default:''" json:"on_failure"` // 失败处理: abort/fail/rollback/ignore
+	Enabled        bool      `gorm:"column:enabled;not null" json:"enabled"`                          // 是否启用
+	CreatedBy      uint      `gorm:"column:created_by;default:0" json:"created_by"`                   // 创建人 ID
+	CreatedAt      time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`              // 创建时间
+	UpdatedAt      time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`              // 更新时间
+}
+
+// TableName 返回发布钩子表名。
+func (DeploymentReleaseHook) TableName() string { return "deployment_release_hooks" }
+
 // ServiceGovernancePolicy 是服务治理策略表模型，定义服务的流量、弹性等策略。
 //
 // 表名: service_governance_policies
@@ -6,16 +6,24 @@ import "time"
 type Job struct {
 	ID          uint       `gorm:"primaryKey" json:"id"`
 	Name        string     `gorm:"type:varchar(255);not null" json:"name"`
-	Type        string     `gorm:"type:varchar(32);not null;default:'shell'" json:"type"` // shell, script
-	Command     string     `gorm:"type:text" json:"command"`
+	Type        string     `gorm:"type:varchar(32);not null;default:'shell'" json:"type"` // shell, script, k8s
+	Command     string     `gorm:"type:text" json:"command"`                              // 主机上执行的命令; k8s 任务为容器命令, JSON 字符串数组或经 /bin/sh -c 执行的命令行, 为空时使用镜像入口
 	HostIDs     string     `gorm:"type:text" json:"host_ids"`
-	Cron        string     `gorm:"type:varchar(64)" json:"cron"`
-	Status      string     `gorm:"type:varchar(32);not null;default:'pending'" json:"status"` // pending, running, success, failed
+	ClusterID   uint       `gorm:"default:0" json:"cluster_id"`                               // k8s 任务的目标集群
+	Namespace   string     `gorm:"type:varchar(128);default:''" json:"namespace"`             // k8s 任务的命名空间, 为空时使用 default
+	Image       string     `gorm:"type:varchar(512);default:''" json:"image"`                 // k8s 任务的容器镜像
+	ArgsJSON    string     `gorm:"column:args_json;type:text" json:"args_json"`               // k8s 任务的容器参数 (JSON 字符串数组)
+	Cron        string     `gorm:"type:varchar(64)" json:"cron"`                              // 5 段或带秒的 6 段 cron 表达式, 为空时只能手动执行; k8s 任务只支持 5 段, 由集群中的 CronJob 触发
+	Timezone    string     `gorm:"type:varchar(64);default:''" json:"timezone"`               // cron 所用时区, 为空时使用服务器时区
+	CatchUp     string     `gorm:"type:varchar(16);not null;default:'skip'" json:"catch_up"`  // 错过触发的补偿策略: skip, once, all
+	Paused      bool       `gorm:"not null;default:false" json:"paused"`                      // 暂停后不再按 cron 触发
+	Status      string     `gorm:"type:varchar(32);not null;default:'pending'" json:"status"` // pending, running, success, failed, stopped, unknown
 	Timeout     int        `gorm:"default:300" json:"timeout"`
+	Parallelism int        `gorm:"default:0" json:"parallelism"` // 同时执行的主机数, 0 表示使用 jobs.parallelism
 	Priority    int        `gorm:"default:0" json:"priority"`
 	Description string     `gorm:"type:text" json:"description"`
 	LastRun     *time.Time `json:"last_run"`
-	NextRun     *time.Time `json:"next_run"`
+	NextRun     *time.Time `gorm:"index" json:"next_run"`
 	CreatedBy   uint       `json:"created_by"`
 	CreatedAt   time.Time  `json:"created_at"`
 	UpdatedAt   time.Time  `json:"updated_at"`
@@ -27,16 +35,22 @@ func (Job) TableName() string {
 
 // JobExecution 任务执行记录
 type JobExecution struct {
-	ID        uint       `gorm:"primaryKey" json:"id"`
-	JobID     uint       `gorm:"not null;index" json:"job_id"`
-	HostID    uint       `json:"host_id"`
-	HostIP    string     `gorm:"type:varchar(64)" json:"host_ip"`
-	Status    string     `gorm:"type:varchar(32);not null;default:'pending'" json:"status"` // pending, running, success, failed
-	ExitCode  int        `json:"exit_code"`
-	Output    string     `gorm:"type:text" json:"output"`
-	StartTime time.Time  `json:"start_time"`
-	EndTime   *time.Time `json:"end_time"`
-	CreatedAt time.Time  `json:"created_at"`
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	JobID        uint       `gorm:"not null;index" json:"job_id"`
+	HostID       uint       `json:"host_id"`
+	HostIP       string     `gorm:"type:varchar(64)" json:"host_ip"`
+	K8sJob       string     `gorm:"column:k8s_job;type:varchar(253)" json:"k8s_job"`                               // k8s 任务对应的 batch/v1 Job 名称
+	RunID        string     `gorm:"type:varchar(64);index" json:"run_id"`                                          // 同一次触发在各主机上的执行共用
+	Status       string     `gorm:"type:varchar(32);not null;default:'pending'" json:"status"`                     // pending, running, stopping, success, failed, skipped, stopped, unknown (k8s Job 在收集结果前被删除)
+	Trigger      string     `gorm:"column:trigger_type;type:varchar(16);not null;default:'manual'" json:"trigger"` // manual, schedule, catchup, workflow
+	ScheduledAt  *time.Time `json:"scheduled_at"`                                                                  // 定时触发对应的计划时间
+	ExitCode     int        `json:"exit_code"`
+	Output       string     `gorm:"type:text" json:"output"`        // 标准输出
+	Stderr       string     `gorm:"type:text" json:"stderr"`        // 标准错误
+	ErrorMessage string     `gorm:"type:text" json:"error_message"` // 跳过或执行失败的原因
+	StartTime    time.Time  `json:"start_time"`
+	EndTime      *time.Time `json:"end_time"`
+	CreatedAt    time.Time  `json:"created_at"`
 }
 
 func (JobExecution) TableName() string {
@@ -0,0 +1,58 @@
+package model
+
+import "time"
+
+// JobWorkflow 任务编排: 以任务为步骤的有向无环图
+type JobWorkflow struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Name        string    `gorm:"type:varchar(255);not null" json:"name"`
+	Description string    `gorm:"type:text" json:"description"`
+	StepsJSON   string    `gorm:"column:steps_json;type:longtext" json:"steps_json"` // 步骤定义 (JSON): 任务、依赖、执行条件、重试与环境变量
+	CreatedBy   uint      `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func (JobWorkflow) TableName() string {
+	return "job_workflows"
+}
+
+// JobWorkflowRun 任务编排的一次运行
+type JobWorkflowRun struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	WorkflowID    uint       `gorm:"not null;index" json:"workflow_id"`
+	Status        string     `gorm:"type:varchar(32);not null;default:'running'" json:"status"` // running, success, failed
+	StepsJSON     string     `gorm:"column:steps_json;type:longtext" json:"steps_json"`         // 启动时的步骤定义快照, 重试时沿用
+	VariablesJSON string     `gorm:"column:variables_json;type:text" json:"variables_json"`     // 启动时传入的变量 (JSON)
+	StartTime     time.Time  `json:"start_time"`
+	EndTime       *time.Time `json:"end_time"`
+	HeartbeatAt   *time.Time `gorm:"column:heartbeat_at;index" json:"heartbeat_at"` // 执行运行的副本定期更新, 长时间未更新视为副本已退出
+	CreatedBy     uint       `json:"created_by"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+func (JobWorkflowRun) TableName() string {
+	return "job_workflow_runs"
+}
+
+// JobWorkflowStep 任务编排运行中一个步骤的状态
+type JobWorkflowStep struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	WorkflowRunID uint       `gorm:"not null;index" json:"workflow_run_id"`
+	Name          string     `gorm:"type:varchar(64);not null" json:"name"`
+	JobID         uint       `gorm:"not null" json:"job_id"`
+	Status        string     `gorm:"type:varchar(32);not null;default:'pending'" json:"status"` // pending, running, success, failed, skipped
+	Attempts      int        `gorm:"not null;default:0" json:"attempts"`
+	JobRunID      string     `gorm:"type:varchar(64)" json:"job_run_id"`                // 最近一次尝试对应的任务运行 ID, 即执行记录的 run_id
+	OutputsJSON   string     `gorm:"column:outputs_json;type:text" json:"outputs_json"` // 步骤输出 (JSON), 供后续步骤引用
+	ErrorMessage  string     `gorm:"type:text" json:"error_message"`                    // 失败或跳过的原因
+	StartTime     *time.Time `json:"start_time"`
+	EndTime       *time.Time `json:"end_time"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+func (JobWorkflowStep) TableName() string {
+	return "job_workflow_steps"
+}
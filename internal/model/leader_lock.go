@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// LeaderLock 是多副本间选主使用的租约锁, Redis 不可用时写入数据库。
+type LeaderLock struct {
+	ID         uint      `gorm:"primaryKey;column:id" json:"id"`                                 // 锁记录 ID
+	Name       string    `gorm:"column:name;type:varchar(128);not null;uniqueIndex" json:"name"` // 锁名称, 如 jobs:scheduler
+	Owner      string    `gorm:"column:owner;type:varchar(128);default:''" json:"owner"`         // 持有进程标识
+	AcquiredAt time.Time `gorm:"column:acquired_at" json:"acquired_at"`                          // 获得锁的时间
+	ExpiresAt  time.Time `gorm:"column:expires_at;index" json:"expires_at"`                      // 租约到期时间
+	UpdatedAt  time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`             // 更新时间
+}
+
+// TableName 返回选主锁表名。
+func (LeaderLock) TableName() string { return "leader_locks" }
@@ -0,0 +1,28 @@
+package model
+
+import "time"
+
+// LogChunk 是实时日志流中的一段连续日志行, Redis 不可用时写入数据库。
+// Seq 为段内第一行的序号, LastSeq 为最后一行的序号, 序号在流内从 1 开始递增。
+type LogChunk struct {
+	ID        uint      `gorm:"primaryKey;column:id" json:"id"`
+	Stream    string    `gorm:"column:stream;type:varchar(128);not null;uniqueIndex:uk_log_chunks_stream_seq,priority:1;index:idx_log_chunks_stream_last,priority:1" json:"stream"`
+	Seq       int64     `gorm:"column:seq;not null;uniqueIndex:uk_log_chunks_stream_seq,priority:2" json:"seq"`
+	LastSeq   int64     `gorm:"column:last_seq;not null;index:idx_log_chunks_stream_last,priority:2" json:"last_seq"`
+	Data      string    `gorm:"column:data;type:mediumtext" json:"data"`
+	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+}
+
+func (LogChunk) TableName() string { return "log_chunks" }
+
+// LogArchive 是运行结束后压缩保存的完整日志, 第 N 行的序号为 N。
+type LogArchive struct {
+	ID        uint      `gorm:"primaryKey;column:id" json:"id"`
+	Stream    string    `gorm:"column:stream;type:varchar(128);not null;uniqueIndex:uk_log_archives_stream" json:"stream"`
+	Lines     int64     `gorm:"column:lines;not null;default:0" json:"lines"`
+	Size      int64     `gorm:"column:size;not null;default:0" json:"size"`
+	Content   string    `gorm:"column:content;type:longtext" json:"content"`
+	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+}
+
+func (LogArchive) TableName() string { return "log_archives" }
@@ -10,9 +10,9 @@ import (
 type Policy struct {
 	ID        uint                   `gorm:"primaryKey" json:"id"`
 	Name      string                 `gorm:"type:varchar(255);not null" json:"name"`
-	Type      string                 `gorm:"type:varchar(32);not null;index" json:"type"` // traffic, resilience, access, slo
+	Type      string                 `gorm:"type:varchar(32);not null;index" json:"type"` // traffic, resilience, access, slo, approval, promotion, admission
 	TargetID  uint                   `gorm:"index" json:"target_id"`
-	Config    map[string]interface{} `gorm:"type:json" json:"config"`
+	Config    map[string]interface{} `gorm:"type:json;serializer:json" json:"config"`
 	Enabled   bool                   `gorm:"default:true" json:"enabled"`
 	CreatedAt time.Time              `json:"created_at"`
 	UpdatedAt time.Time              `json:"updated_at"`
@@ -49,4 +49,7 @@ const (
 	PolicyTypeResilience = "resilience"
 	PolicyTypeAccess     = "access"
 	PolicyTypeSLO        = "slo"
+	PolicyTypeApproval   = "approval"
+	PolicyTypePromotion  = "promotion"
+	PolicyTypeAdmission  = "admission"
 )
@@ -51,7 +51,7 @@ func startServer(ctx context.Context) {
 	// storage.MustMigrate(svcCtx.DB)
 	r := gin.Default()
 	r.Use(gin.Recovery())
-	service.Init(r, svcCtx)
+	service.Init(ctx, r, svcCtx)
 
 	srv := &http.Server{
 		Addr:    fmt.Sprintf("%s:%d", config.CFG.Server.Host, config.CFG.Server.Port),
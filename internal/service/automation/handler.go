@@ -1,6 +1,8 @@
 package automation
 
 import (
+	"context"
+
 	"github.com/cy77cc/OpsPilot/internal/httpx"
 	"github.com/cy77cc/OpsPilot/internal/svc"
 	"github.com/cy77cc/OpsPilot/internal/xcode"
@@ -132,3 +134,18 @@ func (h *Handler) GetRunLogs(c *gin.Context) {
 	}
 	httpx.OK(c, gin.H{"list": rows, "total": len(rows)})
 }
+
+// StreamRunLogs 跟随自动化运行的实时日志, 支持 SSE 与 WebSocket, 通过 after 或 Last-Event-ID 断点续读。
+func (h *Handler) StreamRunLogs(c *gin.Context) {
+	if !httpx.Authorize(c, h.svcCtx.DB, "automation:read", "automation:*") {
+		return
+	}
+	stream, err := h.logic.runLogStream(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		httpx.Fail(c, xcode.NotFound, "run not found")
+		return
+	}
+	h.logic.logs.ServeFollow(c, stream, func(ctx context.Context) (bool, error) {
+		return h.logic.runFinished(ctx, c.Param("id"))
+	})
+}
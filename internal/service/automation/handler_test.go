@@ -27,6 +27,8 @@ func TestAutomationRunLifecycleAPI(t *testing.T) {
 		&model.AutomationRun{},
 		&model.AutomationRunLog{},
 		&model.AutomationExecutionAudit{},
+		&model.LogChunk{},
+		&model.LogArchive{},
 	); err != nil {
 		t.Fatalf("auto migrate: %v", err)
 	}
@@ -45,6 +47,7 @@ func TestAutomationRunLifecycleAPI(t *testing.T) {
 	g.POST("/runs/execute", h.ExecuteRun)
 	g.GET("/runs/:id", h.GetRun)
 	g.GET("/runs/:id/logs", h.GetRunLogs)
+	g.GET("/runs/:id/logs/stream", h.StreamRunLogs)
 
 	w := httptest.NewRecorder()
 	req := httptest.NewRequest(http.MethodPost, "/api/v1/automation/runs/preview", strings.NewReader(`{"action":"collect.inventory","params":{"scope":"all"}}`))
@@ -98,4 +101,12 @@ func TestAutomationRunLifecycleAPI(t *testing.T) {
 	if logsResp.Data.Total < 1 {
 		t.Fatalf("expected logs, got total=%d, body=%s", logsResp.Data.Total, w.Body.String())
 	}
+
+	// 运行结束后日志已压缩归档, 跟随请求直接返回全部日志和结束事件。
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/automation/runs/"+executeResp.Data.ID+"/logs/stream", nil)
+	r.ServeHTTP(w, req)
+	if body := w.Body.String(); !strings.Contains(body, "run queued and started") || !strings.Contains(body, "event: end") {
+		t.Fatalf("expected archived log stream, got %s", body)
+	}
 }
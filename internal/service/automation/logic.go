@@ -8,6 +8,8 @@ import (
 	"strings"
 	"time"
 
+	"github.com/cy77cc/OpsPilot/internal/logger"
+	"github.com/cy77cc/OpsPilot/internal/logstream"
 	"github.com/cy77cc/OpsPilot/internal/model"
 	hostlogic "github.com/cy77cc/OpsPilot/internal/service/host/logic"
 	"github.com/cy77cc/OpsPilot/internal/svc"
@@ -15,10 +17,26 @@ import (
 
 type Logic struct {
 	svcCtx *svc.ServiceContext
+	logs   *logstream.Store
 }
 
 func NewLogic(svcCtx *svc.ServiceContext) *Logic {
-	return &Logic{svcCtx: svcCtx}
+	return &Logic{svcCtx: svcCtx, logs: logstream.New(svcCtx.DB, svcCtx.Rdb)}
+}
+
+// runStream 返回自动化运行的实时日志流名称。
+func runStream(runID string) string {
+	return "automation:run:" + runID
+}
+
+// appendRunLog 写入一条运行日志, 同时推送到实时日志流。
+func (l *Logic) appendRunLog(ctx context.Context, stream *logstream.Appender, runID, level, message string) {
+	_ = l.svcCtx.DB.WithContext(ctx).Create(&model.AutomationRunLog{
+		RunID:   runID,
+		Level:   level,
+		Message: message,
+	}).Error
+	stream.Linef("[%s] %s", level, message)
 }
 
 func (l *Logic) listInventories(ctx context.Context) ([]model.AutomationInventory, error) {
@@ -104,9 +122,20 @@ func (l *Logic) executeRun(ctx context.Context, actor uint, req executeRunReq) (
 	if err := l.svcCtx.DB.WithContext(ctx).Create(&run).Error; err != nil {
 		return nil, err
 	}
+	stream, err := l.logs.Open(ctx, runStream(run.ID))
+	if err != nil {
+		logger.L().Warn("open automation run log stream failed", logger.Error(err))
+	}
+	defer func() {
+		_ = stream.Close()
+		if err := l.logs.Complete(context.WithoutCancel(ctx), runStream(run.ID)); err != nil {
+			logger.L().Warn("compact automation run logs failed", logger.Error(err))
+		}
+	}()
 
 	hostScope, skippedReasons, err := l.resolveAutomationHostScope(ctx, req.Params)
 	if err != nil {
+		stream.Linef("[error] %s", err.Error())
 		run.Status = "failed"
 		run.ResultJSON = fmt.Sprintf(`{"error":%q}`, err.Error())
 		run.FinishedAt = time.Now()
@@ -120,17 +149,9 @@ func (l *Logic) executeRun(ctx context.Context, actor uint, req executeRunReq) (
 		return &run, err
 	}
 
-	_ = l.svcCtx.DB.WithContext(ctx).Create(&model.AutomationRunLog{
-		RunID:   run.ID,
-		Level:   "info",
-		Message: "run queued and started",
-	}).Error
+	l.appendRunLog(ctx, stream, run.ID, "info", "run queued and started")
 	for _, reason := range skippedReasons {
-		_ = l.svcCtx.DB.WithContext(ctx).Create(&model.AutomationRunLog{
-			RunID:   run.ID,
-			Level:   "warning",
-			Message: reason,
-		}).Error
+		l.appendRunLog(ctx, stream, run.ID, "warning", reason)
 	}
 	if len(hostScope) == 0 {
 		run.Status = "succeeded"
@@ -161,11 +182,7 @@ func (l *Logic) executeRun(ctx context.Context, actor uint, req executeRunReq) (
 			"result_json": run.ResultJSON,
 			"finished_at": run.FinishedAt,
 		}).Error
-	_ = l.svcCtx.DB.WithContext(ctx).Create(&model.AutomationRunLog{
-		RunID:   run.ID,
-		Level:   "info",
-		Message: "run finished",
-	}).Error
+	l.appendRunLog(ctx, stream, run.ID, "info", "run finished")
 
 	detail, _ := json.Marshal(map[string]any{
 		"approval_token": strings.TrimSpace(req.ApprovalToken),
@@ -264,3 +281,21 @@ func (l *Logic) listRunLogs(ctx context.Context, id string) ([]model.AutomationR
 	err := l.svcCtx.DB.WithContext(ctx).Where("run_id = ?", strings.TrimSpace(id)).Order("id asc").Find(&rows).Error
 	return rows, err
 }
+
+// runLogStream 返回自动化运行的实时日志流名称, 运行不存在时返回 gorm.ErrRecordNotFound。
+func (l *Logic) runLogStream(ctx context.Context, id string) (string, error) {
+	run, err := l.getRun(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	return runStream(run.ID), nil
+}
+
+// runFinished 报告自动化运行是否已经结束。
+func (l *Logic) runFinished(ctx context.Context, id string) (bool, error) {
+	run, err := l.getRun(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	return run.Status != "running", nil
+}
@@ -4,7 +4,7 @@
 //   - 清单管理（Inventory）
 //   - Playbook 管理
 //   - 运行预览和执行
-//   - 执行日志查询
+//   - 执行日志查询与实时日志流
 package automation
 
 import (
@@ -26,5 +26,6 @@ func RegisterAutomationHandlers(v1 *gin.RouterGroup, svcCtx *svc.ServiceContext)
 		g.POST("/runs/execute", h.ExecuteRun)
 		g.GET("/runs/:id", h.GetRun)
 		g.GET("/runs/:id/logs", h.GetRunLogs)
+		g.GET("/runs/:id/logs/stream", h.StreamRunLogs)
 	}
 }
@@ -0,0 +1,75 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// LocalRunner 在本机的临时目录中执行命令。
+type LocalRunner struct {
+	Root string // 工作目录根路径, 为空时使用系统临时目录
+}
+
+func (r *LocalRunner) Name() string { return "local" }
+
+func (r *LocalRunner) Prepare(_ context.Context, runID uint) (string, error) {
+	root := r.Root
+	if root == "" {
+		root = os.TempDir()
+	}
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return "", err
+	}
+	return os.MkdirTemp(root, fmt.Sprintf("run-%d-", runID))
+}
+
+func (r *LocalRunner) Exec(ctx context.Context, dir, cmd string, env map[string]string, out io.Writer) (int, error) {
+	c := exec.CommandContext(ctx, "bash", "-c", cmd)
+	c.Dir = dir
+	c.Env = localBaseEnv()
+	for k, v := range env {
+		c.Env = append(c.Env, k+"="+v)
+	}
+	c.Stdout = out
+	c.Stderr = out
+	// 子进程可能继承输出管道, 超时后不无限等待其退出。
+	c.WaitDelay = 5 * time.Second
+	err := c.Run()
+	if ctx.Err() != nil {
+		return -1, ErrTimeout
+	}
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode(), fmt.Errorf("exit status %d", exitErr.ExitCode())
+		}
+		return -1, err
+	}
+	return 0, nil
+}
+
+// localEnvAllowlist 是从 API 服务进程继承给构建命令的环境变量。
+// 流水线步骤可由仓库定义, 服务进程中的数据库、Redis、JWT 与模型凭据不能暴露给它们。
+var localEnvAllowlist = []string{"PATH", "HOME", "LANG", "LC_ALL", "TMPDIR"}
+
+func localBaseEnv() []string {
+	out := make([]string, 0, len(localEnvAllowlist))
+	for _, k := range localEnvAllowlist {
+		if v, ok := os.LookupEnv(k); ok {
+			out = append(out, k+"="+v)
+		}
+	}
+	return out
+}
+
+func (r *LocalRunner) Cleanup(_ context.Context, workspace string) error {
+	if workspace == "" {
+		return nil
+	}
+	return os.RemoveAll(workspace)
+}
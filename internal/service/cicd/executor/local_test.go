@@ -0,0 +1,33 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestLocalRunnerDoesNotLeakServerEnv(t *testing.T) {
+	t.Setenv("OPSPILOT_TEST_SECRET", "sentinel-secret")
+	t.Setenv("DB_PASSWORD", "sentinel-db")
+
+	r := &LocalRunner{Root: t.TempDir()}
+	dir, err := r.Prepare(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("prepare: %v", err)
+	}
+	var out bytes.Buffer
+	code, err := r.Exec(context.Background(), dir, "env", map[string]string{"OPSPILOT_RUN_ID": "1", "GOFLAGS": "-mod=mod"}, &out)
+	if err != nil || code != 0 {
+		t.Fatalf("exec: code=%d err=%v output=%s", code, err, out.String())
+	}
+	got := out.String()
+	if strings.Contains(got, "sentinel-") {
+		t.Fatalf("expected server env to be hidden from steps, got:\n%s", got)
+	}
+	for _, want := range []string{"OPSPILOT_RUN_ID=1", "GOFLAGS=-mod=mod", "PATH="} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("expected %q in step env, got:\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+// Package executor 提供 CI 运行的执行环境抽象。
+//
+// Runner 负责为一次 CI 运行准备隔离的工作目录、在其中执行 shell 命令并清理现场。
+// 内置两种实现:
+//   - LocalRunner: 在本机临时目录中通过 bash 执行, 也用于测试
+//   - SSHRunner: 通过 SSH 在指定的构建主机上执行
+package executor
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+)
+
+// ErrTimeout 表示命令因超时被终止。
+var ErrTimeout = errors.New("command timed out")
+
+// Runner 是 CI 运行的执行环境。
+type Runner interface {
+	// Name 返回执行环境标识, 记录在运行记录上。
+	Name() string
+	// Prepare 为运行创建隔离的工作目录并返回其路径。
+	Prepare(ctx context.Context, runID uint) (string, error)
+	// Exec 在 dir 中执行 shell 命令, 标准输出和标准错误写入 out。
+	// 命令以非零状态退出时返回退出码和错误; ctx 超时返回 ErrTimeout。
+	Exec(ctx context.Context, dir, cmd string, env map[string]string, out io.Writer) (int, error)
+	// Cleanup 删除工作目录。
+	Cleanup(ctx context.Context, workspace string) error
+}
+
+// ShellQuote 用单引号包裹参数, 供拼接 shell 命令使用。
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// envExports 把环境变量渲染为按键排序的 export 语句。
+func envExports(env map[string]string) string {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString("export " + k + "=" + ShellQuote(env[k]) + "; ")
+	}
+	return b.String()
+}
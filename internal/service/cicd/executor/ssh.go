@@ -0,0 +1,72 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SSHRunner 通过 SSH 在构建主机上执行命令。
+//
+// 调用方负责建立和关闭 Client。
+type SSHRunner struct {
+	Client *ssh.Client
+	Host   string // 构建主机标识, 用于记录
+	Root   string // 构建主机上的工作目录根路径
+}
+
+func (r *SSHRunner) Name() string { return "ssh:" + r.Host }
+
+func (r *SSHRunner) Prepare(ctx context.Context, runID uint) (string, error) {
+	root := r.Root
+	if root == "" {
+		root = "/tmp/opspilot-ci"
+	}
+	workspace := path.Join(root, fmt.Sprintf("run-%d-%d", runID, time.Now().UnixNano()))
+	if _, err := r.Exec(ctx, "/", "mkdir -p "+ShellQuote(workspace), nil, io.Discard); err != nil {
+		return "", fmt.Errorf("prepare workspace: %w", err)
+	}
+	return workspace, nil
+}
+
+func (r *SSHRunner) Exec(ctx context.Context, dir, cmd string, env map[string]string, out io.Writer) (int, error) {
+	session, err := r.Client.NewSession()
+	if err != nil {
+		return -1, err
+	}
+	defer session.Close()
+	session.Stdout = out
+	session.Stderr = out
+	script := "cd " + ShellQuote(dir) + " && " + envExports(env) + "bash -c " + ShellQuote(cmd)
+	done := make(chan error, 1)
+	go func() { done <- session.Run(script) }()
+	select {
+	case <-ctx.Done():
+		_ = session.Signal(ssh.SIGKILL)
+		_ = session.Close()
+		return -1, ErrTimeout
+	case err := <-done:
+		if err == nil {
+			return 0, nil
+		}
+		var exitErr *ssh.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitStatus(), fmt.Errorf("exit status %d", exitErr.ExitStatus())
+		}
+		return -1, err
+	}
+}
+
+func (r *SSHRunner) Cleanup(ctx context.Context, workspace string) error {
+	if strings.TrimSpace(workspace) == "" || workspace == "/" {
+		return nil
+	}
+	_, err := r.Exec(ctx, "/", "rm -rf "+ShellQuote(workspace), nil, io.Discard)
+	return err
+}
@@ -1,13 +1,17 @@
 package cicd
 
 import (
+	"context"
+	"errors"
 	"strconv"
 	"strings"
 
 	"github.com/cy77cc/OpsPilot/internal/httpx"
+	deploymentlogic "github.com/cy77cc/OpsPilot/internal/service/deployment"
 	"github.com/cy77cc/OpsPilot/internal/svc"
 	"github.com/cy77cc/OpsPilot/internal/xcode"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type Handler struct {
@@ -88,6 +92,47 @@ func (h *Handler) ListCIRuns(c *gin.Context) {
 	httpx.OK(c, gin.H{"list": rows, "total": len(rows)})
 }
 
+func (h *Handler) ListCIRunSteps(c *gin.Context) {
+	if !httpx.Authorize(c, h.svcCtx.DB, "cicd:ci:read", "cicd:*") {
+		return
+	}
+	rows, err := h.logic.ListCIRunSteps(c.Request.Context(), httpx.UintFromParam(c, "id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			httpx.Fail(c, xcode.NotFound, "ci run not found")
+			return
+		}
+		httpx.ServerErr(c, err)
+		return
+	}
+	httpx.OK(c, gin.H{"list": rows, "total": len(rows)})
+}
+
+// StreamCIRunLogs 跟随 CI 运行的实时日志, 支持 SSE 与 WebSocket, 通过 after 或 Last-Event-ID 断点续读。
+func (h *Handler) StreamCIRunLogs(c *gin.Context) {
+	if !httpx.Authorize(c, h.svcCtx.DB, "cicd:ci:read", "cicd:*") {
+		return
+	}
+	runID := httpx.UintFromParam(c, "id")
+	stream, err := h.logic.CIRunLogStream(c.Request.Context(), runID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			httpx.Fail(c, xcode.NotFound, "ci run not found")
+			return
+		}
+		httpx.ServerErr(c, err)
+		return
+	}
+	h.logic.logs.ServeFollow(c, stream, func(ctx context.Context) (bool, error) {
+		return h.logic.ciRunFinished(ctx, runID)
+	})
+}
+
+// StartCIExecutor 启动 CI 运行的后台执行器。
+func (h *Handler) StartCIExecutor() {
+	h.logic.StartCIExecutor(context.Background())
+}
+
 func (h *Handler) GetDeploymentCDConfig(c *gin.Context) {
 	if !httpx.Authorize(c, h.svcCtx.DB, "cicd:cd:read", "cicd:*") {
 		return
@@ -128,6 +173,14 @@ func (h *Handler) TriggerRelease(c *gin.Context) {
 	}
 	row, err := h.logic.TriggerRelease(c.Request.Context(), uint(httpx.UIDFromCtx(c)), req)
 	if err != nil {
+		if errors.Is(err, deploymentlogic.ErrChangeFreeze) {
+			httpx.Fail(c, xcode.Forbidden, err.Error())
+			return
+		}
+		if errors.Is(err, ErrArtifactExpired) {
+			httpx.Fail(c, xcode.ParamError, err.Error())
+			return
+		}
 		httpx.ServerErr(c, err)
 		return
 	}
@@ -191,6 +244,18 @@ func (h *Handler) RollbackRelease(c *gin.Context) {
 	}
 	row, err := h.logic.RollbackRelease(c.Request.Context(), uint(httpx.UIDFromCtx(c)), httpx.UintFromParam(c, "id"), req.TargetVersion, req.Comment)
 	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			httpx.Fail(c, xcode.NotFound, "release not found")
+			return
+		}
+		if errors.Is(err, deploymentlogic.ErrRollbackTargetNotFound) {
+			httpx.Fail(c, xcode.NotFound, err.Error())
+			return
+		}
+		if errors.Is(err, deploymentlogic.ErrTargetLocked) {
+			httpx.Fail(c, xcode.ParamError, err.Error())
+			return
+		}
 		httpx.ServerErr(c, err)
 		return
 	}
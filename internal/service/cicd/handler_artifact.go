@@ -0,0 +1,55 @@
+package cicd
+
+import (
+	"errors"
+
+	"github.com/cy77cc/OpsPilot/internal/httpx"
+	"github.com/cy77cc/OpsPilot/internal/xcode"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func (h *Handler) ListArtifacts(c *gin.Context) {
+	if !httpx.Authorize(c, h.svcCtx.DB, "cicd:ci:read", "cicd:*") {
+		return
+	}
+	rows, err := h.logic.ListArtifacts(c.Request.Context(), httpx.UintFromParam(c, "service_id"), c.Query("status"), int(httpx.UintFromQuery(c, "limit")))
+	if err != nil {
+		httpx.ServerErr(c, err)
+		return
+	}
+	httpx.OK(c, gin.H{"list": rows, "total": len(rows)})
+}
+
+func (h *Handler) GetArtifact(c *gin.Context) {
+	if !httpx.Authorize(c, h.svcCtx.DB, "cicd:ci:read", "cicd:*") {
+		return
+	}
+	row, err := h.logic.GetArtifact(c.Request.Context(), httpx.UintFromParam(c, "id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			httpx.Fail(c, xcode.NotFound, "artifact not found")
+			return
+		}
+		httpx.ServerErr(c, err)
+		return
+	}
+	httpx.OK(c, row)
+}
+
+// ReleaseChanges 返回发布相对上一次成功发布的提交范围。
+func (h *Handler) ReleaseChanges(c *gin.Context) {
+	if !httpx.Authorize(c, h.svcCtx.DB, "cicd:cd:read", "cicd:audit:read", "cicd:*") {
+		return
+	}
+	row, err := h.logic.ReleaseChanges(c.Request.Context(), httpx.UintFromParam(c, "id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			httpx.Fail(c, xcode.NotFound, "release not found")
+			return
+		}
+		httpx.ServerErr(c, err)
+		return
+	}
+	httpx.OK(c, row)
+}
@@ -0,0 +1,72 @@
+package cicd
+
+import (
+	"errors"
+
+	"github.com/cy77cc/OpsPilot/internal/httpx"
+	"github.com/cy77cc/OpsPilot/internal/xcode"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetCIRunPipeline 返回运行实际执行的流水线定义。
+func (h *Handler) GetCIRunPipeline(c *gin.Context) {
+	if !httpx.Authorize(c, h.svcCtx.DB, "cicd:ci:read", "cicd:*") {
+		return
+	}
+	row, err := h.logic.GetCIRunPipeline(c.Request.Context(), httpx.UintFromParam(c, "id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			httpx.Fail(c, xcode.NotFound, "ci run not found")
+			return
+		}
+		httpx.ServerErr(c, err)
+		return
+	}
+	httpx.OK(c, row)
+}
+
+// ValidatePipeline 校验流水线文件内容, 供提交前检查。
+func (h *Handler) ValidatePipeline(c *gin.Context) {
+	if !httpx.Authorize(c, h.svcCtx.DB, "cicd:ci:read", "cicd:*") {
+		return
+	}
+	var req ValidatePipelineReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		httpx.BindErr(c, err)
+		return
+	}
+	httpx.OK(c, h.logic.ValidatePipeline(c.Request.Context(), req))
+}
+
+func (h *Handler) ApproveCIGate(c *gin.Context) {
+	h.decideCIGate(c, true)
+}
+
+func (h *Handler) RejectCIGate(c *gin.Context) {
+	h.decideCIGate(c, false)
+}
+
+func (h *Handler) decideCIGate(c *gin.Context, approve bool) {
+	if !httpx.Authorize(c, h.svcCtx.DB, "cicd:ci:run", "cicd:*") {
+		return
+	}
+	var req CIGateDecisionReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		httpx.BindErr(c, err)
+		return
+	}
+	row, err := h.logic.DecideCIGate(c.Request.Context(), uint(httpx.UIDFromCtx(c)), httpx.UintFromParam(c, "id"), httpx.UintFromParam(c, "step_id"), approve, req)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			httpx.Fail(c, xcode.NotFound, "ci run step not found")
+		case errors.Is(err, ErrCIGateNotWaiting):
+			httpx.Fail(c, xcode.ParamError, err.Error())
+		default:
+			httpx.ServerErr(c, err)
+		}
+		return
+	}
+	httpx.OK(c, row)
+}
@@ -0,0 +1,84 @@
+package cicd
+
+import (
+	"errors"
+	"io"
+
+	"github.com/cy77cc/OpsPilot/internal/httpx"
+	"github.com/cy77cc/OpsPilot/internal/xcode"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ReceiveWebhook 接收 Git 服务器的推送事件, 由签名而不是 JWT 认证。
+func (h *Handler) ReceiveWebhook(c *gin.Context) {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, WebhookBodyLimit+1))
+	if err != nil {
+		httpx.BindErr(c, err)
+		return
+	}
+	if len(body) > WebhookBodyLimit {
+		httpx.Fail(c, xcode.ParamError, "webhook payload too large")
+		return
+	}
+	resp, err := h.logic.ReceiveWebhook(c.Request.Context(), c.Param("provider"), c.Request.Header, body)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrWebhookProvider):
+			httpx.Fail(c, xcode.ParamError, err.Error())
+		case errors.Is(err, ErrWebhookSignature):
+			httpx.Fail(c, xcode.Unauthorized, err.Error())
+		default:
+			httpx.ServerErr(c, err)
+		}
+		return
+	}
+	httpx.OK(c, resp)
+}
+
+func (h *Handler) ListWebhookDeliveries(c *gin.Context) {
+	if !httpx.Authorize(c, h.svcCtx.DB, "cicd:ci:read", "cicd:*") {
+		return
+	}
+	rows, err := h.logic.ListWebhookDeliveries(c.Request.Context(), c.Query("provider"), c.Query("status"), int(httpx.UintFromQuery(c, "limit")))
+	if err != nil {
+		httpx.ServerErr(c, err)
+		return
+	}
+	httpx.OK(c, gin.H{"list": rows, "total": len(rows)})
+}
+
+func (h *Handler) GetWebhookDelivery(c *gin.Context) {
+	if !httpx.Authorize(c, h.svcCtx.DB, "cicd:ci:read", "cicd:*") {
+		return
+	}
+	row, err := h.logic.GetWebhookDelivery(c.Request.Context(), httpx.UintFromParam(c, "id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			httpx.Fail(c, xcode.NotFound, "webhook delivery not found")
+			return
+		}
+		httpx.ServerErr(c, err)
+		return
+	}
+	httpx.OK(c, row)
+}
+
+func (h *Handler) ReplayWebhookDelivery(c *gin.Context) {
+	if !httpx.Authorize(c, h.svcCtx.DB, "cicd:ci:run", "cicd:*") {
+		return
+	}
+	row, err := h.logic.ReplayWebhookDelivery(c.Request.Context(), uint(httpx.UIDFromCtx(c)), httpx.UintFromParam(c, "id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			httpx.Fail(c, xcode.NotFound, "webhook delivery not found")
+		case errors.Is(err, ErrWebhookNotReplayable):
+			httpx.Fail(c, xcode.ParamError, err.Error())
+		default:
+			httpx.ServerErr(c, err)
+		}
+		return
+	}
+	httpx.OK(c, row)
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	cicdv1 "github.com/cy77cc/OpsPilot/api/cicd/v1"
+	"github.com/cy77cc/OpsPilot/internal/logstream"
 	"github.com/cy77cc/OpsPilot/internal/model"
 	"github.com/cy77cc/OpsPilot/internal/service/cicd/repo"
 	deploymentlogic "github.com/cy77cc/OpsPilot/internal/service/deployment"
@@ -22,6 +23,7 @@ type Logic struct {
 	svcCtx      *svc.ServiceContext
 	repo        *repo.Repository
 	deployLogic *deploymentlogic.Logic
+	logs        *logstream.Store
 }
 
 func NewLogic(svcCtx *svc.ServiceContext) *Logic {
@@ -29,6 +31,7 @@ func NewLogic(svcCtx *svc.ServiceContext) *Logic {
 		svcCtx:      svcCtx,
 		repo:        repo.New(svcCtx.DB),
 		deployLogic: deploymentlogic.NewLogic(svcCtx),
+		logs:        logstream.New(svcCtx.DB, svcCtx.Rdb),
 	}
 }
 
@@ -46,6 +49,8 @@ func (l *Logic) UpsertServiceCIConfig(ctx context.Context, uid uint, serviceID u
 		Branch:         defaultIfEmpty(strings.TrimSpace(req.Branch), "main"),
 		BuildStepsJSON: mustJSON(req.BuildSteps),
 		ArtifactTarget: strings.TrimSpace(req.ArtifactTarget),
+		TagPattern:     strings.TrimSpace(req.TagPattern),
+		WebhookSecret:  strings.TrimSpace(req.WebhookSecret),
 		TriggerMode:    mode,
 		Status:         "active",
 		UpdatedBy:      uid,
@@ -92,10 +97,12 @@ func (l *Logic) TriggerCIRun(ctx context.Context, uid uint, serviceID uint, req
 		ServiceID:   serviceID,
 		CIConfigID:  cfg.ID,
 		TriggerType: triggerType,
-		Status:      "queued",
+		Status:      ciRunStatusQueued,
 		Reason:      strings.TrimSpace(req.Reason),
 		TriggeredBy: uid,
 		TriggeredAt: time.Now(),
+		Branch:      cfg.Branch,
+		RefType:     "branch",
 	})
 	if err != nil {
 		return nil, err
@@ -117,6 +124,21 @@ func (l *Logic) ListCIRuns(ctx context.Context, serviceID uint) ([]cicdv1.CIRunR
 	return out, nil
 }
 
+func (l *Logic) ListCIRunSteps(ctx context.Context, runID uint) ([]cicdv1.CIRunStepResp, error) {
+	if _, err := l.repo.GetCIRun(ctx, runID); err != nil {
+		return nil, err
+	}
+	rows, err := l.repo.ListCIRunSteps(ctx, runID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]cicdv1.CIRunStepResp, 0, len(rows))
+	for i := range rows {
+		out = append(out, toCIRunStepResp(&rows[i]))
+	}
+	return out, nil
+}
+
 func (l *Logic) UpsertDeploymentCDConfig(ctx context.Context, uid uint, deploymentID uint, req UpsertDeploymentCDConfigReq) (*cicdv1.DeploymentCDConfigResp, error) {
 	runtimeType := normalizeRuntimeType(req.RuntimeType)
 	if strings.TrimSpace(req.RuntimeType) != "" && runtimeType == "" {
@@ -140,19 +162,26 @@ func (l *Logic) UpsertDeploymentCDConfig(ctx context.Context, uid uint, deployme
 			return nil, fmt.Errorf("canary strategy requires strategy_config.steps")
 		}
 	}
+	if err := validateAutoDeploy(req); err != nil {
+		return nil, err
+	}
 	row, err := l.repo.UpsertDeploymentCDConfig(ctx, model.CICDDeploymentCDConfig{
-		DeploymentID:       deploymentID,
-		Env:                defaultIfEmpty(strings.TrimSpace(req.Env), "staging"),
-		RuntimeType:        runtimeType,
-		Strategy:           strategy,
-		StrategyConfigJSON: mustJSON(req.StrategyConfig),
-		ApprovalRequired:   req.ApprovalRequired,
-		UpdatedBy:          uid,
+		DeploymentID:           deploymentID,
+		Env:                    defaultIfEmpty(strings.TrimSpace(req.Env), "staging"),
+		RuntimeType:            runtimeType,
+		Strategy:               strategy,
+		StrategyConfigJSON:     mustJSON(req.StrategyConfig),
+		ApprovalRequired:       req.ApprovalRequired,
+		ServiceID:              req.ServiceID,
+		AutoDeploy:             req.AutoDeploy,
+		AutoDeployBranchesJSON: mustJSON(req.AutoDeployBranches),
+		AutoDeployTagsJSON:     mustJSON(req.AutoDeployTags),
+		UpdatedBy:              uid,
 	})
 	if err != nil {
 		return nil, err
 	}
-	_ = l.writeAudit(ctx, 0, deploymentID, 0, "cd.config.updated", uid, map[string]any{"cd_config_id": row.ID, "env": row.Env, "runtime": row.RuntimeType, "strategy": row.Strategy})
+	_ = l.writeAudit(ctx, req.ServiceID, deploymentID, 0, "cd.config.updated", uid, map[string]any{"cd_config_id": row.ID, "env": row.Env, "runtime": row.RuntimeType, "strategy": row.Strategy, "auto_deploy": row.AutoDeploy})
 	return toCDConfigResp(row), nil
 }
 
@@ -165,6 +194,11 @@ func (l *Logic) GetDeploymentCDConfig(ctx context.Context, deploymentID uint, en
 }
 
 func (l *Logic) TriggerRelease(ctx context.Context, uid uint, req TriggerReleaseReq) (*cicdv1.ReleaseResp, error) {
+	return l.triggerRelease(ctx, uid, req, nil)
+}
+
+// triggerRelease 实现 TriggerRelease, extra 合并到发布的触发上下文中。
+func (l *Logic) triggerRelease(ctx context.Context, uid uint, req TriggerReleaseReq, extra map[string]any) (*cicdv1.ReleaseResp, error) {
 	runtimeType := normalizeRuntimeType(req.RuntimeType)
 	if strings.TrimSpace(req.RuntimeType) != "" && runtimeType == "" {
 		return nil, fmt.Errorf("runtime_type must be one of: k8s, compose")
@@ -190,18 +224,34 @@ func (l *Logic) TriggerRelease(ctx context.Context, uid uint, req TriggerRelease
 	} else if !errors.Is(cfgErr, gorm.ErrRecordNotFound) {
 		return nil, fmt.Errorf("load cd config: %w", cfgErr)
 	}
+	if req.CIRunID > 0 {
+		// CI 运行 (流水线部署阶段与自动发布) 只能发布到为本服务配置了 CD 的部署。
+		if _, err := l.serviceCDConfig(ctx, req.ServiceID, targetID, strings.TrimSpace(req.Env), runtimeType); err != nil {
+			return nil, err
+		}
+	}
 	if runtimeType == "" {
 		runtimeType = normalizeRuntimeType(cfg.RuntimeType)
 	}
 	if runtimeType == "" {
 		runtimeType = "k8s"
 	}
+	artifact, err := l.resolveReleaseArtifact(ctx, req)
+	if err != nil {
+		return nil, err
+	}
 
 	previewReq := deploymentlogic.ReleasePreviewReq{
-		ServiceID: req.ServiceID,
-		TargetID:  targetID,
-		Env:       strings.TrimSpace(req.Env),
-		Strategy:  cfg.Strategy,
+		ServiceID:      req.ServiceID,
+		TargetID:       targetID,
+		Env:            strings.TrimSpace(req.Env),
+		Strategy:       cfg.Strategy,
+		StrategyConfig: parseMapJSON(cfg.StrategyConfigJSON),
+	}
+	if artifact != nil {
+		previewReq.Variables = artifactVariables(artifact)
+		previewReq.Artifact = releaseArtifact(artifact)
+		req.CIRunID = artifact.CIRunID
 	}
 	preview, err := l.deployLogic.PreviewRelease(ctx, previewReq)
 	if err != nil {
@@ -211,16 +261,37 @@ func (l *Logic) TriggerRelease(ctx context.Context, uid uint, req TriggerRelease
 	applyReq.PreviewToken = preview.PreviewToken
 	applyReq.TriggerSource = defaultIfEmpty(strings.TrimSpace(req.TriggerSource), "ci")
 	applyReq.CIRunID = req.CIRunID
+	applyReq.EmergencyOverride = req.EmergencyOverride
+	applyReq.OverrideReason = req.OverrideReason
 	applyReq.TriggerContext = map[string]any{
 		"entry":         "cicd.release",
+		"env":           strings.TrimSpace(req.Env),
 		"version":       strings.TrimSpace(req.Version),
 		"deployment_id": targetID,
 		"runtime_type":  runtimeType,
 		"ci_run_id":     req.CIRunID,
 		"target_source": resolutionSource,
 	}
+	if artifact != nil {
+		applyReq.TriggerContext["artifact_id"] = artifact.ID
+		applyReq.TriggerContext["artifact_ref"] = pinnedArtifactRef(artifact)
+	}
+	for k, v := range extra {
+		applyReq.TriggerContext[k] = v
+	}
 	resp, err := l.deployLogic.ApplyRelease(ctx, uint64(uid), applyReq)
 	if err != nil {
+		if errors.Is(err, deploymentlogic.ErrChangeFreeze) {
+			// 冻结详情由发布审计 release.freeze_blocked 记录, 这里只记录 CI/CD 触发被拦截。
+			_ = l.writeAudit(ctx, req.ServiceID, targetID, resp.ReleaseID, "release.trigger_blocked", uid, map[string]any{
+				"version":            strings.TrimSpace(req.Version),
+				"emergency_override": req.EmergencyOverride,
+				"unified_release_id": resp.ReleaseID,
+				"reason_code":        "change_freeze",
+				"reason":             err.Error(),
+			})
+			l.invalidateTimelineCache(ctx, req.ServiceID)
+		}
 		return nil, err
 	}
 	release, err := l.deployLogic.GetRelease(ctx, resp.ReleaseID)
@@ -229,7 +300,8 @@ func (l *Logic) TriggerRelease(ctx context.Context, uid uint, req TriggerRelease
 	}
 	_ = l.writeAudit(ctx, req.ServiceID, targetID, release.ID, "release.triggered", uid, map[string]any{
 		"status":             release.Status,
-		"approval_required":  cfg.ApprovalRequired,
+		"approval_required":  resp.ApprovalRequired,
+		"approval_source":    resp.ApprovalSource,
 		"version":            strings.TrimSpace(req.Version),
 		"unified_release_id": release.ID,
 		"target_source":      resolutionSource,
@@ -238,6 +310,21 @@ func (l *Logic) TriggerRelease(ctx context.Context, uid uint, req TriggerRelease
 	return toReleaseRespFromDeployment(release, targetID, strings.TrimSpace(req.Version)), nil
 }
 
+// serviceCDConfig 返回部署上绑定到指定服务的 CD 配置; 配置不存在或属于其他服务时返回错误。
+func (l *Logic) serviceCDConfig(ctx context.Context, serviceID, deploymentID uint, env, runtimeType string) (*model.CICDDeploymentCDConfig, error) {
+	cfg, err := l.repo.GetDeploymentCDConfig(ctx, deploymentID, env, runtimeType)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("no cd config for deployment %d env %s", deploymentID, env)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load cd config: %w", err)
+	}
+	if cfg.ServiceID != serviceID {
+		return nil, fmt.Errorf("cd config for deployment %d env %s is not bound to service %d", deploymentID, env, serviceID)
+	}
+	return cfg, nil
+}
+
 func (l *Logic) resolveReleaseTarget(ctx context.Context, serviceID, deploymentID uint, env, runtimeType string) (uint, string, string, error) {
 	if deploymentID > 0 {
 		var target model.DeploymentTarget
@@ -338,21 +425,40 @@ func (l *Logic) RejectRelease(ctx context.Context, uid uint, releaseID uint, com
 }
 
 func (l *Logic) RollbackRelease(ctx context.Context, uid uint, releaseID uint, targetVersion, comment string) (*cicdv1.ReleaseResp, error) {
-	rollback, err := l.deployLogic.RollbackRelease(ctx, releaseID, uint64(uid))
+	current, err := l.deployLogic.GetRelease(ctx, releaseID)
 	if err != nil {
 		return nil, err
 	}
+	targetVersion = strings.TrimSpace(targetVersion)
+	rollback, err := l.executeRuntimeRollback(ctx, uid, current, targetVersion)
+	if err != nil {
+		payload := map[string]any{
+			"runtime":        current.RuntimeType,
+			"target_version": targetVersion,
+			"comment":        strings.TrimSpace(comment),
+			"error":          err.Error(),
+		}
+		if rollback.ReleaseID > 0 {
+			payload["rollback_release_id"] = rollback.ReleaseID
+		}
+		_ = l.writeAudit(ctx, current.ServiceID, current.TargetID, current.ID, "release.rollback_failed", uid, payload)
+		l.invalidateTimelineCache(ctx, current.ServiceID)
+		return nil, err
+	}
 	row, err := l.deployLogic.GetRelease(ctx, rollback.ReleaseID)
 	if err != nil {
 		return nil, err
 	}
 	_ = l.writeAudit(ctx, row.ServiceID, row.TargetID, row.ID, "release.rolled_back", uid, map[string]any{
-		"runtime":        row.RuntimeType,
-		"target_version": strings.TrimSpace(targetVersion),
-		"comment":        strings.TrimSpace(comment),
+		"runtime":         row.RuntimeType,
+		"target_version":  targetVersion,
+		"from_release_id": current.ID,
+		"to_release_id":   parseMapJSON(row.TriggerContextJSON)["rollback_to_release_id"],
+		"verification":    parseAnyJSON(row.VerificationJSON),
+		"comment":         strings.TrimSpace(comment),
 	})
 	l.invalidateTimelineCache(ctx, row.ServiceID)
-	return toReleaseRespFromDeployment(row, row.TargetID, strings.TrimSpace(targetVersion)), nil
+	return toReleaseRespFromDeployment(row, row.TargetID, targetVersion), nil
 }
 
 func (l *Logic) ListReleases(ctx context.Context, serviceID, deploymentID uint, runtimeType string) ([]cicdv1.ReleaseResp, error) {
@@ -489,26 +595,55 @@ func (l *Logic) writeAudit(ctx context.Context, serviceID, deploymentID, release
 
 func toServiceCIConfigResp(row *model.CICDServiceCIConfig) *cicdv1.ServiceCIConfigResp {
 	return &cicdv1.ServiceCIConfigResp{
-		ID:             row.ID,
-		ServiceID:      row.ServiceID,
-		RepoURL:        row.RepoURL,
-		Branch:         row.Branch,
-		BuildSteps:     parseStringSliceJSON(row.BuildStepsJSON),
-		ArtifactTarget: row.ArtifactTarget,
-		TriggerMode:    row.TriggerMode,
-		Status:         row.Status,
-		UpdatedBy:      row.UpdatedBy,
-		CreatedAt:      row.CreatedAt,
-		UpdatedAt:      row.UpdatedAt,
+		ID:               row.ID,
+		ServiceID:        row.ServiceID,
+		RepoURL:          row.RepoURL,
+		Branch:           row.Branch,
+		BuildSteps:       parseStringSliceJSON(row.BuildStepsJSON),
+		ArtifactTarget:   row.ArtifactTarget,
+		TagPattern:       row.TagPattern,
+		WebhookSecretSet: row.WebhookSecret != "",
+		TriggerMode:      row.TriggerMode,
+		Status:           row.Status,
+		UpdatedBy:        row.UpdatedBy,
+		CreatedAt:        row.CreatedAt,
+		UpdatedAt:        row.UpdatedAt,
 	}
 }
 
 func toCIRunResp(row *model.CICDServiceCIRun) *cicdv1.CIRunResp {
-	return &cicdv1.CIRunResp{ID: row.ID, ServiceID: row.ServiceID, CIConfigID: row.CIConfigID, TriggerType: row.TriggerType, Status: row.Status, Reason: row.Reason, TriggeredBy: row.TriggeredBy, TriggeredAt: row.TriggeredAt, CreatedAt: row.CreatedAt}
+	return &cicdv1.CIRunResp{
+		ID:                row.ID,
+		ServiceID:         row.ServiceID,
+		CIConfigID:        row.CIConfigID,
+		TriggerType:       row.TriggerType,
+		Status:            row.Status,
+		Reason:            row.Reason,
+		TriggeredBy:       row.TriggeredBy,
+		TriggeredAt:       row.TriggeredAt,
+		Branch:            row.Branch,
+		RefType:           row.RefType,
+		CommitSHA:         row.CommitSHA,
+		CommitAuthor:      row.CommitAuthor,
+		CommitMessage:     row.CommitMessage,
+		WebhookDeliveryID: row.WebhookDeliveryID,
+		ArtifactRef:       row.ArtifactRef,
+		Runner:            row.Runner,
+		ErrorMessage:      row.ErrorMessage,
+		PipelineSource:    row.PipelineSource,
+		AutoDeploys:       parseAutoDeployJSON(row.AutoDeployJSON),
+		StartedAt:         row.StartedAt,
+		FinishedAt:        row.FinishedAt,
+		CreatedAt:         row.CreatedAt,
+	}
+}
+
+func toCIRunStepResp(row *model.CICDServiceCIRunStep) cicdv1.CIRunStepResp {
+	return cicdv1.CIRunStepResp{ID: row.ID, RunID: row.RunID, Seq: row.Seq, Stage: row.Stage, Kind: row.Kind, Name: row.Name, Image: row.Image, Command: row.Command, Status: row.Status, ApprovedBy: row.ApprovedBy, ExitCode: row.ExitCode, Log: row.Log, StartedAt: row.StartedAt, FinishedAt: row.FinishedAt}
 }
 
 func toCDConfigResp(row *model.CICDDeploymentCDConfig) *cicdv1.DeploymentCDConfigResp {
-	return &cicdv1.DeploymentCDConfigResp{ID: row.ID, DeploymentID: row.DeploymentID, Env: row.Env, RuntimeType: row.RuntimeType, Strategy: row.Strategy, StrategyConfig: parseMapJSON(row.StrategyConfigJSON), ApprovalRequired: row.ApprovalRequired, UpdatedBy: row.UpdatedBy, CreatedAt: row.CreatedAt, UpdatedAt: row.UpdatedAt}
+	return &cicdv1.DeploymentCDConfigResp{ID: row.ID, DeploymentID: row.DeploymentID, Env: row.Env, RuntimeType: row.RuntimeType, Strategy: row.Strategy, StrategyConfig: parseMapJSON(row.StrategyConfigJSON), ApprovalRequired: row.ApprovalRequired, ServiceID: row.ServiceID, AutoDeploy: row.AutoDeploy, AutoDeployBranches: parseStringSliceJSON(row.AutoDeployBranchesJSON), AutoDeployTags: parseStringSliceJSON(row.AutoDeployTagsJSON), UpdatedBy: row.UpdatedBy, CreatedAt: row.CreatedAt, UpdatedAt: row.UpdatedAt}
 }
 
 func toReleaseResp(row *model.CICDRelease) *cicdv1.ReleaseResp {
@@ -541,6 +676,9 @@ func toReleaseRespFromDeployment(row *model.DeploymentRelease, deploymentID uint
 		TriggerSource:    row.TriggerSource,
 		TriggerContext:   parseAnyJSON(row.TriggerContextJSON),
 		CIRunID:          row.CIRunID,
+		ArtifactID:       row.ArtifactID,
+		ArtifactDigest:   row.ArtifactDigest,
+		CommitSHA:        row.CommitSHA,
 	}
 }
 
@@ -588,13 +726,51 @@ func normalizeRuntimeType(runtimeType string) string {
 	}
 }
 
-func (l *Logic) executeRuntimeRollback(ctx context.Context, runtimeType string) error {
-	switch runtimeType {
+// executeRuntimeRollback 解析回滚目标版本, 通过 deployment 的运行时执行器重新应用该版本的清单快照并验证。
+func (l *Logic) executeRuntimeRollback(ctx context.Context, uid uint, current *model.DeploymentRelease, targetVersion string) (deploymentlogic.ReleaseApplyResp, error) {
+	switch current.RuntimeType {
 	case "k8s", "compose":
-		return nil
 	default:
-		return fmt.Errorf("unsupported runtime rollback executor: %s", runtimeType)
+		return deploymentlogic.ReleaseApplyResp{}, fmt.Errorf("unsupported runtime rollback executor: %s", current.RuntimeType)
+	}
+	toID, err := l.resolveRollbackVersion(ctx, current, targetVersion)
+	if err != nil {
+		return deploymentlogic.ReleaseApplyResp{}, err
+	}
+	return l.deployLogic.RollbackReleaseTo(ctx, current.ID, toID, uint64(uid))
+}
+
+// resolveRollbackVersion 把回滚版本解析为同一目标上成功的发布, 为空时返回 0 表示上一次成功发布。
+// 版本依次匹配发布时的 version、rev-<revision>、发布 ID、提交 (至少 7 位前缀) 和制品 digest。
+// 回滚记录只在验证成功后才进入 rollback 状态, 执行中或失败的回滚不会被命中。
+func (l *Logic) resolveRollbackVersion(ctx context.Context, current *model.DeploymentRelease, version string) (uint, error) {
+	if version == "" {
+		return 0, nil
+	}
+	rows := make([]model.DeploymentRelease, 0)
+	if err := l.svcCtx.DB.WithContext(ctx).
+		Select("id", "revision_id", "trigger_context_json", "commit_sha", "artifact_digest").
+		Where("service_id = ? AND target_id = ? AND id <> ? AND status IN ? AND manifest_snapshot <> ''",
+			current.ServiceID, current.TargetID, current.ID, []string{"applied", "rollback", "rolled_back"}).
+		Order("id DESC").Find(&rows).Error; err != nil {
+		return 0, err
+	}
+	for _, row := range rows {
+		if v, _ := parseMapJSON(row.TriggerContextJSON)["version"].(string); strings.TrimSpace(v) == version {
+			return row.ID, nil
+		}
+	}
+	for _, row := range rows {
+		switch {
+		case row.RevisionID > 0 && version == fmt.Sprintf("rev-%d", row.RevisionID), version == fmt.Sprintf("%d", row.ID):
+			return row.ID, nil
+		case row.CommitSHA != "" && len(version) >= 7 && strings.HasPrefix(row.CommitSHA, version):
+			return row.ID, nil
+		case row.ArtifactDigest != "" && row.ArtifactDigest == version:
+			return row.ID, nil
+		}
 	}
+	return 0, fmt.Errorf("%w: version %q has no successful release on deployment %d", deploymentlogic.ErrRollbackTargetNotFound, version, current.TargetID)
 }
 
 func parseStringSliceJSON(raw string) []string {
@@ -0,0 +1,359 @@
+package cicd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	cicdv1 "github.com/cy77cc/OpsPilot/api/cicd/v1"
+	"github.com/cy77cc/OpsPilot/internal/config"
+	"github.com/cy77cc/OpsPilot/internal/logger"
+	"github.com/cy77cc/OpsPilot/internal/model"
+	"github.com/cy77cc/OpsPilot/internal/service/cicd/executor"
+	deploymentlogic "github.com/cy77cc/OpsPilot/internal/service/deployment"
+	"gorm.io/gorm"
+)
+
+const (
+	artifactKindImage = "image"
+	artifactKindFile  = "file"
+
+	artifactStatusActive  = "active"
+	artifactStatusExpired = "expired"
+
+	// ciMetadataFile 是构建步骤写入 SBOM/元数据的文件, 位于工作目录下。
+	ciMetadataFile     = "metadata.json"
+	ciMetadataLimit    = 1 << 20
+	artifactSweepEvery = time.Hour
+
+	defaultArtifactKeepLast = 20
+	defaultArtifactMaxAge   = 90 * 24 * time.Hour
+)
+
+// ErrArtifactExpired 表示制品已被保留策略过期, 不能再用于发布。
+var ErrArtifactExpired = errors.New("artifact expired")
+
+// recordArtifact 在推送成功后解析制品 digest 并登记制品记录。
+func (e *ciExecutor) recordArtifact(ctx context.Context, runner executor.Runner, run *model.CICDServiceCIRun, workspace string, env map[string]string) error {
+	kind := artifactKindImage
+	if strings.HasPrefix(run.ArtifactRef, "file://") {
+		kind = artifactKindFile
+	}
+	digest, err := resolveArtifactDigest(ctx, runner, workspace, kind, run.ArtifactRef, env)
+	if err != nil {
+		return fmt.Errorf("resolve artifact digest: %w", err)
+	}
+	var meta strings.Builder
+	cmd := fmt.Sprintf(`if [ -f "$OPSPILOT_METADATA_FILE" ]; then head -c %d "$OPSPILOT_METADATA_FILE"; fi`, ciMetadataLimit)
+	if _, err := runner.Exec(ctx, workspace, cmd, env, &meta); err != nil {
+		return fmt.Errorf("read artifact metadata: %w", err)
+	}
+	metadata := strings.TrimSpace(meta.String())
+	if metadata != "" && !json.Valid([]byte(metadata)) {
+		metadata = mustJSON(metadata)
+	}
+
+	artifact := &model.CICDArtifact{
+		ServiceID:     run.ServiceID,
+		CIRunID:       run.ID,
+		Kind:          kind,
+		Reference:     run.ArtifactRef,
+		Digest:        digest,
+		CommitSHA:     run.CommitSHA,
+		Branch:        run.Branch,
+		Author:        run.CommitAuthor,
+		CommitMessage: run.CommitMessage,
+		MetadataJSON:  metadata,
+		Status:        artifactStatusActive,
+	}
+	if run.StartedAt != nil {
+		artifact.DurationMs = time.Since(*run.StartedAt).Milliseconds()
+	}
+	if err := e.logic.repo.CreateArtifact(ctx, artifact); err != nil {
+		return fmt.Errorf("record artifact: %w", err)
+	}
+	_ = e.logic.writeAudit(ctx, run.ServiceID, 0, 0, "ci.artifact.recorded", run.TriggeredBy, map[string]any{
+		"ci_run_id":   run.ID,
+		"artifact_id": artifact.ID,
+		"reference":   artifact.Reference,
+		"digest":      artifact.Digest,
+	})
+	return nil
+}
+
+// resolveArtifactDigest 返回制品的 sha256 digest。
+//
+//   - 镜像: 取推送后镜像在目标仓库下的 RepoDigests; 引用本身带 digest 时直接使用
+//   - 文件: 对目录下全部文件按路径排序后的 sha256sum 清单再做一次 sha256
+func resolveArtifactDigest(ctx context.Context, runner executor.Runner, workspace, kind, ref string, env map[string]string) (string, error) {
+	if kind == artifactKindImage {
+		if _, digest, ok := strings.Cut(ref, "@"); ok {
+			return digest, nil
+		}
+	}
+	cmd := `cd "$OPSPILOT_ARTIFACT_PATH" && find . -type f -print0 | LC_ALL=C sort -z | xargs -0 -r sha256sum | sha256sum`
+	if kind == artifactKindImage {
+		cmd = `docker image inspect --format '{{range .RepoDigests}}{{println .}}{{end}}' "$OPSPILOT_ARTIFACT_REF"`
+	}
+	var out strings.Builder
+	if code, err := runner.Exec(ctx, workspace, cmd, env, &out); err != nil {
+		return "", fmt.Errorf("exit %d: %w: %s", code, err, truncateString(strings.TrimSpace(out.String()), 512))
+	}
+	if kind == artifactKindFile {
+		sum := strings.Fields(out.String())
+		if len(sum) == 0 {
+			return "", fmt.Errorf("empty checksum output")
+		}
+		return "sha256:" + sum[0], nil
+	}
+	repository := artifactRepository(ref)
+	for _, line := range strings.Split(out.String(), "\n") {
+		if name, digest, ok := strings.Cut(strings.TrimSpace(line), "@"); ok && name == repository {
+			return digest, nil
+		}
+	}
+	return "", fmt.Errorf("no digest of %s found in image %s", repository, ref)
+}
+
+// artifactRepository 去掉镜像引用中的 tag 与 digest。
+func artifactRepository(ref string) string {
+	ref, _, _ = strings.Cut(ref, "@")
+	slash := strings.LastIndex(ref, "/")
+	if colon := strings.LastIndex(ref, ":"); colon > slash {
+		ref = ref[:colon]
+	}
+	return ref
+}
+
+// pinnedArtifactRef 返回按 digest 固定的制品引用, 文件制品的目录以提交区分, 直接使用原地址。
+func pinnedArtifactRef(row *model.CICDArtifact) string {
+	if row.Kind != artifactKindImage || row.Digest == "" {
+		return row.Reference
+	}
+	return artifactRepository(row.Reference) + "@" + row.Digest
+}
+
+func (l *Logic) ListArtifacts(ctx context.Context, serviceID uint, status string, limit int) ([]cicdv1.ArtifactResp, error) {
+	rows, err := l.repo.ListArtifacts(ctx, serviceID, strings.TrimSpace(status), limit)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]cicdv1.ArtifactResp, 0, len(rows))
+	for i := range rows {
+		out = append(out, toArtifactResp(&rows[i]))
+	}
+	return out, nil
+}
+
+func (l *Logic) GetArtifact(ctx context.Context, id uint) (*cicdv1.ArtifactResp, error) {
+	row, err := l.repo.GetArtifact(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	resp := toArtifactResp(row)
+	return &resp, nil
+}
+
+// resolveReleaseArtifact 返回发布要固定的制品: 优先 artifact_id, 其次 ci_run_id 产出的制品。
+// 两者都未指定或运行没有制品时返回 nil。
+func (l *Logic) resolveReleaseArtifact(ctx context.Context, req TriggerReleaseReq) (*model.CICDArtifact, error) {
+	var (
+		row *model.CICDArtifact
+		err error
+	)
+	switch {
+	case req.ArtifactID > 0:
+		row, err = l.repo.GetArtifact(ctx, req.ArtifactID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("artifact %d not found", req.ArtifactID)
+		}
+	case req.CIRunID > 0:
+		row, err = l.repo.GetArtifactByRun(ctx, req.CIRunID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if row.ServiceID != req.ServiceID {
+		return nil, fmt.Errorf("artifact %d belongs to service %d", row.ID, row.ServiceID)
+	}
+	if req.CIRunID > 0 && row.CIRunID != req.CIRunID {
+		return nil, fmt.Errorf("artifact %d was not built by ci run %d", row.ID, req.CIRunID)
+	}
+	if row.Status == artifactStatusExpired {
+		return nil, fmt.Errorf("%w: %d", ErrArtifactExpired, row.ID)
+	}
+	return row, nil
+}
+
+// artifactVariables 返回渲染清单时注入的制品变量, image 固定为按 digest 引用的制品。
+func artifactVariables(row *model.CICDArtifact) map[string]string {
+	pinned := pinnedArtifactRef(row)
+	return map[string]string{
+		"image":           pinned,
+		"artifact_image":  pinned,
+		"artifact_digest": row.Digest,
+		"commit_sha":      row.CommitSHA,
+	}
+}
+
+func releaseArtifact(row *model.CICDArtifact) *deploymentlogic.ReleaseArtifact {
+	return &deploymentlogic.ReleaseArtifact{ID: row.ID, Digest: row.Digest, CommitSHA: row.CommitSHA}
+}
+
+// ReleaseChanges 返回发布相对同一服务、同一目标上一次成功发布的提交范围和其间构建的制品。
+func (l *Logic) ReleaseChanges(ctx context.Context, releaseID uint) (*cicdv1.ReleaseChangesResp, error) {
+	db := l.svcCtx.DB.WithContext(ctx)
+	var release model.DeploymentRelease
+	if err := db.First(&release, releaseID).Error; err != nil {
+		return nil, err
+	}
+	resp := &cicdv1.ReleaseChangesResp{ReleaseID: release.ID, ToCommit: release.CommitSHA, Range: release.CommitSHA, Artifacts: []cicdv1.ArtifactResp{}}
+	if release.CommitSHA == "" {
+		return resp, nil
+	}
+	var prev model.DeploymentRelease
+	err := db.Where("service_id = ? AND target_id = ? AND id < ? AND status IN ? AND commit_sha <> ''",
+		release.ServiceID, release.TargetID, release.ID, []string{"applied", "rollback"}).
+		Order("id DESC").First(&prev).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if err == nil {
+		resp.PreviousReleaseID = prev.ID
+		resp.FromCommit = prev.CommitSHA
+		resp.Range = prev.CommitSHA + ".." + release.CommitSHA
+		if cfg, cfgErr := l.repo.GetServiceCIConfig(ctx, release.ServiceID); cfgErr == nil {
+			resp.CompareURL = compareURL(cfg.RepoURL, prev.CommitSHA, release.CommitSHA)
+		}
+	}
+	if release.ArtifactID == 0 {
+		return resp, nil
+	}
+	rows, err := l.repo.ListArtifactsBetween(ctx, release.ServiceID, prev.ArtifactID, release.ArtifactID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range rows {
+		resp.Artifacts = append(resp.Artifacts, toArtifactResp(&rows[i]))
+	}
+	return resp, nil
+}
+
+// compareURL 为 http(s) 仓库地址生成网页上的提交对比链接, GitLab 使用 /-/compare。
+func compareURL(repoURL, from, to string) string {
+	u, err := url.Parse(strings.TrimSpace(repoURL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ""
+	}
+	u.User = nil
+	u.Path = strings.TrimSuffix(strings.TrimSuffix(u.Path, "/"), ".git")
+	prefix := "/compare/"
+	if strings.Contains(strings.ToLower(u.Hostname()), "gitlab") {
+		prefix = "/-/compare/"
+	}
+	return u.Scheme + "://" + u.Host + path.Clean(u.Path+prefix) + "/" + from + "..." + to
+}
+
+// runArtifactRetention 每小时按 cicd.artifact_keep_last / artifact_max_age 过期制品。
+func (l *Logic) runArtifactRetention(ctx context.Context) {
+	cfg := config.CFG.CICD
+	keepLast, maxAge := cfg.ArtifactKeepLast, cfg.ArtifactMaxAge
+	if keepLast == 0 {
+		keepLast = defaultArtifactKeepLast
+	}
+	if maxAge == 0 {
+		maxAge = defaultArtifactMaxAge
+	}
+	ticker := time.NewTicker(artifactSweepEvery)
+	defer ticker.Stop()
+	for {
+		if _, err := l.applyArtifactRetention(ctx, keepLast, maxAge, time.Now()); err != nil {
+			logger.L().Warn("artifact retention failed", logger.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// applyArtifactRetention 过期超出保留数量或保留时间的制品, 返回过期数量。
+// 每个服务最新的制品和被发布记录引用的制品始终保留, 以便回滚和追溯。
+// 只标记记录, 仓库中镜像或文件的清理由仓库自身的策略负责。
+func (l *Logic) applyArtifactRetention(ctx context.Context, keepLast int, maxAge time.Duration, now time.Time) (int, error) {
+	serviceIDs, err := l.repo.ListArtifactServiceIDs(ctx)
+	if err != nil {
+		return 0, err
+	}
+	expired := 0
+	for _, serviceID := range serviceIDs {
+		rows, err := l.repo.ListArtifacts(ctx, serviceID, artifactStatusActive, -1)
+		if err != nil {
+			return expired, err
+		}
+		candidates := make([]uint, 0)
+		for i, row := range rows {
+			if i == 0 {
+				continue
+			}
+			if (keepLast > 0 && i >= keepLast) || (maxAge > 0 && now.Sub(row.CreatedAt) > maxAge) {
+				candidates = append(candidates, row.ID)
+			}
+		}
+		referenced, err := l.repo.ListReferencedArtifactIDs(ctx, candidates)
+		if err != nil {
+			return expired, err
+		}
+		ids := make([]uint, 0, len(candidates))
+		for _, id := range candidates {
+			if !referenced[id] {
+				ids = append(ids, id)
+			}
+		}
+		if len(ids) == 0 {
+			continue
+		}
+		if err := l.repo.ExpireArtifacts(ctx, ids, now); err != nil {
+			return expired, err
+		}
+		expired += len(ids)
+		_ = l.writeAudit(ctx, serviceID, 0, 0, "ci.artifact.expired", 0, map[string]any{"artifact_ids": ids})
+		l.invalidateTimelineCache(ctx, serviceID)
+	}
+	return expired, nil
+}
+
+func toArtifactResp(row *model.CICDArtifact) cicdv1.ArtifactResp {
+	resp := cicdv1.ArtifactResp{
+		ID:            row.ID,
+		ServiceID:     row.ServiceID,
+		CIRunID:       row.CIRunID,
+		Kind:          row.Kind,
+		Reference:     row.Reference,
+		Digest:        row.Digest,
+		PinnedRef:     pinnedArtifactRef(row),
+		CommitSHA:     row.CommitSHA,
+		Branch:        row.Branch,
+		Author:        row.Author,
+		CommitMessage: row.CommitMessage,
+		DurationMs:    row.DurationMs,
+		Status:        row.Status,
+		ExpiredAt:     row.ExpiredAt,
+		CreatedAt:     row.CreatedAt,
+	}
+	if row.MetadataJSON != "" {
+		resp.Metadata = parseAnyJSON(row.MetadataJSON)
+	}
+	return resp
+}
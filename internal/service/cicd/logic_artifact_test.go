@@ -0,0 +1,142 @@
+package cicd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cy77cc/OpsPilot/internal/model"
+)
+
+func TestCIExecutorRecordsArtifacts(t *testing.T) {
+	logic := newTestLogic(t)
+	ctx := context.Background()
+	origin, commit := newTestBareRepo(t)
+	e := newTestCIExecutor(logic, t.TempDir())
+
+	run := runQueuedCI(t, logic, e, 601, UpsertServiceCIConfigReq{
+		RepoURL:        origin,
+		BuildSteps:     []string{`cp app.txt "$OPSPILOT_ARTIFACT_DIR"/ && echo '{"sbom":["app.txt"]}' > "$OPSPILOT_METADATA_FILE"`},
+		ArtifactTarget: "file://" + t.TempDir(),
+	})
+	if run.Status != ciRunStatusSucceeded {
+		t.Fatalf("expected succeeded run, got %+v", run)
+	}
+	artifact, err := logic.repo.GetArtifactByRun(ctx, run.ID)
+	if err != nil {
+		t.Fatalf("expected artifact for run: %v", err)
+	}
+	if artifact.Kind != artifactKindFile || artifact.Reference != run.ArtifactRef || artifact.CommitSHA != commit ||
+		artifact.Branch != "main" || !strings.HasPrefix(artifact.Digest, "sha256:") || len(artifact.Digest) != 71 {
+		t.Fatalf("unexpected file artifact %+v", artifact)
+	}
+	detail, err := logic.GetArtifact(ctx, artifact.ID)
+	if err != nil {
+		t.Fatalf("get artifact: %v", err)
+	}
+	if meta, ok := detail.Metadata.(map[string]any); !ok || meta["sbom"] == nil {
+		t.Fatalf("expected metadata to be kept as json, got %#v", detail.Metadata)
+	}
+
+	// 以假的 docker 模拟推送, 镜像制品按仓库 digest 登记。
+	bin := t.TempDir()
+	script := "#!/bin/sh\n[ \"$1\" = image ] && echo other.local/web@sha256:bad && echo registry.local/shop/web@sha256:feed\nexit 0\n"
+	if err := os.WriteFile(filepath.Join(bin, "docker"), []byte(script), 0o755); err != nil {
+		t.Fatalf("write fake docker: %v", err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	run = runQueuedCI(t, logic, e, 602, UpsertServiceCIConfigReq{
+		RepoURL:        origin,
+		BuildSteps:     []string{"echo built"},
+		ArtifactTarget: "registry.local/shop/web",
+	})
+	image, err := logic.repo.GetArtifactByRun(ctx, run.ID)
+	if err != nil || run.Status != ciRunStatusSucceeded {
+		t.Fatalf("expected image artifact, got %+v %v", run, err)
+	}
+	if image.Digest != "sha256:feed" || pinnedArtifactRef(image) != "registry.local/shop/web@sha256:feed" {
+		t.Fatalf("expected image pinned to its digest, got %+v", image)
+	}
+}
+
+func TestTriggerReleasePinsArtifactAndReportsChanges(t *testing.T) {
+	logic := newTestLogic(t)
+	ctx := context.Background()
+	db := logic.svcCtx.DB
+	db.Create(&model.Service{ID: 603, Name: "svc-artifact", Env: "staging", ProjectID: 11, TeamID: 12,
+		YamlContent: "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: svc-artifact\ndata:\n  image: \"{{image}}\"\n"})
+	db.Create(&model.Cluster{ID: 6, Name: "cluster-6", KubeConfig: "invalid-kubeconfig", Status: "active"})
+	db.Create(&model.DeploymentTarget{ID: 603, Name: "target-artifact", TargetType: "k8s", RuntimeType: "k8s", ClusterID: 6,
+		ProjectID: 11, TeamID: 12, Env: "production", Status: "active", ReadinessStatus: "ready"})
+	if _, err := logic.UpsertServiceCIConfig(ctx, 1, 603, UpsertServiceCIConfigReq{
+		RepoURL: "https://git.example.com/acme/shop.git", ArtifactTarget: "registry.local/shop", TriggerMode: "manual",
+	}); err != nil {
+		t.Fatalf("upsert ci config: %v", err)
+	}
+	artifacts := make([]model.CICDArtifact, 3)
+	for i := range artifacts {
+		artifacts[i] = model.CICDArtifact{ServiceID: 603, CIRunID: uint(6030 + i), Kind: artifactKindImage,
+			Reference: "registry.local/shop:c" + string(rune('1'+i)), Digest: "sha256:d" + string(rune('1'+i)),
+			CommitSHA: "c" + string(rune('1'+i)), Author: "dev", Status: artifactStatusActive}
+		if err := logic.repo.CreateArtifact(ctx, &artifacts[i]); err != nil {
+			t.Fatalf("seed artifact: %v", err)
+		}
+	}
+	previous := model.DeploymentRelease{ServiceID: 603, TargetID: 603, RuntimeType: "k8s", Status: "applied",
+		ArtifactID: artifacts[0].ID, ArtifactDigest: artifacts[0].Digest, CommitSHA: artifacts[0].CommitSHA}
+	db.Create(&previous)
+
+	release, err := logic.TriggerRelease(ctx, 3, TriggerReleaseReq{ServiceID: 603, DeploymentID: 603, Env: "production", ArtifactID: artifacts[2].ID})
+	if err != nil {
+		t.Fatalf("trigger release: %v", err)
+	}
+	if release.ArtifactID != artifacts[2].ID || release.ArtifactDigest != "sha256:d3" || release.CommitSHA != "c3" || release.CIRunID != 6032 {
+		t.Fatalf("expected release pinned to artifact, got %+v", release)
+	}
+	var row model.DeploymentRelease
+	db.First(&row, release.ID)
+	if !strings.Contains(row.ManifestSnapshot, "registry.local/shop@sha256:d3") {
+		t.Fatalf("expected manifest rendered with pinned image, got %s", row.ManifestSnapshot)
+	}
+
+	changes, err := logic.ReleaseChanges(ctx, release.ID)
+	if err != nil {
+		t.Fatalf("release changes: %v", err)
+	}
+	if changes.PreviousReleaseID != previous.ID || changes.Range != "c1..c3" ||
+		changes.CompareURL != "https://git.example.com/acme/shop/compare/c1...c3" || len(changes.Artifacts) != 2 || changes.Artifacts[1].CommitSHA != "c2" {
+		t.Fatalf("unexpected changes %+v", changes)
+	}
+
+	// 最新制品与被发布引用的制品不会过期。
+	old := time.Now().Add(-48 * time.Hour)
+	db.Model(&model.CICDArtifact{}).Where("service_id = ?", 603).Update("created_at", old)
+	expired, err := logic.applyArtifactRetention(ctx, 1, 24*time.Hour, time.Now())
+	if err != nil || expired != 1 {
+		t.Fatalf("expected one artifact expired, got %d %v", expired, err)
+	}
+	list, _ := logic.ListArtifacts(ctx, 603, artifactStatusExpired, 0)
+	if len(list) != 1 || list[0].ID != artifacts[1].ID || list[0].ExpiredAt == nil {
+		t.Fatalf("expected only the unreferenced artifact to expire, got %+v", list)
+	}
+	if _, err := logic.TriggerRelease(ctx, 3, TriggerReleaseReq{ServiceID: 603, DeploymentID: 603, Env: "production", ArtifactID: artifacts[1].ID}); !errors.Is(err, ErrArtifactExpired) {
+		t.Fatalf("expected expired artifact to be rejected, got %v", err)
+	}
+}
+
+func TestCompareURL(t *testing.T) {
+	cases := map[string]string{
+		"https://github.com/acme/shop.git":          "https://github.com/acme/shop/compare/a...b",
+		"https://user:pw@gitlab.example.com/g/app/": "https://gitlab.example.com/g/app/-/compare/a...b",
+		"git@github.com:acme/shop.git":              "",
+	}
+	for repo, want := range cases {
+		if got := compareURL(repo, "a", "b"); got != want {
+			t.Fatalf("compare url %s: expected %s, got %s", repo, want, got)
+		}
+	}
+}
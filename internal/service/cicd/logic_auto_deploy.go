@@ -0,0 +1,187 @@
+package cicd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	cicdv1 "github.com/cy77cc/OpsPilot/api/cicd/v1"
+	"github.com/cy77cc/OpsPilot/internal/logger"
+	"github.com/cy77cc/OpsPilot/internal/logstream"
+	"github.com/cy77cc/OpsPilot/internal/model"
+	"github.com/cy77cc/OpsPilot/internal/service/cicd/pipeline"
+	"gorm.io/gorm"
+)
+
+const (
+	autoDeployStatusTriggered = "triggered"
+	autoDeployStatusSkipped   = "skipped"
+	autoDeployStatusFailed    = "failed"
+)
+
+// validateAutoDeploy 校验 CD 配置的自动发布设置。
+func validateAutoDeploy(req UpsertDeploymentCDConfigReq) error {
+	if req.AutoDeploy && req.ServiceID == 0 {
+		return fmt.Errorf("auto_deploy requires service_id")
+	}
+	for _, pattern := range append(append([]string{}, req.AutoDeployBranches...), req.AutoDeployTags...) {
+		if _, err := path.Match(pattern, ""); err != nil || strings.TrimSpace(pattern) == "" {
+			return fmt.Errorf("invalid auto deploy pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+// ciRunVersion 返回 CI 运行发布时使用的版本号 (提交的前 12 位)。
+func ciRunVersion(run *model.CICDServiceCIRun) string {
+	if len(run.CommitSHA) > 12 {
+		return run.CommitSHA[:12]
+	}
+	return run.CommitSHA
+}
+
+// autoDeploy 在 CI 运行成功后按服务开启了自动发布的 CD 配置逐个发布, 返回每个配置的结果。
+// 发布走 TriggerRelease 的正常路径, 审批策略与变更冻结照常生效; 单个配置失败不影响其他配置, 也不改变运行结果。
+// 自动发布只由 CI 运行成功触发, 发布、回滚不会再触发 CI 运行, 另见 autoDeployBlocked 的防重复检查。
+func (l *Logic) autoDeploy(ctx context.Context, run *model.CICDServiceCIRun, logs *logstream.Appender) []cicdv1.CIRunAutoDeployResp {
+	cfgs, err := l.repo.ListAutoDeployCDConfigs(ctx, run.ServiceID)
+	if err != nil {
+		logger.L().Warn("load auto deploy cd configs failed", logger.Error(err))
+		logs.Linef("[opspilot] auto deploy: load cd configs failed: %v", err)
+		return []cicdv1.CIRunAutoDeployResp{{Status: autoDeployStatusFailed, Detail: "load cd configs: " + err.Error()}}
+	}
+	if len(cfgs) == 0 {
+		return nil
+	}
+	defaultBranch := "main"
+	if ciCfg, err := l.repo.GetServiceCIConfig(ctx, run.ServiceID); err == nil {
+		defaultBranch = defaultIfEmpty(ciCfg.Branch, defaultBranch)
+	}
+	ref := pipeline.Ref{Name: run.Branch, Tag: run.RefType == "tag"}
+	version := ciRunVersion(run)
+
+	out := make([]cicdv1.CIRunAutoDeployResp, 0, len(cfgs))
+	for i := range cfgs {
+		cfg := &cfgs[i]
+		item := cicdv1.CIRunAutoDeployResp{CDConfigID: cfg.ID, DeploymentID: cfg.DeploymentID, Env: cfg.Env, RuntimeType: cfg.RuntimeType}
+		if !autoDeployMatches(cfg, ref, defaultBranch) {
+			continue
+		}
+		reason, err := l.autoDeployBlocked(ctx, run, cfg)
+		switch {
+		case err != nil:
+			item.Status, item.Detail = autoDeployStatusFailed, err.Error()
+		case reason != "":
+			item.Status, item.Detail = autoDeployStatusSkipped, reason
+		default:
+			release, rerr := l.triggerRelease(ctx, run.TriggeredBy, TriggerReleaseReq{
+				ServiceID:     run.ServiceID,
+				DeploymentID:  cfg.DeploymentID,
+				Env:           cfg.Env,
+				RuntimeType:   cfg.RuntimeType,
+				Version:       version,
+				CIRunID:       run.ID,
+				TriggerSource: "ci",
+			}, map[string]any{
+				"entry":               "cicd.auto_deploy",
+				"cd_config_id":        cfg.ID,
+				"ref":                 ref.String(),
+				"commit_sha":          run.CommitSHA,
+				"ci_trigger_type":     run.TriggerType,
+				"webhook_delivery_id": run.WebhookDeliveryID,
+			})
+			if rerr != nil {
+				item.Status, item.Detail = autoDeployStatusFailed, rerr.Error()
+			} else {
+				item.Status, item.ReleaseID, item.Release = autoDeployStatusTriggered, release.ID, release.Status
+			}
+		}
+		switch item.Status {
+		case autoDeployStatusTriggered:
+			logs.Linef("[opspilot] auto deploy to deployment %d env %s: release %d %s", cfg.DeploymentID, cfg.Env, item.ReleaseID, item.Release)
+		case autoDeployStatusSkipped:
+			logs.Linef("[opspilot] auto deploy to deployment %d env %s skipped: %s", cfg.DeploymentID, cfg.Env, item.Detail)
+		default:
+			logs.Linef("[opspilot] auto deploy to deployment %d env %s failed: %s", cfg.DeploymentID, cfg.Env, item.Detail)
+			_ = l.writeAudit(ctx, run.ServiceID, cfg.DeploymentID, 0, "ci.run.auto_deploy_failed", run.TriggeredBy, map[string]any{
+				"ci_run_id":    run.ID,
+				"cd_config_id": cfg.ID,
+				"env":          cfg.Env,
+				"error":        item.Detail,
+			})
+		}
+		out = append(out, item)
+	}
+	return out
+}
+
+// autoDeployMatches 判断运行的分支/tag 是否满足 CD 配置的自动发布条件。
+// 未配置任何模式时只有 CI 配置的默认分支满足。
+func autoDeployMatches(cfg *model.CICDDeploymentCDConfig, ref pipeline.Ref, defaultBranch string) bool {
+	cond := &pipeline.Condition{
+		Branches: parseStringSliceJSON(cfg.AutoDeployBranchesJSON),
+		Tags:     parseStringSliceJSON(cfg.AutoDeployTagsJSON),
+	}
+	if len(cond.Branches) == 0 && len(cond.Tags) == 0 {
+		return !ref.Tag && ref.Name == defaultBranch
+	}
+	return cond.Match(ref)
+}
+
+// autoDeployBlocked 返回不应自动发布的原因, 为空表示可以发布:
+//   - 本次运行已经发布到该目标和环境 (流水线的部署阶段、运行重新执行或回滚记录沿用了运行 ID);
+//   - 目标最近一次发布是从同一提交回滚, 重新运行该提交不会把回滚撤销。
+func (l *Logic) autoDeployBlocked(ctx context.Context, run *model.CICDServiceCIRun, cfg *model.CICDDeploymentCDConfig) (string, error) {
+	db := l.svcCtx.DB.WithContext(ctx)
+	released := make([]model.DeploymentRelease, 0)
+	if err := db.Select("id", "trigger_context_json").
+		Where("service_id = ? AND target_id = ? AND ci_run_id = ?", run.ServiceID, cfg.DeploymentID, run.ID).
+		Find(&released).Error; err != nil {
+		return "", err
+	}
+	for _, row := range released {
+		// 没有记录环境的发布 (如回滚) 视为覆盖所有环境。
+		if env, _ := parseMapJSON(row.TriggerContextJSON)["env"].(string); env == "" || env == cfg.Env {
+			return fmt.Sprintf("ci run %d already released to deployment %d by release %d", run.ID, cfg.DeploymentID, row.ID), nil
+		}
+	}
+	var latest model.DeploymentRelease
+	err := db.Where("service_id = ? AND target_id = ?", run.ServiceID, cfg.DeploymentID).Order("id DESC").First(&latest).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	fromID, _ := parseMapJSON(latest.TriggerContextJSON)["rollback_from_release_id"].(float64)
+	if fromID == 0 || run.CommitSHA == "" {
+		return "", nil
+	}
+	var from model.DeploymentRelease
+	if err := db.Select("id", "commit_sha", "trigger_context_json").First(&from, uint(fromID)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", nil
+		}
+		return "", err
+	}
+	commit := from.CommitSHA
+	if commit == "" {
+		commit, _ = parseMapJSON(from.TriggerContextJSON)["commit_sha"].(string)
+	}
+	if commit == run.CommitSHA {
+		return fmt.Sprintf("commit %s was rolled back on deployment %d by release %d", ciRunVersion(run), cfg.DeploymentID, latest.ID), nil
+	}
+	return "", nil
+}
+
+func parseAutoDeployJSON(raw string) []cicdv1.CIRunAutoDeployResp {
+	if strings.TrimSpace(raw) == "" {
+		return nil
+	}
+	out := make([]cicdv1.CIRunAutoDeployResp, 0)
+	_ = json.Unmarshal([]byte(raw), &out)
+	return out
+}
@@ -0,0 +1,87 @@
+package cicd
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cy77cc/OpsPilot/internal/model"
+)
+
+func TestCIRunAutoDeploysThroughCDConfig(t *testing.T) {
+	logic := newTestLogic(t)
+	ctx := context.Background()
+	db := logic.svcCtx.DB
+	db.Create(&model.Service{ID: 801, Name: "svc-auto", Env: "staging",
+		YamlContent: "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: svc-auto\ndata:\n  image: \"{{image}}\"\n"})
+	db.Create(&model.Cluster{ID: 8, Name: "cluster-8", KubeConfig: "invalid-kubeconfig", Status: "active"})
+	db.Create(&model.DeploymentTarget{ID: 801, Name: "target-auto", TargetType: "k8s", RuntimeType: "k8s", ClusterID: 8,
+		Env: "staging", Status: "active", ReadinessStatus: "ready"})
+	for _, req := range []UpsertDeploymentCDConfigReq{
+		{Env: "staging", Strategy: "rolling", ApprovalRequired: true, ServiceID: 801, AutoDeploy: true},
+		{Env: "production", Strategy: "rolling", ApprovalRequired: true, ServiceID: 801, AutoDeploy: true, AutoDeployTags: []string{"v*"}},
+	} {
+		if _, err := logic.UpsertDeploymentCDConfig(ctx, 2, 801, req); err != nil {
+			t.Fatalf("upsert cd config: %v", err)
+		}
+	}
+	// 目标不存在的配置发布失败, 结果记录到运行上。
+	if _, err := logic.UpsertDeploymentCDConfig(ctx, 2, 899, UpsertDeploymentCDConfigReq{Env: "staging", Strategy: "rolling", ServiceID: 801, AutoDeploy: true}); err != nil {
+		t.Fatalf("upsert cd config: %v", err)
+	}
+	if _, err := logic.UpsertDeploymentCDConfig(ctx, 2, 801, UpsertDeploymentCDConfigReq{Env: "qa", Strategy: "rolling", AutoDeploy: true}); err == nil {
+		t.Fatal("expected auto deploy without service to be rejected")
+	}
+
+	origin, commit := newTestBareRepo(t)
+	e := newTestCIExecutor(logic, t.TempDir())
+	run := runQueuedCI(t, logic, e, 801, UpsertServiceCIConfigReq{RepoURL: origin, BuildSteps: []string{"echo ok"}, ArtifactTarget: "file://" + t.TempDir()})
+	if run.Status != ciRunStatusSucceeded {
+		t.Fatalf("expected succeeded run, got %+v", run)
+	}
+	deploys := toCIRunResp(run).AutoDeploys
+	if len(deploys) != 2 || deploys[0].Status != autoDeployStatusTriggered || deploys[0].Release != "pending_approval" ||
+		deploys[1].DeploymentID != 899 || deploys[1].Status != autoDeployStatusFailed {
+		t.Fatalf("expected staging release pending approval and a failed target, got %+v", deploys)
+	}
+	var release model.DeploymentRelease
+	db.First(&release, deploys[0].ReleaseID)
+	trigger := parseMapJSON(release.TriggerContextJSON)
+	if release.CIRunID != run.ID || trigger["entry"] != "cicd.auto_deploy" || trigger["commit_sha"] != commit || trigger["ref"] != "branch main" {
+		t.Fatalf("expected release to carry ci run and trigger context, got %+v %v", release, trigger)
+	}
+	var audits int64
+	db.Model(&model.CICDAuditEvent{}).Where("event_type = ? AND deployment_id = ?", "ci.run.auto_deploy_failed", 899).Count(&audits)
+	if audits != 1 {
+		t.Fatalf("expected auto deploy failure audited, got %d", audits)
+	}
+	if text, _ := logic.logs.Text(ctx, ciRunStream(run.ID)); !strings.Contains(text, "auto deploy to deployment 801 env staging: release") {
+		t.Fatalf("expected auto deploy in run log, got %q", text)
+	}
+
+	// 同一运行不会重复发布; 目标从该提交回滚后, 重新运行同一提交也不会再次发布。
+	if again := logic.autoDeploy(ctx, run, nil); again[0].Status != autoDeployStatusSkipped || !strings.Contains(again[0].Detail, "already released") {
+		t.Fatalf("expected duplicate release skipped, got %+v", again)
+	}
+	db.Create(&model.DeploymentRelease{ServiceID: 801, TargetID: 801, RuntimeType: "k8s", Status: "rollback", TriggerSource: "ci",
+		CIRunID: run.ID, TriggerContextJSON: mustJSON(map[string]any{"rollback_from_release_id": release.ID})})
+	rerun := *run
+	rerun.ID = run.ID + 1000
+	if again := logic.autoDeploy(ctx, &rerun, nil); again[0].Status != autoDeployStatusSkipped || !strings.Contains(again[0].Detail, "rolled back") {
+		t.Fatalf("expected rolled back commit skipped, got %+v", again)
+	}
+
+	// 非默认分支不满足条件; tag 运行只发布到配置了 tag 模式的环境。
+	rerun.Branch = "feature/x"
+	if again := logic.autoDeploy(ctx, &rerun, nil); len(again) != 0 {
+		t.Fatalf("expected feature branch not to deploy, got %+v", again)
+	}
+	rerun.Branch, rerun.RefType, rerun.CommitSHA = "v1.2.0", "tag", "feedface"
+	if err := logic.repo.CreateArtifact(ctx, &model.CICDArtifact{ServiceID: 801, CIRunID: rerun.ID, Kind: artifactKindImage,
+		Reference: "registry.local/auto:v1.2.0", Digest: "sha256:feed", CommitSHA: "feedface", Status: artifactStatusActive}); err != nil {
+		t.Fatalf("seed artifact: %v", err)
+	}
+	if again := logic.autoDeploy(ctx, &rerun, nil); len(again) != 1 || again[0].Env != "production" || again[0].Status != autoDeployStatusTriggered {
+		t.Fatalf("expected tag run to deploy to production only, got %+v", again)
+	}
+}
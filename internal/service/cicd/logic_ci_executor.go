@@ -0,0 +1,582 @@
+package cicd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	sshclient "github.com/cy77cc/OpsPilot/internal/client/ssh"
+	"github.com/cy77cc/OpsPilot/internal/config"
+	"github.com/cy77cc/OpsPilot/internal/logger"
+	"github.com/cy77cc/OpsPilot/internal/logstream"
+	"github.com/cy77cc/OpsPilot/internal/model"
+	"github.com/cy77cc/OpsPilot/internal/service/cicd/executor"
+	"github.com/cy77cc/OpsPilot/internal/service/cicd/pipeline"
+	hostlogic "github.com/cy77cc/OpsPilot/internal/service/host/logic"
+)
+
+const (
+	ciRunStatusQueued    = "queued"
+	ciRunStatusRunning   = "running"
+	ciRunStatusWaiting   = "waiting"
+	ciRunStatusSucceeded = "succeeded"
+	ciRunStatusFailed    = "failed"
+
+	ciStepStatusPending   = "pending"
+	ciStepStatusRunning   = "running"
+	ciStepStatusSucceeded = "succeeded"
+	ciStepStatusFailed    = "failed"
+	ciStepStatusSkipped   = "skipped"
+	ciStepStatusWaiting   = "waiting"
+
+	ciStepKindClone   = "clone"
+	ciStepKindCommand = "command"
+	ciStepKindManual  = "manual"
+	ciStepKindPublish = "publish"
+	ciStepKindDeploy  = "deploy"
+
+	defaultCIWorkers     = 2
+	defaultCIStepTimeout = 20 * time.Minute
+	defaultCIRunTimeout  = time.Hour
+	ciPollInterval       = 5 * time.Second
+	ciHeartbeatInterval  = 30 * time.Second
+	// ciHeartbeatStale 之内没有心跳的 running 运行视为执行器已退出。
+	ciHeartbeatStale = 3 * ciHeartbeatInterval
+	ciStepLogLimit   = 256 << 10
+
+	// 工作目录下的源码与制品子目录。
+	ciSourceDir   = "src"
+	ciArtifactDir = "artifacts"
+)
+
+var ciExecutorOnce sync.Once
+
+// errCIRunParked 表示运行已挂起在人工卡点, worker 应释放运行而不结束它。
+var errCIRunParked = errors.New("ci run parked at a manual gate")
+
+// ciRunner 打开一次运行使用的执行环境, 返回的 close 在运行结束后调用。
+type ciRunner func(ctx context.Context) (executor.Runner, func(), error)
+
+// ciExecutor 领取排队的 CI 运行, 在执行环境中拉取代码、执行构建步骤并推送制品。
+type ciExecutor struct {
+	logic       *Logic
+	open        ciRunner
+	stepTimeout time.Duration
+	runTimeout  time.Duration
+	heartbeat   time.Duration
+}
+
+func (l *Logic) newCIExecutor() *ciExecutor {
+	cfg := config.CFG.CICD
+	e := &ciExecutor{logic: l, open: l.openCIRunner, stepTimeout: cfg.StepTimeout, runTimeout: cfg.RunTimeout, heartbeat: ciHeartbeatInterval}
+	if e.stepTimeout <= 0 {
+		e.stepTimeout = defaultCIStepTimeout
+	}
+	if e.runTimeout <= 0 {
+		e.runTimeout = defaultCIRunTimeout
+	}
+	return e
+}
+
+// StartCIExecutor 启动 cicd.workers 个 worker 轮询执行排队的 CI 运行, 回收心跳超时的运行与
+// 超过运行超时仍未处理的人工卡点, 并按保留规则过期制品。
+// 未开启 cicd.enable 时不启动, 运行保持 queued。
+func (l *Logic) StartCIExecutor(ctx context.Context) {
+	cfg := config.CFG.CICD
+	if !cfg.Enable {
+		return
+	}
+	ciExecutorOnce.Do(func() {
+		e := l.newCIExecutor()
+		workers := cfg.Workers
+		if workers <= 0 {
+			workers = defaultCIWorkers
+		}
+		go func() {
+			ticker := time.NewTicker(ciHeartbeatInterval)
+			defer ticker.Stop()
+			for {
+				e.recoverStaleRuns(ctx)
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}()
+		for i := 0; i < workers; i++ {
+			go e.work(ctx)
+		}
+		go l.runArtifactRetention(ctx)
+	})
+}
+
+func (e *ciExecutor) work(ctx context.Context) {
+	for {
+		run, err := e.logic.repo.ClaimQueuedCIRun(ctx, time.Now())
+		if err != nil {
+			logger.L().Warn("claim ci run failed", logger.Error(err))
+		}
+		if run != nil {
+			e.Execute(ctx, run)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(ciPollInterval):
+		}
+	}
+}
+
+// recoverStaleRuns 把心跳超时的 running 运行标记为失败, 避免其永远停留在 running;
+// 挂起超过运行超时的人工卡点记为失败并重新排队, 由 worker 结束运行并清理工作目录。
+func (e *ciExecutor) recoverStaleRuns(ctx context.Context) {
+	repo := e.logic.repo
+	rows, err := repo.ListStaleCIRuns(ctx, time.Now().Add(-ciHeartbeatStale))
+	if err != nil {
+		logger.L().Warn("load stale ci runs failed", logger.Error(err))
+		return
+	}
+	for i := range rows {
+		e.finish(ctx, &rows[i], fmt.Errorf("executor heartbeat lost"))
+	}
+	waiting, err := repo.ListExpiredWaitingCIRuns(ctx, time.Now().Add(-e.runTimeout))
+	if err != nil {
+		logger.L().Warn("load waiting ci runs failed", logger.Error(err))
+		return
+	}
+	for i := range waiting {
+		if err := e.expireGates(ctx, &waiting[i]); err != nil {
+			logger.L().Warn("expire ci gate failed", logger.Int("run_id", int(waiting[i].ID)), logger.Error(err))
+		}
+	}
+}
+
+// expireGates 把运行中仍在等待的人工卡点记为失败并重新排队运行。
+func (e *ciExecutor) expireGates(ctx context.Context, run *model.CICDServiceCIRun) error {
+	repo := e.logic.repo
+	steps, err := repo.ListCIRunSteps(ctx, run.ID)
+	if err != nil {
+		return err
+	}
+	for _, step := range steps {
+		if step.Kind != ciStepKindManual || step.Status != ciStepStatusWaiting {
+			continue
+		}
+		log := step.Log + fmt.Sprintf("[opspilot] not approved within %s\n", e.runTimeout)
+		if _, err := repo.DecideCIRunStep(ctx, run.ID, step.ID, ciStepStatusFailed, 0, log, time.Now()); err != nil {
+			return err
+		}
+	}
+	_, err = repo.RequeueCIRun(ctx, run.ID)
+	return err
+}
+
+// ciStepPlan 是一个待执行步骤及其工作子目录, env 与 timeout 来自流水线中的步骤定义。
+// 步骤输出同时写入运行的实时日志流 logs, 并行步骤的每行带有 prefix。
+type ciStepPlan struct {
+	step    *model.CICDServiceCIRunStep
+	dir     string
+	env     map[string]string
+	timeout time.Duration
+	logs    *logstream.Appender
+	prefix  string
+}
+
+// Execute 执行一次已领取 (running) 的运行, 结束时写入 succeeded 或 failed。
+// 运行到达人工卡点时挂起为 waiting 并返回, 卡点处理后重新排队, 再次领取时从卡点继续。
+func (e *ciExecutor) Execute(ctx context.Context, run *model.CICDServiceCIRun) {
+	l := e.logic
+	eventType := "ci.run.started"
+	if run.Workspace != "" {
+		eventType = "ci.run.resumed"
+	}
+	_ = l.writeAudit(ctx, run.ServiceID, 0, 0, eventType, run.TriggeredBy, map[string]any{"ci_run_id": run.ID})
+	l.invalidateTimelineCache(ctx, run.ServiceID)
+
+	logs, err := l.logs.Open(ctx, ciRunStream(run.ID))
+	if err != nil {
+		logger.L().Warn("open ci run log stream failed", logger.Error(err))
+	}
+	runCtx, cancel := context.WithTimeout(ctx, e.runTimeout)
+	defer cancel()
+	stop := e.keepAlive(ctx, run.ID)
+	err = e.execute(runCtx, run, logs)
+	stop()
+	if errors.Is(err, errCIRunParked) {
+		if err := logs.Close(); err != nil {
+			logger.L().Warn("flush ci run log stream failed", logger.Error(err))
+		}
+		_ = l.writeAudit(ctx, run.ServiceID, 0, 0, "ci.run.waiting", run.TriggeredBy, map[string]any{"ci_run_id": run.ID})
+		l.invalidateTimelineCache(ctx, run.ServiceID)
+		return
+	}
+	if err != nil && runCtx.Err() != nil && ctx.Err() == nil {
+		err = fmt.Errorf("run timed out after %s: %w", e.runTimeout, err)
+	}
+	if err != nil {
+		logs.Linef("[opspilot] run failed: %v", err)
+	} else {
+		logs.Line("[opspilot] run succeeded")
+		if deploys := l.autoDeploy(ctx, run, logs); len(deploys) > 0 {
+			run.AutoDeployJSON = mustJSON(deploys)
+		}
+	}
+	if err := logs.Close(); err != nil {
+		logger.L().Warn("flush ci run log stream failed", logger.Error(err))
+	}
+	e.finish(ctx, run, err)
+}
+
+func (e *ciExecutor) execute(ctx context.Context, run *model.CICDServiceCIRun, logs *logstream.Appender) (err error) {
+	l := e.logic
+	var cfg model.CICDServiceCIConfig
+	if err := l.svcCtx.DB.WithContext(ctx).First(&cfg, run.CIConfigID).Error; err != nil {
+		return fmt.Errorf("load ci config: %w", err)
+	}
+	if strings.TrimSpace(run.Branch) == "" {
+		run.Branch = defaultIfEmpty(cfg.Branch, "main")
+	}
+	runner, closeRunner, err := e.open(ctx)
+	if err != nil {
+		return fmt.Errorf("open runner: %w", err)
+	}
+	defer closeRunner()
+	run.Runner = runner.Name()
+	// 从人工卡点恢复的运行沿用挂起时保留的工作目录, 不再重新拉取代码。
+	resumed := run.Workspace != ""
+	if !resumed {
+		if run.Workspace, err = runner.Prepare(ctx, run.ID); err != nil {
+			return fmt.Errorf("prepare workspace: %w", err)
+		}
+	}
+	workspace := run.Workspace
+	defer func() {
+		if errors.Is(err, errCIRunParked) {
+			return
+		}
+		cleanupCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if err := runner.Cleanup(cleanupCtx, workspace); err != nil {
+			logger.L().Warn("cleanup ci workspace failed", logger.Error(err))
+		}
+		run.Workspace = ""
+	}()
+	if err := l.repo.SaveCIRun(ctx, run); err != nil {
+		return err
+	}
+
+	env := map[string]string{
+		"OPSPILOT_RUN_ID":       fmt.Sprintf("%d", run.ID),
+		"OPSPILOT_SERVICE_ID":   fmt.Sprintf("%d", run.ServiceID),
+		"OPSPILOT_BRANCH":       run.Branch,
+		"OPSPILOT_WORKSPACE":    workspace,
+		"OPSPILOT_ARTIFACT_DIR": path.Join(workspace, ciArtifactDir),
+		// 构建步骤可写入 SBOM 等 JSON 元数据, 随制品记录保存。
+		"OPSPILOT_METADATA_FILE": path.Join(workspace, ciMetadataFile),
+	}
+	if !resumed {
+		clone, err := l.repo.CreateCIRunSteps(ctx, []model.CICDServiceCIRunStep{{
+			RunID: run.ID, Seq: 1, Stage: ciStepKindClone, Kind: ciStepKindClone, Name: "clone",
+			Command: ciCloneCommand(cfg.RepoURL, run.Branch, run.CommitSHA), Status: ciStepStatusPending,
+		}})
+		if err != nil {
+			return err
+		}
+		if err := e.runStep(ctx, runner, ciStepPlan{step: &clone[0], dir: workspace, logs: logs}, env); err != nil {
+			return err
+		}
+		// 拉取代码后确定提交与制品地址, 供后续步骤通过环境变量使用。
+		var out strings.Builder
+		if _, err := runner.Exec(ctx, workspace, "git -C "+ciSourceDir+" rev-parse HEAD", nil, &out); err != nil {
+			return fmt.Errorf("resolve commit: %w", err)
+		}
+		run.CommitSHA = strings.TrimSpace(out.String())
+	}
+	ref, artifactPath := resolveCIArtifact(cfg.ArtifactTarget, run.CommitSHA)
+	run.ArtifactRef = ref
+	env["OPSPILOT_COMMIT_SHA"] = run.CommitSHA
+	env["OPSPILOT_ARTIFACT_REF"] = ref
+	env["OPSPILOT_ARTIFACT_PATH"] = artifactPath
+	if err := l.repo.SaveCIRun(ctx, run); err != nil {
+		return err
+	}
+
+	var (
+		p        *pipeline.Pipeline
+		existing []model.CICDServiceCIRunStep
+	)
+	if resumed {
+		if p, existing, err = e.resumePipeline(ctx, run); err != nil {
+			return err
+		}
+	} else if p, err = e.loadPipeline(ctx, runner, run, &cfg, workspace); err != nil {
+		return err
+	}
+	// 流水线变量不能使用 OPSPILOT_ 前缀, 不会覆盖内置变量。
+	maps.Copy(env, p.Env)
+	stages, err := e.planStages(ctx, run, &cfg, p, workspace, logs, existing)
+	if err != nil {
+		return err
+	}
+	for i, stage := range stages {
+		if err := e.runStage(ctx, runner, run, stage, workspace, env); err != nil {
+			if errors.Is(err, errCIRunParked) {
+				return err
+			}
+			for _, rest := range stages[i+1:] {
+				e.skipSteps(ctx, rest.steps)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *ciExecutor) runStep(ctx context.Context, runner executor.Runner, plan ciStepPlan, env map[string]string) error {
+	step := plan.step
+	if err := e.startStep(ctx, step, ciStepStatusRunning); err != nil {
+		return err
+	}
+	if len(plan.env) > 0 {
+		env = maps.Clone(env)
+		maps.Copy(env, plan.env)
+	}
+	timeout := e.stepTimeout
+	if plan.timeout > 0 {
+		timeout = plan.timeout
+	}
+	cmd := step.Command
+	if step.Image != "" {
+		cmd = ciContainerCommand(ciContainerName(step), step.Image, plan.dir, env, step.Command)
+	}
+
+	stepCtx, cancel := context.WithTimeout(ctx, timeout)
+	out := &ciStepLog{limit: ciStepLogLimit}
+	live := plan.logs.Writer(plan.prefix)
+	w := io.MultiWriter(out, live)
+	plan.logs.Linef("%s==> step %s", plan.prefix, step.Name)
+	code, err := runner.Exec(stepCtx, plan.dir, cmd, env, w)
+	cancel()
+	_ = live.Close()
+	if errors.Is(err, executor.ErrTimeout) && step.Image != "" {
+		// 终止 docker 客户端不会停止容器, 超时后显式删除。
+		_, _ = runner.Exec(context.WithoutCancel(ctx), plan.dir, "docker rm -f "+ciContainerName(step), nil, io.Discard)
+	}
+	if errors.Is(err, executor.ErrTimeout) && ctx.Err() == nil {
+		err = fmt.Errorf("timed out after %s", timeout)
+	}
+	if err != nil {
+		fmt.Fprintf(w, "\n[opspilot] step %s failed: %v\n", step.Name, err)
+	}
+	return e.finishStep(ctx, step, code, out.String(), err)
+}
+
+func (e *ciExecutor) startStep(ctx context.Context, step *model.CICDServiceCIRunStep, status string) error {
+	started := time.Now()
+	step.Status = status
+	step.StartedAt = &started
+	return e.logic.repo.SaveCIRunStep(ctx, step)
+}
+
+// finishStep 写入步骤结果, err 非空时步骤失败并返回带步骤名的错误。
+func (e *ciExecutor) finishStep(ctx context.Context, step *model.CICDServiceCIRunStep, code int, log string, err error) error {
+	finished := time.Now()
+	step.ExitCode = code
+	step.Log = log
+	step.FinishedAt = &finished
+	step.Status = ciStepStatusSucceeded
+	if err != nil {
+		step.Status = ciStepStatusFailed
+	}
+	// 运行可能已超时, 用独立的 context 保存步骤结果。
+	if serr := e.logic.repo.SaveCIRunStep(context.WithoutCancel(ctx), step); serr != nil {
+		return serr
+	}
+	if err != nil {
+		return fmt.Errorf("step %s: %w", step.Name, err)
+	}
+	return nil
+}
+
+// skipSteps 把尚未执行的步骤标记为跳过。
+func (e *ciExecutor) skipSteps(ctx context.Context, plans []ciStepPlan) {
+	for _, plan := range plans {
+		if plan.step.Status != ciStepStatusPending {
+			continue
+		}
+		plan.step.Status = ciStepStatusSkipped
+		_ = e.logic.repo.SaveCIRunStep(context.WithoutCancel(ctx), plan.step)
+	}
+}
+
+// keepAlive 在运行期间定期刷新心跳, 返回的函数停止刷新。
+func (e *ciExecutor) keepAlive(ctx context.Context, runID uint) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(e.heartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				_ = e.logic.repo.TouchCIRunHeartbeat(ctx, runID, time.Now())
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+func (e *ciExecutor) finish(ctx context.Context, run *model.CICDServiceCIRun, err error) {
+	l := e.logic
+	now := time.Now()
+	run.FinishedAt = &now
+	run.Status = ciRunStatusSucceeded
+	eventType := "ci.run.succeeded"
+	payload := map[string]any{"ci_run_id": run.ID, "commit_sha": run.CommitSHA, "artifact_ref": run.ArtifactRef}
+	if err != nil {
+		run.Status = ciRunStatusFailed
+		run.ErrorMessage = err.Error()
+		eventType = "ci.run.failed"
+		payload["error"] = err.Error()
+	}
+	ctx = context.WithoutCancel(ctx)
+	if serr := l.repo.SaveCIRun(ctx, run); serr != nil {
+		logger.L().Warn("save ci run failed", logger.Error(serr))
+	}
+	if cerr := l.logs.Complete(ctx, ciRunStream(run.ID)); cerr != nil {
+		logger.L().Warn("compact ci run logs failed", logger.Error(cerr))
+	}
+	_ = l.writeAudit(ctx, run.ServiceID, 0, 0, eventType, run.TriggeredBy, payload)
+	l.invalidateTimelineCache(ctx, run.ServiceID)
+}
+
+// ciRunStream 返回 CI 运行的实时日志流名称。
+func ciRunStream(runID uint) string {
+	return fmt.Sprintf("cicd:run:%d", runID)
+}
+
+// CIRunLogStream 返回 CI 运行的实时日志流名称, 运行不存在时返回 gorm.ErrRecordNotFound。
+func (l *Logic) CIRunLogStream(ctx context.Context, runID uint) (string, error) {
+	if _, err := l.repo.GetCIRun(ctx, runID); err != nil {
+		return "", err
+	}
+	return ciRunStream(runID), nil
+}
+
+// ciRunFinished 报告运行是否已经结束 (succeeded 或 failed)。
+func (l *Logic) ciRunFinished(ctx context.Context, runID uint) (bool, error) {
+	run, err := l.repo.GetCIRun(ctx, runID)
+	if err != nil {
+		return false, err
+	}
+	return run.Status == ciRunStatusSucceeded || run.Status == ciRunStatusFailed, nil
+}
+
+// ciCloneCommand 返回拉取代码的命令。指定 commit 时 (webhook 触发) 检出该提交,
+// 分支此后可能已前进, 因此不做浅克隆。
+func ciCloneCommand(repoURL, ref, commit string) string {
+	if commit == "" {
+		return fmt.Sprintf("mkdir -p %s && git clone --depth 1 --branch %s -- %s %s",
+			ciArtifactDir, executor.ShellQuote(ref), executor.ShellQuote(repoURL), ciSourceDir)
+	}
+	return fmt.Sprintf("mkdir -p %s && git clone --single-branch --branch %s -- %s %s && git -C %s checkout --detach %s",
+		ciArtifactDir, executor.ShellQuote(ref), executor.ShellQuote(repoURL), ciSourceDir, ciSourceDir, executor.ShellQuote(commit))
+}
+
+// resolveCIArtifact 根据制品目标和提交计算制品地址。
+//
+//   - file:///path: 制品目录复制到 /path/<commit>, 地址为 file:///path/<commit>
+//   - 镜像仓库: 未指定 tag 或 digest 时以提交前 12 位作为 tag
+//
+// 第二个返回值为 file 目标的目录, 镜像目标为空。
+func resolveCIArtifact(target, commit string) (string, string) {
+	target = strings.TrimSpace(target)
+	if dir, ok := strings.CutPrefix(target, "file://"); ok {
+		artifactPath := path.Join(dir, commit)
+		return "file://" + artifactPath, artifactPath
+	}
+	name := target[strings.LastIndex(target, "/")+1:]
+	if strings.ContainsAny(name, ":@") {
+		return target, ""
+	}
+	tag := commit
+	if len(tag) > 12 {
+		tag = tag[:12]
+	}
+	return target + ":" + tag, ""
+}
+
+// ciPublishCommand 返回推送制品的命令, 镜像需由构建步骤以 $OPSPILOT_ARTIFACT_REF 为 tag 构建。
+func ciPublishCommand(target string) string {
+	if strings.HasPrefix(strings.TrimSpace(target), "file://") {
+		return `mkdir -p "$OPSPILOT_ARTIFACT_PATH" && cp -R "$OPSPILOT_ARTIFACT_DIR"/. "$OPSPILOT_ARTIFACT_PATH"/`
+	}
+	return `docker push "$OPSPILOT_ARTIFACT_REF"`
+}
+
+// ciStepLog 收集步骤输出, 超过 limit 时只保留末尾部分。
+type ciStepLog struct {
+	mu        sync.Mutex
+	buf       []byte
+	limit     int
+	truncated bool
+}
+
+func (w *ciStepLog) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf, p...)
+	if len(w.buf) > w.limit {
+		w.buf = append(w.buf[:0], w.buf[len(w.buf)-w.limit:]...)
+		w.truncated = true
+	}
+	return len(p), nil
+}
+
+func (w *ciStepLog) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.truncated {
+		return "[opspilot] log truncated\n" + string(w.buf)
+	}
+	return string(w.buf)
+}
+
+// openCIRunner 按 cicd.runner_node_id 打开本机或构建主机上的执行环境。
+func (l *Logic) openCIRunner(ctx context.Context) (executor.Runner, func(), error) {
+	cfg := config.CFG.CICD
+	if cfg.RunnerNodeID == 0 {
+		return &executor.LocalRunner{Root: cfg.WorkspaceDir}, func() {}, nil
+	}
+	var node model.Node
+	if err := l.svcCtx.DB.WithContext(ctx).First(&node, cfg.RunnerNodeID).Error; err != nil {
+		return nil, nil, fmt.Errorf("load build host %d: %w", cfg.RunnerNodeID, err)
+	}
+	if ok, reason := hostlogic.EvaluateOperationalEligibility(&node); !ok {
+		return nil, nil, fmt.Errorf("build host %s unavailable: %s", node.Name, reason)
+	}
+	privateKey, passphrase, err := hostlogic.LoadNodePrivateKey(ctx, l.svcCtx.DB, &node)
+	if err != nil {
+		return nil, nil, err
+	}
+	password := strings.TrimSpace(node.SSHPassword)
+	if strings.TrimSpace(privateKey) != "" {
+		password = ""
+	}
+	cli, err := sshclient.NewSSHClient(node.SSHUser, password, node.IP, node.Port, privateKey, passphrase)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &executor.SSHRunner{Client: cli, Host: node.Name, Root: cfg.WorkspaceDir}, func() { _ = cli.Close() }, nil
+}
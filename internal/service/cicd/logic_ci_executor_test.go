@@ -0,0 +1,218 @@
+package cicd
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cy77cc/OpsPilot/internal/model"
+	"github.com/cy77cc/OpsPilot/internal/service/cicd/executor"
+)
+
+// newTestBareRepo 创建一个含单个提交的本地裸仓库, 返回仓库路径和提交。
+func newTestBareRepo(t *testing.T) (string, string) {
+	t.Helper()
+	return newTestBareRepoWith(t, map[string]string{"app.txt": "hello"})
+}
+
+// newTestBareRepoWith 与 newTestBareRepo 相同, 提交中包含 files 指定的文件。
+func newTestBareRepoWith(t *testing.T, files map[string]string) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	origin := filepath.Join(dir, "origin.git")
+	work := filepath.Join(dir, "work")
+	git := func(dir string, args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=ci", "-c", "user.email=ci@example.com"}, args...)...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	git(dir, "init", "--bare", origin)
+	git(dir, "init", "-b", "main", work)
+	for name, content := range files {
+		file := filepath.Join(work, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatalf("create source dir: %v", err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatalf("write source: %v", err)
+		}
+	}
+	git(work, "add", ".")
+	git(work, "commit", "-m", "init")
+	git(work, "push", origin, "main")
+	return origin, git(work, "rev-parse", "HEAD")
+}
+
+func newTestCIExecutor(l *Logic, root string) *ciExecutor {
+	return &ciExecutor{
+		logic: l,
+		open: func(context.Context) (executor.Runner, func(), error) {
+			return &executor.LocalRunner{Root: root}, func() {}, nil
+		},
+		stepTimeout: 5 * time.Second,
+		runTimeout:  30 * time.Second,
+		heartbeat:   time.Minute,
+	}
+}
+
+// runQueuedCI 为服务配置 CI 并触发一次运行, 领取后同步执行。
+func runQueuedCI(t *testing.T, l *Logic, e *ciExecutor, serviceID uint, req UpsertServiceCIConfigReq) *model.CICDServiceCIRun {
+	t.Helper()
+	ctx := context.Background()
+	req.TriggerMode = "manual"
+	if _, err := l.UpsertServiceCIConfig(ctx, 1, serviceID, req); err != nil {
+		t.Fatalf("upsert ci config: %v", err)
+	}
+	queued, err := l.TriggerCIRun(ctx, 1, serviceID, TriggerCIRunReq{TriggerType: "manual"})
+	if err != nil {
+		t.Fatalf("trigger ci run: %v", err)
+	}
+	run, err := l.repo.ClaimQueuedCIRun(ctx, time.Now())
+	if err != nil || run == nil || run.ID != queued.ID || run.Status != ciRunStatusRunning {
+		t.Fatalf("expected to claim run %d, got %+v %v", queued.ID, run, err)
+	}
+	if again, _ := l.repo.ClaimQueuedCIRun(ctx, time.Now()); again != nil {
+		t.Fatalf("expected a claimed run not to be claimed twice, got %+v", again)
+	}
+	e.Execute(ctx, run)
+	if run, err = l.repo.GetCIRun(ctx, queued.ID); err != nil {
+		t.Fatalf("reload run: %v", err)
+	}
+	return run
+}
+
+// resumeQueuedCI 领取重新排队的运行并同步执行。
+func resumeQueuedCI(t *testing.T, l *Logic, e *ciExecutor, runID uint) *model.CICDServiceCIRun {
+	t.Helper()
+	ctx := context.Background()
+	run, err := l.repo.ClaimQueuedCIRun(ctx, time.Now())
+	if err != nil || run == nil || run.ID != runID {
+		t.Fatalf("expected to claim run %d again, got %+v %v", runID, run, err)
+	}
+	e.Execute(ctx, run)
+	if run, err = l.repo.GetCIRun(ctx, runID); err != nil {
+		t.Fatalf("reload run: %v", err)
+	}
+	return run
+}
+
+func TestCIExecutorBuildsAndPublishesFileArtifact(t *testing.T) {
+	logic := newTestLogic(t)
+	origin, commit := newTestBareRepo(t)
+	workspaces := t.TempDir()
+	artifacts := t.TempDir()
+
+	run := runQueuedCI(t, logic, newTestCIExecutor(logic, workspaces), 401, UpsertServiceCIConfigReq{
+		RepoURL:        origin,
+		Branch:         "main",
+		BuildSteps:     []string{`test "$OPSPILOT_COMMIT_SHA" = "$(git rev-parse HEAD)"`, `cp app.txt "$OPSPILOT_ARTIFACT_DIR"/`},
+		ArtifactTarget: "file://" + artifacts,
+	})
+	if run.Status != ciRunStatusSucceeded || run.CommitSHA != commit || run.Runner != "local" || run.FinishedAt == nil {
+		t.Fatalf("expected succeeded run at %s, got %+v", commit, run)
+	}
+	if want := "file://" + filepath.Join(artifacts, commit); run.ArtifactRef != want {
+		t.Fatalf("expected artifact %s, got %s", want, run.ArtifactRef)
+	}
+	if raw, err := os.ReadFile(filepath.Join(artifacts, commit, "app.txt")); err != nil || string(raw) != "hello" {
+		t.Fatalf("expected published artifact, got %q %v", raw, err)
+	}
+	steps, err := logic.ListCIRunSteps(context.Background(), run.ID)
+	if err != nil || len(steps) != 4 {
+		t.Fatalf("expected clone, two build steps and publish, got %+v %v", steps, err)
+	}
+	for _, step := range steps {
+		if step.Status != ciStepStatusSucceeded {
+			t.Fatalf("expected step %s to succeed, got %+v", step.Name, step)
+		}
+	}
+	if !strings.Contains(steps[0].Log, "Cloning") {
+		t.Fatalf("expected clone output in step log, got %q", steps[0].Log)
+	}
+	if left, _ := os.ReadDir(workspaces); len(left) != 0 {
+		t.Fatalf("expected workspace to be cleaned up, found %d entries", len(left))
+	}
+	var audit model.CICDAuditEvent
+	if err := logic.svcCtx.DB.Where("service_id = ? AND event_type = ?", 401, "ci.run.succeeded").First(&audit).Error; err != nil {
+		t.Fatalf("expected ci.run.succeeded audit: %v", err)
+	}
+
+	// webhook 触发的运行固定在推送的提交上。
+	pinned, err := logic.repo.CreateCIRun(context.Background(), model.CICDServiceCIRun{
+		ServiceID: 401, CIConfigID: run.CIConfigID, TriggerType: "source-event", Status: ciRunStatusQueued,
+		TriggeredAt: time.Now(), Branch: "main", CommitSHA: commit,
+	})
+	if err != nil {
+		t.Fatalf("create pinned run: %v", err)
+	}
+	claimed, _ := logic.repo.ClaimQueuedCIRun(context.Background(), time.Now())
+	newTestCIExecutor(logic, workspaces).Execute(context.Background(), claimed)
+	if pinned, _ = logic.repo.GetCIRun(context.Background(), pinned.ID); pinned.Status != ciRunStatusSucceeded || pinned.CommitSHA != commit {
+		t.Fatalf("expected pinned run to build %s, got %+v", commit, pinned)
+	}
+}
+
+func TestCIExecutorFailsOnStepErrorAndTimeout(t *testing.T) {
+	logic := newTestLogic(t)
+	origin, _ := newTestBareRepo(t)
+	e := newTestCIExecutor(logic, t.TempDir())
+
+	run := runQueuedCI(t, logic, e, 402, UpsertServiceCIConfigReq{
+		RepoURL:        origin,
+		BuildSteps:     []string{"echo building; exit 3", "echo unreachable"},
+		ArtifactTarget: "registry.local/shop/web",
+	})
+	if run.Status != ciRunStatusFailed || !strings.Contains(run.ErrorMessage, "build-1") {
+		t.Fatalf("expected failed run, got %+v", run)
+	}
+	if run.ArtifactRef != "registry.local/shop/web:"+run.CommitSHA[:12] {
+		t.Fatalf("expected image ref tagged with commit, got %s", run.ArtifactRef)
+	}
+	steps, _ := logic.ListCIRunSteps(context.Background(), run.ID)
+	if len(steps) != 4 || steps[1].Status != ciStepStatusFailed || steps[1].ExitCode != 3 || !strings.Contains(steps[1].Log, "building") {
+		t.Fatalf("expected failed build step with exit code and log, got %+v", steps)
+	}
+	if steps[2].Status != ciStepStatusSkipped || steps[3].Status != ciStepStatusSkipped {
+		t.Fatalf("expected remaining steps skipped, got %+v", steps)
+	}
+	// 运行结束后实时日志压缩归档, 包含各步骤的输出。
+	text, err := logic.logs.Text(context.Background(), ciRunStream(run.ID))
+	if err != nil || !strings.Contains(text, "==> step build-1\nbuilding\n") || !strings.HasSuffix(text, "[opspilot] run failed: step build-1: exit status 3") {
+		t.Fatalf("expected archived run log, got %q %v", text, err)
+	}
+
+	e.stepTimeout = 200 * time.Millisecond
+	run = runQueuedCI(t, logic, e, 403, UpsertServiceCIConfigReq{
+		RepoURL:        origin,
+		BuildSteps:     []string{"sleep 5"},
+		ArtifactTarget: "file://" + t.TempDir(),
+	})
+	if run.Status != ciRunStatusFailed || !strings.Contains(run.ErrorMessage, "timed out") {
+		t.Fatalf("expected timed out run, got %+v", run)
+	}
+}
+
+func TestResolveCIArtifact(t *testing.T) {
+	commit := "0123456789abcdef0123"
+	cases := map[string]string{
+		"registry.local/web":          "registry.local/web:0123456789ab",
+		"registry.local:5000/web":     "registry.local:5000/web:0123456789ab",
+		"registry.local/web:stable":   "registry.local/web:stable",
+		"file:///srv/artifacts/web":   "file:///srv/artifacts/web/" + commit,
+		"registry.local/web@sha256:1": "registry.local/web@sha256:1",
+	}
+	for target, want := range cases {
+		if got, _ := resolveCIArtifact(target, commit); got != want {
+			t.Fatalf("resolve %s: expected %s, got %s", target, want, got)
+		}
+	}
+}
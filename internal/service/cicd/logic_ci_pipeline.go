@@ -0,0 +1,419 @@
+package cicd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	cicdv1 "github.com/cy77cc/OpsPilot/api/cicd/v1"
+	"github.com/cy77cc/OpsPilot/internal/logger"
+	"github.com/cy77cc/OpsPilot/internal/logstream"
+	"github.com/cy77cc/OpsPilot/internal/model"
+	"github.com/cy77cc/OpsPilot/internal/service/cicd/executor"
+	"github.com/cy77cc/OpsPilot/internal/service/cicd/pipeline"
+)
+
+const (
+	ciPipelineSourceFile   = "file"
+	ciPipelineSourceConfig = "config"
+)
+
+// ErrCIGateNotWaiting 表示步骤不是等待审批的人工卡点, 或已被其他人处理。
+var ErrCIGateNotWaiting = errors.New("ci step is not a waiting manual gate")
+
+// ciStagePlan 是流水线中的一个阶段及其步骤。
+type ciStagePlan struct {
+	name     string
+	kind     string
+	parallel bool
+	deploy   *pipeline.Deploy
+	steps    []ciStepPlan
+}
+
+// loadPipeline 读取提交中的流水线文件并记录在运行上; 仓库没有该文件时由 CI 配置的构建步骤生成。
+// 文件校验失败时运行失败, 原文仍保存在运行上便于排查。
+func (e *ciExecutor) loadPipeline(ctx context.Context, runner executor.Runner, run *model.CICDServiceCIRun, cfg *model.CICDServiceCIConfig, workspace string) (*pipeline.Pipeline, error) {
+	repo := e.logic.repo
+	source := path.Join(workspace, ciSourceDir)
+	file := executor.ShellQuote(pipeline.FilePath)
+	if _, err := runner.Exec(ctx, source, "test -f "+file, nil, &strings.Builder{}); err != nil {
+		p := configPipeline(cfg)
+		run.PipelineSource = ciPipelineSourceConfig
+		run.PipelineJSON = mustJSON(p)
+		return p, repo.SaveCIRun(ctx, run)
+	}
+	// 多读一个字节, 由 Parse 判断是否超过大小限制。
+	var out strings.Builder
+	if _, err := runner.Exec(ctx, source, fmt.Sprintf("head -c %d %s", pipeline.MaxFileSize+1, file), nil, &out); err != nil {
+		return nil, fmt.Errorf("read %s: %w", pipeline.FilePath, err)
+	}
+	run.PipelineSource = ciPipelineSourceFile
+	run.PipelineYAML = truncateString(out.String(), pipeline.MaxFileSize)
+	p, err := pipeline.Parse([]byte(out.String()))
+	if err != nil {
+		if serr := repo.SaveCIRun(ctx, run); serr != nil {
+			return nil, serr
+		}
+		return nil, fmt.Errorf("%s: %w", pipeline.FilePath, err)
+	}
+	run.PipelineJSON = mustJSON(p)
+	return p, repo.SaveCIRun(ctx, run)
+}
+
+// resumePipeline 返回挂起的运行所使用的流水线及拉取代码之后已创建的步骤。
+func (e *ciExecutor) resumePipeline(ctx context.Context, run *model.CICDServiceCIRun) (*pipeline.Pipeline, []model.CICDServiceCIRunStep, error) {
+	p := &pipeline.Pipeline{}
+	if err := json.Unmarshal([]byte(run.PipelineJSON), p); err != nil {
+		return nil, nil, fmt.Errorf("load pipeline: %w", err)
+	}
+	steps, err := e.logic.repo.ListCIRunSteps(ctx, run.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	existing := make([]model.CICDServiceCIRunStep, 0, len(steps))
+	for _, step := range steps {
+		if step.Kind != ciStepKindClone {
+			existing = append(existing, step)
+		}
+	}
+	return p, existing, nil
+}
+
+// configPipeline 把 CI 配置中的构建步骤转换为单阶段流水线。
+func configPipeline(cfg *model.CICDServiceCIConfig) *pipeline.Pipeline {
+	stage := pipeline.Stage{Name: "build"}
+	for i, cmd := range parseStringSliceJSON(cfg.BuildStepsJSON) {
+		if strings.TrimSpace(cmd) == "" {
+			continue
+		}
+		stage.Steps = append(stage.Steps, pipeline.Step{Name: fmt.Sprintf("build-%d", i+1), Run: cmd})
+	}
+	return &pipeline.Pipeline{Version: pipeline.Version, Stages: []pipeline.Stage{stage}}
+}
+
+// planStages 创建拉取代码之后的全部步骤。推送制品作为独立阶段插入在部署阶段之前,
+// 未配置部署阶段时位于最后。when 不满足当前分支或 tag 的阶段和步骤直接记为跳过。
+// existing 非 nil 时为从人工卡点恢复, 沿用已创建的步骤而不再创建。
+func (e *ciExecutor) planStages(ctx context.Context, run *model.CICDServiceCIRun, cfg *model.CICDServiceCIConfig, p *pipeline.Pipeline, workspace string, logs *logstream.Appender, existing []model.CICDServiceCIRunStep) ([]ciStagePlan, error) {
+	ref := pipeline.Ref{Name: run.Branch, Tag: run.RefType == "tag"}
+	source := path.Join(workspace, ciSourceDir)
+	var (
+		rows   []model.CICDServiceCIRunStep
+		plans  []ciStepPlan
+		stages []ciStagePlan
+		bounds [][2]int
+	)
+	add := func(row model.CICDServiceCIRunStep, plan ciStepPlan) {
+		row.RunID = run.ID
+		row.Seq = len(rows) + 2 // 1 为拉取代码
+		if row.Status == "" {
+			row.Status = ciStepStatusPending
+		}
+		plan.logs = logs
+		rows = append(rows, row)
+		plans = append(plans, plan)
+	}
+	addPublish := func() {
+		bounds = append(bounds, [2]int{len(rows), len(rows) + 1})
+		stages = append(stages, ciStagePlan{name: ciStepKindPublish, kind: ciStepKindPublish})
+		add(model.CICDServiceCIRunStep{Stage: ciStepKindPublish, Kind: ciStepKindPublish, Name: "publish", Command: ciPublishCommand(cfg.ArtifactTarget)}, ciStepPlan{dir: workspace})
+	}
+
+	for _, stage := range p.Stages {
+		skipped := !stage.When.Match(ref)
+		plan := ciStagePlan{name: stage.Name, parallel: stage.Parallel}
+		if stage.Deploy != nil {
+			addPublish()
+			if !skipped {
+				if err := e.checkDeployStage(ctx, run, stage.Name, stage.Deploy); err != nil {
+					return nil, err
+				}
+			}
+		}
+		first := len(rows)
+		switch {
+		case stage.Manual != nil:
+			plan.kind = ciStepKindManual
+			add(model.CICDServiceCIRunStep{Stage: stage.Name, Kind: ciStepKindManual, Name: stage.Name,
+				Command: defaultIfEmpty(strings.TrimSpace(stage.Manual.Message), "waiting for approval")}, ciStepPlan{dir: source})
+		case stage.Deploy != nil:
+			plan.kind = ciStepKindDeploy
+			plan.deploy = stage.Deploy
+			add(model.CICDServiceCIRunStep{Stage: stage.Name, Kind: ciStepKindDeploy, Name: stage.Name,
+				Command: fmt.Sprintf("deploy deployment_id=%d env=%s runtime_type=%s", stage.Deploy.DeploymentID, stage.Deploy.Env, defaultIfEmpty(stage.Deploy.RuntimeType, "auto"))}, ciStepPlan{dir: source})
+		default:
+			plan.kind = ciStepKindCommand
+			for _, step := range stage.Steps {
+				row := model.CICDServiceCIRunStep{Stage: stage.Name, Kind: ciStepKindCommand, Name: step.Name, Image: step.Image, Command: step.Run}
+				if !skipped && !step.When.Match(ref) {
+					row.Status = ciStepStatusSkipped
+					row.Log = fmt.Sprintf("[opspilot] step %s skipped: when does not match %s\n", step.Name, ref)
+				}
+				plan := ciStepPlan{dir: source, env: step.Env, timeout: step.StepTimeout()}
+				if stage.Parallel {
+					plan.prefix = "[" + step.Name + "] "
+				}
+				add(row, plan)
+			}
+		}
+		if skipped {
+			for i := first; i < len(rows); i++ {
+				rows[i].Status = ciStepStatusSkipped
+				rows[i].Log = fmt.Sprintf("[opspilot] stage %s skipped: when does not match %s\n", stage.Name, ref)
+			}
+		}
+		bounds = append(bounds, [2]int{first, len(rows)})
+		stages = append(stages, plan)
+	}
+	if len(stages) == 0 || stages[len(stages)-1].kind != ciStepKindDeploy {
+		addPublish()
+	}
+
+	created := existing
+	if created == nil {
+		var err error
+		if created, err = e.logic.repo.CreateCIRunSteps(ctx, rows); err != nil {
+			return nil, err
+		}
+	} else if len(created) != len(rows) {
+		return nil, fmt.Errorf("run has %d steps but its pipeline plans %d", len(created), len(rows))
+	}
+	for i := range plans {
+		plans[i].step = &created[i]
+	}
+	for i := range stages {
+		stages[i].steps = plans[bounds[i][0]:bounds[i][1]]
+	}
+	return stages, nil
+}
+
+// checkDeployStage 在执行任何构建步骤之前确认部署阶段对应的 CD 配置存在且属于运行的服务。
+func (e *ciExecutor) checkDeployStage(ctx context.Context, run *model.CICDServiceCIRun, name string, d *pipeline.Deploy) error {
+	if _, err := e.logic.serviceCDConfig(ctx, run.ServiceID, d.DeploymentID, d.Env, d.RuntimeType); err != nil {
+		return fmt.Errorf("deploy stage %s: %w", name, err)
+	}
+	return nil
+}
+
+// runStage 执行一个阶段, 失败时跳过阶段内尚未执行的步骤并返回错误。
+func (e *ciExecutor) runStage(ctx context.Context, runner executor.Runner, run *model.CICDServiceCIRun, stage ciStagePlan, workspace string, env map[string]string) error {
+	if stage.kind == ciStepKindManual {
+		return e.waitGate(ctx, run, stage.steps[0])
+	}
+	pending := make([]ciStepPlan, 0, len(stage.steps))
+	for _, plan := range stage.steps {
+		if plan.step.Status == ciStepStatusPending {
+			pending = append(pending, plan)
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	switch stage.kind {
+	case ciStepKindDeploy:
+		return e.runDeploy(ctx, run, pending[0], stage.deploy)
+	case ciStepKindPublish:
+		if err := e.runStep(ctx, runner, pending[0], env); err != nil {
+			return err
+		}
+		return e.recordArtifact(ctx, runner, run, workspace, env)
+	}
+	if !stage.parallel {
+		for i, plan := range pending {
+			if err := e.runStep(ctx, runner, plan, env); err != nil {
+				e.skipSteps(ctx, pending[i+1:])
+				return err
+			}
+		}
+		return nil
+	}
+	errs := make([]error, len(pending))
+	done := make(chan struct{}, len(pending))
+	for i, plan := range pending {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			errs[i] = e.runStep(ctx, runner, plan, env)
+		}()
+	}
+	for range pending {
+		<-done
+	}
+	return errors.Join(errs...)
+}
+
+// waitGate 处理人工卡点。首次到达时把卡点置为 waiting 并挂起运行, 释放 worker 与执行环境;
+// 卡点被审批、驳回或过期后运行重新排队, 再次领取时从这里继续。
+func (e *ciExecutor) waitGate(ctx context.Context, run *model.CICDServiceCIRun, plan ciStepPlan) error {
+	repo := e.logic.repo
+	step := plan.step
+	switch step.Status {
+	case ciStepStatusSucceeded, ciStepStatusSkipped:
+		return nil
+	case ciStepStatusFailed:
+		if step.ApprovedBy == 0 {
+			return fmt.Errorf("step %s: not approved within %s", step.Name, e.runTimeout)
+		}
+		return fmt.Errorf("step %s: rejected by user %d", step.Name, step.ApprovedBy)
+	case ciStepStatusPending:
+		step.Log = fmt.Sprintf("[opspilot] %s\n", step.Command)
+		if err := e.startStep(ctx, step, ciStepStatusWaiting); err != nil {
+			return err
+		}
+		plan.logs.Linef("==> stage %s waiting for approval: %s", step.Name, step.Command)
+	}
+	// 挂起后审批会追加日志, 先写入缓冲的日志行以保持顺序。
+	if err := plan.logs.Flush(ctx); err != nil {
+		logger.L().Warn("flush ci run log stream failed", logger.Error(err))
+	}
+	ok, err := repo.ParkCIRun(ctx, run.ID, time.Now())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("run %d is no longer running", run.ID)
+	}
+	run.Status = ciRunStatusWaiting
+	// 挂起之前卡点可能已被处理, 此时审批无法重新排队, 由执行器完成。
+	if fresh, err := repo.GetCIRunStep(ctx, step.RunID, step.ID); err == nil && fresh.Status != ciStepStatusWaiting {
+		if _, err := repo.RequeueCIRun(ctx, run.ID); err != nil {
+			logger.L().Warn("requeue ci run failed", logger.Error(err))
+		}
+	}
+	return errCIRunParked
+}
+
+// runDeploy 通过部署阶段对应的 CD 配置发起发布, 发布关联本次运行的制品。
+// 发布进入审批或异步执行时步骤即成功, 发布结果在发布记录中跟踪。
+func (e *ciExecutor) runDeploy(ctx context.Context, run *model.CICDServiceCIRun, plan ciStepPlan, d *pipeline.Deploy) error {
+	step := plan.step
+	if err := e.startStep(ctx, step, ciStepStatusRunning); err != nil {
+		return err
+	}
+	version := ciRunVersion(run)
+	release, err := e.logic.TriggerRelease(ctx, run.TriggeredBy, TriggerReleaseReq{
+		ServiceID:     run.ServiceID,
+		DeploymentID:  d.DeploymentID,
+		Env:           d.Env,
+		RuntimeType:   d.RuntimeType,
+		Version:       version,
+		CIRunID:       run.ID,
+		TriggerSource: "ci",
+	})
+	var log strings.Builder
+	w := io.MultiWriter(&log, plan.logs.Writer(""))
+	fmt.Fprintf(w, "==> stage %s\n[opspilot] %s version=%s\n", step.Name, step.Command, version)
+	if err != nil {
+		fmt.Fprintf(w, "[opspilot] step %s failed: %v\n", step.Name, err)
+		return e.finishStep(ctx, step, 1, log.String(), err)
+	}
+	fmt.Fprintf(w, "[opspilot] release %d %s\n", release.ID, release.Status)
+	return e.finishStep(ctx, step, 0, log.String(), nil)
+}
+
+func ciContainerName(step *model.CICDServiceCIRunStep) string {
+	return fmt.Sprintf("opspilot-ci-%d-%d", step.RunID, step.ID)
+}
+
+// ciContainerCommand 返回在镜像中执行步骤的命令: 工作目录按原路径挂载, 环境变量按名透传。
+func ciContainerCommand(name, image, dir string, env map[string]string, cmd string) string {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	fmt.Fprintf(&b, `docker run --rm --name %s -v "$OPSPILOT_WORKSPACE":"$OPSPILOT_WORKSPACE" -w %s`, name, executor.ShellQuote(dir))
+	for _, k := range keys {
+		b.WriteString(" -e " + k)
+	}
+	b.WriteString(" " + executor.ShellQuote(image) + " sh -c " + executor.ShellQuote(cmd))
+	return b.String()
+}
+
+// GetCIRunPipeline 返回运行实际使用的流水线。
+func (l *Logic) GetCIRunPipeline(ctx context.Context, runID uint) (*cicdv1.CIRunPipelineResp, error) {
+	run, err := l.repo.GetCIRun(ctx, runID)
+	if err != nil {
+		return nil, err
+	}
+	resp := &cicdv1.CIRunPipelineResp{RunID: run.ID, Source: run.PipelineSource, YAML: run.PipelineYAML}
+	if run.PipelineSource == ciPipelineSourceFile {
+		resp.Path = pipeline.FilePath
+	}
+	if run.PipelineJSON != "" {
+		resp.Pipeline = parseAnyJSON(run.PipelineJSON)
+	} else if run.PipelineSource == ciPipelineSourceFile {
+		resp.Error = run.ErrorMessage
+	}
+	return resp, nil
+}
+
+// ValidatePipeline 校验流水线文件内容, 校验问题在响应中返回而不是作为错误。
+func (l *Logic) ValidatePipeline(_ context.Context, req ValidatePipelineReq) *cicdv1.ValidatePipelineResp {
+	p, err := pipeline.Parse([]byte(req.Content))
+	if err != nil {
+		var verr *pipeline.ValidationError
+		if errors.As(err, &verr) {
+			return &cicdv1.ValidatePipelineResp{Problems: verr.Problems}
+		}
+		return &cicdv1.ValidatePipelineResp{Problems: []string{err.Error()}}
+	}
+	return &cicdv1.ValidatePipelineResp{Valid: true, Pipeline: p}
+}
+
+// DecideCIGate 审批或驳回运行中等待的人工卡点, 执行器轮询到结果后继续或结束运行。
+func (l *Logic) DecideCIGate(ctx context.Context, uid, runID, stepID uint, approve bool, req CIGateDecisionReq) (*cicdv1.CIRunStepResp, error) {
+	run, err := l.repo.GetCIRun(ctx, runID)
+	if err != nil {
+		return nil, err
+	}
+	step, err := l.repo.GetCIRunStep(ctx, runID, stepID)
+	if err != nil {
+		return nil, err
+	}
+	if (run.Status != ciRunStatusWaiting && run.Status != ciRunStatusRunning) || step.Kind != ciStepKindManual || step.Status != ciStepStatusWaiting {
+		return nil, ErrCIGateNotWaiting
+	}
+	status, decision, eventType := ciStepStatusSucceeded, "approved", "ci.gate.approved"
+	if !approve {
+		status, decision, eventType = ciStepStatusFailed, "rejected", "ci.gate.rejected"
+	}
+	log := step.Log + fmt.Sprintf("[opspilot] %s by user %d", decision, uid)
+	if comment := strings.TrimSpace(req.Comment); comment != "" {
+		log += ": " + comment
+	}
+	log += "\n"
+	ok, err := l.repo.DecideCIRunStep(ctx, runID, stepID, status, uid, log, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrCIGateNotWaiting
+	}
+	if logs, err := l.logs.Open(ctx, ciRunStream(runID)); err == nil {
+		logs.Linef("[opspilot] stage %s %s by user %d", step.Name, decision, uid)
+		_ = logs.Close()
+	}
+	// 运行挂起在卡点上, 重新排队由 worker 继续执行或结束运行。
+	if _, err := l.repo.RequeueCIRun(ctx, runID); err != nil {
+		return nil, err
+	}
+	_ = l.writeAudit(ctx, run.ServiceID, 0, 0, eventType, uid, map[string]any{
+		"ci_run_id": runID,
+		"step_id":   stepID,
+		"stage":     step.Stage,
+		"comment":   strings.TrimSpace(req.Comment),
+	})
+	l.invalidateTimelineCache(ctx, run.ServiceID)
+	if step, err = l.repo.GetCIRunStep(ctx, runID, stepID); err != nil {
+		return nil, err
+	}
+	resp := toCIRunStepResp(step)
+	return &resp, nil
+}
@@ -0,0 +1,169 @@
+package cicd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cy77cc/OpsPilot/internal/model"
+)
+
+const testPipelineYAML = `version: 1
+env:
+  GREETING: hello
+stages:
+  - name: test
+    parallel: true
+    steps:
+      - name: unit
+        run: test "$GREETING" = hello && echo unit > "$OPSPILOT_ARTIFACT_DIR"/unit.txt
+      - name: lint
+        run: test "$LEVEL" = strict
+        env:
+          LEVEL: strict
+      - name: release-only
+        run: exit 1
+        when:
+          branches: ["release/*"]
+  - name: approve
+    manual:
+      message: ship it?
+  - name: package
+    when:
+      tags: ["v*"]
+    steps:
+      - name: tarball
+        run: exit 1
+`
+
+func TestCIExecutorRunsPipelineFromRepository(t *testing.T) {
+	logic := newTestLogic(t)
+	ctx := context.Background()
+	origin, _ := newTestBareRepoWith(t, map[string]string{"app.txt": "hello", ".opspilot/pipeline.yaml": testPipelineYAML})
+	e := newTestCIExecutor(logic, t.TempDir())
+
+	// 运行挂起在人工卡点处并释放 worker, 审批后重新排队并从卡点继续。
+	run := runQueuedCI(t, logic, e, 701, UpsertServiceCIConfigReq{
+		RepoURL:        origin,
+		BuildSteps:     []string{"exit 1"},
+		ArtifactTarget: "file://" + t.TempDir(),
+	})
+	if run.Status != ciRunStatusWaiting || run.FinishedAt != nil {
+		t.Fatalf("expected run to be parked at the gate, got %+v", run)
+	}
+	if _, err := os.Stat(path.Join(run.Workspace, ciArtifactDir, "unit.txt")); err != nil {
+		t.Fatalf("expected parked run to keep its workspace: %v", err)
+	}
+	if claimed, _ := logic.repo.ClaimQueuedCIRun(ctx, time.Now()); claimed != nil {
+		t.Fatalf("expected parked run not to be claimable, got %+v", claimed)
+	}
+	steps, _ := logic.repo.ListCIRunSteps(ctx, run.ID)
+	gate := steps[4]
+	if gate.Kind != ciStepKindManual || gate.Status != ciStepStatusWaiting {
+		t.Fatalf("expected waiting gate, got %+v", gate)
+	}
+	if _, err := logic.DecideCIGate(ctx, 9, run.ID, gate.ID, true, CIGateDecisionReq{Comment: "lgtm"}); err != nil {
+		t.Fatalf("approve gate: %v", err)
+	}
+	run = resumeQueuedCI(t, logic, e, run.ID)
+	if run.Workspace != "" {
+		t.Fatalf("expected workspace to be cleaned after the run, got %q", run.Workspace)
+	}
+	if run.Status != ciRunStatusSucceeded || run.PipelineSource != ciPipelineSourceFile || run.PipelineYAML != testPipelineYAML || run.RefType != "branch" {
+		t.Fatalf("expected run to follow the repository pipeline, got %+v", run)
+	}
+
+	resp, _ := logic.ListCIRunSteps(ctx, run.ID)
+	got := make([]string, 0, len(steps))
+	for _, step := range resp {
+		got = append(got, step.Stage+"/"+step.Name+":"+step.Status)
+	}
+	want := "clone/clone:succeeded test/unit:succeeded test/lint:succeeded test/release-only:skipped approve/approve:succeeded package/tarball:skipped publish/publish:succeeded"
+	if strings.Join(got, " ") != want {
+		t.Fatalf("unexpected steps:\n got %s\nwant %s", strings.Join(got, " "), want)
+	}
+	if gate := resp[4]; gate.ApprovedBy != 9 || !strings.Contains(gate.Log, "ship it?") || !strings.Contains(gate.Log, "lgtm") {
+		t.Fatalf("expected gate approval recorded, got %+v", gate)
+	}
+	if text, _ := logic.logs.Text(ctx, ciRunStream(run.ID)); !strings.Contains(text, "[lint] ==> step lint") || !strings.Contains(text, "stage approve approved by user 9") {
+		t.Fatalf("expected prefixed parallel output and gate decision in run log, got %q", text)
+	}
+	view, err := logic.GetCIRunPipeline(ctx, run.ID)
+	if err != nil || view.Path != ".opspilot/pipeline.yaml" || view.Pipeline == nil {
+		t.Fatalf("expected pipeline view, got %+v %v", view, err)
+	}
+	if _, err := logic.DecideCIGate(ctx, 9, run.ID, gate.ID, false, CIGateDecisionReq{}); !errors.Is(err, ErrCIGateNotWaiting) {
+		t.Fatalf("expected decided gate to be rejected, got %v", err)
+	}
+}
+
+func TestCIExecutorExpiresParkedGate(t *testing.T) {
+	logic := newTestLogic(t)
+	ctx := context.Background()
+	origin, _ := newTestBareRepoWith(t, map[string]string{".opspilot/pipeline.yaml": "stages:\n  - name: approve\n    manual: {}\n"})
+	e := newTestCIExecutor(logic, t.TempDir())
+
+	run := runQueuedCI(t, logic, e, 705, UpsertServiceCIConfigReq{RepoURL: origin, ArtifactTarget: "file://" + t.TempDir()})
+	if run.Status != ciRunStatusWaiting {
+		t.Fatalf("expected run to be parked at the gate, got %+v", run)
+	}
+	workspace := run.Workspace
+	logic.svcCtx.DB.Model(run).Update("heartbeat_at", time.Now().Add(-2*e.runTimeout))
+	e.recoverStaleRuns(ctx)
+
+	run = resumeQueuedCI(t, logic, e, run.ID)
+	if run.Status != ciRunStatusFailed || !strings.Contains(run.ErrorMessage, "not approved within") {
+		t.Fatalf("expected expired gate to fail the run, got %+v", run)
+	}
+	if _, err := os.Stat(workspace); !os.IsNotExist(err) {
+		t.Fatalf("expected parked workspace to be removed, got %v", err)
+	}
+	if steps, _ := logic.repo.ListCIRunSteps(ctx, run.ID); steps[len(steps)-1].Status != ciStepStatusSkipped {
+		t.Fatalf("expected steps after the gate to be skipped, got %+v", steps)
+	}
+}
+
+func TestCIExecutorRejectsInvalidPipeline(t *testing.T) {
+	logic := newTestLogic(t)
+	ctx := context.Background()
+	e := newTestCIExecutor(logic, t.TempDir())
+
+	origin, _ := newTestBareRepoWith(t, map[string]string{".opspilot/pipeline.yaml": "stages:\n  - name: build\n    steps:\n      - name: b\n        runs: make\n"})
+	run := runQueuedCI(t, logic, e, 702, UpsertServiceCIConfigReq{RepoURL: origin, ArtifactTarget: "file://" + t.TempDir()})
+	if run.Status != ciRunStatusFailed || !strings.Contains(run.ErrorMessage, "field runs not found") || run.PipelineYAML == "" {
+		t.Fatalf("expected invalid pipeline to fail the run, got %+v", run)
+	}
+	view, _ := logic.GetCIRunPipeline(ctx, run.ID)
+	if view.Pipeline != nil || view.Error == "" {
+		t.Fatalf("expected pipeline error in view, got %+v", view)
+	}
+
+	// 部署阶段缺少 CD 配置时, 在执行构建步骤前失败。
+	origin, _ = newTestBareRepoWith(t, map[string]string{".opspilot/pipeline.yaml": "stages:\n  - name: build\n    steps:\n      - name: b\n        run: echo ok\n  - name: prod\n    deploy:\n      deployment_id: 999\n      env: production\n"})
+	run = runQueuedCI(t, logic, e, 703, UpsertServiceCIConfigReq{RepoURL: origin, ArtifactTarget: "file://" + t.TempDir()})
+	if run.Status != ciRunStatusFailed || !strings.Contains(run.ErrorMessage, "no cd config for deployment 999") {
+		t.Fatalf("expected missing cd config to fail the run, got %+v", run)
+	}
+	if steps, _ := logic.ListCIRunSteps(ctx, run.ID); len(steps) != 1 {
+		t.Fatalf("expected only the clone step, got %+v", steps)
+	}
+
+	// 部署属于其他服务时同样拒绝。
+	if err := logic.svcCtx.DB.Create(&model.CICDDeploymentCDConfig{DeploymentID: 998, Env: "production", RuntimeType: "k8s", ServiceID: 1}).Error; err != nil {
+		t.Fatalf("create cd config: %v", err)
+	}
+	origin, _ = newTestBareRepoWith(t, map[string]string{".opspilot/pipeline.yaml": "stages:\n  - name: prod\n    deploy:\n      deployment_id: 998\n      env: production\n"})
+	run = runQueuedCI(t, logic, e, 704, UpsertServiceCIConfigReq{RepoURL: origin, ArtifactTarget: "file://" + t.TempDir()})
+	if run.Status != ciRunStatusFailed || !strings.Contains(run.ErrorMessage, "not bound to service 704") {
+		t.Fatalf("expected foreign deployment to fail the run, got %+v", run)
+	}
+
+	resp := logic.ValidatePipeline(ctx, ValidatePipelineReq{Content: "stages:\n  - name: gate\n    manual: {}\n    parallel: true\n"})
+	if resp.Valid || len(resp.Problems) != 1 || !strings.Contains(resp.Problems[0], "parallel requires steps") {
+		t.Fatalf("expected validation problems, got %+v", resp)
+	}
+}
@@ -2,9 +2,13 @@ package cicd
 
 import (
 	"context"
+	"errors"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/cy77cc/OpsPilot/internal/model"
+	deploymentlogic "github.com/cy77cc/OpsPilot/internal/service/deployment"
 	"github.com/cy77cc/OpsPilot/internal/svc"
 	"github.com/redis/go-redis/v9"
 	"gorm.io/driver/sqlite"
@@ -20,16 +24,27 @@ func newTestLogic(t *testing.T) *Logic {
 	if err := db.AutoMigrate(
 		&model.CICDServiceCIConfig{},
 		&model.CICDServiceCIRun{},
+		&model.CICDServiceCIRunStep{},
+		&model.CICDWebhookDelivery{},
+		&model.CICDArtifact{},
 		&model.CICDDeploymentCDConfig{},
 		&model.CICDRelease{},
 		&model.CICDReleaseApproval{},
 		&model.CICDAuditEvent{},
+		&model.LogChunk{},
+		&model.LogArchive{},
 		&model.Service{},
 		&model.Cluster{},
 		&model.DeploymentTarget{},
 		&model.DeploymentRelease{},
 		&model.DeploymentReleaseApproval{},
+		&model.DeploymentReleaseApprovalVote{},
+		&model.Policy{},
 		&model.DeploymentReleaseAudit{},
+		&model.DeploymentFreezeWindow{},
+		&model.DeploymentTargetLock{},
+		&model.DeploymentReleaseHook{},
+		&model.ServiceVariableSet{},
 		&model.ServiceDeployTarget{},
 	); err != nil {
 		t.Fatalf("auto migrate: %v", err)
@@ -100,6 +115,51 @@ func TestTriggerReleaseFallsBackToServiceDefaultTarget(t *testing.T) {
 	}
 }
 
+func TestTriggerReleaseBlockedByProjectFreeze(t *testing.T) {
+	logic := newTestLogic(t)
+	ctx := context.Background()
+
+	if err := logic.svcCtx.DB.WithContext(ctx).Create(&model.Service{
+		ID:          103,
+		Name:        "svc-frozen",
+		Env:         "staging",
+		ProjectID:   21,
+		YamlContent: "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: svc-frozen\n",
+	}).Error; err != nil {
+		t.Fatalf("seed service: %v", err)
+	}
+	if err := logic.svcCtx.DB.WithContext(ctx).Create(&model.Cluster{ID: 3, Name: "cluster-3", KubeConfig: "invalid-kubeconfig", Status: "active"}).Error; err != nil {
+		t.Fatalf("seed cluster: %v", err)
+	}
+	if err := logic.svcCtx.DB.WithContext(ctx).Create(&model.DeploymentTarget{
+		ID: 302, Name: "target-frozen", TargetType: "k8s", RuntimeType: "k8s", ClusterID: 3, ProjectID: 21, Env: "staging", Status: "active", ReadinessStatus: "ready",
+	}).Error; err != nil {
+		t.Fatalf("seed target: %v", err)
+	}
+	start, end := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	if err := logic.svcCtx.DB.WithContext(ctx).Create(&model.DeploymentFreezeWindow{
+		Name: "project-freeze", ProjectID: 21, WindowType: "one_off", StartAt: &start, EndAt: &end, Enabled: true,
+	}).Error; err != nil {
+		t.Fatalf("seed freeze window: %v", err)
+	}
+
+	_, err := logic.TriggerRelease(ctx, 3, TriggerReleaseReq{ServiceID: 103, DeploymentID: 302, Env: "staging", RuntimeType: "k8s", Version: "v2.0.0"})
+	if !errors.Is(err, deploymentlogic.ErrChangeFreeze) {
+		t.Fatalf("expected change freeze error, got %v", err)
+	}
+	var blocked []model.CICDAuditEvent
+	logic.svcCtx.DB.Where("service_id = ? AND event_type IN ?", 103, []string{"release.trigger_blocked", "release.freeze_blocked"}).Find(&blocked)
+	if len(blocked) != 1 || blocked[0].EventType != "release.trigger_blocked" || !strings.Contains(blocked[0].PayloadJSON, "change_freeze") {
+		t.Fatalf("expected a single cicd trigger_blocked event, got %+v", blocked)
+	}
+	// 冻结拦截本身只由发布审计记录一次。
+	var freezeAudits int64
+	logic.svcCtx.DB.Model(&model.DeploymentReleaseAudit{}).Where("release_id = ? AND action = ?", blocked[0].ReleaseID, "release.freeze_blocked").Count(&freezeAudits)
+	if freezeAudits != 1 {
+		t.Fatalf("expected one release freeze_blocked audit, got %d", freezeAudits)
+	}
+}
+
 func TestTriggerModeValidation(t *testing.T) {
 	logic := newTestLogic(t)
 	ctx := context.Background()
@@ -196,3 +256,77 @@ func TestComposeCanaryRejected(t *testing.T) {
 		t.Fatalf("expected compose canary to be rejected")
 	}
 }
+
+func TestRollbackReleaseResolvesTargetVersion(t *testing.T) {
+	logic := newTestLogic(t)
+	ctx := context.Background()
+	db := logic.svcCtx.DB
+	if err := db.Create(&model.Cluster{ID: 7, Name: "cluster-7", KubeConfig: "invalid-kubeconfig", Status: "active"}).Error; err != nil {
+		t.Fatalf("seed cluster: %v", err)
+	}
+	if err := db.Create(&model.DeploymentTarget{ID: 701, Name: "target-rollback", TargetType: "k8s", RuntimeType: "k8s", ClusterID: 7, Status: "active", ReadinessStatus: "ready"}).Error; err != nil {
+		t.Fatalf("seed target: %v", err)
+	}
+	release := func(version, commit string, revisionID uint, manifest string) *model.DeploymentRelease {
+		row := &model.DeploymentRelease{ServiceID: 701, TargetID: 701, RevisionID: revisionID, RuntimeType: "k8s", Status: "applied", CommitSHA: commit,
+			ManifestSnapshot: manifest, TriggerContextJSON: mustJSON(map[string]any{"version": version}), DiagnosticsJSON: "[]", VerificationJSON: "{}"}
+		if err := db.Create(row).Error; err != nil {
+			t.Fatalf("seed release %s: %v", version, err)
+		}
+		return row
+	}
+	v1 := release("v1", "1111111aaaa", 5, "kind: ConfigMap\nmetadata:\n  name: v1\n")
+	v2 := release("v2", "2222222bbbb", 0, "kind: ConfigMap\nmetadata:\n  name: v2\n")
+	current := release("v3", "3333333cccc", 0, "kind: ConfigMap\nmetadata:\n  name: v3\n")
+
+	for version, want := range map[string]uint{"": 0, "v1": v1.ID, "2222222": v2.ID, "rev-5": v1.ID} {
+		if got, err := logic.resolveRollbackVersion(ctx, current, version); err != nil || got != want {
+			t.Fatalf("resolve %q: expected %d, got %d %v", version, want, got, err)
+		}
+	}
+	// 没有修订的发布不应被 rev-0 命中。
+	if got, err := logic.resolveRollbackVersion(ctx, current, "rev-0"); !errors.Is(err, deploymentlogic.ErrRollbackTargetNotFound) {
+		t.Fatalf("expected rev-0 to match no release, got %d %v", got, err)
+	}
+
+	if _, err := logic.RollbackRelease(ctx, 1, current.ID, "v9", ""); !errors.Is(err, deploymentlogic.ErrRollbackTargetNotFound) {
+		t.Fatalf("expected missing version to fail, got %v", err)
+	}
+	var count int64
+	if err := db.Model(&model.DeploymentRelease{}).Where("service_id = ?", 701).Count(&count).Error; err != nil {
+		t.Fatalf("count releases: %v", err)
+	}
+	if count != 3 {
+		t.Fatalf("expected no rollback release for a missing version, got %d releases", count)
+	}
+
+	// 集群不可达时回滚失败, 失败原因记录在回滚发布上而不是报告成功。
+	if _, err := logic.RollbackRelease(ctx, 1, current.ID, "v1", "bad deploy"); err == nil {
+		t.Fatal("expected rollback against an unreachable cluster to fail")
+	}
+	var rollback model.DeploymentRelease
+	db.Where("service_id = ? AND source_release_id = ?", 701, current.ID).Last(&rollback)
+	if rollback.Status != "failed" || rollback.ManifestSnapshot != v1.ManifestSnapshot || rollback.CommitSHA != v1.CommitSHA ||
+		!strings.Contains(rollback.DiagnosticsJSON, "rollback_apply_failed") {
+		t.Fatalf("expected failed rollback to v1 with diagnostics, got %+v", rollback)
+	}
+	var audit model.CICDAuditEvent
+	if err := db.Where("service_id = ? AND event_type = ?", 701, "release.rollback_failed").Last(&audit).Error; err != nil ||
+		!strings.Contains(audit.PayloadJSON, "rollback_release_id") {
+		t.Fatalf("expected rollback_failed audit, got %+v %v", audit, err)
+	}
+	// 执行中或失败的回滚不是成功发布, 不能被版本命中: 失败的回滚同样带着修订 5, rev-5 仍应解析到 v1。
+	if got, err := logic.resolveRollbackVersion(ctx, current, "rev-5"); err != nil || got != v1.ID {
+		t.Fatalf("expected rev-5 to resolve to v1 %d past the failed rollback %d, got %d %v", v1.ID, rollback.ID, got, err)
+	}
+	for _, status := range []string{"applying", "failed"} {
+		row := &model.DeploymentRelease{ServiceID: 701, TargetID: 701, RevisionID: 9, RuntimeType: "k8s", Strategy: "rollback", Status: status,
+			ManifestSnapshot: "kind: ConfigMap\nmetadata:\n  name: v9\n", TriggerContextJSON: "{}", DiagnosticsJSON: "[]", VerificationJSON: "{}"}
+		if err := db.Create(row).Error; err != nil {
+			t.Fatalf("seed %s rollback: %v", status, err)
+		}
+	}
+	if got, err := logic.resolveRollbackVersion(ctx, current, "rev-9"); !errors.Is(err, deploymentlogic.ErrRollbackTargetNotFound) {
+		t.Fatalf("expected rev-9 to match no successful release, got %d %v", got, err)
+	}
+}
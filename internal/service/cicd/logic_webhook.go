@@ -0,0 +1,526 @@
+package cicd
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	cicdv1 "github.com/cy77cc/OpsPilot/api/cicd/v1"
+	"github.com/cy77cc/OpsPilot/internal/model"
+)
+
+const (
+	webhookProviderGitHub = "github"
+	webhookProviderGitLab = "gitlab"
+	webhookProviderGitea  = "gitea"
+
+	webhookStatusReceived  = "received"
+	webhookStatusTriggered = "triggered"
+	webhookStatusIgnored   = "ignored"
+	webhookStatusDuplicate = "duplicate"
+	webhookStatusRejected  = "rejected"
+	webhookStatusInvalid   = "invalid"
+
+	// WebhookBodyLimit 是 webhook 请求体的大小上限。
+	WebhookBodyLimit = 5 << 20
+)
+
+var (
+	// ErrWebhookProvider 表示不支持的 webhook 来源。
+	ErrWebhookProvider = errors.New("webhook provider must be one of: github, gitlab, gitea")
+	// ErrWebhookSignature 表示没有任何匹配的 CI 配置能验证投递的签名。
+	ErrWebhookSignature = errors.New("webhook signature verification failed")
+	// ErrWebhookNotReplayable 表示投递从未通过签名验证, 不能重放。
+	ErrWebhookNotReplayable = errors.New("delivery was never verified and cannot be replayed")
+
+	zeroSHA = regexp.MustCompile(`^0+$`)
+)
+
+// webhookEvent 是从不同 Git 服务器的推送事件中解析出的公共字段。
+type webhookEvent struct {
+	Event      string
+	DeliveryID string
+	Push       bool // 是否为分支或 tag 推送
+	Ref        string
+	Branch     string
+	Tag        string
+	CommitSHA  string
+	Author     string
+	Message    string
+	RepoURLs   []string
+	Deleted    bool
+}
+
+type webhookCommit struct {
+	ID      string `json:"id"`
+	Message string `json:"message"`
+	Author  struct {
+		Name     string `json:"name"`
+		Username string `json:"username"`
+	} `json:"author"`
+}
+
+// githubPushPayload 覆盖 GitHub 与 Gitea 推送事件共有的字段。
+type githubPushPayload struct {
+	Ref        string          `json:"ref"`
+	After      string          `json:"after"`
+	Deleted    bool            `json:"deleted"`
+	HeadCommit *webhookCommit  `json:"head_commit"`
+	Commits    []webhookCommit `json:"commits"`
+	Pusher     struct {
+		Name     string `json:"name"`
+		Login    string `json:"login"`
+		Username string `json:"username"`
+	} `json:"pusher"`
+	Repository struct {
+		CloneURL string `json:"clone_url"`
+		SSHURL   string `json:"ssh_url"`
+		HTMLURL  string `json:"html_url"`
+	} `json:"repository"`
+}
+
+type gitlabPushPayload struct {
+	Ref         string          `json:"ref"`
+	After       string          `json:"after"`
+	CheckoutSHA string          `json:"checkout_sha"`
+	UserName    string          `json:"user_name"`
+	Commits     []webhookCommit `json:"commits"`
+	Project     struct {
+		GitHTTPURL string `json:"git_http_url"`
+		GitSSHURL  string `json:"git_ssh_url"`
+		WebURL     string `json:"web_url"`
+	} `json:"project"`
+}
+
+// ReceiveWebhook 处理 Git 服务器的 webhook 投递: 每次投递都记录一行, 保留状态与原因用于排查,
+// 按仓库地址匹配 CI 配置并验证签名, 通过验证后才保存原始请求, 再去重并按分支/tag 模式触发 source-event 运行。
+// 未通过验证的投递 (无法解析、非推送、无匹配配置、签名错误) 只记录摘要, 不保存请求头与请求体;
+// 签名验证失败时返回 ErrWebhookSignature。
+func (l *Logic) ReceiveWebhook(ctx context.Context, provider string, header http.Header, body []byte) (*cicdv1.WebhookDeliveryResp, error) {
+	provider = strings.ToLower(strings.TrimSpace(provider))
+	if !slices.Contains([]string{webhookProviderGitHub, webhookProviderGitLab, webhookProviderGitea}, provider) {
+		return nil, ErrWebhookProvider
+	}
+	row := &model.CICDWebhookDelivery{Provider: provider, Status: webhookStatusReceived}
+	if err := l.repo.CreateWebhookDelivery(ctx, row); err != nil {
+		return nil, err
+	}
+	return l.processWebhook(ctx, row, header, body, nil)
+}
+
+// ReplayWebhookDelivery 以原始请求重新处理一次投递, 跳过去重。
+// 只重放签名已通过验证的投递, 并且只对当时验证通过的 CI 配置生效。
+func (l *Logic) ReplayWebhookDelivery(ctx context.Context, uid, id uint) (*cicdv1.WebhookDeliveryResp, error) {
+	origin, err := l.repo.GetWebhookDelivery(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	trusted := parseUintSliceJSON(origin.VerifiedConfigIDsJSON)
+	if len(trusted) == 0 {
+		return nil, fmt.Errorf("delivery %d: %w", id, ErrWebhookNotReplayable)
+	}
+	headers := map[string]string{}
+	_ = json.Unmarshal([]byte(origin.HeadersJSON), &headers)
+	header := http.Header{}
+	for k, v := range headers {
+		header.Set(k, v)
+	}
+	row := &model.CICDWebhookDelivery{
+		Provider:    origin.Provider,
+		Status:      webhookStatusReceived,
+		HeadersJSON: origin.HeadersJSON,
+		Payload:     origin.Payload,
+		ReplayOf:    origin.ID,
+		ReplayedBy:  uid,
+	}
+	if err := l.repo.CreateWebhookDelivery(ctx, row); err != nil {
+		return nil, err
+	}
+	return l.processWebhook(ctx, row, header, []byte(origin.Payload), trusted)
+}
+
+func (l *Logic) GetWebhookDelivery(ctx context.Context, id uint) (*cicdv1.WebhookDeliveryResp, error) {
+	row, err := l.repo.GetWebhookDelivery(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	resp := toWebhookDeliveryResp(row)
+	resp.Payload = row.Payload
+	resp.Headers = map[string]string{}
+	_ = json.Unmarshal([]byte(row.HeadersJSON), &resp.Headers)
+	return resp, nil
+}
+
+func (l *Logic) ListWebhookDeliveries(ctx context.Context, provider, status string, limit int) ([]cicdv1.WebhookDeliveryResp, error) {
+	rows, err := l.repo.ListWebhookDeliveries(ctx, strings.TrimSpace(provider), strings.TrimSpace(status), limit)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]cicdv1.WebhookDeliveryResp, 0, len(rows))
+	for i := range rows {
+		out = append(out, *toWebhookDeliveryResp(&rows[i]))
+	}
+	return out, nil
+}
+
+// processWebhook 处理已记录的投递。trusted 非空时为重放, 不再验证签名和去重。
+// 去重与保存请求都在签名验证之后进行, 伪造的投递既不能抢占投递 ID, 也不会留下请求内容;
+// 去重通过唯一的 claim_key 占用投递 ID, 并发的重复投递只会触发一次。
+func (l *Logic) processWebhook(ctx context.Context, row *model.CICDWebhookDelivery, header http.Header, body []byte, trusted []uint) (*cicdv1.WebhookDeliveryResp, error) {
+	finish := func(status, detail string) (*cicdv1.WebhookDeliveryResp, error) {
+		row.Status = status
+		row.Detail = truncateString(detail, 512)
+		if err := l.repo.SaveWebhookDelivery(ctx, row); err != nil {
+			return nil, err
+		}
+		return toWebhookDeliveryResp(row), nil
+	}
+
+	ev, err := parseWebhookEvent(row.Provider, header, body)
+	if err != nil {
+		return finish(webhookStatusInvalid, err.Error())
+	}
+	row.Event = ev.Event
+	row.DeliveryID = ev.DeliveryID
+	row.Ref = ev.Ref
+	row.CommitSHA = ev.CommitSHA
+	row.Author = truncateString(ev.Author, 128)
+	if len(ev.RepoURLs) > 0 {
+		row.RepoURL = ev.RepoURLs[0]
+	}
+	if !ev.Push {
+		return finish(webhookStatusIgnored, fmt.Sprintf("event %q is not a push", ev.Event))
+	}
+
+	configs, err := l.repo.ListActiveCIConfigs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	repoURLs := make([]string, 0, len(ev.RepoURLs))
+	for _, u := range ev.RepoURLs {
+		repoURLs = append(repoURLs, normalizeRepoURL(u))
+	}
+	verified := make([]model.CICDServiceCIConfig, 0)
+	candidates := 0
+	for _, cfg := range configs {
+		if !slices.Contains(repoURLs, normalizeRepoURL(cfg.RepoURL)) {
+			continue
+		}
+		candidates++
+		if trusted != nil {
+			if slices.Contains(trusted, cfg.ID) {
+				verified = append(verified, cfg)
+			}
+			continue
+		}
+		if verifyWebhookSignature(row.Provider, header, body, cfg.WebhookSecret) {
+			verified = append(verified, cfg)
+		}
+	}
+	if candidates == 0 {
+		return finish(webhookStatusIgnored, "no ci config for repository")
+	}
+	if len(verified) == 0 {
+		if _, err := finish(webhookStatusRejected, ErrWebhookSignature.Error()); err != nil {
+			return nil, err
+		}
+		return toWebhookDeliveryResp(row), ErrWebhookSignature
+	}
+	verifiedIDs := make([]uint, 0, len(verified))
+	for _, cfg := range verified {
+		verifiedIDs = append(verifiedIDs, cfg.ID)
+	}
+	row.VerifiedConfigIDsJSON = mustJSON(verifiedIDs)
+	row.HeadersJSON = mustJSON(webhookHeaders(header))
+	row.Payload = string(body)
+	if trusted == nil {
+		dup, err := l.repo.ClaimWebhookDelivery(ctx, row)
+		if err != nil {
+			return nil, err
+		}
+		if dup != nil {
+			return finish(webhookStatusDuplicate, fmt.Sprintf("already processed as delivery %d", dup.ID))
+		}
+	}
+	if ev.Deleted {
+		return finish(webhookStatusIgnored, "ref deleted")
+	}
+
+	runIDs := make([]uint, 0)
+	skipped := make([]string, 0)
+	for i := range verified {
+		cfg := &verified[i]
+		if !allowTrigger(cfg.TriggerMode, "source-event") {
+			skipped = append(skipped, fmt.Sprintf("service %d: trigger mode %s", cfg.ServiceID, cfg.TriggerMode))
+			continue
+		}
+		if !matchWebhookRef(cfg, ev) {
+			skipped = append(skipped, fmt.Sprintf("service %d: ref %s not matched", cfg.ServiceID, ev.Ref))
+			continue
+		}
+		run, err := l.queueWebhookRun(ctx, cfg, row, ev)
+		if err != nil {
+			if row.ClaimKey != nil {
+				_ = l.repo.ReleaseWebhookDeliveryClaim(ctx, row)
+			}
+			return nil, err
+		}
+		runIDs = append(runIDs, run.ID)
+	}
+	row.RunIDsJSON = mustJSON(runIDs)
+	if len(runIDs) == 0 {
+		return finish(webhookStatusIgnored, strings.Join(skipped, "; "))
+	}
+	return finish(webhookStatusTriggered, strings.Join(skipped, "; "))
+}
+
+func (l *Logic) queueWebhookRun(ctx context.Context, cfg *model.CICDServiceCIConfig, delivery *model.CICDWebhookDelivery, ev *webhookEvent) (*model.CICDServiceCIRun, error) {
+	ref, refType := ev.Branch, "branch"
+	if ev.Tag != "" {
+		ref, refType = ev.Tag, "tag"
+	}
+	run, err := l.repo.CreateCIRun(ctx, model.CICDServiceCIRun{
+		ServiceID:         cfg.ServiceID,
+		CIConfigID:        cfg.ID,
+		TriggerType:       "source-event",
+		Status:            ciRunStatusQueued,
+		Reason:            truncateString(fmt.Sprintf("%s push %s", delivery.Provider, ev.Ref), 512),
+		TriggeredAt:       time.Now(),
+		Branch:            ref,
+		RefType:           refType,
+		CommitSHA:         ev.CommitSHA,
+		CommitAuthor:      truncateString(ev.Author, 128),
+		CommitMessage:     ev.Message,
+		WebhookDeliveryID: delivery.ID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	_ = l.writeAudit(ctx, cfg.ServiceID, 0, 0, "ci.run.queued", 0, map[string]any{
+		"ci_run_id":    run.ID,
+		"trigger_type": run.TriggerType,
+		"delivery_id":  delivery.ID,
+		"ref":          ev.Ref,
+		"commit_sha":   ev.CommitSHA,
+	})
+	l.invalidateTimelineCache(ctx, cfg.ServiceID)
+	return run, nil
+}
+
+// parseWebhookEvent 按来源解析事件类型、投递 ID 与推送内容。非推送事件只返回类型和投递 ID。
+func parseWebhookEvent(provider string, header http.Header, body []byte) (*webhookEvent, error) {
+	ev := &webhookEvent{}
+	switch provider {
+	case webhookProviderGitHub:
+		ev.Event = header.Get("X-GitHub-Event")
+		ev.DeliveryID = header.Get("X-GitHub-Delivery")
+		ev.Push = ev.Event == "push"
+	case webhookProviderGitea:
+		ev.Event = header.Get("X-Gitea-Event")
+		ev.DeliveryID = header.Get("X-Gitea-Delivery")
+		ev.Push = ev.Event == "push"
+	case webhookProviderGitLab:
+		ev.Event = header.Get("X-Gitlab-Event")
+		ev.DeliveryID = defaultIfEmpty(header.Get("X-Gitlab-Event-UUID"), header.Get("Idempotency-Key"))
+		ev.Push = ev.Event == "Push Hook" || ev.Event == "Tag Push Hook"
+	}
+	if strings.TrimSpace(ev.DeliveryID) == "" {
+		sum := sha256.Sum256(body)
+		ev.DeliveryID = "sha256:" + hex.EncodeToString(sum[:])
+	}
+	if ev.Event == "" {
+		return nil, fmt.Errorf("missing %s event header", provider)
+	}
+	if !ev.Push {
+		return ev, nil
+	}
+
+	var head *webhookCommit
+	if provider == webhookProviderGitLab {
+		var p gitlabPushPayload
+		if err := json.Unmarshal(body, &p); err != nil {
+			return nil, fmt.Errorf("decode push payload: %w", err)
+		}
+		ev.Ref = p.Ref
+		ev.CommitSHA = defaultIfEmpty(p.CheckoutSHA, p.After)
+		ev.Author = p.UserName
+		ev.RepoURLs = compactStrings(p.Project.GitHTTPURL, p.Project.GitSSHURL, p.Project.WebURL)
+		head = findWebhookCommit(p.Commits, ev.CommitSHA)
+	} else {
+		var p githubPushPayload
+		if err := json.Unmarshal(body, &p); err != nil {
+			return nil, fmt.Errorf("decode push payload: %w", err)
+		}
+		ev.Ref = p.Ref
+		ev.CommitSHA = p.After
+		ev.Deleted = p.Deleted
+		ev.Author = defaultIfEmpty(p.Pusher.Name, defaultIfEmpty(p.Pusher.Login, p.Pusher.Username))
+		ev.RepoURLs = compactStrings(p.Repository.CloneURL, p.Repository.SSHURL, p.Repository.HTMLURL)
+		head = p.HeadCommit
+		if head == nil {
+			head = findWebhookCommit(p.Commits, ev.CommitSHA)
+		}
+	}
+	if head != nil {
+		ev.Message = strings.TrimSpace(head.Message)
+		ev.Author = defaultIfEmpty(head.Author.Name, defaultIfEmpty(head.Author.Username, ev.Author))
+	}
+	if ev.CommitSHA == "" || zeroSHA.MatchString(ev.CommitSHA) {
+		ev.Deleted = true
+		ev.CommitSHA = ""
+	}
+	switch {
+	case strings.HasPrefix(ev.Ref, "refs/heads/"):
+		ev.Branch = strings.TrimPrefix(ev.Ref, "refs/heads/")
+	case strings.HasPrefix(ev.Ref, "refs/tags/"):
+		ev.Tag = strings.TrimPrefix(ev.Ref, "refs/tags/")
+	default:
+		return nil, fmt.Errorf("unsupported ref %q", ev.Ref)
+	}
+	if len(ev.RepoURLs) == 0 {
+		return nil, fmt.Errorf("push payload has no repository url")
+	}
+	return ev, nil
+}
+
+func findWebhookCommit(commits []webhookCommit, sha string) *webhookCommit {
+	for i := range commits {
+		if commits[i].ID == sha {
+			return &commits[i]
+		}
+	}
+	if len(commits) > 0 {
+		return &commits[len(commits)-1]
+	}
+	return nil
+}
+
+// verifyWebhookSignature 用 CI 配置的密钥验证投递。
+// GitHub 使用 X-Hub-Signature-256, Gitea 使用 X-Gitea-Signature (HMAC-SHA256),
+// GitLab 使用 X-Gitlab-Token 明文令牌。未配置密钥的 CI 配置不接受 webhook。
+func verifyWebhookSignature(provider string, header http.Header, body []byte, secret string) bool {
+	if secret == "" {
+		return false
+	}
+	if provider == webhookProviderGitLab {
+		token := header.Get("X-Gitlab-Token")
+		return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1
+	}
+	signature := strings.TrimPrefix(header.Get("X-Hub-Signature-256"), "sha256=")
+	if provider == webhookProviderGitea {
+		signature = defaultIfEmpty(header.Get("X-Gitea-Signature"), signature)
+	}
+	got, err := hex.DecodeString(strings.TrimSpace(signature))
+	if err != nil || len(got) == 0 {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// matchWebhookRef 判断推送的分支或 tag 是否匹配 CI 配置。
+// 分支按 Branch 匹配, tag 按 TagPattern 匹配, 均支持 path.Match 通配 (如 release/*、v*)。
+func matchWebhookRef(cfg *model.CICDServiceCIConfig, ev *webhookEvent) bool {
+	pattern, name := defaultIfEmpty(cfg.Branch, "main"), ev.Branch
+	if ev.Tag != "" {
+		pattern, name = cfg.TagPattern, ev.Tag
+	}
+	if strings.TrimSpace(pattern) == "" {
+		return false
+	}
+	ok, err := path.Match(strings.TrimSpace(pattern), name)
+	return err == nil && ok
+}
+
+// normalizeRepoURL 把 https、ssh 与 scp 形式的仓库地址归一为 host/path, 便于比较。
+func normalizeRepoURL(raw string) string {
+	s := strings.ToLower(strings.TrimSpace(raw))
+	if i := strings.Index(s, "://"); i >= 0 {
+		s = s[i+3:]
+	} else if at := strings.Index(s, "@"); at >= 0 && strings.Contains(s[at:], ":") {
+		s = strings.Replace(s[at+1:], ":", "/", 1)
+	}
+	host, rest, _ := strings.Cut(s, "/")
+	if at := strings.LastIndex(host, "@"); at >= 0 {
+		host = host[at+1:]
+	}
+	if i := strings.LastIndex(host, ":"); i >= 0 {
+		host = host[:i]
+	}
+	s = host
+	if rest != "" {
+		s += "/" + rest
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(s, "/"), ".git")
+}
+
+// webhookHeaders 保留用于重放和排查的请求头, 去掉 GitLab 明文令牌。
+func webhookHeaders(header http.Header) map[string]string {
+	out := map[string]string{}
+	for k := range header {
+		key := http.CanonicalHeaderKey(k)
+		if !strings.HasPrefix(key, "X-") && key != "Content-Type" && key != "User-Agent" && key != "Idempotency-Key" {
+			continue
+		}
+		if key == "X-Gitlab-Token" {
+			continue
+		}
+		out[key] = header.Get(k)
+	}
+	return out
+}
+
+func toWebhookDeliveryResp(row *model.CICDWebhookDelivery) *cicdv1.WebhookDeliveryResp {
+	return &cicdv1.WebhookDeliveryResp{
+		ID:                row.ID,
+		Provider:          row.Provider,
+		DeliveryID:        row.DeliveryID,
+		Event:             row.Event,
+		RepoURL:           row.RepoURL,
+		Ref:               row.Ref,
+		CommitSHA:         row.CommitSHA,
+		Author:            row.Author,
+		Status:            row.Status,
+		Detail:            row.Detail,
+		RunIDs:            parseUintSliceJSON(row.RunIDsJSON),
+		VerifiedConfigIDs: parseUintSliceJSON(row.VerifiedConfigIDsJSON),
+		ReplayOf:          row.ReplayOf,
+		ReplayedBy:        row.ReplayedBy,
+		CreatedAt:         row.CreatedAt,
+	}
+}
+
+func parseUintSliceJSON(raw string) []uint {
+	out := make([]uint, 0)
+	_ = json.Unmarshal([]byte(raw), &out)
+	return out
+}
+
+func compactStrings(values ...string) []string {
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			out = append(out, strings.TrimSpace(v))
+		}
+	}
+	return out
+}
+
+func truncateString(s string, n int) string {
+	if len([]rune(s)) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
@@ -0,0 +1,275 @@
+// Package pipeline 解析和校验服务仓库中的流水线定义 (.opspilot/pipeline.yaml)。
+//
+// 流水线由按顺序执行的阶段组成, 每个阶段是以下三种之一:
+//   - steps: 一组命令步骤, parallel 为 true 时并行执行, 步骤可指定容器镜像与环境变量
+//   - manual: 人工卡点, 审批通过后继续
+//   - deploy: 最后的部署阶段, 按 deployment_id/env/runtime_type 对应 CD 配置发起发布
+//
+// 阶段和步骤都可以用 when 按分支或 tag 过滤。
+package pipeline
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// FilePath 是流水线文件在仓库中的位置。
+	FilePath = ".opspilot/pipeline.yaml"
+	// MaxFileSize 是流水线文件的最大字节数。
+	MaxFileSize = 256 << 10
+
+	// Version 是当前支持的流水线格式版本。
+	Version = 1
+)
+
+var (
+	namePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+	envPattern  = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// Pipeline 是解析后的流水线定义。
+type Pipeline struct {
+	Version int               `yaml:"version" json:"version"`
+	Env     map[string]string `yaml:"env,omitempty" json:"env,omitempty"`
+	Stages  []Stage           `yaml:"stages" json:"stages"`
+}
+
+// Stage 是流水线中的一个阶段, Steps、Manual、Deploy 必须且只能设置一个。
+type Stage struct {
+	Name     string     `yaml:"name" json:"name"`
+	When     *Condition `yaml:"when,omitempty" json:"when,omitempty"`
+	Parallel bool       `yaml:"parallel,omitempty" json:"parallel,omitempty"`
+	Steps    []Step     `yaml:"steps,omitempty" json:"steps,omitempty"`
+	Manual   *Manual    `yaml:"manual,omitempty" json:"manual,omitempty"`
+	Deploy   *Deploy    `yaml:"deploy,omitempty" json:"deploy,omitempty"`
+}
+
+// Step 是一个命令步骤, 在源码目录中执行; 指定 Image 时在该镜像的容器中执行。
+type Step struct {
+	Name    string            `yaml:"name" json:"name"`
+	Image   string            `yaml:"image,omitempty" json:"image,omitempty"`
+	Run     string            `yaml:"run" json:"run"`
+	Env     map[string]string `yaml:"env,omitempty" json:"env,omitempty"`
+	When    *Condition        `yaml:"when,omitempty" json:"when,omitempty"`
+	Timeout string            `yaml:"timeout,omitempty" json:"timeout,omitempty"` // 如 10m, 为空时使用 cicd.step_timeout
+}
+
+// Manual 是人工卡点, 运行在此等待审批。
+type Manual struct {
+	Message string `yaml:"message,omitempty" json:"message,omitempty"`
+}
+
+// Deploy 描述部署阶段, 对应 (DeploymentID, Env, RuntimeType) 的 CD 配置。
+type Deploy struct {
+	DeploymentID uint   `yaml:"deployment_id" json:"deployment_id"`
+	Env          string `yaml:"env" json:"env"`
+	RuntimeType  string `yaml:"runtime_type,omitempty" json:"runtime_type,omitempty"`
+}
+
+// Condition 按分支或 tag 过滤阶段和步骤, 模式使用 path.Match 语法 (如 release/*、v*)。
+// 只配置 Branches 时 tag 运行不满足条件, 反之亦然。
+type Condition struct {
+	Branches []string `yaml:"branches,omitempty" json:"branches,omitempty"`
+	Tags     []string `yaml:"tags,omitempty" json:"tags,omitempty"`
+}
+
+// Ref 是触发运行的分支或 tag。
+type Ref struct {
+	Name string
+	Tag  bool
+}
+
+func (r Ref) String() string {
+	if r.Tag {
+		return "tag " + r.Name
+	}
+	return "branch " + r.Name
+}
+
+// Match 判断 ref 是否满足条件, 未设置条件时总是满足。
+func (c *Condition) Match(ref Ref) bool {
+	if c == nil || (len(c.Branches) == 0 && len(c.Tags) == 0) {
+		return true
+	}
+	patterns := c.Branches
+	if ref.Tag {
+		patterns = c.Tags
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, ref.Name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// StepTimeout 返回步骤超时, 未设置时返回 0。
+func (s Step) StepTimeout() time.Duration {
+	d, _ := time.ParseDuration(s.Timeout)
+	return d
+}
+
+// ValidationError 汇总流水线中的全部问题, 每条问题带有所在位置。
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid pipeline: " + strings.Join(e.Problems, "; ")
+}
+
+// Parse 解析并校验流水线定义, 未知字段和校验失败均返回 *ValidationError。
+func Parse(raw []byte) (*Pipeline, error) {
+	if len(raw) > MaxFileSize {
+		return nil, &ValidationError{Problems: []string{fmt.Sprintf("file exceeds %d bytes", MaxFileSize)}}
+	}
+	var p Pipeline
+	dec := yaml.NewDecoder(bytes.NewReader(raw))
+	dec.KnownFields(true)
+	if err := dec.Decode(&p); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, &ValidationError{Problems: []string{"file is empty"}}
+		}
+		return nil, &ValidationError{Problems: []string{err.Error()}}
+	}
+	if p.Version == 0 {
+		p.Version = Version
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Validate 校验流水线结构, 返回 *ValidationError 或 nil。
+func (p *Pipeline) Validate() error {
+	var problems []string
+	add := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	if p.Version != Version {
+		add("version: unsupported version %d, expected %d", p.Version, Version)
+	}
+	validateEnv("env", p.Env, add)
+	if len(p.Stages) == 0 {
+		add("stages: at least one stage is required")
+	}
+	stageNames := make(map[string]bool, len(p.Stages))
+	for i, stage := range p.Stages {
+		at := fmt.Sprintf("stages[%d]", i)
+		if stage.Name != "" {
+			at = fmt.Sprintf("stages[%d] (%s)", i, stage.Name)
+		}
+		switch {
+		case stage.Name == "":
+			add("%s: name is required", at)
+		case !namePattern.MatchString(stage.Name):
+			add("%s: name must match %s", at, namePattern)
+		case stageNames[stage.Name]:
+			add("%s: duplicate stage name", at)
+		}
+		stageNames[stage.Name] = true
+		validateCondition(at+".when", stage.When, add)
+
+		kinds := 0
+		if len(stage.Steps) > 0 {
+			kinds++
+		}
+		if stage.Manual != nil {
+			kinds++
+		}
+		if stage.Deploy != nil {
+			kinds++
+		}
+		if kinds != 1 {
+			add("%s: exactly one of steps, manual or deploy is required", at)
+		}
+		if stage.Parallel && len(stage.Steps) == 0 {
+			add("%s: parallel requires steps", at)
+		}
+		if stage.Deploy != nil {
+			validateDeploy(at+".deploy", stage.Deploy, add)
+			if i != len(p.Stages)-1 {
+				add("%s: deploy stage must be the last stage", at)
+			}
+		}
+		stepNames := make(map[string]bool, len(stage.Steps))
+		for j, step := range stage.Steps {
+			sat := fmt.Sprintf("%s.steps[%d]", at, j)
+			if step.Name != "" {
+				sat = fmt.Sprintf("%s.steps[%d] (%s)", at, j, step.Name)
+			}
+			switch {
+			case step.Name == "":
+				add("%s: name is required", sat)
+			case !namePattern.MatchString(step.Name):
+				add("%s: name must match %s", sat, namePattern)
+			case stepNames[step.Name]:
+				add("%s: duplicate step name in stage", sat)
+			}
+			stepNames[step.Name] = true
+			if strings.TrimSpace(step.Run) == "" {
+				add("%s: run is required", sat)
+			}
+			if strings.ContainsAny(step.Image, " \t\n'\"") {
+				add("%s: image %q is not a valid image reference", sat, step.Image)
+			}
+			if step.Timeout != "" {
+				if d, err := time.ParseDuration(step.Timeout); err != nil || d <= 0 {
+					add("%s: timeout %q must be a positive duration such as 10m", sat, step.Timeout)
+				}
+			}
+			validateEnv(sat+".env", step.Env, add)
+			validateCondition(sat+".when", step.When, add)
+		}
+	}
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+func validateEnv(at string, env map[string]string, add func(string, ...any)) {
+	for key := range env {
+		switch {
+		case !envPattern.MatchString(key):
+			add("%s: %q is not a valid variable name", at, key)
+		case strings.HasPrefix(key, "OPSPILOT_"):
+			add("%s: %q uses the reserved OPSPILOT_ prefix", at, key)
+		}
+	}
+}
+
+func validateCondition(at string, c *Condition, add func(string, ...any)) {
+	if c == nil {
+		return
+	}
+	for _, pattern := range append(append([]string{}, c.Branches...), c.Tags...) {
+		if _, err := path.Match(pattern, ""); err != nil || strings.TrimSpace(pattern) == "" {
+			add("%s: invalid pattern %q", at, pattern)
+		}
+	}
+}
+
+func validateDeploy(at string, d *Deploy, add func(string, ...any)) {
+	if d.DeploymentID == 0 {
+		add("%s: deployment_id is required", at)
+	}
+	if strings.TrimSpace(d.Env) == "" {
+		add("%s: env is required", at)
+	}
+	switch d.RuntimeType {
+	case "", "k8s", "compose":
+	default:
+		add("%s: runtime_type must be k8s or compose", at)
+	}
+}
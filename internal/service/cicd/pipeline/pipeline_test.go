@@ -0,0 +1,126 @@
+package pipeline
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	p, err := Parse([]byte(`
+env:
+  GOFLAGS: -mod=mod
+stages:
+  - name: test
+    parallel: true
+    steps:
+      - name: unit
+        image: golang:1.22
+        run: go test ./...
+        timeout: 10m
+      - name: lint
+        run: make lint
+  - name: approve
+    when:
+      branches: [main]
+    manual:
+      message: deploy to production?
+  - name: prod
+    deploy:
+      deployment_id: 3
+      env: production
+`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if p.Version != Version || len(p.Stages) != 3 || !p.Stages[0].Parallel || p.Stages[0].Steps[0].StepTimeout().Minutes() != 10 {
+		t.Fatalf("unexpected pipeline %+v", p)
+	}
+	if d := p.Stages[2].Deploy; d == nil || d.DeploymentID != 3 || d.Env != "production" {
+		t.Fatalf("unexpected deploy stage %+v", p.Stages[2])
+	}
+}
+
+func TestParseReportsAllProblems(t *testing.T) {
+	_, err := Parse([]byte(`
+version: 2
+env:
+  OPSPILOT_RUN_ID: "1"
+stages:
+  - name: prod
+    deploy:
+      env: production
+      runtime_type: vm
+  - name: build
+    steps:
+      - name: b
+        run: make
+        image: "bad image"
+        timeout: soon
+      - name: b
+        run: ""
+    manual: {}
+  - name: build
+    when:
+      tags: ["[v"]
+    steps:
+      - name: c
+        run: make
+`))
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+	want := []string{
+		"version: unsupported version 2",
+		`env: "OPSPILOT_RUN_ID" uses the reserved OPSPILOT_ prefix`,
+		"stages[0] (prod).deploy: deployment_id is required",
+		"stages[0] (prod).deploy: runtime_type must be k8s or compose",
+		"stages[0] (prod): deploy stage must be the last stage",
+		"stages[1] (build): exactly one of steps, manual or deploy is required",
+		`stages[1] (build).steps[0] (b): image "bad image" is not a valid image reference`,
+		`stages[1] (build).steps[0] (b): timeout "soon" must be a positive duration`,
+		"stages[1] (build).steps[1] (b): duplicate step name in stage",
+		"stages[1] (build).steps[1] (b): run is required",
+		"stages[2] (build): duplicate stage name",
+		`stages[2] (build).when: invalid pattern "[v"`,
+	}
+	msg := err.Error()
+	for _, problem := range want {
+		if !strings.Contains(msg, problem) {
+			t.Errorf("expected problem %q in %s", problem, msg)
+		}
+	}
+
+	if _, err := Parse([]byte("stages:\n  - name: a\n    step: []\n")); err == nil || !strings.Contains(err.Error(), "field step not found") {
+		t.Fatalf("expected unknown field to be rejected, got %v", err)
+	}
+	if _, err := Parse(nil); err == nil || !strings.Contains(err.Error(), "file is empty") {
+		t.Fatalf("expected empty file to be rejected, got %v", err)
+	}
+}
+
+func TestConditionMatch(t *testing.T) {
+	c := &Condition{Branches: []string{"main", "release/*"}, Tags: []string{"v*"}}
+	cases := []struct {
+		ref  Ref
+		want bool
+	}{
+		{Ref{Name: "main"}, true},
+		{Ref{Name: "release/1.2"}, true},
+		{Ref{Name: "feature/x"}, false},
+		{Ref{Name: "v1.0.0", Tag: true}, true},
+		{Ref{Name: "main", Tag: true}, false},
+	}
+	for _, tc := range cases {
+		if got := c.Match(tc.ref); got != tc.want {
+			t.Errorf("match %s: expected %v, got %v", tc.ref, tc.want, got)
+		}
+	}
+	if !(*Condition)(nil).Match(Ref{Name: "any"}) {
+		t.Fatal("expected nil condition to match")
+	}
+	if (&Condition{Branches: []string{"main"}}).Match(Ref{Name: "v1", Tag: true}) {
+		t.Fatal("expected branch-only condition not to match tags")
+	}
+}
@@ -2,6 +2,8 @@ package repo
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/cy77cc/OpsPilot/internal/model"
 	"gorm.io/gorm"
@@ -31,6 +33,10 @@ func (r *Repository) UpsertServiceCIConfig(ctx context.Context, in model.CICDSer
 		existing.Branch = in.Branch
 		existing.BuildStepsJSON = in.BuildStepsJSON
 		existing.ArtifactTarget = in.ArtifactTarget
+		existing.TagPattern = in.TagPattern
+		if in.WebhookSecret != "" {
+			existing.WebhookSecret = in.WebhookSecret
+		}
 		existing.TriggerMode = in.TriggerMode
 		existing.Status = in.Status
 		existing.UpdatedBy = in.UpdatedBy
@@ -93,6 +99,10 @@ func (r *Repository) UpsertDeploymentCDConfig(ctx context.Context, in model.CICD
 		existing.RuntimeType = in.RuntimeType
 		existing.StrategyConfigJSON = in.StrategyConfigJSON
 		existing.ApprovalRequired = in.ApprovalRequired
+		existing.ServiceID = in.ServiceID
+		existing.AutoDeploy = in.AutoDeploy
+		existing.AutoDeployBranchesJSON = in.AutoDeployBranchesJSON
+		existing.AutoDeployTagsJSON = in.AutoDeployTagsJSON
 		existing.UpdatedBy = in.UpdatedBy
 		if uerr := r.db.WithContext(ctx).Save(&existing).Error; uerr != nil {
 			return nil, uerr
@@ -108,6 +118,13 @@ func (r *Repository) UpsertDeploymentCDConfig(ctx context.Context, in model.CICD
 	return &in, nil
 }
 
+// ListAutoDeployCDConfigs 返回服务开启了自动发布的 CD 配置。
+func (r *Repository) ListAutoDeployCDConfigs(ctx context.Context, serviceID uint) ([]model.CICDDeploymentCDConfig, error) {
+	rows := make([]model.CICDDeploymentCDConfig, 0, 4)
+	err := r.db.WithContext(ctx).Where("service_id = ? AND auto_deploy = ?", serviceID, true).Order("id ASC").Find(&rows).Error
+	return rows, err
+}
+
 func (r *Repository) CreateRelease(ctx context.Context, in model.CICDRelease) (*model.CICDRelease, error) {
 	if err := r.db.WithContext(ctx).Create(&in).Error; err != nil {
 		return nil, err
@@ -198,3 +215,270 @@ func (r *Repository) ListAuditEvents(ctx context.Context, serviceID uint, traceI
 	}
 	return rows, nil
 }
+
+func (r *Repository) GetCIRun(ctx context.Context, id uint) (*model.CICDServiceCIRun, error) {
+	var row model.CICDServiceCIRun
+	if err := r.db.WithContext(ctx).First(&row, id).Error; err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+func (r *Repository) SaveCIRun(ctx context.Context, row *model.CICDServiceCIRun) error {
+	return r.db.WithContext(ctx).Save(row).Error
+}
+
+// ClaimQueuedCIRun 把最早排队的运行置为 running 并返回; 没有可领取的运行时返回 nil。
+// 以 status 作为条件更新, 多个 worker 并发领取时只有一个会成功。
+func (r *Repository) ClaimQueuedCIRun(ctx context.Context, now time.Time) (*model.CICDServiceCIRun, error) {
+	for attempt := 0; attempt < 3; attempt++ {
+		var row model.CICDServiceCIRun
+		err := r.db.WithContext(ctx).Where("status = ?", "queued").Order("id ASC").First(&row).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		res := r.db.WithContext(ctx).Model(&model.CICDServiceCIRun{}).
+			Where("id = ? AND status = ?", row.ID, "queued").
+			Updates(map[string]any{"status": "running", "started_at": gorm.Expr("COALESCE(started_at, ?)", now), "heartbeat_at": now})
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		if res.RowsAffected == 1 {
+			return r.GetCIRun(ctx, row.ID)
+		}
+	}
+	return nil, nil
+}
+
+func (r *Repository) TouchCIRunHeartbeat(ctx context.Context, id uint, now time.Time) error {
+	return r.db.WithContext(ctx).Model(&model.CICDServiceCIRun{}).Where("id = ? AND status = ?", id, "running").Update("heartbeat_at", now).Error
+}
+
+// ParkCIRun 以 running 为条件把运行挂起为 waiting, 返回是否挂起成功。挂起时间记入 heartbeat_at。
+func (r *Repository) ParkCIRun(ctx context.Context, id uint, now time.Time) (bool, error) {
+	res := r.db.WithContext(ctx).Model(&model.CICDServiceCIRun{}).
+		Where("id = ? AND status = ?", id, "running").
+		Updates(map[string]any{"status": "waiting", "heartbeat_at": now})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
+
+// RequeueCIRun 以 waiting 为条件把挂起的运行重新排队, 返回是否由本次调用完成。
+func (r *Repository) RequeueCIRun(ctx context.Context, id uint) (bool, error) {
+	res := r.db.WithContext(ctx).Model(&model.CICDServiceCIRun{}).
+		Where("id = ? AND status = ?", id, "waiting").
+		Update("status", "queued")
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
+
+// ListExpiredWaitingCIRuns 返回挂起时间早于 before 的 waiting 运行。
+func (r *Repository) ListExpiredWaitingCIRuns(ctx context.Context, before time.Time) ([]model.CICDServiceCIRun, error) {
+	rows := make([]model.CICDServiceCIRun, 0)
+	if err := r.db.WithContext(ctx).Where("status = ? AND heartbeat_at < ?", "waiting", before).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// ListStaleCIRuns 返回心跳早于 before 的 running 运行。
+func (r *Repository) ListStaleCIRuns(ctx context.Context, before time.Time) ([]model.CICDServiceCIRun, error) {
+	rows := make([]model.CICDServiceCIRun, 0)
+	if err := r.db.WithContext(ctx).Where("status = ? AND (heartbeat_at IS NULL OR heartbeat_at < ?)", "running", before).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func (r *Repository) CreateCIRunSteps(ctx context.Context, steps []model.CICDServiceCIRunStep) ([]model.CICDServiceCIRunStep, error) {
+	if len(steps) == 0 {
+		return steps, nil
+	}
+	if err := r.db.WithContext(ctx).Create(&steps).Error; err != nil {
+		return nil, err
+	}
+	return steps, nil
+}
+
+func (r *Repository) SaveCIRunStep(ctx context.Context, row *model.CICDServiceCIRunStep) error {
+	return r.db.WithContext(ctx).Save(row).Error
+}
+
+func (r *Repository) GetCIRunStep(ctx context.Context, runID, id uint) (*model.CICDServiceCIRunStep, error) {
+	var row model.CICDServiceCIRunStep
+	if err := r.db.WithContext(ctx).Where("id = ? AND run_id = ?", id, runID).First(&row).Error; err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+// DecideCIRunStep 以 waiting 为条件结束人工卡点, 返回是否由本次调用完成审批。
+func (r *Repository) DecideCIRunStep(ctx context.Context, runID, id uint, status string, uid uint, log string, now time.Time) (bool, error) {
+	res := r.db.WithContext(ctx).Model(&model.CICDServiceCIRunStep{}).
+		Where("id = ? AND run_id = ? AND kind = ? AND status = ?", id, runID, "manual", "waiting").
+		Updates(map[string]any{"status": status, "approved_by": uid, "log": log, "finished_at": now})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
+
+func (r *Repository) ListCIRunSteps(ctx context.Context, runID uint) ([]model.CICDServiceCIRunStep, error) {
+	rows := make([]model.CICDServiceCIRunStep, 0)
+	if err := r.db.WithContext(ctx).Where("run_id = ?", runID).Order("seq ASC, id ASC").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func (r *Repository) ListActiveCIConfigs(ctx context.Context) ([]model.CICDServiceCIConfig, error) {
+	rows := make([]model.CICDServiceCIConfig, 0)
+	if err := r.db.WithContext(ctx).Where("status = ?", "active").Order("id ASC").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func (r *Repository) CreateWebhookDelivery(ctx context.Context, row *model.CICDWebhookDelivery) error {
+	return r.db.WithContext(ctx).Create(row).Error
+}
+
+func (r *Repository) SaveWebhookDelivery(ctx context.Context, row *model.CICDWebhookDelivery) error {
+	return r.db.WithContext(ctx).Save(row).Error
+}
+
+func (r *Repository) GetWebhookDelivery(ctx context.Context, id uint) (*model.CICDWebhookDelivery, error) {
+	var row model.CICDWebhookDelivery
+	if err := r.db.WithContext(ctx).First(&row, id).Error; err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+// ClaimWebhookDelivery 以唯一的 claim_key 占用投递 ID, 并发的重复投递只有一条能写入成功。
+// 投递 ID 已被其他记录占用时返回该记录, 占用成功时返回 nil。
+func (r *Repository) ClaimWebhookDelivery(ctx context.Context, row *model.CICDWebhookDelivery) (*model.CICDWebhookDelivery, error) {
+	key := row.Provider + ":" + row.DeliveryID
+	err := r.db.WithContext(ctx).Model(&model.CICDWebhookDelivery{}).Where("id = ?", row.ID).Update("claim_key", key).Error
+	if err == nil {
+		row.ClaimKey = &key
+		return nil, nil
+	}
+	var holder model.CICDWebhookDelivery
+	if ferr := r.db.WithContext(ctx).Where("claim_key = ? AND id <> ?", key, row.ID).First(&holder).Error; ferr == nil {
+		return &holder, nil
+	}
+	return nil, err
+}
+
+// ReleaseWebhookDeliveryClaim 释放处理失败的投递占用的投递 ID, 使 Git 服务器的重新投递可以再次处理。
+func (r *Repository) ReleaseWebhookDeliveryClaim(ctx context.Context, row *model.CICDWebhookDelivery) error {
+	row.ClaimKey = nil
+	return r.db.WithContext(ctx).Model(&model.CICDWebhookDelivery{}).Where("id = ?", row.ID).Update("claim_key", nil).Error
+}
+
+func (r *Repository) ListWebhookDeliveries(ctx context.Context, provider, status string, limit int) ([]model.CICDWebhookDelivery, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	q := r.db.WithContext(ctx).Model(&model.CICDWebhookDelivery{}).Omit("payload", "headers_json")
+	if provider != "" {
+		q = q.Where("provider = ?", provider)
+	}
+	if status != "" {
+		q = q.Where("status = ?", status)
+	}
+	rows := make([]model.CICDWebhookDelivery, 0)
+	if err := q.Order("id DESC").Limit(limit).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func (r *Repository) CreateArtifact(ctx context.Context, row *model.CICDArtifact) error {
+	return r.db.WithContext(ctx).Create(row).Error
+}
+
+func (r *Repository) GetArtifact(ctx context.Context, id uint) (*model.CICDArtifact, error) {
+	var row model.CICDArtifact
+	if err := r.db.WithContext(ctx).First(&row, id).Error; err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+func (r *Repository) GetArtifactByRun(ctx context.Context, runID uint) (*model.CICDArtifact, error) {
+	var row model.CICDArtifact
+	if err := r.db.WithContext(ctx).Where("ci_run_id = ?", runID).First(&row).Error; err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+// ListArtifacts 返回服务的制品, 新的在前; limit 为 0 时默认 100 条, 负数不限制。
+func (r *Repository) ListArtifacts(ctx context.Context, serviceID uint, status string, limit int) ([]model.CICDArtifact, error) {
+	if limit == 0 {
+		limit = 100
+	}
+	q := r.db.WithContext(ctx).Model(&model.CICDArtifact{}).Omit("metadata_json").Where("service_id = ?", serviceID)
+	if status != "" {
+		q = q.Where("status = ?", status)
+	}
+	rows := make([]model.CICDArtifact, 0)
+	if err := q.Order("id DESC").Limit(limit).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// ListArtifactsBetween 返回服务在 (afterID, toID] 区间内构建的制品, 新的在前。
+func (r *Repository) ListArtifactsBetween(ctx context.Context, serviceID, afterID, toID uint) ([]model.CICDArtifact, error) {
+	rows := make([]model.CICDArtifact, 0)
+	if err := r.db.WithContext(ctx).Omit("metadata_json").
+		Where("service_id = ? AND id > ? AND id <= ?", serviceID, afterID, toID).
+		Order("id DESC").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func (r *Repository) ListArtifactServiceIDs(ctx context.Context) ([]uint, error) {
+	ids := make([]uint, 0)
+	if err := r.db.WithContext(ctx).Model(&model.CICDArtifact{}).Where("status = ?", "active").
+		Distinct().Order("service_id ASC").Pluck("service_id", &ids).Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// ListReferencedArtifactIDs 返回被任一发布记录引用的制品 ID。
+func (r *Repository) ListReferencedArtifactIDs(ctx context.Context, ids []uint) (map[uint]bool, error) {
+	out := make(map[uint]bool, len(ids))
+	if len(ids) == 0 {
+		return out, nil
+	}
+	var refs []uint
+	if err := r.db.WithContext(ctx).Model(&model.DeploymentRelease{}).Where("artifact_id IN ?", ids).
+		Distinct().Pluck("artifact_id", &refs).Error; err != nil {
+		return nil, err
+	}
+	for _, id := range refs {
+		out[id] = true
+	}
+	return out, nil
+}
+
+func (r *Repository) ExpireArtifacts(ctx context.Context, ids []uint, at time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).Model(&model.CICDArtifact{}).Where("id IN ? AND status = ?", ids, "active").
+		Updates(map[string]any{"status": "expired", "expired_at": at}).Error
+}
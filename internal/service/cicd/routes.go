@@ -2,7 +2,10 @@
 //
 // 本文件注册 CI/CD 相关的 HTTP 路由，包括：
 //   - CI 配置管理
-//   - CI 运行触发和查询
+//   - CI 运行触发和查询、步骤日志、实时日志流
+//   - 仓库流水线定义的查看与校验、人工卡点审批
+//   - Git webhook 接收、投递记录与重放
+//   - 构建制品查询与发布变更范围
 //   - CD 配置管理
 //   - 发布管理和审批
 //   - 服务时间线
@@ -18,6 +21,11 @@ import (
 // RegisterCICDHandlers 注册 CI/CD 服务路由到 v1 组。
 func RegisterCICDHandlers(v1 *gin.RouterGroup, svcCtx *svc.ServiceContext) {
 	h := NewHandler(svcCtx)
+	h.StartCIExecutor()
+
+	// Git 服务器 webhook, 由签名认证 (no JWT)。
+	v1.POST("/cicd/webhooks/:provider", h.ReceiveWebhook)
+
 	g := v1.Group("/cicd", middleware.JWTAuth())
 	{
 		g.GET("/services/:service_id/ci-config", h.GetServiceCIConfig)
@@ -25,6 +33,17 @@ func RegisterCICDHandlers(v1 *gin.RouterGroup, svcCtx *svc.ServiceContext) {
 		g.DELETE("/services/:service_id/ci-config", h.DeleteServiceCIConfig)
 		g.POST("/services/:service_id/ci-runs/trigger", h.TriggerCIRun)
 		g.GET("/services/:service_id/ci-runs", h.ListCIRuns)
+		g.GET("/ci-runs/:id/steps", h.ListCIRunSteps)
+		g.GET("/ci-runs/:id/logs/stream", h.StreamCIRunLogs)
+		g.GET("/ci-runs/:id/pipeline", h.GetCIRunPipeline)
+		g.POST("/ci-runs/:id/steps/:step_id/approve", h.ApproveCIGate)
+		g.POST("/ci-runs/:id/steps/:step_id/reject", h.RejectCIGate)
+		g.POST("/pipelines/validate", h.ValidatePipeline)
+		g.GET("/webhook-deliveries", h.ListWebhookDeliveries)
+		g.GET("/webhook-deliveries/:id", h.GetWebhookDelivery)
+		g.POST("/webhook-deliveries/:id/replay", h.ReplayWebhookDelivery)
+		g.GET("/services/:service_id/artifacts", h.ListArtifacts)
+		g.GET("/artifacts/:id", h.GetArtifact)
 
 		g.GET("/deployments/:deployment_id/cd-config", h.GetDeploymentCDConfig)
 		g.PUT("/deployments/:deployment_id/cd-config", h.PutDeploymentCDConfig)
@@ -35,6 +54,7 @@ func RegisterCICDHandlers(v1 *gin.RouterGroup, svcCtx *svc.ServiceContext) {
 		g.POST("/releases/:id/reject", h.RejectRelease)
 		g.POST("/releases/:id/rollback", h.RollbackRelease)
 		g.GET("/releases/:id/approvals", h.ListApprovals)
+		g.GET("/releases/:id/changes", h.ReleaseChanges)
 
 		g.GET("/services/:service_id/timeline", h.ServiceTimeline)
 		g.GET("/audits", h.ListAuditEvents)
@@ -6,6 +6,10 @@ type UpsertServiceCIConfigReq = cicdv1.UpsertServiceCIConfigReq
 
 type TriggerCIRunReq = cicdv1.TriggerCIRunReq
 
+type ValidatePipelineReq = cicdv1.ValidatePipelineReq
+
+type CIGateDecisionReq = cicdv1.CIGateDecisionReq
+
 type UpsertDeploymentCDConfigReq = cicdv1.UpsertDeploymentCDConfigReq
 
 type TriggerReleaseReq = cicdv1.TriggerReleaseReq
@@ -0,0 +1,527 @@
+// Package admission 实现清单准入策略: 在发布应用前检查渲染后的 k8s / compose 清单。
+//
+// 策略以 policies 表中 type=admission 的记录保存, config 描述作用域、模式与规则:
+//
+//	{"mode": "enforce", "project_id": 3, "env": "production",
+//	 "rules": [{"type": "disallow_latest_tag"}, {"type": "allowed_registries", "registries": ["registry.local"]}]}
+//
+// warn 模式只报告违规, enforce 模式的违规会阻止发布。该包供发布流程与服务渲染预览共用。
+package admission
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/cy77cc/OpsPilot/internal/model"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+const (
+	ModeWarn    = "warn"
+	ModeEnforce = "enforce"
+
+	RuleNoPrivileged          = "no_privileged"
+	RuleRequireResourceLimits = "require_resource_limits"
+	RuleDisallowLatestTag     = "disallow_latest_tag"
+	RuleAllowedRegistries     = "allowed_registries"
+	RuleRequiredLabels        = "required_labels"
+)
+
+// Rule 是一条声明式检查规则, Mode 为空时继承策略的模式。
+type Rule struct {
+	Type       string   `json:"type"`
+	Mode       string   `json:"mode,omitempty"`
+	Registries []string `json:"registries,omitempty"`
+	Labels     []string `json:"labels,omitempty"`
+}
+
+// Policy 是解析后的准入策略。
+type Policy struct {
+	ID        uint   `json:"id"`
+	Name      string `json:"name"`
+	Mode      string `json:"mode"`
+	ProjectID uint   `json:"project_id,omitempty"`
+	Env       string `json:"env,omitempty"`
+	TargetID  uint   `json:"target_id,omitempty"`
+	Rules     []Rule `json:"rules"`
+}
+
+// Scope 描述被检查清单所属的项目、环境与目标。
+type Scope struct {
+	ProjectID uint
+	Env       string
+	TargetID  uint
+}
+
+// Violation 是一条违规记录。
+type Violation struct {
+	PolicyID   uint   `json:"policy_id"`
+	PolicyName string `json:"policy_name"`
+	Rule       string `json:"rule"`
+	Mode       string `json:"mode"`
+	Object     string `json:"object"`
+	Container  string `json:"container,omitempty"`
+	Message    string `json:"message"`
+}
+
+// String 返回便于展示的违规说明。
+func (v Violation) String() string {
+	where := v.Object
+	if v.Container != "" {
+		where += "/" + v.Container
+	}
+	return fmt.Sprintf("[%s] %s: %s (policy %s)", v.Rule, where, v.Message, v.PolicyName)
+}
+
+// Result 是一次检查的全部违规。
+type Result struct {
+	Violations []Violation `json:"violations"`
+}
+
+// Enforced 返回 enforce 模式的违规。
+func (r Result) Enforced() []Violation {
+	out := make([]Violation, 0)
+	for _, v := range r.Violations {
+		if v.Mode == ModeEnforce {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// Blocked 判断是否存在阻止发布的违规。
+func (r Result) Blocked() bool { return len(r.Enforced()) > 0 }
+
+// Summary 汇总 enforce 违规, 用于错误信息。
+func (r Result) Summary() string {
+	enforced := r.Enforced()
+	parts := make([]string, 0, len(enforced))
+	for _, v := range enforced {
+		parts = append(parts, v.String())
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Validate 校验 admission 策略的 config。
+func Validate(config map[string]any) error {
+	_, err := parseConfig(config)
+	return err
+}
+
+// Parse 把 policies 表记录解析为准入策略。
+func Parse(p model.Policy) (Policy, error) {
+	out, err := parseConfig(p.Config)
+	if err != nil {
+		return Policy{}, err
+	}
+	out.ID = p.ID
+	out.Name = p.Name
+	if p.TargetID > 0 {
+		out.TargetID = p.TargetID
+	}
+	return out, nil
+}
+
+func parseConfig(config map[string]any) (Policy, error) {
+	var p Policy
+	p.Mode = strings.ToLower(strings.TrimSpace(stringValue(config["mode"])))
+	if p.Mode == "" {
+		p.Mode = ModeWarn
+	}
+	if p.Mode != ModeWarn && p.Mode != ModeEnforce {
+		return Policy{}, fmt.Errorf("mode must be one of: warn, enforce")
+	}
+	p.Env = strings.ToLower(strings.TrimSpace(stringValue(config["env"])))
+	p.ProjectID = uintValue(config["project_id"])
+	p.TargetID = uintValue(config["target_id"])
+	raw, ok := config["rules"].([]any)
+	if !ok || len(raw) == 0 {
+		return Policy{}, fmt.Errorf("rules must be a non-empty list")
+	}
+	for i, item := range raw {
+		m, ok := item.(map[string]any)
+		if !ok {
+			return Policy{}, fmt.Errorf("rules[%d] must be an object", i)
+		}
+		rule := Rule{
+			Type:       strings.ToLower(strings.TrimSpace(stringValue(m["type"]))),
+			Mode:       strings.ToLower(strings.TrimSpace(stringValue(m["mode"]))),
+			Registries: stringList(m["registries"]),
+			Labels:     stringList(m["labels"]),
+		}
+		if rule.Mode != "" && rule.Mode != ModeWarn && rule.Mode != ModeEnforce {
+			return Policy{}, fmt.Errorf("rules[%d].mode must be one of: warn, enforce", i)
+		}
+		switch rule.Type {
+		case RuleNoPrivileged, RuleRequireResourceLimits, RuleDisallowLatestTag:
+		case RuleAllowedRegistries:
+			if len(rule.Registries) == 0 {
+				return Policy{}, fmt.Errorf("rules[%d].registries is required for allowed_registries", i)
+			}
+		case RuleRequiredLabels:
+			if len(rule.Labels) == 0 {
+				return Policy{}, fmt.Errorf("rules[%d].labels is required for required_labels", i)
+			}
+		default:
+			return Policy{}, fmt.Errorf("rules[%d].type %q is not supported", i, rule.Type)
+		}
+		p.Rules = append(p.Rules, rule)
+	}
+	return p, nil
+}
+
+// Applies 判断策略是否作用于给定范围, 未设置的维度匹配全部。
+func (p Policy) Applies(scope Scope) bool {
+	if p.ProjectID > 0 && p.ProjectID != scope.ProjectID {
+		return false
+	}
+	if p.Env != "" && p.Env != strings.ToLower(strings.TrimSpace(scope.Env)) {
+		return false
+	}
+	if p.TargetID > 0 && p.TargetID != scope.TargetID {
+		return false
+	}
+	return true
+}
+
+// Load 读取作用于 scope 的已启用准入策略。无法解析的策略会被跳过。
+func Load(ctx context.Context, db *gorm.DB, scope Scope) ([]Policy, error) {
+	var rows []model.Policy
+	if err := db.WithContext(ctx).
+		Where("type = ? AND enabled = ?", model.PolicyTypeAdmission, true).
+		Order("id ASC").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	out := make([]Policy, 0, len(rows))
+	for _, row := range rows {
+		p, err := Parse(row)
+		if err != nil || !p.Applies(scope) {
+			continue
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// Check 读取作用域内的策略并检查清单。
+func Check(ctx context.Context, db *gorm.DB, scope Scope, manifest string) (Result, error) {
+	policies, err := Load(ctx, db, scope)
+	if err != nil {
+		return Result{}, err
+	}
+	return Evaluate(manifest, policies)
+}
+
+// Evaluate 用给定策略检查清单。清单可以是多文档 k8s YAML 或 docker compose 文件。
+func Evaluate(manifest string, policies []Policy) (Result, error) {
+	res := Result{Violations: []Violation{}}
+	if len(policies) == 0 {
+		return res, nil
+	}
+	workloads, err := extractWorkloads(manifest)
+	if err != nil {
+		return res, err
+	}
+	for _, p := range policies {
+		for _, rule := range p.Rules {
+			mode := rule.Mode
+			if mode == "" {
+				mode = p.Mode
+			}
+			for _, w := range workloads {
+				for _, finding := range checkRule(rule, w) {
+					res.Violations = append(res.Violations, Violation{
+						PolicyID: p.ID, PolicyName: p.Name, Rule: rule.Type, Mode: mode,
+						Object: w.Object, Container: finding.container, Message: finding.message,
+					})
+				}
+			}
+		}
+	}
+	return res, nil
+}
+
+// workload 是从清单中抽取的可检查单元: k8s 工作负载或 compose 服务。
+type workload struct {
+	Object     string
+	Labels     map[string]string
+	Containers []container
+}
+
+type container struct {
+	Name          string
+	Image         string
+	Privileged    bool
+	LimitCPU      bool
+	LimitMemory   bool
+	InitContainer bool
+}
+
+type finding struct {
+	container string
+	message   string
+}
+
+func checkRule(rule Rule, w workload) []finding {
+	var out []finding
+	switch rule.Type {
+	case RuleRequiredLabels:
+		var missing []string
+		for _, label := range rule.Labels {
+			if strings.TrimSpace(w.Labels[label]) == "" {
+				missing = append(missing, label)
+			}
+		}
+		if len(missing) > 0 {
+			out = append(out, finding{message: "missing required labels: " + strings.Join(missing, ", ")})
+		}
+		return out
+	}
+	for _, c := range w.Containers {
+		switch rule.Type {
+		case RuleNoPrivileged:
+			if c.Privileged {
+				out = append(out, finding{container: c.Name, message: "privileged containers are not allowed"})
+			}
+		case RuleRequireResourceLimits:
+			var missing []string
+			if !c.LimitCPU {
+				missing = append(missing, "cpu")
+			}
+			if !c.LimitMemory {
+				missing = append(missing, "memory")
+			}
+			if len(missing) > 0 {
+				out = append(out, finding{container: c.Name, message: "resource limits required: missing " + strings.Join(missing, ", ")})
+			}
+		case RuleDisallowLatestTag:
+			if c.Image != "" && usesLatestTag(c.Image) {
+				out = append(out, finding{container: c.Name, message: fmt.Sprintf("image %s must use a fixed tag or digest, not latest", c.Image)})
+			}
+		case RuleAllowedRegistries:
+			if c.Image != "" && !registryAllowed(c.Image, rule.Registries) {
+				out = append(out, finding{container: c.Name, message: fmt.Sprintf("image %s is not from an allowed registry (%s)", c.Image, strings.Join(rule.Registries, ", "))})
+			}
+		}
+	}
+	return out
+}
+
+// usesLatestTag 判断镜像未指定标签或使用 latest; 以 digest 固定的镜像不算。
+func usesLatestTag(image string) bool {
+	if strings.Contains(image, "@") {
+		return false
+	}
+	name := image
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	i := strings.LastIndex(name, ":")
+	return i < 0 || name[i+1:] == "latest"
+}
+
+// imageRegistry 返回镜像所在仓库, 没有仓库前缀的镜像属于 docker.io。
+func imageRegistry(image string) string {
+	first, _, found := strings.Cut(image, "/")
+	if !found {
+		return "docker.io"
+	}
+	if strings.ContainsAny(first, ".:") || first == "localhost" {
+		return first
+	}
+	return "docker.io"
+}
+
+func registryAllowed(image string, registries []string) bool {
+	registry := imageRegistry(image)
+	for _, allowed := range registries {
+		allowed = strings.TrimSuffix(strings.TrimSpace(allowed), "/")
+		if allowed == "" {
+			continue
+		}
+		// 既支持仓库 ("registry.local"), 也支持仓库下的路径前缀 ("registry.local/team")。
+		if allowed == registry || strings.HasPrefix(image, allowed+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func extractWorkloads(manifest string) ([]workload, error) {
+	dec := yaml.NewDecoder(bytes.NewBufferString(manifest))
+	var out []workload
+	for {
+		var doc map[string]any
+		if err := dec.Decode(&doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("parse manifest: %w", err)
+		}
+		if doc == nil {
+			continue
+		}
+		if _, isK8s := doc["kind"]; !isK8s {
+			if services, ok := doc["services"].(map[string]any); ok {
+				out = append(out, composeWorkloads(services)...)
+			}
+			continue
+		}
+		if w, ok := k8sWorkload(doc); ok {
+			out = append(out, w)
+		}
+	}
+	return out, nil
+}
+
+func k8sWorkload(doc map[string]any) (workload, bool) {
+	kind := stringValue(doc["kind"])
+	podSpec, ok := map[string]any(nil), false
+	switch kind {
+	case "Pod":
+		podSpec, ok = lookupMap(doc, "spec")
+	case "Deployment", "StatefulSet", "DaemonSet", "ReplicaSet", "Job":
+		podSpec, ok = lookupMap(doc, "spec", "template", "spec")
+	case "CronJob":
+		podSpec, ok = lookupMap(doc, "spec", "jobTemplate", "spec", "template", "spec")
+	}
+	if !ok {
+		return workload{}, false
+	}
+	w := workload{Object: kind + "/" + stringValue(lookup(doc, "metadata", "name")), Labels: stringMap(lookup(doc, "metadata", "labels"))}
+	for _, key := range []string{"initContainers", "containers"} {
+		items, _ := podSpec[key].([]any)
+		for _, item := range items {
+			c, ok := item.(map[string]any)
+			if !ok {
+				continue
+			}
+			limits, _ := lookupMap(c, "resources", "limits")
+			w.Containers = append(w.Containers, container{
+				Name:          stringValue(c["name"]),
+				Image:         stringValue(c["image"]),
+				Privileged:    boolValue(lookup(c, "securityContext", "privileged")),
+				LimitCPU:      limits["cpu"] != nil,
+				LimitMemory:   limits["memory"] != nil,
+				InitContainer: key == "initContainers",
+			})
+		}
+	}
+	return w, true
+}
+
+func composeWorkloads(services map[string]any) []workload {
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out := make([]workload, 0, len(names))
+	for _, name := range names {
+		svc, _ := services[name].(map[string]any)
+		if svc == nil {
+			svc = map[string]any{}
+		}
+		limits, _ := lookupMap(svc, "deploy", "resources", "limits")
+		out = append(out, workload{
+			Object: "service/" + name,
+			Labels: stringMap(svc["labels"]),
+			Containers: []container{{
+				Name:        name,
+				Image:       stringValue(svc["image"]),
+				Privileged:  boolValue(svc["privileged"]),
+				LimitCPU:    limits["cpus"] != nil || svc["cpus"] != nil,
+				LimitMemory: limits["memory"] != nil || svc["mem_limit"] != nil,
+			}},
+		})
+	}
+	return out
+}
+
+func lookup(m map[string]any, path ...string) any {
+	var cur any = m
+	for _, key := range path {
+		next, ok := cur.(map[string]any)
+		if !ok {
+			return nil
+		}
+		cur = next[key]
+	}
+	return cur
+}
+
+func lookupMap(m map[string]any, path ...string) (map[string]any, bool) {
+	v, ok := lookup(m, path...).(map[string]any)
+	return v, ok
+}
+
+func stringValue(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	default:
+		return fmt.Sprint(t)
+	}
+}
+
+func boolValue(v any) bool {
+	switch t := v.(type) {
+	case bool:
+		return t
+	case string:
+		return strings.EqualFold(strings.TrimSpace(t), "true")
+	}
+	return false
+}
+
+func uintValue(v any) uint {
+	switch t := v.(type) {
+	case float64:
+		if t > 0 {
+			return uint(t)
+		}
+	case int:
+		if t > 0 {
+			return uint(t)
+		}
+	case uint:
+		return t
+	}
+	return 0
+}
+
+func stringList(v any) []string {
+	items, _ := v.([]any)
+	out := make([]string, 0, len(items))
+	for _, item := range items {
+		if s := strings.TrimSpace(stringValue(item)); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// stringMap 兼容 map 形式与 compose 的 "key=value" 列表形式的标签。
+func stringMap(v any) map[string]string {
+	out := map[string]string{}
+	switch t := v.(type) {
+	case map[string]any:
+		for k, val := range t {
+			out[k] = stringValue(val)
+		}
+	case []any:
+		for _, item := range t {
+			k, val, _ := strings.Cut(stringValue(item), "=")
+			out[strings.TrimSpace(k)] = strings.TrimSpace(val)
+		}
+	}
+	return out
+}
@@ -0,0 +1,141 @@
+package admission
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cy77cc/OpsPilot/internal/model"
+)
+
+const k8sManifest = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  labels:
+    app: web
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: migrate
+        image: registry.local/web-migrate@sha256:abc
+        resources:
+          limits: {cpu: 100m, memory: 64Mi}
+      containers:
+      - name: app
+        image: nginx
+        securityContext:
+          privileged: true
+        resources:
+          limits: {memory: 128Mi}
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+`
+
+const composeManifest = `services:
+  api:
+    image: registry.local/team/api:1.2.0
+    labels: ["team=payments"]
+    deploy:
+      resources:
+        limits: {cpus: "0.5", memory: 256M}
+  cache:
+    image: redis:latest
+    privileged: true
+`
+
+func mustParse(t *testing.T, config map[string]any) Policy {
+	t.Helper()
+	p, err := Parse(model.Policy{ID: 1, Name: "baseline", Type: model.PolicyTypeAdmission, Config: config})
+	if err != nil {
+		t.Fatalf("parse policy: %v", err)
+	}
+	return p
+}
+
+func rulesOf(res Result) []string {
+	var out []string
+	for _, v := range res.Violations {
+		where := v.Object
+		if v.Container != "" {
+			where += "/" + v.Container
+		}
+		out = append(out, v.Rule+"@"+where)
+	}
+	return out
+}
+
+func TestEvaluateKubernetesManifest(t *testing.T) {
+	p := mustParse(t, map[string]any{"mode": "enforce", "rules": []any{
+		map[string]any{"type": "no_privileged"},
+		map[string]any{"type": "require_resource_limits"},
+		map[string]any{"type": "disallow_latest_tag"},
+		map[string]any{"type": "allowed_registries", "registries": []any{"registry.local"}, "mode": "warn"},
+		map[string]any{"type": "required_labels", "labels": []any{"app", "team"}},
+	}})
+	res, err := Evaluate(k8sManifest, []Policy{p})
+	if err != nil {
+		t.Fatalf("evaluate: %v", err)
+	}
+	got := strings.Join(rulesOf(res), ",")
+	want := "no_privileged@Deployment/web/app,require_resource_limits@Deployment/web/app,disallow_latest_tag@Deployment/web/app,allowed_registries@Deployment/web/app,required_labels@Deployment/web"
+	if got != want {
+		t.Fatalf("unexpected violations:\n got %s\nwant %s", got, want)
+	}
+	if !res.Blocked() || len(res.Enforced()) != 4 {
+		t.Fatalf("expected 4 enforced violations, got %d", len(res.Enforced()))
+	}
+}
+
+func TestEvaluateComposeManifest(t *testing.T) {
+	p := mustParse(t, map[string]any{"rules": []any{
+		map[string]any{"type": "no_privileged"},
+		map[string]any{"type": "require_resource_limits"},
+		map[string]any{"type": "disallow_latest_tag"},
+		map[string]any{"type": "allowed_registries", "registries": []any{"registry.local/team"}},
+		map[string]any{"type": "required_labels", "labels": []any{"team"}},
+	}})
+	res, err := Evaluate(composeManifest, []Policy{p})
+	if err != nil {
+		t.Fatalf("evaluate: %v", err)
+	}
+	for _, v := range res.Violations {
+		if v.Object == "service/api" {
+			t.Fatalf("compliant compose service reported: %s", v)
+		}
+	}
+	if len(res.Violations) != 5 {
+		t.Fatalf("expected every rule to flag service/cache, got %v", rulesOf(res))
+	}
+	if res.Blocked() {
+		t.Fatal("warn is the default mode and must not block")
+	}
+}
+
+func TestParseAndScope(t *testing.T) {
+	bad := []map[string]any{
+		{"mode": "audit", "rules": []any{map[string]any{"type": "no_privileged"}}},
+		{"rules": []any{}},
+		{"rules": []any{map[string]any{"type": "no_root"}}},
+		{"rules": []any{map[string]any{"type": "allowed_registries"}}},
+		{"rules": []any{map[string]any{"type": "required_labels", "labels": []any{}}}},
+	}
+	for _, config := range bad {
+		if err := Validate(config); err == nil {
+			t.Fatalf("expected config %v to be rejected", config)
+		}
+	}
+	p := mustParse(t, map[string]any{"project_id": float64(3), "env": "Production", "rules": []any{map[string]any{"type": "no_privileged"}}})
+	if !p.Applies(Scope{ProjectID: 3, Env: "production"}) {
+		t.Fatal("expected policy to apply to its project and env")
+	}
+	if p.Applies(Scope{ProjectID: 4, Env: "production"}) || p.Applies(Scope{ProjectID: 3, Env: "staging"}) {
+		t.Fatal("expected policy not to apply outside its scope")
+	}
+	if usesLatestTag("registry.local:5000/app:1.0") || !usesLatestTag("registry.local:5000/app") {
+		t.Fatal("registry port must not be mistaken for a tag")
+	}
+}
@@ -0,0 +1,177 @@
+// Package freeze 实现部署变更日历: 判断某次发布是否落在冻结窗口内。
+//
+// 该包只依赖数据模型与数据库, 供发布流程、CI/CD 触发与 AI 部署工具共用。
+package freeze
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cy77cc/OpsPilot/internal/model"
+	"github.com/cy77cc/OpsPilot/internal/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	WindowOneOff    = "one_off"
+	WindowRecurring = "recurring"
+
+	// PermOverride 是在冻结期内发起紧急发布所需的权限。
+	PermOverride = "deploy:freeze:override"
+)
+
+// Scope 描述一次发布所处的环境、项目与目标。
+type Scope struct {
+	Env       string
+	ProjectID uint
+	TargetIDs []uint
+}
+
+// Validate 校验窗口定义, 并补齐默认时区。
+func Validate(w *model.DeploymentFreezeWindow) error {
+	if strings.TrimSpace(w.Name) == "" {
+		return fmt.Errorf("name is required")
+	}
+	w.Env = strings.ToLower(strings.TrimSpace(w.Env))
+	switch w.WindowType {
+	case WindowOneOff:
+		if w.StartAt == nil || w.EndAt == nil {
+			return fmt.Errorf("start_at and end_at are required for one_off windows")
+		}
+		if !w.EndAt.After(*w.StartAt) {
+			return fmt.Errorf("end_at must be after start_at")
+		}
+	case WindowRecurring:
+		if _, err := utils.ParseCron(w.Cron); err != nil {
+			return fmt.Errorf("invalid cron: %w", err)
+		}
+		if w.DurationMinutes <= 0 {
+			return fmt.Errorf("duration_minutes must be positive for recurring windows")
+		}
+		if w.StartAt != nil && w.EndAt != nil && !w.EndAt.After(*w.StartAt) {
+			return fmt.Errorf("end_at must be after start_at")
+		}
+		if _, err := location(w.Timezone); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("window_type must be one of: one_off, recurring")
+	}
+	return nil
+}
+
+func location(tz string) (*time.Location, error) {
+	if strings.TrimSpace(tz) == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(strings.TrimSpace(tz))
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q", tz)
+	}
+	return loc, nil
+}
+
+// Covers 判断窗口在 at 时刻是否生效, 生效时返回本次冻结的结束时间。
+func Covers(w model.DeploymentFreezeWindow, at time.Time) (bool, time.Time) {
+	if !w.Enabled {
+		return false, time.Time{}
+	}
+	switch w.WindowType {
+	case WindowOneOff:
+		if w.StartAt == nil || w.EndAt == nil {
+			return false, time.Time{}
+		}
+		if !at.Before(*w.StartAt) && at.Before(*w.EndAt) {
+			return true, *w.EndAt
+		}
+	case WindowRecurring:
+		if (w.StartAt != nil && at.Before(*w.StartAt)) || (w.EndAt != nil && !at.Before(*w.EndAt)) {
+			return false, time.Time{}
+		}
+		sched, err := utils.ParseCron(w.Cron)
+		if err != nil || w.DurationMinutes <= 0 {
+			return false, time.Time{}
+		}
+		loc, err := location(w.Timezone)
+		if err != nil {
+			return false, time.Time{}
+		}
+		// 只要 (at - duration, at] 内存在一次触发, 该次冻结就覆盖 at。
+		duration := time.Duration(w.DurationMinutes) * time.Minute
+		fire := sched.Next(at.In(loc).Add(-duration))
+		if !fire.IsZero() && !fire.After(at) {
+			return true, fire.Add(duration)
+		}
+	}
+	return false, time.Time{}
+}
+
+// Active 返回作用域内在 at 时刻生效的冻结窗口。
+func Active(ctx context.Context, db *gorm.DB, scope Scope, at time.Time) ([]model.DeploymentFreezeWindow, error) {
+	q := db.WithContext(ctx).Model(&model.DeploymentFreezeWindow{}).
+		Where("enabled = ?", true).
+		Where("env = '' OR env = ?", strings.ToLower(strings.TrimSpace(scope.Env))).
+		Where("project_id = 0 OR project_id = ?", scope.ProjectID)
+	if len(scope.TargetIDs) > 0 {
+		q = q.Where("target_id = 0 OR target_id IN ?", scope.TargetIDs)
+	} else {
+		q = q.Where("target_id = 0")
+	}
+	var rows []model.DeploymentFreezeWindow
+	if err := q.Order("id ASC").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	out := make([]model.DeploymentFreezeWindow, 0, len(rows))
+	for _, w := range rows {
+		if ok, _ := Covers(w, at); ok {
+			out = append(out, w)
+		}
+	}
+	return out, nil
+}
+
+// Describe 生成冻结窗口的简短说明, 用于错误信息与审计。
+func Describe(windows []model.DeploymentFreezeWindow, at time.Time) string {
+	parts := make([]string, 0, len(windows))
+	for _, w := range windows {
+		_, until := Covers(w, at)
+		text := fmt.Sprintf("%s (#%d) until %s", w.Name, w.ID, until.UTC().Format(time.RFC3339))
+		if strings.TrimSpace(w.Reason) != "" {
+			text += ": " + strings.TrimSpace(w.Reason)
+		}
+		parts = append(parts, text)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Summaries 返回写入审计详情的窗口摘要。
+func Summaries(windows []model.DeploymentFreezeWindow, at time.Time) []map[string]any {
+	out := make([]map[string]any, 0, len(windows))
+	for _, w := range windows {
+		_, until := Covers(w, at)
+		out = append(out, map[string]any{"id": w.ID, "name": w.Name, "reason": w.Reason, "until": until.UTC().Format(time.RFC3339)})
+	}
+	return out
+}
+
+// OverrideRoles 汇总窗口要求的紧急放行审批角色。
+func OverrideRoles(windows []model.DeploymentFreezeWindow) []string {
+	seen := map[string]struct{}{}
+	out := make([]string, 0)
+	for _, w := range windows {
+		for _, role := range strings.Split(w.OverrideRoles, ",") {
+			role = strings.TrimSpace(role)
+			if role == "" {
+				continue
+			}
+			if _, ok := seen[role]; ok {
+				continue
+			}
+			seen[role] = struct{}{}
+			out = append(out, role)
+		}
+	}
+	return out
+}
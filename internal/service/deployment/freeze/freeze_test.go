@@ -0,0 +1,73 @@
+package freeze
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cy77cc/OpsPilot/internal/model"
+)
+
+func TestCoversOneOff(t *testing.T) {
+	start := time.Date(2026, 12, 20, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2027, 1, 3, 0, 0, 0, 0, time.UTC)
+	w := model.DeploymentFreezeWindow{Name: "year-end", WindowType: WindowOneOff, StartAt: &start, EndAt: &end, Enabled: true}
+	if ok, until := Covers(w, start.Add(time.Hour)); !ok || !until.Equal(end) {
+		t.Fatalf("expected window to cover, got %v until %s", ok, until)
+	}
+	if ok, _ := Covers(w, end); ok {
+		t.Fatal("expected end to be exclusive")
+	}
+	w.Enabled = false
+	if ok, _ := Covers(w, start.Add(time.Hour)); ok {
+		t.Fatal("expected disabled window not to cover")
+	}
+}
+
+func TestCoversRecurring(t *testing.T) {
+	// 每周五 18:00 (上海) 起冻结 63 小时, 至周一 09:00。
+	w := model.DeploymentFreezeWindow{Name: "weekend", WindowType: WindowRecurring, Cron: "0 18 * * 5", DurationMinutes: 63 * 60, Timezone: "Asia/Shanghai", Enabled: true}
+	if err := Validate(&w); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	sh, _ := time.LoadLocation("Asia/Shanghai")
+	cases := []struct {
+		at   time.Time
+		want bool
+	}{
+		{time.Date(2026, 10, 16, 17, 59, 0, 0, sh), false},
+		{time.Date(2026, 10, 16, 18, 0, 0, 0, sh), true},
+		{time.Date(2026, 10, 18, 12, 0, 0, 0, sh), true},
+		{time.Date(2026, 10, 19, 8, 59, 0, 0, sh), true},
+		{time.Date(2026, 10, 19, 9, 0, 0, 0, sh), false},
+		{time.Date(2026, 10, 17, 2, 0, 0, 0, time.UTC), true},
+	}
+	for _, tc := range cases {
+		if ok, _ := Covers(w, tc.at); ok != tc.want {
+			t.Fatalf("Covers(%s) = %v, want %v", tc.at, ok, tc.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Now()
+	bad := []model.DeploymentFreezeWindow{
+		{WindowType: WindowOneOff, StartAt: &now, EndAt: &now},
+		{Name: "x", WindowType: WindowOneOff, StartAt: &now, EndAt: &now},
+		{Name: "x", WindowType: WindowRecurring, Cron: "bad", DurationMinutes: 10},
+		{Name: "x", WindowType: WindowRecurring, Cron: "0 0 * * *"},
+		{Name: "x", WindowType: WindowRecurring, Cron: "0 0 * * *", DurationMinutes: 10, Timezone: "Mars/Base"},
+		{Name: "x", WindowType: "sometimes"},
+	}
+	for i := range bad {
+		if err := Validate(&bad[i]); err == nil {
+			t.Fatalf("expected window %d to be invalid: %+v", i, bad[i])
+		}
+	}
+}
+
+func TestOverrideRoles(t *testing.T) {
+	got := OverrideRoles([]model.DeploymentFreezeWindow{{OverrideRoles: "sre, cto"}, {OverrideRoles: "sre"}, {}})
+	if len(got) != 2 || got[0] != "sre" || got[1] != "cto" {
+		t.Fatalf("unexpected roles: %v", got)
+	}
+}
@@ -1,12 +1,15 @@
 package deployment
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strings"
 
 	"github.com/cy77cc/OpsPilot/internal/httpx"
 	"github.com/cy77cc/OpsPilot/internal/model"
 	"github.com/cy77cc/OpsPilot/internal/svc"
+	"github.com/cy77cc/OpsPilot/internal/xcode"
 	"github.com/gin-gonic/gin"
 )
 
@@ -146,6 +149,10 @@ func (h *Handler) ApplyRelease(c *gin.Context) {
 	}
 	resp, err := h.logic.ApplyRelease(c.Request.Context(), httpx.UIDFromCtx(c), req)
 	if err != nil {
+		if errors.Is(err, ErrChangeFreeze) || errors.Is(err, ErrAdmissionDenied) {
+			httpx.Fail(c, xcode.Forbidden, err.Error())
+			return
+		}
 		httpx.ServerErr(c, err)
 		return
 	}
@@ -163,6 +170,14 @@ func (h *Handler) RollbackRelease(c *gin.Context) {
 	}
 	resp, err := h.logic.RollbackRelease(c.Request.Context(), httpx.UintFromParam(c, "id"), httpx.UIDFromCtx(c))
 	if err != nil {
+		if errors.Is(err, ErrTargetLocked) {
+			httpx.Fail(c, xcode.ParamError, err.Error())
+			return
+		}
+		if errors.Is(err, ErrRollbackTargetNotFound) {
+			httpx.Fail(c, xcode.NotFound, err.Error())
+			return
+		}
 		httpx.ServerErr(c, err)
 		return
 	}
@@ -207,6 +222,37 @@ func (h *Handler) RejectRelease(c *gin.Context) {
 	httpx.OK(c, resp)
 }
 
+func (h *Handler) PauseRelease(c *gin.Context) {
+	h.releaseStrategyAction(c, h.logic.PauseRelease)
+}
+
+func (h *Handler) PromoteRelease(c *gin.Context) {
+	h.releaseStrategyAction(c, h.logic.PromoteRelease)
+}
+
+func (h *Handler) AbortRelease(c *gin.Context) {
+	h.releaseStrategyAction(c, h.logic.AbortRelease)
+}
+
+func (h *Handler) releaseStrategyAction(c *gin.Context, action func(ctx context.Context, id uint, uid uint64, comment string) (ReleaseApplyResp, error)) {
+	row, err := h.logic.GetRelease(c.Request.Context(), httpx.UintFromParam(c, "id"))
+	if err != nil {
+		httpx.ServerErr(c, err)
+		return
+	}
+	if !httpx.Authorize(c, h.svcCtx.DB, "deploy:release:apply") || !h.authorizeRuntime(c, row.RuntimeType, "apply") {
+		return
+	}
+	var req ReleaseDecisionReq
+	_ = c.ShouldBindJSON(&req)
+	resp, err := action(c.Request.Context(), row.ID, httpx.UIDFromCtx(c), req.Comment)
+	if err != nil {
+		httpx.ServerErr(c, err)
+		return
+	}
+	httpx.OK(c, resp)
+}
+
 func (h *Handler) ListReleaseTimeline(c *gin.Context) {
 	row, err := h.logic.GetRelease(c.Request.Context(), httpx.UintFromParam(c, "id"))
 	if err != nil {
@@ -244,6 +290,23 @@ func (h *Handler) ListReleases(c *gin.Context) {
 	httpx.OK(c, gin.H{"list": list, "total": len(list)})
 }
 
+func (h *Handler) ListReleaseApprovalVotes(c *gin.Context) {
+	row, err := h.logic.GetRelease(c.Request.Context(), httpx.UintFromParam(c, "id"))
+	if err != nil {
+		httpx.ServerErr(c, err)
+		return
+	}
+	if !httpx.Authorize(c, h.svcCtx.DB, "deploy:release:read") || !h.authorizeRuntime(c, row.RuntimeType, "read") {
+		return
+	}
+	list, err := h.logic.ListReleaseApprovalVotes(c.Request.Context(), row.ID)
+	if err != nil {
+		httpx.ServerErr(c, err)
+		return
+	}
+	httpx.OK(c, gin.H{"list": list, "total": len(list)})
+}
+
 func (h *Handler) GetRelease(c *gin.Context) {
 	row, err := h.logic.GetRelease(c.Request.Context(), httpx.UintFromParam(c, "id"))
 	if err != nil {
@@ -352,6 +415,9 @@ func (h *Handler) toReleaseSummary(row model.DeploymentRelease) ReleaseSummaryRe
 		TriggerSource:      row.TriggerSource,
 		TriggerContextJSON: row.TriggerContextJSON,
 		CIRunID:            row.CIRunID,
+		ArtifactID:         row.ArtifactID,
+		ArtifactDigest:     row.ArtifactDigest,
+		CommitSHA:          row.CommitSHA,
 		RevisionID:         row.RevisionID,
 		SourceReleaseID:    row.SourceReleaseID,
 		TargetRevision:     row.TargetRevision,
@@ -359,6 +425,9 @@ func (h *Handler) toReleaseSummary(row model.DeploymentRelease) ReleaseSummaryRe
 		LifecycleState:     h.logic.releaseLifecycleState(row.Status),
 		DiagnosticsJSON:    row.DiagnosticsJSON,
 		VerificationJSON:   row.VerificationJSON,
+		StrategyStateJSON:  row.StrategyStateJSON,
+		InventoryJSON:      row.InventoryJSON,
+		PrunedJSON:         row.PrunedJSON,
 		CreatedAt:          row.CreatedAt,
 		UpdatedAt:          row.UpdatedAt,
 		PreviewExpiresAt:   row.PreviewExpiresAt,
@@ -0,0 +1,45 @@
+package deployment
+
+import (
+	"context"
+	"errors"
+
+	"github.com/cy77cc/OpsPilot/internal/httpx"
+	"github.com/cy77cc/OpsPilot/internal/xcode"
+	"github.com/gin-gonic/gin"
+)
+
+// StartDriftDetection 启动配置漂移的后台检测, ctx 取消时退出。
+func (h *Handler) StartDriftDetection(ctx context.Context) {
+	h.logic.StartDriftDetection(ctx)
+}
+
+func (h *Handler) GetTargetDrift(c *gin.Context) {
+	if !httpx.Authorize(c, h.svcCtx.DB, "deploy:release:read") {
+		return
+	}
+	resp, err := h.logic.GetTargetDrift(c.Request.Context(), httpx.UintFromParam(c, "id"))
+	if err != nil {
+		httpx.ServerErr(c, err)
+		return
+	}
+	httpx.OK(c, resp)
+}
+
+func (h *Handler) ResyncTargetDrift(c *gin.Context) {
+	if !httpx.Authorize(c, h.svcCtx.DB, "deploy:release:apply") || !h.authorizeRuntime(c, "k8s", "apply") {
+		return
+	}
+	var req DriftResyncReq
+	_ = c.ShouldBindJSON(&req)
+	resp, err := h.logic.ResyncTargetDrift(c.Request.Context(), httpx.UintFromParam(c, "id"), httpx.UIDFromCtx(c), req)
+	if err != nil {
+		if errors.Is(err, ErrTargetLocked) {
+			httpx.Fail(c, xcode.ParamError, err.Error())
+			return
+		}
+		httpx.ServerErr(c, err)
+		return
+	}
+	httpx.OK(c, resp)
+}
@@ -0,0 +1,78 @@
+package deployment
+
+import (
+	"strings"
+
+	"github.com/cy77cc/OpsPilot/internal/httpx"
+	"github.com/cy77cc/OpsPilot/internal/xcode"
+	"github.com/gin-gonic/gin"
+)
+
+func (h *Handler) ListFreezeWindows(c *gin.Context) {
+	if !httpx.Authorize(c, h.svcCtx.DB, "deploy:release:read") {
+		return
+	}
+	list, err := h.logic.ListFreezeWindows(c.Request.Context(), strings.TrimSpace(c.Query("env")), httpx.UintFromQuery(c, "project_id"), httpx.UintFromQuery(c, "target_id"))
+	if err != nil {
+		httpx.ServerErr(c, err)
+		return
+	}
+	httpx.OK(c, gin.H{"list": list, "total": len(list)})
+}
+
+func (h *Handler) CreateFreezeWindow(c *gin.Context) {
+	if !httpx.Authorize(c, h.svcCtx.DB, "deploy:freeze:write") {
+		return
+	}
+	var req FreezeWindowUpsertReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		httpx.BindErr(c, err)
+		return
+	}
+	resp, err := h.logic.CreateFreezeWindow(c.Request.Context(), httpx.UIDFromCtx(c), req)
+	if err != nil {
+		httpx.Fail(c, xcode.ParamError, err.Error())
+		return
+	}
+	httpx.OK(c, resp)
+}
+
+func (h *Handler) UpdateFreezeWindow(c *gin.Context) {
+	if !httpx.Authorize(c, h.svcCtx.DB, "deploy:freeze:write") {
+		return
+	}
+	var req FreezeWindowUpsertReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		httpx.BindErr(c, err)
+		return
+	}
+	resp, err := h.logic.UpdateFreezeWindow(c.Request.Context(), httpx.UintFromParam(c, "id"), req)
+	if err != nil {
+		httpx.Fail(c, xcode.ParamError, err.Error())
+		return
+	}
+	httpx.OK(c, resp)
+}
+
+func (h *Handler) DeleteFreezeWindow(c *gin.Context) {
+	if !httpx.Authorize(c, h.svcCtx.DB, "deploy:freeze:write") {
+		return
+	}
+	if err := h.logic.DeleteFreezeWindow(c.Request.Context(), httpx.UintFromParam(c, "id")); err != nil {
+		httpx.ServerErr(c, err)
+		return
+	}
+	httpx.OK(c, gin.H{"message": "deleted"})
+}
+
+func (h *Handler) CheckFreeze(c *gin.Context) {
+	if !httpx.Authorize(c, h.svcCtx.DB, "deploy:release:read") {
+		return
+	}
+	resp, err := h.logic.CheckFreeze(c.Request.Context(), httpx.UintFromQuery(c, "service_id"), httpx.UintFromQuery(c, "target_id"), strings.TrimSpace(c.Query("env")))
+	if err != nil {
+		httpx.ServerErr(c, err)
+		return
+	}
+	httpx.OK(c, resp)
+}
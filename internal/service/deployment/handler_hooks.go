@@ -0,0 +1,66 @@
+package deployment
+
+import (
+	"strings"
+
+	"github.com/cy77cc/OpsPilot/internal/httpx"
+	"github.com/cy77cc/OpsPilot/internal/xcode"
+	"github.com/gin-gonic/gin"
+)
+
+func (h *Handler) ListReleaseHooks(c *gin.Context) {
+	if !httpx.Authorize(c, h.svcCtx.DB, "deploy:release:read") {
+		return
+	}
+	list, err := h.logic.ListReleaseHooks(c.Request.Context(), httpx.UintFromQuery(c, "service_id"), httpx.UintFromQuery(c, "target_id"), strings.TrimSpace(c.Query("phase")))
+	if err != nil {
+		httpx.ServerErr(c, err)
+		return
+	}
+	httpx.OK(c, gin.H{"list": list, "total": len(list)})
+}
+
+func (h *Handler) CreateReleaseHook(c *gin.Context) {
+	if !httpx.Authorize(c, h.svcCtx.DB, "deploy:hook:write") {
+		return
+	}
+	var req ReleaseHookUpsertReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		httpx.BindErr(c, err)
+		return
+	}
+	resp, err := h.logic.CreateReleaseHook(c.Request.Context(), httpx.UIDFromCtx(c), req)
+	if err != nil {
+		httpx.Fail(c, xcode.ParamError, err.Error())
+		return
+	}
+	httpx.OK(c, resp)
+}
+
+func (h *Handler) UpdateReleaseHook(c *gin.Context) {
+	if !httpx.Authorize(c, h.svcCtx.DB, "deploy:hook:write") {
+		return
+	}
+	var req ReleaseHookUpsertReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		httpx.BindErr(c, err)
+		return
+	}
+	resp, err := h.logic.UpdateReleaseHook(c.Request.Context(), httpx.UintFromParam(c, "id"), req)
+	if err != nil {
+		httpx.Fail(c, xcode.ParamError, err.Error())
+		return
+	}
+	httpx.OK(c, resp)
+}
+
+func (h *Handler) DeleteReleaseHook(c *gin.Context) {
+	if !httpx.Authorize(c, h.svcCtx.DB, "deploy:hook:write") {
+		return
+	}
+	if err := h.logic.DeleteReleaseHook(c.Request.Context(), httpx.UintFromParam(c, "id")); err != nil {
+		httpx.ServerErr(c, err)
+		return
+	}
+	httpx.OK(c, gin.H{"message": "deleted"})
+}
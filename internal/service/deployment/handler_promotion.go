@@ -0,0 +1,61 @@
+package deployment
+
+import (
+	"errors"
+
+	"github.com/cy77cc/OpsPilot/internal/httpx"
+	"github.com/cy77cc/OpsPilot/internal/xcode"
+	"github.com/gin-gonic/gin"
+)
+
+// authorizePromotion 校验晋级请求: 需要对目标运行时的发布权限。
+func (h *Handler) authorizePromotion(c *gin.Context) (ReleasePromotionReq, bool) {
+	var req ReleasePromotionReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		httpx.BindErr(c, err)
+		return req, false
+	}
+	target, err := h.logic.GetTarget(c.Request.Context(), req.TargetID)
+	if err != nil {
+		httpx.ServerErr(c, err)
+		return req, false
+	}
+	if !httpx.Authorize(c, h.svcCtx.DB, "deploy:release:apply") || !h.authorizeRuntime(c, target.RuntimeType, "apply") {
+		return req, false
+	}
+	return req, true
+}
+
+func (h *Handler) PreviewReleasePromotion(c *gin.Context) {
+	req, ok := h.authorizePromotion(c)
+	if !ok {
+		return
+	}
+	resp, err := h.logic.PreviewReleasePromotion(c.Request.Context(), httpx.UintFromParam(c, "id"), req)
+	if err != nil {
+		if errors.Is(err, ErrPromotionDenied) {
+			httpx.Fail(c, xcode.Forbidden, err.Error())
+			return
+		}
+		httpx.ServerErr(c, err)
+		return
+	}
+	httpx.OK(c, resp)
+}
+
+func (h *Handler) ApplyReleasePromotion(c *gin.Context) {
+	req, ok := h.authorizePromotion(c)
+	if !ok {
+		return
+	}
+	resp, err := h.logic.ApplyReleasePromotion(c.Request.Context(), httpx.UIDFromCtx(c), httpx.UintFromParam(c, "id"), req)
+	if err != nil {
+		if errors.Is(err, ErrPromotionDenied) || errors.Is(err, ErrChangeFreeze) || errors.Is(err, ErrAdmissionDenied) {
+			httpx.Fail(c, xcode.Forbidden, err.Error())
+			return
+		}
+		httpx.ServerErr(c, err)
+		return
+	}
+	httpx.OK(c, resp)
+}
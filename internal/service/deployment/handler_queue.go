@@ -0,0 +1,45 @@
+package deployment
+
+import (
+	"context"
+
+	"github.com/cy77cc/OpsPilot/internal/httpx"
+	"github.com/cy77cc/OpsPilot/internal/xcode"
+	"github.com/gin-gonic/gin"
+)
+
+// StartReleaseQueue 启动目标锁续约与排队发布派发的后台任务, ctx 取消时退出。
+func (h *Handler) StartReleaseQueue(ctx context.Context) {
+	h.logic.StartReleaseQueue(ctx)
+}
+
+func (h *Handler) GetTargetReleaseQueue(c *gin.Context) {
+	if !httpx.Authorize(c, h.svcCtx.DB, "deploy:release:read") {
+		return
+	}
+	resp, err := h.logic.GetTargetReleaseQueue(c.Request.Context(), httpx.UintFromParam(c, "id"))
+	if err != nil {
+		httpx.ServerErr(c, err)
+		return
+	}
+	httpx.OK(c, resp)
+}
+
+func (h *Handler) CancelRelease(c *gin.Context) {
+	row, err := h.logic.GetRelease(c.Request.Context(), httpx.UintFromParam(c, "id"))
+	if err != nil {
+		httpx.ServerErr(c, err)
+		return
+	}
+	if !httpx.Authorize(c, h.svcCtx.DB, "deploy:release:cancel", "deploy:release:apply") || !h.authorizeRuntime(c, row.RuntimeType, "apply") {
+		return
+	}
+	var req ReleaseDecisionReq
+	_ = c.ShouldBindJSON(&req)
+	resp, err := h.logic.CancelRelease(c.Request.Context(), row.ID, httpx.UIDFromCtx(c), req.Comment)
+	if err != nil {
+		httpx.Fail(c, xcode.ParamError, err.Error())
+		return
+	}
+	httpx.OK(c, resp)
+}
@@ -0,0 +1,55 @@
+package deployment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/cy77cc/OpsPilot/internal/model"
+	"github.com/cy77cc/OpsPilot/internal/service/deployment/admission"
+)
+
+// ErrAdmissionDenied 表示渲染后的清单违反了 enforce 模式的准入策略。
+var ErrAdmissionDenied = errors.New("release blocked by admission policy")
+
+const reasonCodeAdmissionDenied = "admission_denied"
+
+// checkAdmission 用作用于服务项目、环境与目标的准入策略检查清单。
+func (l *Logic) checkAdmission(ctx context.Context, svc *model.Service, target *model.DeploymentTarget, env, manifest string) (admission.Result, error) {
+	return admission.Check(ctx, l.svcCtx.DB, admission.Scope{ProjectID: svc.ProjectID, Env: env, TargetID: target.ID}, manifest)
+}
+
+// admissionFindings 把违规转换为预览的检查项与警告: enforce 违规进入 checks (level=error), warn 违规进入 warnings。
+func admissionFindings(res admission.Result) (checks, warnings []map[string]string) {
+	for _, v := range res.Violations {
+		item := map[string]string{"code": "admission_" + v.Rule, "message": v.String(), "level": "warning"}
+		if v.Mode == admission.ModeEnforce {
+			item["level"] = "error"
+			checks = append(checks, item)
+			continue
+		}
+		warnings = append(warnings, item)
+	}
+	return checks, warnings
+}
+
+// blockAdmissionRelease 记录被准入策略拒绝的发布并返回 ErrAdmissionDenied。
+func (l *Logic) blockAdmissionRelease(ctx context.Context, release *model.DeploymentRelease, res admission.Result) (ReleaseApplyResp, error) {
+	message := res.Summary()
+	release.Status = releaseStatusRejected
+	release.DiagnosticsJSON = toJSON([]releaseDiagnostic{{Runtime: release.RuntimeType, Stage: "admission", Code: reasonCodeAdmissionDenied, Message: truncateText(message, 2000), Summary: "release blocked by admission policy"}})
+	if err := l.svcCtx.DB.WithContext(ctx).Create(release).Error; err != nil {
+		return ReleaseApplyResp{}, err
+	}
+	l.writeReleaseAudit(ctx, release.ID, release.Operator, "release.admission_blocked", map[string]any{"violations": res.Enforced()})
+	return ReleaseApplyResp{
+		ReleaseID:        release.ID,
+		UnifiedReleaseID: release.ID,
+		Status:           release.Status,
+		RuntimeType:      release.RuntimeType,
+		TriggerSource:    release.TriggerSource,
+		CIRunID:          release.CIRunID,
+		ReasonCode:       reasonCodeAdmissionDenied,
+		LifecycleState:   l.releaseLifecycleState(release.Status),
+	}, fmt.Errorf("%w: %s", ErrAdmissionDenied, message)
+}
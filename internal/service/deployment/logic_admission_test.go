@@ -0,0 +1,79 @@
+package deployment
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/cy77cc/OpsPilot/internal/model"
+)
+
+func hasFinding(items []map[string]string, code, level string) bool {
+	for _, item := range items {
+		if item["code"] == code && item["level"] == level {
+			return true
+		}
+	}
+	return false
+}
+
+func TestReleaseAdmission_PreviewReportsAndApplyEnforces(t *testing.T) {
+	suite := newReleaseTestSuite(t)
+	ctx := context.Background()
+	svc := suite.createTestService(t)
+	target := suite.createComposeTarget(t, "10.0.0.1")
+	policy := &model.Policy{Name: "prod-images", Type: model.PolicyTypeAdmission, Enabled: true, Config: map[string]any{
+		"mode": "enforce",
+		"env":  "production",
+		"rules": []any{
+			map[string]any{"type": "disallow_latest_tag"},
+			map[string]any{"type": "require_resource_limits", "mode": "warn"},
+		},
+	}}
+	if err := suite.db.Create(policy).Error; err != nil {
+		t.Fatalf("create policy: %v", err)
+	}
+	// 作用于其他环境的策略不参与检查。
+	suite.db.Create(&model.Policy{Name: "dev-only", Type: model.PolicyTypeAdmission, Enabled: true, Config: map[string]any{
+		"mode": "enforce", "env": "dev", "rules": []any{map[string]any{"type": "no_privileged"}, map[string]any{"type": "required_labels", "labels": []any{"team"}}},
+	}})
+
+	req := ReleasePreviewReq{ServiceID: svc.ID, TargetID: target.ID, Strategy: "rolling"}
+	preview, err := suite.logic.PreviewRelease(ctx, req)
+	if err != nil {
+		t.Fatalf("preview: %v", err)
+	}
+	if !hasFinding(preview.Checks, "admission_disallow_latest_tag", "error") {
+		t.Fatalf("expected enforced latest-tag violation in checks, got %+v", preview.Checks)
+	}
+	if !hasFinding(preview.Warnings, "admission_require_resource_limits", "warning") {
+		t.Fatalf("expected resource limit warning, got %+v", preview.Warnings)
+	}
+	if hasFinding(preview.Checks, "admission_required_labels", "error") {
+		t.Fatal("policy scoped to dev must not apply to production")
+	}
+
+	req.PreviewToken = preview.PreviewToken
+	resp, err := suite.logic.ApplyRelease(ctx, 1, req)
+	if !errors.Is(err, ErrAdmissionDenied) || resp.ReasonCode != reasonCodeAdmissionDenied || resp.Status != releaseStatusRejected {
+		t.Fatalf("expected apply to be refused by admission, got %+v err=%v", resp, err)
+	}
+	timeline, _ := suite.logic.ListReleaseTimeline(ctx, resp.ReleaseID)
+	if !timelineHas(timeline, "release.admission_blocked") {
+		t.Fatalf("expected admission_blocked audit, got %+v", timeline)
+	}
+
+	// 降为 warn 后违规只记录在发布的警告中。
+	policy.Config["mode"] = "warn"
+	suite.db.Save(policy)
+	resp, err = suite.logic.ApplyRelease(ctx, 1, req)
+	if errors.Is(err, ErrAdmissionDenied) {
+		t.Fatalf("warn mode must not block the release: %v", err)
+	}
+	var release model.DeploymentRelease
+	suite.db.First(&release, resp.ReleaseID)
+	if !strings.Contains(release.WarningsJSON, "admission_disallow_latest_tag") {
+		t.Fatalf("expected admission warnings to be stored on the release, got %s", release.WarningsJSON)
+	}
+}
@@ -0,0 +1,380 @@
+package deployment
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cy77cc/OpsPilot/internal/model"
+	"gorm.io/gorm"
+)
+
+const (
+	approvalActionRequire     = "require"
+	approvalActionAutoApprove = "auto_approve"
+
+	approvalSourcePolicy   = "policy"
+	approvalSourceCDConfig = "cd_config"
+	approvalSourceDefault  = "default"
+)
+
+// approvalRule 是审批策略的配置, 存储在 type=approval 的 Policy.Config 中。
+//
+// 示例: {"match":{"envs":["production"]},"action":"require","min_approvals":2,"approver_roles":["sre"],"no_self_approval":true}
+// 或:   {"match":{"envs":["staging"],"trigger_sources":["ci"]},"action":"auto_approve"}
+type approvalRule struct {
+	Match          approvalMatch `json:"match"`
+	Action         string        `json:"action"`
+	MinApprovals   int           `json:"min_approvals"`
+	ApproverRoles  []string      `json:"approver_roles"`
+	NoSelfApproval bool          `json:"no_self_approval"`
+	Priority       int           `json:"priority"`
+}
+
+// approvalMatch 描述策略的匹配条件, 空列表表示不限制该维度。
+type approvalMatch struct {
+	ServiceIDs     []uint               `json:"service_ids"`
+	TargetIDs      []uint               `json:"target_ids"`
+	Envs           []string             `json:"envs"`
+	Runtimes       []string             `json:"runtimes"`
+	TriggerSources []string             `json:"trigger_sources"`
+	TimeWindows    []approvalTimeWindow `json:"time_windows"`
+}
+
+// approvalTimeWindow 是按星期与时刻限定的生效时间段; End 早于 Start 表示跨越午夜。
+type approvalTimeWindow struct {
+	Days     []int  `json:"days"` // 0=周日 ... 6=周六, 为空表示每天
+	Start    string `json:"start"`
+	End      string `json:"end"`
+	Timezone string `json:"timezone"`
+}
+
+// approvalDecision 是一次发布的审批判定结果, 同时作为规则快照保存在审批单上, 供投票时校验。
+type approvalDecision struct {
+	Required       bool     `json:"required"`
+	MinApprovals   int      `json:"min_approvals"`
+	ApproverRoles  []string `json:"approver_roles,omitempty"`
+	NoSelfApproval bool     `json:"no_self_approval"`
+	PolicyID       uint     `json:"policy_id,omitempty"`
+	PolicyName     string   `json:"policy_name,omitempty"`
+	Source         string   `json:"source"`
+	Reason         string   `json:"reason"`
+}
+
+// approvalInput 是审批判定所需的发布上下文。
+type approvalInput struct {
+	ServiceID     uint
+	TargetID      uint
+	Env           string
+	Runtime       string
+	TriggerSource string
+	Now           time.Time
+}
+
+// parseApprovalRule 解析并校验审批策略配置。
+func parseApprovalRule(raw map[string]any) (approvalRule, error) {
+	var rule approvalRule
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return rule, err
+	}
+	if err := json.Unmarshal(data, &rule); err != nil {
+		return rule, fmt.Errorf("invalid approval policy config: %w", err)
+	}
+	rule.Action = strings.TrimSpace(defaultIfEmpty(rule.Action, approvalActionRequire))
+	if rule.Action != approvalActionRequire && rule.Action != approvalActionAutoApprove {
+		return rule, fmt.Errorf("approval policy action must be one of: require, auto_approve")
+	}
+	if rule.MinApprovals < 0 {
+		return rule, fmt.Errorf("approval policy min_approvals must not be negative")
+	}
+	if rule.MinApprovals == 0 {
+		rule.MinApprovals = 1
+	}
+	for _, w := range rule.Match.TimeWindows {
+		if _, err := parseClock(w.Start); err != nil {
+			return rule, err
+		}
+		if _, err := parseClock(w.End); err != nil {
+			return rule, err
+		}
+		if strings.TrimSpace(w.Timezone) != "" {
+			if _, err := time.LoadLocation(w.Timezone); err != nil {
+				return rule, fmt.Errorf("invalid time window timezone %q", w.Timezone)
+			}
+		}
+		for _, d := range w.Days {
+			if d < 0 || d > 6 {
+				return rule, fmt.Errorf("time window day %d must be between 0 (Sunday) and 6 (Saturday)", d)
+			}
+		}
+	}
+	return rule, nil
+}
+
+// parseClock 把 HH:MM 解析为当天的分钟数。
+func parseClock(v string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(v))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", v)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (w approvalTimeWindow) contains(now time.Time) bool {
+	loc := time.Local
+	if strings.TrimSpace(w.Timezone) != "" {
+		if l, err := time.LoadLocation(w.Timezone); err == nil {
+			loc = l
+		}
+	}
+	local := now.In(loc)
+	start, err1 := parseClock(w.Start)
+	end, err2 := parseClock(w.End)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	minute := local.Hour()*60 + local.Minute()
+	day := int(local.Weekday())
+	inRange := false
+	switch {
+	case start == end:
+		inRange = true
+	case start < end:
+		inRange = minute >= start && minute < end
+	default:
+		// 跨午夜: 凌晨部分属于前一天的时间段。
+		if minute >= start {
+			inRange = true
+		} else if minute < end {
+			inRange = true
+			day = (day + 6) % 7
+		}
+	}
+	if !inRange {
+		return false
+	}
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+func (m approvalMatch) matches(in approvalInput) bool {
+	if len(m.ServiceIDs) > 0 && !containsUint(m.ServiceIDs, in.ServiceID) {
+		return false
+	}
+	if len(m.TargetIDs) > 0 && !containsUint(m.TargetIDs, in.TargetID) {
+		return false
+	}
+	if len(m.Envs) > 0 && !containsFold(m.Envs, in.Env) {
+		return false
+	}
+	if len(m.Runtimes) > 0 && !containsFold(m.Runtimes, in.Runtime) {
+		return false
+	}
+	if len(m.TriggerSources) > 0 && !containsFold(m.TriggerSources, in.TriggerSource) {
+		return false
+	}
+	if len(m.TimeWindows) > 0 {
+		for _, w := range m.TimeWindows {
+			if w.contains(in.Now) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func containsUint(list []uint, v uint) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(list []string, v string) bool {
+	for _, item := range list {
+		if strings.EqualFold(strings.TrimSpace(item), strings.TrimSpace(v)) {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluateApproval 判定发布是否需要审批。
+//
+// 判定顺序:
+//  1. 启用的 approval 类型策略 (全局或绑定到该目标), 取优先级最高的命中策略; 同优先级时 require 优先于 auto_approve。
+//  2. 未命中策略时, 使用该目标/环境/运行时的 CICDDeploymentCDConfig.ApprovalRequired。
+//  3. 都没有时沿用默认规则: production 环境需要审批。
+func (l *Logic) evaluateApproval(ctx context.Context, in approvalInput) (approvalDecision, error) {
+	if in.Now.IsZero() {
+		in.Now = time.Now()
+	}
+	var policies []model.Policy
+	if err := l.svcCtx.DB.WithContext(ctx).
+		Where("type = ? AND enabled = ? AND (target_id = 0 OR target_id = ?)", model.PolicyTypeApproval, true, in.TargetID).
+		Order("id ASC").Find(&policies).Error; err != nil {
+		return approvalDecision{}, fmt.Errorf("load approval policies: %w", err)
+	}
+	type candidate struct {
+		policy model.Policy
+		rule   approvalRule
+	}
+	matched := make([]candidate, 0)
+	for _, p := range policies {
+		rule, err := parseApprovalRule(p.Config)
+		if err != nil {
+			continue
+		}
+		if rule.Match.matches(in) {
+			matched = append(matched, candidate{policy: p, rule: rule})
+		}
+	}
+	if len(matched) > 0 {
+		sort.SliceStable(matched, func(i, j int) bool {
+			if matched[i].rule.Priority != matched[j].rule.Priority {
+				return matched[i].rule.Priority > matched[j].rule.Priority
+			}
+			return matched[i].rule.Action == approvalActionRequire && matched[j].rule.Action != approvalActionRequire
+		})
+		winner := matched[0]
+		decision := approvalDecision{
+			Required:   winner.rule.Action == approvalActionRequire,
+			PolicyID:   winner.policy.ID,
+			PolicyName: winner.policy.Name,
+			Source:     approvalSourcePolicy,
+		}
+		if decision.Required {
+			decision.MinApprovals = winner.rule.MinApprovals
+			decision.ApproverRoles = winner.rule.ApproverRoles
+			decision.NoSelfApproval = winner.rule.NoSelfApproval
+			decision.Reason = fmt.Sprintf("policy %q requires %d approval(s)", winner.policy.Name, winner.rule.MinApprovals)
+		} else {
+			decision.Reason = fmt.Sprintf("policy %q auto-approves this release", winner.policy.Name)
+		}
+		return decision, nil
+	}
+
+	var cfg model.CICDDeploymentCDConfig
+	err := l.svcCtx.DB.WithContext(ctx).
+		Where("deployment_id = ? AND env = ? AND runtime_type = ?", in.TargetID, in.Env, in.Runtime).
+		First(&cfg).Error
+	switch {
+	case err == nil:
+		decision := approvalDecision{Required: cfg.ApprovalRequired, Source: approvalSourceCDConfig}
+		if cfg.ApprovalRequired {
+			decision.MinApprovals = 1
+			decision.Reason = "cd config requires approval"
+		} else {
+			decision.Reason = "cd config does not require approval"
+		}
+		return decision, nil
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return approvalDecision{}, fmt.Errorf("load cd config: %w", err)
+	}
+
+	if in.Env == "production" {
+		return approvalDecision{Required: true, MinApprovals: 1, Source: approvalSourceDefault, Reason: "production releases require approval"}, nil
+	}
+	return approvalDecision{Source: approvalSourceDefault, Reason: "non-production release"}, nil
+}
+
+func approvalDecisionFromRule(approval *model.DeploymentReleaseApproval) approvalDecision {
+	decision := approvalDecision{Required: true, MinApprovals: 1, Source: approvalSourceDefault}
+	if strings.TrimSpace(approval.RuleJSON) != "" {
+		_ = json.Unmarshal([]byte(approval.RuleJSON), &decision)
+	}
+	if approval.RequiredApprovals > 0 {
+		decision.MinApprovals = approval.RequiredApprovals
+	}
+	if decision.MinApprovals <= 0 {
+		decision.MinApprovals = 1
+	}
+	return decision
+}
+
+func (l *Logic) userRoleCodes(ctx context.Context, uid uint64) ([]string, error) {
+	var codes []string
+	err := l.svcCtx.DB.WithContext(ctx).
+		Table("user_roles").
+		Select("roles.code").
+		Joins("JOIN roles ON roles.id = user_roles.role_id").
+		Where("user_roles.user_id = ? AND roles.status = ?", uid, 1).
+		Pluck("roles.code", &codes).Error
+	return codes, err
+}
+
+// checkApprover 校验投票人是否满足审批单的规则, 返回投票人的角色编码。
+func (l *Logic) checkApprover(ctx context.Context, approval *model.DeploymentReleaseApproval, decision approvalDecision, uid uint64, decisionValue string) ([]string, error) {
+	if decisionValue == "approved" && decision.NoSelfApproval && approval.RequestedBy == uint(uid) {
+		return nil, fmt.Errorf("self-approval is not allowed by approval policy")
+	}
+	var existing int64
+	if err := l.svcCtx.DB.WithContext(ctx).Model(&model.DeploymentReleaseApprovalVote{}).
+		Where("approval_id = ? AND voter_id = ?", approval.ID, uid).
+		Count(&existing).Error; err != nil {
+		return nil, err
+	}
+	if existing > 0 {
+		return nil, fmt.Errorf("user %d has already voted on approval %s", uid, approval.Ticket)
+	}
+	if len(decision.ApproverRoles) == 0 {
+		return nil, nil
+	}
+	roles, err := l.userRoleCodes(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	for _, role := range roles {
+		if containsFold(decision.ApproverRoles, role) {
+			return roles, nil
+		}
+	}
+	return nil, fmt.Errorf("approver must have one of roles: %s", strings.Join(decision.ApproverRoles, ", "))
+}
+
+// recordApprovalVote 写入一张投票, 并按投票记录重新统计通过票数。
+func (l *Logic) recordApprovalVote(ctx context.Context, approval *model.DeploymentReleaseApproval, uid uint64, decisionValue, comment string, roles []string) error {
+	vote := model.DeploymentReleaseApprovalVote{
+		ApprovalID: approval.ID,
+		ReleaseID:  approval.ReleaseID,
+		VoterID:    uint(uid),
+		Decision:   decisionValue,
+		Comment:    strings.TrimSpace(comment),
+		VoterRoles: strings.Join(roles, ","),
+	}
+	if err := l.svcCtx.DB.WithContext(ctx).Create(&vote).Error; err != nil {
+		return err
+	}
+	// 通过票数以投票记录为准, 并发投票时各请求读到的审批单计数可能已经过期。
+	var approved int64
+	if err := l.svcCtx.DB.WithContext(ctx).Model(&model.DeploymentReleaseApprovalVote{}).
+		Where("approval_id = ? AND decision = ?", approval.ID, "approved").Count(&approved).Error; err != nil {
+		return err
+	}
+	approval.ApprovedCount = int(approved)
+	approval.Comment = strings.TrimSpace(comment)
+	approval.ApproverID = uint(uid)
+	return nil
+}
+
+// ListReleaseApprovalVotes 返回发布审批的投票记录。
+func (l *Logic) ListReleaseApprovalVotes(ctx context.Context, releaseID uint) ([]model.DeploymentReleaseApprovalVote, error) {
+	var rows []model.DeploymentReleaseApprovalVote
+	err := l.svcCtx.DB.WithContext(ctx).Where("release_id = ?", releaseID).Order("id ASC").Find(&rows).Error
+	return rows, err
+}
@@ -0,0 +1,264 @@
+package deployment
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cy77cc/OpsPilot/internal/model"
+)
+
+func (s *releaseTestSuite) createApprovalPolicy(t *testing.T, name string, targetID uint, config map[string]any) *model.Policy {
+	t.Helper()
+	policy := &model.Policy{Name: name, Type: model.PolicyTypeApproval, TargetID: targetID, Config: config, Enabled: true}
+	if err := s.db.Create(policy).Error; err != nil {
+		t.Fatalf("failed to create policy: %v", err)
+	}
+	return policy
+}
+
+func (s *releaseTestSuite) createPendingApproval(t *testing.T, releaseID uint, requestedBy uint, decision approvalDecision) *model.DeploymentReleaseApproval {
+	t.Helper()
+	approval := &model.DeploymentReleaseApproval{
+		ReleaseID:         releaseID,
+		Ticket:            "dep-appr-" + t.Name(),
+		Decision:          "pending",
+		RequestedBy:       requestedBy,
+		RequiredApprovals: decision.MinApprovals,
+		RuleJSON:          toJSON(decision),
+	}
+	if err := s.db.Create(approval).Error; err != nil {
+		t.Fatalf("failed to create approval: %v", err)
+	}
+	return approval
+}
+
+func TestEvaluateApproval_DefaultAndCDConfig(t *testing.T) {
+	suite := newReleaseTestSuite(t)
+	ctx := context.Background()
+
+	prod, err := suite.logic.evaluateApproval(ctx, approvalInput{TargetID: 1, Env: "production", Runtime: "k8s"})
+	if err != nil {
+		t.Fatalf("evaluate: %v", err)
+	}
+	if !prod.Required || prod.Source != approvalSourceDefault || prod.MinApprovals != 1 {
+		t.Fatalf("expected default production approval, got %+v", prod)
+	}
+
+	if err := suite.db.Create(&model.CICDDeploymentCDConfig{DeploymentID: 2, Env: "staging", RuntimeType: "k8s", Strategy: "rolling", ApprovalRequired: true}).Error; err != nil {
+		t.Fatalf("create cd config: %v", err)
+	}
+	staging, err := suite.logic.evaluateApproval(ctx, approvalInput{TargetID: 2, Env: "staging", Runtime: "k8s"})
+	if err != nil {
+		t.Fatalf("evaluate: %v", err)
+	}
+	if !staging.Required || staging.Source != approvalSourceCDConfig {
+		t.Fatalf("expected cd config to require approval, got %+v", staging)
+	}
+}
+
+func TestEvaluateApproval_PolicyMatching(t *testing.T) {
+	suite := newReleaseTestSuite(t)
+	ctx := context.Background()
+
+	suite.createApprovalPolicy(t, "prod-quorum", 0, map[string]any{
+		"match":            map[string]any{"envs": []string{"production"}},
+		"action":           "require",
+		"min_approvals":    2,
+		"approver_roles":   []string{"sre"},
+		"no_self_approval": true,
+	})
+	suite.createApprovalPolicy(t, "ci-staging", 0, map[string]any{
+		"match":  map[string]any{"envs": []string{"staging"}, "trigger_sources": []string{"ci"}},
+		"action": "auto_approve",
+	})
+	if err := suite.db.Create(&model.CICDDeploymentCDConfig{DeploymentID: 3, Env: "staging", RuntimeType: "k8s", Strategy: "rolling", ApprovalRequired: true}).Error; err != nil {
+		t.Fatalf("create cd config: %v", err)
+	}
+
+	prod, err := suite.logic.evaluateApproval(ctx, approvalInput{TargetID: 3, Env: "production", Runtime: "k8s", TriggerSource: "manual"})
+	if err != nil {
+		t.Fatalf("evaluate: %v", err)
+	}
+	if !prod.Required || prod.MinApprovals != 2 || !prod.NoSelfApproval || prod.Source != approvalSourcePolicy {
+		t.Fatalf("unexpected production decision: %+v", prod)
+	}
+
+	ci, err := suite.logic.evaluateApproval(ctx, approvalInput{TargetID: 3, Env: "staging", Runtime: "k8s", TriggerSource: "ci"})
+	if err != nil {
+		t.Fatalf("evaluate: %v", err)
+	}
+	if ci.Required || ci.Source != approvalSourcePolicy {
+		t.Fatalf("expected ci staging to be auto-approved by policy, got %+v", ci)
+	}
+
+	manual, err := suite.logic.evaluateApproval(ctx, approvalInput{TargetID: 3, Env: "staging", Runtime: "k8s", TriggerSource: "manual"})
+	if err != nil {
+		t.Fatalf("evaluate: %v", err)
+	}
+	if !manual.Required || manual.Source != approvalSourceCDConfig {
+		t.Fatalf("expected manual staging to fall back to cd config, got %+v", manual)
+	}
+}
+
+func TestEvaluateApproval_PriorityAndRequireWins(t *testing.T) {
+	suite := newReleaseTestSuite(t)
+	ctx := context.Background()
+
+	suite.createApprovalPolicy(t, "auto", 0, map[string]any{"action": "auto_approve"})
+	suite.createApprovalPolicy(t, "require", 0, map[string]any{"action": "require"})
+	decision, err := suite.logic.evaluateApproval(ctx, approvalInput{TargetID: 1, Env: "dev", Runtime: "k8s"})
+	if err != nil {
+		t.Fatalf("evaluate: %v", err)
+	}
+	if !decision.Required || decision.PolicyName != "require" {
+		t.Fatalf("expected require to win a priority tie, got %+v", decision)
+	}
+
+	suite.createApprovalPolicy(t, "auto-high", 1, map[string]any{"action": "auto_approve", "priority": 10})
+	decision, err = suite.logic.evaluateApproval(ctx, approvalInput{TargetID: 1, Env: "dev", Runtime: "k8s"})
+	if err != nil {
+		t.Fatalf("evaluate: %v", err)
+	}
+	if decision.Required || decision.PolicyName != "auto-high" {
+		t.Fatalf("expected higher priority policy to win, got %+v", decision)
+	}
+}
+
+func TestApprovalTimeWindow_Overnight(t *testing.T) {
+	w := approvalTimeWindow{Days: []int{5}, Start: "22:00", End: "06:00", Timezone: "UTC"}
+	cases := []struct {
+		at   time.Time
+		want bool
+	}{
+		{time.Date(2026, 10, 16, 23, 0, 0, 0, time.UTC), true},  // 周五 23:00
+		{time.Date(2026, 10, 17, 3, 0, 0, 0, time.UTC), true},   // 周六凌晨, 属于周五的时间段
+		{time.Date(2026, 10, 17, 23, 0, 0, 0, time.UTC), false}, // 周六 23:00
+		{time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC), false},
+	}
+	for _, tc := range cases {
+		if got := w.contains(tc.at); got != tc.want {
+			t.Errorf("contains(%s) = %v, want %v", tc.at, got, tc.want)
+		}
+	}
+}
+
+func TestParseApprovalRule_Validation(t *testing.T) {
+	if _, err := parseApprovalRule(map[string]any{"action": "maybe"}); err == nil {
+		t.Fatal("expected invalid action error")
+	}
+	if _, err := parseApprovalRule(map[string]any{"match": map[string]any{"time_windows": []any{map[string]any{"start": "25:00", "end": "06:00"}}}}); err == nil {
+		t.Fatal("expected invalid time error")
+	}
+	rule, err := parseApprovalRule(map[string]any{})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if rule.Action != approvalActionRequire || rule.MinApprovals != 1 {
+		t.Fatalf("unexpected defaults: %+v", rule)
+	}
+}
+
+func TestApproveRelease_Quorum(t *testing.T) {
+	suite := newReleaseTestSuite(t)
+	ctx := context.Background()
+
+	svc := suite.createTestService(t)
+	cluster := suite.createTestCluster(t)
+	target := suite.createTestTarget(t, cluster.ID)
+	release := suite.createTestRelease(t, svc.ID, target.ID, releaseStatusPendingApproval)
+	approval := suite.createPendingApproval(t, release.ID, 1, approvalDecision{Required: true, MinApprovals: 2, NoSelfApproval: true, Source: approvalSourcePolicy})
+
+	if _, err := suite.logic.ApproveRelease(ctx, release.ID, 1, "self"); err == nil {
+		t.Fatal("expected self-approval to be rejected")
+	}
+
+	resp, err := suite.logic.ApproveRelease(ctx, release.ID, 2, "lgtm")
+	if err != nil {
+		t.Fatalf("first vote: %v", err)
+	}
+	if resp.Status != releaseStatusPendingApproval || resp.ApprovedCount != 1 || resp.RequiredApprovals != 2 {
+		t.Fatalf("expected release to wait for quorum, got %+v", resp)
+	}
+	if _, err := suite.logic.ApproveRelease(ctx, release.ID, 2, "again"); err == nil {
+		t.Fatal("expected duplicate vote to be rejected")
+	}
+
+	// 达到法定票数后会尝试执行发布, 测试环境没有集群连接, 执行错误可以忽略。
+	_, _ = suite.logic.ApproveRelease(ctx, release.ID, 3, "lgtm")
+
+	var updated model.DeploymentReleaseApproval
+	if err := suite.db.First(&updated, approval.ID).Error; err != nil {
+		t.Fatalf("load approval: %v", err)
+	}
+	if updated.Decision != "approved" || updated.ApprovedCount != 2 {
+		t.Fatalf("expected approval to reach quorum, got decision=%s count=%d", updated.Decision, updated.ApprovedCount)
+	}
+	votes, err := suite.logic.ListReleaseApprovalVotes(ctx, release.ID)
+	if err != nil {
+		t.Fatalf("list votes: %v", err)
+	}
+	if len(votes) != 2 {
+		t.Fatalf("expected 2 votes, got %d", len(votes))
+	}
+}
+
+func TestApproveRelease_ApproverRoles(t *testing.T) {
+	suite := newReleaseTestSuite(t)
+	ctx := context.Background()
+
+	role := &model.Role{Name: "SRE", Code: "sre", Status: 1}
+	if err := suite.db.Create(role).Error; err != nil {
+		t.Fatalf("create role: %v", err)
+	}
+	if err := suite.db.Create(&model.UserRole{UserID: 7, RoleID: int64(role.ID)}).Error; err != nil {
+		t.Fatalf("create user role: %v", err)
+	}
+
+	svc := suite.createTestService(t)
+	cluster := suite.createTestCluster(t)
+	target := suite.createTestTarget(t, cluster.ID)
+	release := suite.createTestRelease(t, svc.ID, target.ID, releaseStatusPendingApproval)
+	suite.createPendingApproval(t, release.ID, 1, approvalDecision{Required: true, MinApprovals: 1, ApproverRoles: []string{"sre"}, Source: approvalSourcePolicy})
+
+	if _, err := suite.logic.RejectRelease(ctx, release.ID, 5, "no"); err == nil {
+		t.Fatal("expected user without approver role to be refused")
+	}
+	resp, err := suite.logic.RejectRelease(ctx, release.ID, 7, "not now")
+	if err != nil {
+		t.Fatalf("reject: %v", err)
+	}
+	if resp.Status != releaseStatusRejected {
+		t.Fatalf("expected rejected status, got %s", resp.Status)
+	}
+	votes, _ := suite.logic.ListReleaseApprovalVotes(ctx, release.ID)
+	if len(votes) != 1 || votes[0].VoterRoles != "sre" || votes[0].Decision != "rejected" {
+		t.Fatalf("unexpected votes: %+v", votes)
+	}
+}
+
+func TestApproveRelease_CountsVotesFromRows(t *testing.T) {
+	suite := newReleaseTestSuite(t)
+	ctx := context.Background()
+
+	svc := suite.createTestService(t)
+	cluster := suite.createTestCluster(t)
+	target := suite.createTestTarget(t, cluster.ID)
+	release := suite.createTestRelease(t, svc.ID, target.ID, releaseStatusPendingApproval)
+	approval := suite.createPendingApproval(t, release.ID, 1, approvalDecision{Required: true, MinApprovals: 2, Source: approvalSourcePolicy})
+
+	// 模拟并发投票: 另一请求的投票已落库, 但审批单上的计数被覆盖为旧值。
+	if err := suite.db.Create(&model.DeploymentReleaseApprovalVote{ApprovalID: approval.ID, ReleaseID: release.ID, VoterID: 2, Decision: "approved"}).Error; err != nil {
+		t.Fatalf("create vote: %v", err)
+	}
+	_, _ = suite.logic.ApproveRelease(ctx, release.ID, 3, "lgtm")
+
+	var updated model.DeploymentReleaseApproval
+	if err := suite.db.First(&updated, approval.ID).Error; err != nil {
+		t.Fatalf("load approval: %v", err)
+	}
+	if updated.Decision != "approved" || updated.ApprovedCount != 2 {
+		t.Fatalf("expected quorum from vote rows, got decision=%s count=%d", updated.Decision, updated.ApprovedCount)
+	}
+
+}
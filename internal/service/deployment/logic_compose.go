@@ -2,9 +2,10 @@ package deployment
 
 import (
 	"context"
-	"encoding/base64"
 	"fmt"
+	"net/http"
 	"strings"
+	"time"
 
 	sshclient "github.com/cy77cc/OpsPilot/internal/client/ssh"
 	"github.com/cy77cc/OpsPilot/internal/config"
@@ -13,12 +14,19 @@ import (
 	"github.com/cy77cc/OpsPilot/internal/utils"
 )
 
-func (l *Logic) applyComposeRelease(ctx context.Context, target *model.DeploymentTarget, releaseID uint, manifest string) (string, error) {
-	node, err := l.pickComposeNode(ctx, target.ID)
-	if err != nil {
-		return "", err
-	}
-	privateKey, passphrase, err := l.loadNodePrivateKey(ctx, node)
+// applyComposeRelease 把 compose 清单按批次滚动发布到目标的全部节点。
+func (l *Logic) applyComposeRelease(ctx context.Context, target *model.DeploymentTarget, release *model.DeploymentRelease, manifest string) (string, error) {
+	rollout := &composeRollout{logic: l, runner: &sshComposeRunner{logic: l}, httpClient: &http.Client{Timeout: 10 * time.Second}, interval: composeHealthInterval}
+	return rollout.Run(ctx, release, target, manifest)
+}
+
+// sshComposeRunner 通过 SSH 在节点上执行命令。
+type sshComposeRunner struct {
+	logic *Logic
+}
+
+func (r *sshComposeRunner) Run(ctx context.Context, node *model.Node, cmd string) (string, error) {
+	privateKey, passphrase, err := r.logic.loadNodePrivateKey(ctx, node)
 	if err != nil {
 		return "", err
 	}
@@ -31,37 +39,40 @@ func (l *Logic) applyComposeRelease(ctx context.Context, target *model.Deploymen
 		return "", err
 	}
 	defer cli.Close()
-
-	workDir := fmt.Sprintf("/tmp/opspilot/releases/%d", releaseID)
-	composeFile := fmt.Sprintf("%s/docker-compose.yaml", workDir)
-	encoded := base64.StdEncoding.EncodeToString([]byte(manifest))
-	cmd := fmt.Sprintf("command -v docker >/dev/null 2>&1 && docker compose version >/dev/null 2>&1 && mkdir -p %s && echo '%s' | base64 -d > %s && docker compose -f %s pull && docker compose -f %s up -d && docker compose -f %s ps", workDir, encoded, composeFile, composeFile, composeFile, composeFile)
-	out, err := sshclient.RunCommand(cli, cmd)
-	if err != nil {
-		return out, err
-	}
-	return out, nil
+	return sshclient.RunCommand(cli, cmd)
 }
 
-func (l *Logic) pickComposeNode(ctx context.Context, targetID uint) (*model.Node, error) {
+// composeTargetNodes 返回目标的全部活跃节点: manager 优先, 其次按权重从高到低。
+// 不满足运维条件的节点单独返回, 由调用方记录为跳过。
+func (l *Logic) composeTargetNodes(ctx context.Context, targetID uint) ([]composeRolloutNode, []composeNodeResult, error) {
 	var links []model.DeploymentTargetNode
 	if err := l.svcCtx.DB.WithContext(ctx).
 		Where("target_id = ? AND status = ?", targetID, "active").
-		Order("CASE WHEN role = 'manager' THEN 0 ELSE 1 END, id ASC").
+		Order("CASE WHEN role = 'manager' THEN 0 ELSE 1 END, weight DESC, id ASC").
 		Find(&links).Error; err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if len(links) == 0 {
-		return nil, fmt.Errorf("compose target has no active nodes")
+		return nil, nil, fmt.Errorf("compose target has no active nodes")
 	}
-	var node model.Node
-	if err := l.svcCtx.DB.WithContext(ctx).First(&node, links[0].HostID).Error; err != nil {
-		return nil, err
+	nodes := make([]composeRolloutNode, 0, len(links))
+	skipped := make([]composeNodeResult, 0)
+	for _, link := range links {
+		var node model.Node
+		if err := l.svcCtx.DB.WithContext(ctx).First(&node, link.HostID).Error; err != nil {
+			skipped = append(skipped, composeNodeResult{HostID: link.HostID, Status: composeNodeSkipped, Message: "host not found"})
+			continue
+		}
+		if ok, reason := hostlogic.EvaluateOperationalEligibility(&node); !ok {
+			skipped = append(skipped, composeNodeResult{HostID: link.HostID, Name: node.Name, IP: node.IP, Status: composeNodeSkipped, Message: reason})
+			continue
+		}
+		nodes = append(nodes, composeRolloutNode{link: link, node: node})
 	}
-	if ok, reason := hostlogic.EvaluateOperationalEligibility(&node); !ok {
-		return nil, fmt.Errorf("compose target node unavailable: %s", reason)
+	if len(nodes) == 0 {
+		return nil, skipped, fmt.Errorf("compose target has no available nodes")
 	}
-	return &node, nil
+	return nodes, skipped, nil
 }
 
 func (l *Logic) loadNodePrivateKey(ctx context.Context, node *model.Node) (string, string, error) {
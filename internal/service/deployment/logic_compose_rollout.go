@@ -0,0 +1,510 @@
+package deployment
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cy77cc/OpsPilot/internal/model"
+)
+
+const (
+	composeRolloutKind = "compose_rolling"
+
+	composeHealthComposePS = "compose_ps"
+	composeHealthHTTP      = "http"
+	composeHealthNone      = "none"
+
+	composeNodePending  = "pending"
+	composeNodeHealthy  = "healthy"
+	composeNodeFailed   = "failed"
+	composeNodeSkipped  = "skipped"
+	composeNodeNotReady = "not_started"
+
+	defaultComposeHealthTimeout = 60 * time.Second
+	composeHealthInterval       = 5 * time.Second
+
+	composeReleaseRoot           = "/tmp/opspilot/releases"
+	defaultComposeRetainReleases = 5
+	maxLegacyComposeReleases     = 20
+)
+
+// composeRolloutConfig 是 compose 滚动发布的参数, 来自发布请求的 strategy_config。
+//
+//	batch_size: 每批节点数, 可写为整数或百分比 ("25%"), 默认 1
+//	max_retries: 单节点部署或健康检查失败后的重试次数, 默认 1; 重试耗尽则中止后续批次
+//	health_check: compose_ps (默认, 等待全部容器 running 且非 unhealthy) / http / none
+//	health_url: http 检查地址, {host} 替换为节点 IP
+//	health_timeout_seconds: 单次健康等待的超时时间, 默认 60
+//	retain_releases: 每个节点保留的发布目录数 (含本次), 默认 5
+type composeRolloutConfig struct {
+	BatchSize            int    `json:"batch_size,omitempty"`
+	BatchPercent         int    `json:"batch_percent,omitempty"`
+	MaxRetries           int    `json:"max_retries"`
+	HealthCheck          string `json:"health_check"`
+	HealthURL            string `json:"health_url,omitempty"`
+	HealthTimeoutSeconds int    `json:"health_timeout_seconds"`
+	RetainReleases       int    `json:"retain_releases"`
+}
+
+// composeNodeResult 记录单个节点的滚动结果。
+type composeNodeResult struct {
+	HostID   uint   `json:"host_id"`
+	Name     string `json:"name,omitempty"`
+	IP       string `json:"ip,omitempty"`
+	Batch    int    `json:"batch"`
+	Status   string `json:"status"`
+	Attempts int    `json:"attempts"`
+	Message  string `json:"message,omitempty"`
+}
+
+// composeRolloutState 保存在 DeploymentRelease.StrategyStateJSON 中, 描述 compose 滚动进度。
+type composeRolloutState struct {
+	Kind         string               `json:"kind"`
+	Project      string               `json:"project"`
+	Config       composeRolloutConfig `json:"config"`
+	Batches      int                  `json:"batches"`
+	CurrentBatch int                  `json:"current_batch"`
+	Nodes        []composeNodeResult  `json:"nodes"`
+	Halted       bool                 `json:"halted,omitempty"`
+	HaltReason   string               `json:"halt_reason,omitempty"`
+}
+
+type composeRolloutNode struct {
+	link model.DeploymentTargetNode
+	node model.Node
+}
+
+// composeNodeRunner 在节点上执行 shell 命令。
+type composeNodeRunner interface {
+	Run(ctx context.Context, node *model.Node, cmd string) (string, error)
+}
+
+// parseComposeRolloutConfig 解析并校验 compose 滚动参数。
+func parseComposeRolloutConfig(raw map[string]any) (composeRolloutConfig, error) {
+	cfg := composeRolloutConfig{BatchSize: 1, MaxRetries: 1, HealthCheck: composeHealthComposePS, HealthTimeoutSeconds: int(defaultComposeHealthTimeout.Seconds()), RetainReleases: defaultComposeRetainReleases}
+	if raw == nil {
+		return cfg, nil
+	}
+	if v, ok := raw["batch_size"]; ok {
+		switch val := v.(type) {
+		case string:
+			text := strings.TrimSpace(val)
+			if strings.HasSuffix(text, "%") {
+				pct, err := strconv.Atoi(strings.TrimSuffix(text, "%"))
+				if err != nil || pct <= 0 || pct > 100 {
+					return cfg, fmt.Errorf("batch_size percentage must be between 1%% and 100%%")
+				}
+				cfg.BatchSize, cfg.BatchPercent = 0, pct
+			} else {
+				n, err := strconv.Atoi(text)
+				if err != nil || n <= 0 {
+					return cfg, fmt.Errorf("batch_size must be a positive integer or percentage")
+				}
+				cfg.BatchSize = n
+			}
+		default:
+			n := intFromAny(val)
+			if n <= 0 {
+				return cfg, fmt.Errorf("batch_size must be a positive integer or percentage")
+			}
+			cfg.BatchSize = n
+		}
+	}
+	if v, ok := raw["max_retries"]; ok {
+		cfg.MaxRetries = intFromAny(v)
+		if cfg.MaxRetries < 0 {
+			return cfg, fmt.Errorf("max_retries must not be negative")
+		}
+	}
+	if v, ok := raw["health_check"].(string); ok && strings.TrimSpace(v) != "" {
+		cfg.HealthCheck = strings.TrimSpace(v)
+	}
+	switch cfg.HealthCheck {
+	case composeHealthComposePS, composeHealthNone:
+	case composeHealthHTTP:
+		url, _ := raw["health_url"].(string)
+		cfg.HealthURL = strings.TrimSpace(url)
+		if cfg.HealthURL == "" {
+			return cfg, fmt.Errorf("health_url is required when health_check is http")
+		}
+	default:
+		return cfg, fmt.Errorf("health_check must be one of: compose_ps, http, none")
+	}
+	if v, ok := raw["health_timeout_seconds"]; ok {
+		if n := intFromAny(v); n > 0 {
+			cfg.HealthTimeoutSeconds = n
+		}
+	}
+	if v, ok := raw["retain_releases"]; ok {
+		cfg.RetainReleases = intFromAny(v)
+		if cfg.RetainReleases < 1 {
+			return cfg, fmt.Errorf("retain_releases must be at least 1")
+		}
+	}
+	return cfg, nil
+}
+
+func intFromAny(v any) int {
+	switch val := v.(type) {
+	case int:
+		return val
+	case int64:
+		return int(val)
+	case float64:
+		return int(val)
+	case json.Number:
+		n, _ := val.Int64()
+		return int(n)
+	case string:
+		n, _ := strconv.Atoi(strings.TrimSpace(val))
+		return n
+	}
+	return 0
+}
+
+// batchSizeFor 按节点总数计算每批节点数。
+func (c composeRolloutConfig) batchSizeFor(total int) int {
+	size := c.BatchSize
+	if c.BatchPercent > 0 {
+		size = (total*c.BatchPercent + 99) / 100
+	}
+	if size <= 0 {
+		size = 1
+	}
+	if size > total {
+		size = total
+	}
+	return size
+}
+
+func (c composeRolloutConfig) planMessage(nodes int) string {
+	if nodes == 0 {
+		return "compose rolling: target has no active nodes"
+	}
+	size := c.batchSizeFor(nodes)
+	batches := (nodes + size - 1) / size
+	return fmt.Sprintf("compose rolling: %d node(s) in %d batch(es) of %d, health=%s, max_retries=%d, retain_releases=%d", nodes, batches, size, c.HealthCheck, c.MaxRetries, c.RetainReleases)
+}
+
+func newComposeRolloutState(cfg composeRolloutConfig) composeRolloutState {
+	return composeRolloutState{Kind: composeRolloutKind, Config: cfg}
+}
+
+// loadComposeRolloutState 读取发布上的 compose 滚动状态, 缺失时返回默认参数。
+func loadComposeRolloutState(release *model.DeploymentRelease) composeRolloutState {
+	var state composeRolloutState
+	if release != nil && strings.TrimSpace(release.StrategyStateJSON) != "" {
+		_ = json.Unmarshal([]byte(release.StrategyStateJSON), &state)
+	}
+	if state.Kind != composeRolloutKind {
+		cfg, _ := parseComposeRolloutConfig(nil)
+		return newComposeRolloutState(cfg)
+	}
+	if state.Config.HealthCheck == "" {
+		state.Config.HealthCheck = composeHealthComposePS
+	}
+	if state.Config.RetainReleases <= 0 {
+		state.Config.RetainReleases = defaultComposeRetainReleases
+	}
+	return state
+}
+
+// composeProjectName 返回服务在目标上的固定 compose 项目名, 各次发布与回滚共用同一项目,
+// 使 up --remove-orphans 能够移除清单中已删除的服务。
+func composeProjectName(serviceID, targetID uint) string {
+	return fmt.Sprintf("opspilot-s%d-t%d", serviceID, targetID)
+}
+
+// composeWorkDir 返回发布在节点上的目录: <root>/<project>/<release_id>。
+func composeWorkDir(project string, releaseID uint) string {
+	return fmt.Sprintf("%s/%s/%d", composeReleaseRoot, project, releaseID)
+}
+
+// composeDeployCommand 写入清单并以固定项目名启动。legacyIDs 是旧版按发布 ID 命名的项目,
+// 存在时先停止并删除其目录, 避免与固定项目争用端口。
+func composeDeployCommand(project string, releaseID uint, manifest string, legacyIDs []uint) string {
+	workDir := composeWorkDir(project, releaseID)
+	composeFile := fmt.Sprintf("%s/docker-compose.yaml", workDir)
+	encoded := base64.StdEncoding.EncodeToString([]byte(manifest))
+	compose := fmt.Sprintf("docker compose -p %s -f %s", project, composeFile)
+	teardown := ""
+	if len(legacyIDs) > 0 {
+		ids := make([]string, 0, len(legacyIDs))
+		for _, id := range legacyIDs {
+			ids = append(ids, strconv.FormatUint(uint64(id), 10))
+		}
+		teardown = fmt.Sprintf("for d in %s; do if [ -f %s/$d/docker-compose.yaml ]; then docker compose -p $d -f %s/$d/docker-compose.yaml down --remove-orphans; rm -rf %s/$d; fi; done; ",
+			strings.Join(ids, " "), composeReleaseRoot, composeReleaseRoot, composeReleaseRoot)
+	}
+	return fmt.Sprintf("command -v docker >/dev/null 2>&1 && docker compose version >/dev/null 2>&1 && mkdir -p %s && echo '%s' | base64 -d > %s && %s pull && { %s%s up -d --remove-orphans; } && %s ps",
+		workDir, encoded, composeFile, compose, teardown, compose, compose)
+}
+
+func composePSCommand(project string, releaseID uint) string {
+	return fmt.Sprintf("docker compose -p %s -f %s/docker-compose.yaml ps -a --format '{{.Name}}|{{.State}}|{{.Health}}|{{.ExitCode}}'", project, composeWorkDir(project, releaseID))
+}
+
+// composeGCCommand 按发布 ID 从新到旧保留 retain 个目录 (始终保留本次发布), 输出被删除的目录名。
+func composeGCCommand(project string, releaseID uint, retain int) string {
+	if retain < 1 {
+		retain = 1
+	}
+	return fmt.Sprintf("cd %s/%s 2>/dev/null || exit 0; ls -1 | grep -E '^[0-9]+$' | grep -vx %d | sort -rn | tail -n +%d | while read d; do rm -rf \"$d\" && echo \"$d\"; done",
+		composeReleaseRoot, project, releaseID, retain)
+}
+
+// composePSHealthy 解析 ps 输出: 所有容器 running, 且配置了健康检查的容器为 healthy。
+// ps -a 会列出已退出的容器, 以退出码 0 结束的一次性容器 (如迁移任务) 视为正常完成。
+func composePSHealthy(out string) (bool, string) {
+	lines := 0
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		lines++
+		parts := strings.Split(line, "|")
+		for len(parts) < 4 {
+			parts = append(parts, "")
+		}
+		name, state, health := parts[0], strings.ToLower(strings.TrimSpace(parts[1])), strings.ToLower(strings.TrimSpace(parts[2]))
+		if state == "exited" && strings.TrimSpace(parts[3]) == "0" {
+			continue
+		}
+		if state != "running" {
+			return false, fmt.Sprintf("container %s is %s", name, defaultIfEmpty(state, "unknown"))
+		}
+		if health != "" && health != "healthy" {
+			return false, fmt.Sprintf("container %s health is %s", name, health)
+		}
+	}
+	if lines == 0 {
+		return false, "no containers reported"
+	}
+	return true, ""
+}
+
+// composeRollout 按批次在节点上执行部署与健康门禁。
+type composeRollout struct {
+	logic      *Logic
+	runner     composeNodeRunner
+	httpClient *http.Client
+	interval   time.Duration
+}
+
+func (r *composeRollout) Run(ctx context.Context, release *model.DeploymentRelease, target *model.DeploymentTarget, manifest string) (string, error) {
+	l := r.logic
+	state := newComposeRolloutState(loadComposeRolloutState(release).Config)
+	state.Project = composeProjectName(release.ServiceID, release.TargetID)
+	deployCmd := composeDeployCommand(state.Project, release.ID, manifest, l.legacyComposeReleaseIDs(ctx, release))
+	nodes, skipped, err := l.composeTargetNodes(ctx, target.ID)
+	for _, s := range skipped {
+		l.writeReleaseAudit(ctx, release.ID, release.Operator, "release.node.skipped", s)
+	}
+	if err != nil {
+		return "", err
+	}
+	size := state.Config.batchSizeFor(len(nodes))
+	state.Batches = (len(nodes) + size - 1) / size
+	state.Nodes = make([]composeNodeResult, 0, len(nodes)+len(skipped))
+	for i, n := range nodes {
+		state.Nodes = append(state.Nodes, composeNodeResult{HostID: uint(n.node.ID), Name: n.node.Name, IP: n.node.IP, Batch: i/size + 1, Status: composeNodePending})
+	}
+	state.Nodes = append(state.Nodes, skipped...)
+	r.save(ctx, release, state)
+
+	var outputs []string
+	for batch := 1; batch <= state.Batches; batch++ {
+		state.CurrentBatch = batch
+		members := make([]int, 0, size)
+		for i := range nodes {
+			if state.Nodes[i].Batch == batch {
+				members = append(members, i)
+			}
+		}
+		names := make([]string, 0, len(members))
+		for _, i := range members {
+			names = append(names, state.Nodes[i].Name)
+		}
+		l.writeReleaseAudit(ctx, release.ID, release.Operator, "release.batch.started", map[string]any{"batch": batch, "batches": state.Batches, "nodes": names})
+		r.save(ctx, release, state)
+
+		results := make([]composeNodeResult, len(members))
+		logs := make([]string, len(members))
+		var wg sync.WaitGroup
+		for k, i := range members {
+			wg.Add(1)
+			go func(k int, n composeRolloutNode, res composeNodeResult) {
+				defer wg.Done()
+				results[k], logs[k] = r.rollNode(ctx, release.ID, state.Project, deployCmd, &n.node, res, state.Config)
+			}(k, nodes[i], state.Nodes[i])
+		}
+		wg.Wait()
+
+		failed := make([]string, 0)
+		for k, i := range members {
+			state.Nodes[i] = results[k]
+			outputs = append(outputs, fmt.Sprintf("[%s %s]\n%s", results[k].Name, results[k].IP, logs[k]))
+			action := "release.node.applied"
+			if results[k].Status != composeNodeHealthy {
+				action = "release.node.failed"
+				failed = append(failed, results[k].Name)
+			}
+			l.writeReleaseAudit(ctx, release.ID, release.Operator, action, map[string]any{
+				"host_id":  results[k].HostID,
+				"name":     results[k].Name,
+				"ip":       results[k].IP,
+				"batch":    batch,
+				"attempts": results[k].Attempts,
+				"message":  results[k].Message,
+				"output":   truncateText(logs[k], 800),
+			})
+		}
+		if len(failed) > 0 {
+			state.Halted = true
+			state.HaltReason = fmt.Sprintf("batch %d unhealthy: %s", batch, strings.Join(failed, ", "))
+			for i := range nodes {
+				if state.Nodes[i].Batch > batch {
+					state.Nodes[i].Status = composeNodeNotReady
+				}
+			}
+			r.save(ctx, release, state)
+			l.writeReleaseAudit(ctx, release.ID, release.Operator, "release.rollout.halted", map[string]any{"batch": batch, "failed_nodes": failed})
+			return strings.Join(outputs, "\n"), fmt.Errorf("compose rollout halted: %s", state.HaltReason)
+		}
+		r.save(ctx, release, state)
+		l.writeReleaseAudit(ctx, release.ID, release.Operator, "release.batch.healthy", map[string]any{"batch": batch, "batches": state.Batches})
+	}
+	r.collectWorkDirs(ctx, release, state, nodes)
+	return strings.Join(outputs, "\n"), nil
+}
+
+// collectWorkDirs 在滚动成功后清理各节点上超出保留数的旧发布目录; 清理失败只记录, 不影响发布结果。
+func (r *composeRollout) collectWorkDirs(ctx context.Context, release *model.DeploymentRelease, state composeRolloutState, nodes []composeRolloutNode) {
+	cmd := composeGCCommand(state.Project, release.ID, state.Config.RetainReleases)
+	for i := range nodes {
+		node := &nodes[i].node
+		out, err := r.runner.Run(ctx, node, cmd)
+		detail := map[string]any{"host_id": node.ID, "name": node.Name, "project": state.Project, "retain": state.Config.RetainReleases}
+		if err != nil {
+			detail["error"] = truncateText(err.Error(), 300)
+			r.logic.writeReleaseAudit(ctx, release.ID, release.Operator, "release.workdir.gc_failed", detail)
+			continue
+		}
+		removed := strings.Fields(out)
+		if len(removed) == 0 {
+			continue
+		}
+		detail["removed"] = removed
+		r.logic.writeReleaseAudit(ctx, release.ID, release.Operator, "release.workdir.gc", detail)
+	}
+}
+
+// rollNode 在单个节点上部署并等待健康, 失败时按 max_retries 重试。
+func (r *composeRollout) rollNode(ctx context.Context, releaseID uint, project, deployCmd string, node *model.Node, res composeNodeResult, cfg composeRolloutConfig) (composeNodeResult, string) {
+	var out string
+	for attempt := 1; attempt <= cfg.MaxRetries+1; attempt++ {
+		res.Attempts = attempt
+		var err error
+		out, err = r.runner.Run(ctx, node, deployCmd)
+		if err != nil {
+			res.Status, res.Message = composeNodeFailed, truncateText(err.Error(), 300)
+			continue
+		}
+		if ok, reason := r.waitHealthy(ctx, project, releaseID, node, cfg); !ok {
+			res.Status, res.Message = composeNodeFailed, reason
+			continue
+		}
+		res.Status, res.Message = composeNodeHealthy, ""
+		return res, out
+	}
+	return res, out
+}
+
+func (r *composeRollout) waitHealthy(ctx context.Context, project string, releaseID uint, node *model.Node, cfg composeRolloutConfig) (bool, string) {
+	if cfg.HealthCheck == composeHealthNone {
+		return true, ""
+	}
+	timeout := time.Duration(cfg.HealthTimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = defaultComposeHealthTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	reason := "health check timed out"
+	for {
+		ok, why := r.checkHealth(ctx, project, releaseID, node, cfg)
+		if ok {
+			return true, ""
+		}
+		if why != "" {
+			reason = why
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return false, fmt.Sprintf("unhealthy after %s: %s", timeout, reason)
+		}
+		wait := r.interval
+		if wait > remaining {
+			wait = remaining
+		}
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err().Error()
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (r *composeRollout) checkHealth(ctx context.Context, project string, releaseID uint, node *model.Node, cfg composeRolloutConfig) (bool, string) {
+	switch cfg.HealthCheck {
+	case composeHealthHTTP:
+		url := strings.ReplaceAll(cfg.HealthURL, "{host}", node.IP)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return false, err.Error()
+		}
+		resp, err := r.httpClient.Do(req)
+		if err != nil {
+			return false, err.Error()
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return false, fmt.Sprintf("%s returned %d", url, resp.StatusCode)
+		}
+		return true, ""
+	default:
+		out, err := r.runner.Run(ctx, node, composePSCommand(project, releaseID))
+		if err != nil {
+			return false, truncateText(err.Error(), 300)
+		}
+		return composePSHealthy(out)
+	}
+}
+
+func (r *composeRollout) save(ctx context.Context, release *model.DeploymentRelease, state composeRolloutState) {
+	release.StrategyStateJSON = toJSON(state)
+	_ = r.logic.svcCtx.DB.WithContext(ctx).Model(release).Update("strategy_state_json", release.StrategyStateJSON).Error
+}
+
+// legacyComposeReleaseIDs 返回同一服务与目标的历史 compose 发布 ID, 用于清理旧版按发布 ID 命名的项目。
+func (l *Logic) legacyComposeReleaseIDs(ctx context.Context, release *model.DeploymentRelease) []uint {
+	var ids []uint
+	_ = l.svcCtx.DB.WithContext(ctx).Model(&model.DeploymentRelease{}).
+		Where("service_id = ? AND target_id = ? AND runtime_type = ? AND id < ?", release.ServiceID, release.TargetID, "compose", release.ID).
+		Order("id DESC").Limit(maxLegacyComposeReleases).Pluck("id", &ids).Error
+	return ids
+}
+
+// composeTargetNodeCount 返回目标活跃节点数, 用于预览滚动计划。
+func (l *Logic) composeTargetNodeCount(ctx context.Context, targetID uint) int {
+	var n int64
+	_ = l.svcCtx.DB.WithContext(ctx).Model(&model.DeploymentTargetNode{}).Where("target_id = ? AND status = ?", targetID, "active").Count(&n).Error
+	return int(n)
+}
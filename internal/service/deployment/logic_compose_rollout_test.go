@@ -0,0 +1,282 @@
+package deployment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cy77cc/OpsPilot/internal/model"
+)
+
+// fakeComposeRunner 按节点 IP 返回预设的部署与 ps 结果。
+type fakeComposeRunner struct {
+	mu        sync.Mutex
+	deploys   map[string]int
+	failPS    map[string]bool
+	failApply map[string]int // 前 N 次部署失败
+	gc        map[string]string
+	commands  []string
+}
+
+func newFakeComposeRunner() *fakeComposeRunner {
+	return &fakeComposeRunner{deploys: map[string]int{}, failPS: map[string]bool{}, failApply: map[string]int{}, gc: map[string]string{}}
+}
+
+func (f *fakeComposeRunner) Run(_ context.Context, node *model.Node, cmd string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.commands = append(f.commands, cmd)
+	if strings.Contains(cmd, "sort -rn") {
+		return f.gc[node.IP], nil
+	}
+	if strings.Contains(cmd, " ps -a ") {
+		if f.failPS[node.IP] {
+			return "app|exited|", nil
+		}
+		return "app|running|healthy\nworker|running|", nil
+	}
+	f.deploys[node.IP]++
+	if f.deploys[node.IP] <= f.failApply[node.IP] {
+		return "pull failed", fmt.Errorf("exit status 1")
+	}
+	return "started", nil
+}
+
+func (s *releaseTestSuite) createComposeTarget(t *testing.T, ips ...string) *model.DeploymentTarget {
+	t.Helper()
+	target := &model.DeploymentTarget{Name: "edge", TargetType: "compose", RuntimeType: "compose", Env: "production", Status: "active", ReadinessStatus: "ready"}
+	if err := s.db.Create(target).Error; err != nil {
+		t.Fatalf("create target: %v", err)
+	}
+	for i, ip := range ips {
+		node := &model.Node{Name: fmt.Sprintf("edge-%d", i+1), IP: ip, Status: "active", SSHUser: "root"}
+		if err := s.db.Create(node).Error; err != nil {
+			t.Fatalf("create node: %v", err)
+		}
+		if err := s.db.Create(&model.DeploymentTargetNode{TargetID: target.ID, HostID: uint(node.ID), Role: "worker", Weight: 100, Status: "active"}).Error; err != nil {
+			t.Fatalf("create target node: %v", err)
+		}
+	}
+	return target
+}
+
+func newTestComposeRollout(l *Logic, runner composeNodeRunner) *composeRollout {
+	return &composeRollout{logic: l, runner: runner, httpClient: &http.Client{Timeout: time.Second}, interval: 10 * time.Millisecond}
+}
+
+func TestParseComposeRolloutConfig(t *testing.T) {
+	cfg, err := parseComposeRolloutConfig(map[string]any{"batch_size": "50%", "max_retries": float64(2)})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if got := cfg.batchSizeFor(5); got != 3 {
+		t.Fatalf("expected 50%% of 5 nodes to round up to 3, got %d", got)
+	}
+	if cfg.MaxRetries != 2 || cfg.HealthCheck != composeHealthComposePS {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+	if _, err := parseComposeRolloutConfig(map[string]any{"health_check": "http"}); err == nil {
+		t.Fatal("expected http health check without url to fail")
+	}
+	if _, err := parseComposeRolloutConfig(map[string]any{"batch_size": 0}); err == nil {
+		t.Fatal("expected zero batch size to fail")
+	}
+}
+
+func TestComposePSHealthy(t *testing.T) {
+	if ok, _ := composePSHealthy("app|running|healthy\ndb|running|"); !ok {
+		t.Fatal("expected running containers to be healthy")
+	}
+	if ok, reason := composePSHealthy("app|running|starting"); ok || !strings.Contains(reason, "starting") {
+		t.Fatalf("expected starting container to be unhealthy, got %v %q", ok, reason)
+	}
+	if ok, _ := composePSHealthy(""); ok {
+		t.Fatal("expected empty ps output to be unhealthy")
+	}
+	if ok, reason := composePSHealthy("app|running||\nmigrate|exited||0"); !ok {
+		t.Fatalf("expected completed one-shot container to be ignored, got %q", reason)
+	}
+	if ok, reason := composePSHealthy("app|running||\nmigrate|exited||1"); ok || !strings.Contains(reason, "migrate") {
+		t.Fatalf("expected failed one-shot container to be unhealthy, got %v %q", ok, reason)
+	}
+}
+
+func TestComposeRollout_AllNodesInBatches(t *testing.T) {
+	suite := newReleaseTestSuite(t)
+	ctx := context.Background()
+	target := suite.createComposeTarget(t, "10.0.0.1", "10.0.0.2", "10.0.0.3")
+	release := suite.createTestRelease(t, 1, target.ID, releaseStatusApplying)
+	release.StrategyStateJSON = toJSON(newComposeRolloutState(composeRolloutConfig{BatchSize: 2, MaxRetries: 1, HealthCheck: composeHealthComposePS, HealthTimeoutSeconds: 1}))
+
+	runner := newFakeComposeRunner()
+	runner.failApply["10.0.0.3"] = 1
+	if _, err := newTestComposeRollout(suite.logic, runner).Run(ctx, release, target, "services: {}"); err != nil {
+		t.Fatalf("rollout: %v", err)
+	}
+	if len(runner.deploys) != 3 || runner.deploys["10.0.0.3"] != 2 {
+		t.Fatalf("expected every node deployed and one retry, got %v", runner.deploys)
+	}
+	var state composeRolloutState
+	if err := json.Unmarshal([]byte(release.StrategyStateJSON), &state); err != nil {
+		t.Fatalf("decode state: %v", err)
+	}
+	if state.Batches != 2 || len(state.Nodes) != 3 {
+		t.Fatalf("unexpected rollout state: %+v", state)
+	}
+	for _, n := range state.Nodes {
+		if n.Status != composeNodeHealthy {
+			t.Fatalf("expected all nodes healthy, got %+v", state.Nodes)
+		}
+	}
+
+	var count int64
+	suite.db.Model(&model.DeploymentReleaseAudit{}).Where("release_id = ? AND action = ?", release.ID, "release.node.applied").Count(&count)
+	if count != 3 {
+		t.Fatalf("expected 3 per-node timeline events, got %d", count)
+	}
+}
+
+func TestComposeRollout_HaltsOnUnhealthyBatch(t *testing.T) {
+	suite := newReleaseTestSuite(t)
+	ctx := context.Background()
+	target := suite.createComposeTarget(t, "10.0.1.1", "10.0.1.2", "10.0.1.3")
+	release := suite.createTestRelease(t, 1, target.ID, releaseStatusApplying)
+	release.StrategyStateJSON = toJSON(newComposeRolloutState(composeRolloutConfig{BatchSize: 1, MaxRetries: 1, HealthCheck: composeHealthComposePS, HealthTimeoutSeconds: 1}))
+
+	runner := newFakeComposeRunner()
+	runner.failPS["10.0.1.2"] = true
+	_, err := newTestComposeRollout(suite.logic, runner).Run(ctx, release, target, "services: {}")
+	if err == nil || !strings.Contains(err.Error(), "batch 2") {
+		t.Fatalf("expected rollout to halt at batch 2, got %v", err)
+	}
+	if runner.deploys["10.0.1.3"] != 0 {
+		t.Fatal("expected remaining batches not to be deployed")
+	}
+	if runner.deploys["10.0.1.2"] != 2 {
+		t.Fatalf("expected unhealthy node to be retried once, got %d deploys", runner.deploys["10.0.1.2"])
+	}
+	var state composeRolloutState
+	if err := json.Unmarshal([]byte(release.StrategyStateJSON), &state); err != nil {
+		t.Fatalf("decode state: %v", err)
+	}
+	if !state.Halted || state.Nodes[2].Status != composeNodeNotReady {
+		t.Fatalf("expected halted state with untouched last node, got %+v", state)
+	}
+}
+
+func TestComposeRollout_HTTPHealthCheck(t *testing.T) {
+	suite := newReleaseTestSuite(t)
+	ctx := context.Background()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("host") == "10.0.2.1" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	target := suite.createComposeTarget(t, "10.0.2.1")
+	release := suite.createTestRelease(t, 1, target.ID, releaseStatusApplying)
+	release.StrategyStateJSON = toJSON(newComposeRolloutState(composeRolloutConfig{BatchSize: 1, HealthCheck: composeHealthHTTP, HealthURL: srv.URL + "/healthz?host={host}", HealthTimeoutSeconds: 1}))
+	if _, err := newTestComposeRollout(suite.logic, newFakeComposeRunner()).Run(ctx, release, target, "services: {}"); err != nil {
+		t.Fatalf("rollout: %v", err)
+	}
+}
+
+func TestComposeDeployCommand_StableProject(t *testing.T) {
+	project := composeProjectName(3, 7)
+	cmd := composeDeployCommand(project, 42, "services: {}", []uint{40, 41})
+	if !strings.Contains(cmd, "docker compose -p opspilot-s3-t7 -f /tmp/opspilot/releases/opspilot-s3-t7/42/docker-compose.yaml up -d --remove-orphans") {
+		t.Fatalf("expected stable project up with --remove-orphans, got %s", cmd)
+	}
+	if !strings.Contains(cmd, "for d in 40 41;") {
+		t.Fatalf("expected legacy per-release projects to be torn down, got %s", cmd)
+	}
+	if strings.Contains(composeDeployCommand(project, 42, "services: {}", nil), "for d in") {
+		t.Fatal("expected no teardown loop without legacy releases")
+	}
+	gc := composeGCCommand(project, 42, 3)
+	if !strings.Contains(gc, "grep -vx 42") || !strings.Contains(gc, "tail -n +3") {
+		t.Fatalf("expected gc to keep the current release and 2 older ones, got %s", gc)
+	}
+}
+
+func TestComposeRollout_CollectsOldWorkDirs(t *testing.T) {
+	suite := newReleaseTestSuite(t)
+	ctx := context.Background()
+	target := suite.createComposeTarget(t, "10.0.3.1", "10.0.3.2")
+	release := suite.createTestRelease(t, 1, target.ID, releaseStatusApplying)
+	release.StrategyStateJSON = toJSON(newComposeRolloutState(composeRolloutConfig{BatchSize: 2, HealthCheck: composeHealthNone, RetainReleases: 2}))
+
+	runner := newFakeComposeRunner()
+	runner.gc["10.0.3.1"] = "3\n1\n"
+	if _, err := newTestComposeRollout(suite.logic, runner).Run(ctx, release, target, "services: {}"); err != nil {
+		t.Fatalf("rollout: %v", err)
+	}
+	var state composeRolloutState
+	if err := json.Unmarshal([]byte(release.StrategyStateJSON), &state); err != nil {
+		t.Fatalf("decode state: %v", err)
+	}
+	if state.Project != composeProjectName(1, target.ID) {
+		t.Fatalf("expected stable project name, got %q", state.Project)
+	}
+	gcRuns := 0
+	for _, cmd := range runner.commands {
+		if strings.Contains(cmd, "sort -rn") {
+			gcRuns++
+		}
+	}
+	if gcRuns != 2 {
+		t.Fatalf("expected gc on each node, got %d", gcRuns)
+	}
+	var audits []model.DeploymentReleaseAudit
+	suite.db.Where("release_id = ? AND action = ?", release.ID, "release.workdir.gc").Find(&audits)
+	if len(audits) != 1 || !strings.Contains(audits[0].DetailJSON, `"removed":["3","1"]`) {
+		t.Fatalf("expected one gc audit listing removed dirs, got %+v", audits)
+	}
+}
+
+func TestComposeRollout_HaltedRolloutKeepsWorkDirs(t *testing.T) {
+	suite := newReleaseTestSuite(t)
+	ctx := context.Background()
+	target := suite.createComposeTarget(t, "10.0.4.1")
+	release := suite.createTestRelease(t, 1, target.ID, releaseStatusApplying)
+	release.StrategyStateJSON = toJSON(newComposeRolloutState(composeRolloutConfig{BatchSize: 1, HealthCheck: composeHealthNone, RetainReleases: 1}))
+
+	runner := newFakeComposeRunner()
+	runner.failApply["10.0.4.1"] = 1
+	if _, err := newTestComposeRollout(suite.logic, runner).Run(ctx, release, target, "services: {}"); err == nil {
+		t.Fatal("expected rollout to fail")
+	}
+	for _, cmd := range runner.commands {
+		if strings.Contains(cmd, "sort -rn") {
+			t.Fatal("expected no gc after a halted rollout")
+		}
+	}
+}
+
+func TestPreviousSuccessfulRelease_SkipsFailed(t *testing.T) {
+	suite := newReleaseTestSuite(t)
+	ctx := context.Background()
+	good := suite.createTestRelease(t, 1, 1, releaseStatusApplied)
+	suite.createTestRelease(t, 1, 1, releaseStatusFailed)
+	current := suite.createTestRelease(t, 1, 1, releaseStatusApplied)
+
+	prev, err := suite.logic.previousSuccessfulRelease(ctx, current)
+	if err != nil {
+		t.Fatalf("previous release: %v", err)
+	}
+	if prev.ID != good.ID {
+		t.Fatalf("expected rollback target %d, got %d", good.ID, prev.ID)
+	}
+	if _, err := suite.logic.previousSuccessfulRelease(ctx, good); err == nil {
+		t.Fatal("expected no previous successful release before the first one")
+	}
+}
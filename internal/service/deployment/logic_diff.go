@@ -0,0 +1,188 @@
+package deployment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cy77cc/OpsPilot/internal/model"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	diffActionCreate    = "create"
+	diffActionChange    = "change"
+	diffActionUnchanged = "unchanged"
+	diffActionPrune     = "prune"
+	diffActionError     = "error"
+
+	dryRunTimeout        = 20 * time.Second
+	maxDiffChangesPerObj = 50
+)
+
+// diffIgnoredMetadata 是由服务端维护、不参与差异比较的元数据字段。
+var diffIgnoredMetadata = []string{"managedFields", "resourceVersion", "uid", "creationTimestamp", "generation", "selfLink"}
+
+// normalizeForDiff 去掉状态与服务端生成的元数据, 只保留用户可感知的期望状态。
+func normalizeForDiff(obj *unstructured.Unstructured) map[string]any {
+	if obj == nil {
+		return nil
+	}
+	cp := obj.DeepCopy()
+	unstructured.RemoveNestedField(cp.Object, "status")
+	for _, field := range diffIgnoredMetadata {
+		unstructured.RemoveNestedField(cp.Object, "metadata", field)
+	}
+	return cp.Object
+}
+
+// diffObjects 递归比较两个对象, 返回按路径排序的字段变化。
+func diffObjects(live, desired map[string]any) []ReleaseFieldChange {
+	out := make([]ReleaseFieldChange, 0)
+	diffValue("", live, desired, &out)
+	sort.Slice(out, func(i, j int) bool { return out[i].Path < out[j].Path })
+	return out
+}
+
+func diffValue(path string, before, after any, out *[]ReleaseFieldChange) {
+	bm, bok := before.(map[string]any)
+	am, aok := after.(map[string]any)
+	if bok && aok {
+		keys := make(map[string]struct{}, len(bm)+len(am))
+		for k := range bm {
+			keys[k] = struct{}{}
+		}
+		for k := range am {
+			keys[k] = struct{}{}
+		}
+		for k := range keys {
+			diffValue(joinDiffPath(path, k), bm[k], am[k], out)
+		}
+		return
+	}
+	bs, bok := before.([]any)
+	as, aok := after.([]any)
+	if bok && aok && len(bs) == len(as) {
+		for i := range bs {
+			diffValue(fmt.Sprintf("%s[%d]", path, i), bs[i], as[i], out)
+		}
+		return
+	}
+	if reflect.DeepEqual(before, after) {
+		return
+	}
+	*out = append(*out, ReleaseFieldChange{Path: path, Before: before, After: after})
+}
+
+func joinDiffPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// isDryRunRejection 判断错误是否来自 API Server 的校验、准入控制或未注册的资源类型, 而非连接故障。
+func isDryRunRejection(err error) bool {
+	if meta.IsNoMatchError(err) {
+		return true
+	}
+	var status apierrors.APIStatus
+	if !errors.As(err, &status) {
+		return false
+	}
+	return apierrors.IsInvalid(err) || apierrors.IsForbidden(err) || apierrors.IsBadRequest(err) ||
+		apierrors.IsConflict(err) || apierrors.IsNotFound(err) || apierrors.IsAlreadyExists(err)
+}
+
+// dryRunDiff 对清单中的每个对象执行服务端应用的 dry-run, 并与线上状态比较。
+// 校验与准入 webhook 的拒绝转换为 error 级别的检查项; 连接类错误直接返回, 由调用方降级为告警。
+func (l *Logic) dryRunDiff(ctx context.Context, applier manifestApplier, owner *model.DeploymentRelease, manifest string, prune []ReleaseInventoryItem) ([]ReleaseObjectDiff, []map[string]string, error) {
+	objs, err := decodeManifestObjects(manifest)
+	if err != nil {
+		return nil, nil, err
+	}
+	diffs := make([]ReleaseObjectDiff, 0, len(objs)+len(prune))
+	checks := make([]map[string]string, 0)
+	for _, obj := range objs {
+		withOwnershipLabels(obj, owner)
+		item := inventoryItemFromObject(obj)
+		live, err := applier.Get(ctx, item)
+		if err != nil {
+			if !isDryRunRejection(err) {
+				return nil, nil, err
+			}
+			live = nil
+		}
+		result, err := applier.DryRun(ctx, obj)
+		if err != nil {
+			if !isDryRunRejection(err) {
+				return nil, nil, err
+			}
+			diffs = append(diffs, ReleaseObjectDiff{Object: item, Action: diffActionError, Error: err.Error()})
+			checks = append(checks, map[string]string{"code": "dry_run_rejected", "message": fmt.Sprintf("%s: %s", item.String(), err.Error()), "level": "error"})
+			continue
+		}
+		item = inventoryItemFromObject(result)
+		if live == nil {
+			diffs = append(diffs, ReleaseObjectDiff{Object: item, Action: diffActionCreate})
+			continue
+		}
+		changes := diffObjects(normalizeForDiff(live), normalizeForDiff(result))
+		entry := ReleaseObjectDiff{Object: item, Action: diffActionUnchanged}
+		if len(changes) > 0 {
+			entry.Action = diffActionChange
+			if len(changes) > maxDiffChangesPerObj {
+				entry.Truncated = true
+				changes = changes[:maxDiffChangesPerObj]
+			}
+			entry.Changes = changes
+		}
+		diffs = append(diffs, entry)
+	}
+	for _, item := range prune {
+		live, err := applier.Get(ctx, item)
+		if err != nil || !ownedByRelease(live, owner) {
+			continue
+		}
+		diffs = append(diffs, ReleaseObjectDiff{Object: item, Action: diffActionPrune})
+	}
+	return diffs, checks, nil
+}
+
+func summarizeDiff(diffs []ReleaseObjectDiff) string {
+	counts := map[string]int{}
+	for _, d := range diffs {
+		counts[d.Action]++
+	}
+	parts := make([]string, 0, 5)
+	for _, action := range []string{diffActionCreate, diffActionChange, diffActionUnchanged, diffActionPrune, diffActionError} {
+		if counts[action] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[action], action))
+		}
+	}
+	if len(parts) == 0 {
+		return "dry-run: no objects"
+	}
+	return "dry-run: " + strings.Join(parts, ", ")
+}
+
+// previewClusterDiff 连接目标集群执行 dry-run, 返回对象差异与检查项。
+func (l *Logic) previewClusterDiff(ctx context.Context, serviceID uint, target *model.DeploymentTarget, manifest string, prune []ReleaseInventoryItem) ([]ReleaseObjectDiff, []map[string]string, error) {
+	var cluster model.Cluster
+	if err := l.svcCtx.DB.WithContext(ctx).First(&cluster, target.ClusterID).Error; err != nil {
+		return nil, nil, fmt.Errorf("cluster not found: %w", err)
+	}
+	applier, err := dynamicApplierForCluster(&cluster)
+	if err != nil {
+		return nil, nil, err
+	}
+	dryCtx, cancel := context.WithTimeout(ctx, dryRunTimeout)
+	defer cancel()
+	return l.dryRunDiff(dryCtx, applier, &model.DeploymentRelease{ServiceID: serviceID, TargetID: target.ID}, manifest, prune)
+}
@@ -0,0 +1,103 @@
+package deployment
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cy77cc/OpsPilot/internal/model"
+)
+
+func TestDiffObjects(t *testing.T) {
+	live := map[string]any{
+		"spec": map[string]any{"replicas": int64(2), "template": map[string]any{"image": "nginx:1.25"}},
+		"data": map[string]any{"a": "1"},
+	}
+	desired := map[string]any{
+		"spec": map[string]any{"replicas": int64(3), "template": map[string]any{"image": "nginx:1.25"}},
+		"data": map[string]any{"a": "1", "b": "2"},
+	}
+	changes := diffObjects(live, desired)
+	if len(changes) != 2 {
+		t.Fatalf("expected 2 changes, got %+v", changes)
+	}
+	if changes[0].Path != "data.b" || changes[1].Path != "spec.replicas" {
+		t.Fatalf("unexpected change paths: %+v", changes)
+	}
+}
+
+const diffManifest = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app-config
+data:
+  key: changed
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: app
+spec:
+  selector:
+    app: app
+  ports:
+  - port: 80
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: new-secret
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: rejected
+  annotations:
+    test/reject: image registry not allowed`
+
+func TestDryRunDiff(t *testing.T) {
+	suite := newReleaseTestSuite(t)
+	ctx := context.Background()
+	applier := newFakeApplier()
+
+	first := suite.createTestRelease(t, 1, 1, releaseStatusApplying)
+	if err := suite.logic.applyReleaseManifest(ctx, applier, first, pruneManifestV1); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	prune, err := suite.logic.previewPrune(ctx, 1, 1, diffManifest)
+	if err != nil {
+		t.Fatalf("preview prune: %v", err)
+	}
+
+	owner := &model.DeploymentRelease{ServiceID: 1, TargetID: 1}
+	diffs, checks, err := suite.logic.dryRunDiff(ctx, applier, owner, diffManifest, prune)
+	if err != nil {
+		t.Fatalf("dry-run diff: %v", err)
+	}
+	actions := map[string]string{}
+	for _, d := range diffs {
+		actions[d.Object.Kind+"/"+d.Object.Name] = d.Action
+	}
+	want := map[string]string{
+		"ConfigMap/app-config": diffActionChange,
+		"Service/app":          diffActionUnchanged,
+		"Secret/new-secret":    diffActionCreate,
+		"ConfigMap/rejected":   diffActionError,
+		"Ingress/app":          diffActionPrune,
+	}
+	for key, action := range want {
+		if actions[key] != action {
+			t.Errorf("%s: expected %s, got %q", key, action, actions[key])
+		}
+	}
+	for _, d := range diffs {
+		if d.Object.Name == "app-config" && (len(d.Changes) != 1 || d.Changes[0].Path != "data.key") {
+			t.Errorf("expected data.key change, got %+v", d.Changes)
+		}
+	}
+	if len(checks) != 1 || checks[0]["level"] != "error" || checks[0]["code"] != "dry_run_rejected" {
+		t.Fatalf("expected one error check for the rejected object, got %+v", checks)
+	}
+	if got := summarizeDiff(diffs); got != "dry-run: 1 create, 1 change, 1 unchanged, 1 prune, 1 error" {
+		t.Fatalf("unexpected summary %q", got)
+	}
+}
@@ -0,0 +1,485 @@
+package deployment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cy77cc/OpsPilot/internal/logger"
+	"github.com/cy77cc/OpsPilot/internal/model"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	riskTypeConfigurationDrift = "configuration_drift"
+
+	driftActionMissing = "missing"
+
+	driftCheckInterval = 10 * time.Minute
+	driftCheckTimeout  = time.Minute
+)
+
+var driftDetectionOnce sync.Once
+
+// driftFindingMeta 是漂移风险的扩展元数据, 同一服务在同一目标上只保留一条未解决的风险。
+type driftFindingMeta struct {
+	TargetID   uint                `json:"target_id"`
+	TargetName string              `json:"target_name"`
+	ReleaseID  uint                `json:"release_id"`
+	CheckedAt  time.Time           `json:"checked_at"`
+	Objects    []ReleaseObjectDiff `json:"objects,omitempty"`
+	Resolution string              `json:"resolution,omitempty"`
+}
+
+// driftBaselines 返回目标上每个服务最近一次成功的发布, 其快照即期望状态。
+func (l *Logic) driftBaselines(ctx context.Context, targetID uint) ([]model.DeploymentRelease, error) {
+	var rows []model.DeploymentRelease
+	if err := l.svcCtx.DB.WithContext(ctx).
+		Where("target_id = ? AND status IN ? AND manifest_snapshot <> ''", targetID, []string{releaseStatusApplied, releaseStatusRollback}).
+		Order("id DESC").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	seen := map[uint]bool{}
+	out := make([]model.DeploymentRelease, 0)
+	for _, row := range rows {
+		if seen[row.ServiceID] {
+			continue
+		}
+		seen[row.ServiceID] = true
+		out = append(out, row)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ServiceID < out[j].ServiceID })
+	return out, nil
+}
+
+// releaseInFlight 判断目标上是否有正在执行的发布, 此时线上状态与快照不一致属于正常过程。
+func (l *Logic) releaseInFlight(ctx context.Context, targetID uint) bool {
+	var n int64
+	l.svcCtx.DB.WithContext(ctx).Model(&model.DeploymentRelease{}).
+		Where("target_id = ? AND status IN ?", targetID, []string{releaseStatusApplying, releaseStatusVerifying, releaseStatusPaused}).
+		Count(&n)
+	return n > 0
+}
+
+// releaseDrift 比较发布快照中的每个对象与线上对象。
+func releaseDrift(ctx context.Context, applier manifestApplier, baseline *model.DeploymentRelease) ([]ReleaseObjectDiff, error) {
+	objs, err := decodeManifestObjects(baseline.ManifestSnapshot)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]ReleaseObjectDiff, 0, len(objs))
+	for _, obj := range objs {
+		withOwnershipLabels(obj, baseline)
+		item := inventoryItemFromObject(obj)
+		live, err := applier.Get(ctx, item)
+		if apierrors.IsNotFound(err) {
+			out = append(out, ReleaseObjectDiff{Object: item, Action: driftActionMissing})
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("get %s: %w", item.String(), err)
+		}
+		entry := ReleaseObjectDiff{Object: item, Action: diffActionUnchanged}
+		if changes := driftChanges(obj, live); len(changes) > 0 {
+			entry.Action = diffActionChange
+			if len(changes) > maxDiffChangesPerObj {
+				entry.Truncated = true
+				changes = changes[:maxDiffChangesPerObj]
+			}
+			entry.Changes = changes
+		}
+		out = append(out, entry)
+	}
+	return out, nil
+}
+
+// driftIgnoredFields 是其他字段管理者持有时不视为漂移的字段, 如由 HPA 等自动扩缩容控制器接管的副本数。
+var driftIgnoredFields = [][]string{{"spec", "replicas"}}
+
+// driftChanges 比较快照中声明的每个字段与线上值, 不论该字段现在由谁持有:
+// kubectl edit/set image 等 Update 操作会接管被改动的字段, 这正是需要报告的漂移。
+// 快照未声明的字段 (控制器、准入 webhook 写入) 不比较; driftIgnoredFields 中由其他管理者持有的字段跳过。
+func driftChanges(desired, live *unstructured.Unstructured) []ReleaseFieldChange {
+	want := desired.DeepCopy()
+	unstructured.RemoveNestedField(want.Object, "status")
+	unstructured.RemoveNestedField(want.Object, "metadata", "namespace")
+	changes := make([]ReleaseFieldChange, 0)
+	driftValue("", want.Object, normalizeForDiff(live), &changes)
+	ignored := ignoredDriftPaths(live)
+	out := make([]ReleaseFieldChange, 0, len(changes))
+	for _, c := range changes {
+		if !ignored[c.Path] {
+			out = append(out, c)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Path < out[j].Path })
+	return out
+}
+
+// ignoredDriftPaths 返回 driftIgnoredFields 中在线上由 OpsPilot 以外的字段管理者持有的字段路径。
+func ignoredDriftPaths(live *unstructured.Unstructured) map[string]bool {
+	out := map[string]bool{}
+	for _, entry := range live.GetManagedFields() {
+		if entry.Manager == releaseFieldManager || entry.FieldsV1 == nil {
+			continue
+		}
+		var fields map[string]any
+		if err := json.Unmarshal(entry.FieldsV1.Raw, &fields); err != nil {
+			continue
+		}
+		for _, path := range driftIgnoredFields {
+			if fieldSetHas(fields, path) {
+				out[strings.Join(path, ".")] = true
+			}
+		}
+	}
+	return out
+}
+
+// fieldSetHas 判断 managedFields 的 fieldsV1 集合中是否包含给定字段路径。
+func fieldSetHas(set map[string]any, path []string) bool {
+	for _, name := range path {
+		child, ok := set["f:"+name].(map[string]any)
+		if !ok {
+			return false
+		}
+		set = child
+	}
+	return true
+}
+
+func driftValue(path string, desired, live any, out *[]ReleaseFieldChange) {
+	switch d := desired.(type) {
+	case nil:
+		return
+	case map[string]any:
+		lm, ok := live.(map[string]any)
+		if !ok && live != nil {
+			*out = append(*out, ReleaseFieldChange{Path: path, Before: desired, After: live})
+			return
+		}
+		for k, v := range d {
+			driftValue(joinDiffPath(path, k), v, lm[k], out)
+		}
+		return
+	case []any:
+		ls, ok := live.([]any)
+		if ok && len(ls) == len(d) {
+			for i := range d {
+				driftValue(fmt.Sprintf("%s[%d]", path, i), d[i], ls[i], out)
+			}
+			return
+		}
+		if len(d) == 0 && len(ls) == 0 {
+			return
+		}
+		*out = append(*out, ReleaseFieldChange{Path: path, Before: desired, After: live})
+		return
+	}
+	if driftScalarEqual(desired, live) {
+		return
+	}
+	*out = append(*out, ReleaseFieldChange{Path: path, Before: desired, After: live})
+}
+
+// driftScalarEqual 比较标量, 容忍数字类型差异与资源数量的等价写法 (如 0.5 与 500m)。
+func driftScalarEqual(desired, live any) bool {
+	if reflect.DeepEqual(desired, live) {
+		return true
+	}
+	if live == nil {
+		return false
+	}
+	if fmt.Sprint(desired) == fmt.Sprint(live) {
+		return true
+	}
+	ds, dok := desired.(string)
+	ls, lok := live.(string)
+	if !dok || !lok {
+		return false
+	}
+	dq, err := resource.ParseQuantity(ds)
+	if err != nil {
+		return false
+	}
+	lq, err := resource.ParseQuantity(ls)
+	return err == nil && dq.Cmp(lq) == 0
+}
+
+func hasDrift(objects []ReleaseObjectDiff) bool {
+	for _, o := range objects {
+		if o.Action == diffActionChange || o.Action == driftActionMissing {
+			return true
+		}
+	}
+	return false
+}
+
+func summarizeDrift(objects []ReleaseObjectDiff) string {
+	parts := make([]string, 0)
+	for _, o := range objects {
+		switch o.Action {
+		case driftActionMissing:
+			parts = append(parts, o.Object.String()+" is missing")
+		case diffActionChange:
+			parts = append(parts, fmt.Sprintf("%s has %d drifted fields", o.Object.String(), len(o.Changes)))
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// inspectTargetDrift 检查目标上全部服务的漂移, 只读取现有风险记录而不写入。
+func (l *Logic) inspectTargetDrift(ctx context.Context, target *model.DeploymentTarget, applier manifestApplier) (TargetDriftResp, []model.DeploymentRelease, error) {
+	baselines, err := l.driftBaselines(ctx, target.ID)
+	if err != nil {
+		return TargetDriftResp{}, nil, err
+	}
+	resp := TargetDriftResp{TargetID: target.ID, CheckedAt: time.Now(), Services: make([]ServiceDrift, 0, len(baselines))}
+	for i := range baselines {
+		baseline := &baselines[i]
+		objects, err := releaseDrift(ctx, applier, baseline)
+		if err != nil {
+			return resp, nil, err
+		}
+		item := ServiceDrift{ServiceID: baseline.ServiceID, ReleaseID: baseline.ID, Drifted: hasDrift(objects), Objects: objects}
+		var svc model.Service
+		if err := l.svcCtx.DB.WithContext(ctx).Select("id", "name").First(&svc, baseline.ServiceID).Error; err == nil {
+			item.ServiceName = svc.Name
+		}
+		finding, _, err := l.openDriftFinding(ctx, baseline.ServiceID, target.ID)
+		if err != nil {
+			return resp, nil, err
+		}
+		if finding != nil {
+			item.FindingID = finding.ID
+		}
+		resp.Drifted = resp.Drifted || item.Drifted
+		resp.Services = append(resp.Services, item)
+	}
+	return resp, baselines, nil
+}
+
+// checkTargetDrift 检查目标上全部服务的漂移并同步风险记录。
+func (l *Logic) checkTargetDrift(ctx context.Context, target *model.DeploymentTarget, applier manifestApplier) (TargetDriftResp, error) {
+	resp, baselines, err := l.inspectTargetDrift(ctx, target, applier)
+	if err != nil {
+		return resp, err
+	}
+	for i := range resp.Services {
+		item := &resp.Services[i]
+		item.FindingID, err = l.recordDrift(ctx, target, &baselines[i], *item, resp.CheckedAt)
+		if err != nil {
+			return resp, err
+		}
+	}
+	return resp, nil
+}
+
+// openDriftFinding 返回服务在目标上尚未解决的漂移风险。
+func (l *Logic) openDriftFinding(ctx context.Context, serviceID, targetID uint) (*model.RiskFinding, driftFindingMeta, error) {
+	var rows []model.RiskFinding
+	if err := l.svcCtx.DB.WithContext(ctx).
+		Where("type = ? AND service_id = ? AND resolved_at IS NULL", riskTypeConfigurationDrift, serviceID).
+		Order("id DESC").Find(&rows).Error; err != nil {
+		return nil, driftFindingMeta{}, err
+	}
+	for i := range rows {
+		var meta driftFindingMeta
+		if json.Unmarshal([]byte(rows[i].Metadata), &meta) == nil && meta.TargetID == targetID {
+			return &rows[i], meta, nil
+		}
+	}
+	return nil, driftFindingMeta{}, nil
+}
+
+// recordDrift 为漂移的服务创建或刷新风险记录, 漂移消失时把风险标记为已解决。
+func (l *Logic) recordDrift(ctx context.Context, target *model.DeploymentTarget, baseline *model.DeploymentRelease, drift ServiceDrift, at time.Time) (uint, error) {
+	finding, meta, err := l.openDriftFinding(ctx, drift.ServiceID, target.ID)
+	if err != nil {
+		return 0, err
+	}
+	if !drift.Drifted {
+		if finding == nil {
+			return 0, nil
+		}
+		meta.CheckedAt = at
+		meta.Resolution = "in_sync"
+		return 0, l.svcCtx.DB.WithContext(ctx).Model(finding).Updates(map[string]any{"resolved_at": at, "metadata": toJSON(meta)}).Error
+	}
+	drifted := make([]ReleaseObjectDiff, 0)
+	for _, o := range drift.Objects {
+		if o.Action != diffActionUnchanged {
+			drifted = append(drifted, o)
+		}
+	}
+	meta = driftFindingMeta{TargetID: target.ID, TargetName: target.Name, ReleaseID: baseline.ID, CheckedAt: at, Objects: drifted}
+	severity := "medium"
+	if target.Env == "production" {
+		severity = "high"
+	}
+	if finding != nil {
+		return finding.ID, l.svcCtx.DB.WithContext(ctx).Model(finding).Updates(map[string]any{
+			"severity": severity, "description": truncateText(summarizeDrift(drifted), 4000), "metadata": toJSON(meta),
+		}).Error
+	}
+	row := model.RiskFinding{
+		Type:        riskTypeConfigurationDrift,
+		Severity:    severity,
+		Title:       truncateText(fmt.Sprintf("Configuration drift: %s on %s", defaultIfEmpty(drift.ServiceName, fmt.Sprintf("service %d", drift.ServiceID)), target.Name), 255),
+		Description: truncateText(summarizeDrift(drifted), 4000),
+		ServiceID:   drift.ServiceID,
+		ServiceName: drift.ServiceName,
+		Metadata:    toJSON(meta),
+	}
+	if err := l.svcCtx.DB.WithContext(ctx).Create(&row).Error; err != nil {
+		return 0, err
+	}
+	l.writeReleaseAudit(ctx, baseline.ID, 0, "release.drift_detected", map[string]any{"target_id": target.ID, "finding_id": row.ID, "objects": drifted})
+	return row.ID, nil
+}
+
+// driftTarget 读取目标并校验其支持漂移检测。
+func (l *Logic) driftTarget(ctx context.Context, targetID uint) (*model.DeploymentTarget, *model.Cluster, error) {
+	var target model.DeploymentTarget
+	if err := l.svcCtx.DB.WithContext(ctx).First(&target, targetID).Error; err != nil {
+		return nil, nil, err
+	}
+	if target.TargetType != "k8s" {
+		return nil, nil, fmt.Errorf("drift detection only supports k8s targets")
+	}
+	var cluster model.Cluster
+	if err := l.svcCtx.DB.WithContext(ctx).First(&cluster, target.ClusterID).Error; err != nil {
+		return nil, nil, fmt.Errorf("cluster not found: %w", err)
+	}
+	return &target, &cluster, nil
+}
+
+// GetTargetDrift 立即检查目标的漂移并返回字段级差异; 只读, 风险记录由后台检测与重新同步维护。
+func (l *Logic) GetTargetDrift(ctx context.Context, targetID uint) (TargetDriftResp, error) {
+	target, cluster, err := l.driftTarget(ctx, targetID)
+	if err != nil {
+		return TargetDriftResp{}, err
+	}
+	applier, err := dynamicApplierForCluster(cluster)
+	if err != nil {
+		return TargetDriftResp{}, err
+	}
+	checkCtx, cancel := context.WithTimeout(ctx, driftCheckTimeout)
+	defer cancel()
+	resp, _, err := l.inspectTargetDrift(checkCtx, target, applier)
+	return resp, err
+}
+
+// ResyncTargetDrift 重新应用漂移服务的发布快照, 以强制应用夺回被改动的字段。
+func (l *Logic) ResyncTargetDrift(ctx context.Context, targetID uint, uid uint64, req DriftResyncReq) (TargetDriftResp, error) {
+	target, cluster, err := l.driftTarget(ctx, targetID)
+	if err != nil {
+		return TargetDriftResp{}, err
+	}
+	applier, err := dynamicApplierForCluster(cluster)
+	if err != nil {
+		return TargetDriftResp{}, err
+	}
+	applier.force = true
+	checkCtx, cancel := context.WithTimeout(ctx, driftCheckTimeout)
+	defer cancel()
+	return l.resyncTargetDrift(checkCtx, target, applier, uid, req.ServiceID)
+}
+
+func (l *Logic) resyncTargetDrift(ctx context.Context, target *model.DeploymentTarget, applier manifestApplier, uid uint64, serviceID uint) (TargetDriftResp, error) {
+	lease, err := l.queue().locker.Get(ctx, target.ID)
+	if err != nil {
+		return TargetDriftResp{}, fmt.Errorf("read target lock: %w", err)
+	}
+	if lease != nil {
+		return TargetDriftResp{}, fmt.Errorf("%w: release %d holds target %d", ErrTargetLocked, lease.ReleaseID, target.ID)
+	}
+	current, err := l.checkTargetDrift(ctx, target, applier)
+	if err != nil {
+		return current, err
+	}
+	resynced := 0
+	for _, drift := range current.Services {
+		if !drift.Drifted || (serviceID > 0 && drift.ServiceID != serviceID) {
+			continue
+		}
+		var baseline model.DeploymentRelease
+		if err := l.svcCtx.DB.WithContext(ctx).First(&baseline, drift.ReleaseID).Error; err != nil {
+			return current, err
+		}
+		objs, err := decodeManifestObjects(baseline.ManifestSnapshot)
+		if err != nil {
+			return current, err
+		}
+		applied := make([]string, 0, len(objs))
+		for _, obj := range objs {
+			withOwnershipLabels(obj, &baseline)
+			item, err := applier.Apply(ctx, obj)
+			if err != nil {
+				return current, fmt.Errorf("resync %s: %w", item.String(), err)
+			}
+			applied = append(applied, item.String())
+		}
+		l.writeReleaseAudit(ctx, baseline.ID, uint(uid), "release.drift_resynced", map[string]any{"target_id": target.ID, "finding_id": drift.FindingID, "objects": applied})
+		resynced++
+	}
+	if resynced == 0 {
+		if serviceID > 0 {
+			return current, fmt.Errorf("service %d has no drift on target %d", serviceID, target.ID)
+		}
+		return current, nil
+	}
+	return l.checkTargetDrift(ctx, target, applier)
+}
+
+// StartDriftDetection 启动后台漂移检测, 定期检查全部活跃的 k8s 目标。进程内只启动一次。
+func (l *Logic) StartDriftDetection(ctx context.Context) {
+	driftDetectionOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(driftCheckInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					l.detectDrift(ctx)
+				}
+			}
+		}()
+	})
+}
+
+func (l *Logic) detectDrift(ctx context.Context) {
+	var targets []model.DeploymentTarget
+	if err := l.svcCtx.DB.WithContext(ctx).Where("target_type = ? AND status = ?", "k8s", "active").Find(&targets).Error; err != nil {
+		logger.L().Warn("load targets for drift detection failed", logger.Error(err))
+		return
+	}
+	for i := range targets {
+		target := &targets[i]
+		if l.releaseInFlight(ctx, target.ID) {
+			continue
+		}
+		var cluster model.Cluster
+		if err := l.svcCtx.DB.WithContext(ctx).First(&cluster, target.ClusterID).Error; err != nil {
+			continue
+		}
+		applier, err := dynamicApplierForCluster(&cluster)
+		if err == nil {
+			checkCtx, cancel := context.WithTimeout(ctx, driftCheckTimeout)
+			_, err = l.checkTargetDrift(checkCtx, target, applier)
+			cancel()
+		}
+		if err != nil {
+			logger.L().Warn("drift detection failed", logger.Int("target_id", int(target.ID)), logger.Error(err))
+		}
+	}
+}
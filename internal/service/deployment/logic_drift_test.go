@@ -0,0 +1,198 @@
+package deployment
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cy77cc/OpsPilot/internal/model"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const driftManifest = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: shop
+spec:
+  replicas: 2
+  selector:
+    matchLabels:
+      app: web
+  template:
+    metadata:
+      labels:
+        app: web
+    spec:
+      containers:
+        - name: web
+          image: registry.local/web:v1
+          resources:
+            limits:
+              cpu: "0.5"
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web-config
+  namespace: shop
+data:
+  mode: live
+`
+
+func TestTargetDrift_DetectsRecordsAndResyncs(t *testing.T) {
+	suite := newReleaseTestSuite(t)
+	if err := suite.db.AutoMigrate(&model.RiskFinding{}); err != nil {
+		t.Fatalf("migrate risk findings: %v", err)
+	}
+	ctx := context.Background()
+	svc := suite.createTestService(t)
+	target := suite.createTestTarget(t, suite.createTestCluster(t).ID)
+	baseline := suite.createTestRelease(t, svc.ID, target.ID, releaseStatusApplied)
+	baseline.ManifestSnapshot = driftManifest
+	suite.db.Save(baseline)
+
+	applier := newFakeApplier()
+	if err := suite.logic.applyReleaseManifest(ctx, applier, baseline, driftManifest); err != nil {
+		t.Fatalf("apply baseline: %v", err)
+	}
+	deployKey := ReleaseInventoryItem{Group: "apps", Version: "v1", Kind: "Deployment", Namespace: "shop", Name: "web"}.key()
+	live := applier.objects[deployKey]
+	// 其他字段管理者写入的字段与资源数量的等价写法不算漂移。
+	_ = unstructured.SetNestedField(live.Object, int64(600), "spec", "progressDeadlineSeconds")
+	_ = unstructured.SetNestedField(live.Object, "1", "metadata", "annotations", "deployment.kubernetes.io/revision")
+	containers, _, _ := unstructured.NestedSlice(live.Object, "spec", "template", "spec", "containers")
+	container := containers[0].(map[string]any)
+	container["terminationMessagePath"] = "/dev/termination-log"
+	container["resources"] = map[string]any{"limits": map[string]any{"cpu": "500m"}}
+	_ = unstructured.SetNestedSlice(live.Object, containers, "spec", "template", "spec", "containers")
+
+	resp, err := suite.logic.checkTargetDrift(ctx, target, applier)
+	if err != nil {
+		t.Fatalf("check drift: %v", err)
+	}
+	if resp.Drifted || len(resp.Services) != 1 || resp.Services[0].ReleaseID != baseline.ID {
+		t.Fatalf("expected in-sync target, got %+v", resp)
+	}
+
+	// kubectl edit 修改镜像并删除 ConfigMap。
+	container["image"] = "registry.local/web:hotfix"
+	_ = unstructured.SetNestedSlice(live.Object, containers, "spec", "template", "spec", "containers")
+	delete(applier.objects, ReleaseInventoryItem{Version: "v1", Kind: "ConfigMap", Namespace: "shop", Name: "web-config"}.key())
+
+	resp, err = suite.logic.checkTargetDrift(ctx, target, applier)
+	if err != nil {
+		t.Fatalf("check drift: %v", err)
+	}
+	drift := resp.Services[0]
+	if !resp.Drifted || drift.FindingID == 0 || len(drift.Objects) != 2 {
+		t.Fatalf("expected drift with a finding, got %+v", resp)
+	}
+	if obj := drift.Objects[0]; obj.Action != diffActionChange || len(obj.Changes) != 1 ||
+		obj.Changes[0].Path != "spec.template.spec.containers[0].image" || obj.Changes[0].After != "registry.local/web:hotfix" {
+		t.Fatalf("expected image drift only, got %+v", obj)
+	}
+	if drift.Objects[1].Action != driftActionMissing {
+		t.Fatalf("expected deleted ConfigMap to be reported missing, got %+v", drift.Objects[1])
+	}
+	if _, err := suite.logic.checkTargetDrift(ctx, target, applier); err != nil {
+		t.Fatalf("recheck drift: %v", err)
+	}
+	var findings []model.RiskFinding
+	suite.db.Where("type = ?", riskTypeConfigurationDrift).Find(&findings)
+	if len(findings) != 1 || findings[0].ServiceID != svc.ID || findings[0].ResolvedAt != nil {
+		t.Fatalf("expected one open drift finding, got %+v", findings)
+	}
+
+	lease, ok, err := suite.logic.queue().locker.Acquire(ctx, target.ID, baseline.ID+100)
+	if err != nil || !ok {
+		t.Fatalf("acquire lock: %v %+v", err, lease)
+	}
+	if _, err := suite.logic.resyncTargetDrift(ctx, target, applier, 1, 0); !errors.Is(err, ErrTargetLocked) {
+		t.Fatalf("expected resync to wait for the target lock, got %v", err)
+	}
+	_ = suite.logic.queue().locker.Release(ctx, target.ID, baseline.ID+100)
+
+	resp, err = suite.logic.resyncTargetDrift(ctx, target, applier, 1, 0)
+	if err != nil {
+		t.Fatalf("resync: %v", err)
+	}
+	if resp.Drifted {
+		t.Fatalf("expected target in sync after resync, got %+v", resp)
+	}
+	var finding model.RiskFinding
+	suite.db.First(&finding, findings[0].ID)
+	if finding.ResolvedAt == nil {
+		t.Fatal("expected drift finding to be resolved after resync")
+	}
+	var audit model.DeploymentReleaseAudit
+	if err := suite.db.Where("release_id = ? AND action = ?", baseline.ID, "release.drift_resynced").First(&audit).Error; err != nil {
+		t.Fatalf("expected resync on release timeline: %v", err)
+	}
+}
+
+func TestInspectTargetDrift_DoesNotRecordFindings(t *testing.T) {
+	suite := newReleaseTestSuite(t)
+	if err := suite.db.AutoMigrate(&model.RiskFinding{}); err != nil {
+		t.Fatalf("migrate risk findings: %v", err)
+	}
+	ctx := context.Background()
+	svc := suite.createTestService(t)
+	target := suite.createTestTarget(t, suite.createTestCluster(t).ID)
+	baseline := suite.createTestRelease(t, svc.ID, target.ID, releaseStatusApplied)
+	baseline.ManifestSnapshot = driftManifest
+	suite.db.Save(baseline)
+
+	applier := newFakeApplier()
+	if err := suite.logic.applyReleaseManifest(ctx, applier, baseline, driftManifest); err != nil {
+		t.Fatalf("apply baseline: %v", err)
+	}
+	delete(applier.objects, ReleaseInventoryItem{Version: "v1", Kind: "ConfigMap", Namespace: "shop", Name: "web-config"}.key())
+
+	resp, _, err := suite.logic.inspectTargetDrift(ctx, target, applier)
+	if err != nil {
+		t.Fatalf("inspect drift: %v", err)
+	}
+	if !resp.Drifted || resp.Services[0].FindingID != 0 {
+		t.Fatalf("expected drift without a finding, got %+v", resp)
+	}
+	var count int64
+	suite.db.Model(&model.RiskFinding{}).Where("type = ?", riskTypeConfigurationDrift).Count(&count)
+	if count != 0 {
+		t.Fatalf("expected inspection to leave findings untouched, got %d", count)
+	}
+}
+
+func TestDriftChanges_ReportsFieldsTakenOverByManualEdits(t *testing.T) {
+	objs, err := decodeManifestObjects(driftManifest)
+	if err != nil {
+		t.Fatalf("decode manifest: %v", err)
+	}
+	desired := objs[0]
+	live := desired.DeepCopy()
+	_ = unstructured.SetNestedField(live.Object, int64(5), "spec", "replicas")
+	_ = unstructured.SetNestedField(live.Object, int64(600), "spec", "progressDeadlineSeconds")
+	containers, _, _ := unstructured.NestedSlice(live.Object, "spec", "template", "spec", "containers")
+	containers[0].(map[string]any)["image"] = "registry.local/web:hotfix"
+	_ = unstructured.SetNestedSlice(live.Object, containers, "spec", "template", "spec", "containers")
+	// kubectl set image 以 Update 操作接管了容器镜像, HPA 接管了 replicas, 控制器写入了快照未声明的字段。
+	live.SetManagedFields([]metav1.ManagedFieldsEntry{
+		{Manager: "kube-controller-manager", Operation: metav1.ManagedFieldsOperationUpdate, Subresource: "scale", FieldsV1: &metav1.FieldsV1{Raw: []byte(`{"f:spec":{"f:replicas":{}}}`)}},
+		{Manager: "kubectl-set", Operation: metav1.ManagedFieldsOperationUpdate, FieldsV1: &metav1.FieldsV1{Raw: []byte(
+			`{"f:spec":{"f:template":{"f:spec":{"f:containers":{"k:{\"name\":\"web\"}":{"f:image":{}}}}}}}`)}},
+		{Manager: releaseFieldManager, Operation: metav1.ManagedFieldsOperationApply, FieldsV1: &metav1.FieldsV1{Raw: []byte(
+			`{"f:spec":{"f:selector":{},"f:template":{"f:spec":{"f:containers":{"k:{\"name\":\"web\"}":{".":{},"f:name":{}}}}}}}`)}},
+	})
+
+	changes := driftChanges(desired, live)
+	if len(changes) != 1 || changes[0].Path != "spec.template.spec.containers[0].image" || changes[0].After != "registry.local/web:hotfix" {
+		t.Fatalf("expected only the manually edited image to drift, got %+v", changes)
+	}
+
+	// 没有其他管理者接管时, 改动的副本数同样是漂移。
+	live.SetManagedFields(nil)
+	if all := driftChanges(desired, live); len(all) != 2 {
+		t.Fatalf("expected image and replicas to drift without an autoscaler, got %+v", all)
+	}
+}
@@ -0,0 +1,246 @@
+package deployment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cy77cc/OpsPilot/internal/httpx"
+	"github.com/cy77cc/OpsPilot/internal/model"
+	"github.com/cy77cc/OpsPilot/internal/service/deployment/freeze"
+)
+
+// ErrChangeFreeze 表示发布落在冻结窗口内且未获紧急放行。
+var ErrChangeFreeze = errors.New("release blocked by change freeze")
+
+// errReleaseStatusChanged 表示发布在执行前已被并发取消或拒绝, 执行方应直接停止且不再改写其状态。
+var errReleaseStatusChanged = errors.New("release status changed before execution")
+
+const (
+	reasonCodeChangeFreeze = "change_freeze"
+
+	minOverrideReasonLength = 10
+)
+
+func (l *Logic) ListFreezeWindows(ctx context.Context, env string, projectID, targetID uint) ([]FreezeWindowResp, error) {
+	q := l.svcCtx.DB.WithContext(ctx).Model(&model.DeploymentFreezeWindow{})
+	if env = strings.ToLower(strings.TrimSpace(env)); env != "" {
+		q = q.Where("env = ?", env)
+	}
+	if projectID > 0 {
+		q = q.Where("project_id = ?", projectID)
+	}
+	if targetID > 0 {
+		q = q.Where("target_id = ?", targetID)
+	}
+	var rows []model.DeploymentFreezeWindow
+	if err := q.Order("id DESC").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	out := make([]FreezeWindowResp, 0, len(rows))
+	for _, row := range rows {
+		out = append(out, toFreezeWindowResp(row, now))
+	}
+	return out, nil
+}
+
+func (l *Logic) CreateFreezeWindow(ctx context.Context, uid uint64, req FreezeWindowUpsertReq) (FreezeWindowResp, error) {
+	row := model.DeploymentFreezeWindow{Enabled: true, CreatedBy: uint(uid)}
+	applyFreezeWindowReq(&row, req)
+	if err := freeze.Validate(&row); err != nil {
+		return FreezeWindowResp{}, err
+	}
+	if err := l.svcCtx.DB.WithContext(ctx).Create(&row).Error; err != nil {
+		return FreezeWindowResp{}, err
+	}
+	return toFreezeWindowResp(row, time.Now()), nil
+}
+
+func (l *Logic) UpdateFreezeWindow(ctx context.Context, id uint, req FreezeWindowUpsertReq) (FreezeWindowResp, error) {
+	var row model.DeploymentFreezeWindow
+	if err := l.svcCtx.DB.WithContext(ctx).First(&row, id).Error; err != nil {
+		return FreezeWindowResp{}, err
+	}
+	applyFreezeWindowReq(&row, req)
+	if err := freeze.Validate(&row); err != nil {
+		return FreezeWindowResp{}, err
+	}
+	if err := l.svcCtx.DB.WithContext(ctx).Save(&row).Error; err != nil {
+		return FreezeWindowResp{}, err
+	}
+	return toFreezeWindowResp(row, time.Now()), nil
+}
+
+func (l *Logic) DeleteFreezeWindow(ctx context.Context, id uint) error {
+	return l.svcCtx.DB.WithContext(ctx).Delete(&model.DeploymentFreezeWindow{}, id).Error
+}
+
+// CheckFreeze 返回服务在目标上当前是否处于冻结期。
+func (l *Logic) CheckFreeze(ctx context.Context, serviceID, targetID uint, env string) (FreezeCheckResp, error) {
+	var svc model.Service
+	if err := l.svcCtx.DB.WithContext(ctx).First(&svc, serviceID).Error; err != nil {
+		return FreezeCheckResp{}, err
+	}
+	var target model.DeploymentTarget
+	if err := l.svcCtx.DB.WithContext(ctx).First(&target, targetID).Error; err != nil {
+		return FreezeCheckResp{}, err
+	}
+	env = strings.ToLower(strings.TrimSpace(defaultIfEmpty(env, defaultIfEmpty(target.Env, svc.Env))))
+	now := time.Now()
+	windows, err := l.activeFreezes(ctx, &svc, &target, env, now)
+	if err != nil {
+		return FreezeCheckResp{}, err
+	}
+	resp := FreezeCheckResp{Frozen: len(windows) > 0, Windows: make([]FreezeWindowResp, 0, len(windows))}
+	if resp.Frozen {
+		resp.Message = freeze.Describe(windows, now)
+	}
+	for _, w := range windows {
+		resp.Windows = append(resp.Windows, toFreezeWindowResp(w, now))
+	}
+	return resp, nil
+}
+
+func applyFreezeWindowReq(row *model.DeploymentFreezeWindow, req FreezeWindowUpsertReq) {
+	row.Name = strings.TrimSpace(req.Name)
+	row.Reason = strings.TrimSpace(req.Reason)
+	row.Env = req.Env
+	row.ProjectID = req.ProjectID
+	row.TargetID = req.TargetID
+	row.WindowType = strings.TrimSpace(req.WindowType)
+	row.StartAt = req.StartAt
+	row.EndAt = req.EndAt
+	row.Cron = strings.TrimSpace(req.Cron)
+	row.DurationMinutes = req.DurationMinutes
+	row.Timezone = strings.TrimSpace(req.Timezone)
+	roles := make([]string, 0, len(req.OverrideRoles))
+	for _, r := range req.OverrideRoles {
+		if r = strings.TrimSpace(r); r != "" {
+			roles = append(roles, r)
+		}
+	}
+	row.OverrideRoles = strings.Join(roles, ",")
+	if req.Enabled != nil {
+		row.Enabled = *req.Enabled
+	}
+}
+
+func toFreezeWindowResp(row model.DeploymentFreezeWindow, now time.Time) FreezeWindowResp {
+	resp := FreezeWindowResp{DeploymentFreezeWindow: row}
+	if ok, until := freeze.Covers(row, now); ok {
+		resp.Active = true
+		resp.ActiveUntil = &until
+	}
+	return resp
+}
+
+func (l *Logic) activeFreezes(ctx context.Context, svc *model.Service, target *model.DeploymentTarget, env string, at time.Time) ([]model.DeploymentFreezeWindow, error) {
+	return freeze.Active(ctx, l.svcCtx.DB, freeze.Scope{Env: env, ProjectID: svc.ProjectID, TargetIDs: []uint{target.ID}}, at)
+}
+
+// freezeOverrideDecision 把紧急放行转换为更严格的审批: 必须审批、不可自审,
+// 窗口配置了放行角色时只允许这些角色审批。
+func freezeOverrideDecision(base approvalDecision, windows []model.DeploymentFreezeWindow, reason string) approvalDecision {
+	d := base
+	d.Required = true
+	if d.MinApprovals < 1 {
+		d.MinApprovals = 1
+	}
+	d.NoSelfApproval = true
+	if roles := freeze.OverrideRoles(windows); len(roles) > 0 {
+		d.ApproverRoles = roles
+	}
+	d.Source = "freeze_override"
+	d.Reason = fmt.Sprintf("emergency override during change freeze: %s", reason)
+	return d
+}
+
+// checkFreezeOverride 校验紧急放行请求, 返回拒绝原因; 为空表示允许放行。
+func (l *Logic) checkFreezeOverride(uid uint64, req ReleasePreviewReq) string {
+	if !req.EmergencyOverride {
+		return ""
+	}
+	if len([]rune(strings.TrimSpace(req.OverrideReason))) < minOverrideReasonLength {
+		return fmt.Sprintf("override_reason must be at least %d characters", minOverrideReasonLength)
+	}
+	if !httpx.HasAnyPermission(l.svcCtx.DB, uid, freeze.PermOverride) {
+		return "emergency override requires " + freeze.PermOverride
+	}
+	return ""
+}
+
+// blockFrozenRelease 记录一次被冻结窗口拦截的发布, 使其出现在发布列表与时间线中。
+func (l *Logic) blockFrozenRelease(ctx context.Context, release *model.DeploymentRelease, windows []model.DeploymentFreezeWindow, at time.Time, req ReleasePreviewReq, denial string) (ReleaseApplyResp, error) {
+	message := freeze.Describe(windows, at)
+	if denial != "" {
+		message += " (override denied: " + denial + ")"
+	}
+	release.Status = releaseStatusRejected
+	release.DiagnosticsJSON = toJSON([]releaseDiagnostic{{Runtime: release.RuntimeType, Stage: "freeze", Code: reasonCodeChangeFreeze, Message: ErrChangeFreeze.Error() + ": " + message, Summary: "release blocked by change freeze"}})
+	if err := l.svcCtx.DB.WithContext(ctx).Create(release).Error; err != nil {
+		return ReleaseApplyResp{}, err
+	}
+	detail := map[string]any{"windows": freeze.Summaries(windows, at), "emergency_override": req.EmergencyOverride}
+	if req.EmergencyOverride {
+		detail["override_reason"] = strings.TrimSpace(req.OverrideReason)
+		detail["override_denied"] = denial
+	}
+	l.writeReleaseAudit(ctx, release.ID, release.Operator, "release.freeze_blocked", detail)
+	return ReleaseApplyResp{
+		ReleaseID:        release.ID,
+		UnifiedReleaseID: release.ID,
+		Status:           release.Status,
+		RuntimeType:      release.RuntimeType,
+		TriggerSource:    release.TriggerSource,
+		CIRunID:          release.CIRunID,
+		ReasonCode:       reasonCodeChangeFreeze,
+		LifecycleState:   l.releaseLifecycleState(release.Status),
+	}, fmt.Errorf("%w: %s", ErrChangeFreeze, message)
+}
+
+// recheckReleaseFreeze 在发布真正执行前再次检查冻结窗口: 审批与排队期间可能进入新的冻结窗口。
+// 申请时已记录紧急放行 (release.freeze_overridden 审计) 的发布不再拦截; 命中冻结时发布被拒绝并返回 ErrChangeFreeze,
+// 发布已被并发取消或拒绝时返回 errReleaseStatusChanged。
+func (l *Logic) recheckReleaseFreeze(ctx context.Context, release *model.DeploymentRelease, target *model.DeploymentTarget) error {
+	var overridden int64
+	if err := l.svcCtx.DB.WithContext(ctx).Model(&model.DeploymentReleaseAudit{}).
+		Where("release_id = ? AND action = ?", release.ID, "release.freeze_overridden").Count(&overridden).Error; err != nil {
+		return err
+	}
+	if overridden > 0 {
+		return nil
+	}
+	var svc model.Service
+	if err := l.svcCtx.DB.WithContext(ctx).First(&svc, release.ServiceID).Error; err != nil {
+		return err
+	}
+	now := time.Now()
+	env := strings.ToLower(strings.TrimSpace(defaultIfEmpty(release.NamespaceOrProject, defaultIfEmpty(target.Env, svc.Env))))
+	windows, err := l.activeFreezes(ctx, &svc, target, env, now)
+	if err != nil || len(windows) == 0 {
+		return err
+	}
+	message := freeze.Describe(windows, now)
+	// 只拒绝仍处于调用方预期状态 (approved/queued) 的发布, 同时被取消或拒绝的发布保持原状。
+	expected := release.Status
+	diagnostics := toJSON([]releaseDiagnostic{{Runtime: release.RuntimeType, Stage: "freeze", Code: reasonCodeChangeFreeze, Message: ErrChangeFreeze.Error() + ": " + message, Summary: "release blocked by change freeze"}})
+	res := l.svcCtx.DB.WithContext(ctx).Model(&model.DeploymentRelease{}).
+		Where("id = ? AND status = ?", release.ID, expected).
+		Updates(map[string]any{"status": releaseStatusRejected, "diagnostics_json": diagnostics, "updated_at": now})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		if err := l.svcCtx.DB.WithContext(ctx).First(release, release.ID).Error; err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: release %d is %s", errReleaseStatusChanged, release.ID, release.Status)
+	}
+	release.Status = releaseStatusRejected
+	release.DiagnosticsJSON = diagnostics
+	l.writeReleaseAudit(ctx, release.ID, release.Operator, "release.freeze_blocked", map[string]any{"windows": freeze.Summaries(windows, now), "stage": "execute"})
+	return fmt.Errorf("%w: %s", ErrChangeFreeze, message)
+}
@@ -0,0 +1,239 @@
+package deployment
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cy77cc/OpsPilot/internal/model"
+	"github.com/cy77cc/OpsPilot/internal/service/deployment/freeze"
+)
+
+func (s *releaseTestSuite) createActiveFreeze(t *testing.T, env string, targetID uint, overrideRoles []string) FreezeWindowResp {
+	t.Helper()
+	start := time.Now().Add(-time.Hour)
+	end := time.Now().Add(time.Hour)
+	w, err := s.logic.CreateFreezeWindow(context.Background(), 1, FreezeWindowUpsertReq{
+		Name:          "release-freeze",
+		Reason:        "quarter close",
+		Env:           env,
+		TargetID:      targetID,
+		WindowType:    freeze.WindowOneOff,
+		StartAt:       &start,
+		EndAt:         &end,
+		OverrideRoles: overrideRoles,
+	})
+	if err != nil {
+		t.Fatalf("create freeze window: %v", err)
+	}
+	return w
+}
+
+func (s *releaseTestSuite) grantRole(t *testing.T, uid uint64, code string) {
+	t.Helper()
+	role := &model.Role{Name: code, Code: code, Status: 1}
+	if err := s.db.Create(role).Error; err != nil {
+		t.Fatalf("create role: %v", err)
+	}
+	if err := s.db.Create(&model.UserRole{UserID: int64(uid), RoleID: int64(role.ID)}).Error; err != nil {
+		t.Fatalf("create user role: %v", err)
+	}
+}
+
+func (s *releaseTestSuite) previewFor(t *testing.T, svcID, targetID uint) ReleasePreviewReq {
+	t.Helper()
+	req := ReleasePreviewReq{ServiceID: svcID, TargetID: targetID, Strategy: "rolling"}
+	preview, err := s.logic.PreviewRelease(context.Background(), req)
+	if err != nil {
+		t.Fatalf("preview: %v", err)
+	}
+	found := false
+	for _, w := range preview.Warnings {
+		if w["code"] == reasonCodeChangeFreeze {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected preview to warn about the freeze, got %+v", preview.Warnings)
+	}
+	req.PreviewToken = preview.PreviewToken
+	return req
+}
+
+func TestCreateFreezeWindow_Validates(t *testing.T) {
+	suite := newReleaseTestSuite(t)
+	_, err := suite.logic.CreateFreezeWindow(context.Background(), 1, FreezeWindowUpsertReq{Name: "bad", WindowType: freeze.WindowRecurring, Cron: "0 18 * * 5"})
+	if err == nil {
+		t.Fatal("expected recurring window without duration to be rejected")
+	}
+	w := suite.createActiveFreeze(t, "staging", 0, nil)
+	if !w.Active || !w.Enabled {
+		t.Fatalf("expected created window to be enabled and active, got %+v", w)
+	}
+}
+
+func TestApplyRelease_BlockedByFreeze(t *testing.T) {
+	suite := newReleaseTestSuite(t)
+	ctx := context.Background()
+	svc := suite.createTestService(t)
+	target := suite.createComposeTarget(t, "10.0.5.1")
+	suite.createActiveFreeze(t, "production", 0, nil)
+
+	resp, err := suite.logic.ApplyRelease(ctx, 7, suite.previewFor(t, svc.ID, target.ID))
+	if !errors.Is(err, ErrChangeFreeze) {
+		t.Fatalf("expected change freeze error, got %v", err)
+	}
+	if resp.Status != releaseStatusRejected || resp.ReasonCode != reasonCodeChangeFreeze || resp.ReleaseID == 0 {
+		t.Fatalf("expected a rejected release record, got %+v", resp)
+	}
+	timeline, _ := suite.logic.ListReleaseTimeline(ctx, resp.ReleaseID)
+	if len(timeline) != 1 || timeline[0].Action != "release.freeze_blocked" {
+		t.Fatalf("expected freeze_blocked timeline event, got %+v", timeline)
+	}
+
+	// 其他环境的发布不受影响。
+	got, err := suite.logic.activeFreezes(ctx, svc, target, "staging", time.Now())
+	if err != nil || len(got) != 0 {
+		t.Fatalf("expected staging not to be frozen, got %v %v", got, err)
+	}
+}
+
+func TestApplyRelease_FreezeScopedToTarget(t *testing.T) {
+	suite := newReleaseTestSuite(t)
+	ctx := context.Background()
+	svc := suite.createTestService(t)
+	frozen := suite.createComposeTarget(t, "10.0.6.1")
+	open := suite.createComposeTarget(t, "10.0.6.2")
+	suite.createActiveFreeze(t, "", frozen.ID, nil)
+
+	got, err := suite.logic.activeFreezes(ctx, svc, open, "staging", time.Now())
+	if err != nil || len(got) != 0 {
+		t.Fatalf("expected no freeze for other target, got %v %v", got, err)
+	}
+	check, err := suite.logic.CheckFreeze(ctx, svc.ID, frozen.ID, "")
+	if err != nil || !check.Frozen || len(check.Windows) != 1 {
+		t.Fatalf("expected frozen target, got %+v %v", check, err)
+	}
+}
+
+func TestApplyRelease_EmergencyOverride(t *testing.T) {
+	suite := newReleaseTestSuite(t)
+	ctx := context.Background()
+	svc := suite.createTestService(t)
+	target := suite.createComposeTarget(t, "10.0.7.1")
+	suite.createActiveFreeze(t, "production", 0, []string{"sre"})
+
+	// 理由过短或缺少权限的放行请求仍被拦截, 并记录拒绝原因。
+	req := suite.previewFor(t, svc.ID, target.ID)
+	req.EmergencyOverride = true
+	req.OverrideReason = "hotfix"
+	resp, err := suite.logic.ApplyRelease(ctx, 7, req)
+	if !errors.Is(err, ErrChangeFreeze) || !strings.Contains(err.Error(), "override_reason") {
+		t.Fatalf("expected short justification to be rejected, got %v", err)
+	}
+	req.OverrideReason = "fix payment outage INC-4521"
+	if _, err := suite.logic.ApplyRelease(ctx, 7, req); !errors.Is(err, ErrChangeFreeze) || !strings.Contains(err.Error(), freeze.PermOverride) {
+		t.Fatalf("expected override without permission to be rejected, got %v", err)
+	}
+	var blocked int64
+	suite.db.Model(&model.DeploymentReleaseAudit{}).Where("action = ?", "release.freeze_blocked").Count(&blocked)
+	if blocked != 2 || resp.ReleaseID == 0 {
+		t.Fatalf("expected both denied overrides to be audited, got %d", blocked)
+	}
+
+	suite.grantRole(t, 7, "admin")
+	resp, err = suite.logic.ApplyRelease(ctx, 7, req)
+	if err != nil {
+		t.Fatalf("override apply: %v", err)
+	}
+	if resp.Status != releaseStatusPendingApproval || resp.ApprovalSource != "freeze_override" {
+		t.Fatalf("expected override to require approval, got %+v", resp)
+	}
+	var approval model.DeploymentReleaseApproval
+	if err := suite.db.Where("release_id = ?", resp.ReleaseID).First(&approval).Error; err != nil {
+		t.Fatalf("load approval: %v", err)
+	}
+	decision := approvalDecisionFromRule(&approval)
+	if !decision.NoSelfApproval || len(decision.ApproverRoles) != 1 || decision.ApproverRoles[0] != "sre" {
+		t.Fatalf("expected elevated approval rule, got %+v", decision)
+	}
+	var overridden int64
+	suite.db.Model(&model.DeploymentReleaseAudit{}).Where("release_id = ? AND action = ?", resp.ReleaseID, "release.freeze_overridden").Count(&overridden)
+	if overridden != 1 {
+		t.Fatal("expected freeze_overridden timeline event")
+	}
+	if _, err := suite.logic.ApproveRelease(ctx, resp.ReleaseID, 7, "self"); err == nil {
+		t.Fatal("expected requester to be unable to approve their own override")
+	}
+}
+
+func TestApproveRelease_RechecksFreeze(t *testing.T) {
+	suite := newReleaseTestSuite(t)
+	ctx := context.Background()
+	svc := suite.createTestService(t)
+	target := suite.createComposeTarget(t, "10.0.8.1")
+
+	req := ReleasePreviewReq{ServiceID: svc.ID, TargetID: target.ID, Strategy: "rolling"}
+	preview, err := suite.logic.PreviewRelease(ctx, req)
+	if err != nil {
+		t.Fatalf("preview: %v", err)
+	}
+	req.PreviewToken = preview.PreviewToken
+	resp, err := suite.logic.ApplyRelease(ctx, 7, req)
+	if err != nil || resp.Status != releaseStatusPendingApproval {
+		t.Fatalf("expected release to wait for approval, got %+v %v", resp, err)
+	}
+
+	// 审批期间进入冻结窗口, 审批通过后不再执行。
+	suite.createActiveFreeze(t, "production", 0, nil)
+	if _, err := suite.logic.ApproveRelease(ctx, resp.ReleaseID, 8, "lgtm"); !errors.Is(err, ErrChangeFreeze) {
+		t.Fatalf("expected approved release to be blocked by the new freeze, got %v", err)
+	}
+	var row model.DeploymentRelease
+	if err := suite.db.First(&row, resp.ReleaseID).Error; err != nil {
+		t.Fatalf("load release: %v", err)
+	}
+	if row.Status != releaseStatusRejected {
+		t.Fatalf("expected rejected release, got %s", row.Status)
+	}
+	var blocked int64
+	suite.db.Model(&model.DeploymentReleaseAudit{}).Where("release_id = ? AND action = ?", row.ID, "release.freeze_blocked").Count(&blocked)
+	if blocked != 1 {
+		t.Fatalf("expected freeze_blocked audit, got %d", blocked)
+	}
+}
+
+func TestRecheckReleaseFreeze_KeepsConcurrentCancel(t *testing.T) {
+	suite := newReleaseTestSuite(t)
+	ctx := context.Background()
+	svc := suite.createTestService(t)
+	target := suite.createComposeTarget(t, "10.0.8.1")
+	release := suite.createTestRelease(t, svc.ID, target.ID, releaseStatusApproved)
+	suite.createActiveFreeze(t, "", target.ID, nil)
+
+	// 执行方仍认为发布处于 approved, 库中已被取消。
+	if err := suite.db.Model(&model.DeploymentRelease{}).Where("id = ?", release.ID).Update("status", releaseStatusCancelled).Error; err != nil {
+		t.Fatalf("cancel release: %v", err)
+	}
+	err := suite.logic.recheckReleaseFreeze(ctx, release, target)
+	if !errors.Is(err, errReleaseStatusChanged) {
+		t.Fatalf("expected status change to be reported, got %v", err)
+	}
+	if release.Status != releaseStatusCancelled {
+		t.Fatalf("expected in-memory release reloaded as cancelled, got %s", release.Status)
+	}
+	var row model.DeploymentRelease
+	if err := suite.db.First(&row, release.ID).Error; err != nil {
+		t.Fatalf("load release: %v", err)
+	}
+	if row.Status != releaseStatusCancelled || strings.Contains(row.DiagnosticsJSON, reasonCodeChangeFreeze) {
+		t.Fatalf("expected cancel to be kept, got %s %s", row.Status, row.DiagnosticsJSON)
+	}
+	var blocked int64
+	suite.db.Model(&model.DeploymentReleaseAudit{}).Where("release_id = ? AND action = ?", row.ID, "release.freeze_blocked").Count(&blocked)
+	if blocked != 0 {
+		t.Fatalf("expected no freeze_blocked audit, got %d", blocked)
+	}
+}
@@ -0,0 +1,684 @@
+package deployment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cy77cc/OpsPilot/internal/model"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+const (
+	hookPhasePre  = "pre"
+	hookPhasePost = "post"
+
+	hookKindK8sJob = "k8s_job"
+	hookKindSSH    = "ssh"
+	hookKindHTTP   = "http"
+	hookKindWait   = "wait"
+
+	hookOnFailureAbort    = "abort"
+	hookOnFailureFail     = "fail"
+	hookOnFailureRollback = "rollback"
+	hookOnFailureIgnore   = "ignore"
+
+	hookReleaseLabel = "opspilot.io/release-id"
+	hookIDLabel      = "opspilot.io/hook-id"
+
+	defaultHookTimeoutSeconds = 300
+	maxHookTimeoutSeconds     = 3600
+	defaultHookInterval       = 5 * time.Second
+	hookOutputLimit           = 4000
+	hookJobLogTailLines       = 200
+)
+
+var hookJobNameInvalid = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// releaseHookConfig 是钩子参数, 各类型使用其中的部分字段:
+//
+//	k8s_job: template (Job 清单), namespace
+//	ssh: command, node_ids (为空时在目标全部可用节点上执行)
+//	http: url, method, headers, body, expect_status (默认 2xx), body_contains
+//	wait: url (轮询直到 http 检查通过) 或 resource + condition (如 deployment/web + Available), namespace, interval_seconds
+//
+// 字符串参数中的 {release_id} {service_id} {target_id} {revision_id} {namespace} {env} 替换为发布上下文,
+// ssh 命令中的 {host} 替换为节点 IP。
+type releaseHookConfig struct {
+	Template        string            `json:"template,omitempty"`
+	Namespace       string            `json:"namespace,omitempty"`
+	Command         string            `json:"command,omitempty"`
+	NodeIDs         []uint            `json:"node_ids,omitempty"`
+	URL             string            `json:"url,omitempty"`
+	Method          string            `json:"method,omitempty"`
+	Headers         map[string]string `json:"headers,omitempty"`
+	Body            string            `json:"body,omitempty"`
+	ExpectStatus    []int             `json:"expect_status,omitempty"`
+	BodyContains    string            `json:"body_contains,omitempty"`
+	Resource        string            `json:"resource,omitempty"`
+	Condition       string            `json:"condition,omitempty"`
+	IntervalSeconds int               `json:"interval_seconds,omitempty"`
+}
+
+func parseReleaseHookConfig(raw string) (releaseHookConfig, error) {
+	var cfg releaseHookConfig
+	if strings.TrimSpace(raw) == "" {
+		return cfg, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &cfg); err != nil {
+		return cfg, fmt.Errorf("invalid hook config: %w", err)
+	}
+	return cfg, nil
+}
+
+// expand 用发布上下文替换参数中的占位符。
+func (c releaseHookConfig) expand(r *strings.Replacer) releaseHookConfig {
+	c.Template = r.Replace(c.Template)
+	c.Namespace = r.Replace(c.Namespace)
+	c.Command = r.Replace(c.Command)
+	c.URL = r.Replace(c.URL)
+	c.Body = r.Replace(c.Body)
+	c.Resource = r.Replace(c.Resource)
+	headers := make(map[string]string, len(c.Headers))
+	for k, v := range c.Headers {
+		headers[k] = r.Replace(v)
+	}
+	c.Headers = headers
+	return c
+}
+
+func hookVars(release *model.DeploymentRelease, target *model.DeploymentTarget) *strings.Replacer {
+	return strings.NewReplacer(
+		"{release_id}", strconv.FormatUint(uint64(release.ID), 10),
+		"{service_id}", strconv.FormatUint(uint64(release.ServiceID), 10),
+		"{target_id}", strconv.FormatUint(uint64(release.TargetID), 10),
+		"{revision_id}", strconv.FormatUint(uint64(release.RevisionID), 10),
+		"{namespace}", defaultIfEmpty(release.NamespaceOrProject, "default"),
+		"{env}", target.Env,
+	)
+}
+
+// validateReleaseHook 校验钩子定义并补全默认值。
+func validateReleaseHook(row *model.DeploymentReleaseHook) error {
+	if row.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if row.ServiceID == 0 && row.TargetID == 0 {
+		return fmt.Errorf("service_id or target_id is required")
+	}
+	switch row.Phase {
+	case hookPhasePre:
+		row.OnFailure = defaultIfEmpty(row.OnFailure, hookOnFailureAbort)
+		if row.OnFailure != hookOnFailureAbort && row.OnFailure != hookOnFailureIgnore {
+			return fmt.Errorf("on_failure of a pre hook must be one of: abort, ignore")
+		}
+	case hookPhasePost:
+		row.OnFailure = defaultIfEmpty(row.OnFailure, hookOnFailureFail)
+		if row.OnFailure != hookOnFailureFail && row.OnFailure != hookOnFailureRollback && row.OnFailure != hookOnFailureIgnore {
+			return fmt.Errorf("on_failure of a post hook must be one of: fail, rollback, ignore")
+		}
+	default:
+		return fmt.Errorf("phase must be one of: pre, post")
+	}
+	if row.TimeoutSeconds <= 0 {
+		row.TimeoutSeconds = defaultHookTimeoutSeconds
+	}
+	if row.TimeoutSeconds > maxHookTimeoutSeconds {
+		return fmt.Errorf("timeout_seconds must not exceed %d", maxHookTimeoutSeconds)
+	}
+	cfg, err := parseReleaseHookConfig(row.ConfigJSON)
+	if err != nil {
+		return err
+	}
+	switch row.Kind {
+	case hookKindK8sJob:
+		if strings.TrimSpace(cfg.Template) == "" {
+			return fmt.Errorf("template is required for k8s_job hooks")
+		}
+		if _, err := decodeHookJob(cfg.Template); err != nil {
+			return err
+		}
+	case hookKindSSH:
+		if strings.TrimSpace(cfg.Command) == "" {
+			return fmt.Errorf("command is required for ssh hooks")
+		}
+	case hookKindHTTP:
+		if strings.TrimSpace(cfg.URL) == "" {
+			return fmt.Errorf("url is required for http hooks")
+		}
+	case hookKindWait:
+		if strings.TrimSpace(cfg.URL) == "" && strings.TrimSpace(cfg.Resource) == "" {
+			return fmt.Errorf("url or resource is required for wait hooks")
+		}
+		if cfg.Resource != "" {
+			if _, _, err := splitHookResource(cfg.Resource); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("kind must be one of: k8s_job, ssh, http, wait")
+	}
+	return nil
+}
+
+func (l *Logic) ListReleaseHooks(ctx context.Context, serviceID, targetID uint, phase string) ([]model.DeploymentReleaseHook, error) {
+	q := l.svcCtx.DB.WithContext(ctx).Model(&model.DeploymentReleaseHook{})
+	if serviceID > 0 {
+		q = q.Where("service_id = ?", serviceID)
+	}
+	if targetID > 0 {
+		q = q.Where("target_id = ?", targetID)
+	}
+	if phase = strings.TrimSpace(phase); phase != "" {
+		q = q.Where("phase = ?", phase)
+	}
+	var rows []model.DeploymentReleaseHook
+	if err := q.Order("phase DESC, sort_order ASC, id ASC").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func (l *Logic) CreateReleaseHook(ctx context.Context, uid uint64, req ReleaseHookUpsertReq) (model.DeploymentReleaseHook, error) {
+	row := model.DeploymentReleaseHook{Enabled: true, CreatedBy: uint(uid)}
+	applyReleaseHookReq(&row, req)
+	if err := validateReleaseHook(&row); err != nil {
+		return row, err
+	}
+	if err := l.svcCtx.DB.WithContext(ctx).Create(&row).Error; err != nil {
+		return row, err
+	}
+	return row, nil
+}
+
+func (l *Logic) UpdateReleaseHook(ctx context.Context, id uint, req ReleaseHookUpsertReq) (model.DeploymentReleaseHook, error) {
+	var row model.DeploymentReleaseHook
+	if err := l.svcCtx.DB.WithContext(ctx).First(&row, id).Error; err != nil {
+		return row, err
+	}
+	applyReleaseHookReq(&row, req)
+	if err := validateReleaseHook(&row); err != nil {
+		return row, err
+	}
+	if err := l.svcCtx.DB.WithContext(ctx).Save(&row).Error; err != nil {
+		return row, err
+	}
+	return row, nil
+}
+
+func (l *Logic) DeleteReleaseHook(ctx context.Context, id uint) error {
+	return l.svcCtx.DB.WithContext(ctx).Delete(&model.DeploymentReleaseHook{}, id).Error
+}
+
+func applyReleaseHookReq(row *model.DeploymentReleaseHook, req ReleaseHookUpsertReq) {
+	row.Name = strings.TrimSpace(req.Name)
+	row.ServiceID = req.ServiceID
+	row.TargetID = req.TargetID
+	row.Phase = strings.ToLower(strings.TrimSpace(req.Phase))
+	row.Kind = strings.ToLower(strings.TrimSpace(req.Kind))
+	row.SortOrder = req.SortOrder
+	row.ConfigJSON = toJSON(req.Config)
+	row.TimeoutSeconds = req.TimeoutSeconds
+	row.OnFailure = strings.ToLower(strings.TrimSpace(req.OnFailure))
+	if req.Enabled != nil {
+		row.Enabled = *req.Enabled
+	}
+}
+
+// loadReleaseHooks 返回作用于发布的启用钩子: 目标级、服务级与服务在该目标上的钩子, 按 sort_order 升序。
+func (l *Logic) loadReleaseHooks(ctx context.Context, release *model.DeploymentRelease, phase string) ([]model.DeploymentReleaseHook, error) {
+	var rows []model.DeploymentReleaseHook
+	err := l.svcCtx.DB.WithContext(ctx).
+		Where("enabled = ? AND phase = ?", true, phase).
+		Where("(service_id = ? AND target_id IN ?) OR (service_id = 0 AND target_id = ?)", release.ServiceID, []uint{0, release.TargetID}, release.TargetID).
+		Order("sort_order ASC, id ASC").
+		Find(&rows).Error
+	return rows, err
+}
+
+// runReleaseHooks 按顺序执行发布在指定阶段的钩子, 失败时把发布标记为失败并按 on_failure 处理。
+func (l *Logic) runReleaseHooks(ctx context.Context, release *model.DeploymentRelease, phase string) error {
+	return l.newHookRunner().Run(ctx, release, phase)
+}
+
+// hookRunner 执行发布钩子, 外部依赖可在测试中替换。
+type hookRunner struct {
+	logic      *Logic
+	nodes      composeNodeRunner
+	httpClient *http.Client
+	kube       func(ctx context.Context, target *model.DeploymentTarget) (kubernetes.Interface, error)
+	rollback   func(ctx context.Context, releaseID uint, uid uint64) (uint, error)
+	interval   time.Duration
+}
+
+func (l *Logic) newHookRunner() *hookRunner {
+	return &hookRunner{
+		logic:      l,
+		nodes:      &sshComposeRunner{logic: l},
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		kube: func(ctx context.Context, target *model.DeploymentTarget) (kubernetes.Interface, error) {
+			var cluster model.Cluster
+			if err := l.svcCtx.DB.WithContext(ctx).First(&cluster, target.ClusterID).Error; err != nil {
+				return nil, fmt.Errorf("cluster binding not found: %w", err)
+			}
+			return rolloutClientForCluster(&cluster)
+		},
+		rollback: func(ctx context.Context, releaseID uint, uid uint64) (uint, error) {
+			resp, err := l.RollbackRelease(ctx, releaseID, uid)
+			return resp.ReleaseID, err
+		},
+		interval: defaultHookInterval,
+	}
+}
+
+func (r *hookRunner) Run(ctx context.Context, release *model.DeploymentRelease, phase string) error {
+	l := r.logic
+	// 钩子开始时发布在库中的状态, 失败时只在状态未被并发修改 (中止、回滚等) 的情况下标记为失败。
+	var current model.DeploymentRelease
+	if err := l.svcCtx.DB.WithContext(ctx).Select("status").First(&current, release.ID).Error; err != nil {
+		return fmt.Errorf("load release %d: %w", release.ID, err)
+	}
+	expected := current.Status
+	hooks, err := l.loadReleaseHooks(ctx, release, phase)
+	if err != nil {
+		return r.fail(ctx, release, expected, model.DeploymentReleaseHook{Phase: phase, Name: "load"}, err)
+	}
+	if len(hooks) == 0 {
+		return nil
+	}
+	var target model.DeploymentTarget
+	if err := l.svcCtx.DB.WithContext(ctx).First(&target, release.TargetID).Error; err != nil {
+		return r.fail(ctx, release, expected, hooks[0], err)
+	}
+	vars := hookVars(release, &target)
+	for _, hook := range hooks {
+		detail := map[string]any{"hook_id": hook.ID, "name": hook.Name, "phase": hook.Phase, "kind": hook.Kind}
+		l.writeReleaseAudit(ctx, release.ID, release.Operator, "release.hook_started", detail)
+		started := time.Now()
+		hookCtx, cancel := context.WithTimeout(ctx, time.Duration(hook.TimeoutSeconds)*time.Second)
+		out, runErr := r.runHook(hookCtx, release, &target, hook, vars)
+		cancel()
+		detail["duration_ms"] = time.Since(started).Milliseconds()
+		detail["output"] = truncateText(out, hookOutputLimit)
+		if runErr == nil {
+			l.writeReleaseAudit(ctx, release.ID, release.Operator, "release.hook_succeeded", detail)
+			continue
+		}
+		detail["error"] = runErr.Error()
+		detail["on_failure"] = hook.OnFailure
+		l.writeReleaseAudit(ctx, release.ID, release.Operator, "release.hook_failed", detail)
+		if hook.OnFailure == hookOnFailureIgnore {
+			continue
+		}
+		return r.fail(ctx, release, expected, hook, runErr)
+	}
+	return nil
+}
+
+// fail 把发布标记为失败; 配置了 on_failure=rollback 的 post 钩子随后自动回滚到上一个成功版本。
+// 状态更新以 expected 为条件, 发布已被并发中止或回滚时保留其状态, 也不再触发回滚。
+func (r *hookRunner) fail(ctx context.Context, release *model.DeploymentRelease, expected string, hook model.DeploymentReleaseHook, cause error) error {
+	l := r.logic
+	code := hook.Phase + "_hook_failed"
+	err := fmt.Errorf("%s-deploy hook %q failed: %w", hook.Phase, hook.Name, cause)
+	prevStatus, prevDiagnostics := release.Status, release.DiagnosticsJSON
+	release.Status = releaseStatusFailed
+	release.DiagnosticsJSON = toJSON([]releaseDiagnostic{{
+		Runtime: release.RuntimeType, Stage: hook.Phase + "_hook", Code: code, Message: truncateText(cause.Error(), 500), Summary: truncateText(err.Error(), 800),
+	}})
+	res := l.svcCtx.DB.WithContext(ctx).Model(release).
+		Where("status = ?", expected).
+		Select("status", "diagnostics_json", "updated_at").
+		Updates(release)
+	if res.Error != nil {
+		release.Status, release.DiagnosticsJSON = prevStatus, prevDiagnostics
+		return fmt.Errorf("%w (mark release failed: %v)", err, res.Error)
+	}
+	if res.RowsAffected == 0 {
+		release.Status, release.DiagnosticsJSON = prevStatus, prevDiagnostics
+		return fmt.Errorf("%w (release %d left %s before the hook finished)", err, release.ID, expected)
+	}
+	l.writeReleaseAudit(ctx, release.ID, release.Operator, "release.failed", map[string]any{"reason": code, "hook_id": hook.ID})
+	if hook.Phase == hookPhasePost && hook.OnFailure == hookOnFailureRollback {
+		rollbackID, rbErr := r.rollback(ctx, release.ID, uint64(release.Operator))
+		detail := map[string]any{"hook_id": hook.ID, "rollback_release_id": rollbackID}
+		if rbErr != nil {
+			detail["error"] = rbErr.Error()
+		}
+		l.writeReleaseAudit(ctx, release.ID, release.Operator, "release.hook_rollback", detail)
+	}
+	return err
+}
+
+func (r *hookRunner) runHook(ctx context.Context, release *model.DeploymentRelease, target *model.DeploymentTarget, hook model.DeploymentReleaseHook, vars *strings.Replacer) (string, error) {
+	cfg, err := parseReleaseHookConfig(hook.ConfigJSON)
+	if err != nil {
+		return "", err
+	}
+	cfg = cfg.expand(vars)
+	switch hook.Kind {
+	case hookKindK8sJob:
+		return r.runJob(ctx, release, target, hook, cfg)
+	case hookKindSSH:
+		return r.runSSH(ctx, target, cfg)
+	case hookKindHTTP:
+		return r.checkHTTP(ctx, cfg)
+	case hookKindWait:
+		return r.runWait(ctx, release, target, cfg)
+	default:
+		return "", fmt.Errorf("unsupported hook kind %q", hook.Kind)
+	}
+}
+
+// runSSH 依次在节点上执行命令, 遇到第一个失败即停止。
+func (r *hookRunner) runSSH(ctx context.Context, target *model.DeploymentTarget, cfg releaseHookConfig) (string, error) {
+	var nodes []model.Node
+	if len(cfg.NodeIDs) > 0 {
+		if err := r.logic.svcCtx.DB.WithContext(ctx).Where("id IN ?", cfg.NodeIDs).Order("id ASC").Find(&nodes).Error; err != nil {
+			return "", err
+		}
+		if len(nodes) != len(cfg.NodeIDs) {
+			return "", fmt.Errorf("some hook nodes were not found")
+		}
+	} else {
+		targetNodes, _, err := r.logic.composeTargetNodes(ctx, target.ID)
+		if err != nil {
+			return "", err
+		}
+		for _, n := range targetNodes {
+			nodes = append(nodes, n.node)
+		}
+	}
+	var out strings.Builder
+	for i := range nodes {
+		node := &nodes[i]
+		res, err := r.nodes.Run(ctx, node, strings.ReplaceAll(cfg.Command, "{host}", node.IP))
+		fmt.Fprintf(&out, "[%s] %s\n", node.IP, strings.TrimSpace(res))
+		if err != nil {
+			return out.String(), fmt.Errorf("node %s: %w", node.IP, err)
+		}
+		if ctx.Err() != nil {
+			return out.String(), ctx.Err()
+		}
+	}
+	return out.String(), nil
+}
+
+// checkHTTP 发起一次请求, 校验状态码与响应内容。
+func (r *hookRunner) checkHTTP(ctx context.Context, cfg releaseHookConfig) (string, error) {
+	method := strings.ToUpper(defaultIfEmpty(cfg.Method, http.MethodGet))
+	var body io.Reader
+	if cfg.Body != "" {
+		body = strings.NewReader(cfg.Body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, cfg.URL, body)
+	if err != nil {
+		return "", err
+	}
+	for k, v := range cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	out := fmt.Sprintf("%s %s -> %d\n%s", method, cfg.URL, resp.StatusCode, strings.TrimSpace(string(data)))
+	if !hookStatusExpected(resp.StatusCode, cfg.ExpectStatus) {
+		return out, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	if cfg.BodyContains != "" && !strings.Contains(string(data), cfg.BodyContains) {
+		return out, fmt.Errorf("response does not contain %q", cfg.BodyContains)
+	}
+	return out, nil
+}
+
+func hookStatusExpected(code int, expected []int) bool {
+	if len(expected) == 0 {
+		return code >= 200 && code < 300
+	}
+	for _, v := range expected {
+		if v == code {
+			return true
+		}
+	}
+	return false
+}
+
+// runWait 轮询 http 检查或 Kubernetes 资源条件, 直到满足或超时。
+func (r *hookRunner) runWait(ctx context.Context, release *model.DeploymentRelease, target *model.DeploymentTarget, cfg releaseHookConfig) (string, error) {
+	interval := r.interval
+	if cfg.IntervalSeconds > 0 {
+		interval = time.Duration(cfg.IntervalSeconds) * time.Second
+	}
+	check := func(ctx context.Context) (string, error) { return r.checkHTTP(ctx, cfg) }
+	if cfg.Resource != "" {
+		cli, err := r.kube(ctx, target)
+		if err != nil {
+			return "", err
+		}
+		namespace := defaultIfEmpty(cfg.Namespace, defaultIfEmpty(release.NamespaceOrProject, "default"))
+		check = func(ctx context.Context) (string, error) {
+			return checkHookCondition(ctx, cli, namespace, cfg.Resource, cfg.Condition)
+		}
+	}
+	for {
+		out, err := check(ctx)
+		if err == nil {
+			return out, nil
+		}
+		select {
+		case <-ctx.Done():
+			return out, fmt.Errorf("timed out waiting for condition: %w", err)
+		case <-time.After(interval):
+		}
+	}
+}
+
+func splitHookResource(resource string) (string, string, error) {
+	kind, name, ok := strings.Cut(strings.TrimSpace(resource), "/")
+	kind = strings.ToLower(strings.TrimSpace(kind))
+	if !ok || strings.TrimSpace(name) == "" {
+		return "", "", fmt.Errorf("resource must be in the form kind/name")
+	}
+	switch kind {
+	case "deployment", "statefulset", "daemonset", "job", "pod":
+		return kind, strings.TrimSpace(name), nil
+	default:
+		return "", "", fmt.Errorf("resource kind must be one of: deployment, statefulset, daemonset, job, pod")
+	}
+}
+
+// checkHookCondition 判断资源条件是否成立。deployment/job/pod 比较 status.conditions,
+// statefulset/daemonset 的 Ready 表示全部副本就绪。
+func checkHookCondition(ctx context.Context, cli kubernetes.Interface, namespace, resource, condition string) (string, error) {
+	kind, name, err := splitHookResource(resource)
+	if err != nil {
+		return "", err
+	}
+	conditions := map[string]string{}
+	switch kind {
+	case "deployment":
+		condition = defaultIfEmpty(condition, "Available")
+		obj, err := cli.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		for _, c := range obj.Status.Conditions {
+			conditions[string(c.Type)] = string(c.Status)
+		}
+	case "statefulset":
+		condition = defaultIfEmpty(condition, "Ready")
+		obj, err := cli.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		desired := int32(1)
+		if obj.Spec.Replicas != nil {
+			desired = *obj.Spec.Replicas
+		}
+		conditions["Ready"] = strconv.FormatBool(obj.Status.ReadyReplicas >= desired)
+	case "daemonset":
+		condition = defaultIfEmpty(condition, "Ready")
+		obj, err := cli.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		conditions["Ready"] = strconv.FormatBool(obj.Status.DesiredNumberScheduled > 0 && obj.Status.NumberReady >= obj.Status.DesiredNumberScheduled)
+	case "job":
+		condition = defaultIfEmpty(condition, "Complete")
+		obj, err := cli.BatchV1().Jobs(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		for _, c := range obj.Status.Conditions {
+			conditions[string(c.Type)] = string(c.Status)
+		}
+	case "pod":
+		condition = defaultIfEmpty(condition, "Ready")
+		obj, err := cli.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		for _, c := range obj.Status.Conditions {
+			conditions[string(c.Type)] = string(c.Status)
+		}
+	}
+	if status := conditions[condition]; strings.EqualFold(status, "true") {
+		return fmt.Sprintf("%s %s/%s %s=True", kind, namespace, name, condition), nil
+	}
+	return fmt.Sprintf("%s %s/%s %s not met", kind, namespace, name, condition), fmt.Errorf("%s/%s condition %s not met", kind, name, condition)
+}
+
+func decodeHookJob(template string) (*batchv1.Job, error) {
+	var job batchv1.Job
+	if err := sigsyaml.Unmarshal([]byte(template), &job); err != nil {
+		return nil, fmt.Errorf("invalid job template: %w", err)
+	}
+	if job.Kind != "" && job.Kind != "Job" {
+		return nil, fmt.Errorf("job template kind must be Job, got %s", job.Kind)
+	}
+	if len(job.Spec.Template.Spec.Containers) == 0 {
+		return nil, fmt.Errorf("job template has no containers")
+	}
+	return &job, nil
+}
+
+// hookJobName 生成每次发布唯一的 Job 名称, 满足 DNS-1123 且不超过 63 个字符。
+func hookJobName(base string, releaseID, hookID uint) string {
+	suffix := fmt.Sprintf("-r%d-h%d", releaseID, hookID)
+	base = strings.Trim(hookJobNameInvalid.ReplaceAllString(strings.ToLower(defaultIfEmpty(base, "hook")), "-"), "-")
+	if max := 63 - len(suffix); len(base) > max {
+		base = strings.TrimRight(base[:max], "-")
+	}
+	return defaultIfEmpty(base, "hook") + suffix
+}
+
+// runJob 按模板创建 Job, 等待其完成并收集 Pod 日志; 超时后删除 Job。
+func (r *hookRunner) runJob(ctx context.Context, release *model.DeploymentRelease, target *model.DeploymentTarget, hook model.DeploymentReleaseHook, cfg releaseHookConfig) (string, error) {
+	cli, err := r.kube(ctx, target)
+	if err != nil {
+		return "", err
+	}
+	job, err := decodeHookJob(cfg.Template)
+	if err != nil {
+		return "", err
+	}
+	job.Name = hookJobName(job.Name, release.ID, hook.ID)
+	job.Namespace = defaultIfEmpty(cfg.Namespace, defaultIfEmpty(job.Namespace, defaultIfEmpty(release.NamespaceOrProject, "default")))
+	job.ResourceVersion = ""
+	if job.Labels == nil {
+		job.Labels = map[string]string{}
+	}
+	job.Labels[ownerManagedByLabel] = ownerManagedByValue
+	job.Labels[ownerServiceLabel] = strconv.FormatUint(uint64(release.ServiceID), 10)
+	job.Labels[ownerTargetLabel] = strconv.FormatUint(uint64(release.TargetID), 10)
+	job.Labels[hookReleaseLabel] = strconv.FormatUint(uint64(release.ID), 10)
+	job.Labels[hookIDLabel] = strconv.FormatUint(uint64(hook.ID), 10)
+	if job.Spec.BackoffLimit == nil {
+		backoff := int32(0)
+		job.Spec.BackoffLimit = &backoff
+	}
+	if job.Spec.TTLSecondsAfterFinished == nil {
+		ttl := int32(3600)
+		job.Spec.TTLSecondsAfterFinished = &ttl
+	}
+	if job.Spec.Template.Spec.RestartPolicy == "" {
+		job.Spec.Template.Spec.RestartPolicy = corev1.RestartPolicyNever
+	}
+	jobs := cli.BatchV1().Jobs(job.Namespace)
+	if _, err := jobs.Create(ctx, job, metav1.CreateOptions{}); err != nil {
+		return "", fmt.Errorf("create job %s/%s: %w", job.Namespace, job.Name, err)
+	}
+	header := fmt.Sprintf("job %s/%s", job.Namespace, job.Name)
+	for {
+		current, err := jobs.Get(ctx, job.Name, metav1.GetOptions{})
+		if err == nil {
+			if done, failed := hookJobFinished(current); done {
+				out := header + "\n" + hookJobLogs(ctx, cli, current)
+				if failed {
+					return out, fmt.Errorf("job %s failed", job.Name)
+				}
+				return out, nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			policy := metav1.DeletePropagationBackground
+			_ = jobs.Delete(context.Background(), job.Name, metav1.DeleteOptions{PropagationPolicy: &policy})
+			return header + "\n" + hookJobLogs(context.Background(), cli, job), fmt.Errorf("job %s timed out", job.Name)
+		case <-time.After(r.interval):
+		}
+	}
+}
+
+func hookJobFinished(job *batchv1.Job) (done, failed bool) {
+	for _, c := range job.Status.Conditions {
+		if c.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch c.Type {
+		case batchv1.JobComplete:
+			return true, false
+		case batchv1.JobFailed:
+			return true, true
+		}
+	}
+	if job.Status.Succeeded > 0 {
+		return true, false
+	}
+	if job.Spec.BackoffLimit != nil && job.Status.Failed > *job.Spec.BackoffLimit {
+		return true, true
+	}
+	return false, false
+}
+
+// hookJobLogs 收集 Job 所属 Pod 的日志尾部, 读取失败时返回错误说明而不影响钩子结果。
+func hookJobLogs(ctx context.Context, cli kubernetes.Interface, job *batchv1.Job) string {
+	pods, err := cli.CoreV1().Pods(job.Namespace).List(ctx, metav1.ListOptions{LabelSelector: "job-name=" + job.Name})
+	if err != nil {
+		return "logs unavailable: " + err.Error()
+	}
+	tail := int64(hookJobLogTailLines)
+	var out strings.Builder
+	for _, pod := range pods.Items {
+		data, err := cli.CoreV1().Pods(job.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{TailLines: &tail}).DoRaw(ctx)
+		if err != nil {
+			fmt.Fprintf(&out, "[%s] logs unavailable: %v\n", pod.Name, err)
+			continue
+		}
+		fmt.Fprintf(&out, "[%s]\n%s\n", pod.Name, strings.TrimSpace(string(data)))
+	}
+	return out.String()
+}
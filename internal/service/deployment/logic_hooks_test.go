@@ -0,0 +1,287 @@
+package deployment
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cy77cc/OpsPilot/internal/model"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const hookJobTemplate = `apiVersion: batch/v1
+kind: Job
+metadata:
+  name: db-migrate
+spec:
+  template:
+    spec:
+      containers:
+        - name: migrate
+          image: registry.local/app:{revision_id}
+          args: ["migrate", "--release", "{release_id}"]
+`
+
+func newTestHookRunner(l *Logic, runner composeNodeRunner, cli kubernetes.Interface) *hookRunner {
+	return &hookRunner{
+		logic:      l,
+		nodes:      runner,
+		httpClient: &http.Client{Timeout: time.Second},
+		kube: func(context.Context, *model.DeploymentTarget) (kubernetes.Interface, error) {
+			return cli, nil
+		},
+		rollback: func(context.Context, uint, uint64) (uint, error) { return 0, nil },
+		interval: 10 * time.Millisecond,
+	}
+}
+
+func (s *releaseTestSuite) createHook(t *testing.T, req ReleaseHookUpsertReq) model.DeploymentReleaseHook {
+	t.Helper()
+	hook, err := s.logic.CreateReleaseHook(context.Background(), 1, req)
+	if err != nil {
+		t.Fatalf("create hook %s: %v", req.Name, err)
+	}
+	return hook
+}
+
+func (s *releaseTestSuite) auditActions(t *testing.T, releaseID uint) []string {
+	t.Helper()
+	var rows []model.DeploymentReleaseAudit
+	s.db.Where("release_id = ?", releaseID).Order("id ASC").Find(&rows)
+	out := make([]string, 0, len(rows))
+	for _, row := range rows {
+		out = append(out, row.Action)
+	}
+	return out
+}
+
+func TestReleaseHooks_ValidateAndScope(t *testing.T) {
+	suite := newReleaseTestSuite(t)
+	ctx := context.Background()
+	svc := suite.createTestService(t)
+	target := suite.createComposeTarget(t, "10.0.0.1")
+
+	invalid := []ReleaseHookUpsertReq{
+		{Name: "no-scope", Phase: hookPhasePre, Kind: hookKindHTTP, Config: map[string]any{"url": "http://x"}},
+		{Name: "bad-kind", TargetID: target.ID, Phase: hookPhasePre, Kind: "script"},
+		{Name: "pre-rollback", TargetID: target.ID, Phase: hookPhasePre, Kind: hookKindHTTP, OnFailure: hookOnFailureRollback, Config: map[string]any{"url": "http://x"}},
+		{Name: "no-command", TargetID: target.ID, Phase: hookPhasePre, Kind: hookKindSSH},
+		{Name: "bad-job", TargetID: target.ID, Phase: hookPhasePre, Kind: hookKindK8sJob, Config: map[string]any{"template": "kind: Deployment"}},
+		{Name: "bad-wait", TargetID: target.ID, Phase: hookPhasePost, Kind: hookKindWait, Config: map[string]any{"resource": "service/web"}},
+	}
+	for _, req := range invalid {
+		if _, err := suite.logic.CreateReleaseHook(ctx, 1, req); err == nil {
+			t.Fatalf("expected hook %s to be rejected", req.Name)
+		}
+	}
+
+	second := suite.createHook(t, ReleaseHookUpsertReq{Name: "smoke", TargetID: target.ID, Phase: hookPhasePre, Kind: hookKindHTTP, SortOrder: 20, Config: map[string]any{"url": "http://x"}})
+	first := suite.createHook(t, ReleaseHookUpsertReq{Name: "migrate", ServiceID: svc.ID, Phase: hookPhasePre, Kind: hookKindK8sJob, SortOrder: 10, Config: map[string]any{"template": hookJobTemplate}})
+	suite.createHook(t, ReleaseHookUpsertReq{Name: "other-target", ServiceID: svc.ID, TargetID: target.ID + 100, Phase: hookPhasePre, Kind: hookKindSSH, Config: map[string]any{"command": "true"}})
+	suite.createHook(t, ReleaseHookUpsertReq{Name: "post", TargetID: target.ID, Phase: hookPhasePost, Kind: hookKindSSH, Config: map[string]any{"command": "true"}})
+	disabled := false
+	suite.createHook(t, ReleaseHookUpsertReq{Name: "disabled", TargetID: target.ID, Phase: hookPhasePre, Kind: hookKindSSH, Enabled: &disabled, Config: map[string]any{"command": "true"}})
+	if first.OnFailure != hookOnFailureAbort || first.TimeoutSeconds != defaultHookTimeoutSeconds {
+		t.Fatalf("expected pre hook defaults, got %+v", first)
+	}
+
+	release := suite.createTestRelease(t, svc.ID, target.ID, releaseStatusApplying)
+	hooks, err := suite.logic.loadReleaseHooks(ctx, release, hookPhasePre)
+	if err != nil {
+		t.Fatalf("load hooks: %v", err)
+	}
+	if len(hooks) != 2 || hooks[0].ID != first.ID || hooks[1].ID != second.ID {
+		t.Fatalf("expected migrate then smoke, got %+v", hooks)
+	}
+}
+
+func TestReleaseHooks_RunKindsInOrderAndRecordTimeline(t *testing.T) {
+	suite := newReleaseTestSuite(t)
+	ctx := context.Background()
+	svc := suite.createTestService(t)
+	target := suite.createComposeTarget(t, "10.0.0.1", "10.0.0.2")
+	release := suite.createTestRelease(t, svc.ID, target.ID, releaseStatusApplying)
+	release.RevisionID = 42
+	suite.db.Save(release)
+
+	smoke := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("release " + r.URL.Query().Get("release") + " ok"))
+	}))
+	defer smoke.Close()
+	var polls int32
+	warmup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if atomic.AddInt32(&polls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer warmup.Close()
+
+	cli := fake.NewSimpleClientset(&appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "staging"},
+		Status:     appsv1.DeploymentStatus{Conditions: []appsv1.DeploymentCondition{{Type: appsv1.DeploymentAvailable, Status: corev1.ConditionTrue}}},
+	})
+	cli.PrependReactor("create", "jobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		job := action.(k8stesting.CreateAction).GetObject().(*batchv1.Job)
+		job.Status.Succeeded = 1
+		return false, nil, nil
+	})
+
+	migrate := suite.createHook(t, ReleaseHookUpsertReq{Name: "migrate", ServiceID: svc.ID, Phase: hookPhasePre, Kind: hookKindK8sJob, SortOrder: 1, Config: map[string]any{"template": hookJobTemplate}})
+	suite.createHook(t, ReleaseHookUpsertReq{Name: "drain", TargetID: target.ID, Phase: hookPhasePre, Kind: hookKindSSH, SortOrder: 2, Config: map[string]any{"command": "drain --host {host} --release {release_id}"}})
+	suite.createHook(t, ReleaseHookUpsertReq{Name: "warmup", TargetID: target.ID, Phase: hookPhasePost, Kind: hookKindWait, SortOrder: 1, Config: map[string]any{"url": warmup.URL}})
+	suite.createHook(t, ReleaseHookUpsertReq{Name: "available", TargetID: target.ID, Phase: hookPhasePost, Kind: hookKindWait, SortOrder: 2, Config: map[string]any{"resource": "deployment/web"}})
+	suite.createHook(t, ReleaseHookUpsertReq{Name: "smoke", TargetID: target.ID, Phase: hookPhasePost, Kind: hookKindHTTP, SortOrder: 3, Config: map[string]any{"url": smoke.URL + "/?release={release_id}", "body_contains": "ok"}})
+
+	runner := newFakeComposeRunner()
+	hr := newTestHookRunner(suite.logic, runner, cli)
+	if err := hr.Run(ctx, release, hookPhasePre); err != nil {
+		t.Fatalf("pre hooks: %v", err)
+	}
+	if err := hr.Run(ctx, release, hookPhasePost); err != nil {
+		t.Fatalf("post hooks: %v", err)
+	}
+
+	job, err := cli.BatchV1().Jobs("staging").Get(ctx, hookJobName("db-migrate", release.ID, migrate.ID), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected migration job to be created: %v", err)
+	}
+	if image := job.Spec.Template.Spec.Containers[0].Image; image != "registry.local/app:42" {
+		t.Fatalf("expected template variables to be expanded, got image %s", image)
+	}
+	if job.Labels[hookReleaseLabel] == "" || job.Spec.Template.Spec.RestartPolicy != corev1.RestartPolicyNever {
+		t.Fatalf("expected hook labels and defaults on job, got %+v", job.ObjectMeta.Labels)
+	}
+	if len(runner.commands) != 2 || !strings.Contains(runner.commands[1], "--host 10.0.0.2 --release ") {
+		t.Fatalf("expected drain on both nodes, got %v", runner.commands)
+	}
+	if atomic.LoadInt32(&polls) != 3 {
+		t.Fatalf("expected wait hook to poll until healthy, got %d polls", polls)
+	}
+
+	actions := suite.auditActions(t, release.ID)
+	if n := strings.Count(strings.Join(actions, ","), "release.hook_succeeded"); n != 5 {
+		t.Fatalf("expected 5 successful hooks on the timeline, got %v", actions)
+	}
+	var audit model.DeploymentReleaseAudit
+	suite.db.Where("release_id = ? AND action = ?", release.ID, "release.hook_succeeded").Order("id DESC").First(&audit)
+	if !strings.Contains(audit.DetailJSON, fmt.Sprintf("release %d ok", release.ID)) {
+		t.Fatalf("expected hook output attached to timeline, got %s", audit.DetailJSON)
+	}
+}
+
+func TestReleaseHooks_PreHookFailureAbortsRelease(t *testing.T) {
+	suite := newReleaseTestSuite(t)
+	ctx := context.Background()
+	svc := suite.createTestService(t)
+	target := suite.createComposeTarget(t, "10.0.0.1")
+	release := suite.createTestRelease(t, svc.ID, target.ID, releaseStatusApplying)
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer broken.Close()
+
+	suite.createHook(t, ReleaseHookUpsertReq{Name: "optional", TargetID: target.ID, Phase: hookPhasePre, Kind: hookKindHTTP, SortOrder: 1, OnFailure: hookOnFailureIgnore, Config: map[string]any{"url": broken.URL}})
+	suite.createHook(t, ReleaseHookUpsertReq{Name: "required", TargetID: target.ID, Phase: hookPhasePre, Kind: hookKindHTTP, SortOrder: 2, Config: map[string]any{"url": broken.URL, "expect_status": []int{200}}})
+	suite.createHook(t, ReleaseHookUpsertReq{Name: "never", TargetID: target.ID, Phase: hookPhasePre, Kind: hookKindSSH, SortOrder: 3, Config: map[string]any{"command": "true"}})
+
+	runner := newFakeComposeRunner()
+	err := newTestHookRunner(suite.logic, runner, fake.NewSimpleClientset()).Run(ctx, release, hookPhasePre)
+	if err == nil || !strings.Contains(err.Error(), `"required"`) {
+		t.Fatalf("expected required pre hook to abort, got %v", err)
+	}
+	if len(runner.commands) != 0 {
+		t.Fatalf("expected hooks after the failure to be skipped, got %v", runner.commands)
+	}
+	var stored model.DeploymentRelease
+	suite.db.First(&stored, release.ID)
+	if stored.Status != releaseStatusFailed || !strings.Contains(stored.DiagnosticsJSON, "pre_hook_failed") {
+		t.Fatalf("expected release failed by pre hook, got %s %s", stored.Status, stored.DiagnosticsJSON)
+	}
+	actions := strings.Join(suite.auditActions(t, release.ID), ",")
+	if strings.Count(actions, "release.hook_failed") != 2 || !strings.HasSuffix(actions, "release.failed") {
+		t.Fatalf("unexpected timeline: %s", actions)
+	}
+}
+
+func TestReleaseHooks_PostHookFailureTriggersRollback(t *testing.T) {
+	suite := newReleaseTestSuite(t)
+	ctx := context.Background()
+	svc := suite.createTestService(t)
+	target := suite.createComposeTarget(t, "10.0.0.1")
+	release := suite.createTestRelease(t, svc.ID, target.ID, releaseStatusVerifying)
+
+	suite.createHook(t, ReleaseHookUpsertReq{Name: "smoke", TargetID: target.ID, Phase: hookPhasePost, Kind: hookKindHTTP, OnFailure: hookOnFailureRollback, TimeoutSeconds: 1, Config: map[string]any{"url": "http://127.0.0.1:1/health"}})
+
+	var rolledBack uint
+	hr := newTestHookRunner(suite.logic, newFakeComposeRunner(), fake.NewSimpleClientset())
+	hr.rollback = func(_ context.Context, releaseID uint, _ uint64) (uint, error) {
+		rolledBack = releaseID
+		return releaseID + 1, nil
+	}
+	if err := hr.Run(ctx, release, hookPhasePost); err == nil {
+		t.Fatal("expected post hook failure")
+	}
+	if rolledBack != release.ID {
+		t.Fatalf("expected automatic rollback of release %d, got %d", release.ID, rolledBack)
+	}
+	var stored model.DeploymentRelease
+	suite.db.First(&stored, release.ID)
+	if stored.Status != releaseStatusFailed || !strings.Contains(stored.DiagnosticsJSON, "post_hook_failed") {
+		t.Fatalf("expected release failed by post hook, got %s %s", stored.Status, stored.DiagnosticsJSON)
+	}
+	var audit model.DeploymentReleaseAudit
+	if err := suite.db.Where("release_id = ? AND action = ?", release.ID, "release.hook_rollback").First(&audit).Error; err != nil {
+		t.Fatalf("expected rollback on timeline: %v", err)
+	}
+}
+
+func TestReleaseHooks_FailureKeepsConcurrentAbort(t *testing.T) {
+	suite := newReleaseTestSuite(t)
+	ctx := context.Background()
+	svc := suite.createTestService(t)
+	target := suite.createComposeTarget(t, "10.0.0.1")
+	release := suite.createTestRelease(t, svc.ID, target.ID, releaseStatusVerifying)
+	// 钩子执行期间发布被中止, 随后钩子失败。
+	aborting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		suite.db.Model(&model.DeploymentRelease{}).Where("id = ?", release.ID).Update("status", releaseStatusAborted)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer aborting.Close()
+
+	suite.createHook(t, ReleaseHookUpsertReq{Name: "smoke", TargetID: target.ID, Phase: hookPhasePost, Kind: hookKindHTTP, OnFailure: hookOnFailureRollback, TimeoutSeconds: 1, Config: map[string]any{"url": aborting.URL}})
+
+	rolledBack := false
+	hr := newTestHookRunner(suite.logic, newFakeComposeRunner(), fake.NewSimpleClientset())
+	hr.rollback = func(context.Context, uint, uint64) (uint, error) {
+		rolledBack = true
+		return 0, nil
+	}
+	if err := hr.Run(ctx, release, hookPhasePost); err == nil {
+		t.Fatal("expected post hook failure")
+	}
+	if rolledBack {
+		t.Fatal("expected no rollback for a release aborted while the hook ran")
+	}
+	var stored model.DeploymentRelease
+	suite.db.First(&stored, release.ID)
+	if stored.Status != releaseStatusAborted || strings.Contains(stored.DiagnosticsJSON, "post_hook_failed") {
+		t.Fatalf("expected abort to be kept, got %s %s", stored.Status, stored.DiagnosticsJSON)
+	}
+	if actions := strings.Join(suite.auditActions(t, release.ID), ","); strings.Contains(actions, "release.failed") {
+		t.Fatalf("expected no release.failed event, got %s", actions)
+	}
+}
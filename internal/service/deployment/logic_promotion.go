@@ -0,0 +1,329 @@
+package deployment
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/cy77cc/OpsPilot/internal/model"
+)
+
+// ErrPromotionDenied 表示源发布或环境跃迁不满足晋级条件。
+var ErrPromotionDenied = errors.New("release promotion denied")
+
+const triggerSourcePromotion = "promotion"
+
+// defaultPromotionPath 是未配置晋级策略时的环境顺序。
+var defaultPromotionPath = []string{"dev", "staging", "production"}
+
+// promotionEnvAliases 把常见的环境简写归一, 便于与晋级路径比较。
+var promotionEnvAliases = map[string]string{
+	"development": "dev",
+	"stage":       "staging",
+	"prod":        "production",
+}
+
+// imageLinePattern 匹配清单中的 image 字段行, 包括列表项形式 "- image: x"。
+var imageLinePattern = regexp.MustCompile(`(?m)^([ \t]*(?:-[ \t]+)?image:[ \t]*)(\S[^\r\n#]*?)[ \t]*$`)
+
+// promotionRule 是 promotion 类型策略的配置。
+//
+//	{"path": ["dev", "staging", "production"]}
+//
+// 发布只能从路径上的一个环境晋级到紧邻的下一个环境。
+type promotionRule struct {
+	Path []string `json:"path"`
+}
+
+// promotionPlan 是一次晋级的完整上下文: 源发布、目标、渲染结果与固定的镜像。
+type promotionPlan struct {
+	Source    *model.DeploymentRelease
+	Target    *model.DeploymentTarget
+	FromEnv   string
+	ToEnv     string
+	Path      []string
+	PolicyID  uint
+	Render    releaseRender
+	Images    []string
+	Reapplied []string
+}
+
+func normalizePromotionEnv(env string) string {
+	env = strings.ToLower(strings.TrimSpace(env))
+	if alias, ok := promotionEnvAliases[env]; ok {
+		return alias
+	}
+	return env
+}
+
+// parsePromotionRule 解析并校验晋级策略配置。
+func parsePromotionRule(raw map[string]any) (promotionRule, error) {
+	var rule promotionRule
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return rule, err
+	}
+	if err := json.Unmarshal(data, &rule); err != nil {
+		return rule, fmt.Errorf("invalid promotion policy config: %w", err)
+	}
+	seen := map[string]struct{}{}
+	path := make([]string, 0, len(rule.Path))
+	for _, env := range rule.Path {
+		env = normalizePromotionEnv(env)
+		if env == "" {
+			return rule, fmt.Errorf("promotion policy path must not contain empty environments")
+		}
+		if _, ok := seen[env]; ok {
+			return rule, fmt.Errorf("promotion policy path lists %q more than once", env)
+		}
+		seen[env] = struct{}{}
+		path = append(path, env)
+	}
+	if len(path) < 2 {
+		return rule, fmt.Errorf("promotion policy path must contain at least two environments")
+	}
+	rule.Path = path
+	return rule, nil
+}
+
+// allows 判断 from -> to 是否是路径上相邻的一次前进。
+func (r promotionRule) allows(from, to string) error {
+	idx := -1
+	for i, env := range r.Path {
+		if env == from {
+			idx = i
+			break
+		}
+	}
+	switch {
+	case idx < 0:
+		return fmt.Errorf("%w: source env %q is not on promotion path %s", ErrPromotionDenied, from, strings.Join(r.Path, " -> "))
+	case idx == len(r.Path)-1:
+		return fmt.Errorf("%w: %q is the last stage of promotion path %s", ErrPromotionDenied, from, strings.Join(r.Path, " -> "))
+	case r.Path[idx+1] != to:
+		return fmt.Errorf("%w: %s can only be promoted to %s, not %s", ErrPromotionDenied, from, r.Path[idx+1], to)
+	}
+	return nil
+}
+
+// promotionRuleFor 返回作用于目标的晋级策略; 目标级策略优先于全局策略, 均未配置时使用默认路径。
+func (l *Logic) promotionRuleFor(ctx context.Context, targetID uint) (promotionRule, uint, error) {
+	var policies []model.Policy
+	if err := l.svcCtx.DB.WithContext(ctx).
+		Where("type = ? AND enabled = ? AND (target_id = 0 OR target_id = ?)", model.PolicyTypePromotion, true, targetID).
+		Order("target_id DESC, id ASC").Find(&policies).Error; err != nil {
+		return promotionRule{}, 0, fmt.Errorf("load promotion policies: %w", err)
+	}
+	for _, p := range policies {
+		rule, err := parsePromotionRule(p.Config)
+		if err != nil {
+			continue
+		}
+		return rule, p.ID, nil
+	}
+	return promotionRule{Path: defaultPromotionPath}, 0, nil
+}
+
+func verificationPassed(raw string) bool {
+	var v struct {
+		Passed bool `json:"passed"`
+	}
+	if strings.TrimSpace(raw) == "" || json.Unmarshal([]byte(raw), &v) != nil {
+		return false
+	}
+	return v.Passed
+}
+
+// buildPromotionPlan 校验源发布与晋级路径, 并用源发布的模板和请求变量、目标环境的变量集重新渲染清单,
+// 最后把镜像引用固定为源发布实际部署的镜像。
+func (l *Logic) buildPromotionPlan(ctx context.Context, sourceID, targetID uint) (*promotionPlan, error) {
+	var source model.DeploymentRelease
+	if err := l.svcCtx.DB.WithContext(ctx).First(&source, sourceID).Error; err != nil {
+		return nil, err
+	}
+	if source.Status != releaseStatusApplied {
+		return nil, fmt.Errorf("%w: source release %d is %s, only applied releases can be promoted", ErrPromotionDenied, source.ID, source.Status)
+	}
+	if !verificationPassed(source.VerificationJSON) {
+		return nil, fmt.Errorf("%w: source release %d has not passed verification", ErrPromotionDenied, source.ID)
+	}
+	var target model.DeploymentTarget
+	if err := l.svcCtx.DB.WithContext(ctx).First(&target, targetID).Error; err != nil {
+		return nil, err
+	}
+	if target.ID == source.TargetID {
+		return nil, fmt.Errorf("%w: promotion target must differ from the source target", ErrPromotionDenied)
+	}
+	if target.TargetType != source.RuntimeType {
+		return nil, fmt.Errorf("%w: cannot promote a %s release to a %s target", ErrPromotionDenied, source.RuntimeType, target.TargetType)
+	}
+	fromEnv, toEnv := normalizePromotionEnv(source.NamespaceOrProject), normalizePromotionEnv(target.Env)
+	if toEnv == "" {
+		return nil, fmt.Errorf("%w: target %d has no environment", ErrPromotionDenied, target.ID)
+	}
+	rule, policyID, err := l.promotionRuleFor(ctx, target.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := rule.allows(fromEnv, toEnv); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(source.TemplateSnapshot) == "" {
+		return nil, fmt.Errorf("source release %d has no template snapshot, redeploy it before promoting", source.ID)
+	}
+	var vars releaseVariables
+	if strings.TrimSpace(source.VariablesJSON) != "" {
+		if err := json.Unmarshal([]byte(source.VariablesJSON), &vars); err != nil {
+			return nil, fmt.Errorf("invalid source release variables: %w", err)
+		}
+	}
+	envValues, err := l.serviceEnvVariables(ctx, source.ServiceID, strings.ToLower(strings.TrimSpace(target.Env)))
+	if err != nil {
+		return nil, err
+	}
+	// 目标环境变量集中定义的键一律取目标环境的值, 其余请求变量沿用源发布。
+	request := map[string]string{}
+	for k, v := range vars.Request {
+		if _, ok := envValues[k]; !ok {
+			request[k] = v
+		}
+	}
+	render, err := renderReleaseManifest(source.TemplateSnapshot, request, envValues)
+	if err != nil {
+		return nil, fmt.Errorf("render promoted manifest for %s: %w", toEnv, err)
+	}
+	images := manifestImageRefs(source.ManifestSnapshot)
+	pinned, err := pinManifestImages(render.Manifest, images)
+	if err != nil {
+		return nil, err
+	}
+	render.Manifest = pinned
+	return &promotionPlan{
+		Source:    &source,
+		Target:    &target,
+		FromEnv:   fromEnv,
+		ToEnv:     toEnv,
+		Path:      rule.Path,
+		PolicyID:  policyID,
+		Render:    render,
+		Images:    images,
+		Reapplied: render.Variables.EnvKeys,
+	}, nil
+}
+
+func (p *promotionPlan) releaseReq(req ReleasePromotionReq) ReleasePreviewReq {
+	return ReleasePreviewReq{
+		ServiceID:         p.Source.ServiceID,
+		TargetID:          p.Target.ID,
+		Env:               strings.ToLower(strings.TrimSpace(p.Target.Env)),
+		Strategy:          req.Strategy,
+		StrategyConfig:    req.StrategyConfig,
+		TriggerSource:     triggerSourcePromotion,
+		PreviewToken:      req.PreviewToken,
+		EmergencyOverride: req.EmergencyOverride,
+		OverrideReason:    req.OverrideReason,
+		promotion:         p,
+	}
+}
+
+func (p *promotionPlan) resp() *ReleasePromotionResp {
+	reapplied := p.Reapplied
+	if reapplied == nil {
+		reapplied = []string{}
+	}
+	return &ReleasePromotionResp{
+		SourceReleaseID:    p.Source.ID,
+		SourceTargetID:     p.Source.TargetID,
+		RevisionID:         p.Source.RevisionID,
+		FromEnv:            p.FromEnv,
+		ToEnv:              p.ToEnv,
+		Path:               p.Path,
+		PolicyID:           p.PolicyID,
+		Images:             unquoteImages(p.Images),
+		ReappliedVariables: reapplied,
+	}
+}
+
+// PreviewReleasePromotion 预览把发布晋级到目标上的结果, 返回的 preview_token 用于 ApplyReleasePromotion。
+func (l *Logic) PreviewReleasePromotion(ctx context.Context, sourceID uint, req ReleasePromotionReq) (ReleasePreviewResp, error) {
+	plan, err := l.buildPromotionPlan(ctx, sourceID, req.TargetID)
+	if err != nil {
+		return ReleasePreviewResp{}, err
+	}
+	resp, err := l.PreviewRelease(ctx, plan.releaseReq(req))
+	if err != nil {
+		return ReleasePreviewResp{}, err
+	}
+	resp.Promotion = plan.resp()
+	resp.Checks = append(resp.Checks, map[string]string{
+		"code":    "promotion",
+		"message": fmt.Sprintf("promote release #%d from %s to %s, %d image(s) pinned, re-applied variables: %s", plan.Source.ID, plan.FromEnv, plan.ToEnv, len(plan.Images), defaultIfEmpty(strings.Join(plan.Reapplied, ", "), "none")),
+		"level":   "info",
+	})
+	return resp, nil
+}
+
+// ApplyReleasePromotion 创建晋级发布, 之后与普通发布一样经过冻结窗口、审批与执行。
+func (l *Logic) ApplyReleasePromotion(ctx context.Context, uid uint64, sourceID uint, req ReleasePromotionReq) (ReleaseApplyResp, error) {
+	plan, err := l.buildPromotionPlan(ctx, sourceID, req.TargetID)
+	if err != nil {
+		return ReleaseApplyResp{}, err
+	}
+	return l.ApplyRelease(ctx, uid, plan.releaseReq(req))
+}
+
+// writePromotionAudits 在新旧两个发布的时间线上互相记录晋级关系。
+func (l *Logic) writePromotionAudits(ctx context.Context, actor uint, release *model.DeploymentRelease, plan *promotionPlan) {
+	l.writeReleaseAudit(ctx, release.ID, actor, "release.promoted_from", map[string]any{
+		"source_release_id":   plan.Source.ID,
+		"source_target_id":    plan.Source.TargetID,
+		"from_env":            plan.FromEnv,
+		"to_env":              plan.ToEnv,
+		"revision_id":         plan.Source.RevisionID,
+		"images":              unquoteImages(plan.Images),
+		"reapplied_variables": plan.Reapplied,
+		"policy_id":           plan.PolicyID,
+	})
+	l.writeReleaseAudit(ctx, plan.Source.ID, actor, "release.promoted_to", map[string]any{
+		"release_id": release.ID,
+		"target_id":  release.TargetID,
+		"env":        plan.ToEnv,
+	})
+}
+
+// manifestImageRefs 按出现顺序返回清单中所有 image 字段的原始取值。
+func manifestImageRefs(manifest string) []string {
+	matches := imageLinePattern.FindAllStringSubmatch(manifest, -1)
+	out := make([]string, 0, len(matches))
+	for _, m := range matches {
+		out = append(out, m[2])
+	}
+	return out
+}
+
+// pinManifestImages 按出现顺序把清单中的 image 字段替换为给定取值。
+// 同一模板渲染出的清单 image 字段数量必然一致, 数量不同说明模板结构已变化, 拒绝晋级。
+func pinManifestImages(manifest string, images []string) (string, error) {
+	current := manifestImageRefs(manifest)
+	if len(current) != len(images) {
+		return "", fmt.Errorf("%w: promoted manifest has %d image reference(s), source release has %d", ErrPromotionDenied, len(current), len(images))
+	}
+	i := 0
+	return imageLinePattern.ReplaceAllStringFunc(manifest, func(line string) string {
+		m := imageLinePattern.FindStringSubmatch(line)
+		line = m[1] + images[i]
+		i++
+		return line
+	}), nil
+}
+
+func unquoteImages(images []string) []string {
+	out := make([]string, 0, len(images))
+	for _, img := range images {
+		out = append(out, strings.Trim(img, `"'`))
+	}
+	return out
+}
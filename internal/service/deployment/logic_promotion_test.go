@@ -0,0 +1,152 @@
+package deployment
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/cy77cc/OpsPilot/internal/model"
+)
+
+const promotionTemplate = "services:\n  app:\n    image: registry.local/app:{{tag}}\n    environment:\n      DB_HOST: {{db_host}}\n      LOG_LEVEL: {{log_level}}\n"
+
+// createVerifiedStagingRelease 创建一个在 staging 验证通过的 compose 发布, db_host 来自 staging 变量集。
+func (s *releaseTestSuite) createVerifiedStagingRelease(t *testing.T, svcID uint) *model.DeploymentRelease {
+	t.Helper()
+	source := &model.DeploymentTarget{Name: "edge-staging", TargetType: "compose", RuntimeType: "compose", Env: "staging", Status: "active", ReadinessStatus: "ready"}
+	if err := s.db.Create(source).Error; err != nil {
+		t.Fatalf("create source target: %v", err)
+	}
+	release := &model.DeploymentRelease{
+		ServiceID:          svcID,
+		TargetID:           source.ID,
+		NamespaceOrProject: "staging",
+		RuntimeType:        "compose",
+		Strategy:           "rolling",
+		RevisionID:         7,
+		Status:             releaseStatusApplied,
+		TemplateSnapshot:   promotionTemplate,
+		VariablesJSON:      toJSON(releaseVariables{Env: "staging", Request: map[string]string{"tag": "1.4.2", "log_level": "debug"}, EnvKeys: []string{"db_host"}}),
+		ManifestSnapshot:   "services:\n  app:\n    image: registry.local/app:1.4.2\n    environment:\n      DB_HOST: staging-db\n      LOG_LEVEL: debug\n",
+		VerificationJSON:   `{"runtime":"compose","passed":true}`,
+		Operator:           1,
+	}
+	if err := s.db.Create(release).Error; err != nil {
+		t.Fatalf("create source release: %v", err)
+	}
+	return release
+}
+
+func TestPromoteRelease_ReappliesEnvVariablesAndPinsImages(t *testing.T) {
+	suite := newReleaseTestSuite(t)
+	ctx := context.Background()
+	svc := suite.createTestService(t)
+	source := suite.createVerifiedStagingRelease(t, svc.ID)
+	target := suite.createComposeTarget(t, "10.0.0.1")
+	// 生产变量集覆盖 db_host, 同时把 tag 配成 latest: 镜像必须仍然固定为源发布的 1.4.2。
+	if err := suite.db.Create(&model.ServiceVariableSet{ServiceID: svc.ID, Env: "production", ValuesJSON: `{"db_host":"prod-db","tag":"latest"}`}).Error; err != nil {
+		t.Fatalf("create variable set: %v", err)
+	}
+
+	preview, err := suite.logic.PreviewReleasePromotion(ctx, source.ID, ReleasePromotionReq{TargetID: target.ID})
+	if err != nil {
+		t.Fatalf("preview promotion: %v", err)
+	}
+	if !strings.Contains(preview.ResolvedManifest, "image: registry.local/app:1.4.2") || strings.Contains(preview.ResolvedManifest, ":latest") {
+		t.Fatalf("expected image pinned to source release, got:\n%s", preview.ResolvedManifest)
+	}
+	if !strings.Contains(preview.ResolvedManifest, "DB_HOST: prod-db") || !strings.Contains(preview.ResolvedManifest, "LOG_LEVEL: debug") {
+		t.Fatalf("expected production variables re-applied and request variables kept, got:\n%s", preview.ResolvedManifest)
+	}
+	if preview.Promotion == nil || preview.Promotion.FromEnv != "staging" || preview.Promotion.ToEnv != "production" {
+		t.Fatalf("unexpected promotion summary: %+v", preview.Promotion)
+	}
+	if got := strings.Join(preview.Promotion.ReappliedVariables, ","); got != "db_host,tag" {
+		t.Fatalf("expected db_host,tag to be re-applied, got %s", got)
+	}
+
+	resp, err := suite.logic.ApplyReleasePromotion(ctx, 2, source.ID, ReleasePromotionReq{TargetID: target.ID, PreviewToken: preview.PreviewToken})
+	if err != nil {
+		t.Fatalf("apply promotion: %v", err)
+	}
+	if resp.Status != releaseStatusPendingApproval || resp.TriggerSource != triggerSourcePromotion {
+		t.Fatalf("expected production promotion to wait for approval, got %+v", resp)
+	}
+	var promoted model.DeploymentRelease
+	if err := suite.db.First(&promoted, resp.ReleaseID).Error; err != nil {
+		t.Fatalf("load promoted release: %v", err)
+	}
+	if promoted.SourceReleaseID != source.ID || promoted.RevisionID != source.RevisionID {
+		t.Fatalf("expected promoted release to link to source %d revision %d, got source=%d revision=%d", source.ID, source.RevisionID, promoted.SourceReleaseID, promoted.RevisionID)
+	}
+	if promoted.TemplateSnapshot != promotionTemplate {
+		t.Fatalf("expected template snapshot to be carried for the next promotion")
+	}
+	timeline, err := suite.logic.ListReleaseTimeline(ctx, promoted.ID)
+	if err != nil {
+		t.Fatalf("timeline: %v", err)
+	}
+	if !timelineHas(timeline, "release.promoted_from") {
+		t.Fatalf("expected promoted_from event on promoted release, got %+v", timeline)
+	}
+	sourceTimeline, _ := suite.logic.ListReleaseTimeline(ctx, source.ID)
+	if !timelineHas(sourceTimeline, "release.promoted_to") {
+		t.Fatalf("expected promoted_to event on source release, got %+v", sourceTimeline)
+	}
+}
+
+func TestPromoteRelease_EnforcesVerificationAndPath(t *testing.T) {
+	suite := newReleaseTestSuite(t)
+	ctx := context.Background()
+	svc := suite.createTestService(t)
+	source := suite.createVerifiedStagingRelease(t, svc.ID)
+	prod := suite.createComposeTarget(t, "10.0.0.1")
+	if err := suite.db.Create(&model.ServiceVariableSet{ServiceID: svc.ID, Env: "production", ValuesJSON: `{"db_host":"prod-db"}`}).Error; err != nil {
+		t.Fatalf("create variable set: %v", err)
+	}
+
+	suite.db.Model(source).Update("verification_json", `{"runtime":"compose","passed":false}`)
+	if _, err := suite.logic.PreviewReleasePromotion(ctx, source.ID, ReleasePromotionReq{TargetID: prod.ID}); !errors.Is(err, ErrPromotionDenied) {
+		t.Fatalf("expected unverified release to be refused, got %v", err)
+	}
+	suite.db.Model(source).Update("verification_json", `{"runtime":"compose","passed":true}`)
+
+	// dev 发布不能越过 staging 直接进入生产。
+	suite.db.Model(source).Update("namespace_or_project", "dev")
+	if _, err := suite.logic.PreviewReleasePromotion(ctx, source.ID, ReleasePromotionReq{TargetID: prod.ID}); !errors.Is(err, ErrPromotionDenied) {
+		t.Fatalf("expected dev -> production to be refused by the default path, got %v", err)
+	}
+	// 目标级晋级策略可以改写路径。
+	suite.db.Create(&model.Policy{Name: "hotfix-path", Type: model.PolicyTypePromotion, TargetID: prod.ID, Enabled: true, Config: map[string]any{"path": []any{"dev", "prod"}}})
+	if _, err := suite.logic.PreviewReleasePromotion(ctx, source.ID, ReleasePromotionReq{TargetID: prod.ID}); err != nil {
+		t.Fatalf("expected target promotion policy to allow dev -> prod: %v", err)
+	}
+}
+
+func TestPinManifestImages(t *testing.T) {
+	manifest := "spec:\n  containers:\n  - name: app\n    image: app:latest\n  - image: \"sidecar:2\"\n    name: proxy\n"
+	pinned, err := pinManifestImages(manifest, []string{"app@sha256:abc", `"sidecar:1"`})
+	if err != nil {
+		t.Fatalf("pin: %v", err)
+	}
+	want := "spec:\n  containers:\n  - name: app\n    image: app@sha256:abc\n  - image: \"sidecar:1\"\n    name: proxy\n"
+	if pinned != want {
+		t.Fatalf("unexpected pinned manifest:\n%s", pinned)
+	}
+	if _, err := pinManifestImages(manifest, []string{"app:1"}); !errors.Is(err, ErrPromotionDenied) {
+		t.Fatalf("expected image count mismatch to be refused, got %v", err)
+	}
+	if _, err := parsePromotionRule(map[string]any{"path": []any{"staging", "stage"}}); err == nil {
+		t.Fatal("expected duplicate environments in path to be rejected")
+	}
+}
+
+func timelineHas(events []ReleaseTimelineEventResp, action string) bool {
+	for _, e := range events {
+		if e.Action == action {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,363 @@
+package deployment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/cy77cc/OpsPilot/internal/model"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// 归属标签: 每个由发布下发的对象都会带上服务与目标标识, 清理时只删除归属一致的对象。
+const (
+	ownerManagedByLabel = "opspilot.io/managed-by"
+	ownerServiceLabel   = "opspilot.io/service-id"
+	ownerTargetLabel    = "opspilot.io/target-id"
+	ownerManagedByValue = "opspilot"
+
+	releaseFieldManager = "OpsPilot"
+)
+
+// prunedObject 记录被清理对象的标识与删除前的快照, 回滚时据此恢复。
+type prunedObject struct {
+	ReleaseInventoryItem
+	Object map[string]any `json:"object,omitempty"`
+}
+
+func (i ReleaseInventoryItem) key() string {
+	return strings.Join([]string{i.Group, i.Kind, defaultIfEmpty(i.Namespace, "default"), i.Name}, "/")
+}
+
+func (i ReleaseInventoryItem) String() string {
+	if i.Namespace == "" {
+		return fmt.Sprintf("%s/%s", i.Kind, i.Name)
+	}
+	return fmt.Sprintf("%s/%s/%s", i.Kind, i.Namespace, i.Name)
+}
+
+func (i ReleaseInventoryItem) gvk() schema.GroupVersionKind {
+	return schema.GroupVersionKind{Group: i.Group, Version: i.Version, Kind: i.Kind}
+}
+
+func inventoryItemFromObject(obj *unstructured.Unstructured) ReleaseInventoryItem {
+	gvk := obj.GroupVersionKind()
+	return ReleaseInventoryItem{Group: gvk.Group, Version: gvk.Version, Kind: gvk.Kind, Namespace: obj.GetNamespace(), Name: obj.GetName()}
+}
+
+// manifestInventory 返回清单中声明的对象, 命名空间保持清单原样。
+func manifestInventory(manifest string) ([]ReleaseInventoryItem, error) {
+	objs, err := decodeManifestObjects(manifest)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]ReleaseInventoryItem, 0, len(objs))
+	for _, obj := range objs {
+		out = append(out, inventoryItemFromObject(obj))
+	}
+	return out, nil
+}
+
+func parseInventory(raw string) []ReleaseInventoryItem {
+	out := make([]ReleaseInventoryItem, 0)
+	if strings.TrimSpace(raw) == "" {
+		return out
+	}
+	_ = json.Unmarshal([]byte(raw), &out)
+	return out
+}
+
+func parsePrunedObjects(raw string) []prunedObject {
+	out := make([]prunedObject, 0)
+	if strings.TrimSpace(raw) == "" {
+		return out
+	}
+	_ = json.Unmarshal([]byte(raw), &out)
+	return out
+}
+
+// pruneCandidates 返回上一次发布拥有但当前清单中已不存在的对象。
+func pruneCandidates(previous, current []ReleaseInventoryItem) []ReleaseInventoryItem {
+	keep := make(map[string]struct{}, len(current))
+	for _, item := range current {
+		keep[item.key()] = struct{}{}
+	}
+	out := make([]ReleaseInventoryItem, 0)
+	for _, item := range previous {
+		if _, ok := keep[item.key()]; ok {
+			continue
+		}
+		keep[item.key()] = struct{}{}
+		out = append(out, item)
+	}
+	return out
+}
+
+func ownershipLabels(release *model.DeploymentRelease) map[string]string {
+	return map[string]string{
+		ownerManagedByLabel: ownerManagedByValue,
+		ownerServiceLabel:   fmt.Sprintf("%d", release.ServiceID),
+		ownerTargetLabel:    fmt.Sprintf("%d", release.TargetID),
+	}
+}
+
+func withOwnershipLabels(obj *unstructured.Unstructured, release *model.DeploymentRelease) {
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	for k, v := range ownershipLabels(release) {
+		labels[k] = v
+	}
+	obj.SetLabels(labels)
+}
+
+// ownedByRelease 判断集群中的对象是否归属于发布所在的服务与目标。
+func ownedByRelease(obj *unstructured.Unstructured, release *model.DeploymentRelease) bool {
+	labels := obj.GetLabels()
+	for k, v := range ownershipLabels(release) {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// isStrategyDeployment 判断对象是否为金丝雀或蓝绿发布生成的 Deployment。
+// 这些 Deployment 可能仍在承接流量, 由 clearBlueGreen 与 finishCanary 在新版本就绪后收回, 清理阶段不删除。
+func isStrategyDeployment(obj *unstructured.Unstructured) bool {
+	if obj.GetKind() != "Deployment" {
+		return false
+	}
+	labels := obj.GetLabels()
+	return labels[strategyColorLabel] != "" || labels[strategyTrackLabel] != ""
+}
+
+// pruneSnapshot 去掉服务端生成的字段, 使快照可以重新应用。
+func pruneSnapshot(obj *unstructured.Unstructured) map[string]any {
+	cp := obj.DeepCopy()
+	unstructured.RemoveNestedField(cp.Object, "status")
+	for _, field := range []string{"resourceVersion", "uid", "creationTimestamp", "generation", "managedFields", "selfLink", "ownerReferences"} {
+		unstructured.RemoveNestedField(cp.Object, "metadata", field)
+	}
+	unstructured.RemoveNestedField(cp.Object, "metadata", "annotations", "kubectl.kubernetes.io/last-applied-configuration")
+	if cp.GetKind() == "Service" {
+		unstructured.RemoveNestedField(cp.Object, "spec", "clusterIP")
+		unstructured.RemoveNestedField(cp.Object, "spec", "clusterIPs")
+	}
+	return cp.Object
+}
+
+// manifestApplier 抽象对集群对象的应用、dry-run、读取与删除。
+type manifestApplier interface {
+	Apply(ctx context.Context, obj *unstructured.Unstructured) (ReleaseInventoryItem, error)
+	DryRun(ctx context.Context, obj *unstructured.Unstructured) (*unstructured.Unstructured, error)
+	Get(ctx context.Context, item ReleaseInventoryItem) (*unstructured.Unstructured, error)
+	Delete(ctx context.Context, item ReleaseInventoryItem) error
+}
+
+type dynamicApplier struct {
+	client dynamic.Interface
+	mapper meta.RESTMapper
+	// force 为 true 时应用会夺回被其他字段管理者修改的字段, 用于漂移修复。
+	force bool
+}
+
+func dynamicApplierForCluster(cluster *model.Cluster) (*dynamicApplier, error) {
+	cfg, err := clientcmd.RESTConfigFromKubeConfig([]byte(cluster.KubeConfig))
+	if err != nil {
+		return nil, err
+	}
+	client, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	dc, err := discovery.NewDiscoveryClientForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &dynamicApplier{client: client, mapper: restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(dc))}, nil
+}
+
+func (a *dynamicApplier) resource(gvk schema.GroupVersionKind, namespace string) (dynamic.ResourceInterface, string, error) {
+	mapping, err := a.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, "", err
+	}
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		return a.client.Resource(mapping.Resource), "", nil
+	}
+	namespace = defaultIfEmpty(namespace, "default")
+	return a.client.Resource(mapping.Resource).Namespace(namespace), namespace, nil
+}
+
+func (a *dynamicApplier) Apply(ctx context.Context, obj *unstructured.Unstructured) (ReleaseInventoryItem, error) {
+	item := inventoryItemFromObject(obj)
+	dr, namespace, err := a.resource(item.gvk(), item.Namespace)
+	if err != nil {
+		return item, err
+	}
+	item.Namespace = namespace
+	data, err := obj.MarshalJSON()
+	if err != nil {
+		return item, err
+	}
+	opts := metav1.PatchOptions{FieldManager: releaseFieldManager}
+	if a.force {
+		opts.Force = &a.force
+	}
+	_, err = dr.Patch(ctx, obj.GetName(), types.ApplyPatchType, data, opts)
+	return item, err
+}
+
+// DryRun 以服务端应用的 dry-run 模式提交对象, 返回经默认值填充与准入处理后的结果。
+func (a *dynamicApplier) DryRun(ctx context.Context, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	dr, _, err := a.resource(obj.GroupVersionKind(), obj.GetNamespace())
+	if err != nil {
+		return nil, err
+	}
+	data, err := obj.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	return dr.Patch(ctx, obj.GetName(), types.ApplyPatchType, data, metav1.PatchOptions{
+		FieldManager: releaseFieldManager,
+		DryRun:       []string{metav1.DryRunAll},
+	})
+}
+
+func (a *dynamicApplier) Get(ctx context.Context, item ReleaseInventoryItem) (*unstructured.Unstructured, error) {
+	dr, _, err := a.resource(item.gvk(), item.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	return dr.Get(ctx, item.Name, metav1.GetOptions{})
+}
+
+func (a *dynamicApplier) Delete(ctx context.Context, item ReleaseInventoryItem) error {
+	dr, _, err := a.resource(item.gvk(), item.Namespace)
+	if err != nil {
+		return err
+	}
+	policy := metav1.DeletePropagationBackground
+	return dr.Delete(ctx, item.Name, metav1.DeleteOptions{PropagationPolicy: &policy})
+}
+
+// latestInventory 返回同一服务与目标上, beforeID 之前最近一次记录了对象清单的发布。beforeID 为 0 表示不限。
+func (l *Logic) latestInventory(ctx context.Context, serviceID, targetID, beforeID uint) []ReleaseInventoryItem {
+	q := l.svcCtx.DB.WithContext(ctx).Model(&model.DeploymentRelease{}).
+		Where("service_id = ? AND target_id = ? AND inventory_json IS NOT NULL AND inventory_json <> ''", serviceID, targetID)
+	if beforeID > 0 {
+		q = q.Where("id < ?", beforeID)
+	}
+	var row model.DeploymentRelease
+	if err := q.Order("id DESC").First(&row).Error; err != nil {
+		return nil
+	}
+	return parseInventory(row.InventoryJSON)
+}
+
+// previewPrune 返回按当前清单发布时将被清理的对象。
+func (l *Logic) previewPrune(ctx context.Context, serviceID, targetID uint, manifest string) ([]ReleaseInventoryItem, error) {
+	current, err := manifestInventory(manifest)
+	if err != nil {
+		return nil, err
+	}
+	return pruneCandidates(l.latestInventory(ctx, serviceID, targetID, 0), current), nil
+}
+
+// applyReleaseManifest 以服务端应用方式下发清单并记录对象清单, 然后清理上一次发布拥有、本次清单已移除的对象。
+// 只有带有相同服务与目标归属标签的对象才会被删除, 删除前的快照写入 PrunedJSON 供回滚恢复。
+func (l *Logic) applyReleaseManifest(ctx context.Context, applier manifestApplier, release *model.DeploymentRelease, manifest string) error {
+	objs, err := decodeManifestObjects(manifest)
+	if err != nil {
+		return err
+	}
+	applied := make([]ReleaseInventoryItem, 0, len(objs))
+	for _, obj := range objs {
+		withOwnershipLabels(obj, release)
+		item, err := applier.Apply(ctx, obj)
+		if err != nil {
+			return fmt.Errorf("apply %s: %w", item.String(), err)
+		}
+		applied = append(applied, item)
+	}
+	release.InventoryJSON = toJSON(applied)
+
+	pruned := make([]prunedObject, 0)
+	skipped := make([]string, 0)
+	for _, item := range pruneCandidates(l.latestInventory(ctx, release.ServiceID, release.TargetID, release.ID), applied) {
+		live, err := applier.Get(ctx, item)
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("prune %s: %w", item.String(), err)
+		}
+		if !ownedByRelease(live, release) {
+			skipped = append(skipped, item.String())
+			continue
+		}
+		if isStrategyDeployment(live) {
+			continue
+		}
+		if err := applier.Delete(ctx, item); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("prune %s: %w", item.String(), err)
+		}
+		pruned = append(pruned, prunedObject{ReleaseInventoryItem: item, Object: pruneSnapshot(live)})
+	}
+	release.PrunedJSON = toJSON(pruned)
+	_ = l.svcCtx.DB.WithContext(ctx).Save(release).Error
+	if len(pruned) > 0 || len(skipped) > 0 {
+		names := make([]string, 0, len(pruned))
+		for _, p := range pruned {
+			names = append(names, p.String())
+		}
+		l.writeReleaseAudit(ctx, release.ID, release.Operator, "release.pruned", map[string]any{"pruned": names, "skipped_not_owned": skipped})
+	}
+	return nil
+}
+
+// restorePrunedObjects 在回滚时重新应用 source 发布清理掉的对象; 已被回滚清单覆盖的对象跳过。
+func (l *Logic) restorePrunedObjects(ctx context.Context, applier manifestApplier, rollback, source *model.DeploymentRelease) ([]string, error) {
+	inventory := parseInventory(rollback.InventoryJSON)
+	applied := make(map[string]struct{}, len(inventory))
+	for _, item := range inventory {
+		applied[item.key()] = struct{}{}
+	}
+	restored := make([]string, 0)
+	for _, p := range parsePrunedObjects(source.PrunedJSON) {
+		if _, ok := applied[p.key()]; ok {
+			restored = append(restored, p.String())
+			continue
+		}
+		if len(p.Object) == 0 {
+			continue
+		}
+		obj := &unstructured.Unstructured{Object: p.Object}
+		withOwnershipLabels(obj, rollback)
+		item, err := applier.Apply(ctx, obj)
+		if err != nil {
+			return restored, fmt.Errorf("restore %s: %w", p.String(), err)
+		}
+		inventory = append(inventory, item)
+		restored = append(restored, p.String())
+	}
+	rollback.InventoryJSON = toJSON(inventory)
+	_ = l.svcCtx.DB.WithContext(ctx).Save(rollback).Error
+	if len(restored) > 0 {
+		l.writeReleaseAudit(ctx, rollback.ID, rollback.Operator, "release.prune_restored", map[string]any{"from_release_id": source.ID, "restored": restored})
+	}
+	return restored, nil
+}
@@ -0,0 +1,190 @@
+package deployment
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/cy77cc/OpsPilot/internal/model"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// fakeApplier 在内存中保存对象, 模拟集群的应用、读取与删除。
+type fakeApplier struct {
+	objects map[string]*unstructured.Unstructured
+	deleted []string
+}
+
+func newFakeApplier() *fakeApplier {
+	return &fakeApplier{objects: map[string]*unstructured.Unstructured{}}
+}
+
+func (f *fakeApplier) Apply(_ context.Context, obj *unstructured.Unstructured) (ReleaseInventoryItem, error) {
+	item := inventoryItemFromObject(obj)
+	item.Namespace = defaultIfEmpty(item.Namespace, "default")
+	cp := obj.DeepCopy()
+	cp.SetNamespace(item.Namespace)
+	cp.SetResourceVersion("1")
+	f.objects[item.key()] = cp
+	return item, nil
+}
+
+func (f *fakeApplier) DryRun(_ context.Context, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	if reason := obj.GetAnnotations()["test/reject"]; reason != "" {
+		return nil, apierrors.NewForbidden(schema.GroupResource{Resource: obj.GetKind()}, obj.GetName(), fmt.Errorf("admission webhook denied the request: %s", reason))
+	}
+	cp := obj.DeepCopy()
+	cp.SetNamespace(defaultIfEmpty(cp.GetNamespace(), "default"))
+	return cp, nil
+}
+
+func (f *fakeApplier) Get(_ context.Context, item ReleaseInventoryItem) (*unstructured.Unstructured, error) {
+	obj, ok := f.objects[item.key()]
+	if !ok {
+		return nil, apierrors.NewNotFound(schema.GroupResource{Group: item.Group, Resource: item.Kind}, item.Name)
+	}
+	return obj.DeepCopy(), nil
+}
+
+func (f *fakeApplier) Delete(_ context.Context, item ReleaseInventoryItem) error {
+	if _, ok := f.objects[item.key()]; !ok {
+		return apierrors.NewNotFound(schema.GroupResource{Group: item.Group, Resource: item.Kind}, item.Name)
+	}
+	delete(f.objects, item.key())
+	f.deleted = append(f.deleted, item.String())
+	return nil
+}
+
+const pruneManifestV1 = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app-config
+data:
+  key: value
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: app
+spec:
+  selector:
+    app: app
+  ports:
+  - port: 80
+---
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: app
+spec: {}`
+
+const pruneManifestV2 = `apiVersion: v1
+kind: Service
+metadata:
+  name: app
+spec:
+  selector:
+    app: app
+  ports:
+  - port: 80`
+
+func TestPruneCandidates(t *testing.T) {
+	previous := []ReleaseInventoryItem{
+		{Version: "v1", Kind: "Service", Namespace: "default", Name: "app"},
+		{Version: "v1", Kind: "ConfigMap", Namespace: "default", Name: "app-config"},
+	}
+	current := []ReleaseInventoryItem{{Version: "v1", Kind: "Service", Name: "app"}}
+	got := pruneCandidates(previous, current)
+	if len(got) != 1 || got[0].Kind != "ConfigMap" {
+		t.Fatalf("expected only the configmap to be pruned, got %+v", got)
+	}
+}
+
+func TestApplyReleaseManifest_PrunesRemovedObjects(t *testing.T) {
+	suite := newReleaseTestSuite(t)
+	ctx := context.Background()
+	applier := newFakeApplier()
+
+	first := suite.createTestRelease(t, 1, 1, releaseStatusApplying)
+	if err := suite.logic.applyReleaseManifest(ctx, applier, first, pruneManifestV1); err != nil {
+		t.Fatalf("first apply: %v", err)
+	}
+	if got := len(parseInventory(first.InventoryJSON)); got != 3 {
+		t.Fatalf("expected 3 inventory items, got %d", got)
+	}
+	cm, _ := applier.Get(ctx, ReleaseInventoryItem{Version: "v1", Kind: "ConfigMap", Namespace: "default", Name: "app-config"})
+	if cm == nil || !ownedByRelease(cm, first) {
+		t.Fatal("expected applied objects to carry ownership labels")
+	}
+
+	// 被其他服务接管的对象不应被清理。
+	ingress := applier.objects[ReleaseInventoryItem{Group: "networking.k8s.io", Kind: "Ingress", Namespace: "default", Name: "app"}.key()]
+	labels := ingress.GetLabels()
+	labels[ownerServiceLabel] = "99"
+	ingress.SetLabels(labels)
+
+	preview, err := suite.logic.previewPrune(ctx, 1, 1, pruneManifestV2)
+	if err != nil {
+		t.Fatalf("preview prune: %v", err)
+	}
+	if len(preview) != 2 {
+		t.Fatalf("expected preview to list 2 prune candidates, got %+v", preview)
+	}
+
+	second := suite.createTestRelease(t, 1, 1, releaseStatusApplying)
+	if err := suite.logic.applyReleaseManifest(ctx, applier, second, pruneManifestV2); err != nil {
+		t.Fatalf("second apply: %v", err)
+	}
+	if len(applier.deleted) != 1 || applier.deleted[0] != "ConfigMap/default/app-config" {
+		t.Fatalf("expected only the owned configmap to be deleted, got %v", applier.deleted)
+	}
+	pruned := parsePrunedObjects(second.PrunedJSON)
+	if len(pruned) != 1 || pruned[0].Object == nil {
+		t.Fatalf("expected pruned snapshot to be recorded, got %+v", pruned)
+	}
+	if _, ok := pruned[0].Object["metadata"].(map[string]any)["resourceVersion"]; ok {
+		t.Fatal("expected server generated fields to be stripped from snapshot")
+	}
+}
+
+func TestRestorePrunedObjects(t *testing.T) {
+	suite := newReleaseTestSuite(t)
+	ctx := context.Background()
+	applier := newFakeApplier()
+
+	first := suite.createTestRelease(t, 1, 1, releaseStatusApplying)
+	if err := suite.logic.applyReleaseManifest(ctx, applier, first, pruneManifestV1); err != nil {
+		t.Fatalf("first apply: %v", err)
+	}
+	second := suite.createTestRelease(t, 1, 1, releaseStatusApplying)
+	if err := suite.logic.applyReleaseManifest(ctx, applier, second, pruneManifestV2); err != nil {
+		t.Fatalf("second apply: %v", err)
+	}
+	if len(applier.objects) != 1 {
+		t.Fatalf("expected only the service to remain, got %d objects", len(applier.objects))
+	}
+
+	// 回滚清单只包含 Service, 被清理的 ConfigMap 与 Ingress 需要从快照恢复。
+	rollback := suite.createTestRelease(t, 1, 1, releaseStatusRollback)
+	if err := suite.logic.applyReleaseManifest(ctx, applier, rollback, pruneManifestV2); err != nil {
+		t.Fatalf("rollback apply: %v", err)
+	}
+	restored, err := suite.logic.restorePrunedObjects(ctx, applier, rollback, second)
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if len(restored) != 2 || len(applier.objects) != 3 {
+		t.Fatalf("expected 2 restored objects and 3 live objects, got %v / %d", restored, len(applier.objects))
+	}
+	if got := len(parseInventory(rollback.InventoryJSON)); got != 3 {
+		t.Fatalf("expected rollback inventory to include restored objects, got %d", got)
+	}
+
+	var audits []model.DeploymentReleaseAudit
+	suite.db.Where("release_id = ? AND action = ?", rollback.ID, "release.prune_restored").Find(&audits)
+	if len(audits) != 1 {
+		t.Fatalf("expected prune_restored audit, got %d", len(audits))
+	}
+}
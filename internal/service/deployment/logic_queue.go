@@ -0,0 +1,403 @@
+package deployment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cy77cc/OpsPilot/internal/logger"
+	"github.com/cy77cc/OpsPilot/internal/model"
+	"github.com/cy77cc/OpsPilot/internal/service/deployment/releaselock"
+	"github.com/cy77cc/OpsPilot/internal/svc"
+)
+
+// ErrTargetLocked 表示目标正被另一个发布占用。
+var ErrTargetLocked = errors.New("deployment target is locked by another release")
+
+const (
+	// releaseLockTTL 是目标锁的租约时长, 后台任务每 releaseLockTTL/4 续约一次。
+	releaseLockTTL = 60 * time.Second
+)
+
+// 执行中 (持有目标锁) 的发布状态。
+var releaseActiveStatuses = []string{releaseStatusApplying, releaseStatusVerifying, releaseStatusPaused}
+
+// releaseQueue 是进程内共享的目标锁状态。同一 ServiceContext 下的所有 Logic 实例共用一份,
+// 以便 CI/CD 与部署接口发起的发布由同一个后台任务续约。
+type releaseQueue struct {
+	locker *releaselock.Locker
+	mu     sync.Mutex
+	held   map[uint]uint // target_id -> release_id, 本进程持有的租约
+	start  sync.Once
+}
+
+var (
+	releaseQueuesMu sync.Mutex
+	releaseQueues   = map[*svc.ServiceContext]*releaseQueue{}
+)
+
+func (l *Logic) queue() *releaseQueue {
+	releaseQueuesMu.Lock()
+	defer releaseQueuesMu.Unlock()
+	q, ok := releaseQueues[l.svcCtx]
+	if !ok {
+		q = &releaseQueue{locker: releaselock.New(l.svcCtx.DB, l.svcCtx.Rdb, "", releaseLockTTL), held: map[uint]uint{}}
+		releaseQueues[l.svcCtx] = q
+	}
+	return q
+}
+
+func (q *releaseQueue) track(targetID, releaseID uint) {
+	q.mu.Lock()
+	q.held[targetID] = releaseID
+	q.mu.Unlock()
+}
+
+func (q *releaseQueue) untrack(targetID, releaseID uint) {
+	q.mu.Lock()
+	if q.held[targetID] == releaseID {
+		delete(q.held, targetID)
+	}
+	q.mu.Unlock()
+}
+
+func (q *releaseQueue) snapshot() map[uint]uint {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	out := make(map[uint]uint, len(q.held))
+	for k, v := range q.held {
+		out[k] = v
+	}
+	return out
+}
+
+func releaseStatusActive(status string) bool {
+	for _, s := range releaseActiveStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return status == releaseStatusApproved
+}
+
+// StartReleaseQueue 启动目标锁的后台任务: 续约本进程持有的租约、回收失效的锁并派发排队的发布。
+// 同一 ServiceContext 只会启动一次。
+func (l *Logic) StartReleaseQueue(ctx context.Context) {
+	q := l.queue()
+	q.start.Do(func() {
+		go func() {
+			ticker := time.NewTicker(releaseLockTTL / 4)
+			defer ticker.Stop()
+			// 启动时先检查一次, 接管重启前中断的发布。
+			l.tickReleaseQueue(ctx)
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					l.tickReleaseQueue(ctx)
+				}
+			}
+		}()
+	})
+}
+
+// runOrQueue 在获得目标锁后执行发布; 目标被占用或已有排队发布时发布进入队列, 返回其排队位置与当前持锁发布。
+func (l *Logic) runOrQueue(ctx context.Context, release *model.DeploymentRelease, target *model.DeploymentTarget) (int, uint, error) {
+	q := l.queue()
+	var ahead int64
+	if err := l.svcCtx.DB.WithContext(ctx).Model(&model.DeploymentRelease{}).
+		Where("target_id = ? AND status = ? AND id < ?", target.ID, releaseStatusQueued, release.ID).
+		Count(&ahead).Error; err != nil {
+		return 0, 0, err
+	}
+	var holder uint
+	if ahead == 0 {
+		lease, ok, err := q.locker.Acquire(ctx, target.ID, release.ID)
+		if err != nil {
+			return 0, 0, fmt.Errorf("acquire target lock: %w", err)
+		}
+		if ok {
+			q.track(target.ID, release.ID)
+			l.writeReleaseAudit(ctx, release.ID, release.Operator, "release.lock_acquired", map[string]any{"target_id": target.ID, "backend": lease.Backend, "owner": lease.Owner})
+			execErr := l.executeRelease(ctx, release, target)
+			l.settleReleaseLock(ctx, release)
+			return 0, 0, execErr
+		}
+		holder = lease.ReleaseID
+	} else if lease, err := q.locker.Get(ctx, target.ID); err == nil && lease != nil {
+		holder = lease.ReleaseID
+	}
+	release.Status = releaseStatusQueued
+	if err := l.svcCtx.DB.WithContext(ctx).Save(release).Error; err != nil {
+		return 0, 0, err
+	}
+	position := int(ahead) + 1
+	l.writeReleaseAudit(ctx, release.ID, release.Operator, "release.queued", map[string]any{"position": position, "lock_holder_release_id": holder})
+	if holder == 0 {
+		// 锁空闲但队列非空: 立即尝试派发, 不必等待后台任务。
+		go l.dispatchReleaseQueue(context.Background(), target.ID)
+	}
+	return position, holder, nil
+}
+
+// settleReleaseLock 在发布进入终态后释放目标锁并派发下一个排队的发布。
+func (l *Logic) settleReleaseLock(ctx context.Context, release *model.DeploymentRelease) {
+	if releaseStatusActive(release.Status) {
+		return
+	}
+	q := l.queue()
+	if err := q.locker.Release(ctx, release.TargetID, release.ID); err != nil {
+		logger.L().Warn("release target lock failed", logger.Error(err))
+	}
+	q.untrack(release.TargetID, release.ID)
+	l.writeReleaseAudit(ctx, release.ID, release.Operator, "release.lock_released", map[string]any{"target_id": release.TargetID, "status": release.Status})
+	go l.dispatchReleaseQueue(context.Background(), release.TargetID)
+}
+
+// dispatchReleaseQueue 为目标队首的发布获取锁并执行。
+func (l *Logic) dispatchReleaseQueue(ctx context.Context, targetID uint) {
+	q := l.queue()
+	for {
+		var next model.DeploymentRelease
+		if err := l.svcCtx.DB.WithContext(ctx).
+			Where("target_id = ? AND status = ?", targetID, releaseStatusQueued).
+			Order("id ASC").First(&next).Error; err != nil {
+			return
+		}
+		if _, ok, err := q.locker.Acquire(ctx, targetID, next.ID); err != nil || !ok {
+			return
+		}
+		// 入队后可能已被取消, 只有仍在排队的发布才会被执行。
+		res := l.svcCtx.DB.WithContext(ctx).Model(&model.DeploymentRelease{}).
+			Where("id = ? AND status = ?", next.ID, releaseStatusQueued).
+			Update("status", releaseStatusApproved)
+		if res.Error != nil || res.RowsAffected == 0 {
+			_ = q.locker.Release(ctx, targetID, next.ID)
+			if res.Error != nil {
+				return
+			}
+			continue
+		}
+		q.track(targetID, next.ID)
+		next.Status = releaseStatusApproved
+		l.writeReleaseAudit(ctx, next.ID, next.Operator, "release.dequeued", map[string]any{"target_id": targetID, "waited_seconds": int(time.Since(next.UpdatedAt).Seconds())})
+		var target model.DeploymentTarget
+		if err := l.svcCtx.DB.WithContext(ctx).First(&target, targetID).Error; err != nil {
+			next.Status = releaseStatusFailed
+			next.DiagnosticsJSON = toJSON([]releaseDiagnostic{{Runtime: next.RuntimeType, Stage: "queue", Code: "target_not_found", Message: err.Error(), Summary: "queued release target missing"}})
+			_ = l.svcCtx.DB.WithContext(ctx).Save(&next).Error
+			l.settleReleaseLock(ctx, &next)
+			return
+		}
+		_ = l.executeRelease(ctx, &next, &target)
+		l.settleReleaseLock(ctx, &next)
+		return
+	}
+}
+
+// tickReleaseQueue 续约本进程持有的租约, 并检查所有有排队或执行中发布的目标。
+func (l *Logic) tickReleaseQueue(ctx context.Context) {
+	q := l.queue()
+	for targetID, releaseID := range q.snapshot() {
+		var release model.DeploymentRelease
+		if err := l.svcCtx.DB.WithContext(ctx).First(&release, releaseID).Error; err != nil || !releaseStatusActive(release.Status) {
+			if err == nil {
+				l.settleReleaseLock(ctx, &release)
+			} else {
+				_ = q.locker.Release(ctx, targetID, releaseID)
+				q.untrack(targetID, releaseID)
+			}
+			continue
+		}
+		if ok, err := q.locker.Renew(ctx, targetID, releaseID); err == nil && !ok {
+			q.untrack(targetID, releaseID)
+			l.writeReleaseAudit(ctx, releaseID, release.Operator, "release.lock_lost", map[string]any{"target_id": targetID})
+		}
+	}
+	var targetIDs []uint
+	if err := l.svcCtx.DB.WithContext(ctx).Model(&model.DeploymentRelease{}).
+		Where("status IN ?", append([]string{releaseStatusQueued}, releaseActiveStatuses...)).
+		Distinct().Pluck("target_id", &targetIDs).Error; err != nil {
+		return
+	}
+	for _, targetID := range targetIDs {
+		l.recoverStaleLock(ctx, targetID)
+		// 派发会同步执行发布, 放到独立协程中以免阻塞其他租约的续约。
+		go l.dispatchReleaseQueue(ctx, targetID)
+	}
+}
+
+// recoverStaleLock 处理持有进程已崩溃的目标锁:
+//   - 租约仍在但持锁发布已进入终态: 直接释放;
+//   - 租约已过期而目标上仍有执行中的发布: 暂停中的发布由本进程接管租约,
+//     验证中的发布由本进程接管并继续验证, 正在应用的发布随进程一起中断, 标记为失败。
+func (l *Logic) recoverStaleLock(ctx context.Context, targetID uint) {
+	q := l.queue()
+	held := q.snapshot()
+	lease, err := q.locker.Get(ctx, targetID)
+	if err != nil {
+		return
+	}
+	if lease != nil {
+		var holder model.DeploymentRelease
+		if err := l.svcCtx.DB.WithContext(ctx).First(&holder, lease.ReleaseID).Error; err == nil && !releaseStatusActive(holder.Status) {
+			_ = q.locker.Release(ctx, targetID, holder.ID)
+			l.writeReleaseAudit(ctx, holder.ID, holder.Operator, "release.lock_stale", map[string]any{"target_id": targetID, "owner": lease.Owner, "reason": "holder_finished", "status": holder.Status})
+		}
+		return
+	}
+	var orphans []model.DeploymentRelease
+	if err := l.svcCtx.DB.WithContext(ctx).
+		Where("target_id = ? AND status IN ?", targetID, releaseActiveStatuses).
+		Order("id ASC").Find(&orphans).Error; err != nil {
+		return
+	}
+	for i := range orphans {
+		orphan := &orphans[i]
+		if held[targetID] == orphan.ID {
+			continue
+		}
+		if orphan.Status == releaseStatusPaused {
+			if _, ok, err := q.locker.Acquire(ctx, targetID, orphan.ID); err == nil && ok {
+				q.track(targetID, orphan.ID)
+				l.writeReleaseAudit(ctx, orphan.ID, orphan.Operator, "release.lock_adopted", map[string]any{"target_id": targetID, "owner": q.locker.Owner()})
+			}
+			continue
+		}
+		message := "target lock lease expired while the release was running; the executing process is presumed dead"
+		if orphan.Status == releaseStatusVerifying {
+			_, ok, err := q.locker.Acquire(ctx, targetID, orphan.ID)
+			if err != nil || !ok {
+				continue
+			}
+			q.track(targetID, orphan.ID)
+			l.writeReleaseAudit(ctx, orphan.ID, orphan.Operator, "release.lock_adopted", map[string]any{"target_id": targetID, "owner": q.locker.Owner()})
+			err = l.resumeReleaseVerification(ctx, orphan)
+			if err == nil {
+				l.writeReleaseAudit(ctx, orphan.ID, orphan.Operator, "release.verification_resumed", map[string]any{"strategy": orphan.Strategy})
+				continue
+			}
+			_ = q.locker.Release(ctx, targetID, orphan.ID)
+			q.untrack(targetID, orphan.ID)
+			message = "verification was interrupted by a process restart and could not be resumed: " + err.Error()
+		}
+		orphan.Status = releaseStatusFailed
+		orphan.DiagnosticsJSON = toJSON([]releaseDiagnostic{{
+			Runtime: orphan.RuntimeType, Stage: "queue", Code: "lock_stale",
+			Message: message,
+			Summary: "release interrupted by process crash",
+		}})
+		_ = l.svcCtx.DB.WithContext(ctx).Save(orphan).Error
+		l.writeReleaseAudit(ctx, orphan.ID, orphan.Operator, "release.lock_stale", map[string]any{"target_id": targetID, "reason": "lease_expired"})
+	}
+}
+
+// checkRollbackLock 在创建回滚发布前检查目标锁: 被回滚的发布自己持有锁时允许回滚, 被其他发布占用时拒绝。
+func (l *Logic) checkRollbackLock(ctx context.Context, current *model.DeploymentRelease) error {
+	lease, err := l.queue().locker.Get(ctx, current.TargetID)
+	if err != nil {
+		return fmt.Errorf("read target lock: %w", err)
+	}
+	if lease != nil && lease.ReleaseID != current.ID {
+		return fmt.Errorf("%w: release %d holds target %d", ErrTargetLocked, lease.ReleaseID, current.TargetID)
+	}
+	return nil
+}
+
+// acquireRollbackLock 为回滚发布获取目标锁, 必要时从被回滚的发布手中接过锁。
+func (l *Logic) acquireRollbackLock(ctx context.Context, current, rollback *model.DeploymentRelease) error {
+	q := l.queue()
+	lease, ok, err := q.locker.Acquire(ctx, rollback.TargetID, rollback.ID)
+	if err == nil && !ok && lease != nil && lease.ReleaseID == current.ID {
+		_ = q.locker.Release(ctx, current.TargetID, current.ID)
+		q.untrack(current.TargetID, current.ID)
+		lease, ok, err = q.locker.Acquire(ctx, rollback.TargetID, rollback.ID)
+	}
+	if err == nil && !ok {
+		err = fmt.Errorf("%w: release %d holds target %d", ErrTargetLocked, lease.ReleaseID, rollback.TargetID)
+	}
+	if err != nil {
+		rollback.Status = releaseStatusFailed
+		rollback.DiagnosticsJSON = toJSON([]releaseDiagnostic{{Runtime: rollback.RuntimeType, Stage: "rollback", Code: "target_locked", Message: err.Error(), Summary: "rollback target is busy"}})
+		_ = l.svcCtx.DB.WithContext(ctx).Save(rollback).Error
+		return err
+	}
+	q.track(rollback.TargetID, rollback.ID)
+	l.writeReleaseAudit(ctx, rollback.ID, rollback.Operator, "release.lock_acquired", map[string]any{"target_id": rollback.TargetID, "backend": lease.Backend, "owner": lease.Owner})
+	return nil
+}
+
+// CancelRelease 取消仍在目标队列中等待的发布。
+func (l *Logic) CancelRelease(ctx context.Context, id uint, uid uint64, reason string) (ReleaseApplyResp, error) {
+	var release model.DeploymentRelease
+	if err := l.svcCtx.DB.WithContext(ctx).First(&release, id).Error; err != nil {
+		return ReleaseApplyResp{}, err
+	}
+	res := l.svcCtx.DB.WithContext(ctx).Model(&model.DeploymentRelease{}).
+		Where("id = ? AND status = ?", id, releaseStatusQueued).
+		Updates(map[string]any{"status": releaseStatusCancelled, "finished_at": time.Now()})
+	if res.Error != nil {
+		return ReleaseApplyResp{}, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ReleaseApplyResp{}, fmt.Errorf("release state %s cannot be cancelled, only queued releases can", release.Status)
+	}
+	release.Status = releaseStatusCancelled
+	l.writeReleaseAudit(ctx, release.ID, uint(uid), "release.cancelled", map[string]any{"reason": reason})
+	return ReleaseApplyResp{
+		ReleaseID:        release.ID,
+		UnifiedReleaseID: release.ID,
+		Status:           release.Status,
+		RuntimeType:      release.RuntimeType,
+		TriggerSource:    release.TriggerSource,
+		CIRunID:          release.CIRunID,
+		LifecycleState:   l.releaseLifecycleState(release.Status),
+	}, nil
+}
+
+// GetTargetReleaseQueue 返回目标的锁持有情况与排队中的发布。
+func (l *Logic) GetTargetReleaseQueue(ctx context.Context, targetID uint) (TargetReleaseQueueResp, error) {
+	if err := l.svcCtx.DB.WithContext(ctx).First(&model.DeploymentTarget{}, targetID).Error; err != nil {
+		return TargetReleaseQueueResp{}, err
+	}
+	resp := TargetReleaseQueueResp{TargetID: targetID, Queued: []ReleaseQueueItem{}}
+	lease, err := l.queue().locker.Get(ctx, targetID)
+	if err != nil {
+		return TargetReleaseQueueResp{}, err
+	}
+	if lease != nil {
+		resp.Lock = lease
+		var holder model.DeploymentRelease
+		if err := l.svcCtx.DB.WithContext(ctx).First(&holder, lease.ReleaseID).Error; err == nil {
+			item := toReleaseQueueItem(holder, 0)
+			resp.Running = &item
+		}
+	}
+	var queued []model.DeploymentRelease
+	if err := l.svcCtx.DB.WithContext(ctx).
+		Where("target_id = ? AND status = ?", targetID, releaseStatusQueued).
+		Order("id ASC").Find(&queued).Error; err != nil {
+		return TargetReleaseQueueResp{}, err
+	}
+	for i, row := range queued {
+		resp.Queued = append(resp.Queued, toReleaseQueueItem(row, i+1))
+	}
+	return resp, nil
+}
+
+func toReleaseQueueItem(row model.DeploymentRelease, position int) ReleaseQueueItem {
+	return ReleaseQueueItem{
+		Position:      position,
+		ReleaseID:     row.ID,
+		ServiceID:     row.ServiceID,
+		Status:        row.Status,
+		Strategy:      row.Strategy,
+		TriggerSource: row.TriggerSource,
+		Operator:      row.Operator,
+		CreatedAt:     row.CreatedAt,
+		UpdatedAt:     row.UpdatedAt,
+	}
+}
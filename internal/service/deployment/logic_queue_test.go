@@ -0,0 +1,171 @@
+package deployment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/cy77cc/OpsPilot/internal/model"
+)
+
+// approveIntoQueue 创建一个待审批发布并审批, 返回审批响应。
+func (s *releaseTestSuite) approveIntoQueue(t *testing.T, svcID, targetID uint) ReleaseApplyResp {
+	t.Helper()
+	release := s.createTestRelease(t, svcID, targetID, releaseStatusPendingApproval)
+	if err := s.db.Create(&model.DeploymentReleaseApproval{ReleaseID: release.ID, Ticket: fmt.Sprintf("dep-appr-queue-%d", release.ID), Decision: "pending", RequestedBy: 1}).Error; err != nil {
+		t.Fatalf("create approval: %v", err)
+	}
+	resp, err := s.logic.ApproveRelease(context.Background(), release.ID, 1, "ok")
+	if err != nil {
+		t.Fatalf("approve release %d: %v", release.ID, err)
+	}
+	return resp
+}
+
+func TestReleaseQueue_QueuesBehindLockedTargetAndCancels(t *testing.T) {
+	suite := newReleaseTestSuite(t)
+	ctx := context.Background()
+	svc := suite.createTestService(t)
+	target := suite.createTestTarget(t, suite.createTestCluster(t).ID)
+	running := suite.createTestRelease(t, svc.ID, target.ID, releaseStatusApplying)
+	if _, ok, err := suite.logic.queue().locker.Acquire(ctx, target.ID, running.ID); err != nil || !ok {
+		t.Fatalf("acquire lock: ok=%v err=%v", ok, err)
+	}
+
+	first := suite.approveIntoQueue(t, svc.ID, target.ID)
+	second := suite.approveIntoQueue(t, svc.ID, target.ID)
+	if first.Status != releaseStatusQueued || first.QueuePosition != 1 || first.LockHolderReleaseID != running.ID {
+		t.Fatalf("expected first release queued at 1 behind %d, got %+v", running.ID, first)
+	}
+	if second.QueuePosition != 2 {
+		t.Fatalf("expected second release queued at 2, got %+v", second)
+	}
+
+	queue, err := suite.logic.GetTargetReleaseQueue(ctx, target.ID)
+	if err != nil {
+		t.Fatalf("get queue: %v", err)
+	}
+	if queue.Lock == nil || queue.Running == nil || queue.Running.ReleaseID != running.ID || len(queue.Queued) != 2 {
+		t.Fatalf("unexpected queue: %+v", queue)
+	}
+
+	if _, err := suite.logic.CancelRelease(ctx, first.ReleaseID, 1, "superseded"); err != nil {
+		t.Fatalf("cancel queued release: %v", err)
+	}
+	if _, err := suite.logic.CancelRelease(ctx, running.ID, 1, ""); err == nil {
+		t.Fatal("expected running release not to be cancellable")
+	}
+	queue, _ = suite.logic.GetTargetReleaseQueue(ctx, target.ID)
+	if len(queue.Queued) != 1 || queue.Queued[0].ReleaseID != second.ReleaseID || queue.Queued[0].Position != 1 {
+		t.Fatalf("expected second release to move to the head of the queue, got %+v", queue.Queued)
+	}
+	timeline, _ := suite.logic.ListReleaseTimeline(ctx, first.ReleaseID)
+	if !timelineHas(timeline, "release.queued") || !timelineHas(timeline, "release.cancelled") {
+		t.Fatalf("expected queued and cancelled events, got %+v", timeline)
+	}
+}
+
+func TestReleaseQueue_DispatchesHeadAfterLockRelease(t *testing.T) {
+	suite := newReleaseTestSuite(t)
+	ctx := context.Background()
+	svc := suite.createTestService(t)
+	target := suite.createTestTarget(t, suite.createTestCluster(t).ID)
+	running := suite.createTestRelease(t, svc.ID, target.ID, releaseStatusApplying)
+	locker := suite.logic.queue().locker
+	if _, ok, _ := locker.Acquire(ctx, target.ID, running.ID); !ok {
+		t.Fatal("expected to acquire lock")
+	}
+	queued := suite.approveIntoQueue(t, svc.ID, target.ID)
+
+	suite.db.Model(running).Update("status", releaseStatusApplied)
+	if err := locker.Release(ctx, target.ID, running.ID); err != nil {
+		t.Fatalf("release lock: %v", err)
+	}
+	suite.logic.dispatchReleaseQueue(ctx, target.ID)
+
+	var dispatched model.DeploymentRelease
+	suite.db.First(&dispatched, queued.ReleaseID)
+	if dispatched.Status == releaseStatusQueued {
+		t.Fatal("expected queued release to be dispatched")
+	}
+	timeline, _ := suite.logic.ListReleaseTimeline(ctx, dispatched.ID)
+	if !timelineHas(timeline, "release.dequeued") {
+		t.Fatalf("expected dequeued event, got %+v", timeline)
+	}
+	if !releaseStatusActive(dispatched.Status) {
+		if lease, _ := locker.Get(ctx, target.ID); lease != nil && lease.ReleaseID == dispatched.ID {
+			t.Fatalf("expected finished release to release the lock, got %+v", lease)
+		}
+	}
+}
+
+func TestReleaseQueue_RecoversStaleLocks(t *testing.T) {
+	suite := newReleaseTestSuite(t)
+	ctx := context.Background()
+	svc := suite.createTestService(t)
+	cluster := suite.createTestCluster(t)
+	locker := suite.logic.queue().locker
+
+	// 持锁发布已结束但进程未释放锁。
+	finishedTarget := suite.createTestTarget(t, cluster.ID)
+	finished := suite.createTestRelease(t, svc.ID, finishedTarget.ID, releaseStatusApplied)
+	if _, ok, _ := locker.Acquire(ctx, finishedTarget.ID, finished.ID); !ok {
+		t.Fatal("expected to acquire lock")
+	}
+	suite.logic.recoverStaleLock(ctx, finishedTarget.ID)
+	if lease, _ := locker.Get(ctx, finishedTarget.ID); lease != nil {
+		t.Fatalf("expected lock of finished release to be released, got %+v", lease)
+	}
+
+	// 执行进程崩溃, 租约已过期: 应用中的发布标记失败, 暂停中的发布被接管。
+	crashedTarget := suite.createTestTarget(t, cluster.ID)
+	applying := suite.createTestRelease(t, svc.ID, crashedTarget.ID, releaseStatusApplying)
+	suite.logic.recoverStaleLock(ctx, crashedTarget.ID)
+	suite.db.First(applying, applying.ID)
+	if applying.Status != releaseStatusFailed || !strings.Contains(applying.DiagnosticsJSON, "lock_stale") {
+		t.Fatalf("expected orphaned release to fail with lock_stale, got %s %s", applying.Status, applying.DiagnosticsJSON)
+	}
+
+	// 验证中的发布被接管后继续验证; 集群无法连接时标记失败并释放锁。
+	verifyingTarget := suite.createTestTarget(t, cluster.ID)
+	verifying := suite.createTestRelease(t, svc.ID, verifyingTarget.ID, releaseStatusVerifying)
+	suite.logic.recoverStaleLock(ctx, verifyingTarget.ID)
+	suite.db.First(verifying, verifying.ID)
+	if verifying.Status != releaseStatusFailed || !strings.Contains(verifying.DiagnosticsJSON, "could not be resumed") {
+		t.Fatalf("expected unresumable verification to fail, got %s %s", verifying.Status, verifying.DiagnosticsJSON)
+	}
+	if lease, _ := locker.Get(ctx, verifyingTarget.ID); lease != nil {
+		t.Fatalf("expected lock of failed verification to be released, got %+v", lease)
+	}
+
+	pausedTarget := suite.createTestTarget(t, cluster.ID)
+	paused := suite.createTestRelease(t, svc.ID, pausedTarget.ID, releaseStatusPaused)
+	suite.logic.recoverStaleLock(ctx, pausedTarget.ID)
+	if lease, _ := locker.Get(ctx, pausedTarget.ID); lease == nil || lease.ReleaseID != paused.ID {
+		t.Fatalf("expected paused release to adopt the lock, got %+v", lease)
+	}
+}
+
+func TestRollbackRelease_RefusesLockedTarget(t *testing.T) {
+	suite := newReleaseTestSuite(t)
+	ctx := context.Background()
+	svc := suite.createTestService(t)
+	target := suite.createTestTarget(t, suite.createTestCluster(t).ID)
+	suite.createTestRelease(t, svc.ID, target.ID, releaseStatusApplied)
+	current := suite.createTestRelease(t, svc.ID, target.ID, releaseStatusApplied)
+	other := suite.createTestRelease(t, svc.ID, target.ID, releaseStatusApplying)
+	if _, ok, _ := suite.logic.queue().locker.Acquire(ctx, target.ID, other.ID); !ok {
+		t.Fatal("expected to acquire lock")
+	}
+
+	if _, err := suite.logic.RollbackRelease(ctx, current.ID, 1); !errors.Is(err, ErrTargetLocked) {
+		t.Fatalf("expected rollback to be refused while another release runs, got %v", err)
+	}
+	var count int64
+	suite.db.Model(&model.DeploymentRelease{}).Where("strategy = ?", "rollback").Count(&count)
+	if count != 0 {
+		t.Fatalf("expected no rollback release to be created, got %d", count)
+	}
+}
@@ -3,12 +3,15 @@ package deployment
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/cy77cc/OpsPilot/internal/model"
-	projectlogic "github.com/cy77cc/OpsPilot/internal/service/project/logic"
+	"github.com/cy77cc/OpsPilot/internal/service/deployment/freeze"
+	"gorm.io/gorm"
 )
 
 const (
@@ -17,14 +20,22 @@ const (
 	releaseStatusApproved        = "approved"
 	releaseStatusRejected        = "rejected"
 	releaseStatusApplying        = "applying"
+	releaseStatusVerifying       = "verifying"
+	releaseStatusPaused          = "paused"
+	releaseStatusAborted         = "aborted"
 	releaseStatusApplied         = "applied"
 	releaseStatusFailed          = "failed"
 	releaseStatusRollback        = "rollback"
 	releaseStatusRolledBack      = "rolled_back" // compatibility with existing history rows
+	releaseStatusQueued          = "queued"      // approved, waiting for the target lock
+	releaseStatusCancelled       = "cancelled"   // removed from the target queue before running
 )
 
 const previewTokenTTL = 30 * time.Minute
 
+// ErrRollbackTargetNotFound 表示回滚目标版本不存在或没有可重新应用的清单快照。
+var ErrRollbackTargetNotFound = errors.New("rollback target not found")
+
 type releaseDiagnostic struct {
 	Runtime string `json:"runtime"`
 	Stage   string `json:"stage"`
@@ -34,10 +45,11 @@ type releaseDiagnostic struct {
 }
 
 func (l *Logic) PreviewRelease(ctx context.Context, req ReleasePreviewReq) (ReleasePreviewResp, error) {
-	svc, target, manifest, err := l.resolveReleaseContext(ctx, req)
+	svc, target, render, err := l.resolveReleaseContext(ctx, req)
 	if err != nil {
 		return ReleasePreviewResp{}, err
 	}
+	manifest := render.Manifest
 	env := strings.ToLower(strings.TrimSpace(defaultIfEmpty(req.Env, defaultIfEmpty(target.Env, svc.Env))))
 	checks := []map[string]string{
 		{"code": "target", "message": fmt.Sprintf("target=%s:%d", target.TargetType, target.ID), "level": "info"},
@@ -48,6 +60,55 @@ func (l *Logic) PreviewRelease(ctx context.Context, req ReleasePreviewReq) (Rele
 		if !strings.Contains(manifest, "services:") {
 			warnings = append(warnings, map[string]string{"code": "compose_shape", "message": "manifest may not be valid docker compose schema", "level": "warning"})
 		}
+		rolloutCfg, err := parseComposeRolloutConfig(req.StrategyConfig)
+		if err != nil {
+			return ReleasePreviewResp{}, err
+		}
+		checks = append(checks, map[string]string{"code": "compose_rollout", "message": rolloutCfg.planMessage(l.composeTargetNodeCount(ctx, target.ID)), "level": "info"})
+	}
+	if freezes, err := l.activeFreezes(ctx, svc, target, env, time.Now()); err == nil && len(freezes) > 0 {
+		warnings = append(warnings, map[string]string{"code": reasonCodeChangeFreeze, "message": "change freeze active: " + freeze.Describe(freezes, time.Now()) + "; apply requires emergency_override", "level": "warning"})
+	}
+	if isProgressiveStrategy(req.Strategy) {
+		if target.TargetType != "k8s" {
+			warnings = append(warnings, map[string]string{"code": "strategy_unsupported", "message": fmt.Sprintf("%s strategy is only executed on k8s targets, release will be applied directly", req.Strategy), "level": "warning"})
+		} else {
+			state, err := planReleaseStrategy(req.Strategy, req.StrategyConfig, manifest)
+			if err != nil {
+				return ReleasePreviewResp{}, err
+			}
+			checks = append(checks, map[string]string{"code": "strategy", "message": strategyPlanMessage(state), "level": "info"})
+		}
+	}
+	var pruneObjects []ReleaseInventoryItem
+	var diffResult []ReleaseObjectDiff
+	if target.TargetType == "k8s" {
+		pruneObjects, err = l.previewPrune(ctx, svc.ID, target.ID, manifest)
+		if err != nil {
+			warnings = append(warnings, map[string]string{"code": "prune_plan_unavailable", "message": err.Error(), "level": "warning"})
+		} else if len(pruneObjects) > 0 {
+			names := make([]string, 0, len(pruneObjects))
+			for _, item := range pruneObjects {
+				names = append(names, item.String())
+			}
+			checks = append(checks, map[string]string{"code": "prune", "message": fmt.Sprintf("%d object(s) removed from manifest will be pruned: %s", len(names), strings.Join(names, ", ")), "level": "info"})
+		}
+		diff, diffChecks, derr := l.previewClusterDiff(ctx, svc.ID, target, manifest, pruneObjects)
+		if derr != nil {
+			warnings = append(warnings, map[string]string{"code": "dry_run_unavailable", "message": truncateText(derr.Error(), 500), "level": "warning"})
+		} else {
+			diffResult = diff
+			checks = append(checks, map[string]string{"code": "dry_run", "message": summarizeDiff(diff), "level": "info"})
+			checks = append(checks, diffChecks...)
+		}
+	}
+	admissionResult, err := l.checkAdmission(ctx, svc, target, env, manifest)
+	if err != nil {
+		warnings = append(warnings, map[string]string{"code": "admission_unavailable", "message": truncateText(err.Error(), 500), "level": "warning"})
+	} else {
+		admissionChecks, admissionWarnings := admissionFindings(admissionResult)
+		checks = append(checks, admissionChecks...)
+		warnings = append(warnings, admissionWarnings...)
 	}
 	expiresAt := time.Now().Add(previewTokenTTL).UTC()
 	previewToken, _ := issuePreviewToken(req, target.TargetType, env, manifest, expiresAt)
@@ -58,14 +119,17 @@ func (l *Logic) PreviewRelease(ctx context.Context, req ReleasePreviewReq) (Rele
 		Runtime:          target.TargetType,
 		PreviewToken:     previewToken,
 		PreviewExpiresAt: &expiresAt,
+		PruneObjects:     pruneObjects,
+		Diff:             diffResult,
 	}, nil
 }
 
 func (l *Logic) ApplyRelease(ctx context.Context, uid uint64, req ReleasePreviewReq) (ReleaseApplyResp, error) {
-	svc, target, manifest, err := l.resolveReleaseContext(ctx, req)
+	svc, target, render, err := l.resolveReleaseContext(ctx, req)
 	if err != nil {
 		return ReleaseApplyResp{}, err
 	}
+	manifest := render.Manifest
 	triggerSource := strings.TrimSpace(req.TriggerSource)
 	if triggerSource == "" {
 		triggerSource = "manual"
@@ -78,12 +142,64 @@ func (l *Logic) ApplyRelease(ctx context.Context, uid uint64, req ReleasePreview
 	if req.CIRunID > 0 {
 		triggerContext["ci_run_id"] = req.CIRunID
 	}
+	if req.Artifact != nil {
+		triggerContext["artifact_id"] = req.Artifact.ID
+		triggerContext["artifact_digest"] = req.Artifact.Digest
+	}
 	env := strings.ToLower(strings.TrimSpace(defaultIfEmpty(req.Env, defaultIfEmpty(target.Env, svc.Env))))
+	if req.promotion != nil {
+		triggerContext["promoted_from_release_id"] = req.promotion.Source.ID
+		triggerContext["promoted_from_env"] = req.promotion.FromEnv
+	}
 	previewContextHash, previewTokenHash, previewExpiresAt, reasonCode, err := validatePreviewToken(req, target.TargetType, env, manifest)
 	if err != nil {
 		return ReleaseApplyResp{ReasonCode: reasonCode}, err
 	}
-	approvalRequired := env == "production"
+	admissionResult, err := l.checkAdmission(ctx, svc, target, env, manifest)
+	if err != nil {
+		return ReleaseApplyResp{}, err
+	}
+	_, admissionWarnings := admissionFindings(admissionResult)
+	strategyStateJSON := ""
+	if isProgressiveStrategy(req.Strategy) && target.TargetType == "k8s" {
+		state, err := planReleaseStrategy(req.Strategy, req.StrategyConfig, manifest)
+		if err != nil {
+			return ReleaseApplyResp{}, err
+		}
+		strategyStateJSON = toJSON(state)
+	}
+	if target.TargetType == "compose" {
+		rolloutCfg, err := parseComposeRolloutConfig(req.StrategyConfig)
+		if err != nil {
+			return ReleaseApplyResp{}, err
+		}
+		strategyStateJSON = toJSON(newComposeRolloutState(rolloutCfg))
+	}
+	decision, err := l.evaluateApproval(ctx, approvalInput{
+		ServiceID:     svc.ID,
+		TargetID:      target.ID,
+		Env:           env,
+		Runtime:       target.TargetType,
+		TriggerSource: triggerSource,
+	})
+	if err != nil {
+		return ReleaseApplyResp{}, err
+	}
+	now := time.Now()
+	freezes, err := l.activeFreezes(ctx, svc, target, env, now)
+	if err != nil {
+		return ReleaseApplyResp{}, err
+	}
+	overrideDenial := ""
+	if len(freezes) > 0 {
+		overrideDenial = l.checkFreezeOverride(uid, req)
+		if req.EmergencyOverride && overrideDenial == "" {
+			decision = freezeOverrideDecision(decision, freezes, strings.TrimSpace(req.OverrideReason))
+			triggerContext["freeze_override"] = true
+		}
+	}
+	variables := render.Variables
+	variables.Env = env
 	release := &model.DeploymentRelease{
 		ServiceID:          svc.ID,
 		TargetID:           target.ID,
@@ -97,6 +213,8 @@ func (l *Logic) ApplyRelease(ctx context.Context, uid uint64, req ReleasePreview
 		PreviewExpiresAt:   previewExpiresAt,
 		Status:             releaseStatusPreviewed,
 		ManifestSnapshot:   manifest,
+		TemplateSnapshot:   render.Template,
+		VariablesJSON:      toJSON(variables),
 		RuntimeContextJSON: toJSON(map[string]any{
 			"runtime":   target.TargetType,
 			"target_id": target.ID,
@@ -108,79 +226,171 @@ func (l *Logic) ApplyRelease(ctx context.Context, uid uint64, req ReleasePreview
 		WarningsJSON:       "[]",
 		DiagnosticsJSON:    "[]",
 		VerificationJSON:   "{}",
+		StrategyStateJSON:  strategyStateJSON,
 		Operator:           uint(uid),
 		CIRunID:            req.CIRunID,
 	}
+	if len(admissionWarnings) > 0 {
+		release.WarningsJSON = toJSON(admissionWarnings)
+	}
+	if req.Artifact != nil {
+		release.ArtifactID = req.Artifact.ID
+		release.ArtifactDigest = req.Artifact.Digest
+		release.CommitSHA = req.Artifact.CommitSHA
+	}
+	if req.promotion != nil {
+		release.RevisionID = req.promotion.Source.RevisionID
+		release.SourceReleaseID = req.promotion.Source.ID
+		release.ArtifactID = req.promotion.Source.ArtifactID
+		release.ArtifactDigest = req.promotion.Source.ArtifactDigest
+		release.CommitSHA = req.promotion.Source.CommitSHA
+	}
+	if admissionResult.Blocked() {
+		return l.blockAdmissionRelease(ctx, release, admissionResult)
+	}
+	if len(freezes) > 0 && (!req.EmergencyOverride || overrideDenial != "") {
+		return l.blockFrozenRelease(ctx, release, freezes, now, req, overrideDenial)
+	}
 	if err := l.svcCtx.DB.WithContext(ctx).Create(release).Error; err != nil {
 		return ReleaseApplyResp{}, err
 	}
 	l.writeReleaseAudit(ctx, release.ID, uint(uid), "release.previewed", map[string]any{"runtime": target.TargetType, "env": env})
+	if req.promotion != nil {
+		l.writePromotionAudits(ctx, uint(uid), release, req.promotion)
+	}
+	if len(freezes) > 0 {
+		l.writeReleaseAudit(ctx, release.ID, uint(uid), "release.freeze_overridden", map[string]any{
+			"windows":         freeze.Summaries(freezes, now),
+			"override_reason": strings.TrimSpace(req.OverrideReason),
+			"approver_roles":  decision.ApproverRoles,
+		})
+	}
 
-	if approvalRequired {
+	if decision.Required {
 		ticket := fmt.Sprintf("dep-appr-%d", time.Now().UnixNano())
 		approval := model.DeploymentReleaseApproval{
-			ReleaseID:   release.ID,
-			Ticket:      ticket,
-			Decision:    "pending",
-			RequestedBy: uint(uid),
+			ReleaseID:         release.ID,
+			Ticket:            ticket,
+			Decision:          "pending",
+			RequestedBy:       uint(uid),
+			RequiredApprovals: decision.MinApprovals,
+			PolicyID:          decision.PolicyID,
+			RuleJSON:          toJSON(decision),
 		}
 		if err := l.svcCtx.DB.WithContext(ctx).Create(&approval).Error; err != nil {
 			return ReleaseApplyResp{}, err
 		}
 		release.Status = releaseStatusPendingApproval
 		_ = l.svcCtx.DB.WithContext(ctx).Save(release).Error
-		l.writeReleaseAudit(ctx, release.ID, uint(uid), "release.pending_approval", map[string]any{"ticket": ticket})
+		l.writeReleaseAudit(ctx, release.ID, uint(uid), "release.pending_approval", map[string]any{
+			"ticket":             ticket,
+			"source":             decision.Source,
+			"policy_id":          decision.PolicyID,
+			"required_approvals": decision.MinApprovals,
+			"approver_roles":     decision.ApproverRoles,
+			"reason":             decision.Reason,
+		})
 		return ReleaseApplyResp{
-			ReleaseID:        release.ID,
-			UnifiedReleaseID: release.ID,
-			Status:           release.Status,
-			RuntimeType:      release.RuntimeType,
-			TriggerSource:    release.TriggerSource,
-			TriggerContext:   triggerContext,
-			CIRunID:          release.CIRunID,
-			ApprovalRequired: true,
-			ApprovalTicket:   ticket,
-			LifecycleState:   l.releaseLifecycleState(release.Status),
+			ReleaseID:         release.ID,
+			UnifiedReleaseID:  release.ID,
+			Status:            release.Status,
+			RuntimeType:       release.RuntimeType,
+			TriggerSource:     release.TriggerSource,
+			TriggerContext:    triggerContext,
+			CIRunID:           release.CIRunID,
+			ApprovalRequired:  true,
+			ApprovalTicket:    ticket,
+			RequiredApprovals: decision.MinApprovals,
+			ApprovalSource:    decision.Source,
+			LifecycleState:    l.releaseLifecycleState(release.Status),
 		}, nil
 	}
 
 	release.Status = releaseStatusApproved
 	_ = l.svcCtx.DB.WithContext(ctx).Save(release).Error
-	l.writeReleaseAudit(ctx, release.ID, uint(uid), "release.approved", map[string]any{"auto": true})
-	if execErr := l.executeRelease(ctx, release, target); execErr != nil {
-		return ReleaseApplyResp{
-			ReleaseID:        release.ID,
-			UnifiedReleaseID: release.ID,
-			Status:           release.Status,
-			RuntimeType:      release.RuntimeType,
-			TriggerSource:    release.TriggerSource,
-			TriggerContext:   triggerContext,
-			CIRunID:          release.CIRunID,
-			LifecycleState:   l.releaseLifecycleState(release.Status),
-		}, execErr
-	}
+	l.writeReleaseAudit(ctx, release.ID, uint(uid), "release.approved", map[string]any{
+		"auto":      true,
+		"source":    decision.Source,
+		"policy_id": decision.PolicyID,
+		"reason":    decision.Reason,
+	})
+	position, holder, execErr := l.runOrQueue(ctx, release, target)
 	return ReleaseApplyResp{
-		ReleaseID:        release.ID,
-		UnifiedReleaseID: release.ID,
-		Status:           release.Status,
-		RuntimeType:      release.RuntimeType,
-		TriggerSource:    release.TriggerSource,
-		TriggerContext:   triggerContext,
-		CIRunID:          release.CIRunID,
-		LifecycleState:   l.releaseLifecycleState(release.Status),
-	}, nil
+		ReleaseID:           release.ID,
+		UnifiedReleaseID:    release.ID,
+		Status:              release.Status,
+		RuntimeType:         release.RuntimeType,
+		TriggerSource:       release.TriggerSource,
+		TriggerContext:      triggerContext,
+		CIRunID:             release.CIRunID,
+		LifecycleState:      l.releaseLifecycleState(release.Status),
+		QueuePosition:       position,
+		LockHolderReleaseID: holder,
+	}, execErr
+}
+
+// previousSuccessfulRelease 返回同一服务与目标上早于 current 的最近一次成功发布 (含成功的回滚)。
+func (l *Logic) previousSuccessfulRelease(ctx context.Context, current *model.DeploymentRelease) (*model.DeploymentRelease, error) {
+	var prev model.DeploymentRelease
+	err := l.svcCtx.DB.WithContext(ctx).
+		Where("service_id = ? AND target_id = ? AND id < ?", current.ServiceID, current.TargetID, current.ID).
+		Where("status IN ?", []string{releaseStatusApplied, releaseStatusRollback, releaseStatusRolledBack}).
+		Where("manifest_snapshot <> ''").
+		Order("id DESC").First(&prev).Error
+	if err != nil {
+		return nil, err
+	}
+	return &prev, nil
 }
 
+// rollbackSource 返回回滚要重新应用的发布: toID 为 0 时取上一次成功发布, 否则必须是同一服务、
+// 同一目标上成功且带清单快照的发布。
+func (l *Logic) rollbackSource(ctx context.Context, current *model.DeploymentRelease, toID uint) (*model.DeploymentRelease, error) {
+	if toID == 0 {
+		prev, err := l.previousSuccessfulRelease(ctx, current)
+		if err != nil {
+			return nil, fmt.Errorf("%w: no previous successful release to rollback", ErrRollbackTargetNotFound)
+		}
+		return prev, nil
+	}
+	var prev model.DeploymentRelease
+	if err := l.svcCtx.DB.WithContext(ctx).First(&prev, toID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: release %d does not exist", ErrRollbackTargetNotFound, toID)
+		}
+		return nil, err
+	}
+	if prev.ID == current.ID || prev.ServiceID != current.ServiceID || prev.TargetID != current.TargetID {
+		return nil, fmt.Errorf("%w: release %d is not an earlier release of the same service and target", ErrRollbackTargetNotFound, toID)
+	}
+	switch prev.Status {
+	case releaseStatusApplied, releaseStatusRollback, releaseStatusRolledBack:
+	default:
+		return nil, fmt.Errorf("%w: release %d is %s", ErrRollbackTargetNotFound, toID, prev.Status)
+	}
+	if strings.TrimSpace(prev.ManifestSnapshot) == "" {
+		return nil, fmt.Errorf("%w: release %d has no manifest snapshot", ErrRollbackTargetNotFound, toID)
+	}
+	return &prev, nil
+}
+
+// RollbackRelease 回滚到上一次成功发布。
 func (l *Logic) RollbackRelease(ctx context.Context, id uint, uid uint64) (ReleaseApplyResp, error) {
+	return l.RollbackReleaseTo(ctx, id, 0, uid)
+}
+
+// RollbackReleaseTo 在 id 所在目标上重新应用 toID 发布的清单快照并验证, toID 为 0 时回滚到上一次成功发布。
+func (l *Logic) RollbackReleaseTo(ctx context.Context, id, toID uint, uid uint64) (ReleaseApplyResp, error) {
 	var current model.DeploymentRelease
 	if err := l.svcCtx.DB.WithContext(ctx).First(&current, id).Error; err != nil {
 		return ReleaseApplyResp{}, err
 	}
-	var prev model.DeploymentRelease
-	if err := l.svcCtx.DB.WithContext(ctx).
-		Where("service_id = ? AND target_id = ? AND id < ?", current.ServiceID, current.TargetID, current.ID).
-		Order("id DESC").First(&prev).Error; err != nil {
-		return ReleaseApplyResp{}, fmt.Errorf("no previous release to rollback")
+	prev, err := l.rollbackSource(ctx, &current, toID)
+	if err != nil {
+		return ReleaseApplyResp{}, err
+	}
+	if err := l.checkRollbackLock(ctx, &current); err != nil {
+		return ReleaseApplyResp{}, err
 	}
 	rollback := &model.DeploymentRelease{
 		ServiceID:          current.ServiceID,
@@ -192,21 +402,28 @@ func (l *Logic) RollbackRelease(ctx context.Context, id uint, uid uint64) (Relea
 		RevisionID:         prev.RevisionID,
 		SourceReleaseID:    current.ID,
 		TargetRevision:     fmt.Sprintf("%d", prev.RevisionID),
-		Status:             releaseStatusRollback,
+		Status:             releaseStatusApplying,
 		ManifestSnapshot:   prev.ManifestSnapshot,
 		RuntimeContextJSON: toJSON(map[string]any{"runtime": current.RuntimeType, "rollback_from": current.ID}),
-		TriggerContextJSON: toJSON(map[string]any{"rollback_from_release_id": current.ID}),
+		TriggerContextJSON: toJSON(map[string]any{"rollback_from_release_id": current.ID, "rollback_to_release_id": prev.ID}),
 		ChecksJSON:         "[]",
 		WarningsJSON:       "[]",
 		DiagnosticsJSON:    "[]",
 		VerificationJSON:   "{}",
 		Operator:           uint(uid),
 		CIRunID:            current.CIRunID,
+		ArtifactID:         prev.ArtifactID,
+		ArtifactDigest:     prev.ArtifactDigest,
+		CommitSHA:          prev.CommitSHA,
 	}
 	if err := l.svcCtx.DB.WithContext(ctx).Create(rollback).Error; err != nil {
 		return ReleaseApplyResp{}, err
 	}
-	l.writeReleaseAudit(ctx, rollback.ID, uint(uid), "release.rollback_started", map[string]any{"from_release_id": current.ID})
+	if err := l.acquireRollbackLock(ctx, &current, rollback); err != nil {
+		return ReleaseApplyResp{ReleaseID: rollback.ID, Status: rollback.Status, RuntimeType: rollback.RuntimeType}, err
+	}
+	defer l.settleReleaseLock(ctx, rollback)
+	l.writeReleaseAudit(ctx, rollback.ID, uint(uid), "release.rollback_started", map[string]any{"from_release_id": current.ID, "to_release_id": prev.ID})
 	switch current.RuntimeType {
 	case "k8s":
 		var target model.DeploymentTarget
@@ -223,12 +440,39 @@ func (l *Logic) RollbackRelease(ctx context.Context, id uint, uid uint64) (Relea
 			_ = l.svcCtx.DB.WithContext(ctx).Save(rollback).Error
 			return ReleaseApplyResp{ReleaseID: rollback.ID, Status: rollback.Status, RuntimeType: rollback.RuntimeType}, err
 		}
-		if err := projectlogic.DeployToCluster(ctx, &cluster, prev.ManifestSnapshot); err != nil {
+		applier, err := dynamicApplierForCluster(&cluster)
+		if err == nil {
+			err = l.applyReleaseManifest(ctx, applier, rollback, prev.ManifestSnapshot)
+		}
+		if err == nil {
+			_, err = l.restorePrunedObjects(ctx, applier, rollback, &current)
+		}
+		if err != nil {
 			rollback.Status = releaseStatusFailed
 			rollback.DiagnosticsJSON = toJSON([]releaseDiagnostic{{Runtime: "k8s", Stage: "rollback", Code: "rollback_apply_failed", Message: err.Error(), Summary: "k8s rollback apply failed"}})
 			_ = l.svcCtx.DB.WithContext(ctx).Save(rollback).Error
 			return ReleaseApplyResp{ReleaseID: rollback.ID, Status: rollback.Status, RuntimeType: rollback.RuntimeType}, err
 		}
+		workloads, err := extractRolloutWorkloads(prev.ManifestSnapshot)
+		if err != nil {
+			rollback.Status = releaseStatusFailed
+			rollback.VerificationJSON = toJSON(map[string]any{"runtime": "k8s", "checks": []string{"apply_succeeded"}, "passed": false})
+			rollback.DiagnosticsJSON = toJSON([]releaseDiagnostic{{Runtime: "k8s", Stage: "verify", Code: "verify_parse_failed", Message: err.Error(), Summary: "cannot parse manifest for rollout verification"}})
+			_ = l.svcCtx.DB.WithContext(ctx).Save(rollback).Error
+			return ReleaseApplyResp{ReleaseID: rollback.ID, Status: rollback.Status, RuntimeType: rollback.RuntimeType}, err
+		}
+		if len(workloads) > 0 {
+			cli, err := rolloutClientForCluster(&cluster)
+			if err != nil {
+				rollback.Status = releaseStatusFailed
+				rollback.DiagnosticsJSON = toJSON([]releaseDiagnostic{{Runtime: "k8s", Stage: "verify", Code: "verify_client_failed", Message: err.Error(), Summary: "cannot build client for rollout verification"}})
+				_ = l.svcCtx.DB.WithContext(ctx).Save(rollback).Error
+				return ReleaseApplyResp{ReleaseID: rollback.ID, Status: rollback.Status, RuntimeType: rollback.RuntimeType}, err
+			}
+			if err := l.verifyRollback(ctx, rollback, cli, workloads, targetVerifyTimeout(&target)); err != nil {
+				return ReleaseApplyResp{ReleaseID: rollback.ID, Status: rollback.Status, RuntimeType: rollback.RuntimeType}, err
+			}
+		}
 	case "compose":
 		var target model.DeploymentTarget
 		if err := l.svcCtx.DB.WithContext(ctx).First(&target, current.TargetID).Error; err != nil {
@@ -237,7 +481,8 @@ func (l *Logic) RollbackRelease(ctx context.Context, id uint, uid uint64) (Relea
 			_ = l.svcCtx.DB.WithContext(ctx).Save(rollback).Error
 			return ReleaseApplyResp{ReleaseID: rollback.ID, Status: rollback.Status, RuntimeType: rollback.RuntimeType}, err
 		}
-		out, err := l.applyComposeRelease(ctx, &target, rollback.ID, prev.ManifestSnapshot)
+		rollback.StrategyStateJSON = toJSON(newComposeRolloutState(loadComposeRolloutState(&current).Config))
+		out, err := l.applyComposeRelease(ctx, &target, rollback, prev.ManifestSnapshot)
 		if err != nil {
 			rollback.Status = releaseStatusFailed
 			rollback.DiagnosticsJSON = toJSON([]releaseDiagnostic{{Runtime: "compose", Stage: "rollback", Code: "rollback_apply_failed", Message: err.Error(), Summary: truncateText(out, 800)}})
@@ -245,23 +490,29 @@ func (l *Logic) RollbackRelease(ctx context.Context, id uint, uid uint64) (Relea
 			return ReleaseApplyResp{ReleaseID: rollback.ID, Status: rollback.Status, RuntimeType: rollback.RuntimeType}, err
 		}
 		rollback.ChecksJSON = toJSON([]map[string]string{{"code": "compose_rollback_ps", "message": truncateText(out, 1200), "level": "info"}})
+		rollout := loadComposeRolloutState(rollback)
+		rollback.VerificationJSON = toJSON(map[string]any{"runtime": "compose", "checks": []string{"docker_compose_up", "health_" + rollout.Config.HealthCheck}, "passed": true, "rollback_succeeded": true, "batches": rollout.Batches, "nodes": len(rollout.Nodes)})
 	default:
 		rollback.Status = releaseStatusRejected
 		rollback.DiagnosticsJSON = toJSON([]releaseDiagnostic{{Runtime: current.RuntimeType, Stage: "rollback", Code: "runtime_not_supported", Message: "unsupported runtime", Summary: "rollback rejected"}})
 		_ = l.svcCtx.DB.WithContext(ctx).Save(rollback).Error
 		return ReleaseApplyResp{ReleaseID: rollback.ID, Status: rollback.Status, RuntimeType: rollback.RuntimeType}, fmt.Errorf("unsupported runtime: %s", current.RuntimeType)
 	}
+	// 回滚记录以 applying 状态执行, 只有应用与验证都成功后才进入 rollback 终态,
+	// 避免执行中或失败的回滚被当作成功的发布参与回滚源、漂移基线和 DORA 统计。
 	rollback.Status = releaseStatusRollback
-	rollback.VerificationJSON = toJSON(map[string]any{"runtime": current.RuntimeType, "rollback_succeeded": true})
+	if rollback.VerificationJSON == "{}" {
+		rollback.VerificationJSON = toJSON(map[string]any{"runtime": current.RuntimeType, "checks": []string{"apply_succeeded"}, "passed": true, "rollback_succeeded": true})
+	}
 	_ = l.svcCtx.DB.WithContext(ctx).Save(rollback).Error
-	l.writeReleaseAudit(ctx, rollback.ID, uint(uid), "release.rollback_completed", map[string]any{"from_release_id": current.ID})
+	l.writeReleaseAudit(ctx, rollback.ID, uint(uid), "release.rollback_completed", map[string]any{"from_release_id": current.ID, "to_release_id": prev.ID})
 	return ReleaseApplyResp{
 		ReleaseID:        rollback.ID,
 		UnifiedReleaseID: rollback.ID,
 		Status:           rollback.Status,
 		RuntimeType:      rollback.RuntimeType,
 		TriggerSource:    rollback.TriggerSource,
-		TriggerContext:   map[string]any{"from_release_id": current.ID},
+		TriggerContext:   map[string]any{"from_release_id": current.ID, "to_release_id": prev.ID},
 		CIRunID:          rollback.CIRunID,
 		LifecycleState:   l.releaseLifecycleState(rollback.Status),
 	}, nil
@@ -281,43 +532,89 @@ func (l *Logic) ApproveRelease(ctx context.Context, id uint, uid uint64, comment
 		Order("id DESC").First(&approval).Error; err != nil {
 		return ReleaseApplyResp{}, fmt.Errorf("approval record not found")
 	}
-	approval.Decision = "approved"
-	approval.Comment = strings.TrimSpace(comment)
-	approval.ApproverID = uint(uid)
-	if err := l.svcCtx.DB.WithContext(ctx).Save(&approval).Error; err != nil {
+	rule := approvalDecisionFromRule(&approval)
+	roles, err := l.checkApprover(ctx, &approval, rule, uid, "approved")
+	if err != nil {
 		return ReleaseApplyResp{}, err
 	}
-	release.Status = releaseStatusApproved
-	if err := l.svcCtx.DB.WithContext(ctx).Save(&release).Error; err != nil {
+	if err := l.recordApprovalVote(ctx, &approval, uid, "approved", comment, roles); err != nil {
+		return ReleaseApplyResp{}, err
+	}
+	quorumReached := approval.ApprovedCount >= rule.MinApprovals
+	if quorumReached {
+		approval.Decision = "approved"
+	}
+	if err := l.svcCtx.DB.WithContext(ctx).Save(&approval).Error; err != nil {
 		return ReleaseApplyResp{}, err
 	}
+	l.writeReleaseAudit(ctx, release.ID, uint(uid), "release.approval_vote", map[string]any{
+		"ticket":             approval.Ticket,
+		"decision":           "approved",
+		"approved_count":     approval.ApprovedCount,
+		"required_approvals": rule.MinApprovals,
+	})
+	if !quorumReached {
+		return ReleaseApplyResp{
+			ReleaseID:         release.ID,
+			UnifiedReleaseID:  release.ID,
+			Status:            release.Status,
+			RuntimeType:       release.RuntimeType,
+			TriggerSource:     release.TriggerSource,
+			TriggerContext:    map[string]any{"approval_ticket": approval.Ticket},
+			CIRunID:           release.CIRunID,
+			ApprovalRequired:  true,
+			ApprovalTicket:    approval.Ticket,
+			RequiredApprovals: rule.MinApprovals,
+			ApprovedCount:     approval.ApprovedCount,
+			ApprovalSource:    rule.Source,
+			LifecycleState:    l.releaseLifecycleState(release.Status),
+		}, nil
+	}
+	// 并发投票可能同时达到法定票数, 只有把状态从 pending_approval 改掉的请求继续执行发布。
+	res := l.svcCtx.DB.WithContext(ctx).Model(&model.DeploymentRelease{}).
+		Where("id = ? AND status = ?", release.ID, releaseStatusPendingApproval).
+		Update("status", releaseStatusApproved)
+	if res.Error != nil {
+		return ReleaseApplyResp{}, res.Error
+	}
+	if res.RowsAffected != 1 {
+		if err := l.svcCtx.DB.WithContext(ctx).First(&release, release.ID).Error; err != nil {
+			return ReleaseApplyResp{}, err
+		}
+		return ReleaseApplyResp{
+			ReleaseID:         release.ID,
+			UnifiedReleaseID:  release.ID,
+			Status:            release.Status,
+			RuntimeType:       release.RuntimeType,
+			TriggerSource:     release.TriggerSource,
+			TriggerContext:    map[string]any{"approval_ticket": approval.Ticket},
+			CIRunID:           release.CIRunID,
+			ApprovalTicket:    approval.Ticket,
+			RequiredApprovals: rule.MinApprovals,
+			ApprovedCount:     approval.ApprovedCount,
+			ApprovalSource:    rule.Source,
+			LifecycleState:    l.releaseLifecycleState(release.Status),
+		}, nil
+	}
+	release.Status = releaseStatusApproved
 	l.writeReleaseAudit(ctx, release.ID, uint(uid), "release.approved", map[string]any{"ticket": approval.Ticket, "comment": approval.Comment})
 	var target model.DeploymentTarget
 	if err := l.svcCtx.DB.WithContext(ctx).First(&target, release.TargetID).Error; err != nil {
 		return ReleaseApplyResp{}, err
 	}
-	if execErr := l.executeRelease(ctx, &release, &target); execErr != nil {
-		return ReleaseApplyResp{
-			ReleaseID:        release.ID,
-			UnifiedReleaseID: release.ID,
-			Status:           release.Status,
-			RuntimeType:      release.RuntimeType,
-			TriggerSource:    release.TriggerSource,
-			TriggerContext:   map[string]any{"approval_ticket": approval.Ticket},
-			CIRunID:          release.CIRunID,
-			LifecycleState:   l.releaseLifecycleState(release.Status),
-		}, execErr
-	}
+	position, holder, execErr := l.runOrQueue(ctx, &release, &target)
 	return ReleaseApplyResp{
-		ReleaseID:        release.ID,
-		UnifiedReleaseID: release.ID,
-		Status:           release.Status,
-		RuntimeType:      release.RuntimeType,
-		TriggerSource:    release.TriggerSource,
-		TriggerContext:   map[string]any{"approval_ticket": approval.Ticket},
-		CIRunID:          release.CIRunID,
-		LifecycleState:   l.releaseLifecycleState(release.Status),
-	}, nil
+		ReleaseID:           release.ID,
+		UnifiedReleaseID:    release.ID,
+		Status:              release.Status,
+		RuntimeType:         release.RuntimeType,
+		TriggerSource:       release.TriggerSource,
+		TriggerContext:      map[string]any{"approval_ticket": approval.Ticket},
+		CIRunID:             release.CIRunID,
+		LifecycleState:      l.releaseLifecycleState(release.Status),
+		QueuePosition:       position,
+		LockHolderReleaseID: holder,
+	}, execErr
 }
 
 func (l *Logic) RejectRelease(ctx context.Context, id uint, uid uint64, comment string) (ReleaseApplyResp, error) {
@@ -334,16 +631,27 @@ func (l *Logic) RejectRelease(ctx context.Context, id uint, uid uint64, comment
 		Order("id DESC").First(&approval).Error; err != nil {
 		return ReleaseApplyResp{}, fmt.Errorf("approval record not found")
 	}
+	roles, err := l.checkApprover(ctx, &approval, approvalDecisionFromRule(&approval), uid, "rejected")
+	if err != nil {
+		return ReleaseApplyResp{}, err
+	}
+	if err := l.recordApprovalVote(ctx, &approval, uid, "rejected", comment, roles); err != nil {
+		return ReleaseApplyResp{}, err
+	}
 	approval.Decision = "rejected"
-	approval.Comment = strings.TrimSpace(comment)
-	approval.ApproverID = uint(uid)
 	if err := l.svcCtx.DB.WithContext(ctx).Save(&approval).Error; err != nil {
 		return ReleaseApplyResp{}, err
 	}
-	release.Status = releaseStatusRejected
-	if err := l.svcCtx.DB.WithContext(ctx).Save(&release).Error; err != nil {
-		return ReleaseApplyResp{}, err
+	res := l.svcCtx.DB.WithContext(ctx).Model(&model.DeploymentRelease{}).
+		Where("id = ? AND status = ?", release.ID, releaseStatusPendingApproval).
+		Updates(map[string]any{"status": releaseStatusRejected, "finished_at": time.Now()})
+	if res.Error != nil {
+		return ReleaseApplyResp{}, res.Error
 	}
+	if res.RowsAffected != 1 {
+		return ReleaseApplyResp{}, fmt.Errorf("release %d is no longer pending approval", release.ID)
+	}
+	release.Status = releaseStatusRejected
 	l.writeReleaseAudit(ctx, release.ID, uint(uid), "release.rejected", map[string]any{"ticket": approval.Ticket, "comment": approval.Comment})
 	return ReleaseApplyResp{
 		ReleaseID:        release.ID,
@@ -411,51 +719,132 @@ func (l *Logic) ListReleaseTimeline(ctx context.Context, releaseID uint) ([]Rele
 	return out, nil
 }
 
-func (l *Logic) resolveReleaseContext(ctx context.Context, req ReleasePreviewReq) (*model.Service, *model.DeploymentTarget, string, error) {
+func (l *Logic) resolveReleaseContext(ctx context.Context, req ReleasePreviewReq) (*model.Service, *model.DeploymentTarget, releaseRender, error) {
 	var svc model.Service
 	if err := l.svcCtx.DB.WithContext(ctx).First(&svc, req.ServiceID).Error; err != nil {
-		return nil, nil, "", err
+		return nil, nil, releaseRender{}, err
 	}
 	var target model.DeploymentTarget
 	if err := l.svcCtx.DB.WithContext(ctx).First(&target, req.TargetID).Error; err != nil {
-		return nil, nil, "", err
+		return nil, nil, releaseRender{}, err
 	}
 	if target.TargetType != "k8s" && target.TargetType != "compose" {
-		return nil, nil, "", fmt.Errorf("unsupported runtime target")
+		return nil, nil, releaseRender{}, fmt.Errorf("unsupported runtime target")
 	}
 	if target.TargetType == "k8s" && target.ClusterID == 0 && target.CredentialID == 0 {
-		return nil, nil, "", fmt.Errorf("k8s target missing cluster binding or credential")
+		return nil, nil, releaseRender{}, fmt.Errorf("k8s target missing cluster binding or credential")
 	}
 	if target.TargetType == "compose" {
 		var cnt int64
 		if err := l.svcCtx.DB.WithContext(ctx).Model(&model.DeploymentTargetNode{}).
 			Where("target_id = ? AND status = ?", target.ID, "active").Count(&cnt).Error; err != nil {
-			return nil, nil, "", err
+			return nil, nil, releaseRender{}, err
 		}
 		if cnt == 0 {
-			return nil, nil, "", fmt.Errorf("compose target has no active host node")
+			return nil, nil, releaseRender{}, fmt.Errorf("compose target has no active host node")
 		}
 	}
 	if rs := strings.TrimSpace(target.ReadinessStatus); rs != "" && rs != "ready" && rs != "unknown" {
-		return nil, nil, "", fmt.Errorf("target is not bootstrap ready: %s", rs)
+		return nil, nil, releaseRender{}, fmt.Errorf("target is not bootstrap ready: %s", rs)
+	}
+	if req.promotion != nil {
+		return &svc, &target, req.promotion.Render, nil
 	}
-	manifest := strings.TrimSpace(defaultIfEmpty(svc.CustomYAML, svc.YamlContent))
-	if manifest == "" {
-		return nil, nil, "", fmt.Errorf("empty service manifest")
+	template := strings.TrimSpace(defaultIfEmpty(svc.CustomYAML, svc.YamlContent))
+	if template == "" {
+		return nil, nil, releaseRender{}, fmt.Errorf("empty service manifest")
+	}
+	env := strings.ToLower(strings.TrimSpace(defaultIfEmpty(req.Env, defaultIfEmpty(target.Env, svc.Env))))
+	envValues, err := l.serviceEnvVariables(ctx, svc.ID, env)
+	if err != nil {
+		return nil, nil, releaseRender{}, err
 	}
-	for k, v := range req.Variables {
+	render, err := renderReleaseManifest(template, req.Variables, envValues)
+	if err != nil {
+		return nil, nil, releaseRender{}, err
+	}
+	return &svc, &target, render, nil
+}
+
+// releaseVariables 记录渲染清单所用的变量: 请求变量原样保存, 环境变量只记键名,
+// 其取值留在 ServiceVariableSet 中, 晋级时按目标环境重新取值。
+type releaseVariables struct {
+	Env     string            `json:"env"`
+	Request map[string]string `json:"request,omitempty"`
+	EnvKeys []string          `json:"env_keys,omitempty"`
+}
+
+// releaseRender 是一次清单渲染的结果。
+type releaseRender struct {
+	Manifest  string
+	Template  string
+	Variables releaseVariables
+}
+
+// renderReleaseManifest 用请求变量与环境变量替换模板中的 {{key}}, 请求变量优先。
+func renderReleaseManifest(template string, request, envValues map[string]string) (releaseRender, error) {
+	manifest := template
+	for k, v := range request {
 		manifest = strings.ReplaceAll(manifest, "{{"+k+"}}", v)
 	}
+	envKeys := make([]string, 0)
+	for k, v := range envValues {
+		if strings.Contains(manifest, "{{"+k+"}}") {
+			manifest = strings.ReplaceAll(manifest, "{{"+k+"}}", v)
+			envKeys = append(envKeys, k)
+		}
+	}
 	if strings.Contains(manifest, "{{") && strings.Contains(manifest, "}}") {
-		return nil, nil, "", fmt.Errorf("manifest contains unresolved template variables")
+		return releaseRender{}, fmt.Errorf("manifest contains unresolved template variables")
+	}
+	sort.Strings(envKeys)
+	return releaseRender{
+		Manifest:  manifest,
+		Template:  template,
+		Variables: releaseVariables{Request: request, EnvKeys: envKeys},
+	}, nil
+}
+
+// serviceEnvVariables 读取服务在指定环境下的变量集, 不存在时返回空集合。
+func (l *Logic) serviceEnvVariables(ctx context.Context, serviceID uint, env string) (map[string]string, error) {
+	out := map[string]string{}
+	if env == "" {
+		return out, nil
+	}
+	var set model.ServiceVariableSet
+	err := l.svcCtx.DB.WithContext(ctx).Where("service_id = ? AND env = ?", serviceID, env).First(&set).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return out, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load %s variables: %w", env, err)
+	}
+	if strings.TrimSpace(set.ValuesJSON) != "" {
+		if err := json.Unmarshal([]byte(set.ValuesJSON), &out); err != nil {
+			return nil, fmt.Errorf("invalid %s variable set: %w", env, err)
+		}
 	}
-	return &svc, &target, manifest, nil
+	return out, nil
 }
 
 func (l *Logic) executeRelease(ctx context.Context, release *model.DeploymentRelease, target *model.DeploymentTarget) error {
+	if err := l.recheckReleaseFreeze(ctx, release, target); err != nil {
+		if !errors.Is(err, ErrChangeFreeze) && !errors.Is(err, errReleaseStatusChanged) {
+			release.Status = releaseStatusFailed
+			release.DiagnosticsJSON = toJSON([]releaseDiagnostic{{
+				Runtime: release.RuntimeType, Stage: "freeze", Code: "freeze_check_failed", Message: err.Error(), Summary: "cannot check change freeze before execution",
+			}})
+			_ = l.svcCtx.DB.WithContext(ctx).Save(release).Error
+			l.writeReleaseAudit(ctx, release.ID, release.Operator, "release.failed", map[string]any{"reason": "freeze_check_failed"})
+		}
+		return err
+	}
 	release.Status = releaseStatusApplying
 	_ = l.svcCtx.DB.WithContext(ctx).Save(release).Error
 	l.writeReleaseAudit(ctx, release.ID, release.Operator, "release.applying", map[string]any{"runtime": target.TargetType})
+	if err := l.runReleaseHooks(ctx, release, hookPhasePre); err != nil {
+		return err
+	}
 	switch target.TargetType {
 	case "k8s":
 		var cluster model.Cluster
@@ -468,7 +857,30 @@ func (l *Logic) executeRelease(ctx context.Context, release *model.DeploymentRel
 			l.writeReleaseAudit(ctx, release.ID, release.Operator, "release.failed", map[string]any{"reason": "cluster_not_found"})
 			return err
 		}
-		if err := projectlogic.DeployToCluster(ctx, &cluster, release.ManifestSnapshot); err != nil {
+		if isProgressiveStrategy(release.Strategy) {
+			rt, err := l.strategyRuntimeForTarget(ctx, target)
+			if err == nil {
+				var started bool
+				started, err = l.startReleaseStrategy(ctx, release, target, rt)
+				if started {
+					return nil
+				}
+			}
+			if err != nil {
+				release.Status = releaseStatusFailed
+				release.DiagnosticsJSON = toJSON([]releaseDiagnostic{{
+					Runtime: "k8s", Stage: "strategy", Code: "strategy_start_failed", Message: err.Error(), Summary: fmt.Sprintf("cannot start %s release", release.Strategy),
+				}})
+				_ = l.svcCtx.DB.WithContext(ctx).Save(release).Error
+				l.writeReleaseAudit(ctx, release.ID, release.Operator, "release.failed", map[string]any{"reason": "strategy_start_failed"})
+				return err
+			}
+		}
+		applier, err := dynamicApplierForCluster(&cluster)
+		if err == nil {
+			err = l.applyReleaseManifest(ctx, applier, release, release.ManifestSnapshot)
+		}
+		if err != nil {
 			release.Status = releaseStatusFailed
 			release.DiagnosticsJSON = toJSON([]releaseDiagnostic{{
 				Runtime: "k8s", Stage: "execute", Code: "deploy_failed", Message: err.Error(), Summary: "k8s runtime apply failed",
@@ -477,10 +889,45 @@ func (l *Logic) executeRelease(ctx context.Context, release *model.DeploymentRel
 			l.writeReleaseAudit(ctx, release.ID, release.Operator, "release.failed", map[string]any{"reason": "deploy_failed"})
 			return err
 		}
-		release.VerificationJSON = toJSON(map[string]any{"runtime": "k8s", "checks": []string{"apply_succeeded"}, "passed": true})
-		release.Status = releaseStatusApplied
+		workloads, err := extractRolloutWorkloads(release.ManifestSnapshot)
+		if err != nil {
+			// 无法解析出需要验证的工作负载时不能视为验证通过, 否则未经验证的发布可被晋级。
+			release.Status = releaseStatusFailed
+			release.VerificationJSON = toJSON(map[string]any{"runtime": "k8s", "checks": []string{"apply_succeeded"}, "passed": false})
+			release.DiagnosticsJSON = toJSON([]releaseDiagnostic{{
+				Runtime: "k8s", Stage: "verify", Code: "verify_parse_failed", Message: err.Error(), Summary: "cannot parse manifest for rollout verification",
+			}})
+			_ = l.svcCtx.DB.WithContext(ctx).Save(release).Error
+			l.writeReleaseAudit(ctx, release.ID, release.Operator, "release.failed", map[string]any{"reason": "verify_parse_failed"})
+			return err
+		}
+		if len(workloads) == 0 {
+			release.VerificationJSON = toJSON(map[string]any{"runtime": "k8s", "checks": []string{"apply_succeeded"}, "passed": true})
+			release.Status = releaseStatusApplied
+			break
+		}
+		cli, err := rolloutClientForCluster(&cluster)
+		if err != nil {
+			release.Status = releaseStatusFailed
+			release.DiagnosticsJSON = toJSON([]releaseDiagnostic{{
+				Runtime: "k8s", Stage: "verify", Code: "verify_client_failed", Message: err.Error(), Summary: "cannot build client for rollout verification",
+			}})
+			_ = l.svcCtx.DB.WithContext(ctx).Save(release).Error
+			l.writeReleaseAudit(ctx, release.ID, release.Operator, "release.failed", map[string]any{"reason": "verify_client_failed"})
+			return err
+		}
+		timeout := targetVerifyTimeout(target)
+		release.Status = releaseStatusVerifying
+		release.VerificationJSON = toJSON(map[string]any{"runtime": "k8s", "checks": []string{"apply_succeeded", "rollout_status"}, "passed": false, "timeout_seconds": int(timeout.Seconds()), "workloads": workloads})
+		_ = l.svcCtx.DB.WithContext(ctx).Save(release).Error
+		l.writeReleaseAudit(ctx, release.ID, release.Operator, "release.verifying", map[string]any{"workloads": workloads, "timeout_seconds": int(timeout.Seconds())})
+		l.startReleaseVerification(release, cli, workloads, timeout)
+		return nil
 	default:
-		out, execErr := l.applyComposeRelease(ctx, target, release.ID, release.ManifestSnapshot)
+		if isProgressiveStrategy(release.Strategy) {
+			l.writeReleaseAudit(ctx, release.ID, release.Operator, "release.strategy.unsupported", map[string]any{"strategy": release.Strategy, "runtime": target.TargetType})
+		}
+		out, execErr := l.applyComposeRelease(ctx, target, release, release.ManifestSnapshot)
 		if execErr != nil {
 			release.Status = releaseStatusFailed
 			release.WarningsJSON = toJSON([]map[string]string{{"code": "compose_apply_failed", "message": truncateText(out, 1200), "level": "warning"}})
@@ -492,9 +939,13 @@ func (l *Logic) executeRelease(ctx context.Context, release *model.DeploymentRel
 			return execErr
 		}
 		release.Status = releaseStatusApplied
-		release.VerificationJSON = toJSON(map[string]any{"runtime": "compose", "checks": []string{"docker_compose_ps"}, "passed": true})
+		rollout := loadComposeRolloutState(release)
+		release.VerificationJSON = toJSON(map[string]any{"runtime": "compose", "checks": []string{"docker_compose_up", "health_" + rollout.Config.HealthCheck}, "passed": true, "batches": rollout.Batches, "nodes": len(rollout.Nodes)})
 		release.ChecksJSON = toJSON([]map[string]string{{"code": "compose_ps", "message": truncateText(out, 1200), "level": "info"}})
 	}
+	if err := l.runReleaseHooks(ctx, release, hookPhasePost); err != nil {
+		return err
+	}
 	_ = l.svcCtx.DB.WithContext(ctx).Save(release).Error
 	l.writeReleaseAudit(ctx, release.ID, release.Operator, "release.applied", map[string]any{"runtime": target.TargetType})
 	return nil
@@ -523,6 +974,12 @@ func (l *Logic) releaseLifecycleState(status string) string {
 		return "pending_approval"
 	case releaseStatusApplying:
 		return "applying"
+	case releaseStatusVerifying:
+		return "verifying"
+	case releaseStatusPaused:
+		return "paused"
+	case releaseStatusAborted:
+		return "aborted"
 	case releaseStatusApproved:
 		return "approved"
 	case releaseStatusApplied:
@@ -533,6 +990,10 @@ func (l *Logic) releaseLifecycleState(status string) string {
 		return "rejected"
 	case releaseStatusRollback, releaseStatusRolledBack:
 		return "rollback"
+	case releaseStatusQueued:
+		return "queued"
+	case releaseStatusCancelled:
+		return "cancelled"
 	default:
 		return status
 	}
@@ -2,6 +2,7 @@ package deployment
 
 import (
 	"context"
+	"errors"
 	"testing"
 
 	"github.com/cy77cc/OpsPilot/internal/model"
@@ -32,7 +33,18 @@ func newReleaseTestSuite(t *testing.T) *releaseTestSuite {
 		&model.DeploymentTargetNode{},
 		&model.DeploymentRelease{},
 		&model.DeploymentReleaseApproval{},
+		&model.DeploymentReleaseApprovalVote{},
+		&model.Policy{},
+		&model.CICDDeploymentCDConfig{},
+		&model.Role{},
+		&model.UserRole{},
 		&model.DeploymentReleaseAudit{},
+		&model.DeploymentFreezeWindow{},
+		&model.DeploymentTargetLock{},
+		&model.DeploymentReleaseHook{},
+		&model.ServiceVariableSet{},
+		&model.Permission{},
+		&model.RolePermission{},
 		&model.Service{},
 		&model.Cluster{},
 		&model.ClusterCredential{},
@@ -404,6 +416,28 @@ func TestRollbackRelease_NoPreviousRelease(t *testing.T) {
 	}
 }
 
+func TestRollbackReleaseTo_RejectsUnusableTarget(t *testing.T) {
+	suite := newReleaseTestSuite(t)
+	ctx := context.Background()
+
+	svc := suite.createTestService(t)
+	target := suite.createTestTarget(t, suite.createTestCluster(t).ID)
+	failed := suite.createTestRelease(t, svc.ID, target.ID, releaseStatusFailed)
+	other := suite.createTestRelease(t, svc.ID+1, target.ID, releaseStatusApplied)
+	current := suite.createTestRelease(t, svc.ID, target.ID, releaseStatusApplied)
+
+	for _, toID := range []uint{failed.ID, other.ID, current.ID, current.ID + 100} {
+		if _, err := suite.logic.RollbackReleaseTo(ctx, current.ID, toID, 1); !errors.Is(err, ErrRollbackTargetNotFound) {
+			t.Fatalf("rollback to %d: expected ErrRollbackTargetNotFound, got %v", toID, err)
+		}
+	}
+	var count int64
+	suite.db.Model(&model.DeploymentRelease{}).Count(&count)
+	if count != 3 {
+		t.Fatalf("expected no rollback release to be created, got %d releases", count)
+	}
+}
+
 func TestRollbackRelease_Success(t *testing.T) {
 	suite := newReleaseTestSuite(t)
 	ctx := context.Background()
@@ -426,6 +460,58 @@ func TestRollbackRelease_Success(t *testing.T) {
 	_ = prevRelease
 }
 
+func TestRollbackRelease_InFlightAndFailedRollbackIsNotSuccessful(t *testing.T) {
+	suite := newReleaseTestSuite(t)
+	ctx := context.Background()
+
+	svc := suite.createTestService(t)
+	target := suite.createTestTarget(t, suite.createTestCluster(t).ID)
+	prev := suite.createTestRelease(t, svc.ID, target.ID, releaseStatusApplied)
+	current := suite.createTestRelease(t, svc.ID, target.ID, releaseStatusApplied)
+
+	// 在回滚记录插入时检查其状态: 执行中的回滚不能带有成功状态或完成时间。
+	var created model.DeploymentRelease
+	if err := suite.db.Callback().Create().After("gorm:create").Register("test:capture_rollback", func(tx *gorm.DB) {
+		if row, ok := tx.Statement.Dest.(*model.DeploymentRelease); ok && row.Strategy == "rollback" {
+			created = *row
+		}
+	}); err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+
+	// 测试集群不可达, 回滚应用失败。
+	if _, err := suite.logic.RollbackRelease(ctx, current.ID, 1); err == nil {
+		t.Fatal("expected rollback against unreachable cluster to fail")
+	}
+	if created.ID == 0 || created.Status != releaseStatusApplying || created.FinishedAt != nil {
+		t.Fatalf("expected rollback to be created as applying without finished_at, got %q %v", created.Status, created.FinishedAt)
+	}
+	var row model.DeploymentRelease
+	suite.db.First(&row, created.ID)
+	if row.Status != releaseStatusFailed {
+		t.Fatalf("expected failed rollback, got %s", row.Status)
+	}
+
+	next := suite.createTestRelease(t, svc.ID, target.ID, releaseStatusApplied)
+	got, err := suite.logic.previousSuccessfulRelease(ctx, next)
+	if err != nil || got.ID != current.ID {
+		t.Fatalf("expected previous successful release %d, got %+v (%v)", current.ID, got, err)
+	}
+	if _, err := suite.logic.RollbackReleaseTo(ctx, next.ID, row.ID, 1); !errors.Is(err, ErrRollbackTargetNotFound) {
+		t.Fatalf("expected failed rollback to be rejected as rollback source, got %v", err)
+	}
+	baselines, err := suite.logic.driftBaselines(ctx, target.ID)
+	if err != nil {
+		t.Fatalf("drift baselines: %v", err)
+	}
+	for _, b := range baselines {
+		if b.ID == row.ID {
+			t.Fatalf("failed rollback %d must not be a drift baseline", row.ID)
+		}
+	}
+	_ = prev
+}
+
 // ============================================================================
 // ListReleaseTimeline Tests
 // ============================================================================
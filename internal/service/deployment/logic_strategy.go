@@ -0,0 +1,1131 @@
+package deployment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cy77cc/OpsPilot/internal/logger"
+	"github.com/cy77cc/OpsPilot/internal/model"
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+const (
+	releaseStrategyRolling   = "rolling"
+	releaseStrategyCanary    = "canary"
+	releaseStrategyBlueGreen = "blue-green"
+
+	// strategyTrackLabel 区分金丝雀与稳定版本的 Pod, Service 选择器不包含该标签, 因此两者共同承接流量。
+	strategyTrackLabel = "opspilot.io/track"
+	// strategyColorLabel 标识蓝绿发布的颜色, 切换流量时写入 Service 选择器。
+	strategyColorLabel = "opspilot.io/color"
+)
+
+const (
+	strategyPhaseProgressing = "progressing"
+	strategyPhasePaused      = "paused"
+	strategyPhaseCompleted   = "completed"
+	strategyPhaseAborted     = "aborted"
+	strategyPhaseFailed      = "failed"
+)
+
+var defaultCanarySteps = []int{10, 50, 100}
+
+// strategyUpdateAttempts 是暂停、推进、中止请求与后台协程写入冲突时的重试次数。
+const strategyUpdateAttempts = 5
+
+// strategyWorkload 记录参与渐进式发布的 Deployment 及其稳定版本的原始副本数。
+type strategyWorkload struct {
+	Namespace      string `json:"namespace"`
+	Name           string `json:"name"`
+	Replicas       int32  `json:"replicas"`
+	StableReplicas int32  `json:"stable_replicas"`
+	HasStable      bool   `json:"has_stable"`
+}
+
+// strategyState 是金丝雀/蓝绿发布的执行状态, 持久化在 DeploymentRelease.StrategyStateJSON。
+type strategyState struct {
+	Strategy        string             `json:"strategy"`
+	Phase           string             `json:"phase"`
+	Steps           []int              `json:"steps,omitempty"`
+	StepIndex       int                `json:"step_index"`
+	Weight          int                `json:"weight"`
+	EffectiveSteps  []int              `json:"effective_steps,omitempty"`  // 按副本数换算后各步骤实际的流量比例
+	EffectiveWeight int                `json:"effective_weight,omitempty"` // 当前步骤实际的流量比例, 副本较少时高于 Weight
+	IntervalSeconds int                `json:"interval_seconds,omitempty"`
+	AutoSwitch      bool               `json:"auto_switch,omitempty"`
+	Paused          bool               `json:"paused"`
+	Color           string             `json:"color,omitempty"`
+	PreviousColor   string             `json:"previous_color,omitempty"`
+	Switched        bool               `json:"switched,omitempty"`
+	TimeoutSeconds  int                `json:"timeout_seconds,omitempty"`
+	Workloads       []strategyWorkload `json:"workloads,omitempty"`
+}
+
+// strategyRuntime 封装策略引擎对集群的访问: applier 与普通发布共用服务端应用与归属标签, cli 用于扩缩容、清理与读取 Service。
+type strategyRuntime struct {
+	applier manifestApplier
+	cli     kubernetes.Interface
+}
+
+func isProgressiveStrategy(strategy string) bool {
+	switch strings.TrimSpace(strategy) {
+	case releaseStrategyCanary, releaseStrategyBlueGreen:
+		return true
+	default:
+		return false
+	}
+}
+
+// newStrategyState 解析 strategy_config 并生成初始状态。
+//
+// 金丝雀支持 steps (流量百分比序列)、traffic_percent (首个步骤) 与 interval_seconds (自动推进间隔, 0 表示每步等待人工推进);
+// 蓝绿支持 auto_switch (新颜色就绪后是否自动切换, 默认 true)。
+func newStrategyState(strategy string, raw map[string]any) (strategyState, error) {
+	var cfg struct {
+		Steps           []int `json:"steps"`
+		TrafficPercent  int   `json:"traffic_percent"`
+		IntervalSeconds int   `json:"interval_seconds"`
+		AutoSwitch      *bool `json:"auto_switch"`
+	}
+	if len(raw) > 0 {
+		data, _ := json.Marshal(raw)
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return strategyState{}, fmt.Errorf("invalid strategy_config: %w", err)
+		}
+	}
+	if cfg.IntervalSeconds < 0 {
+		return strategyState{}, fmt.Errorf("strategy_config.interval_seconds must not be negative")
+	}
+	state := strategyState{Strategy: strategy, Phase: strategyPhaseProgressing, IntervalSeconds: cfg.IntervalSeconds}
+	switch strategy {
+	case releaseStrategyCanary:
+		steps := append([]int(nil), cfg.Steps...)
+		if cfg.TrafficPercent > 0 && (len(steps) == 0 || steps[0] != cfg.TrafficPercent) {
+			steps = append([]int{cfg.TrafficPercent}, steps...)
+		}
+		if len(steps) == 0 {
+			steps = append(steps, defaultCanarySteps...)
+		}
+		for i, step := range steps {
+			if step < 1 || step > 100 {
+				return strategyState{}, fmt.Errorf("canary step %d must be between 1 and 100", step)
+			}
+			if i > 0 && step <= steps[i-1] {
+				return strategyState{}, fmt.Errorf("canary steps must be strictly increasing")
+			}
+		}
+		if steps[len(steps)-1] != 100 {
+			steps = append(steps, 100)
+		}
+		state.Steps = steps
+		state.Weight = steps[0]
+	case releaseStrategyBlueGreen:
+		state.AutoSwitch = cfg.AutoSwitch == nil || *cfg.AutoSwitch
+	default:
+		return strategyState{}, fmt.Errorf("unsupported strategy %s", strategy)
+	}
+	return state, nil
+}
+
+// planReleaseStrategy 生成发布的初始策略状态; 金丝雀按清单中 Deployment 的副本数校验步骤并换算实际流量比例。
+func planReleaseStrategy(strategy string, raw map[string]any, manifest string) (strategyState, error) {
+	state, err := newStrategyState(strategy, raw)
+	if err != nil || strategy != releaseStrategyCanary {
+		return state, err
+	}
+	objs, err := decodeManifestObjects(manifest)
+	if err != nil {
+		return state, err
+	}
+	state.EffectiveSteps, err = canaryPlan(state.Steps, strategyWorkloadsFromManifest(objs))
+	return state, err
+}
+
+// canaryPlan 按各 Deployment 的副本数换算每个步骤实际的流量比例 (取各 Deployment 中最大的一个)。
+// 金丝雀副本数向上取整且至少为 1, 低于 100% 的步骤若会把全部副本切到金丝雀则无法按步骤放量, 返回错误。
+func canaryPlan(steps []int, workloads []strategyWorkload) ([]int, error) {
+	effective := make([]int, len(steps))
+	for i, step := range steps {
+		for _, w := range workloads {
+			total := w.Replicas
+			if total <= 0 {
+				total = 1
+			}
+			canary := canaryReplicas(total, step)
+			if step < 100 && canary >= total {
+				return nil, fmt.Errorf("canary step %d%% would move all %d replica(s) of deployment %s/%s to the canary, increase replicas or remove the step", step, total, w.Namespace, w.Name)
+			}
+			if weight := int(canary) * 100 / int(total); weight > effective[i] {
+				effective[i] = weight
+			}
+		}
+	}
+	return effective, nil
+}
+
+// setStep 切换到第 i 个金丝雀步骤, 记录请求的与实际的流量比例。
+func (s *strategyState) setStep(i int) {
+	s.StepIndex = i
+	s.Weight = s.Steps[i]
+	s.EffectiveWeight = s.Weight
+	if i < len(s.EffectiveSteps) {
+		s.EffectiveWeight = s.EffectiveSteps[i]
+	}
+}
+
+func loadStrategyState(release *model.DeploymentRelease) (strategyState, error) {
+	var state strategyState
+	if strings.TrimSpace(release.StrategyStateJSON) == "" {
+		return state, fmt.Errorf("release %d has no strategy state", release.ID)
+	}
+	if err := json.Unmarshal([]byte(release.StrategyStateJSON), &state); err != nil {
+		return state, fmt.Errorf("decode strategy state: %w", err)
+	}
+	return state, nil
+}
+
+// strategyPlanMessage 生成预览检查项中展示的策略执行计划。
+func strategyPlanMessage(state strategyState) string {
+	switch state.Strategy {
+	case releaseStrategyCanary:
+		parts := make([]string, 0, len(state.Steps))
+		for i, step := range state.Steps {
+			part := fmt.Sprintf("%d%%", step)
+			if i < len(state.EffectiveSteps) && state.EffectiveSteps[i] != step {
+				part = fmt.Sprintf("%d%% (actual %d%% by replicas)", step, state.EffectiveSteps[i])
+			}
+			parts = append(parts, part)
+		}
+		gate := "manual promote between steps"
+		if state.IntervalSeconds > 0 {
+			gate = fmt.Sprintf("auto promote every %ds", state.IntervalSeconds)
+		}
+		return fmt.Sprintf("canary steps=%s (%s)", strings.Join(parts, " -> "), gate)
+	case releaseStrategyBlueGreen:
+		if state.AutoSwitch {
+			return "blue-green: deploy idle color, switch service selector when ready"
+		}
+		return "blue-green: deploy idle color, wait for promote before switching service selector"
+	default:
+		return state.Strategy
+	}
+}
+
+func decodeManifestObjects(manifest string) ([]*unstructured.Unstructured, error) {
+	out := make([]*unstructured.Unstructured, 0)
+	for _, doc := range strings.Split(manifest, "---") {
+		if strings.TrimSpace(doc) == "" {
+			continue
+		}
+		data, err := sigsyaml.YAMLToJSON([]byte(doc))
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(string(data)) == "null" {
+			continue
+		}
+		// 经 UnstructuredJSONScheme 解码, 整数保持为 int64, 便于 NestedInt64 读取副本数。
+		obj := &unstructured.Unstructured{}
+		if err := obj.UnmarshalJSON(data); err != nil {
+			return nil, err
+		}
+		out = append(out, obj)
+	}
+	return out, nil
+}
+
+func encodeManifestObjects(objs []*unstructured.Unstructured) (string, error) {
+	docs := make([]string, 0, len(objs))
+	for _, obj := range objs {
+		data, err := sigsyaml.Marshal(obj.Object)
+		if err != nil {
+			return "", err
+		}
+		docs = append(docs, strings.TrimSpace(string(data)))
+	}
+	return strings.Join(docs, "\n---\n"), nil
+}
+
+func isManifestDeployment(obj *unstructured.Unstructured) bool {
+	return obj.GetKind() == "Deployment" && strings.HasPrefix(obj.GetAPIVersion(), appsv1.GroupName+"/")
+}
+
+func isManifestService(obj *unstructured.Unstructured) bool {
+	return obj.GetKind() == "Service" && obj.GetAPIVersion() == "v1"
+}
+
+func manifestNamespace(obj *unstructured.Unstructured) string {
+	return defaultIfEmpty(obj.GetNamespace(), "default")
+}
+
+// strategyWorkloadsFromManifest 返回清单中的 Deployment, 其余工作负载随最终的全量应用一起更新。
+func strategyWorkloadsFromManifest(objs []*unstructured.Unstructured) []strategyWorkload {
+	out := make([]strategyWorkload, 0)
+	for _, obj := range objs {
+		if !isManifestDeployment(obj) {
+			continue
+		}
+		replicas, found, _ := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+		if !found {
+			replicas = 1
+		}
+		out = append(out, strategyWorkload{Namespace: manifestNamespace(obj), Name: obj.GetName(), Replicas: int32(replicas)})
+	}
+	return out
+}
+
+// labeledDeployment 复制 Deployment 并改名, 在选择器和 Pod 模板上追加标签, 使其与原 Deployment 互不接管 Pod。
+func labeledDeployment(obj *unstructured.Unstructured, suffix, key, value string) *unstructured.Unstructured {
+	out := obj.DeepCopy()
+	out.SetName(obj.GetName() + "-" + suffix)
+	out.SetNamespace(manifestNamespace(obj))
+	labels := out.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[key] = value
+	out.SetLabels(labels)
+	for _, path := range [][]string{{"spec", "selector", "matchLabels"}, {"spec", "template", "metadata", "labels"}} {
+		current, _, _ := unstructured.NestedStringMap(out.Object, path...)
+		if current == nil {
+			current = map[string]string{}
+		}
+		current[key] = value
+		_ = unstructured.SetNestedStringMap(out.Object, current, path...)
+	}
+	return out
+}
+
+// canaryReplicas 按流量权重换算金丝雀副本数, 至少 1 个, 至多总副本数。
+func canaryReplicas(total int32, weight int) int32 {
+	if total <= 0 {
+		total = 1
+	}
+	n := (int64(total)*int64(weight) + 99) / 100
+	if n < 1 {
+		n = 1
+	}
+	if n > int64(total) {
+		n = int64(total)
+	}
+	return int32(n)
+}
+
+// canaryManifest 生成金丝雀步骤的清单: 辅助资源 (ConfigMap/Secret 等) 与按权重缩放的 <name>-canary Deployment。
+// Service 不做修改, 金丝雀 Pod 保留原有标签从而按副本比例分担流量。
+func canaryManifest(objs []*unstructured.Unstructured, weight int) (string, error) {
+	out := make([]*unstructured.Unstructured, 0, len(objs))
+	for _, obj := range objs {
+		switch {
+		case isManifestService(obj):
+			continue
+		case isManifestDeployment(obj):
+			replicas, found, _ := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+			if !found {
+				replicas = 1
+			}
+			canary := labeledDeployment(obj, "canary", strategyTrackLabel, "canary")
+			_ = unstructured.SetNestedField(canary.Object, int64(canaryReplicas(int32(replicas), weight)), "spec", "replicas")
+			out = append(out, canary)
+		case isRolloutWorkloadKind(obj.GetKind()):
+			// StatefulSet/DaemonSet 不参与金丝雀, 在最终全量应用时更新。
+			continue
+		default:
+			out = append(out, obj)
+		}
+	}
+	return encodeManifestObjects(out)
+}
+
+// blueGreenManifest 生成蓝绿发布新颜色的清单: 辅助资源与 <name>-<color> Deployment, Service 暂不切换。
+func blueGreenManifest(objs []*unstructured.Unstructured, color string) (string, error) {
+	out := make([]*unstructured.Unstructured, 0, len(objs))
+	for _, obj := range objs {
+		switch {
+		case isManifestService(obj):
+			continue
+		case isManifestDeployment(obj):
+			out = append(out, labeledDeployment(obj, color, strategyColorLabel, color))
+		default:
+			out = append(out, obj)
+		}
+	}
+	return encodeManifestObjects(out)
+}
+
+// blueGreenServiceManifest 生成切换流量用的 Service 清单: 选择器命中清单中 Deployment 的 Service 追加颜色标签。
+func blueGreenServiceManifest(objs []*unstructured.Unstructured, color string) (string, error) {
+	templates := make([]map[string]string, 0)
+	for _, obj := range objs {
+		if isManifestDeployment(obj) {
+			labels, _, _ := unstructured.NestedStringMap(obj.Object, "spec", "template", "metadata", "labels")
+			templates = append(templates, labels)
+		}
+	}
+	out := make([]*unstructured.Unstructured, 0)
+	for _, obj := range objs {
+		if !isManifestService(obj) {
+			continue
+		}
+		svc := obj.DeepCopy()
+		selector, _, _ := unstructured.NestedStringMap(svc.Object, "spec", "selector")
+		if len(selector) > 0 && selectorMatchesAny(selector, templates) {
+			selector[strategyColorLabel] = color
+			_ = unstructured.SetNestedStringMap(svc.Object, selector, "spec", "selector")
+		}
+		out = append(out, svc)
+	}
+	return encodeManifestObjects(out)
+}
+
+func selectorMatchesAny(selector map[string]string, candidates []map[string]string) bool {
+	for _, labels := range candidates {
+		matched := true
+		for k, v := range selector {
+			if labels[k] != v {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+func isRolloutWorkloadKind(kind string) bool {
+	switch kind {
+	case "Deployment", "StatefulSet", "DaemonSet":
+		return true
+	default:
+		return false
+	}
+}
+
+// scaleDeployment 调整 Deployment 副本数并返回调整前的副本数; Deployment 不存在时 found 为 false。
+func scaleDeployment(ctx context.Context, cli kubernetes.Interface, namespace, name string, replicas int32) (previous int32, found bool, err error) {
+	obj, err := cli.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	previous = 1
+	if obj.Spec.Replicas != nil {
+		previous = *obj.Spec.Replicas
+	}
+	if previous == replicas {
+		return previous, true, nil
+	}
+	obj.Spec.Replicas = &replicas
+	_, err = cli.AppsV1().Deployments(namespace).Update(ctx, obj, metav1.UpdateOptions{})
+	return previous, true, err
+}
+
+func deleteDeployment(ctx context.Context, cli kubernetes.Interface, namespace, name string) error {
+	err := cli.AppsV1().Deployments(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// activeColor 读取清单中 Service 当前的颜色选择器, 未切换过蓝绿时返回空。
+func activeColor(ctx context.Context, cli kubernetes.Interface, objs []*unstructured.Unstructured) string {
+	for _, obj := range objs {
+		if !isManifestService(obj) {
+			continue
+		}
+		svc, err := cli.CoreV1().Services(manifestNamespace(obj)).Get(ctx, obj.GetName(), metav1.GetOptions{})
+		if err != nil {
+			continue
+		}
+		if color := strings.TrimSpace(svc.Spec.Selector[strategyColorLabel]); color != "" {
+			return color
+		}
+	}
+	return ""
+}
+
+func nextColor(current string) string {
+	if current == "blue" {
+		return "green"
+	}
+	return "blue"
+}
+
+func (l *Logic) strategyRuntimeForTarget(ctx context.Context, target *model.DeploymentTarget) (*strategyRuntime, error) {
+	var cluster model.Cluster
+	if err := l.svcCtx.DB.WithContext(ctx).First(&cluster, target.ClusterID).Error; err != nil {
+		return nil, err
+	}
+	cli, err := rolloutClientForCluster(&cluster)
+	if err != nil {
+		return nil, err
+	}
+	applier, err := dynamicApplierForCluster(&cluster)
+	if err != nil {
+		return nil, err
+	}
+	return &strategyRuntime{applier: applier, cli: cli}, nil
+}
+
+// applyStrategyManifest 以普通发布相同的字段管理者与归属标签下发策略步骤的清单。
+// 中间步骤只包含部分对象, 因此不记录对象清单也不做清理, 由最终的全量应用或流量切换负责。
+func (l *Logic) applyStrategyManifest(ctx context.Context, rt *strategyRuntime, release *model.DeploymentRelease, manifest string) ([]ReleaseInventoryItem, error) {
+	objs, err := decodeManifestObjects(manifest)
+	if err != nil {
+		return nil, err
+	}
+	applied := make([]ReleaseInventoryItem, 0, len(objs))
+	for _, obj := range objs {
+		withOwnershipLabels(obj, release)
+		item, err := rt.applier.Apply(ctx, obj)
+		if err != nil {
+			return applied, fmt.Errorf("apply %s: %w", item.String(), err)
+		}
+		applied = append(applied, item)
+	}
+	return applied, nil
+}
+
+// saveStrategyState 以条件更新写入发布的状态、策略状态与 columns 列出的其他字段 (取 release 上的当前值)。
+// 库中的状态与策略状态须仍为 release 上次读取或写入的值, 暂停、中止等请求已并发修改发布时不写入并返回 false, release 保持原值。
+func (l *Logic) saveStrategyState(ctx context.Context, release *model.DeploymentRelease, status string, state strategyState, columns ...string) bool {
+	prevStatus, prevState := release.Status, release.StrategyStateJSON
+	release.Status, release.StrategyStateJSON = status, toJSON(state)
+	res := l.svcCtx.DB.WithContext(ctx).Model(release).
+		Where("status = ? AND strategy_state_json = ?", prevStatus, prevState).
+		Select(append([]string{"status", "strategy_state_json", "finished_at", "updated_at"}, columns...)).
+		Updates(release)
+	if res.Error == nil && res.RowsAffected > 0 {
+		return true
+	}
+	// MySQL 不把取值未变化的行计入 RowsAffected, 以库中的当前值确认是否已是本次写入的状态。
+	var row model.DeploymentRelease
+	if res.Error == nil && l.svcCtx.DB.WithContext(ctx).Select("status", "strategy_state_json").First(&row, release.ID).Error == nil &&
+		row.Status == release.Status && row.StrategyStateJSON == release.StrategyStateJSON {
+		return true
+	}
+	release.Status, release.StrategyStateJSON = prevStatus, prevState
+	return false
+}
+
+// commitStrategyStep 由执行策略的后台协程写入步骤状态。暂停请求只修改策略状态中的 paused 标记, 遇到时合并后重试;
+// 发布已被中止或转入其他状态时返回 false, 调用方应停止推进。
+func (l *Logic) commitStrategyStep(ctx context.Context, release *model.DeploymentRelease, status string, state *strategyState, columns ...string) bool {
+	for {
+		if l.saveStrategyState(ctx, release, status, *state, columns...) {
+			return true
+		}
+		latest, latestState, err := l.reloadRelease(ctx, release.ID)
+		if err != nil || latest.Status != release.Status || latest.StrategyStateJSON == release.StrategyStateJSON {
+			return false
+		}
+		state.Paused = latestState.Paused
+		release.StrategyStateJSON = latest.StrategyStateJSON
+	}
+}
+
+// haltStrategy 在后台协程的写入被拒绝后停止推进; 发布已被中止时按本协程的状态再次清理,
+// 回收中止请求之后才创建的金丝雀或新颜色资源, 并恢复中止时尚未记录的稳定版本副本数。
+func (l *Logic) haltStrategy(ctx context.Context, releaseID uint, state strategyState, rt *strategyRuntime) error {
+	latest, _, err := l.reloadRelease(ctx, releaseID)
+	if err != nil {
+		return err
+	}
+	if latest.Status == releaseStatusAborted {
+		return l.cleanupStrategy(ctx, state, rt)
+	}
+	return nil
+}
+
+// mutateStrategyRelease 供暂停、推进、中止请求使用: 重新读取发布, 由 apply 修改策略状态并返回新的发布状态后按条件写入,
+// 与后台协程的写入冲突时重新读取并重试。
+func (l *Logic) mutateStrategyRelease(ctx context.Context, id uint, apply func(release *model.DeploymentRelease, state *strategyState) (string, error)) (*model.DeploymentRelease, strategyState, error) {
+	for attempt := 0; attempt < strategyUpdateAttempts; attempt++ {
+		release, state, err := l.loadStrategyRelease(ctx, id)
+		if err != nil {
+			return nil, strategyState{}, err
+		}
+		status, err := apply(release, &state)
+		if err != nil {
+			return nil, strategyState{}, err
+		}
+		if l.saveStrategyState(ctx, release, status, state) {
+			return release, state, nil
+		}
+	}
+	return nil, strategyState{}, fmt.Errorf("release %d was modified concurrently, retry later", id)
+}
+
+// reloadRelease 重新读取发布记录, 用于在长耗时步骤之后感知暂停与中止请求。
+func (l *Logic) reloadRelease(ctx context.Context, id uint) (*model.DeploymentRelease, strategyState, error) {
+	var row model.DeploymentRelease
+	if err := l.svcCtx.DB.WithContext(ctx).First(&row, id).Error; err != nil {
+		return nil, strategyState{}, err
+	}
+	state, err := loadStrategyState(&row)
+	return &row, state, err
+}
+
+// startReleaseStrategy 在 executeRelease 中接管金丝雀/蓝绿发布; 清单中没有 Deployment 时返回 false, 回退为普通发布。
+func (l *Logic) startReleaseStrategy(ctx context.Context, release *model.DeploymentRelease, target *model.DeploymentTarget, rt *strategyRuntime) (bool, error) {
+	state, err := loadStrategyState(release)
+	if err != nil {
+		if state, err = newStrategyState(release.Strategy, nil); err != nil {
+			return false, err
+		}
+	}
+	objs, err := decodeManifestObjects(release.ManifestSnapshot)
+	if err != nil {
+		return false, err
+	}
+	state.Workloads = strategyWorkloadsFromManifest(objs)
+	if len(state.Workloads) == 0 {
+		l.writeReleaseAudit(ctx, release.ID, release.Operator, "release.strategy.fallback", map[string]any{
+			"strategy": release.Strategy, "reason": "manifest has no Deployment",
+		})
+		return false, nil
+	}
+	if state.Strategy == releaseStrategyCanary {
+		if state.EffectiveSteps, err = canaryPlan(state.Steps, state.Workloads); err != nil {
+			return false, err
+		}
+	}
+	state.TimeoutSeconds = int(targetVerifyTimeout(target).Seconds())
+	state.Phase = strategyPhaseProgressing
+	if !l.saveStrategyState(ctx, release, releaseStatusVerifying, state) {
+		return false, fmt.Errorf("release %d was modified concurrently", release.ID)
+	}
+	l.writeReleaseAudit(ctx, release.ID, release.Operator, "release.strategy.started", map[string]any{
+		"strategy": state.Strategy, "plan": strategyPlanMessage(state), "workloads": state.Workloads,
+	})
+	releaseID := release.ID
+	go func() {
+		if err := l.runReleaseStrategy(context.Background(), releaseID, rt); err != nil {
+			if lg := logger.L(); lg != nil {
+				lg.Warn("release strategy step failed", logger.Int("release_id", int(releaseID)), logger.Error(err))
+			}
+		}
+	}()
+	return true, nil
+}
+
+// runReleaseStrategy 执行当前步骤, 直到发布完成、失败、中止或进入暂停。
+func (l *Logic) runReleaseStrategy(ctx context.Context, releaseID uint, rt *strategyRuntime) error {
+	release, state, err := l.reloadRelease(ctx, releaseID)
+	if err != nil {
+		return err
+	}
+	if release.Status != releaseStatusVerifying {
+		return nil
+	}
+	switch state.Strategy {
+	case releaseStrategyCanary:
+		return l.runCanary(ctx, release, state, rt)
+	case releaseStrategyBlueGreen:
+		return l.runBlueGreen(ctx, release, state, rt)
+	default:
+		return fmt.Errorf("unsupported strategy %s", state.Strategy)
+	}
+}
+
+func (l *Logic) runCanary(ctx context.Context, release *model.DeploymentRelease, state strategyState, rt *strategyRuntime) error {
+	objs, err := decodeManifestObjects(release.ManifestSnapshot)
+	if err != nil {
+		return l.failStrategy(ctx, release, state, rt, "canary_manifest_invalid", err)
+	}
+	timeout := time.Duration(state.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = defaultVerifyTimeout
+	}
+	for {
+		state.setStep(state.StepIndex)
+		if !l.commitStrategyStep(ctx, release, releaseStatusVerifying, &state) {
+			return l.haltStrategy(ctx, release.ID, state, rt)
+		}
+		l.writeReleaseAudit(ctx, release.ID, release.Operator, "release.canary.step", map[string]any{
+			"step": state.StepIndex + 1, "steps": len(state.Steps), "weight": state.Weight, "effective_weight": state.EffectiveWeight,
+		})
+		if state.Weight >= 100 {
+			return l.finishCanary(ctx, release, state, rt, timeout)
+		}
+		manifest, err := canaryManifest(objs, state.Weight)
+		if err != nil {
+			return l.failStrategy(ctx, release, state, rt, "canary_manifest_invalid", err)
+		}
+		if _, err := l.applyStrategyManifest(ctx, rt, release, manifest); err != nil {
+			return l.failStrategy(ctx, release, state, rt, "canary_apply_failed", err)
+		}
+		canaries := make([]rolloutWorkload, 0, len(state.Workloads))
+		for i := range state.Workloads {
+			w := &state.Workloads[i]
+			canaryCount := canaryReplicas(w.Replicas, state.Weight)
+			stable := w.Replicas - canaryCount
+			if stable < 0 {
+				stable = 0
+			}
+			previous, found, err := scaleDeployment(ctx, rt.cli, w.Namespace, w.Name, stable)
+			if err != nil {
+				return l.failStrategy(ctx, release, state, rt, "canary_scale_failed", err)
+			}
+			if found && !w.HasStable {
+				w.HasStable = true
+				w.StableReplicas = previous
+			}
+			canaries = append(canaries, rolloutWorkload{Kind: "Deployment", Namespace: w.Namespace, Name: w.Name + "-canary"})
+		}
+		if !l.commitStrategyStep(ctx, release, releaseStatusVerifying, &state) {
+			return l.haltStrategy(ctx, release.ID, state, rt)
+		}
+
+		verifyCtx, cancel := context.WithTimeout(ctx, timeout)
+		results := (&rolloutVerifier{cli: rt.cli}).Verify(verifyCtx, canaries)
+		cancel()
+		for _, item := range results {
+			if !item.Ready {
+				return l.failStrategy(ctx, release, state, rt, "canary_unhealthy", fmt.Errorf("%s %s/%s: %s", item.Kind, item.Namespace, item.Name, item.Message))
+			}
+		}
+		l.writeReleaseAudit(ctx, release.ID, release.Operator, "release.canary.step_ready", map[string]any{
+			"step": state.StepIndex + 1, "weight": state.Weight, "workloads": results,
+		})
+
+		latest, latestState, err := l.reloadRelease(ctx, release.ID)
+		if err != nil {
+			return err
+		}
+		if latest.Status == releaseStatusAborted {
+			// 中止请求与本步骤并发执行时, 再次清理以防本步骤重新创建了金丝雀。
+			return l.cleanupCanary(ctx, latestState, rt)
+		}
+		if latestState.Paused || state.IntervalSeconds <= 0 {
+			return l.pauseStrategy(ctx, latest, latestState, "awaiting_promote")
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(state.IntervalSeconds) * time.Second):
+		}
+		latest, latestState, err = l.reloadRelease(ctx, release.ID)
+		if err != nil {
+			return err
+		}
+		if latest.Status == releaseStatusAborted {
+			return l.cleanupCanary(ctx, latestState, rt)
+		}
+		if latest.Status != releaseStatusVerifying {
+			return nil
+		}
+		if latestState.Paused {
+			return l.pauseStrategy(ctx, latest, latestState, "pause_requested")
+		}
+		release, state = latest, latestState
+		state.StepIndex++
+		l.writeReleaseAudit(ctx, release.ID, release.Operator, "release.canary.promoted", map[string]any{
+			"auto": true, "weight": state.Steps[state.StepIndex],
+		})
+	}
+}
+
+// finishCanary 将原始清单全量应用到稳定版本, 删除金丝雀 Deployment 后按 rollout 验证收尾。
+// 全量应用与滚动发布走同一路径, 记录对象清单并清理上一次发布遗留的对象。
+func (l *Logic) finishCanary(ctx context.Context, release *model.DeploymentRelease, state strategyState, rt *strategyRuntime, timeout time.Duration) error {
+	if err := l.applyReleaseManifest(ctx, rt.applier, release, release.ManifestSnapshot); err != nil {
+		return l.failStrategy(ctx, release, state, rt, "canary_promote_failed", err)
+	}
+	for _, w := range state.Workloads {
+		if err := deleteDeployment(ctx, rt.cli, w.Namespace, w.Name+"-canary"); err != nil {
+			l.writeReleaseAudit(ctx, release.ID, release.Operator, "release.canary.cleanup_failed", map[string]any{"workload": w.Name, "error": err.Error()})
+		}
+	}
+	state.Phase = strategyPhaseCompleted
+	if !l.commitStrategyStep(ctx, release, releaseStatusVerifying, &state, "inventory_json") {
+		return l.haltStrategy(ctx, release.ID, state, rt)
+	}
+	workloads, err := extractRolloutWorkloads(release.ManifestSnapshot)
+	if err != nil {
+		return l.failStrategy(ctx, release, state, rt, "canary_manifest_invalid", err)
+	}
+	if err := l.verifyRelease(ctx, release, rt.cli, workloads, timeout); err != nil {
+		if release.Status == releaseStatusFailed {
+			state.Phase = strategyPhaseFailed
+			l.saveStrategyState(ctx, release, releaseStatusFailed, state)
+		}
+		return err
+	}
+	return nil
+}
+
+func (l *Logic) cleanupCanary(ctx context.Context, state strategyState, rt *strategyRuntime) error {
+	var firstErr error
+	for _, w := range state.Workloads {
+		if err := deleteDeployment(ctx, rt.cli, w.Namespace, w.Name+"-canary"); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		if !w.HasStable {
+			continue
+		}
+		if _, _, err := scaleDeployment(ctx, rt.cli, w.Namespace, w.Name, w.StableReplicas); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (l *Logic) runBlueGreen(ctx context.Context, release *model.DeploymentRelease, state strategyState, rt *strategyRuntime) error {
+	objs, err := decodeManifestObjects(release.ManifestSnapshot)
+	if err != nil {
+		return l.failStrategy(ctx, release, state, rt, "bluegreen_manifest_invalid", err)
+	}
+	if state.Color == "" {
+		state.PreviousColor = activeColor(ctx, rt.cli, objs)
+		state.Color = nextColor(state.PreviousColor)
+	}
+	if !l.commitStrategyStep(ctx, release, releaseStatusVerifying, &state) {
+		return l.haltStrategy(ctx, release.ID, state, rt)
+	}
+	l.writeReleaseAudit(ctx, release.ID, release.Operator, "release.bluegreen.deploying", map[string]any{
+		"color": state.Color, "previous_color": defaultIfEmpty(state.PreviousColor, "none"),
+	})
+	manifest, err := blueGreenManifest(objs, state.Color)
+	if err != nil {
+		return l.failStrategy(ctx, release, state, rt, "bluegreen_manifest_invalid", err)
+	}
+	if _, err := l.applyStrategyManifest(ctx, rt, release, manifest); err != nil {
+		return l.failStrategy(ctx, release, state, rt, "bluegreen_apply_failed", err)
+	}
+	colored := make([]rolloutWorkload, 0, len(state.Workloads))
+	for _, w := range state.Workloads {
+		colored = append(colored, rolloutWorkload{Kind: "Deployment", Namespace: w.Namespace, Name: w.Name + "-" + state.Color})
+	}
+	timeout := time.Duration(state.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = defaultVerifyTimeout
+	}
+	verifyCtx, cancel := context.WithTimeout(ctx, timeout)
+	results := (&rolloutVerifier{cli: rt.cli}).Verify(verifyCtx, colored)
+	cancel()
+	for _, item := range results {
+		if !item.Ready {
+			return l.failStrategy(ctx, release, state, rt, "bluegreen_unhealthy", fmt.Errorf("%s %s/%s: %s", item.Kind, item.Namespace, item.Name, item.Message))
+		}
+	}
+	l.writeReleaseAudit(ctx, release.ID, release.Operator, "release.bluegreen.color_ready", map[string]any{
+		"color": state.Color, "workloads": results,
+	})
+
+	latest, latestState, err := l.reloadRelease(ctx, release.ID)
+	if err != nil {
+		return err
+	}
+	if latest.Status == releaseStatusAborted {
+		return l.cleanupBlueGreen(ctx, latestState, rt)
+	}
+	if !latestState.AutoSwitch || latestState.Paused {
+		return l.pauseStrategy(ctx, latest, latestState, "awaiting_switch")
+	}
+	return l.switchBlueGreen(ctx, latest, latestState, rt)
+}
+
+// switchBlueGreen 把 Service 选择器切到新颜色, 并将旧颜色 (或首次蓝绿前的原 Deployment) 缩容到 0 以便快速回切。
+func (l *Logic) switchBlueGreen(ctx context.Context, release *model.DeploymentRelease, state strategyState, rt *strategyRuntime) error {
+	objs, err := decodeManifestObjects(release.ManifestSnapshot)
+	if err != nil {
+		return l.failStrategy(ctx, release, state, rt, "bluegreen_manifest_invalid", err)
+	}
+	manifest, err := blueGreenServiceManifest(objs, state.Color)
+	if err != nil {
+		return l.failStrategy(ctx, release, state, rt, "bluegreen_manifest_invalid", err)
+	}
+	colored, err := blueGreenManifest(objs, state.Color)
+	if err != nil {
+		return l.failStrategy(ctx, release, state, rt, "bluegreen_manifest_invalid", err)
+	}
+	inventory, err := manifestInventory(colored)
+	if err != nil {
+		return l.failStrategy(ctx, release, state, rt, "bluegreen_manifest_invalid", err)
+	}
+	if strings.TrimSpace(manifest) != "" {
+		services, err := l.applyStrategyManifest(ctx, rt, release, manifest)
+		if err != nil {
+			return l.failStrategy(ctx, release, state, rt, "bluegreen_switch_failed", err)
+		}
+		inventory = append(inventory, services...)
+	}
+	// 切换后新颜色成为当前版本, 记录对象清单供后续发布清理与漂移检测使用; 旧颜色保留为 0 副本以便快速回切, 不做清理。
+	release.InventoryJSON = toJSON(inventory)
+	state.Switched = true
+	l.writeReleaseAudit(ctx, release.ID, release.Operator, "release.bluegreen.switched", map[string]any{
+		"color": state.Color, "previous_color": defaultIfEmpty(state.PreviousColor, "none"),
+	})
+	for _, w := range state.Workloads {
+		previous := w.Name
+		if state.PreviousColor != "" {
+			previous = w.Name + "-" + state.PreviousColor
+		}
+		if _, _, err := scaleDeployment(ctx, rt.cli, w.Namespace, previous, 0); err != nil {
+			l.writeReleaseAudit(ctx, release.ID, release.Operator, "release.bluegreen.scale_down_failed", map[string]any{"workload": previous, "error": err.Error()})
+		}
+	}
+	state.Phase = strategyPhaseCompleted
+	state.Paused = false
+	if err := l.runReleaseHooks(ctx, release, hookPhasePost); err != nil {
+		return err
+	}
+	release.VerificationJSON = toJSON(map[string]any{
+		"runtime":        "k8s",
+		"checks":         []string{"apply_succeeded", "rollout_status", "traffic_switched"},
+		"passed":         true,
+		"strategy":       releaseStrategyBlueGreen,
+		"active_color":   state.Color,
+		"previous_color": state.PreviousColor,
+	})
+	if !l.commitStrategyStep(ctx, release, releaseStatusApplied, &state, "inventory_json", "verification_json") {
+		return l.haltStrategy(ctx, release.ID, state, rt)
+	}
+	l.writeReleaseAudit(ctx, release.ID, release.Operator, "release.applied", map[string]any{"runtime": "k8s", "strategy": releaseStrategyBlueGreen})
+	return nil
+}
+
+func (l *Logic) cleanupBlueGreen(ctx context.Context, state strategyState, rt *strategyRuntime) error {
+	if state.Switched || state.Color == "" {
+		return nil
+	}
+	var firstErr error
+	for _, w := range state.Workloads {
+		if err := deleteDeployment(ctx, rt.cli, w.Namespace, w.Name+"-"+state.Color); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// clearBlueGreen 在非蓝绿发布就绪后收回此前蓝绿发布留下的 <name>-blue/<name>-green Deployment。
+// 服务端应用的 Service 清单不含颜色标签, 由 OpsPilot 字段管理者持有的颜色选择器随之移除,
+// 若不同时删除颜色 Deployment, Service 会把流量同时分给旧颜色与新版本 Pod。
+func (l *Logic) clearBlueGreen(ctx context.Context, release *model.DeploymentRelease, cli kubernetes.Interface) {
+	objs, err := decodeManifestObjects(release.ManifestSnapshot)
+	if err != nil {
+		return
+	}
+	cleared := make([]string, 0)
+	for _, w := range strategyWorkloadsFromManifest(objs) {
+		for _, color := range []string{"blue", "green"} {
+			name := w.Name + "-" + color
+			if _, err := cli.AppsV1().Deployments(w.Namespace).Get(ctx, name, metav1.GetOptions{}); err != nil {
+				continue
+			}
+			if err := deleteDeployment(ctx, cli, w.Namespace, name); err != nil {
+				l.writeReleaseAudit(ctx, release.ID, release.Operator, "release.bluegreen.cleanup_failed", map[string]any{"workload": name, "error": err.Error()})
+				continue
+			}
+			cleared = append(cleared, w.Namespace+"/"+name)
+		}
+	}
+	if len(cleared) > 0 {
+		l.writeReleaseAudit(ctx, release.ID, release.Operator, "release.bluegreen.cleared", map[string]any{"strategy": defaultIfEmpty(release.Strategy, releaseStrategyRolling), "deployments": cleared})
+	}
+}
+
+func (l *Logic) cleanupStrategy(ctx context.Context, state strategyState, rt *strategyRuntime) error {
+	if state.Strategy == releaseStrategyBlueGreen {
+		return l.cleanupBlueGreen(ctx, state, rt)
+	}
+	return l.cleanupCanary(ctx, state, rt)
+}
+
+func (l *Logic) pauseStrategy(ctx context.Context, release *model.DeploymentRelease, state strategyState, reason string) error {
+	state.Phase = strategyPhasePaused
+	state.Paused = true
+	if !l.commitStrategyStep(ctx, release, releaseStatusPaused, &state) {
+		return nil
+	}
+	l.writeReleaseAudit(ctx, release.ID, release.Operator, "release.strategy.paused", map[string]any{
+		"strategy": state.Strategy, "reason": reason, "step": state.StepIndex + 1, "weight": state.Weight, "effective_weight": state.EffectiveWeight, "color": state.Color,
+	})
+	return nil
+}
+
+// failStrategy 清理本次发布创建的金丝雀/新颜色资源, 让流量回到原版本, 并记录诊断。
+func (l *Logic) failStrategy(ctx context.Context, release *model.DeploymentRelease, state strategyState, rt *strategyRuntime, code string, cause error) error {
+	cleanupErr := l.cleanupStrategy(ctx, state, rt)
+	state.Phase = strategyPhaseFailed
+	diagnostics := []releaseDiagnostic{{
+		Runtime: "k8s", Stage: "strategy", Code: code, Message: truncateText(cause.Error(), 500),
+		Summary: fmt.Sprintf("%s release failed at step %d, traffic restored to previous version", state.Strategy, state.StepIndex+1),
+	}}
+	if cleanupErr != nil {
+		diagnostics = append(diagnostics, releaseDiagnostic{
+			Runtime: "k8s", Stage: "strategy", Code: "strategy_cleanup_failed", Message: truncateText(cleanupErr.Error(), 500), Summary: "manual cleanup of strategy resources required",
+		})
+	}
+	release.DiagnosticsJSON = toJSON(diagnostics)
+	if !l.commitStrategyStep(ctx, release, releaseStatusFailed, &state, "diagnostics_json") {
+		return cause
+	}
+	l.writeReleaseAudit(ctx, release.ID, release.Operator, "release.failed", map[string]any{"reason": code, "strategy": state.Strategy})
+	return cause
+}
+
+func (l *Logic) loadStrategyRelease(ctx context.Context, id uint) (*model.DeploymentRelease, strategyState, error) {
+	release, state, err := l.reloadRelease(ctx, id)
+	if err != nil {
+		return nil, strategyState{}, err
+	}
+	if !isProgressiveStrategy(release.Strategy) {
+		return nil, strategyState{}, fmt.Errorf("release %d uses %s strategy", release.ID, defaultIfEmpty(release.Strategy, releaseStrategyRolling))
+	}
+	return release, state, nil
+}
+
+// PauseRelease 请求暂停金丝雀/蓝绿发布, 正在执行的步骤完成后停在当前流量比例。
+func (l *Logic) PauseRelease(ctx context.Context, id uint, uid uint64, comment string) (ReleaseApplyResp, error) {
+	release, _, err := l.mutateStrategyRelease(ctx, id, func(release *model.DeploymentRelease, state *strategyState) (string, error) {
+		if release.Status != releaseStatusVerifying && release.Status != releaseStatusPaused {
+			return "", fmt.Errorf("release state %s cannot be paused", release.Status)
+		}
+		state.Paused = true
+		return release.Status, nil
+	})
+	if err != nil {
+		return ReleaseApplyResp{}, err
+	}
+	l.writeReleaseAudit(ctx, release.ID, uint(uid), "release.strategy.pause_requested", map[string]any{"comment": strings.TrimSpace(comment)})
+	return l.strategyResp(release), nil
+}
+
+// PromoteRelease 推进已暂停的发布: 金丝雀进入下一个流量步骤, 蓝绿切换 Service 到新颜色。
+func (l *Logic) PromoteRelease(ctx context.Context, id uint, uid uint64, comment string) (ReleaseApplyResp, error) {
+	release, _, err := l.loadStrategyRelease(ctx, id)
+	if err != nil {
+		return ReleaseApplyResp{}, err
+	}
+	var target model.DeploymentTarget
+	if err := l.svcCtx.DB.WithContext(ctx).First(&target, release.TargetID).Error; err != nil {
+		return ReleaseApplyResp{}, err
+	}
+	rt, err := l.strategyRuntimeForTarget(ctx, &target)
+	if err != nil {
+		return ReleaseApplyResp{}, err
+	}
+	release, err = l.promoteRelease(ctx, id, uid, comment, rt, true)
+	if err != nil {
+		return ReleaseApplyResp{}, err
+	}
+	return l.strategyResp(release), nil
+}
+
+func (l *Logic) promoteRelease(ctx context.Context, id uint, uid uint64, comment string, rt *strategyRuntime, async bool) (*model.DeploymentRelease, error) {
+	release, state, err := l.mutateStrategyRelease(ctx, id, func(release *model.DeploymentRelease, state *strategyState) (string, error) {
+		if release.Status != releaseStatusPaused {
+			return "", fmt.Errorf("release state %s cannot be promoted", release.Status)
+		}
+		if state.Strategy != releaseStrategyBlueGreen {
+			if state.StepIndex+1 >= len(state.Steps) {
+				return "", fmt.Errorf("canary release has no remaining steps")
+			}
+			state.setStep(state.StepIndex + 1)
+		}
+		state.Paused = false
+		state.Phase = strategyPhaseProgressing
+		return releaseStatusVerifying, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if state.Strategy == releaseStrategyBlueGreen {
+		l.writeReleaseAudit(ctx, release.ID, uint(uid), "release.bluegreen.promoted", map[string]any{"color": state.Color, "comment": strings.TrimSpace(comment)})
+		if err := l.switchBlueGreen(ctx, release, state, rt); err != nil {
+			return release, err
+		}
+		return release, nil
+	}
+	l.writeReleaseAudit(ctx, release.ID, uint(uid), "release.canary.promoted", map[string]any{"weight": state.Weight, "effective_weight": state.EffectiveWeight, "comment": strings.TrimSpace(comment)})
+	run := func() error { return l.runReleaseStrategy(context.Background(), release.ID, rt) }
+	if !async {
+		if err := run(); err != nil {
+			return release, err
+		}
+		latest, _, err := l.reloadRelease(ctx, release.ID)
+		return latest, err
+	}
+	go func() {
+		if err := run(); err != nil {
+			if lg := logger.L(); lg != nil {
+				lg.Warn("release strategy step failed", logger.Int("release_id", int(release.ID)), logger.Error(err))
+			}
+		}
+	}()
+	return release, nil
+}
+
+// AbortRelease 中止金丝雀/蓝绿发布, 删除新版本资源并恢复原版本的副本数与流量。
+func (l *Logic) AbortRelease(ctx context.Context, id uint, uid uint64, comment string) (ReleaseApplyResp, error) {
+	release, _, err := l.loadStrategyRelease(ctx, id)
+	if err != nil {
+		return ReleaseApplyResp{}, err
+	}
+	var target model.DeploymentTarget
+	if err := l.svcCtx.DB.WithContext(ctx).First(&target, release.TargetID).Error; err != nil {
+		return ReleaseApplyResp{}, err
+	}
+	rt, err := l.strategyRuntimeForTarget(ctx, &target)
+	if err != nil {
+		return ReleaseApplyResp{}, err
+	}
+	release, err = l.abortRelease(ctx, id, uid, comment, rt)
+	if err != nil {
+		return ReleaseApplyResp{}, err
+	}
+	l.settleReleaseLock(ctx, release)
+	return l.strategyResp(release), nil
+}
+
+func (l *Logic) abortRelease(ctx context.Context, id uint, uid uint64, comment string, rt *strategyRuntime) (*model.DeploymentRelease, error) {
+	// 先落库中止状态, 后台步骤的下一次写入因此失败并停止推进。
+	release, state, err := l.mutateStrategyRelease(ctx, id, func(release *model.DeploymentRelease, state *strategyState) (string, error) {
+		if release.Status != releaseStatusVerifying && release.Status != releaseStatusPaused {
+			return "", fmt.Errorf("release state %s cannot be aborted", release.Status)
+		}
+		state.Phase = strategyPhaseAborted
+		return releaseStatusAborted, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	cleanupErr := l.cleanupStrategy(ctx, state, rt)
+	detail := map[string]any{"strategy": state.Strategy, "weight": state.Weight, "color": state.Color, "comment": strings.TrimSpace(comment)}
+	if cleanupErr != nil {
+		detail["cleanup_error"] = cleanupErr.Error()
+		release.DiagnosticsJSON = toJSON([]releaseDiagnostic{{
+			Runtime: "k8s", Stage: "strategy", Code: "strategy_cleanup_failed", Message: truncateText(cleanupErr.Error(), 500), Summary: "manual cleanup of strategy resources required",
+		}})
+		_ = l.svcCtx.DB.WithContext(ctx).Model(release).Update("diagnostics_json", release.DiagnosticsJSON).Error
+	}
+	l.writeReleaseAudit(ctx, release.ID, uint(uid), "release.strategy.aborted", detail)
+	return release, cleanupErr
+}
+
+func (l *Logic) strategyResp(release *model.DeploymentRelease) ReleaseApplyResp {
+	return ReleaseApplyResp{
+		ReleaseID:        release.ID,
+		UnifiedReleaseID: release.ID,
+		Status:           release.Status,
+		RuntimeType:      release.RuntimeType,
+		TriggerSource:    release.TriggerSource,
+		CIRunID:          release.CIRunID,
+		LifecycleState:   l.releaseLifecycleState(release.Status),
+	}
+}
@@ -0,0 +1,605 @@
+package deployment
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cy77cc/OpsPilot/internal/model"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const strategyTestManifest = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 4
+  selector:
+    matchLabels:
+      app: web
+  template:
+    metadata:
+      labels:
+        app: web
+    spec:
+      containers:
+      - name: web
+        image: nginx:1.27
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+spec:
+  selector:
+    app: web
+  ports:
+  - port: 80
+`
+
+// fakeStrategyApply 把清单写入 fake clientset, 并模拟控制器把 Deployment 状态置为就绪。
+func fakeStrategyApply(t *testing.T, cli kubernetes.Interface) func(ctx context.Context, manifest string) error {
+	return func(ctx context.Context, manifest string) error {
+		objs, err := decodeManifestObjects(manifest)
+		if err != nil {
+			return err
+		}
+		for _, obj := range objs {
+			switch {
+			case isManifestDeployment(obj):
+				var d appsv1.Deployment
+				if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &d); err != nil {
+					return err
+				}
+				d.Namespace = manifestNamespace(obj)
+				replicas := int32(1)
+				if d.Spec.Replicas != nil {
+					replicas = *d.Spec.Replicas
+				}
+				d.Status = appsv1.DeploymentStatus{Replicas: replicas, UpdatedReplicas: replicas, ReadyReplicas: replicas, AvailableReplicas: replicas}
+				if _, err := cli.AppsV1().Deployments(d.Namespace).Create(ctx, &d, metav1.CreateOptions{}); apierrors.IsAlreadyExists(err) {
+					_, err = cli.AppsV1().Deployments(d.Namespace).Update(ctx, &d, metav1.UpdateOptions{})
+					if err != nil {
+						return err
+					}
+				} else if err != nil {
+					return err
+				}
+			case isManifestService(obj):
+				var svc corev1.Service
+				if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &svc); err != nil {
+					return err
+				}
+				svc.Namespace = manifestNamespace(obj)
+				if _, err := cli.CoreV1().Services(svc.Namespace).Create(ctx, &svc, metav1.CreateOptions{}); apierrors.IsAlreadyExists(err) {
+					if _, err := cli.CoreV1().Services(svc.Namespace).Update(ctx, &svc, metav1.UpdateOptions{}); err != nil {
+						return err
+					}
+				} else if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// strategyTestApplier 把对象写入 fake clientset, 同时保留应用过的对象供断言归属标签与清理。
+type strategyTestApplier struct {
+	*fakeApplier
+	apply func(ctx context.Context, manifest string) error
+}
+
+func (a *strategyTestApplier) Apply(ctx context.Context, obj *unstructured.Unstructured) (ReleaseInventoryItem, error) {
+	manifest, err := encodeManifestObjects([]*unstructured.Unstructured{obj})
+	if err != nil {
+		return inventoryItemFromObject(obj), err
+	}
+	if err := a.apply(ctx, manifest); err != nil {
+		return inventoryItemFromObject(obj), err
+	}
+	return a.fakeApplier.Apply(ctx, obj)
+}
+
+func newStrategyTestRuntime(t *testing.T, cli kubernetes.Interface) (*strategyRuntime, *strategyTestApplier) {
+	applier := &strategyTestApplier{fakeApplier: newFakeApplier(), apply: fakeStrategyApply(t, cli)}
+	return &strategyRuntime{applier: applier, cli: cli}, applier
+}
+
+func newStrategyTestRelease(t *testing.T, s *releaseTestSuite, strategy string, cfg map[string]any) *model.DeploymentRelease {
+	t.Helper()
+	state, err := newStrategyState(strategy, cfg)
+	if err != nil {
+		t.Fatalf("new strategy state: %v", err)
+	}
+	objs, err := decodeManifestObjects(strategyTestManifest)
+	if err != nil {
+		t.Fatalf("decode manifest: %v", err)
+	}
+	state.Workloads = strategyWorkloadsFromManifest(objs)
+	state.TimeoutSeconds = 1
+	release := s.createTestRelease(t, 1, 1, releaseStatusVerifying)
+	release.Strategy = strategy
+	release.ManifestSnapshot = strategyTestManifest
+	release.StrategyStateJSON = toJSON(state)
+	if err := s.db.Save(release).Error; err != nil {
+		t.Fatalf("save release: %v", err)
+	}
+	return release
+}
+
+func stableWebDeployment(replicas int32) *appsv1.Deployment {
+	d := readyDeployment("web")
+	d.Spec.Replicas = int32Ptr(replicas)
+	d.Status.Replicas = replicas
+	d.Status.UpdatedReplicas = replicas
+	d.Status.ReadyReplicas = replicas
+	d.Status.AvailableReplicas = replicas
+	return d
+}
+
+func deploymentReplicas(t *testing.T, cli kubernetes.Interface, name string) int32 {
+	t.Helper()
+	d, err := cli.AppsV1().Deployments("default").Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get deployment %s: %v", name, err)
+	}
+	return *d.Spec.Replicas
+}
+
+func TestNewStrategyState(t *testing.T) {
+	state, err := newStrategyState(releaseStrategyCanary, map[string]any{"traffic_percent": 10, "steps": []int{50}})
+	if err != nil {
+		t.Fatalf("canary state: %v", err)
+	}
+	if len(state.Steps) != 3 || state.Steps[0] != 10 || state.Steps[1] != 50 || state.Steps[2] != 100 {
+		t.Fatalf("unexpected canary steps: %v", state.Steps)
+	}
+	if _, err := newStrategyState(releaseStrategyCanary, map[string]any{"steps": []int{50, 20}}); err == nil {
+		t.Fatal("expected error for decreasing steps")
+	}
+	if _, err := newStrategyState(releaseStrategyCanary, map[string]any{"steps": []int{150}}); err == nil {
+		t.Fatal("expected error for step above 100")
+	}
+	bg, err := newStrategyState(releaseStrategyBlueGreen, nil)
+	if err != nil {
+		t.Fatalf("blue-green state: %v", err)
+	}
+	if !bg.AutoSwitch {
+		t.Fatal("expected blue-green to auto switch by default")
+	}
+	bg, _ = newStrategyState(releaseStrategyBlueGreen, map[string]any{"auto_switch": false})
+	if bg.AutoSwitch {
+		t.Fatal("expected auto_switch=false to be honored")
+	}
+}
+
+func TestCanaryReplicas(t *testing.T) {
+	cases := []struct {
+		total  int32
+		weight int
+		want   int32
+	}{
+		{total: 4, weight: 25, want: 1},
+		{total: 4, weight: 10, want: 1},
+		{total: 4, weight: 50, want: 2},
+		{total: 10, weight: 33, want: 4},
+		{total: 3, weight: 100, want: 3},
+		{total: 0, weight: 10, want: 1},
+	}
+	for _, tc := range cases {
+		if got := canaryReplicas(tc.total, tc.weight); got != tc.want {
+			t.Fatalf("canaryReplicas(%d, %d) = %d, want %d", tc.total, tc.weight, got, tc.want)
+		}
+	}
+}
+
+func TestCanaryPlan(t *testing.T) {
+	web := []strategyWorkload{{Namespace: "default", Name: "web", Replicas: 4}}
+	got, err := canaryPlan([]int{10, 50, 100}, web)
+	if err != nil {
+		t.Fatalf("plan canary: %v", err)
+	}
+	if want := []int{25, 50, 100}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected effective steps %v, got %v", want, got)
+	}
+
+	single := []strategyWorkload{{Namespace: "default", Name: "web", Replicas: 1}}
+	if _, err := canaryPlan([]int{10, 100}, single); err == nil || !strings.Contains(err.Error(), "all 1 replica(s)") {
+		t.Fatalf("expected single replica 10%% step to be rejected, got %v", err)
+	}
+	if _, err := canaryPlan([]int{100}, single); err != nil {
+		t.Fatalf("expected 100%% step to be allowed, got %v", err)
+	}
+}
+
+func TestCanaryReleasePausesAndPromotes(t *testing.T) {
+	s := newReleaseTestSuite(t)
+	ctx := context.Background()
+	cli := fake.NewSimpleClientset(stableWebDeployment(4))
+	rt, applier := newStrategyTestRuntime(t, cli)
+	release := newStrategyTestRelease(t, s, releaseStrategyCanary, map[string]any{"steps": []int{25}})
+
+	if err := s.logic.runReleaseStrategy(ctx, release.ID, rt); err != nil {
+		t.Fatalf("run canary step: %v", err)
+	}
+	row, state, err := s.logic.reloadRelease(ctx, release.ID)
+	if err != nil {
+		t.Fatalf("reload release: %v", err)
+	}
+	if row.Status != releaseStatusPaused || state.Weight != 25 {
+		t.Fatalf("expected paused at 25%%, got status=%s weight=%d", row.Status, state.Weight)
+	}
+	if got := deploymentReplicas(t, cli, "web-canary"); got != 1 {
+		t.Fatalf("expected 1 canary replica, got %d", got)
+	}
+	if got := deploymentReplicas(t, cli, "web"); got != 3 {
+		t.Fatalf("expected stable scaled to 3, got %d", got)
+	}
+
+	row, err = s.logic.promoteRelease(ctx, release.ID, 1, "looks good", rt, false)
+	if err != nil {
+		t.Fatalf("promote release: %v", err)
+	}
+	if row.Status != releaseStatusApplied {
+		t.Fatalf("expected applied after final step, got %s", row.Status)
+	}
+	if _, err := cli.AppsV1().Deployments("default").Get(ctx, "web-canary", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected canary deployment to be removed, got %v", err)
+	}
+	if got := deploymentReplicas(t, cli, "web"); got != 4 {
+		t.Fatalf("expected stable back to 4 replicas, got %d", got)
+	}
+	inventory := map[string]bool{}
+	for _, item := range parseInventory(row.InventoryJSON) {
+		inventory[item.String()] = true
+	}
+	if len(inventory) != 2 || !inventory["Deployment/default/web"] || !inventory["Service/default/web"] {
+		t.Fatalf("expected promote to record the full manifest inventory, got %s", row.InventoryJSON)
+	}
+	canary, err := applier.Get(ctx, ReleaseInventoryItem{Group: "apps", Version: "v1", Kind: "Deployment", Namespace: "default", Name: "web-canary"})
+	if err != nil {
+		t.Fatalf("get applied canary: %v", err)
+	}
+	if !ownedByRelease(canary, row) {
+		t.Fatalf("expected canary deployment to carry ownership labels, got %v", canary.GetLabels())
+	}
+
+	var actions []string
+	s.db.Model(&model.DeploymentReleaseAudit{}).Where("release_id = ?", release.ID).Order("id ASC").Pluck("action", &actions)
+	want := []string{"release.canary.step", "release.canary.step_ready", "release.strategy.paused", "release.canary.promoted", "release.canary.step", "release.verified", "release.applied"}
+	if len(actions) != len(want) {
+		t.Fatalf("unexpected timeline: %v", actions)
+	}
+	for i := range want {
+		if actions[i] != want[i] {
+			t.Fatalf("timeline[%d] = %s, want %s (all: %v)", i, actions[i], want[i], actions)
+		}
+	}
+}
+
+func TestCanaryReleaseAbortRestoresStable(t *testing.T) {
+	s := newReleaseTestSuite(t)
+	ctx := context.Background()
+	cli := fake.NewSimpleClientset(stableWebDeployment(4))
+	rt, _ := newStrategyTestRuntime(t, cli)
+	release := newStrategyTestRelease(t, s, releaseStrategyCanary, map[string]any{"steps": []int{50}})
+
+	if err := s.logic.runReleaseStrategy(ctx, release.ID, rt); err != nil {
+		t.Fatalf("run canary step: %v", err)
+	}
+	row, err := s.logic.abortRelease(ctx, release.ID, 1, "error rate up", rt)
+	if err != nil {
+		t.Fatalf("abort release: %v", err)
+	}
+	if row.Status != releaseStatusAborted {
+		t.Fatalf("expected aborted, got %s", row.Status)
+	}
+	if _, err := cli.AppsV1().Deployments("default").Get(ctx, "web-canary", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected canary deployment to be removed, got %v", err)
+	}
+	if got := deploymentReplicas(t, cli, "web"); got != 4 {
+		t.Fatalf("expected stable restored to 4 replicas, got %d", got)
+	}
+	if _, err := s.logic.promoteRelease(ctx, release.ID, 1, "", rt, false); err == nil {
+		t.Fatal("expected aborted release to reject promote")
+	}
+}
+
+func TestCanaryStepKeepsConcurrentPauseAndAbort(t *testing.T) {
+	s := newReleaseTestSuite(t)
+	ctx := context.Background()
+
+	// 步骤执行期间的暂停请求不会被步骤的写入覆盖; 未暂停时会等待 60 秒后自动推进。
+	cli := fake.NewSimpleClientset(stableWebDeployment(4))
+	rt, applier := newStrategyTestRuntime(t, cli)
+	release := newStrategyTestRelease(t, s, releaseStrategyCanary, map[string]any{"steps": []int{25}, "interval_seconds": 60})
+	apply := applier.apply
+	applier.apply = func(ctx context.Context, manifest string) error {
+		applier.apply = apply
+		if _, err := s.logic.PauseRelease(ctx, release.ID, 1, "hold"); err != nil {
+			t.Fatalf("pause release: %v", err)
+		}
+		return apply(ctx, manifest)
+	}
+	if err := s.logic.runReleaseStrategy(ctx, release.ID, rt); err != nil {
+		t.Fatalf("run canary step: %v", err)
+	}
+	row, state, _ := s.logic.reloadRelease(ctx, release.ID)
+	if row.Status != releaseStatusPaused || !state.Paused || state.Weight != 25 {
+		t.Fatalf("expected pause request to survive the step, got status=%s state=%+v", row.Status, state)
+	}
+
+	// 步骤执行期间中止: 发布保持 aborted, 步骤随后创建的金丝雀被清理, 稳定版本恢复副本数。
+	cli = fake.NewSimpleClientset(stableWebDeployment(4))
+	rt, applier = newStrategyTestRuntime(t, cli)
+	release = newStrategyTestRelease(t, s, releaseStrategyCanary, map[string]any{"steps": []int{50}})
+	apply = applier.apply
+	applier.apply = func(ctx context.Context, manifest string) error {
+		applier.apply = apply
+		if _, err := s.logic.abortRelease(ctx, release.ID, 1, "stop", rt); err != nil {
+			t.Fatalf("abort release: %v", err)
+		}
+		return apply(ctx, manifest)
+	}
+	if err := s.logic.runReleaseStrategy(ctx, release.ID, rt); err != nil {
+		t.Fatalf("run canary step: %v", err)
+	}
+	row, _, _ = s.logic.reloadRelease(ctx, release.ID)
+	if row.Status != releaseStatusAborted {
+		t.Fatalf("expected release to stay aborted, got %s", row.Status)
+	}
+	if _, err := cli.AppsV1().Deployments("default").Get(ctx, "web-canary", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected canary created after abort to be removed, got %v", err)
+	}
+	if got := deploymentReplicas(t, cli, "web"); got != 4 {
+		t.Fatalf("expected stable restored to 4 replicas, got %d", got)
+	}
+}
+
+func TestVerifyReleaseDoesNotOverwriteAbort(t *testing.T) {
+	s := newReleaseTestSuite(t)
+	ctx := context.Background()
+	cli := fake.NewSimpleClientset(stableWebDeployment(4))
+	release := s.createTestRelease(t, 1, 1, releaseStatusVerifying)
+	if err := s.db.Model(&model.DeploymentRelease{}).Where("id = ?", release.ID).Update("status", releaseStatusAborted).Error; err != nil {
+		t.Fatalf("abort release: %v", err)
+	}
+	workloads := []rolloutWorkload{{Kind: "Deployment", Namespace: "default", Name: "web"}}
+	if err := s.logic.verifyRelease(ctx, release, cli, workloads, time.Second); err == nil {
+		t.Fatal("expected verification of an aborted release to be discarded")
+	}
+	var row model.DeploymentRelease
+	s.db.First(&row, release.ID)
+	if row.Status != releaseStatusAborted {
+		t.Fatalf("expected release to stay aborted, got %s", row.Status)
+	}
+}
+
+func TestBlueGreenReleaseSwitchesServiceSelector(t *testing.T) {
+	s := newReleaseTestSuite(t)
+	ctx := context.Background()
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec:       corev1.ServiceSpec{Selector: map[string]string{"app": "web"}},
+	}
+	cli := fake.NewSimpleClientset(stableWebDeployment(4), svc)
+	rt, _ := newStrategyTestRuntime(t, cli)
+	release := newStrategyTestRelease(t, s, releaseStrategyBlueGreen, nil)
+
+	if err := s.logic.runReleaseStrategy(ctx, release.ID, rt); err != nil {
+		t.Fatalf("run blue-green: %v", err)
+	}
+	row, state, err := s.logic.reloadRelease(ctx, release.ID)
+	if err != nil {
+		t.Fatalf("reload release: %v", err)
+	}
+	if row.Status != releaseStatusApplied || state.Color != "blue" || !state.Switched {
+		t.Fatalf("unexpected blue-green result: status=%s state=%+v", row.Status, state)
+	}
+	live, err := cli.CoreV1().Services("default").Get(ctx, "web", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get service: %v", err)
+	}
+	if live.Spec.Selector[strategyColorLabel] != "blue" || live.Spec.Selector["app"] != "web" {
+		t.Fatalf("expected selector switched to blue, got %v", live.Spec.Selector)
+	}
+	if got := deploymentReplicas(t, cli, "web-blue"); got != 4 {
+		t.Fatalf("expected web-blue with 4 replicas, got %d", got)
+	}
+	if got := deploymentReplicas(t, cli, "web"); got != 0 {
+		t.Fatalf("expected original deployment scaled to 0, got %d", got)
+	}
+	inventory := map[string]bool{}
+	for _, item := range parseInventory(row.InventoryJSON) {
+		inventory[item.String()] = true
+	}
+	if !inventory["Deployment/default/web-blue"] || !inventory["Service/default/web"] || inventory["Deployment/default/web"] {
+		t.Fatalf("expected inventory of the active color, got %s", row.InventoryJSON)
+	}
+}
+
+func TestRollingReleaseClearsBlueGreenDeployments(t *testing.T) {
+	s := newReleaseTestSuite(t)
+	ctx := context.Background()
+	blue := stableWebDeployment(4)
+	blue.Name = "web-blue"
+	cli := fake.NewSimpleClientset(stableWebDeployment(4), blue)
+	release := s.createTestRelease(t, 1, 1, releaseStatusVerifying)
+	release.Strategy = releaseStrategyRolling
+	release.ManifestSnapshot = strategyTestManifest
+	if err := s.db.Save(release).Error; err != nil {
+		t.Fatalf("save release: %v", err)
+	}
+
+	workloads := []rolloutWorkload{{Kind: "Deployment", Namespace: "default", Name: "web"}}
+	if err := s.logic.verifyRelease(ctx, release, cli, workloads, time.Second); err != nil {
+		t.Fatalf("verify release: %v", err)
+	}
+	if _, err := cli.AppsV1().Deployments("default").Get(ctx, "web-blue", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected web-blue removed after switching to rolling, got %v", err)
+	}
+	if got := deploymentReplicas(t, cli, "web"); got != 4 {
+		t.Fatalf("expected stable deployment kept, got %d replicas", got)
+	}
+}
+
+func TestRollingAfterBlueGreenKeepsColorUntilReady(t *testing.T) {
+	s := newReleaseTestSuite(t)
+	ctx := context.Background()
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec:       corev1.ServiceSpec{Selector: map[string]string{"app": "web"}},
+	}
+	cli := fake.NewSimpleClientset(stableWebDeployment(4), svc)
+	rt, applier := newStrategyTestRuntime(t, cli)
+	bluegreen := newStrategyTestRelease(t, s, releaseStrategyBlueGreen, nil)
+	if err := s.logic.runReleaseStrategy(ctx, bluegreen.ID, rt); err != nil {
+		t.Fatalf("run blue-green: %v", err)
+	}
+	// 蓝绿发布只把颜色 Deployment 写入 fake clientset, 这里同步到应用器, 模拟集群中的真实对象。
+	blue, err := cli.AppsV1().Deployments("default").Get(ctx, "web-blue", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get web-blue: %v", err)
+	}
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(blue)
+	if err != nil {
+		t.Fatalf("convert web-blue: %v", err)
+	}
+	live := &unstructured.Unstructured{Object: obj}
+	live.SetAPIVersion("apps/v1")
+	live.SetKind("Deployment")
+	withOwnershipLabels(live, bluegreen)
+	if _, err := applier.fakeApplier.Apply(ctx, live); err != nil {
+		t.Fatalf("seed web-blue: %v", err)
+	}
+
+	rolling := s.createTestRelease(t, 1, 1, releaseStatusApplying)
+	rolling.Strategy = releaseStrategyRolling
+	rolling.ManifestSnapshot = strategyTestManifest
+	if err := s.db.Save(rolling).Error; err != nil {
+		t.Fatalf("save release: %v", err)
+	}
+	if err := s.logic.applyReleaseManifest(ctx, rt.applier, rolling, rolling.ManifestSnapshot); err != nil {
+		t.Fatalf("apply rolling: %v", err)
+	}
+	// web 尚未就绪时, 承接流量的 web-blue 不能被清理。
+	web, err := cli.AppsV1().Deployments("default").Get(ctx, "web", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get web: %v", err)
+	}
+	web.Status.ReadyReplicas = 0
+	web.Status.AvailableReplicas = 0
+	if _, err := cli.AppsV1().Deployments("default").UpdateStatus(ctx, web, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("mark web not ready: %v", err)
+	}
+	for _, name := range applier.deleted {
+		if name == "Deployment/default/web-blue" {
+			t.Fatalf("expected web-blue kept by prune, deleted %v", applier.deleted)
+		}
+	}
+	if _, err := applier.Get(ctx, ReleaseInventoryItem{Group: "apps", Version: "v1", Kind: "Deployment", Namespace: "default", Name: "web-blue"}); err != nil {
+		t.Fatalf("expected web-blue to remain while web is not ready: %v", err)
+	}
+	if got := deploymentReplicas(t, cli, "web-blue"); got != 4 {
+		t.Fatalf("expected web-blue to keep serving with 4 replicas, got %d", got)
+	}
+
+	web.Status.ReadyReplicas = 4
+	web.Status.AvailableReplicas = 4
+	if _, err := cli.AppsV1().Deployments("default").UpdateStatus(ctx, web, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("mark web ready: %v", err)
+	}
+	rolling.Status = releaseStatusVerifying
+	if err := s.db.Save(rolling).Error; err != nil {
+		t.Fatalf("save release: %v", err)
+	}
+	workloads := []rolloutWorkload{{Kind: "Deployment", Namespace: "default", Name: "web"}}
+	if err := s.logic.verifyRelease(ctx, rolling, cli, workloads, time.Second); err != nil {
+		t.Fatalf("verify release: %v", err)
+	}
+	if _, err := cli.AppsV1().Deployments("default").Get(ctx, "web-blue", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected web-blue cleared after web became ready, got %v", err)
+	}
+}
+
+func TestExcludeStrategyPods(t *testing.T) {
+	stable := &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}
+	sel, _ := metav1.LabelSelectorAsSelector(stable)
+	sel = excludeStrategyPods(sel, stable)
+	if sel.Matches(labels.Set{"app": "web", strategyTrackLabel: "canary"}) {
+		t.Fatal("stable selector should not match canary pods")
+	}
+	if !sel.Matches(labels.Set{"app": "web"}) {
+		t.Fatal("stable selector should match stable pods")
+	}
+	canary := &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web", strategyTrackLabel: "canary"}}
+	sel, _ = metav1.LabelSelectorAsSelector(canary)
+	sel = excludeStrategyPods(sel, canary)
+	if !sel.Matches(labels.Set{"app": "web", strategyTrackLabel: "canary"}) {
+		t.Fatal("canary selector should keep matching canary pods")
+	}
+}
+
+func TestBlueGreenReleaseWaitsForPromote(t *testing.T) {
+	s := newReleaseTestSuite(t)
+	ctx := context.Background()
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec:       corev1.ServiceSpec{Selector: map[string]string{"app": "web", strategyColorLabel: "blue"}},
+	}
+	cli := fake.NewSimpleClientset(svc)
+	rt, _ := newStrategyTestRuntime(t, cli)
+	release := newStrategyTestRelease(t, s, releaseStrategyBlueGreen, map[string]any{"auto_switch": false})
+
+	if err := s.logic.runReleaseStrategy(ctx, release.ID, rt); err != nil {
+		t.Fatalf("run blue-green: %v", err)
+	}
+	row, state, _ := s.logic.reloadRelease(ctx, release.ID)
+	if row.Status != releaseStatusPaused || state.Color != "green" || state.PreviousColor != "blue" {
+		t.Fatalf("expected paused with green color ready, got status=%s state=%+v", row.Status, state)
+	}
+	live, _ := cli.CoreV1().Services("default").Get(ctx, "web", metav1.GetOptions{})
+	if live.Spec.Selector[strategyColorLabel] != "blue" {
+		t.Fatalf("service should keep serving blue before promote, got %v", live.Spec.Selector)
+	}
+
+	row, err := s.logic.promoteRelease(ctx, release.ID, 1, "", rt, false)
+	if err != nil {
+		t.Fatalf("promote release: %v", err)
+	}
+	if row.Status != releaseStatusApplied {
+		t.Fatalf("expected applied after switch, got %s", row.Status)
+	}
+	live, _ = cli.CoreV1().Services("default").Get(ctx, "web", metav1.GetOptions{})
+	if live.Spec.Selector[strategyColorLabel] != "green" {
+		t.Fatalf("expected selector switched to green, got %v", live.Spec.Selector)
+	}
+}
+
+func TestPreviewReleaseRejectsInvalidCanaryConfig(t *testing.T) {
+	s := newReleaseTestSuite(t)
+	svc := s.createTestService(t)
+	cluster := s.createTestCluster(t)
+	target := s.createTestTarget(t, cluster.ID)
+	_, err := s.logic.PreviewRelease(context.Background(), ReleasePreviewReq{
+		ServiceID:      svc.ID,
+		TargetID:       target.ID,
+		Strategy:       releaseStrategyCanary,
+		StrategyConfig: map[string]any{"steps": []int{60, 30}},
+	})
+	if err == nil {
+		t.Fatal("expected invalid canary steps to be rejected")
+	}
+}
@@ -52,6 +52,7 @@ func (l *Logic) GetTarget(ctx context.Context, id uint) (TargetResp, error) {
 		Env:             row.Env,
 		Status:          row.Status,
 		ReadinessStatus: defaultIfEmpty(row.ReadinessStatus, "unknown"),
+		VerifyTimeout:   defaultInt(row.VerifyTimeoutSeconds, int(defaultVerifyTimeout.Seconds())),
 		CreatedAt:       row.CreatedAt,
 		UpdatedAt:       row.UpdatedAt,
 	}
@@ -75,19 +76,20 @@ func (l *Logic) GetTarget(ctx context.Context, id uint) (TargetResp, error) {
 func (l *Logic) CreateTarget(ctx context.Context, uid uint64, req TargetUpsertReq) (TargetResp, error) {
 	runtimeType := normalizedRuntime(req.TargetType, req.RuntimeType)
 	row := model.DeploymentTarget{
-		Name:            strings.TrimSpace(req.Name),
-		TargetType:      runtimeType,
-		RuntimeType:     runtimeType,
-		ClusterID:       req.ClusterID,
-		ClusterSource:   l.compatClusterSource(strings.TrimSpace(req.ClusterSource), req.ClusterID, req.CredentialID),
-		CredentialID:    req.CredentialID,
-		BootstrapJobID:  strings.TrimSpace(req.BootstrapJobID),
-		ProjectID:       req.ProjectID,
-		TeamID:          req.TeamID,
-		Env:             defaultIfEmpty(req.Env, "staging"),
-		Status:          "active",
-		ReadinessStatus: "unknown",
-		CreatedBy:       uint(uid),
+		Name:                 strings.TrimSpace(req.Name),
+		TargetType:           runtimeType,
+		RuntimeType:          runtimeType,
+		ClusterID:            req.ClusterID,
+		ClusterSource:        l.compatClusterSource(strings.TrimSpace(req.ClusterSource), req.ClusterID, req.CredentialID),
+		CredentialID:         req.CredentialID,
+		BootstrapJobID:       strings.TrimSpace(req.BootstrapJobID),
+		ProjectID:            req.ProjectID,
+		TeamID:               req.TeamID,
+		Env:                  defaultIfEmpty(req.Env, "staging"),
+		Status:               "active",
+		ReadinessStatus:      "unknown",
+		VerifyTimeoutSeconds: defaultInt(req.VerifyTimeout, int(defaultVerifyTimeout.Seconds())),
+		CreatedBy:            uint(uid),
 	}
 	if strings.TrimSpace(row.BootstrapJobID) != "" {
 		var job model.EnvironmentInstallJob
@@ -162,6 +164,9 @@ func (l *Logic) UpdateTarget(ctx context.Context, id uint, req TargetUpsertReq)
 	if strings.TrimSpace(req.Env) != "" {
 		row.Env = req.Env
 	}
+	if req.VerifyTimeout > 0 {
+		row.VerifyTimeoutSeconds = req.VerifyTimeout
+	}
 	row.ClusterSource = l.compatClusterSource(row.ClusterSource, row.ClusterID, row.CredentialID)
 	if err := l.validateTargetUpsert(ctx, row.TargetType, row.ClusterID, row.ClusterSource, row.CredentialID, req.Nodes); err != nil {
 		return TargetResp{}, err
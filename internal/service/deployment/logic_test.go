@@ -27,7 +27,16 @@ func newDeploymentTestLogic(t *testing.T) *Logic {
 		&model.DeploymentTargetNode{},
 		&model.DeploymentRelease{},
 		&model.DeploymentReleaseApproval{},
+		&model.DeploymentReleaseApprovalVote{},
+		&model.Policy{},
+		&model.CICDDeploymentCDConfig{},
+		&model.Role{},
+		&model.UserRole{},
 		&model.DeploymentReleaseAudit{},
+		&model.DeploymentFreezeWindow{},
+		&model.DeploymentTargetLock{},
+		&model.DeploymentReleaseHook{},
+		&model.ServiceVariableSet{},
 		&model.EnvironmentInstallJob{},
 		&model.EnvironmentInstallJobStep{},
 		&model.ClusterCredential{},
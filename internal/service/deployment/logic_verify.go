@@ -0,0 +1,575 @@
+package deployment
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cy77cc/OpsPilot/internal/logger"
+	"github.com/cy77cc/OpsPilot/internal/model"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/serializer/yaml"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	defaultVerifyTimeout = 5 * time.Minute
+	// verifyResumeMinTimeout 是进程重启后重新验证发布的最短时间。
+	verifyResumeMinTimeout = 30 * time.Second
+	rolloutPollInterval    = 5 * time.Second
+	rolloutMaxFailingPods  = 5
+	rolloutMaxWarningEvent = 10
+)
+
+// rolloutWorkload 标识清单中需要等待滚动完成的工作负载。
+type rolloutWorkload struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+func (w rolloutWorkload) key() string {
+	return fmt.Sprintf("%s/%s/%s", w.Kind, w.Namespace, w.Name)
+}
+
+// rolloutFailingPod 记录未就绪 Pod 的等待或终止原因。
+type rolloutFailingPod struct {
+	Name     string `json:"name"`
+	Phase    string `json:"phase"`
+	Reason   string `json:"reason"`
+	Message  string `json:"message,omitempty"`
+	Restarts int32  `json:"restarts"`
+}
+
+// rolloutWorkloadResult 是单个工作负载的验证结果, 写入 VerificationJSON。
+type rolloutWorkloadResult struct {
+	rolloutWorkload
+	DesiredReplicas int32               `json:"desired_replicas"`
+	UpdatedReplicas int32               `json:"updated_replicas"`
+	ReadyReplicas   int32               `json:"ready_replicas"`
+	Ready           bool                `json:"ready"`
+	Failed          bool                `json:"failed"`
+	Message         string              `json:"message"`
+	FailingPods     []rolloutFailingPod `json:"failing_pods,omitempty"`
+	WarningEvents   []string            `json:"warning_events,omitempty"`
+}
+
+// rolloutStatus 是对工作负载对象状态的一次判定。
+type rolloutStatus struct {
+	Desired int32
+	Updated int32
+	Ready   int32
+	Done    bool
+	Failed  bool
+	Message string
+	// Selector 用于查找失败 Pod, 为空时跳过 Pod 诊断。
+	Selector *metav1.LabelSelector
+}
+
+// extractRolloutWorkloads 按 DeployToCluster 的切分规则解析清单, 返回需要验证的工作负载。
+func extractRolloutWorkloads(manifest string) ([]rolloutWorkload, error) {
+	dec := yaml.NewDecodingSerializer(unstructured.UnstructuredJSONScheme)
+	seen := map[string]struct{}{}
+	out := make([]rolloutWorkload, 0)
+	for _, doc := range strings.Split(manifest, "---") {
+		if strings.TrimSpace(doc) == "" {
+			continue
+		}
+		obj := &unstructured.Unstructured{}
+		_, gvk, err := dec.Decode([]byte(doc), nil, obj)
+		if err != nil {
+			return nil, err
+		}
+		if gvk.Group != appsv1.GroupName {
+			continue
+		}
+		switch gvk.Kind {
+		case "Deployment", "StatefulSet", "DaemonSet":
+		default:
+			continue
+		}
+		item := rolloutWorkload{
+			Kind:      gvk.Kind,
+			Namespace: defaultIfEmpty(obj.GetNamespace(), "default"),
+			Name:      obj.GetName(),
+		}
+		if _, ok := seen[item.key()]; ok {
+			continue
+		}
+		seen[item.key()] = struct{}{}
+		out = append(out, item)
+	}
+	return out, nil
+}
+
+func deploymentRolloutStatus(d *appsv1.Deployment) rolloutStatus {
+	desired := int32(1)
+	if d.Spec.Replicas != nil {
+		desired = *d.Spec.Replicas
+	}
+	st := rolloutStatus{Desired: desired, Updated: d.Status.UpdatedReplicas, Ready: d.Status.ReadyReplicas, Selector: d.Spec.Selector}
+	if d.Status.ObservedGeneration < d.Generation {
+		st.Message = "waiting for deployment spec update to be observed"
+		return st
+	}
+	for _, cond := range d.Status.Conditions {
+		if cond.Type == appsv1.DeploymentProgressing && cond.Reason == "ProgressDeadlineExceeded" {
+			st.Failed = true
+			st.Message = fmt.Sprintf("deployment exceeded its progress deadline: %s", cond.Message)
+			return st
+		}
+	}
+	switch {
+	case d.Status.UpdatedReplicas < desired:
+		st.Message = fmt.Sprintf("%d of %d updated replicas are available", d.Status.UpdatedReplicas, desired)
+	case d.Status.Replicas > d.Status.UpdatedReplicas:
+		st.Message = fmt.Sprintf("%d old replicas are pending termination", d.Status.Replicas-d.Status.UpdatedReplicas)
+	case d.Status.AvailableReplicas < d.Status.UpdatedReplicas:
+		st.Message = fmt.Sprintf("%d of %d updated replicas are available", d.Status.AvailableReplicas, d.Status.UpdatedReplicas)
+	default:
+		st.Done = true
+		st.Message = "successfully rolled out"
+	}
+	return st
+}
+
+func statefulSetRolloutStatus(s *appsv1.StatefulSet) rolloutStatus {
+	desired := int32(1)
+	if s.Spec.Replicas != nil {
+		desired = *s.Spec.Replicas
+	}
+	st := rolloutStatus{Desired: desired, Updated: s.Status.UpdatedReplicas, Ready: s.Status.ReadyReplicas, Selector: s.Spec.Selector}
+	if s.Status.ObservedGeneration < s.Generation {
+		st.Message = "waiting for statefulset spec update to be observed"
+		return st
+	}
+	if s.Status.ReadyReplicas < desired {
+		st.Message = fmt.Sprintf("%d of %d pods are ready", s.Status.ReadyReplicas, desired)
+		return st
+	}
+	if s.Spec.UpdateStrategy.Type == appsv1.RollingUpdateStatefulSetStrategyType && s.Spec.UpdateStrategy.RollingUpdate != nil {
+		if p := s.Spec.UpdateStrategy.RollingUpdate.Partition; p != nil && *p > 0 {
+			if s.Status.UpdatedReplicas < desired-*p {
+				st.Message = fmt.Sprintf("%d of %d partitioned pods are updated", s.Status.UpdatedReplicas, desired-*p)
+				return st
+			}
+			st.Done = true
+			st.Message = fmt.Sprintf("partitioned roll out complete: %d new pods", s.Status.UpdatedReplicas)
+			return st
+		}
+	}
+	if s.Status.UpdateRevision != "" && s.Status.UpdateRevision != s.Status.CurrentRevision {
+		st.Message = fmt.Sprintf("waiting for pods to be updated to revision %s", s.Status.UpdateRevision)
+		return st
+	}
+	st.Done = true
+	st.Message = "successfully rolled out"
+	return st
+}
+
+func daemonSetRolloutStatus(d *appsv1.DaemonSet) rolloutStatus {
+	desired := d.Status.DesiredNumberScheduled
+	st := rolloutStatus{Desired: desired, Updated: d.Status.UpdatedNumberScheduled, Ready: d.Status.NumberReady, Selector: d.Spec.Selector}
+	if d.Status.ObservedGeneration < d.Generation {
+		st.Message = "waiting for daemonset spec update to be observed"
+		return st
+	}
+	switch {
+	case d.Status.UpdatedNumberScheduled < desired:
+		st.Message = fmt.Sprintf("%d of %d updated pods are scheduled", d.Status.UpdatedNumberScheduled, desired)
+	case d.Status.NumberAvailable < desired:
+		st.Message = fmt.Sprintf("%d of %d updated pods are available", d.Status.NumberAvailable, desired)
+	default:
+		st.Done = true
+		st.Message = "successfully rolled out"
+	}
+	return st
+}
+
+// rolloutVerifier 轮询集群直到所有工作负载滚动完成、失败或超时。
+type rolloutVerifier struct {
+	cli      kubernetes.Interface
+	interval time.Duration
+}
+
+func (v *rolloutVerifier) status(ctx context.Context, w rolloutWorkload) (rolloutStatus, error) {
+	switch w.Kind {
+	case "Deployment":
+		obj, err := v.cli.AppsV1().Deployments(w.Namespace).Get(ctx, w.Name, metav1.GetOptions{})
+		if err != nil {
+			return rolloutStatus{}, err
+		}
+		return deploymentRolloutStatus(obj), nil
+	case "StatefulSet":
+		obj, err := v.cli.AppsV1().StatefulSets(w.Namespace).Get(ctx, w.Name, metav1.GetOptions{})
+		if err != nil {
+			return rolloutStatus{}, err
+		}
+		return statefulSetRolloutStatus(obj), nil
+	case "DaemonSet":
+		obj, err := v.cli.AppsV1().DaemonSets(w.Namespace).Get(ctx, w.Name, metav1.GetOptions{})
+		if err != nil {
+			return rolloutStatus{}, err
+		}
+		return daemonSetRolloutStatus(obj), nil
+	default:
+		return rolloutStatus{}, fmt.Errorf("unsupported workload kind %s", w.Kind)
+	}
+}
+
+// Verify 等待所有工作负载就绪; ctx 到期时未就绪的工作负载会附带 Pod 与事件诊断。
+func (v *rolloutVerifier) Verify(ctx context.Context, workloads []rolloutWorkload) []rolloutWorkloadResult {
+	results := make([]rolloutWorkloadResult, len(workloads))
+	statuses := make([]rolloutStatus, len(workloads))
+	pending := make(map[int]struct{}, len(workloads))
+	for i, w := range workloads {
+		results[i] = rolloutWorkloadResult{rolloutWorkload: w}
+		pending[i] = struct{}{}
+	}
+	interval := v.interval
+	if interval <= 0 {
+		interval = rolloutPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for i := range pending {
+			st, err := v.status(ctx, workloads[i])
+			if err != nil {
+				results[i].Message = err.Error()
+				continue
+			}
+			statuses[i] = st
+			results[i].DesiredReplicas = st.Desired
+			results[i].UpdatedReplicas = st.Updated
+			results[i].ReadyReplicas = st.Ready
+			results[i].Ready = st.Done
+			results[i].Failed = st.Failed
+			results[i].Message = st.Message
+			if st.Done || st.Failed {
+				delete(pending, i)
+			}
+		}
+		if len(pending) == 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			for i := range pending {
+				results[i].Failed = true
+				if strings.TrimSpace(results[i].Message) == "" {
+					results[i].Message = "rollout status unknown"
+				}
+				results[i].Message = "timed out: " + results[i].Message
+			}
+			pending = nil
+		case <-ticker.C:
+			continue
+		}
+		break
+	}
+	// 诊断查询使用独立的超时, 避免验证 ctx 已过期导致无法取回失败原因。
+	diagCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	for i := range results {
+		if results[i].Ready {
+			continue
+		}
+		results[i].FailingPods = v.failingPods(diagCtx, workloads[i].Namespace, statuses[i].Selector)
+		results[i].WarningEvents = v.warningEvents(diagCtx, workloads[i])
+	}
+	return results
+}
+
+func (v *rolloutVerifier) failingPods(ctx context.Context, namespace string, selector *metav1.LabelSelector) []rolloutFailingPod {
+	if selector == nil {
+		return nil
+	}
+	sel, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil || sel.Empty() {
+		return nil
+	}
+	sel = excludeStrategyPods(sel, selector)
+	pods, err := v.cli.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: sel.String()})
+	if err != nil {
+		return nil
+	}
+	out := make([]rolloutFailingPod, 0)
+	for _, pod := range pods.Items {
+		if item, failing := podFailure(&pod); failing {
+			out = append(out, item)
+			if len(out) >= rolloutMaxFailingPods {
+				break
+			}
+		}
+	}
+	return out
+}
+
+// excludeStrategyPods 让未约束金丝雀/颜色标签的稳定版本选择器排除金丝雀与蓝绿 Pod, 避免诊断时混入其他版本。
+func excludeStrategyPods(sel labels.Selector, selector *metav1.LabelSelector) labels.Selector {
+	for _, key := range []string{strategyTrackLabel, strategyColorLabel} {
+		if _, ok := selector.MatchLabels[key]; ok {
+			continue
+		}
+		constrained := false
+		for _, expr := range selector.MatchExpressions {
+			if expr.Key == key {
+				constrained = true
+				break
+			}
+		}
+		if constrained {
+			continue
+		}
+		if req, err := labels.NewRequirement(key, selection.DoesNotExist, nil); err == nil {
+			sel = sel.Add(*req)
+		}
+	}
+	return sel
+}
+
+func podFailure(pod *corev1.Pod) (rolloutFailingPod, bool) {
+	item := rolloutFailingPod{Name: pod.Name, Phase: string(pod.Status.Phase)}
+	failing := pod.Status.Phase == corev1.PodFailed || pod.Status.Phase == corev1.PodPending
+	for _, cs := range pod.Status.ContainerStatuses {
+		item.Restarts += cs.RestartCount
+		switch {
+		case cs.State.Waiting != nil:
+			failing = true
+			item.Reason = cs.State.Waiting.Reason
+			item.Message = truncateText(cs.State.Waiting.Message, 300)
+		case cs.State.Terminated != nil && cs.State.Terminated.ExitCode != 0:
+			failing = true
+			item.Reason = cs.State.Terminated.Reason
+			item.Message = truncateText(cs.State.Terminated.Message, 300)
+		case !cs.Ready:
+			failing = true
+			item.Reason = defaultIfEmpty(item.Reason, "ContainerNotReady")
+		}
+	}
+	if item.Reason == "" {
+		item.Reason = defaultIfEmpty(pod.Status.Reason, string(pod.Status.Phase))
+	}
+	return item, failing
+}
+
+func (v *rolloutVerifier) warningEvents(ctx context.Context, w rolloutWorkload) []string {
+	list, err := v.cli.CoreV1().Events(w.Namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("type", corev1.EventTypeWarning).String(),
+	})
+	if err != nil {
+		return nil
+	}
+	prefix := strings.ToLower(w.Name)
+	items := make([]corev1.Event, 0)
+	for _, ev := range list.Items {
+		if ev.Type != corev1.EventTypeWarning {
+			continue
+		}
+		// 工作负载自身以及其派生的 ReplicaSet/Pod 都以工作负载名为前缀。
+		if !strings.HasPrefix(strings.ToLower(ev.InvolvedObject.Name), prefix) {
+			continue
+		}
+		items = append(items, ev)
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].LastTimestamp.After(items[j].LastTimestamp.Time)
+	})
+	out := make([]string, 0, len(items))
+	for _, ev := range items {
+		out = append(out, truncateText(fmt.Sprintf("%s/%s %s: %s", ev.InvolvedObject.Kind, ev.InvolvedObject.Name, ev.Reason, ev.Message), 300))
+		if len(out) >= rolloutMaxWarningEvent {
+			break
+		}
+	}
+	return out
+}
+
+func rolloutClientForCluster(cluster *model.Cluster) (kubernetes.Interface, error) {
+	cfg, err := clientcmd.RESTConfigFromKubeConfig([]byte(cluster.KubeConfig))
+	if err != nil {
+		return nil, err
+	}
+	return kubernetes.NewForConfig(cfg)
+}
+
+func targetVerifyTimeout(target *model.DeploymentTarget) time.Duration {
+	if target == nil || target.VerifyTimeoutSeconds <= 0 {
+		return defaultVerifyTimeout
+	}
+	return time.Duration(target.VerifyTimeoutSeconds) * time.Second
+}
+
+// verifyRelease 在 verifying 状态下等待工作负载滚动完成, 并把结果落到发布记录上。
+func (l *Logic) verifyRelease(ctx context.Context, release *model.DeploymentRelease, cli kubernetes.Interface, workloads []rolloutWorkload, timeout time.Duration) error {
+	verifyCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	verifier := &rolloutVerifier{cli: cli}
+	results := verifier.Verify(verifyCtx, workloads)
+
+	diagnostics := rolloutDiagnostics(results)
+	passed := len(diagnostics) == 0
+	release.VerificationJSON = toJSON(map[string]any{
+		"runtime":         "k8s",
+		"checks":          []string{"apply_succeeded", "rollout_status"},
+		"passed":          passed,
+		"timeout_seconds": int(timeout.Seconds()),
+		"workloads":       results,
+	})
+	if !passed {
+		release.DiagnosticsJSON = toJSON(diagnostics)
+		if !l.saveVerification(release, releaseStatusFailed) {
+			return fmt.Errorf("release %d left verifying before verification finished", release.ID)
+		}
+		l.writeReleaseAudit(context.Background(), release.ID, release.Operator, "release.verification_failed", map[string]any{"diagnostics": diagnostics})
+		return fmt.Errorf("rollout verification failed: %s", diagnostics[0].Summary)
+	}
+	l.writeReleaseAudit(context.Background(), release.ID, release.Operator, "release.verified", map[string]any{"workloads": len(results)})
+	if err := l.runReleaseHooks(context.Background(), release, hookPhasePost); err != nil {
+		return err
+	}
+	if !l.saveVerification(release, releaseStatusApplied) {
+		return fmt.Errorf("release %d left verifying before verification finished", release.ID)
+	}
+	l.writeReleaseAudit(context.Background(), release.ID, release.Operator, "release.applied", map[string]any{"runtime": "k8s"})
+	if release.Strategy != releaseStrategyBlueGreen {
+		l.clearBlueGreen(context.Background(), release, cli)
+	}
+	return nil
+}
+
+// saveVerification 以发布仍处于 verifying 为条件写入验证结果与终态; 发布已被中止等并发修改时不写入并返回 false, release 保持原状态。
+func (l *Logic) saveVerification(release *model.DeploymentRelease, status string) bool {
+	prev := release.Status
+	release.Status = status
+	res := l.svcCtx.DB.WithContext(context.Background()).Model(release).
+		Where("status = ?", releaseStatusVerifying).
+		Select("status", "verification_json", "diagnostics_json", "inventory_json", "strategy_state_json", "finished_at", "updated_at").
+		Updates(release)
+	if res.Error != nil || res.RowsAffected == 0 {
+		release.Status = prev
+		return false
+	}
+	return true
+}
+
+// verifyRollback 同步等待回滚后的工作负载就绪, 失败时把回滚记录标记为 failed 并写入诊断。
+// 回滚不再执行 post 钩子, 避免钩子失败再次触发回滚。
+func (l *Logic) verifyRollback(ctx context.Context, rollback *model.DeploymentRelease, cli kubernetes.Interface, workloads []rolloutWorkload, timeout time.Duration) error {
+	verifyCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	results := (&rolloutVerifier{cli: cli}).Verify(verifyCtx, workloads)
+
+	diagnostics := rolloutDiagnostics(results)
+	passed := len(diagnostics) == 0
+	rollback.VerificationJSON = toJSON(map[string]any{
+		"runtime":            "k8s",
+		"checks":             []string{"apply_succeeded", "rollout_status"},
+		"passed":             passed,
+		"rollback_succeeded": passed,
+		"timeout_seconds":    int(timeout.Seconds()),
+		"workloads":          results,
+	})
+	if passed {
+		l.writeReleaseAudit(ctx, rollback.ID, rollback.Operator, "release.verified", map[string]any{"workloads": len(results)})
+		return nil
+	}
+	rollback.Status = releaseStatusFailed
+	rollback.DiagnosticsJSON = toJSON(diagnostics)
+	_ = l.svcCtx.DB.WithContext(context.WithoutCancel(ctx)).Save(rollback).Error
+	l.writeReleaseAudit(context.WithoutCancel(ctx), rollback.ID, rollback.Operator, "release.verification_failed", map[string]any{"diagnostics": diagnostics})
+	return fmt.Errorf("rollback verification failed: %s", diagnostics[0].Summary)
+}
+
+// rolloutDiagnostics 为未就绪的工作负载生成诊断, 全部就绪时返回空。
+func rolloutDiagnostics(results []rolloutWorkloadResult) []releaseDiagnostic {
+	diagnostics := make([]releaseDiagnostic, 0)
+	for _, item := range results {
+		if item.Ready {
+			continue
+		}
+		code := "rollout_failed"
+		if strings.HasPrefix(item.Message, "timed out") {
+			code = "rollout_timeout"
+		}
+		summary := fmt.Sprintf("%s %s/%s ready %d/%d", item.Kind, item.Namespace, item.Name, item.ReadyReplicas, item.DesiredReplicas)
+		if len(item.FailingPods) > 0 {
+			pod := item.FailingPods[0]
+			summary = fmt.Sprintf("%s; pod %s %s", summary, pod.Name, pod.Reason)
+		}
+		diagnostics = append(diagnostics, releaseDiagnostic{
+			Runtime: "k8s", Stage: "verify", Code: code, Message: truncateText(item.Message, 500), Summary: truncateText(summary, 800),
+		})
+	}
+	return diagnostics
+}
+
+// resumeReleaseVerification 接管验证中随进程重启而中断的发布: 金丝雀/蓝绿发布从当前步骤继续,
+// 其他发布按剩余的验证时间重新验证。
+func (l *Logic) resumeReleaseVerification(ctx context.Context, release *model.DeploymentRelease) error {
+	var target model.DeploymentTarget
+	if err := l.svcCtx.DB.WithContext(ctx).First(&target, release.TargetID).Error; err != nil {
+		return err
+	}
+	if isProgressiveStrategy(release.Strategy) && strings.TrimSpace(release.StrategyStateJSON) != "" {
+		rt, err := l.strategyRuntimeForTarget(ctx, &target)
+		if err != nil {
+			return err
+		}
+		releaseID := release.ID
+		go func() {
+			if err := l.runReleaseStrategy(context.Background(), releaseID, rt); err != nil {
+				if lg := logger.L(); lg != nil {
+					lg.Warn("resume release strategy failed", logger.Int("release_id", int(releaseID)), logger.Error(err))
+				}
+			}
+		}()
+		return nil
+	}
+	var cluster model.Cluster
+	if err := l.svcCtx.DB.WithContext(ctx).First(&cluster, target.ClusterID).Error; err != nil {
+		return err
+	}
+	cli, err := rolloutClientForCluster(&cluster)
+	if err != nil {
+		return err
+	}
+	return l.restartReleaseVerification(release, &target, cli)
+}
+
+// restartReleaseVerification 按目标验证超时的剩余时间重新验证发布, 剩余时间不足 verifyResumeMinTimeout 时按该值验证,
+// 已完成滚动的工作负载会很快通过。
+func (l *Logic) restartReleaseVerification(release *model.DeploymentRelease, target *model.DeploymentTarget, cli kubernetes.Interface) error {
+	workloads, err := extractRolloutWorkloads(release.ManifestSnapshot)
+	if err != nil {
+		return err
+	}
+	timeout := targetVerifyTimeout(target) - time.Since(release.UpdatedAt)
+	if timeout < verifyResumeMinTimeout {
+		timeout = verifyResumeMinTimeout
+	}
+	l.startReleaseVerification(release, cli, workloads, timeout)
+	return nil
+}
+
+// startReleaseVerification 在后台执行滚动验证, 发布接口不等待验证结束。
+func (l *Logic) startReleaseVerification(release *model.DeploymentRelease, cli kubernetes.Interface, workloads []rolloutWorkload, timeout time.Duration) {
+	row := *release
+	go func() {
+		if err := l.verifyRelease(context.Background(), &row, cli, workloads, timeout); err != nil {
+			if lg := logger.L(); lg != nil {
+				lg.Warn("release rollout verification failed", logger.Int("release_id", int(row.ID)), logger.Error(err))
+			}
+		}
+	}()
+}
@@ -0,0 +1,284 @@
+package deployment
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cy77cc/OpsPilot/internal/model"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func int32Ptr(v int32) *int32 { return &v }
+
+func readyDeployment(name string) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Generation: 2},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: int32Ptr(2),
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": name}},
+		},
+		Status: appsv1.DeploymentStatus{
+			ObservedGeneration: 2,
+			Replicas:           2,
+			UpdatedReplicas:    2,
+			ReadyReplicas:      2,
+			AvailableReplicas:  2,
+		},
+	}
+}
+
+func TestExtractRolloutWorkloads(t *testing.T) {
+	manifest := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+---
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: db
+  namespace: data
+---
+apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: agent
+  namespace: kube-system
+`
+	got, err := extractRolloutWorkloads(manifest)
+	if err != nil {
+		t.Fatalf("extract workloads: %v", err)
+	}
+	want := []rolloutWorkload{
+		{Kind: "Deployment", Namespace: "default", Name: "web"},
+		{Kind: "StatefulSet", Namespace: "data", Name: "db"},
+		{Kind: "DaemonSet", Namespace: "kube-system", Name: "agent"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d workloads, got %+v", len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("workload %d: expected %+v, got %+v", i, want[i], got[i])
+		}
+	}
+}
+
+func TestDeploymentRolloutStatus(t *testing.T) {
+	d := readyDeployment("web")
+	if st := deploymentRolloutStatus(d); !st.Done || st.Failed {
+		t.Fatalf("expected ready deployment, got %+v", st)
+	}
+
+	stale := readyDeployment("web")
+	stale.Status.ObservedGeneration = 1
+	if st := deploymentRolloutStatus(stale); st.Done {
+		t.Fatalf("expected unobserved generation to be pending, got %+v", st)
+	}
+
+	partial := readyDeployment("web")
+	partial.Status.AvailableReplicas = 1
+	if st := deploymentRolloutStatus(partial); st.Done {
+		t.Fatalf("expected partially available deployment to be pending, got %+v", st)
+	}
+
+	stuck := readyDeployment("web")
+	stuck.Status.UpdatedReplicas = 1
+	stuck.Status.Conditions = []appsv1.DeploymentCondition{{
+		Type: appsv1.DeploymentProgressing, Status: corev1.ConditionFalse, Reason: "ProgressDeadlineExceeded",
+	}}
+	if st := deploymentRolloutStatus(stuck); !st.Failed {
+		t.Fatalf("expected progress deadline to fail, got %+v", st)
+	}
+}
+
+func TestStatefulSetAndDaemonSetRolloutStatus(t *testing.T) {
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Generation: 1},
+		Spec:       appsv1.StatefulSetSpec{Replicas: int32Ptr(3)},
+		Status: appsv1.StatefulSetStatus{
+			ObservedGeneration: 1, ReadyReplicas: 3, UpdatedReplicas: 3,
+			CurrentRevision: "db-1", UpdateRevision: "db-2",
+		},
+	}
+	if st := statefulSetRolloutStatus(sts); st.Done {
+		t.Fatalf("expected revision mismatch to be pending, got %+v", st)
+	}
+	sts.Status.CurrentRevision = "db-2"
+	if st := statefulSetRolloutStatus(sts); !st.Done {
+		t.Fatalf("expected statefulset rolled out, got %+v", st)
+	}
+
+	ds := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Generation: 1},
+		Status: appsv1.DaemonSetStatus{
+			ObservedGeneration: 1, DesiredNumberScheduled: 3, UpdatedNumberScheduled: 3, NumberAvailable: 2,
+		},
+	}
+	if st := daemonSetRolloutStatus(ds); st.Done {
+		t.Fatalf("expected unavailable daemonset pod to be pending, got %+v", st)
+	}
+	ds.Status.NumberAvailable = 3
+	if st := daemonSetRolloutStatus(ds); !st.Done {
+		t.Fatalf("expected daemonset rolled out, got %+v", st)
+	}
+}
+
+func TestVerifyReleaseMarksApplied(t *testing.T) {
+	s := newReleaseTestSuite(t)
+	release := s.createTestRelease(t, 1, 1, releaseStatusVerifying)
+	cli := fake.NewSimpleClientset(readyDeployment("web"))
+
+	workloads := []rolloutWorkload{{Kind: "Deployment", Namespace: "default", Name: "web"}}
+	if err := s.logic.verifyRelease(context.Background(), release, cli, workloads, time.Second); err != nil {
+		t.Fatalf("verify release: %v", err)
+	}
+
+	var row model.DeploymentRelease
+	if err := s.db.First(&row, release.ID).Error; err != nil {
+		t.Fatalf("load release: %v", err)
+	}
+	if row.Status != releaseStatusApplied {
+		t.Fatalf("expected applied, got %s", row.Status)
+	}
+	var verification struct {
+		Passed    bool                    `json:"passed"`
+		Workloads []rolloutWorkloadResult `json:"workloads"`
+	}
+	if err := json.Unmarshal([]byte(row.VerificationJSON), &verification); err != nil {
+		t.Fatalf("decode verification: %v", err)
+	}
+	if !verification.Passed || len(verification.Workloads) != 1 || verification.Workloads[0].ReadyReplicas != 2 {
+		t.Fatalf("unexpected verification payload: %s", row.VerificationJSON)
+	}
+}
+
+func TestRestartReleaseVerificationAfterRestart(t *testing.T) {
+	s := newReleaseTestSuite(t)
+	release := s.createTestRelease(t, 1, 1, releaseStatusVerifying)
+	release.ManifestSnapshot = "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\n  namespace: default\n"
+	target := &model.DeploymentTarget{VerifyTimeoutSeconds: 1}
+	if err := s.logic.restartReleaseVerification(release, target, fake.NewSimpleClientset(readyDeployment("web"))); err != nil {
+		t.Fatalf("restart verification: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	var row model.DeploymentRelease
+	for time.Now().Before(deadline) {
+		if err := s.db.First(&row, release.ID).Error; err == nil && row.Status != releaseStatusVerifying {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if row.Status != releaseStatusApplied {
+		t.Fatalf("expected resumed verification to mark release applied, got %s", row.Status)
+	}
+}
+
+func TestVerifyReleaseTimeoutRecordsDiagnostics(t *testing.T) {
+	s := newReleaseTestSuite(t)
+	release := s.createTestRelease(t, 1, 1, releaseStatusVerifying)
+
+	d := readyDeployment("web")
+	d.Status.ReadyReplicas = 1
+	d.Status.AvailableReplicas = 1
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-abc", Namespace: "default", Labels: map[string]string{"app": "web"}},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodRunning,
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name:         "app",
+				RestartCount: 4,
+				State:        corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+			}},
+		},
+	}
+	event := &corev1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Name: "web-abc.1", Namespace: "default"},
+		InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: "web-abc"},
+		Type:           corev1.EventTypeWarning,
+		Reason:         "BackOff",
+		Message:        "Back-off restarting failed container",
+	}
+	cli := fake.NewSimpleClientset(d, pod, event)
+
+	workloads := []rolloutWorkload{{Kind: "Deployment", Namespace: "default", Name: "web"}}
+	if err := s.logic.verifyRelease(context.Background(), release, cli, workloads, 50*time.Millisecond); err == nil {
+		t.Fatal("expected verification error")
+	}
+
+	var row model.DeploymentRelease
+	if err := s.db.First(&row, release.ID).Error; err != nil {
+		t.Fatalf("load release: %v", err)
+	}
+	if row.Status != releaseStatusFailed {
+		t.Fatalf("expected failed, got %s", row.Status)
+	}
+	var diagnostics []releaseDiagnostic
+	if err := json.Unmarshal([]byte(row.DiagnosticsJSON), &diagnostics); err != nil {
+		t.Fatalf("decode diagnostics: %v", err)
+	}
+	if len(diagnostics) != 1 || diagnostics[0].Code != "rollout_timeout" || diagnostics[0].Stage != "verify" {
+		t.Fatalf("unexpected diagnostics: %s", row.DiagnosticsJSON)
+	}
+	var verification struct {
+		Workloads []rolloutWorkloadResult `json:"workloads"`
+	}
+	if err := json.Unmarshal([]byte(row.VerificationJSON), &verification); err != nil {
+		t.Fatalf("decode verification: %v", err)
+	}
+	result := verification.Workloads[0]
+	if len(result.FailingPods) != 1 || result.FailingPods[0].Reason != "CrashLoopBackOff" {
+		t.Fatalf("expected crashlooping pod in diagnostics, got %+v", result.FailingPods)
+	}
+	if len(result.WarningEvents) != 1 {
+		t.Fatalf("expected warning event in diagnostics, got %+v", result.WarningEvents)
+	}
+
+	var audits []model.DeploymentReleaseAudit
+	s.db.Where("release_id = ?", release.ID).Find(&audits)
+	if len(audits) != 1 || audits[0].Action != "release.verification_failed" {
+		t.Fatalf("expected verification_failed audit, got %+v", audits)
+	}
+}
+
+func TestVerifyRollbackLeavesSuccessToCaller(t *testing.T) {
+	s := newReleaseTestSuite(t)
+	rollback := s.createTestRelease(t, 1, 1, releaseStatusApplying)
+	workloads := []rolloutWorkload{{Kind: "Deployment", Namespace: "default", Name: "web"}}
+
+	if err := s.logic.verifyRollback(context.Background(), rollback, fake.NewSimpleClientset(readyDeployment("web")), workloads, time.Second); err != nil {
+		t.Fatalf("verify rollback: %v", err)
+	}
+	var verification struct {
+		Passed            bool `json:"passed"`
+		RollbackSucceeded bool `json:"rollback_succeeded"`
+	}
+	_ = json.Unmarshal([]byte(rollback.VerificationJSON), &verification)
+	if rollback.Status != releaseStatusApplying || !verification.Passed || !verification.RollbackSucceeded {
+		t.Fatalf("expected verified rollback, got %s %s", rollback.Status, rollback.VerificationJSON)
+	}
+
+	stuck := readyDeployment("web")
+	stuck.Status.ReadyReplicas = 1
+	stuck.Status.AvailableReplicas = 1
+	if err := s.logic.verifyRollback(context.Background(), rollback, fake.NewSimpleClientset(stuck), workloads, 50*time.Millisecond); err == nil {
+		t.Fatal("expected rollback verification error")
+	}
+	var row model.DeploymentRelease
+	s.db.First(&row, rollback.ID)
+	if row.Status != releaseStatusFailed || !strings.Contains(row.DiagnosticsJSON, "rollout_timeout") || strings.Contains(row.VerificationJSON, `"rollback_succeeded":true`) {
+		t.Fatalf("expected failed rollback with diagnostics, got %+v", row)
+	}
+}
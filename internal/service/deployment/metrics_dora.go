@@ -0,0 +1,435 @@
+package deployment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cy77cc/OpsPilot/internal/httpx"
+	prominfra "github.com/cy77cc/OpsPilot/internal/infra/prometheus"
+	"github.com/cy77cc/OpsPilot/internal/logger"
+	"github.com/cy77cc/OpsPilot/internal/model"
+	"github.com/cy77cc/OpsPilot/internal/xcode"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	doraGroupService = "service"
+	doraGroupTeam    = "team"
+	doraGroupEnv     = "env"
+	doraGroupAll     = "all"
+
+	doraDefaultWindowDays = 30
+	doraMaxWindowDays     = 365
+	doraExportInterval    = 5 * time.Minute
+)
+
+// DORAMetricsQuery DORA 指标查询条件
+type DORAMetricsQuery struct {
+	GroupBy   string `form:"group_by"`
+	Days      int    `form:"days"`
+	ServiceID uint   `form:"service_id"`
+	TeamID    uint   `form:"team_id"`
+	Env       string `form:"env"`
+}
+
+// DORAMetrics DORA 指标结果
+type DORAMetrics struct {
+	GroupBy    string            `json:"group_by"`
+	WindowDays int               `json:"window_days"`
+	From       time.Time         `json:"from"`
+	To         time.Time         `json:"to"`
+	Overall    DORAMetricsItem   `json:"overall"`
+	Items      []DORAMetricsItem `json:"items"`
+}
+
+// DORAMetricsItem 单个维度的 DORA 指标。时长取中位数, 比率为百分比。
+type DORAMetricsItem struct {
+	Key                  string  `json:"key"`
+	Name                 string  `json:"name"`
+	Deployments          int     `json:"deployments"`
+	DeploymentFrequency  float64 `json:"deployment_frequency_per_day"`
+	LeadTimeSeconds      float64 `json:"lead_time_seconds"`
+	LeadTimeSamples      int     `json:"lead_time_samples"`
+	ChangeAttempts       int     `json:"change_attempts"`
+	ChangeFailures       int     `json:"change_failures"`
+	ChangeFailureRate    float64 `json:"change_failure_rate"`
+	TimeToRestoreSeconds float64 `json:"time_to_restore_seconds"`
+	Restores             int     `json:"restores"`
+	Unrestored           int     `json:"unrestored"`
+}
+
+// doraRelease 是计算 DORA 指标所需的发布视图。
+type doraRelease struct {
+	model.DeploymentRelease
+	Env         string
+	TeamID      uint
+	ServiceName string
+	CITrigger   *time.Time
+}
+
+// doraAccumulator 汇总一个维度内的样本。
+type doraAccumulator struct {
+	item      DORAMetricsItem
+	leadTimes []float64
+	restores  []float64
+}
+
+// GetDORAMetrics 获取 DORA 指标: 部署频率、变更前置时间、变更失败率与恢复时间。
+func (h *MetricsHandler) GetDORAMetrics(c *gin.Context) {
+	if !httpx.Authorize(c, h.svcCtx.DB, "deploy:release:read") {
+		return
+	}
+	var q DORAMetricsQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		httpx.BindErr(c, err)
+		return
+	}
+	if err := normalizeDORAQuery(&q); err != nil {
+		httpx.Fail(c, xcode.ParamError, err.Error())
+		return
+	}
+	resp, err := h.getDORAMetrics(c.Request.Context(), q, time.Now())
+	if err != nil {
+		httpx.ServerErr(c, err)
+		return
+	}
+	httpx.OK(c, resp)
+}
+
+func normalizeDORAQuery(q *DORAMetricsQuery) error {
+	q.GroupBy = strings.ToLower(strings.TrimSpace(q.GroupBy))
+	switch q.GroupBy {
+	case "":
+		q.GroupBy = doraGroupService
+	case doraGroupService, doraGroupTeam, doraGroupEnv, doraGroupAll:
+	default:
+		return fmt.Errorf("group_by must be one of service, team, env, all")
+	}
+	if q.Days <= 0 {
+		q.Days = doraDefaultWindowDays
+	}
+	if q.Days > doraMaxWindowDays {
+		return fmt.Errorf("days must not exceed %d", doraMaxWindowDays)
+	}
+	q.Env = strings.TrimSpace(q.Env)
+	return nil
+}
+
+func (h *MetricsHandler) getDORAMetrics(ctx context.Context, q DORAMetricsQuery, now time.Time) (*DORAMetrics, error) {
+	since := now.AddDate(0, 0, -q.Days)
+	rows, err := h.loadDORAReleases(ctx, since)
+	if err != nil {
+		return nil, err
+	}
+	filtered := rows[:0]
+	for _, r := range rows {
+		if q.ServiceID != 0 && r.ServiceID != q.ServiceID {
+			continue
+		}
+		if q.TeamID != 0 && r.TeamID != q.TeamID {
+			continue
+		}
+		if q.Env != "" && !strings.EqualFold(r.Env, q.Env) {
+			continue
+		}
+		filtered = append(filtered, r)
+	}
+	return computeDORAMetrics(filtered, q.GroupBy, since, now, q.Days), nil
+}
+
+// loadDORAReleases 读取时间窗口内的发布, 并补齐目标环境、服务团队与 CI 触发时间。
+func (h *MetricsHandler) loadDORAReleases(ctx context.Context, since time.Time) ([]doraRelease, error) {
+	db := h.svcCtx.DB.WithContext(ctx)
+	var releases []model.DeploymentRelease
+	if err := db.Where("created_at >= ?", since).Order("id ASC").Find(&releases).Error; err != nil {
+		return nil, err
+	}
+	serviceIDs, targetIDs, runIDs := map[uint]struct{}{}, map[uint]struct{}{}, map[uint]struct{}{}
+	for _, r := range releases {
+		serviceIDs[r.ServiceID] = struct{}{}
+		targetIDs[r.TargetID] = struct{}{}
+		if r.CIRunID > 0 {
+			runIDs[r.CIRunID] = struct{}{}
+		}
+	}
+	var services []model.Service
+	if len(serviceIDs) > 0 {
+		if err := db.Select("id", "name", "team_id").Where("id IN ?", doraIDs(serviceIDs)).Find(&services).Error; err != nil {
+			return nil, err
+		}
+	}
+	var targets []model.DeploymentTarget
+	if len(targetIDs) > 0 {
+		if err := db.Select("id", "env").Where("id IN ?", doraIDs(targetIDs)).Find(&targets).Error; err != nil {
+			return nil, err
+		}
+	}
+	var runs []model.CICDServiceCIRun
+	if len(runIDs) > 0 {
+		if err := db.Select("id", "triggered_at").Where("id IN ?", doraIDs(runIDs)).Find(&runs).Error; err != nil {
+			return nil, err
+		}
+	}
+	serviceByID := make(map[uint]model.Service, len(services))
+	for _, s := range services {
+		serviceByID[s.ID] = s
+	}
+	envByTarget := make(map[uint]string, len(targets))
+	for _, t := range targets {
+		envByTarget[t.ID] = t.Env
+	}
+	triggerByRun := make(map[uint]time.Time, len(runs))
+	for _, r := range runs {
+		triggerByRun[r.ID] = r.TriggeredAt
+	}
+	out := make([]doraRelease, 0, len(releases))
+	for _, r := range releases {
+		row := doraRelease{DeploymentRelease: r, Env: defaultIfEmpty(envByTarget[r.TargetID], r.NamespaceOrProject)}
+		if svc, ok := serviceByID[r.ServiceID]; ok {
+			row.TeamID = svc.TeamID
+			row.ServiceName = svc.Name
+		}
+		if at, ok := triggerByRun[r.CIRunID]; ok {
+			row.CITrigger = &at
+		}
+		out = append(out, row)
+	}
+	return out, nil
+}
+
+func doraIDs(m map[uint]struct{}) []uint {
+	out := make([]uint, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	return out
+}
+
+func doraIsRollback(r *doraRelease) bool {
+	return r.Strategy == "rollback"
+}
+
+// doraGood 判断发布是否让目标恢复到健康状态: 验证通过的发布或成功的回滚。
+func doraGood(r *doraRelease) bool {
+	if doraIsRollback(r) {
+		var v struct {
+			Succeeded bool `json:"rollback_succeeded"`
+		}
+		return r.Status == releaseStatusRollback && json.Unmarshal([]byte(r.VerificationJSON), &v) == nil && v.Succeeded
+	}
+	return r.Status == releaseStatusApplied && verificationPassed(r.VerificationJSON)
+}
+
+// doraFinishedAt 返回发布进入终态的时间; 迁移前没有记录完成时间的历史发布回退为更新时间。
+func doraFinishedAt(r *doraRelease) time.Time {
+	if r.FinishedAt != nil {
+		return *r.FinishedAt
+	}
+	return r.UpdatedAt
+}
+
+func doraGroupKey(r *doraRelease, groupBy string) (string, string) {
+	switch groupBy {
+	case doraGroupTeam:
+		if r.TeamID == 0 {
+			return "0", "unassigned"
+		}
+		id := strconv.FormatUint(uint64(r.TeamID), 10)
+		return id, "team-" + id
+	case doraGroupEnv:
+		env := defaultIfEmpty(strings.ToLower(r.Env), "unknown")
+		return env, env
+	case doraGroupAll:
+		return doraGroupAll, doraGroupAll
+	default:
+		id := strconv.FormatUint(uint64(r.ServiceID), 10)
+		return id, defaultIfEmpty(r.ServiceName, "service-"+id)
+	}
+}
+
+// computeDORAMetrics 按维度计算 DORA 指标:
+//   - 部署频率: 窗口内成功应用的发布数 / 窗口天数, 回滚发布不计入;
+//   - 变更前置时间: CI 运行触发到发布验证通过的中位时长;
+//   - 变更失败率: 失败或被回滚的发布占已落地发布 (成功、失败、被回滚) 的比例;
+//   - 恢复时间: 同一服务与目标上, 失败发布到下一个良好发布 (验证通过或回滚成功) 的中位时长。
+func computeDORAMetrics(rows []doraRelease, groupBy string, since, until time.Time, windowDays int) *DORAMetrics {
+	rolledBack := map[uint]bool{}
+	for i := range rows {
+		if doraIsRollback(&rows[i]) && rows[i].SourceReleaseID > 0 {
+			rolledBack[rows[i].SourceReleaseID] = true
+		}
+	}
+	groups := map[string]*doraAccumulator{}
+	overall := &doraAccumulator{item: DORAMetricsItem{Key: doraGroupAll, Name: doraGroupAll}}
+	acc := func(r *doraRelease) []*doraAccumulator {
+		key, name := doraGroupKey(r, groupBy)
+		g, ok := groups[key]
+		if !ok {
+			g = &doraAccumulator{item: DORAMetricsItem{Key: key, Name: name}}
+			groups[key] = g
+		}
+		if groupBy == doraGroupAll {
+			return []*doraAccumulator{g}
+		}
+		return []*doraAccumulator{g, overall}
+	}
+
+	type stream struct{ serviceID, targetID uint }
+	outages := map[stream]*doraRelease{}
+	for i := range rows {
+		r := &rows[i]
+		failed := !doraIsRollback(r) && (r.Status == releaseStatusFailed || r.Status == releaseStatusRolledBack || rolledBack[r.ID])
+		good := doraGood(r)
+		for _, a := range acc(r) {
+			if !doraIsRollback(r) && (failed || r.Status == releaseStatusApplied) {
+				a.item.ChangeAttempts++
+			}
+			if failed {
+				a.item.ChangeFailures++
+			}
+			if !doraIsRollback(r) && r.Status == releaseStatusApplied && !rolledBack[r.ID] {
+				a.item.Deployments++
+			}
+			if finished := doraFinishedAt(r); good && !doraIsRollback(r) && r.CITrigger != nil && finished.After(*r.CITrigger) {
+				a.leadTimes = append(a.leadTimes, finished.Sub(*r.CITrigger).Seconds())
+			}
+		}
+		key := stream{r.ServiceID, r.TargetID}
+		switch {
+		case failed:
+			if _, open := outages[key]; !open {
+				outages[key] = r
+			}
+		case good:
+			if start, open := outages[key]; open {
+				if d := doraFinishedAt(r).Sub(doraFinishedAt(start)).Seconds(); d >= 0 {
+					for _, a := range acc(start) {
+						a.restores = append(a.restores, d)
+					}
+				}
+				delete(outages, key)
+			}
+		}
+	}
+	for _, start := range outages {
+		for _, a := range acc(start) {
+			a.item.Unrestored++
+		}
+	}
+
+	finish := func(a *doraAccumulator) DORAMetricsItem {
+		item := a.item
+		if windowDays > 0 {
+			item.DeploymentFrequency = roundDORA(float64(item.Deployments) / float64(windowDays))
+		}
+		item.LeadTimeSamples = len(a.leadTimes)
+		item.LeadTimeSeconds = roundDORA(medianSeconds(a.leadTimes))
+		if item.ChangeAttempts > 0 {
+			item.ChangeFailureRate = roundDORA(float64(item.ChangeFailures) / float64(item.ChangeAttempts) * 100)
+		}
+		item.Restores = len(a.restores)
+		item.TimeToRestoreSeconds = roundDORA(medianSeconds(a.restores))
+		return item
+	}
+	out := &DORAMetrics{GroupBy: groupBy, WindowDays: windowDays, From: since, To: until, Items: make([]DORAMetricsItem, 0, len(groups))}
+	for _, g := range groups {
+		out.Items = append(out.Items, finish(g))
+	}
+	sort.Slice(out.Items, func(i, j int) bool { return out.Items[i].Key < out.Items[j].Key })
+	if groupBy == doraGroupAll {
+		if len(out.Items) > 0 {
+			out.Overall = out.Items[0]
+		} else {
+			out.Overall = finish(overall)
+		}
+	} else {
+		out.Overall = finish(overall)
+	}
+	return out
+}
+
+func medianSeconds(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 1 {
+		return sorted[mid]
+	}
+	return (sorted[mid-1] + sorted[mid]) / 2
+}
+
+func roundDORA(v float64) float64 {
+	return float64(int64(v*100+0.5)) / 100
+}
+
+var doraExportOnce sync.Once
+
+// StartDORAExport 定时计算 DORA 指标并通过 Pushgateway 导出为 Prometheus gauge, ctx 取消时退出。进程内只启动一次。
+func (h *MetricsHandler) StartDORAExport(ctx context.Context) {
+	pusher := h.svcCtx.MetricsPusher
+	if pusher == nil {
+		logger.L().Warn("MetricsPusher is nil, deployment DORA export disabled")
+		return
+	}
+	doraExportOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(doraExportInterval)
+			defer ticker.Stop()
+			for {
+				exportCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+				h.exportDORAMetrics(exportCtx, pusher)
+				cancel()
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}()
+	})
+}
+
+func (h *MetricsHandler) exportDORAMetrics(ctx context.Context, pusher *prominfra.MetricsPusher) {
+	now := time.Now()
+	since := now.AddDate(0, 0, -doraDefaultWindowDays)
+	rows, err := h.loadDORAReleases(ctx, since)
+	if err != nil {
+		logger.L().Warn("load releases for DORA export failed", logger.Error(err))
+		return
+	}
+	var snapshots []prominfra.DORAMetricSnapshot
+	for _, groupBy := range []string{doraGroupService, doraGroupTeam, doraGroupEnv} {
+		result := computeDORAMetrics(rows, groupBy, since, now, doraDefaultWindowDays)
+		for _, item := range result.Items {
+			snapshots = append(snapshots, doraSnapshot(groupBy, item))
+		}
+		if groupBy == doraGroupService {
+			snapshots = append(snapshots, doraSnapshot(doraGroupAll, result.Overall))
+		}
+	}
+	if err := pusher.PushDORAMetrics(ctx, snapshots); err != nil {
+		logger.L().Warn("push DORA metrics failed", logger.Error(err))
+	}
+}
+
+func doraSnapshot(groupBy string, item DORAMetricsItem) prominfra.DORAMetricSnapshot {
+	return prominfra.DORAMetricSnapshot{
+		GroupBy:              groupBy,
+		Key:                  item.Key,
+		Name:                 item.Name,
+		WindowDays:           doraDefaultWindowDays,
+		DeploymentsPerDay:    item.DeploymentFrequency,
+		LeadTimeSeconds:      item.LeadTimeSeconds,
+		ChangeFailureRate:    item.ChangeFailureRate,
+		TimeToRestoreSeconds: item.TimeToRestoreSeconds,
+	}
+}
@@ -0,0 +1,99 @@
+package deployment
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cy77cc/OpsPilot/internal/model"
+)
+
+func TestDORAMetrics_LeadTimeFailureRateAndRestore(t *testing.T) {
+	suite := newReleaseTestSuite(t)
+	if err := suite.db.AutoMigrate(&model.CICDServiceCIRun{}); err != nil {
+		t.Fatalf("migrate ci runs: %v", err)
+	}
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Second)
+	base := now.Add(-48 * time.Hour)
+
+	svc := suite.createTestService(t)
+	suite.db.Model(svc).Update("team_id", 7)
+	prod := &model.DeploymentTarget{Name: "prod", TargetType: "k8s", RuntimeType: "k8s", Env: "production", Status: "active"}
+	staging := &model.DeploymentTarget{Name: "staging", TargetType: "k8s", RuntimeType: "k8s", Env: "staging", Status: "active"}
+	suite.db.Create(prod)
+	suite.db.Create(staging)
+	run := &model.CICDServiceCIRun{ServiceID: svc.ID, CIConfigID: 1, TriggerType: "push", Status: "succeeded", TriggeredAt: base}
+	suite.db.Create(run)
+
+	verified := `{"passed":true}`
+	create := func(target *model.DeploymentTarget, status, strategy, verification string, at time.Time, ciRunID, source uint) *model.DeploymentRelease {
+		finished := at
+		r := &model.DeploymentRelease{
+			FinishedAt: &finished,
+			ServiceID:  svc.ID, TargetID: target.ID, RuntimeType: "k8s", Strategy: strategy, Status: status,
+			VerificationJSON: verification, CIRunID: ciRunID, SourceReleaseID: source, CreatedAt: at, UpdatedAt: at,
+		}
+		if err := suite.db.Create(r).Error; err != nil {
+			t.Fatalf("create release: %v", err)
+		}
+		return r
+	}
+	// 前置时间 10 分钟; 完成之后的更新 (如回滚标记) 不影响完成时间。
+	first := create(prod, releaseStatusApplied, "rolling", verified, base.Add(10*time.Minute), run.ID, 0)
+	suite.db.Model(first).UpdateColumn("updated_at", base.Add(5*time.Hour))
+	// 失败后 30 分钟由下一次验证通过的发布恢复。
+	create(prod, releaseStatusFailed, "rolling", "{}", base.Add(time.Hour), 0, 0)
+	create(prod, releaseStatusApplied, "rolling", verified, base.Add(90*time.Minute), 0, 0)
+	// 被回滚的发布计为失败, 回滚成功后 5 分钟恢复。
+	bad := create(prod, releaseStatusApplied, "rolling", verified, base.Add(3*time.Hour), 0, 0)
+	create(prod, releaseStatusRollback, "rollback", `{"rollback_succeeded":true}`, base.Add(3*time.Hour+5*time.Minute), 0, bad.ID)
+	// 其他环境不影响生产指标, 且仍有一个未恢复的失败。
+	create(staging, releaseStatusApplied, "rolling", verified, base.Add(time.Hour), 0, 0)
+	create(staging, releaseStatusFailed, "rolling", "{}", base.Add(2*time.Hour), 0, 0)
+
+	h := NewMetricsHandler(suite.svcCtx)
+	q := DORAMetricsQuery{GroupBy: doraGroupEnv}
+	if err := normalizeDORAQuery(&q); err != nil {
+		t.Fatalf("normalize: %v", err)
+	}
+	got, err := h.getDORAMetrics(ctx, q, now)
+	if err != nil {
+		t.Fatalf("dora metrics: %v", err)
+	}
+	if len(got.Items) != 2 || got.Items[0].Key != "production" || got.Items[1].Key != "staging" {
+		t.Fatalf("expected production and staging groups, got %+v", got.Items)
+	}
+	p := got.Items[0]
+	if p.Deployments != 2 || p.DeploymentFrequency != 0.07 {
+		t.Fatalf("expected 2 deployments over 30 days, got %d (%.2f/day)", p.Deployments, p.DeploymentFrequency)
+	}
+	if p.LeadTimeSamples != 1 || p.LeadTimeSeconds != 600 {
+		t.Fatalf("expected lead time of 600s, got %.0f from %d samples", p.LeadTimeSeconds, p.LeadTimeSamples)
+	}
+	if p.ChangeAttempts != 4 || p.ChangeFailures != 2 || p.ChangeFailureRate != 50 {
+		t.Fatalf("expected 2/4 failed changes, got %d/%d (%.2f%%)", p.ChangeFailures, p.ChangeAttempts, p.ChangeFailureRate)
+	}
+	if p.Restores != 2 || p.TimeToRestoreSeconds != 1050 {
+		t.Fatalf("expected median restore of 1050s over 2 restores, got %.0f over %d", p.TimeToRestoreSeconds, p.Restores)
+	}
+	if s := got.Items[1]; s.Unrestored != 1 || s.Restores != 0 {
+		t.Fatalf("expected staging failure to stay unrestored, got %+v", s)
+	}
+	if got.Overall.ChangeAttempts != 6 || got.Overall.ChangeFailures != 3 {
+		t.Fatalf("unexpected overall metrics: %+v", got.Overall)
+	}
+
+	q = DORAMetricsQuery{GroupBy: doraGroupTeam, Env: "production"}
+	_ = normalizeDORAQuery(&q)
+	byTeam, err := h.getDORAMetrics(ctx, q, now)
+	if err != nil {
+		t.Fatalf("dora by team: %v", err)
+	}
+	if len(byTeam.Items) != 1 || byTeam.Items[0].Key != "7" || byTeam.Items[0].ChangeAttempts != 4 {
+		t.Fatalf("expected team 7 with production releases only, got %+v", byTeam.Items)
+	}
+	if err := normalizeDORAQuery(&DORAMetricsQuery{GroupBy: "cluster"}); err == nil {
+		t.Fatal("expected unknown group_by to be rejected")
+	}
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/cy77cc/OpsPilot/internal/httpx"
 	"github.com/cy77cc/OpsPilot/internal/model"
+	"github.com/cy77cc/OpsPilot/internal/service/deployment/admission"
 	"github.com/cy77cc/OpsPilot/internal/svc"
 	"github.com/cy77cc/OpsPilot/internal/xcode"
 	"github.com/gin-gonic/gin"
@@ -29,7 +30,7 @@ type listPoliciesReq struct {
 
 type createPolicyReq struct {
 	Name     string                 `json:"name" binding:"required"`
-	Type     string                 `json:"type" binding:"required,oneof=traffic resilience access slo"`
+	Type     string                 `json:"type" binding:"required,oneof=traffic resilience access slo approval promotion admission"`
 	TargetID uint                   `json:"target_id"`
 	Config   map[string]interface{} `json:"config"`
 	Enabled  bool                   `json:"enabled"`
@@ -93,6 +94,11 @@ func (h *PolicyHandler) CreatePolicy(c *gin.Context) {
 		return
 	}
 
+	if err := validatePolicyConfig(req.Type, req.Config); err != nil {
+		httpx.Fail(c, xcode.ParamError, err.Error())
+		return
+	}
+
 	ctx := c.Request.Context()
 	policy, err := h.createPolicy(ctx, req)
 	if err != nil {
@@ -103,6 +109,21 @@ func (h *PolicyHandler) CreatePolicy(c *gin.Context) {
 	httpx.OK(c, policy)
 }
 
+// validatePolicyConfig 校验带结构化规则的策略配置 (审批、晋级)。
+func validatePolicyConfig(policyType string, config map[string]any) error {
+	switch policyType {
+	case model.PolicyTypeApproval:
+		_, err := parseApprovalRule(config)
+		return err
+	case model.PolicyTypePromotion:
+		_, err := parsePromotionRule(config)
+		return err
+	case model.PolicyTypeAdmission:
+		return admission.Validate(config)
+	}
+	return nil
+}
+
 // UpdatePolicy 更新策略
 func (h *PolicyHandler) UpdatePolicy(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
@@ -118,6 +139,21 @@ func (h *PolicyHandler) UpdatePolicy(c *gin.Context) {
 	}
 
 	ctx := c.Request.Context()
+	if req.Config != nil || req.Type != "" {
+		existing, err := h.getPolicy(ctx, uint(id))
+		if err != nil {
+			httpx.Fail(c, xcode.NotFound, "policy not found")
+			return
+		}
+		config := req.Config
+		if config == nil {
+			config = existing.Config
+		}
+		if err := validatePolicyConfig(defaultIfEmpty(req.Type, existing.Type), config); err != nil {
+			httpx.Fail(c, xcode.ParamError, err.Error())
+			return
+		}
+	}
 	policy, err := h.updatePolicy(ctx, uint(id), req)
 	if err != nil {
 		httpx.Fail(c, xcode.NotFound, "policy not found")
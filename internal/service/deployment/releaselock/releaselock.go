@@ -0,0 +1,237 @@
+// Package releaselock 实现部署目标级的发布锁, 保证同一目标上同一时刻只有一个发布在执行。
+//
+// 锁以租约形式存在: 持有者需要在 TTL 内续约, 进程崩溃后租约自然过期, 其他进程即可接手。
+// 锁优先保存在 Redis 中, Redis 未配置或不可用时回退到 deployment_target_locks 表。
+package releaselock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cy77cc/OpsPilot/internal/model"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+const (
+	BackendRedis = "redis"
+	BackendDB    = "db"
+
+	keyPrefix = "deploy:release-lock:target:"
+)
+
+// Lease 描述某个目标上当前的锁持有情况。
+type Lease struct {
+	TargetID   uint      `json:"target_id"`
+	ReleaseID  uint      `json:"release_id"`
+	Owner      string    `json:"owner"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Backend    string    `json:"backend"`
+}
+
+// 续约与释放只在值前缀匹配时生效, 避免误删已被他人接手的锁。
+var (
+	renewScript = redis.NewScript(`
+local v = redis.call('GET', KEYS[1])
+if v and string.sub(v, 1, string.len(ARGV[1])) == ARGV[1] then
+  return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0`)
+	releaseScript = redis.NewScript(`
+local v = redis.call('GET', KEYS[1])
+if v and string.sub(v, 1, string.len(ARGV[1])) == ARGV[1] then
+  return redis.call('DEL', KEYS[1])
+end
+return 0`)
+)
+
+// Locker 获取、续约与释放目标锁。
+type Locker struct {
+	db    *gorm.DB
+	rdb   redis.UniversalClient
+	owner string
+	ttl   time.Duration
+}
+
+// New 创建锁管理器, owner 为空时使用 "主机名:进程号"。
+func New(db *gorm.DB, rdb redis.UniversalClient, owner string, ttl time.Duration) *Locker {
+	if strings.TrimSpace(owner) == "" {
+		host, _ := os.Hostname()
+		owner = fmt.Sprintf("%s:%d", host, os.Getpid())
+	}
+	return &Locker{db: db, rdb: rdb, owner: owner, ttl: ttl}
+}
+
+// Owner 返回本进程的持有者标识。
+func (l *Locker) Owner() string { return l.owner }
+
+// TTL 返回租约时长。
+func (l *Locker) TTL() time.Duration { return l.ttl }
+
+func redisKey(targetID uint) string { return keyPrefix + strconv.FormatUint(uint64(targetID), 10) }
+
+// 值格式: release_id|owner|acquired_unix_ms
+func encodeValue(releaseID uint, owner string, at time.Time) string {
+	return fmt.Sprintf("%d|%s|%d", releaseID, owner, at.UnixMilli())
+}
+
+func releasePrefix(releaseID uint) string { return fmt.Sprintf("%d|", releaseID) }
+
+func decodeValue(targetID uint, v string) (*Lease, error) {
+	parts := strings.Split(v, "|")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid lock value %q", v)
+	}
+	rid, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid lock value %q", v)
+	}
+	ms, _ := strconv.ParseInt(parts[2], 10, 64)
+	return &Lease{TargetID: targetID, ReleaseID: uint(rid), Owner: parts[1], AcquiredAt: time.UnixMilli(ms), Backend: BackendRedis}, nil
+}
+
+// redisFailed 判断 Redis 错误是否应回退到数据库。redis.Nil 表示键不存在, 不属于故障。
+func redisFailed(err error) bool {
+	return err != nil && !errors.Is(err, redis.Nil)
+}
+
+// Acquire 尝试为发布获取目标锁。已由同一发布持有时视为成功并续约。
+// 获取失败时返回当前持有者。
+func (l *Locker) Acquire(ctx context.Context, targetID, releaseID uint) (*Lease, bool, error) {
+	if l.rdb != nil {
+		lease, ok, err := l.acquireRedis(ctx, targetID, releaseID)
+		if !redisFailed(err) {
+			return lease, ok, err
+		}
+	}
+	return l.acquireDB(ctx, targetID, releaseID)
+}
+
+func (l *Locker) acquireRedis(ctx context.Context, targetID, releaseID uint) (*Lease, bool, error) {
+	// Redis 恢复前在数据库中获得的锁仍然有效, 先检查数据库后备记录。
+	if held, err := l.getDB(ctx, targetID); err == nil && held != nil && held.ReleaseID != releaseID {
+		return held, false, nil
+	}
+	now := time.Now()
+	ok, err := l.rdb.SetNX(ctx, redisKey(targetID), encodeValue(releaseID, l.owner, now), l.ttl).Result()
+	if err != nil {
+		return nil, false, err
+	}
+	if ok {
+		return &Lease{TargetID: targetID, ReleaseID: releaseID, Owner: l.owner, AcquiredAt: now, ExpiresAt: now.Add(l.ttl), Backend: BackendRedis}, true, nil
+	}
+	held, err := l.getRedis(ctx, targetID)
+	if err != nil {
+		return nil, false, err
+	}
+	if held != nil && held.ReleaseID == releaseID {
+		// 同一发布重入 (例如接手暂停中的发布): 改写为本进程持有。
+		if err := l.rdb.Set(ctx, redisKey(targetID), encodeValue(releaseID, l.owner, held.AcquiredAt), l.ttl).Err(); err != nil {
+			return nil, false, err
+		}
+		held.Owner = l.owner
+		held.ExpiresAt = now.Add(l.ttl)
+		return held, true, nil
+	}
+	return held, false, nil
+}
+
+func (l *Locker) acquireDB(ctx context.Context, targetID, releaseID uint) (*Lease, bool, error) {
+	now := time.Now()
+	res := l.db.WithContext(ctx).Model(&model.DeploymentTargetLock{}).
+		Where("target_id = ? AND (expires_at < ? OR release_id = ?)", targetID, now, releaseID).
+		Updates(map[string]any{"release_id": releaseID, "owner": l.owner, "acquired_at": now, "expires_at": now.Add(l.ttl)})
+	if res.Error != nil {
+		return nil, false, res.Error
+	}
+	if res.RowsAffected == 0 {
+		row := model.DeploymentTargetLock{TargetID: targetID, ReleaseID: releaseID, Owner: l.owner, AcquiredAt: now, ExpiresAt: now.Add(l.ttl)}
+		if err := l.db.WithContext(ctx).Create(&row).Error; err != nil {
+			// 唯一索引冲突: 锁已被他人持有。
+			held, gerr := l.getDB(ctx, targetID)
+			if gerr != nil {
+				return nil, false, gerr
+			}
+			if held == nil {
+				return nil, false, err
+			}
+			return held, false, nil
+		}
+	}
+	return &Lease{TargetID: targetID, ReleaseID: releaseID, Owner: l.owner, AcquiredAt: now, ExpiresAt: now.Add(l.ttl), Backend: BackendDB}, true, nil
+}
+
+// Renew 延长本进程为发布持有的租约, 锁已不属于该发布时返回 false。
+func (l *Locker) Renew(ctx context.Context, targetID, releaseID uint) (bool, error) {
+	if l.rdb != nil {
+		n, err := renewScript.Run(ctx, l.rdb, []string{redisKey(targetID)}, releasePrefix(releaseID)+l.owner+"|", l.ttl.Milliseconds()).Int()
+		if !redisFailed(err) && n == 1 {
+			return true, nil
+		}
+	}
+	res := l.db.WithContext(ctx).Model(&model.DeploymentTargetLock{}).
+		Where("target_id = ? AND release_id = ? AND owner = ?", targetID, releaseID, l.owner).
+		Update("expires_at", time.Now().Add(l.ttl))
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected > 0, nil
+}
+
+// Release 释放发布持有的目标锁; 锁已属于其他发布时不做任何操作。
+func (l *Locker) Release(ctx context.Context, targetID, releaseID uint) error {
+	if l.rdb != nil {
+		// Redis 不可用时锁只可能在数据库中, 无论结果如何都继续清理数据库记录。
+		_, _ = releaseScript.Run(ctx, l.rdb, []string{redisKey(targetID)}, releasePrefix(releaseID)).Result()
+	}
+	return l.db.WithContext(ctx).Where("target_id = ? AND release_id = ?", targetID, releaseID).
+		Delete(&model.DeploymentTargetLock{}).Error
+}
+
+// Get 返回目标当前未过期的租约, 无人持有时返回 nil。
+func (l *Locker) Get(ctx context.Context, targetID uint) (*Lease, error) {
+	if l.rdb != nil {
+		lease, err := l.getRedis(ctx, targetID)
+		if err == nil && lease != nil {
+			return lease, nil
+		}
+	}
+	return l.getDB(ctx, targetID)
+}
+
+func (l *Locker) getRedis(ctx context.Context, targetID uint) (*Lease, error) {
+	key := redisKey(targetID)
+	v, err := l.rdb.Get(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	lease, err := decodeValue(targetID, v)
+	if err != nil {
+		return nil, err
+	}
+	if ttl, err := l.rdb.PTTL(ctx, key).Result(); err == nil && ttl > 0 {
+		lease.ExpiresAt = time.Now().Add(ttl)
+	}
+	return lease, nil
+}
+
+func (l *Locker) getDB(ctx context.Context, targetID uint) (*Lease, error) {
+	var row model.DeploymentTargetLock
+	err := l.db.WithContext(ctx).Where("target_id = ? AND expires_at >= ?", targetID, time.Now()).First(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Lease{TargetID: row.TargetID, ReleaseID: row.ReleaseID, Owner: row.Owner, AcquiredAt: row.AcquiredAt, ExpiresAt: row.ExpiresAt, Backend: BackendDB}, nil
+}
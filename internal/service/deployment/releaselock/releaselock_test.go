@@ -0,0 +1,98 @@
+package releaselock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/cy77cc/OpsPilot/internal/model"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:releaselock_"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&model.DeploymentTargetLock{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+func TestLocker_RedisExclusiveAndExpiry(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	db := newTestDB(t)
+	ctx := context.Background()
+	a := New(db, rdb, "node-a", time.Minute)
+	b := New(db, rdb, "node-b", time.Minute)
+
+	lease, ok, err := a.Acquire(ctx, 1, 10)
+	if err != nil || !ok || lease.Backend != BackendRedis {
+		t.Fatalf("expected redis lease, got %+v ok=%v err=%v", lease, ok, err)
+	}
+	held, ok, err := b.Acquire(ctx, 1, 11)
+	if err != nil || ok || held.ReleaseID != 10 || held.Owner != "node-a" {
+		t.Fatalf("expected release 10 to keep the lock, got %+v ok=%v err=%v", held, ok, err)
+	}
+	if renewed, _ := b.Renew(ctx, 1, 10); renewed {
+		t.Fatal("another process must not renew a lease it does not own")
+	}
+	if renewed, err := a.Renew(ctx, 1, 10); err != nil || !renewed {
+		t.Fatalf("owner renew failed: %v", err)
+	}
+
+	// 持有进程崩溃: 租约过期后其他发布可以获得锁。
+	mr.FastForward(2 * time.Minute)
+	if _, ok, err := b.Acquire(ctx, 1, 11); err != nil || !ok {
+		t.Fatalf("expected stale lease to be taken over, ok=%v err=%v", ok, err)
+	}
+	if err := a.Release(ctx, 1, 10); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if cur, _ := a.Get(ctx, 1); cur == nil || cur.ReleaseID != 11 {
+		t.Fatalf("releasing a lost lease must not drop the new holder, got %+v", cur)
+	}
+	if err := b.Release(ctx, 1, 11); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if cur, _ := a.Get(ctx, 1); cur != nil {
+		t.Fatalf("expected target to be free, got %+v", cur)
+	}
+}
+
+func TestLocker_FallsBackToDatabase(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	// 不可达的 Redis: 所有操作回退到数据库。
+	down := redis.NewClient(&redis.Options{Addr: "127.0.0.1:0", MaxRetries: -1})
+	a := New(db, down, "node-a", time.Minute)
+	b := New(db, nil, "node-b", time.Minute)
+
+	lease, ok, err := a.Acquire(ctx, 2, 20)
+	if err != nil || !ok || lease.Backend != BackendDB {
+		t.Fatalf("expected db lease, got %+v ok=%v err=%v", lease, ok, err)
+	}
+	if held, ok, _ := b.Acquire(ctx, 2, 21); ok || held == nil || held.ReleaseID != 20 {
+		t.Fatalf("expected db lock to be exclusive, got %+v ok=%v", held, ok)
+	}
+	if renewed, err := a.Renew(ctx, 2, 20); err != nil || !renewed {
+		t.Fatalf("db renew failed: %v", err)
+	}
+
+	db.Model(&model.DeploymentTargetLock{}).Where("target_id = ?", 2).Update("expires_at", time.Now().Add(-time.Second))
+	if cur, _ := b.Get(ctx, 2); cur != nil {
+		t.Fatalf("expired db lease must not be reported as held, got %+v", cur)
+	}
+	if _, ok, err := b.Acquire(ctx, 2, 21); err != nil || !ok {
+		t.Fatalf("expected expired db lease to be taken over, ok=%v err=%v", ok, err)
+	}
+	if renewed, _ := a.Renew(ctx, 2, 20); renewed {
+		t.Fatal("previous holder must not renew after takeover")
+	}
+}
@@ -3,6 +3,10 @@
 // 本文件注册部署相关的 HTTP 路由，包括：
 //   - 部署目标管理
 //   - 发布管理和审批
+//   - 目标发布锁与排队
+//   - 配置漂移检测与修复
+//   - 变更冻结窗口
+//   - 发布前后钩子
 //   - 集群引导
 //   - 凭证管理
 //   - 审计日志和指标统计
@@ -10,18 +14,24 @@
 package deployment
 
 import (
+	"context"
+
 	"github.com/cy77cc/OpsPilot/internal/middleware"
 	"github.com/cy77cc/OpsPilot/internal/svc"
 	"github.com/gin-gonic/gin"
 )
 
 // RegisterDeploymentHandlers 注册部署服务路由到 v1 组。
-func RegisterDeploymentHandlers(v1 *gin.RouterGroup, svcCtx *svc.ServiceContext) {
+// ctx 为服务器的生命周期, 发布队列、漂移检测和 DORA 导出等后台任务随其取消而退出。
+func RegisterDeploymentHandlers(ctx context.Context, v1 *gin.RouterGroup, svcCtx *svc.ServiceContext) {
 	h := NewHandler(svcCtx)
 	auditH := NewAuditHandler(svcCtx)
 	metricsH := NewMetricsHandler(svcCtx)
+	metricsH.StartDORAExport(ctx)
 	topologyH := NewTopologyHandler(svcCtx)
 	policyH := NewPolicyHandler(svcCtx)
+	h.StartReleaseQueue(ctx)
+	h.StartDriftDetection(ctx)
 	g := v1.Group("/deploy", middleware.JWTAuth())
 	{
 		g.GET("/targets", h.ListTargets)
@@ -30,15 +40,38 @@ func RegisterDeploymentHandlers(v1 *gin.RouterGroup, svcCtx *svc.ServiceContext)
 		g.PUT("/targets/:id", h.UpdateTarget)
 		g.DELETE("/targets/:id", h.DeleteTarget)
 		g.PUT("/targets/:id/nodes", h.PutTargetNodes)
+		g.GET("/targets/:id/queue", h.GetTargetReleaseQueue)
+		g.GET("/targets/:id/drift", h.GetTargetDrift)
+		g.POST("/targets/:id/drift/resync", h.ResyncTargetDrift)
 
 		g.POST("/releases/preview", h.PreviewRelease)
 		g.POST("/releases/apply", h.ApplyRelease)
 		g.POST("/releases/:id/approve", h.ApproveRelease)
 		g.POST("/releases/:id/reject", h.RejectRelease)
 		g.POST("/releases/:id/rollback", h.RollbackRelease)
+		g.POST("/releases/:id/pause", h.PauseRelease)
+		g.POST("/releases/:id/promote", h.PromoteRelease)
+		g.POST("/releases/:id/abort", h.AbortRelease)
+		g.POST("/releases/:id/cancel", h.CancelRelease)
+		g.POST("/releases/:id/promotion/preview", h.PreviewReleasePromotion)
+		g.POST("/releases/:id/promotion/apply", h.ApplyReleasePromotion)
 		g.GET("/releases", h.ListReleases)
 		g.GET("/releases/:id", h.GetRelease)
 		g.GET("/releases/:id/timeline", h.ListReleaseTimeline)
+		g.GET("/releases/:id/approval-votes", h.ListReleaseApprovalVotes)
+
+		// 变更冻结窗口
+		g.GET("/freeze-windows", h.ListFreezeWindows)
+		g.POST("/freeze-windows", h.CreateFreezeWindow)
+		g.PUT("/freeze-windows/:id", h.UpdateFreezeWindow)
+		g.DELETE("/freeze-windows/:id", h.DeleteFreezeWindow)
+		g.GET("/freeze-windows/check", h.CheckFreeze)
+
+		// 发布前后钩子
+		g.GET("/hooks", h.ListReleaseHooks)
+		g.POST("/hooks", h.CreateReleaseHook)
+		g.PUT("/hooks/:id", h.UpdateReleaseHook)
+		g.DELETE("/hooks/:id", h.DeleteReleaseHook)
 
 		g.POST("/clusters/bootstrap/preview", h.PreviewClusterBootstrap)
 		g.POST("/clusters/bootstrap/apply", h.ApplyClusterBootstrap)
@@ -56,6 +89,7 @@ func RegisterDeploymentHandlers(v1 *gin.RouterGroup, svcCtx *svc.ServiceContext)
 		// 指标统计
 		g.GET("/metrics/summary", metricsH.GetMetricsSummary)
 		g.GET("/metrics/trends", metricsH.GetMetricsTrends)
+		g.GET("/metrics/dora", metricsH.GetDORAMetrics)
 
 		// 部署拓扑
 		g.GET("/topology", topologyH.GetTopology)
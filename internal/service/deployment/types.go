@@ -1,6 +1,11 @@
 package deployment
 
-import "time"
+import (
+	"time"
+
+	"github.com/cy77cc/OpsPilot/internal/model"
+	"github.com/cy77cc/OpsPilot/internal/service/deployment/releaselock"
+)
 
 type TargetNodeReq struct {
 	HostID uint   `json:"host_id"`
@@ -19,6 +24,7 @@ type TargetUpsertReq struct {
 	ProjectID      uint            `json:"project_id"`
 	TeamID         uint            `json:"team_id"`
 	Env            string          `json:"env"`
+	VerifyTimeout  int             `json:"verify_timeout_seconds"`
 	Nodes          []TargetNodeReq `json:"nodes"`
 }
 
@@ -45,22 +51,39 @@ type TargetResp struct {
 	Env             string           `json:"env"`
 	Status          string           `json:"status"`
 	ReadinessStatus string           `json:"readiness_status"`
+	VerifyTimeout   int              `json:"verify_timeout_seconds"`
 	Nodes           []TargetNodeResp `json:"nodes,omitempty"`
 	CreatedAt       time.Time        `json:"created_at"`
 	UpdatedAt       time.Time        `json:"updated_at"`
 }
 
+// ReleaseArtifact 是发布固定的 CI 制品。
+type ReleaseArtifact struct {
+	ID        uint
+	Digest    string
+	CommitSHA string
+}
+
 type ReleasePreviewReq struct {
 	ServiceID      uint              `json:"service_id" binding:"required"`
 	TargetID       uint              `json:"target_id" binding:"required"`
 	Env            string            `json:"env"`
 	Strategy       string            `json:"strategy"`
+	StrategyConfig map[string]any    `json:"strategy_config,omitempty"`
 	Variables      map[string]string `json:"variables"`
 	TriggerSource  string            `json:"trigger_source,omitempty"` // manual|ci
 	TriggerContext map[string]any    `json:"trigger_context,omitempty"`
 	CIRunID        uint              `json:"ci_run_id,omitempty"`
+	Artifact       *ReleaseArtifact  `json:"-"`              // 由 CI/CD 固定的制品, 不接受客户端传入
 	ApprovalToken  string            `json:"approval_token"` // backward compatibility
 	PreviewToken   string            `json:"preview_token"`
+	// EmergencyOverride 在冻结窗口内强制发起发布, 需要 OverrideReason 与 deploy:freeze:override 权限,
+	// 且发布必须经过不可自审的审批。
+	EmergencyOverride bool   `json:"emergency_override,omitempty"`
+	OverrideReason    string `json:"override_reason,omitempty"`
+
+	// promotion 由晋级接口填充, 清单直接取自晋级计划而不是重新渲染服务模板。
+	promotion *promotionPlan
 }
 
 type ReleasePreviewResp struct {
@@ -70,6 +93,59 @@ type ReleasePreviewResp struct {
 	Runtime          string              `json:"runtime"`
 	PreviewToken     string              `json:"preview_token,omitempty"`
 	PreviewExpiresAt *time.Time          `json:"preview_expires_at,omitempty"`
+	// PruneObjects 是上一次发布拥有、本次清单中已移除, 应用时将被清理的对象。
+	PruneObjects []ReleaseInventoryItem `json:"prune_objects,omitempty"`
+	// Diff 是服务端 dry-run 结果与线上状态的逐对象差异, 仅 k8s 目标且集群可达时返回。
+	Diff []ReleaseObjectDiff `json:"diff,omitempty"`
+	// Promotion 仅在晋级预览时返回, 说明源发布、环境跃迁与重新取值的变量。
+	Promotion *ReleasePromotionResp `json:"promotion,omitempty"`
+}
+
+// ReleasePromotionReq 把一次已验证通过的发布晋级到下一环境的目标上。
+type ReleasePromotionReq struct {
+	TargetID          uint           `json:"target_id" binding:"required"`
+	Strategy          string         `json:"strategy"`
+	StrategyConfig    map[string]any `json:"strategy_config,omitempty"`
+	PreviewToken      string         `json:"preview_token"`
+	EmergencyOverride bool           `json:"emergency_override,omitempty"`
+	OverrideReason    string         `json:"override_reason,omitempty"`
+}
+
+type ReleasePromotionResp struct {
+	SourceReleaseID    uint     `json:"source_release_id"`
+	SourceTargetID     uint     `json:"source_target_id"`
+	RevisionID         uint     `json:"revision_id"`
+	FromEnv            string   `json:"from_env"`
+	ToEnv              string   `json:"to_env"`
+	Path               []string `json:"path"`
+	PolicyID           uint     `json:"policy_id,omitempty"`
+	Images             []string `json:"images"`
+	ReappliedVariables []string `json:"reapplied_variables"`
+}
+
+// ReleaseObjectDiff 描述单个对象在本次发布中的变化: create/change/unchanged/prune/error。
+type ReleaseObjectDiff struct {
+	Object    ReleaseInventoryItem `json:"object"`
+	Action    string               `json:"action"`
+	Changes   []ReleaseFieldChange `json:"changes,omitempty"`
+	Truncated bool                 `json:"truncated,omitempty"`
+	Error     string               `json:"error,omitempty"`
+}
+
+// ReleaseFieldChange 是对象中单个字段的变化, Path 为点分路径。
+type ReleaseFieldChange struct {
+	Path   string `json:"path"`
+	Before any    `json:"before,omitempty"`
+	After  any    `json:"after,omitempty"`
+}
+
+// ReleaseInventoryItem 标识发布下发的一个集群对象。
+type ReleaseInventoryItem struct {
+	Group     string `json:"group,omitempty"`
+	Version   string `json:"version"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
 }
 
 type ReleaseApplyResp struct {
@@ -82,8 +158,35 @@ type ReleaseApplyResp struct {
 	CIRunID          uint   `json:"ci_run_id,omitempty"`
 	ApprovalRequired bool   `json:"approval_required,omitempty"`
 	ApprovalTicket   string `json:"approval_ticket,omitempty"`
-	LifecycleState   string `json:"lifecycle_state,omitempty"`
-	ReasonCode       string `json:"reason_code,omitempty"`
+	// RequiredApprovals/ApprovedCount 描述审批法定票数与当前通过票数。
+	RequiredApprovals int    `json:"required_approvals,omitempty"`
+	ApprovedCount     int    `json:"approved_count,omitempty"`
+	ApprovalSource    string `json:"approval_source,omitempty"`
+	LifecycleState    string `json:"lifecycle_state,omitempty"`
+	ReasonCode        string `json:"reason_code,omitempty"`
+	// QueuePosition 为发布在目标队列中的位置 (从 1 开始), 0 表示已直接执行。
+	QueuePosition       int  `json:"queue_position,omitempty"`
+	LockHolderReleaseID uint `json:"lock_holder_release_id,omitempty"`
+}
+
+// TargetReleaseQueueResp 描述目标锁的持有者与排队中的发布。
+type TargetReleaseQueueResp struct {
+	TargetID uint               `json:"target_id"`
+	Lock     *releaselock.Lease `json:"lock,omitempty"`
+	Running  *ReleaseQueueItem  `json:"running,omitempty"`
+	Queued   []ReleaseQueueItem `json:"queued"`
+}
+
+type ReleaseQueueItem struct {
+	Position      int       `json:"position"`
+	ReleaseID     uint      `json:"release_id"`
+	ServiceID     uint      `json:"service_id"`
+	Status        string    `json:"status"`
+	Strategy      string    `json:"strategy"`
+	TriggerSource string    `json:"trigger_source"`
+	Operator      uint      `json:"operator"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
 }
 
 type ReleaseSummaryResp struct {
@@ -97,6 +200,9 @@ type ReleaseSummaryResp struct {
 	TriggerSource      string     `json:"trigger_source,omitempty"`
 	TriggerContextJSON string     `json:"trigger_context_json,omitempty"`
 	CIRunID            uint       `json:"ci_run_id,omitempty"`
+	ArtifactID         uint       `json:"artifact_id,omitempty"`
+	ArtifactDigest     string     `json:"artifact_digest,omitempty"`
+	CommitSHA          string     `json:"commit_sha,omitempty"`
 	RevisionID         uint       `json:"revision_id"`
 	SourceReleaseID    uint       `json:"source_release_id"`
 	TargetRevision     string     `json:"target_revision"`
@@ -104,6 +210,9 @@ type ReleaseSummaryResp struct {
 	LifecycleState     string     `json:"lifecycle_state"`
 	DiagnosticsJSON    string     `json:"diagnostics_json"`
 	VerificationJSON   string     `json:"verification_json"`
+	StrategyStateJSON  string     `json:"strategy_state_json,omitempty"`
+	InventoryJSON      string     `json:"inventory_json,omitempty"`
+	PrunedJSON         string     `json:"pruned_json,omitempty"`
 	CreatedAt          time.Time  `json:"created_at"`
 	UpdatedAt          time.Time  `json:"updated_at"`
 	PreviewExpiresAt   *time.Time `json:"preview_expires_at,omitempty"`
@@ -216,3 +325,72 @@ type ClusterCredentialTestResp struct {
 	Message      string `json:"message"`
 	LatencyMS    int64  `json:"latency_ms,omitempty"`
 }
+
+// FreezeWindowUpsertReq 是创建或更新冻结窗口的请求。
+type FreezeWindowUpsertReq struct {
+	Name            string     `json:"name" binding:"required"`
+	Reason          string     `json:"reason"`
+	Env             string     `json:"env"`
+	ProjectID       uint       `json:"project_id"`
+	TargetID        uint       `json:"target_id"`
+	WindowType      string     `json:"window_type" binding:"required"`
+	StartAt         *time.Time `json:"start_at"`
+	EndAt           *time.Time `json:"end_at"`
+	Cron            string     `json:"cron"`
+	DurationMinutes int        `json:"duration_minutes"`
+	Timezone        string     `json:"timezone"`
+	OverrideRoles   []string   `json:"override_roles"`
+	Enabled         *bool      `json:"enabled"`
+}
+
+// FreezeWindowResp 是冻结窗口及其当前状态。
+type FreezeWindowResp struct {
+	model.DeploymentFreezeWindow
+	Active      bool       `json:"active"`
+	ActiveUntil *time.Time `json:"active_until,omitempty"`
+}
+
+// FreezeCheckResp 是某次发布作用域的冻结检查结果。
+type FreezeCheckResp struct {
+	Frozen  bool               `json:"frozen"`
+	Message string             `json:"message,omitempty"`
+	Windows []FreezeWindowResp `json:"windows"`
+}
+
+// ReleaseHookUpsertReq 是创建或更新发布钩子的请求。
+type ReleaseHookUpsertReq struct {
+	Name           string         `json:"name" binding:"required"`
+	ServiceID      uint           `json:"service_id"`
+	TargetID       uint           `json:"target_id"`
+	Phase          string         `json:"phase" binding:"required"`
+	Kind           string         `json:"kind" binding:"required"`
+	SortOrder      int            `json:"sort_order"`
+	Config         map[string]any `json:"config"`
+	TimeoutSeconds int            `json:"timeout_seconds"`
+	OnFailure      string         `json:"on_failure"`
+	Enabled        *bool          `json:"enabled"`
+}
+
+// TargetDriftResp 是部署目标的配置漂移检查结果。
+type TargetDriftResp struct {
+	TargetID  uint           `json:"target_id"`
+	CheckedAt time.Time      `json:"checked_at"`
+	Drifted   bool           `json:"drifted"`
+	Services  []ServiceDrift `json:"services"`
+}
+
+// ServiceDrift 是服务最近一次成功发布的快照与线上对象的差异。
+// 字段变化中 Before 为快照中的期望值, After 为线上值。
+type ServiceDrift struct {
+	ServiceID   uint                `json:"service_id"`
+	ServiceName string              `json:"service_name"`
+	ReleaseID   uint                `json:"release_id"`
+	Drifted     bool                `json:"drifted"`
+	Objects     []ReleaseObjectDiff `json:"objects"`
+	FindingID   uint                `json:"finding_id,omitempty"`
+}
+
+// DriftResyncReq 重新应用发布快照以消除漂移; ServiceID 为 0 表示目标上全部漂移的服务。
+type DriftResyncReq struct {
+	ServiceID uint `json:"service_id"`
+}
@@ -408,11 +408,17 @@ func (s *HostService) persistHealthSnapshot(ctx context.Context, snapshot *model
 }
 
 func (s *HostService) loadNodePrivateKey(ctx context.Context, node *model.Node) (string, string, error) {
+	return LoadNodePrivateKey(ctx, s.svcCtx.DB, node)
+}
+
+// LoadNodePrivateKey 读取主机绑定的 SSH 私钥与口令, 加密保存的私钥用 security.encryption_key 解密。
+// 主机未绑定私钥时返回空字符串。
+func LoadNodePrivateKey(ctx context.Context, db *gorm.DB, node *model.Node) (string, string, error) {
 	if node == nil || node.SSHKeyID == nil {
 		return "", "", nil
 	}
 	var key model.SSHKey
-	if err := s.svcCtx.DB.WithContext(ctx).
+	if err := db.WithContext(ctx).
 		Select("id", "private_key", "passphrase", "encrypted").
 		Where("id = ?", uint64(*node.SSHKeyID)).
 		First(&key).Error; err != nil {
@@ -422,6 +428,9 @@ func (s *HostService) loadNodePrivateKey(ctx context.Context, node *model.Node)
 	if !key.Encrypted {
 		return strings.TrimSpace(key.PrivateKey), passphrase, nil
 	}
+	if strings.TrimSpace(config.CFG.Security.EncryptionKey) == "" {
+		return "", "", fmt.Errorf("security.encryption_key is required")
+	}
 	privateKey, err := utils.DecryptText(strings.TrimSpace(key.PrivateKey), config.CFG.Security.EncryptionKey)
 	if err != nil {
 		return "", "", fmt.Errorf("decrypt private key: %w", err)
@@ -0,0 +1,341 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	sshclient "github.com/cy77cc/OpsPilot/internal/client/ssh"
+	"github.com/cy77cc/OpsPilot/internal/config"
+	"github.com/cy77cc/OpsPilot/internal/logger"
+	"github.com/cy77cc/OpsPilot/internal/model"
+	hostlogic "github.com/cy77cc/OpsPilot/internal/service/host/logic"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	defaultParallelism = 5
+	defaultJobTimeout  = 300 * time.Second
+	// stopPollInterval 是执行中检查是否被其他副本停止的间隔。
+	stopPollInterval = time.Second
+	// maxOutputBytes 是执行记录中保存的标准输出/标准错误的最大长度, 超出时只保留末尾, 完整输出见实时日志流。
+	maxOutputBytes = 64 << 10
+)
+
+// hostRunner 在一台目标主机上执行任务命令。
+type hostRunner interface {
+	// Run 执行命令, 标准输出与标准错误分别写入 stdout 与 stderr。
+	// 命令以非零状态退出时返回退出码和错误; ctx 结束时终止远程命令并返回 -1 与 ctx 的错误。
+	Run(ctx context.Context, cmd string, stdout, stderr io.Writer) (int, error)
+	Close() error
+}
+
+// sshHostRunner 通过 SSH 在目标主机上执行命令。
+type sshHostRunner struct {
+	client *ssh.Client
+}
+
+func (r *sshHostRunner) Run(ctx context.Context, cmd string, stdout, stderr io.Writer) (int, error) {
+	session, err := r.client.NewSession()
+	if err != nil {
+		return -1, err
+	}
+	defer session.Close()
+	session.Stdout = stdout
+	session.Stderr = stderr
+	done := make(chan error, 1)
+	go func() { done <- session.Run(cmd) }()
+	select {
+	case <-ctx.Done():
+		_ = session.Signal(ssh.SIGKILL)
+		_ = session.Close()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+		}
+		return -1, ctx.Err()
+	case err := <-done:
+		if err == nil {
+			return 0, nil
+		}
+		var exitErr *ssh.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitStatus(), fmt.Errorf("exit status %d", exitErr.ExitStatus())
+		}
+		return -1, err
+	}
+}
+
+func (r *sshHostRunner) Close() error { return r.client.Close() }
+
+// dialSSH 使用主机的 SSH 凭据建立连接。
+func (l *Logic) dialSSH(ctx context.Context, node *model.Node) (hostRunner, error) {
+	privateKey, passphrase, err := hostlogic.LoadNodePrivateKey(ctx, l.svcCtx.DB, node)
+	if err != nil {
+		return nil, err
+	}
+	password := strings.TrimSpace(node.SSHPassword)
+	if strings.TrimSpace(privateKey) != "" {
+		password = ""
+	}
+	cli, err := sshclient.NewSSHClient(node.SSHUser, password, node.IP, node.Port, privateKey, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return &sshHostRunner{client: cli}, nil
+}
+
+// runJob 按任务的并发度在各主机上执行命令, 全部结束后汇总并返回任务状态。
+// 本进程内的停止通过取消 ctx 立即生效, 其他副本发起的停止通过轮询执行记录的 stopping 状态感知。
+func (l *Logic) runJob(parent context.Context, job model.Job, runID string, executions []model.JobExecution, nodes map[uint]model.Node) string {
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+	l.trackRun(job.ID, cancel)
+	defer l.untrackRun(job.ID)
+	go l.watchStop(ctx, runID, cancel)
+
+	sem := make(chan struct{}, jobParallelism(&job))
+	var wg sync.WaitGroup
+	for i := range executions {
+		execution := &executions[i]
+		if execution.Status == "skipped" {
+			continue
+		}
+		node := nodes[execution.HostID]
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			l.runOnHost(ctx, &job, execution, &node)
+		}()
+	}
+	wg.Wait()
+
+	counts := map[string]int{}
+	for _, execution := range executions {
+		counts[execution.Status]++
+	}
+	status := "success"
+	switch {
+	case counts["stopped"] > 0:
+		status = "stopped"
+	case counts["failed"] > 0 || counts["success"] == 0:
+		status = "failed"
+	}
+	now := time.Now()
+	bg := context.Background()
+	l.svcCtx.DB.WithContext(bg).Model(&model.Job{}).Where("id = ?", job.ID).Updates(map[string]any{
+		"status":     status,
+		"updated_at": now,
+	})
+	level := "info"
+	if status != "success" {
+		level = "error"
+	}
+	l.jobLog(bg, job.ID, 0, level, fmt.Sprintf("Job %d run %s finished: %s (%d succeeded, %d failed, %d skipped, %d stopped)",
+		job.ID, runID, status, counts["success"], counts["failed"], counts["skipped"], counts["stopped"]))
+	return status
+}
+
+// runOnHost 在一台主机上执行任务命令, 输出写入执行的实时日志流, 结果写回执行记录。
+func (l *Logic) runOnHost(ctx context.Context, job *model.Job, execution *model.JobExecution, node *model.Node) {
+	bg := context.Background()
+	stream, err := l.logs.Open(bg, executionStream(execution.ID))
+	if err != nil {
+		logger.L().Warn("open job execution log stream failed", logger.Error(err))
+	}
+	defer func() {
+		_ = stream.Close()
+		if err := l.logs.Complete(bg, executionStream(execution.ID)); err != nil {
+			logger.L().Warn("compact job execution logs failed", logger.Error(err))
+		}
+	}()
+
+	if ctx.Err() != nil {
+		l.finishExecution(execution, "stopped", -1, "", "", "stopped before start")
+		return
+	}
+	res := l.svcCtx.DB.WithContext(bg).Model(&model.JobExecution{}).
+		Where("id = ? AND status = ?", execution.ID, "pending").
+		Updates(map[string]any{"status": "running", "start_time": time.Now()})
+	if res.Error == nil && res.RowsAffected == 0 {
+		l.finishExecution(execution, "stopped", -1, "", "", "stopped before start")
+		return
+	}
+	stream.Linef("==> running on %s (%s)", node.Name, node.IP)
+
+	runner, err := l.dial(ctx, node)
+	if err != nil {
+		stream.Linef("==> connect failed: %v", err)
+		l.finishExecution(execution, "failed", -1, "", "", "connect: "+err.Error())
+		return
+	}
+	defer runner.Close()
+
+	timeout := jobTimeout(job)
+	hostCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	stdout := &tailBuffer{limit: maxOutputBytes}
+	stderr := &tailBuffer{limit: maxOutputBytes}
+	outLog, errLog := stream.Writer(""), stream.Writer("")
+	code, err := runner.Run(hostCtx, job.Command, io.MultiWriter(stdout, outLog), io.MultiWriter(stderr, errLog))
+	_ = outLog.Close()
+	_ = errLog.Close()
+
+	status, message := "success", ""
+	switch {
+	case err == nil:
+	case ctx.Err() != nil:
+		status, code, message = "stopped", -1, "stopped by user"
+	case hostCtx.Err() != nil:
+		status, code, message = "failed", -1, fmt.Sprintf("command timed out after %s", timeout)
+	default:
+		status, message = "failed", err.Error()
+	}
+	if message != "" {
+		stream.Linef("==> %s", message)
+	}
+	stream.Linef("==> exit code %d", code)
+	l.finishExecution(execution, status, code, stdout.String(), stderr.String(), message)
+}
+
+// finishExecution 写入主机执行的结果并同步到内存中的记录, 供汇总任务状态使用。
+func (l *Logic) finishExecution(execution *model.JobExecution, status string, code int, stdout, stderr, message string) {
+	now := time.Now()
+	execution.Status = status
+	bg := context.Background()
+	err := l.svcCtx.DB.WithContext(bg).Model(&model.JobExecution{}).Where("id = ?", execution.ID).Updates(map[string]any{
+		"status":        status,
+		"exit_code":     code,
+		"output":        stdout,
+		"stderr":        stderr,
+		"error_message": message,
+		"end_time":      now,
+	}).Error
+	if err != nil {
+		logger.L().Warn("save job execution failed", logger.Int("execution_id", int(execution.ID)), logger.Error(err))
+	}
+	target := "host " + execution.HostIP
+	if execution.K8sJob != "" {
+		target = "kubernetes job " + execution.K8sJob
+	}
+	level, text := "info", fmt.Sprintf("Job %d on %s %s (exit code %d)", execution.JobID, target, status, code)
+	if status != "success" {
+		level = "error"
+		if message != "" {
+			text += ": " + message
+		}
+	}
+	l.jobLog(bg, execution.JobID, execution.ID, level, text)
+}
+
+// watchStop 轮询本次运行的执行记录, 发现被标记为 stopping 时取消运行。
+func (l *Logic) watchStop(ctx context.Context, runID string, cancel context.CancelFunc) {
+	ticker := time.NewTicker(stopPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		var count int64
+		if err := l.svcCtx.DB.WithContext(ctx).Model(&model.JobExecution{}).
+			Where("run_id = ? AND status = ?", runID, "stopping").Count(&count).Error; err == nil && count > 0 {
+			cancel()
+			return
+		}
+	}
+}
+
+func (l *Logic) trackRun(jobID uint, cancel context.CancelFunc) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.running[jobID] = cancel
+}
+
+func (l *Logic) untrackRun(jobID uint) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.running, jobID)
+}
+
+// cancelRun 取消本进程内任务正在进行的运行, 返回是否存在这样的运行。
+func (l *Logic) cancelRun(jobID uint) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	cancel, ok := l.running[jobID]
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+func jobTimeout(job *model.Job) time.Duration {
+	if job.Timeout <= 0 {
+		return defaultJobTimeout
+	}
+	return time.Duration(job.Timeout) * time.Second
+}
+
+func jobParallelism(job *model.Job) int {
+	if job.Parallelism > 0 {
+		return job.Parallelism
+	}
+	if config.CFG.Jobs.Parallelism > 0 {
+		return config.CFG.Jobs.Parallelism
+	}
+	return defaultParallelism
+}
+
+// parseHostIDs 解析以逗号或空白分隔的主机 ID 列表, 忽略无效与重复的 ID。
+func parseHostIDs(raw string) []uint {
+	fields := strings.FieldsFunc(raw, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '[' || r == ']'
+	})
+	out := make([]uint, 0, len(fields))
+	seen := make(map[uint]bool, len(fields))
+	for _, field := range fields {
+		id, err := strconv.ParseUint(strings.TrimSpace(field), 10, 64)
+		if err != nil || id == 0 || seen[uint(id)] {
+			continue
+		}
+		seen[uint(id)] = true
+		out = append(out, uint(id))
+	}
+	return out
+}
+
+// tailBuffer 收集命令输出, 超过 limit 时只保留末尾部分。
+type tailBuffer struct {
+	mu        sync.Mutex
+	buf       []byte
+	limit     int
+	truncated bool
+}
+
+func (w *tailBuffer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf, p...)
+	if len(w.buf) > w.limit {
+		w.buf = append(w.buf[:0], w.buf[len(w.buf)-w.limit:]...)
+		w.truncated = true
+	}
+	return len(p), nil
+}
+
+func (w *tailBuffer) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.truncated {
+		return "[opspilot] output truncated\n" + string(w.buf)
+	}
+	return string(w.buf)
+}
@@ -0,0 +1,236 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cy77cc/OpsPilot/internal/model"
+)
+
+// localRunners 在本机用 bash 代替 SSH 执行命令, 并记录同时执行的最大主机数。
+type localRunners struct {
+	active atomic.Int32
+	peak   atomic.Int32
+}
+
+func (r *localRunners) dial(_ context.Context, node *model.Node) (hostRunner, error) {
+	if strings.HasPrefix(node.Name, "unreachable") {
+		return nil, errors.New("dial tcp " + node.IP + ":22: connection refused")
+	}
+	return &localRunner{pool: r, host: node.Name}, nil
+}
+
+type localRunner struct {
+	pool *localRunners
+	host string
+}
+
+func (r *localRunner) Run(ctx context.Context, cmd string, stdout, stderr io.Writer) (int, error) {
+	n := r.pool.active.Add(1)
+	defer r.pool.active.Add(-1)
+	for {
+		peak := r.pool.peak.Load()
+		if n <= peak || r.pool.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	c := exec.CommandContext(ctx, "bash", "-c", cmd)
+	c.Env = []string{"PATH=/usr/bin:/bin", "HOST=" + r.host}
+	c.Stdout, c.Stderr = stdout, stderr
+	err := c.Run()
+	if ctx.Err() != nil {
+		return -1, ctx.Err()
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), err
+	}
+	if err != nil {
+		return -1, err
+	}
+	return 0, nil
+}
+
+func (r *localRunner) Close() error { return nil }
+
+// waitJob 等待任务的运行结束并返回任务。
+func waitJob(t *testing.T, l *Logic, jobID uint) *model.Job {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := l.getJob(context.Background(), jobID)
+		if err == nil && job.Status != "running" {
+			l.mu.Lock()
+			_, running := l.running[jobID]
+			l.mu.Unlock()
+			if !running {
+				return job
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("job %d did not finish", jobID)
+	return nil
+}
+
+// waitExecutionStatus 等待执行进入指定状态。
+func waitExecutionStatus(t *testing.T, l *Logic, jobID uint, status string) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		var count int64
+		l.svcCtx.DB.Model(&model.JobExecution{}).Where("job_id = ? AND status = ?", jobID, status).Count(&count)
+		if count > 0 {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("job %d has no %s execution", jobID, status)
+}
+
+func TestRunJobOnHosts(t *testing.T) {
+	l := newTestLogic(t)
+	ctx := context.Background()
+	l.svcCtx.DB.Create(&model.Node{ID: 5, Name: "unreachable-1", IP: "10.0.0.5", Status: "active"})
+
+	job, err := l.createJob(ctx, 1, createJobReq{
+		Name:    "disk-report",
+		Command: `echo "usage on $HOST"; echo "warn from $HOST" >&2; test "$HOST" != web-2 || exit 3`,
+		HostIDs: "1, 2,3,5,99,1",
+	})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	runID, err := l.startJob(ctx, job.ID)
+	if err != nil || runID == "" {
+		t.Fatalf("start: %q %v", runID, err)
+	}
+	if done := waitJob(t, l, job.ID); done.Status != "failed" {
+		t.Fatalf("expected failed job status, got %s", done.Status)
+	}
+
+	rows := executions(t, l, job.ID)
+	got := make(map[uint]model.JobExecution, len(rows))
+	for _, row := range rows {
+		if row.RunID != runID {
+			t.Fatalf("expected all executions in run %s, got %+v", runID, row)
+		}
+		got[row.HostID] = row
+	}
+	if len(rows) != 5 {
+		t.Fatalf("expected one execution per distinct host, got %d", len(rows))
+	}
+	if r := got[1]; r.Status != "success" || r.ExitCode != 0 || r.Output != "usage on web-1\n" || r.Stderr != "warn from web-1\n" || r.HostIP != "10.0.0.1" {
+		t.Fatalf("unexpected web-1 execution %+v", r)
+	}
+	if r := got[2]; r.Status != "failed" || r.ExitCode != 3 || r.Output != "usage on web-2\n" || !strings.Contains(r.ErrorMessage, "exit status 3") {
+		t.Fatalf("unexpected web-2 execution %+v", r)
+	}
+	if r := got[3]; r.Status != "skipped" || r.ErrorMessage != "kernel upgrade" || r.Output != "" {
+		t.Fatalf("expected maintenance host to be skipped, got %+v", r)
+	}
+	if r := got[5]; r.Status != "failed" || !strings.Contains(r.ErrorMessage, "connection refused") {
+		t.Fatalf("expected connect failure, got %+v", r)
+	}
+	if r := got[99]; r.Status != "skipped" || r.ErrorMessage != "host not found" {
+		t.Fatalf("expected unknown host to be skipped, got %+v", r)
+	}
+	text, _ := l.logs.Text(ctx, executionStream(got[1].ID))
+	if !strings.Contains(text, "==> running on web-1 (10.0.0.1)") || !strings.Contains(text, "usage on web-1") || !strings.Contains(text, "warn from web-1") {
+		t.Fatalf("expected host output in the execution log stream, got %q", text)
+	}
+	if logs := jobLogText(t, l, job.ID); !strings.Contains(logs, "finished: failed (1 succeeded, 2 failed, 2 skipped, 0 stopped)") {
+		t.Fatalf("expected run summary, got %q", logs)
+	}
+
+	// 没有命令或主机的任务不能执行。
+	empty, _ := l.createJob(ctx, 1, createJobReq{Name: "empty", Command: "true"})
+	if _, err := l.startJob(ctx, empty.ID); !errors.Is(err, ErrJobNotRunnable) {
+		t.Fatalf("expected job without hosts to be rejected, got %v", err)
+	}
+}
+
+func TestRunJobParallelismAndTimeout(t *testing.T) {
+	l := newTestLogic(t)
+	ctx := context.Background()
+	runners := &localRunners{}
+	l.dial = runners.dial
+
+	job, _ := l.createJob(ctx, 1, createJobReq{Name: "rolling", Command: "sleep 0.2", HostIDs: "1,2,4", Parallelism: 1})
+	if _, err := l.startJob(ctx, job.ID); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if done := waitJob(t, l, job.ID); done.Status != "success" || runners.peak.Load() != 1 {
+		t.Fatalf("expected hosts to run one at a time, status=%s peak=%d", done.Status, runners.peak.Load())
+	}
+	runners.peak.Store(0)
+	l.updateJob(ctx, job.ID, updateJobReq{Parallelism: 3})
+	l.startJob(ctx, job.ID)
+	if waitJob(t, l, job.ID); runners.peak.Load() != 3 {
+		t.Fatalf("expected hosts to run in parallel, peak=%d", runners.peak.Load())
+	}
+
+	slow, _ := l.createJob(ctx, 1, createJobReq{Name: "slow", Command: "echo begin; sleep 10", HostIDs: "1", Timeout: 1})
+	started := time.Now()
+	l.startJob(ctx, slow.ID)
+	if done := waitJob(t, l, slow.ID); done.Status != "failed" || time.Since(started) > 5*time.Second {
+		t.Fatalf("expected command to be killed on timeout, status=%s after %s", done.Status, time.Since(started))
+	}
+	rows := executions(t, l, slow.ID)
+	if rows[0].ExitCode != -1 || rows[0].ErrorMessage != "command timed out after 1s" || rows[0].Output != "begin\n" {
+		t.Fatalf("unexpected timed out execution %+v", rows[0])
+	}
+}
+
+func TestStopJobCancelsRemoteCommands(t *testing.T) {
+	l := newTestLogic(t)
+	ctx := context.Background()
+
+	job, _ := l.createJob(ctx, 1, createJobReq{Name: "long", Command: "sleep 30", HostIDs: "1,2,4", Parallelism: 2})
+	if _, err := l.startJob(ctx, job.ID); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	waitExecutionStatus(t, l, job.ID, "running")
+	started := time.Now()
+	if err := l.stopJob(ctx, job.ID); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if done := waitJob(t, l, job.ID); done.Status != "stopped" || time.Since(started) > 5*time.Second {
+		t.Fatalf("expected run to stop promptly, status=%s after %s", done.Status, time.Since(started))
+	}
+	for _, row := range executions(t, l, job.ID) {
+		if row.Status != "stopped" || row.EndTime == nil {
+			t.Fatalf("expected every host execution to be stopped, got %+v", row)
+		}
+	}
+
+	// 其他副本发起的停止: 执行记录被标记为 stopping, 运行所在的进程轮询后取消。
+	other, _ := l.createJob(ctx, 1, createJobReq{Name: "remote-stop", Command: "sleep 30", HostIDs: "1"})
+	l.startJob(ctx, other.ID)
+	waitExecutionStatus(t, l, other.ID, "running")
+	l.svcCtx.DB.Model(&model.JobExecution{}).Where("job_id = ?", other.ID).Update("status", "stopping")
+	if done := waitJob(t, l, other.ID); done.Status != "stopped" {
+		t.Fatalf("expected run to observe the stop request, got %s", done.Status)
+	}
+}
+
+func TestParseHostIDs(t *testing.T) {
+	for raw, want := range map[string]string{
+		"1,2,3":     "[1 2 3]",
+		" 4 5\n6 ":  "[4 5 6]",
+		"[7, 8, 7]": "[7 8]",
+		"0,x,-1,9":  "[9]",
+		"":          "[]",
+	} {
+		if got := fmt.Sprint(parseHostIDs(raw)); got != want {
+			t.Fatalf("parseHostIDs(%q) = %s, want %s", raw, got, want)
+		}
+	}
+}
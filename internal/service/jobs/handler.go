@@ -1,12 +1,15 @@
 package jobs
 
 import (
+	"context"
+	"errors"
 	"strconv"
 
 	"github.com/cy77cc/OpsPilot/internal/httpx"
 	"github.com/cy77cc/OpsPilot/internal/svc"
 	"github.com/cy77cc/OpsPilot/internal/xcode"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type Handler struct {
@@ -74,6 +77,10 @@ func (h *Handler) CreateJob(c *gin.Context) {
 
 	job, err := h.logic.createJob(c.Request.Context(), uint(httpx.UIDFromCtx(c)), req)
 	if err != nil {
+		if errors.Is(err, ErrInvalidSchedule) || errors.Is(err, ErrInvalidK8sJob) {
+			httpx.Fail(c, xcode.ParamError, err.Error())
+			return
+		}
 		httpx.ServerErr(c, err)
 		return
 	}
@@ -101,7 +108,7 @@ func (h *Handler) UpdateJob(c *gin.Context) {
 
 	job, err := h.logic.updateJob(c.Request.Context(), uint(id), req)
 	if err != nil {
-		httpx.Fail(c, xcode.NotFound, "job not found")
+		h.fail(c, err)
 		return
 	}
 
@@ -140,12 +147,55 @@ func (h *Handler) StartJob(c *gin.Context) {
 		return
 	}
 
-	if err := h.logic.startJob(c.Request.Context(), uint(id)); err != nil {
-		httpx.Fail(c, xcode.NotFound, "job not found")
+	runID, err := h.logic.startJob(c.Request.Context(), uint(id))
+	if err != nil {
+		h.fail(c, err)
 		return
 	}
 
-	httpx.OK(c, gin.H{"message": "started"})
+	httpx.OK(c, gin.H{"message": "started", "run_id": runID})
+}
+
+// PauseJob 暂停任务的定时触发
+func (h *Handler) PauseJob(c *gin.Context) {
+	if !httpx.Authorize(c, h.svcCtx.DB, "task:write", "task:*") {
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		httpx.Fail(c, xcode.ParamError, "invalid id")
+		return
+	}
+
+	job, err := h.logic.pauseJob(c.Request.Context(), uint(id))
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+
+	httpx.OK(c, job)
+}
+
+// ResumeJob 恢复任务的定时触发
+func (h *Handler) ResumeJob(c *gin.Context) {
+	if !httpx.Authorize(c, h.svcCtx.DB, "task:write", "task:*") {
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		httpx.Fail(c, xcode.ParamError, "invalid id")
+		return
+	}
+
+	job, err := h.logic.resumeJob(c.Request.Context(), uint(id))
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+
+	httpx.OK(c, job)
 }
 
 // StopJob 停止任务
@@ -215,3 +265,289 @@ func (h *Handler) GetJobLogs(c *gin.Context) {
 
 	httpx.OK(c, gin.H{"list": logs, "total": total})
 }
+
+// StreamExecutionLogs 跟随任务执行的实时日志, 支持 SSE 与 WebSocket, 通过 after 或 Last-Event-ID 断点续读。
+func (h *Handler) StreamExecutionLogs(c *gin.Context) {
+	if !httpx.Authorize(c, h.svcCtx.DB, "task:read", "task:*") {
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		httpx.Fail(c, xcode.ParamError, "invalid id")
+		return
+	}
+	executionID, err := strconv.ParseUint(c.Param("execution_id"), 10, 64)
+	if err != nil {
+		httpx.Fail(c, xcode.ParamError, "invalid execution id")
+		return
+	}
+
+	stream, err := h.logic.executionLogStream(c.Request.Context(), uint(id), uint(executionID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			httpx.Fail(c, xcode.NotFound, "execution not found")
+			return
+		}
+		httpx.ServerErr(c, err)
+		return
+	}
+
+	h.logic.logs.ServeFollow(c, stream, func(ctx context.Context) (bool, error) {
+		return h.logic.executionFinished(ctx, uint(executionID))
+	})
+}
+
+// StartScheduler 启动任务的后台调度器。
+func (h *Handler) StartScheduler() {
+	h.logic.StartScheduler(context.Background())
+}
+
+// fail 把任务操作的错误映射为响应。
+func (h *Handler) fail(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		httpx.Fail(c, xcode.NotFound, "job not found")
+	case errors.Is(err, ErrInvalidSchedule), errors.Is(err, ErrJobRunning), errors.Is(err, ErrJobNotRunnable), errors.Is(err, ErrInvalidK8sJob):
+		httpx.Fail(c, xcode.ParamError, err.Error())
+	default:
+		httpx.ServerErr(c, err)
+	}
+}
+
+// ListWorkflows 获取任务编排列表
+func (h *Handler) ListWorkflows(c *gin.Context) {
+	if !httpx.Authorize(c, h.svcCtx.DB, "task:read", "task:*") {
+		return
+	}
+
+	var req listJobsReq
+	if err := c.ShouldBindQuery(&req); err != nil {
+		httpx.BindErr(c, err)
+		return
+	}
+
+	workflows, total, err := h.logic.listWorkflows(c.Request.Context(), req.Page, req.PageSize)
+	if err != nil {
+		httpx.ServerErr(c, err)
+		return
+	}
+
+	httpx.OK(c, gin.H{"list": workflows, "total": total})
+}
+
+// GetWorkflow 获取任务编排详情
+func (h *Handler) GetWorkflow(c *gin.Context) {
+	if !httpx.Authorize(c, h.svcCtx.DB, "task:read", "task:*") {
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		httpx.Fail(c, xcode.ParamError, "invalid id")
+		return
+	}
+
+	workflow, err := h.logic.getWorkflow(c.Request.Context(), uint(id))
+	if err != nil {
+		h.failWorkflow(c, err)
+		return
+	}
+
+	httpx.OK(c, workflow)
+}
+
+// CreateWorkflow 创建任务编排
+func (h *Handler) CreateWorkflow(c *gin.Context) {
+	if !httpx.Authorize(c, h.svcCtx.DB, "task:write", "task:*") {
+		return
+	}
+
+	var req createWorkflowReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		httpx.BindErr(c, err)
+		return
+	}
+
+	workflow, err := h.logic.createWorkflow(c.Request.Context(), uint(httpx.UIDFromCtx(c)), req)
+	if err != nil {
+		h.failWorkflow(c, err)
+		return
+	}
+
+	httpx.OK(c, workflow)
+}
+
+// UpdateWorkflow 更新任务编排
+func (h *Handler) UpdateWorkflow(c *gin.Context) {
+	if !httpx.Authorize(c, h.svcCtx.DB, "task:write", "task:*") {
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		httpx.Fail(c, xcode.ParamError, "invalid id")
+		return
+	}
+
+	var req updateWorkflowReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		httpx.BindErr(c, err)
+		return
+	}
+
+	workflow, err := h.logic.updateWorkflow(c.Request.Context(), uint(id), req)
+	if err != nil {
+		h.failWorkflow(c, err)
+		return
+	}
+
+	httpx.OK(c, workflow)
+}
+
+// DeleteWorkflow 删除任务编排
+func (h *Handler) DeleteWorkflow(c *gin.Context) {
+	if !httpx.Authorize(c, h.svcCtx.DB, "task:write", "task:*") {
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		httpx.Fail(c, xcode.ParamError, "invalid id")
+		return
+	}
+
+	if err := h.logic.deleteWorkflow(c.Request.Context(), uint(id)); err != nil {
+		httpx.ServerErr(c, err)
+		return
+	}
+
+	httpx.OK(c, gin.H{"message": "deleted"})
+}
+
+// StartWorkflow 启动任务编排的一次运行
+func (h *Handler) StartWorkflow(c *gin.Context) {
+	if !httpx.Authorize(c, h.svcCtx.DB, "task:write", "task:*") {
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		httpx.Fail(c, xcode.ParamError, "invalid id")
+		return
+	}
+
+	var req startWorkflowReq
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			httpx.BindErr(c, err)
+			return
+		}
+	}
+
+	run, err := h.logic.startWorkflow(c.Request.Context(), uint(id), uint(httpx.UIDFromCtx(c)), req.Variables)
+	if err != nil {
+		h.failWorkflow(c, err)
+		return
+	}
+
+	httpx.OK(c, run)
+}
+
+// ListWorkflowRuns 获取任务编排的运行记录
+func (h *Handler) ListWorkflowRuns(c *gin.Context) {
+	if !httpx.Authorize(c, h.svcCtx.DB, "task:read", "task:*") {
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		httpx.Fail(c, xcode.ParamError, "invalid id")
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	runs, total, err := h.logic.listWorkflowRuns(c.Request.Context(), uint(id), page, pageSize)
+	if err != nil {
+		httpx.ServerErr(c, err)
+		return
+	}
+
+	httpx.OK(c, gin.H{"list": runs, "total": total})
+}
+
+// GetWorkflowRun 获取任务编排运行的步骤状态图
+func (h *Handler) GetWorkflowRun(c *gin.Context) {
+	if !httpx.Authorize(c, h.svcCtx.DB, "task:read", "task:*") {
+		return
+	}
+
+	id, runID, ok := workflowRunParams(c)
+	if !ok {
+		return
+	}
+
+	graph, err := h.logic.getWorkflowRun(c.Request.Context(), id, runID)
+	if err != nil {
+		h.failWorkflow(c, err)
+		return
+	}
+
+	httpx.OK(c, graph)
+}
+
+// RetryWorkflowRun 从失败的步骤重试任务编排运行
+func (h *Handler) RetryWorkflowRun(c *gin.Context) {
+	if !httpx.Authorize(c, h.svcCtx.DB, "task:write", "task:*") {
+		return
+	}
+
+	id, runID, ok := workflowRunParams(c)
+	if !ok {
+		return
+	}
+
+	var req retryWorkflowReq
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			httpx.BindErr(c, err)
+			return
+		}
+	}
+
+	run, err := h.logic.retryWorkflowRun(c.Request.Context(), id, runID, req.Step)
+	if err != nil {
+		h.failWorkflow(c, err)
+		return
+	}
+
+	httpx.OK(c, run)
+}
+
+func workflowRunParams(c *gin.Context) (uint, uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		httpx.Fail(c, xcode.ParamError, "invalid id")
+		return 0, 0, false
+	}
+	runID, err := strconv.ParseUint(c.Param("run_id"), 10, 64)
+	if err != nil {
+		httpx.Fail(c, xcode.ParamError, "invalid run id")
+		return 0, 0, false
+	}
+	return uint(id), uint(runID), true
+}
+
+// failWorkflow 把任务编排操作的错误映射为响应。
+func (h *Handler) failWorkflow(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		httpx.Fail(c, xcode.NotFound, "workflow not found")
+	case errors.Is(err, ErrInvalidWorkflow), errors.Is(err, ErrWorkflowNotRetryable):
+		httpx.Fail(c, xcode.ParamError, err.Error())
+	default:
+		httpx.ServerErr(c, err)
+	}
+}
@@ -0,0 +1,693 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cy77cc/OpsPilot/internal/config"
+	"github.com/cy77cc/OpsPilot/internal/logger"
+	"github.com/cy77cc/OpsPilot/internal/logstream"
+	"github.com/cy77cc/OpsPilot/internal/model"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	// jobTypeK8s 类型的任务在集群中以 batch/v1 Job 运行容器, 配置 cron 时由集群中的 CronJob 触发。
+	jobTypeK8s = "k8s"
+
+	k8sManagedByLabel = "opspilot.io/managed-by"
+	k8sManagedByValue = "opspilot"
+	k8sJobIDLabel     = "opspilot.io/job-id"
+	// k8sScheduledAnnotation 由 CronJob 控制器写入, 记录 Job 对应的计划触发时间。
+	k8sScheduledAnnotation = "batch.kubernetes.io/cronjob-scheduled-timestamp"
+
+	k8sContainerName    = "job"
+	defaultK8sNamespace = "default"
+	defaultK8sJobTTL    = time.Hour
+	// defaultK8sPollInterval 是等待 Job 结束时查询其状态的间隔。
+	defaultK8sPollInterval = 2 * time.Second
+	// k8sSyncInterval 是调度器同步 CronJob 创建的 Job 的间隔。
+	k8sSyncInterval = 10 * time.Second
+	// k8sLogTailLines 是每个 Pod 收集的日志行数上限。
+	k8sLogTailLines = 1000
+)
+
+// ErrInvalidK8sJob 表示 k8s 任务缺少镜像、集群, 或命令、参数、命名空间无效。
+var ErrInvalidK8sJob = errors.New("invalid kubernetes job")
+
+// clusterClient 使用集群保存的 kubeconfig 建立客户端。
+func (l *Logic) clusterClient(ctx context.Context, clusterID uint) (kubernetes.Interface, error) {
+	var cluster model.Cluster
+	if err := l.svcCtx.DB.WithContext(ctx).First(&cluster, clusterID).Error; err != nil {
+		return nil, fmt.Errorf("load cluster %d: %v", clusterID, err)
+	}
+	if strings.TrimSpace(cluster.KubeConfig) == "" {
+		return nil, fmt.Errorf("cluster %d has no kubeconfig", clusterID)
+	}
+	cfg, err := clientcmd.RESTConfigFromKubeConfig([]byte(cluster.KubeConfig))
+	if err != nil {
+		return nil, err
+	}
+	return kubernetes.NewForConfig(cfg)
+}
+
+// validateK8sJob 校验 k8s 任务的镜像、集群、命名空间、命令与参数。
+// 集群中的 CronJob 不支持秒级触发, 带秒的 6 段 cron 表达式返回 ErrInvalidSchedule。
+func validateK8sJob(job *model.Job) error {
+	if strings.TrimSpace(job.Image) == "" {
+		return fmt.Errorf("%w: image is required", ErrInvalidK8sJob)
+	}
+	if job.ClusterID == 0 {
+		return fmt.Errorf("%w: cluster_id is required", ErrInvalidK8sJob)
+	}
+	if job.Namespace != "" {
+		if errs := validation.IsDNS1123Label(job.Namespace); len(errs) > 0 {
+			return fmt.Errorf("%w: namespace %q: %s", ErrInvalidK8sJob, job.Namespace, strings.Join(errs, "; "))
+		}
+	}
+	if _, err := k8sCommand(job.Command); err != nil {
+		return err
+	}
+	if _, err := k8sArgs(job.ArgsJSON); err != nil {
+		return err
+	}
+	if job.Cron != "" && !strings.HasPrefix(job.Cron, "@") && len(strings.Fields(job.Cron)) != 5 {
+		return fmt.Errorf("%w: kubernetes cron jobs only support 5-field cron expressions", ErrInvalidSchedule)
+	}
+	return nil
+}
+
+// k8sCommand 解析容器命令: JSON 字符串数组原样使用, 其他命令行经 /bin/sh -c 执行, 为空时使用镜像入口。
+func k8sCommand(raw string) ([]string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(raw, "[") {
+		return []string{"/bin/sh", "-c", raw}, nil
+	}
+	var command []string
+	if err := json.Unmarshal([]byte(raw), &command); err != nil {
+		return nil, fmt.Errorf("%w: command: %v", ErrInvalidK8sJob, err)
+	}
+	return command, nil
+}
+
+// k8sArgs 解析以 JSON 字符串数组保存的容器参数。
+func k8sArgs(raw string) ([]string, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	var args []string
+	if err := json.Unmarshal([]byte(raw), &args); err != nil {
+		return nil, fmt.Errorf("%w: args: %v", ErrInvalidK8sJob, err)
+	}
+	return args, nil
+}
+
+// encodeK8sArgs 把容器参数保存为 JSON 字符串数组, 没有参数时返回空串。
+func encodeK8sArgs(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(args)
+	return string(data)
+}
+
+func k8sNamespace(job *model.Job) string {
+	if job.Namespace == "" {
+		return defaultK8sNamespace
+	}
+	return job.Namespace
+}
+
+// k8sCronManaged 判断任务是否由集群中的 CronJob 触发。
+func k8sCronManaged(job *model.Job) bool {
+	return job != nil && job.Type == jobTypeK8s && job.Cron != ""
+}
+
+// k8sJobName 生成每次运行唯一的 Job 名称。
+func k8sJobName(jobID uint, runID string) string {
+	suffix := strings.ReplaceAll(runID, "-", "")
+	if len(suffix) > 8 {
+		suffix = suffix[:8]
+	}
+	return fmt.Sprintf("opspilot-job-%d-%s", jobID, suffix)
+}
+
+// k8sCronJobName 返回任务对应的 CronJob 名称, CronJob 创建的 Job 名称在此基础上追加时间戳。
+func k8sCronJobName(jobID uint) string {
+	return fmt.Sprintf("opspilot-job-%d", jobID)
+}
+
+func k8sLabels(jobID uint) map[string]string {
+	return map[string]string{
+		k8sManagedByLabel: k8sManagedByValue,
+		k8sJobIDLabel:     strconv.FormatUint(uint64(jobID), 10),
+	}
+}
+
+func k8sJobTTL() int32 {
+	if ttl := config.CFG.Jobs.K8sJobTTL; ttl > 0 {
+		return int32(ttl / time.Second)
+	}
+	return int32(defaultK8sJobTTL / time.Second)
+}
+
+// k8sJobSpec 生成任务的 Job 规格: 不重试, 按任务超时终止, 结束后保留 jobs.k8s_job_ttl 供查看日志再由集群清理。
+func k8sJobSpec(job *model.Job, env map[string]string) (batchv1.JobSpec, error) {
+	command, err := k8sCommand(job.Command)
+	if err != nil {
+		return batchv1.JobSpec{}, err
+	}
+	args, err := k8sArgs(job.ArgsJSON)
+	if err != nil {
+		return batchv1.JobSpec{}, err
+	}
+	container := corev1.Container{Name: k8sContainerName, Image: job.Image, Command: command, Args: args}
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		container.Env = append(container.Env, corev1.EnvVar{Name: key, Value: env[key]})
+	}
+	backoff := int32(0)
+	ttl := k8sJobTTL()
+	deadline := int64(jobTimeout(job) / time.Second)
+	return batchv1.JobSpec{
+		BackoffLimit:            &backoff,
+		ActiveDeadlineSeconds:   &deadline,
+		TTLSecondsAfterFinished: &ttl,
+		Template: corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{Labels: k8sLabels(job.ID)},
+			Spec: corev1.PodSpec{
+				RestartPolicy: corev1.RestartPolicyNever,
+				Containers:    []corev1.Container{container},
+			},
+		},
+	}, nil
+}
+
+// k8sCronJobSpec 生成任务的 CronJob 规格。同一任务不重叠执行, 暂停的任务挂起 CronJob。
+// CronJob 控制器对错过的触发最多补偿最近一次, 因此 once 与 all 都补偿一次; skip 只允许在 missedThreshold 内启动。
+// 未设置时区时使用集群控制器的时区。
+func k8sCronJobSpec(job *model.Job, jobSpec batchv1.JobSpec) batchv1.CronJobSpec {
+	suspend := job.Paused
+	spec := batchv1.CronJobSpec{
+		Schedule:          job.Cron,
+		ConcurrencyPolicy: batchv1.ForbidConcurrent,
+		Suspend:           &suspend,
+		JobTemplate: batchv1.JobTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{Labels: k8sLabels(job.ID)},
+			Spec:       jobSpec,
+		},
+	}
+	if job.Timezone != "" {
+		tz := job.Timezone
+		spec.TimeZone = &tz
+	}
+	if job.CatchUp == "" || job.CatchUp == catchUpSkip {
+		deadline := int64(missedThreshold / time.Second)
+		spec.StartingDeadlineSeconds = &deadline
+	}
+	return spec
+}
+
+// syncK8sCronJob 使集群中的 CronJob 与任务定义一致: before 为修改前的任务, after 为修改后的任务, 删除任务时为 nil。
+func (l *Logic) syncK8sCronJob(ctx context.Context, before, after *model.Job) error {
+	if k8sCronManaged(before) && (!k8sCronManaged(after) || before.ClusterID != after.ClusterID || k8sNamespace(before) != k8sNamespace(after)) {
+		if err := l.deleteK8sCronJob(ctx, before); err != nil {
+			return err
+		}
+	}
+	if !k8sCronManaged(after) {
+		return nil
+	}
+	return l.applyK8sCronJob(ctx, after)
+}
+
+// applyK8sCronJob 创建或更新任务对应的 CronJob。
+func (l *Logic) applyK8sCronJob(ctx context.Context, job *model.Job) error {
+	jobSpec, err := k8sJobSpec(job, nil)
+	if err != nil {
+		return err
+	}
+	cli, err := l.kube(ctx, job.ClusterID)
+	if err != nil {
+		return err
+	}
+	namespace, name := k8sNamespace(job), k8sCronJobName(job.ID)
+	cronJobs := cli.BatchV1().CronJobs(namespace)
+	current, err := cronJobs.Get(ctx, name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		_, err = cronJobs.Create(ctx, &batchv1.CronJob{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: k8sLabels(job.ID)},
+			Spec:       k8sCronJobSpec(job, jobSpec),
+		}, metav1.CreateOptions{})
+	case err == nil:
+		current.Labels = k8sLabels(job.ID)
+		current.Spec = k8sCronJobSpec(job, jobSpec)
+		_, err = cronJobs.Update(ctx, current, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("apply cronjob %s/%s: %w", namespace, name, err)
+	}
+	return nil
+}
+
+// deleteK8sCronJob 删除任务对应的 CronJob 及其创建的 Job。
+func (l *Logic) deleteK8sCronJob(ctx context.Context, job *model.Job) error {
+	cli, err := l.kube(ctx, job.ClusterID)
+	if err != nil {
+		return err
+	}
+	namespace, name := k8sNamespace(job), k8sCronJobName(job.ID)
+	policy := metav1.DeletePropagationBackground
+	err = cli.BatchV1().CronJobs(namespace).Delete(ctx, name, metav1.DeleteOptions{PropagationPolicy: &policy})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("delete cronjob %s/%s: %w", namespace, name, err)
+	}
+	return nil
+}
+
+// prepareK8sRun 为 k8s 任务创建执行记录, 返回本次运行的 ID 与执行记录。
+// 任务已有未结束且未失联的执行时返回 ErrJobRunning。
+func (l *Logic) prepareK8sRun(ctx context.Context, job *model.Job, trigger string, scheduledAt *time.Time) (string, *model.JobExecution, error) {
+	if err := validateK8sJob(job); err != nil {
+		return "", nil, err
+	}
+	now := time.Now()
+	runID := uuid.NewString()
+	execution := model.JobExecution{
+		JobID:       job.ID,
+		K8sJob:      k8sJobName(job.ID, runID),
+		RunID:       runID,
+		Status:      "pending",
+		Trigger:     trigger,
+		ScheduledAt: scheduledAt,
+		StartTime:   now,
+		CreatedAt:   now,
+	}
+	if err := l.startRun(ctx, job, now, &execution); err != nil {
+		return "", nil, err
+	}
+
+	target := k8sNamespace(job) + "/" + execution.K8sJob
+	message := fmt.Sprintf("Job %d started as kubernetes job %s (run %s)", job.ID, target, runID)
+	if scheduledAt != nil {
+		message = fmt.Sprintf("Job %d started by %s for %s as kubernetes job %s (run %s)", job.ID, trigger, scheduledAt.Format(time.RFC3339), target, runID)
+	}
+	l.jobLog(ctx, job.ID, 0, "info", message)
+	return runID, &execution, nil
+}
+
+// runK8sJob 在集群中运行一次 k8s 任务, 结束后汇总并返回任务状态。env 为注入容器的环境变量。
+// 停止方式与主机上的执行相同: 本进程内取消 ctx, 其他副本通过 stopping 状态感知, 停止时删除 Job。
+func (l *Logic) runK8sJob(parent context.Context, job model.Job, runID string, execution *model.JobExecution, env map[string]string) string {
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+	l.trackRun(job.ID, cancel)
+	defer l.untrackRun(job.ID)
+	go l.watchStop(ctx, runID, cancel)
+
+	l.withExecutionStream(execution.ID, func(stream *logstream.Appender) {
+		l.runK8sExecution(ctx, &job, execution, env, stream)
+	})
+	return l.finishK8sRun(&job, runID, execution.Status)
+}
+
+// runK8sExecution 创建 Job 并等待其结束, 收集 Pod 日志后把结果写回执行记录。
+// Job 的 activeDeadlineSeconds 由集群按任务超时终止 Pod; 本地等待额外留出宽限, 避免集群失联时一直等待。
+func (l *Logic) runK8sExecution(ctx context.Context, job *model.Job, execution *model.JobExecution, env map[string]string, stream *logstream.Appender) {
+	bg := context.Background()
+	if ctx.Err() != nil {
+		l.finishExecution(execution, "stopped", -1, "", "", "stopped before start")
+		return
+	}
+	res := l.svcCtx.DB.WithContext(bg).Model(&model.JobExecution{}).
+		Where("id = ? AND status = ?", execution.ID, "pending").
+		Updates(map[string]any{"status": "running", "start_time": time.Now()})
+	if res.Error == nil && res.RowsAffected == 0 {
+		l.finishExecution(execution, "stopped", -1, "", "", "stopped before start")
+		return
+	}
+	namespace := k8sNamespace(job)
+	stream.Linef("==> creating kubernetes job %s/%s (%s)", namespace, execution.K8sJob, job.Image)
+
+	spec, err := k8sJobSpec(job, env)
+	if err != nil {
+		stream.Linef("==> %v", err)
+		l.finishExecution(execution, "failed", -1, "", "", err.Error())
+		return
+	}
+	cli, err := l.kube(ctx, job.ClusterID)
+	if err != nil {
+		stream.Linef("==> connect failed: %v", err)
+		l.finishExecution(execution, "failed", -1, "", "", "connect: "+err.Error())
+		return
+	}
+	jobs := cli.BatchV1().Jobs(namespace)
+	_, err = jobs.Create(ctx, &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: execution.K8sJob, Namespace: namespace, Labels: k8sLabels(job.ID)},
+		Spec:       spec,
+	}, metav1.CreateOptions{})
+	if err != nil {
+		stream.Linef("==> create job failed: %v", err)
+		l.finishExecution(execution, "failed", -1, "", "", "create job: "+err.Error())
+		return
+	}
+
+	timeout := jobTimeout(job)
+	waitCtx, cancel := context.WithTimeout(ctx, timeout+executionStaleGrace)
+	defer cancel()
+	for {
+		current, err := jobs.Get(waitCtx, execution.K8sJob, metav1.GetOptions{})
+		switch {
+		case apierrors.IsNotFound(err):
+			l.completeK8sExecution(bg, cli, namespace, execution, stream, "failed", "kubernetes job was deleted")
+			return
+		case err == nil:
+			if done, failed, message := k8sJobResult(current); done {
+				status := "success"
+				if failed {
+					status = "failed"
+				}
+				l.completeK8sExecution(bg, cli, namespace, execution, stream, status, message)
+				return
+			}
+		}
+		select {
+		case <-waitCtx.Done():
+			deleteK8sJob(cli, namespace, execution.K8sJob)
+			status, message := "failed", fmt.Sprintf("kubernetes job did not finish within %s", timeout)
+			if ctx.Err() != nil {
+				status, message = "stopped", "stopped by user"
+			}
+			l.completeK8sExecution(bg, cli, namespace, execution, stream, status, message)
+			return
+		case <-time.After(l.k8sPoll):
+		}
+	}
+}
+
+// completeK8sExecution 收集 Job 所属 Pod 的日志写入实时日志流与任务日志, 并写入执行结果。
+// 退出码取自容器的终止状态, 读取不到时成功记为 0, 其他情况记为 -1。
+func (l *Logic) completeK8sExecution(ctx context.Context, cli kubernetes.Interface, namespace string, execution *model.JobExecution, stream *logstream.Appender, status, message string) {
+	logs, code := k8sPodLogs(ctx, cli, namespace, execution.K8sJob)
+	output := &tailBuffer{limit: maxOutputBytes}
+	for _, pod := range logs {
+		stream.Linef("==> logs of pod %s", pod.name)
+		w := stream.Writer("")
+		_, _ = w.Write([]byte(pod.text))
+		_ = w.Close()
+		_, _ = output.Write([]byte(pod.text))
+		level := "info"
+		if pod.err {
+			level = "warn"
+		}
+		l.jobLog(ctx, execution.JobID, execution.ID, level, fmt.Sprintf("Pod %s/%s logs:\n%s", namespace, pod.name, pod.text))
+	}
+	if code == -1 && status == "success" {
+		code = 0
+	}
+	if message != "" {
+		stream.Linef("==> %s", message)
+	}
+	stream.Linef("==> exit code %d", code)
+	l.finishExecution(execution, status, code, output.String(), "", message)
+}
+
+// finishK8sRun 把一次 k8s 运行的结果写回任务状态。
+func (l *Logic) finishK8sRun(job *model.Job, runID, status string) string {
+	bg := context.Background()
+	l.svcCtx.DB.WithContext(bg).Model(&model.Job{}).Where("id = ?", job.ID).Updates(map[string]any{
+		"status":     status,
+		"updated_at": time.Now(),
+	})
+	level := "info"
+	if status != "success" {
+		level = "error"
+	}
+	l.jobLog(bg, job.ID, 0, level, fmt.Sprintf("Job %d run %s finished: %s", job.ID, runID, status))
+	return status
+}
+
+// withExecutionStream 打开执行的实时日志流, fn 返回后关闭并归档。
+func (l *Logic) withExecutionStream(executionID uint, fn func(stream *logstream.Appender)) {
+	bg := context.Background()
+	stream, err := l.logs.Open(bg, executionStream(executionID))
+	if err != nil {
+		logger.L().Warn("open job execution log stream failed", logger.Error(err))
+	}
+	defer func() {
+		_ = stream.Close()
+		if err := l.logs.Complete(bg, executionStream(executionID)); err != nil {
+			logger.L().Warn("compact job execution logs failed", logger.Error(err))
+		}
+	}()
+	fn(stream)
+}
+
+// k8sJobResult 判断 Job 是否结束, 失败时返回集群给出的原因。
+func k8sJobResult(job *batchv1.Job) (done, failed bool, message string) {
+	for _, c := range job.Status.Conditions {
+		if c.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch c.Type {
+		case batchv1.JobComplete:
+			return true, false, ""
+		case batchv1.JobFailed:
+			message = c.Reason
+			if c.Message != "" {
+				message = strings.TrimSpace(c.Reason + ": " + c.Message)
+			}
+			return true, true, defaultString(message, "kubernetes job failed")
+		}
+	}
+	if job.Status.Succeeded > 0 {
+		return true, false, ""
+	}
+	if job.Spec.BackoffLimit != nil && job.Status.Failed > *job.Spec.BackoffLimit {
+		return true, true, "kubernetes job failed"
+	}
+	return false, false, ""
+}
+
+func defaultString(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// deleteK8sJob 删除 Job 及其 Pod, Job 已不存在时忽略。
+func deleteK8sJob(cli kubernetes.Interface, namespace, name string) {
+	policy := metav1.DeletePropagationBackground
+	err := cli.BatchV1().Jobs(namespace).Delete(context.Background(), name, metav1.DeleteOptions{PropagationPolicy: &policy})
+	if err != nil && !apierrors.IsNotFound(err) {
+		logger.L().Warn("delete kubernetes job failed", logger.String("job", namespace+"/"+name), logger.Error(err))
+	}
+}
+
+type k8sPodLog struct {
+	name string
+	text string
+	err  bool
+}
+
+// k8sPodLogs 按创建顺序收集 Job 所属 Pod 的日志尾部, 并返回最后一个已终止容器的退出码, 没有时返回 -1。
+func k8sPodLogs(ctx context.Context, cli kubernetes.Interface, namespace, name string) ([]k8sPodLog, int) {
+	pods, err := cli.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: "job-name=" + name})
+	if err != nil {
+		return []k8sPodLog{{name: name, text: "logs unavailable: " + err.Error(), err: true}}, -1
+	}
+	items := pods.Items
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].CreationTimestamp.Before(&items[j].CreationTimestamp)
+	})
+	tail := int64(k8sLogTailLines)
+	code := -1
+	out := make([]k8sPodLog, 0, len(items))
+	for _, pod := range items {
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.Name == k8sContainerName && status.State.Terminated != nil {
+				code = int(status.State.Terminated.ExitCode)
+			}
+		}
+		data, err := cli.CoreV1().Pods(namespace).GetLogs(pod.Name, &corev1.PodLogOptions{Container: k8sContainerName, TailLines: &tail}).DoRaw(ctx)
+		if err != nil {
+			out = append(out, k8sPodLog{name: pod.Name, text: "logs unavailable: " + err.Error(), err: true})
+			continue
+		}
+		out = append(out, k8sPodLog{name: pod.Name, text: strings.TrimRight(string(data), "\n") + "\n"})
+	}
+	return out, code
+}
+
+// syncK8sCronRuns 为 CronJob 创建的 Job 登记执行记录, 并在其结束后收集日志、写入结果。
+// 由持有选主锁的调度器定期调用。
+func (l *Logic) syncK8sCronRuns(ctx context.Context) {
+	var jobs []model.Job
+	if err := l.svcCtx.DB.WithContext(ctx).Where("type = ? AND cron <> ''", jobTypeK8s).Find(&jobs).Error; err != nil {
+		logger.L().Warn("load kubernetes cron jobs failed", logger.Error(err))
+		return
+	}
+	for i := range jobs {
+		if err := l.syncK8sCronJobRuns(ctx, &jobs[i]); err != nil {
+			logger.L().Warn("sync kubernetes cron job runs failed", logger.Int("job_id", int(jobs[i].ID)), logger.Error(err))
+		}
+	}
+}
+
+func (l *Logic) syncK8sCronJobRuns(ctx context.Context, job *model.Job) error {
+	cli, err := l.kube(ctx, job.ClusterID)
+	if err != nil {
+		return err
+	}
+	namespace := k8sNamespace(job)
+	list, err := cli.BatchV1().Jobs(namespace).List(ctx, metav1.ListOptions{LabelSelector: k8sJobIDLabel + "=" + strconv.FormatUint(uint64(job.ID), 10)})
+	if err != nil {
+		return err
+	}
+	items := list.Items
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].CreationTimestamp.Before(&items[j].CreationTimestamp)
+	})
+	byName := map[string]*batchv1.Job{}
+	names := []string{}
+	for i := range items {
+		if !k8sCronOwned(&items[i]) {
+			continue
+		}
+		byName[items[i].Name] = &items[i]
+		names = append(names, items[i].Name)
+	}
+
+	db := l.svcCtx.DB.WithContext(ctx)
+	var executions []model.JobExecution
+	if err := db.Where("job_id = ? AND trigger_type = ? AND k8s_job <> '' AND (k8s_job IN ? OR status IN ?)",
+		job.ID, triggerSchedule, names, []string{"pending", "running", "stopping"}).
+		Order("id ASC").Find(&executions).Error; err != nil {
+		return err
+	}
+	known := make(map[string]bool, len(executions))
+	for _, execution := range executions {
+		known[execution.K8sJob] = true
+	}
+
+	// CronJob 新创建的 Job 登记为定时执行
+	for _, name := range names {
+		if known[name] {
+			continue
+		}
+		item := byName[name]
+		execution := model.JobExecution{
+			JobID:     job.ID,
+			K8sJob:    name,
+			RunID:     uuid.NewString(),
+			Status:    "running",
+			Trigger:   triggerSchedule,
+			StartTime: item.CreationTimestamp.Time,
+			CreatedAt: time.Now(),
+		}
+		if at, err := time.Parse(time.RFC3339, item.Annotations[k8sScheduledAnnotation]); err == nil {
+			execution.ScheduledAt = &at
+		}
+		if err := db.Create(&execution).Error; err != nil {
+			return err
+		}
+		db.Model(&model.Job{}).Where("id = ?", job.ID).Updates(map[string]any{
+			"status":     "running",
+			"last_run":   execution.StartTime,
+			"updated_at": time.Now(),
+		})
+		l.jobLog(ctx, job.ID, 0, "info", fmt.Sprintf("Job %d started by schedule as kubernetes job %s/%s (run %s)", job.ID, namespace, name, execution.RunID))
+		executions = append(executions, execution)
+	}
+
+	var cron *batchv1.CronJob
+	for i := range executions {
+		execution := &executions[i]
+		var status, message string
+		item := byName[execution.K8sJob]
+		switch {
+		case execution.Status == "stopping":
+			deleteK8sJob(cli, namespace, execution.K8sJob)
+			status, message = "stopped", "stopped by user"
+		case execution.Status != "pending" && execution.Status != "running":
+			continue
+		case item == nil:
+			if cron == nil {
+				if cron, err = cli.BatchV1().CronJobs(namespace).Get(ctx, k8sCronJobName(job.ID), metav1.GetOptions{}); err != nil {
+					logger.L().Warn("get kubernetes cronjob failed", logger.Int("job_id", int(job.ID)), logger.Error(err))
+					cron = &batchv1.CronJob{}
+				}
+			}
+			status, message = l.deletedK8sCronResult(ctx, cron, execution)
+		default:
+			done, failed, reason := k8sJobResult(item)
+			if !done {
+				continue
+			}
+			status, message = "success", reason
+			if failed {
+				status = "failed"
+			}
+		}
+		l.withExecutionStream(execution.ID, func(stream *logstream.Appender) {
+			l.completeK8sExecution(ctx, cli, namespace, execution, stream, status, message)
+		})
+		l.finishK8sRun(job, execution.RunID, status)
+	}
+	return nil
+}
+
+// deletedK8sCronResult 推断结果收集前已被删除 (如 TTL 到期) 的 Job 的结果。CronJob 禁止并发运行,
+// 其最近一次成功时间落在该 Job 创建之后、下一个 Job 创建之前时即为该 Job 成功; 否则无法判断, 记为 unknown。
+func (l *Logic) deletedK8sCronResult(ctx context.Context, cron *batchv1.CronJob, execution *model.JobExecution) (string, string) {
+	const deleted = "kubernetes job was deleted before its result was collected"
+	last := cron.Status.LastSuccessfulTime
+	if last == nil || last.Time.Before(execution.StartTime) {
+		return "unknown", deleted
+	}
+	var next model.JobExecution
+	err := l.svcCtx.DB.WithContext(ctx).
+		Where("job_id = ? AND trigger_type = ? AND k8s_job <> '' AND start_time > ?", execution.JobID, triggerSchedule, execution.StartTime).
+		Order("start_time ASC").First(&next).Error
+	switch {
+	case err == nil && !last.Time.Before(next.StartTime):
+		return "unknown", deleted
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+		logger.L().Warn("load next kubernetes cron execution failed", logger.Int("execution_id", int(execution.ID)), logger.Error(err))
+		return "unknown", deleted
+	}
+	return "success", fmt.Sprintf("kubernetes job was deleted; cronjob reported success at %s", last.Time.Format(time.RFC3339))
+}
+
+// k8sCronOwned 判断 Job 是否由 CronJob 创建, 手动运行创建的 Job 由发起运行的副本跟踪。
+func k8sCronOwned(job *batchv1.Job) bool {
+	for _, ref := range job.OwnerReferences {
+		if ref.Kind == "CronJob" {
+			return true
+		}
+	}
+	return false
+}
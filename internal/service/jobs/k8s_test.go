@@ -0,0 +1,280 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cy77cc/OpsPilot/internal/model"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newK8sTestLogic(t *testing.T) (*Logic, *fake.Clientset) {
+	t.Helper()
+	l := newTestLogic(t)
+	cli := fake.NewSimpleClientset()
+	l.kube = func(context.Context, uint) (kubernetes.Interface, error) { return cli, nil }
+	l.k8sPoll = 10 * time.Millisecond
+	return l, cli
+}
+
+// waitK8sJob 等待 Job 在集群中创建。
+func waitK8sJob(t *testing.T, cli *fake.Clientset, namespace, name string) *batchv1.Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if job, err := cli.BatchV1().Jobs(namespace).Get(context.Background(), name, metav1.GetOptions{}); err == nil {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("kubernetes job %s/%s was not created", namespace, name)
+	return nil
+}
+
+// finishK8sJob 模拟 Job 控制器: 创建已终止的 Pod 并把 Job 标记为完成或失败。
+func finishK8sJob(t *testing.T, cli *fake.Clientset, job *batchv1.Job, exitCode int32, failure string) {
+	t.Helper()
+	ctx := context.Background()
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: job.Name + "-abcde", Namespace: job.Namespace, Labels: map[string]string{"job-name": job.Name}},
+		Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+			Name:  k8sContainerName,
+			State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: exitCode}},
+		}}},
+	}
+	if _, err := cli.CoreV1().Pods(job.Namespace).Create(ctx, pod, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("create pod: %v", err)
+	}
+	condition := batchv1.JobCondition{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}
+	if failure != "" {
+		condition = batchv1.JobCondition{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: "BackoffLimitExceeded", Message: failure}
+	}
+	job.Status.Conditions = append(job.Status.Conditions, condition)
+	if _, err := cli.BatchV1().Jobs(job.Namespace).UpdateStatus(ctx, job, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("update job status: %v", err)
+	}
+}
+
+func runExecution(t *testing.T, l *Logic, runID string) model.JobExecution {
+	t.Helper()
+	var execution model.JobExecution
+	if err := l.svcCtx.DB.Where("run_id = ?", runID).First(&execution).Error; err != nil {
+		t.Fatalf("load execution of run %s: %v", runID, err)
+	}
+	return execution
+}
+
+func TestK8sJobRunsAsBatchJobAndCollectsLogs(t *testing.T) {
+	l, cli := newK8sTestLogic(t)
+	ctx := context.Background()
+	job, err := l.createJob(ctx, 1, createJobReq{
+		Name: "cleanup", Type: "k8s", ClusterID: 1, Namespace: "ops", Image: "busybox:1.36",
+		Command: "find /data -mtime +7 -delete", Timeout: 120,
+	})
+	if err != nil {
+		t.Fatalf("create job: %v", err)
+	}
+	runID, err := l.startJob(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("start job: %v", err)
+	}
+	execution := runExecution(t, l, runID)
+	created := waitK8sJob(t, cli, "ops", execution.K8sJob)
+
+	spec := created.Spec
+	if *spec.BackoffLimit != 0 || *spec.TTLSecondsAfterFinished != 3600 || *spec.ActiveDeadlineSeconds != 120 {
+		t.Fatalf("job spec = backoff %d ttl %d deadline %d", *spec.BackoffLimit, *spec.TTLSecondsAfterFinished, *spec.ActiveDeadlineSeconds)
+	}
+	container := spec.Template.Spec.Containers[0]
+	if container.Image != "busybox:1.36" || strings.Join(container.Command, " ") != "/bin/sh -c find /data -mtime +7 -delete" || spec.Template.Spec.RestartPolicy != corev1.RestartPolicyNever {
+		t.Fatalf("container = %+v", container)
+	}
+	if created.Labels[k8sJobIDLabel] == "" || created.Labels[k8sManagedByLabel] != k8sManagedByValue {
+		t.Fatalf("job labels = %v", created.Labels)
+	}
+
+	finishK8sJob(t, cli, created, 0, "")
+	if got := waitJob(t, l, job.ID); got.Status != "success" {
+		t.Fatalf("job status = %s, want success", got.Status)
+	}
+	execution = runExecution(t, l, runID)
+	if execution.Status != "success" || execution.ExitCode != 0 || !strings.Contains(execution.Output, "fake logs") {
+		t.Fatalf("execution = %s exit %d output %q", execution.Status, execution.ExitCode, execution.Output)
+	}
+	var podLogs int64
+	l.svcCtx.DB.Model(&model.JobLog{}).Where("execution_id = ? AND message LIKE ?", execution.ID, "Pod ops/"+created.Name+"-abcde logs:%").Count(&podLogs)
+	if podLogs != 1 {
+		t.Fatalf("pod log entries = %d, want 1", podLogs)
+	}
+}
+
+func TestK8sJobFailureAndStop(t *testing.T) {
+	l, cli := newK8sTestLogic(t)
+	ctx := context.Background()
+	job, err := l.createJob(ctx, 1, createJobReq{
+		Name: "rotate", Type: "k8s", ClusterID: 1, Image: "registry.local/ops/rotate:1",
+		Command: `["/scripts/rotate.sh"]`, Args: []string{"--days", "7"},
+	})
+	if err != nil {
+		t.Fatalf("create job: %v", err)
+	}
+	runID, err := l.startJob(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("start job: %v", err)
+	}
+	created := waitK8sJob(t, cli, "default", runExecution(t, l, runID).K8sJob)
+	container := created.Spec.Template.Spec.Containers[0]
+	if strings.Join(container.Command, " ") != "/scripts/rotate.sh" || strings.Join(container.Args, " ") != "--days 7" {
+		t.Fatalf("container command %v args %v", container.Command, container.Args)
+	}
+	finishK8sJob(t, cli, created, 3, "Job has reached the specified backoff limit")
+	if got := waitJob(t, l, job.ID); got.Status != "failed" {
+		t.Fatalf("job status = %s, want failed", got.Status)
+	}
+	execution := runExecution(t, l, runID)
+	if execution.Status != "failed" || execution.ExitCode != 3 || !strings.Contains(execution.ErrorMessage, "BackoffLimitExceeded") {
+		t.Fatalf("execution = %s exit %d message %q", execution.Status, execution.ExitCode, execution.ErrorMessage)
+	}
+
+	// 停止时删除集群中的 Job
+	runID, err = l.startJob(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("start job again: %v", err)
+	}
+	name := runExecution(t, l, runID).K8sJob
+	waitK8sJob(t, cli, "default", name)
+	if err := l.stopJob(ctx, job.ID); err != nil {
+		t.Fatalf("stop job: %v", err)
+	}
+	if got := waitJob(t, l, job.ID); got.Status != "stopped" {
+		t.Fatalf("job status = %s, want stopped", got.Status)
+	}
+	if execution := runExecution(t, l, runID); execution.Status != "stopped" {
+		t.Fatalf("execution status = %s, want stopped", execution.Status)
+	}
+	if _, err := cli.BatchV1().Jobs("default").Get(ctx, name, metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("stopped job still exists: %v", err)
+	}
+}
+
+func TestK8sCronJobLifecycleAndRunSync(t *testing.T) {
+	l, cli := newK8sTestLogic(t)
+	ctx := context.Background()
+	if _, err := l.createJob(ctx, 1, createJobReq{Name: "no-image", Type: "k8s", ClusterID: 1}); !errors.Is(err, ErrInvalidK8sJob) {
+		t.Fatalf("create without image err = %v, want ErrInvalidK8sJob", err)
+	}
+	if _, err := l.createJob(ctx, 1, createJobReq{Name: "seconds", Type: "k8s", ClusterID: 1, Image: "busybox", Cron: "0 */5 * * * *"}); !errors.Is(err, ErrInvalidSchedule) {
+		t.Fatalf("create with seconds err = %v, want ErrInvalidSchedule", err)
+	}
+
+	job, err := l.createJob(ctx, 1, createJobReq{
+		Name: "vacuum", Type: "k8s", ClusterID: 1, Namespace: "ops", Image: "postgres:16",
+		Command: "vacuumdb --all", Cron: "*/5 * * * *", Timezone: "Asia/Shanghai",
+	})
+	if err != nil {
+		t.Fatalf("create job: %v", err)
+	}
+	if job.NextRun != nil {
+		t.Fatalf("next_run = %v, want nil for cluster-scheduled job", job.NextRun)
+	}
+	cronJobs := cli.BatchV1().CronJobs("ops")
+	cronJob, err := cronJobs.Get(ctx, k8sCronJobName(job.ID), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get cronjob: %v", err)
+	}
+	spec := cronJob.Spec
+	if spec.Schedule != "*/5 * * * *" || *spec.TimeZone != "Asia/Shanghai" || spec.ConcurrencyPolicy != batchv1.ForbidConcurrent ||
+		*spec.StartingDeadlineSeconds != 60 || *spec.Suspend || *spec.JobTemplate.Spec.TTLSecondsAfterFinished != 3600 {
+		t.Fatalf("cronjob spec = %+v", spec)
+	}
+
+	if _, err := l.pauseJob(ctx, job.ID); err != nil {
+		t.Fatalf("pause job: %v", err)
+	}
+	if cronJob, _ = cronJobs.Get(ctx, k8sCronJobName(job.ID), metav1.GetOptions{}); !*cronJob.Spec.Suspend {
+		t.Fatal("paused job did not suspend its cronjob")
+	}
+
+	// CronJob 创建的 Job 结束后登记为定时执行
+	scheduled := time.Date(2026, 10, 17, 3, 0, 0, 0, time.UTC)
+	spawned := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: k8sCronJobName(job.ID) + "-29000000", Namespace: "ops", Labels: k8sLabels(job.ID),
+			Annotations:     map[string]string{k8sScheduledAnnotation: scheduled.Format(time.RFC3339)},
+			OwnerReferences: []metav1.OwnerReference{{Kind: "CronJob", Name: cronJob.Name}},
+		},
+	}
+	if spawned, err = cli.BatchV1().Jobs("ops").Create(ctx, spawned, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("create spawned job: %v", err)
+	}
+	l.syncK8sCronRuns(ctx)
+	var execution model.JobExecution
+	if err := l.svcCtx.DB.Where("job_id = ? AND k8s_job = ?", job.ID, spawned.Name).First(&execution).Error; err != nil {
+		t.Fatalf("spawned job not registered: %v", err)
+	}
+	if execution.Status != "running" || execution.Trigger != triggerSchedule || execution.ScheduledAt == nil || !execution.ScheduledAt.Equal(scheduled) {
+		t.Fatalf("execution = %s %s %v", execution.Status, execution.Trigger, execution.ScheduledAt)
+	}
+
+	finishK8sJob(t, cli, spawned, 0, "")
+	l.syncK8sCronRuns(ctx)
+	l.syncK8sCronRuns(ctx)
+	var executions []model.JobExecution
+	l.svcCtx.DB.Where("job_id = ?", job.ID).Find(&executions)
+	if len(executions) != 1 || executions[0].Status != "success" || !strings.Contains(executions[0].Output, "fake logs") {
+		t.Fatalf("executions = %+v", executions)
+	}
+	if got, _ := l.getJob(ctx, job.ID); got.Status != "success" {
+		t.Fatalf("job status = %s, want success", got.Status)
+	}
+
+	// 结果收集前被 TTL 删除的 Job: CronJob 的最近成功时间落在其运行期间时记为成功, 否则结果未知。
+	first, second := time.Now().Add(-10*time.Minute).Truncate(time.Second), time.Now().Add(-5*time.Minute).Truncate(time.Second)
+	var expired []string
+	for i, created := range []time.Time{first, second} {
+		item := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{
+			Name: fmt.Sprintf("%s-%d", k8sCronJobName(job.ID), 29000001+i), Namespace: "ops", Labels: k8sLabels(job.ID),
+			CreationTimestamp: metav1.NewTime(created),
+			OwnerReferences:   []metav1.OwnerReference{{Kind: "CronJob", Name: cronJob.Name}},
+		}}
+		if _, err := cli.BatchV1().Jobs("ops").Create(ctx, item, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("create spawned job: %v", err)
+		}
+		expired = append(expired, item.Name)
+	}
+	l.syncK8sCronRuns(ctx)
+	succeeded := metav1.NewTime(first.Add(time.Minute))
+	cronJob, _ = cronJobs.Get(ctx, k8sCronJobName(job.ID), metav1.GetOptions{})
+	cronJob.Status.LastSuccessfulTime = &succeeded
+	if _, err := cronJobs.UpdateStatus(ctx, cronJob, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("update cronjob status: %v", err)
+	}
+	for _, name := range expired {
+		if err := cli.BatchV1().Jobs("ops").Delete(ctx, name, metav1.DeleteOptions{}); err != nil {
+			t.Fatalf("delete spawned job: %v", err)
+		}
+	}
+	l.syncK8sCronRuns(ctx)
+	for name, want := range map[string]string{expired[0]: "success", expired[1]: "unknown"} {
+		var row model.JobExecution
+		if err := l.svcCtx.DB.Where("job_id = ? AND k8s_job = ?", job.ID, name).First(&row).Error; err != nil || row.Status != want {
+			t.Fatalf("deleted job %s status = %s (%v), want %s", name, row.Status, err, want)
+		}
+	}
+
+	if err := l.deleteJob(ctx, job.ID); err != nil {
+		t.Fatalf("delete job: %v", err)
+	}
+	if _, err := cronJobs.Get(ctx, k8sCronJobName(job.ID), metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("cronjob still exists after delete: %v", err)
+	}
+}
@@ -2,20 +2,95 @@ package jobs
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/cy77cc/OpsPilot/internal/logger"
+	"github.com/cy77cc/OpsPilot/internal/logstream"
 	"github.com/cy77cc/OpsPilot/internal/model"
+	hostlogic "github.com/cy77cc/OpsPilot/internal/service/host/logic"
 	"github.com/cy77cc/OpsPilot/internal/svc"
+	"github.com/cy77cc/OpsPilot/internal/utils"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// 执行的触发方式。
+	triggerManual   = "manual"
+	triggerSchedule = "schedule"
+	triggerCatchUp  = "catchup"
+	triggerWorkflow = "workflow"
+
+	// 错过触发的补偿策略: skip 丢弃错过的触发, once 补偿一次, all 逐次补偿 (受 jobs.max_catch_up 限制)。
+	catchUpSkip = "skip"
+	catchUpOnce = "once"
+	catchUpAll  = "all"
+
+	// executionStaleGrace 是执行超过任务超时仍未结束时, 视为已失联而不再阻止新执行的宽限时间。
+	executionStaleGrace = time.Minute
+)
+
+var (
+	// ErrJobRunning 表示任务已有执行中的记录, 同一任务不允许重叠执行。
+	ErrJobRunning = errors.New("job is already running")
+	// ErrInvalidSchedule 表示 cron 表达式、时区或补偿策略无效。
+	ErrInvalidSchedule = errors.New("invalid job schedule")
+	// ErrJobNotRunnable 表示任务缺少命令或目标主机。
+	ErrJobNotRunnable = errors.New("job has no command or target hosts")
 )
 
 type Logic struct {
 	svcCtx *svc.ServiceContext
+	logs   *logstream.Store
+	// dial 建立到目标主机的执行连接, 默认使用 SSH。
+	dial func(ctx context.Context, node *model.Node) (hostRunner, error)
+	// kube 建立到 k8s 任务目标集群的客户端, 默认使用集群保存的 kubeconfig。
+	kube func(ctx context.Context, clusterID uint) (kubernetes.Interface, error)
+	// k8sPoll 是等待 k8s 任务的 Job 结束时查询其状态的间隔。
+	k8sPoll time.Duration
+
+	mu      sync.Mutex
+	running map[uint]context.CancelFunc // 本进程内正在进行的运行, 按任务 ID 索引
 }
 
 func NewLogic(svcCtx *svc.ServiceContext) *Logic {
-	return &Logic{svcCtx: svcCtx}
+	l := &Logic{svcCtx: svcCtx, logs: logstream.New(svcCtx.DB, svcCtx.Rdb), running: map[uint]context.CancelFunc{}}
+	l.dial = l.dialSSH
+	l.kube = l.clusterClient
+	l.k8sPoll = defaultK8sPollInterval
+	return l
+}
+
+// executionStream 返回任务执行的实时日志流名称。
+func executionStream(executionID uint) string {
+	return fmt.Sprintf("jobs:execution:%d", executionID)
+}
+
+// executionLogStream 返回任务执行的实时日志流名称, 执行记录不存在时返回 gorm.ErrRecordNotFound。
+func (l *Logic) executionLogStream(ctx context.Context, jobID, executionID uint) (string, error) {
+	var execution model.JobExecution
+	if err := l.svcCtx.DB.WithContext(ctx).Where("id = ? AND job_id = ?", executionID, jobID).First(&execution).Error; err != nil {
+		return "", err
+	}
+	return executionStream(execution.ID), nil
+}
+
+// executionFinished 报告任务执行是否已经结束。
+func (l *Logic) executionFinished(ctx context.Context, executionID uint) (bool, error) {
+	var execution model.JobExecution
+	if err := l.svcCtx.DB.WithContext(ctx).Select("id", "status").First(&execution, executionID).Error; err != nil {
+		return false, err
+	}
+	switch execution.Status {
+	case "pending", "running", "stopping":
+		return false, nil
+	}
+	return true, nil
 }
 
 func (l *Logic) listJobs(ctx context.Context, page, pageSize int) ([]model.Job, int64, error) {
@@ -54,9 +129,16 @@ func (l *Logic) createJob(ctx context.Context, actor uint, req createJobReq) (*m
 		Type:        req.Type,
 		Command:     req.Command,
 		HostIDs:     req.HostIDs,
-		Cron:        req.Cron,
+		ClusterID:   req.ClusterID,
+		Namespace:   strings.TrimSpace(req.Namespace),
+		Image:       strings.TrimSpace(req.Image),
+		ArgsJSON:    encodeK8sArgs(req.Args),
+		Cron:        strings.TrimSpace(req.Cron),
+		Timezone:    strings.TrimSpace(req.Timezone),
+		CatchUp:     strings.TrimSpace(req.CatchUp),
 		Status:      "pending",
 		Timeout:     req.Timeout,
+		Parallelism: req.Parallelism,
 		Priority:    req.Priority,
 		Description: req.Description,
 		CreatedBy:   actor,
@@ -70,10 +152,27 @@ func (l *Logic) createJob(ctx context.Context, actor uint, req createJobReq) (*m
 	if job.Timeout == 0 {
 		job.Timeout = 300
 	}
+	if job.CatchUp == "" {
+		job.CatchUp = catchUpSkip
+	}
+	if job.Type == jobTypeK8s {
+		if err := validateK8sJob(&job); err != nil {
+			return nil, err
+		}
+	}
+	next, err := nextRun(&job, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	job.NextRun = next
 
 	if err := l.svcCtx.DB.WithContext(ctx).Create(&job).Error; err != nil {
 		return nil, err
 	}
+	if err := l.syncK8sCronJob(ctx, nil, &job); err != nil {
+		l.svcCtx.DB.WithContext(ctx).Delete(&model.Job{}, job.ID)
+		return nil, err
+	}
 
 	return &job, nil
 }
@@ -83,6 +182,7 @@ func (l *Logic) updateJob(ctx context.Context, id uint, req updateJobReq) (*mode
 	if err := l.svcCtx.DB.WithContext(ctx).First(&job, id).Error; err != nil {
 		return nil, err
 	}
+	before := job
 
 	updates := map[string]any{
 		"updated_at": time.Now(),
@@ -92,16 +192,55 @@ func (l *Logic) updateJob(ctx context.Context, id uint, req updateJobReq) (*mode
 		updates["name"] = strings.TrimSpace(req.Name)
 	}
 	if req.Type != "" {
-		updates["type"] = req.Type
+		job.Type = req.Type
+		updates["type"] = job.Type
 	}
 	if req.Command != "" {
-		updates["command"] = req.Command
+		job.Command = req.Command
+		updates["command"] = job.Command
 	}
 	if req.HostIDs != "" {
 		updates["host_ids"] = req.HostIDs
 	}
+	if req.ClusterID > 0 {
+		job.ClusterID = req.ClusterID
+		updates["cluster_id"] = job.ClusterID
+	}
+	if req.Namespace != "" {
+		job.Namespace = strings.TrimSpace(req.Namespace)
+		updates["namespace"] = job.Namespace
+	}
+	if req.Image != "" {
+		job.Image = strings.TrimSpace(req.Image)
+		updates["image"] = job.Image
+	}
+	if req.Args != nil {
+		job.ArgsJSON = encodeK8sArgs(req.Args)
+		updates["args_json"] = job.ArgsJSON
+	}
 	if req.Cron != "" {
-		updates["cron"] = req.Cron
+		job.Cron = strings.TrimSpace(req.Cron)
+		updates["cron"] = job.Cron
+	}
+	if req.Timezone != "" {
+		job.Timezone = strings.TrimSpace(req.Timezone)
+		updates["timezone"] = job.Timezone
+	}
+	if req.CatchUp != "" {
+		job.CatchUp = strings.TrimSpace(req.CatchUp)
+		updates["catch_up"] = job.CatchUp
+	}
+	if job.Type == jobTypeK8s {
+		if err := validateK8sJob(&job); err != nil {
+			return nil, err
+		}
+	}
+	if req.Cron != "" || req.Timezone != "" || req.CatchUp != "" || req.Type != "" {
+		next, err := nextRun(&job, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		updates["next_run"] = next
 	}
 	if req.Status != "" {
 		updates["status"] = req.Status
@@ -109,6 +248,9 @@ func (l *Logic) updateJob(ctx context.Context, id uint, req updateJobReq) (*mode
 	if req.Timeout > 0 {
 		updates["timeout"] = req.Timeout
 	}
+	if req.Parallelism > 0 {
+		updates["parallelism"] = req.Parallelism
+	}
 	if req.Priority != 0 {
 		updates["priority"] = req.Priority
 	}
@@ -120,54 +262,265 @@ func (l *Logic) updateJob(ctx context.Context, id uint, req updateJobReq) (*mode
 		return nil, err
 	}
 
-	return l.getJob(ctx, id)
+	updated, err := l.getJob(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.syncK8sCronJob(ctx, &before, updated); err != nil {
+		return nil, err
+	}
+	return updated, nil
 }
 
+// deleteJob 删除任务; k8s 任务同时删除集群中的 CronJob, 删除失败只记录警告。
 func (l *Logic) deleteJob(ctx context.Context, id uint) error {
+	var job model.Job
+	if err := l.svcCtx.DB.WithContext(ctx).First(&job, id).Error; err == nil {
+		if err := l.syncK8sCronJob(ctx, &job, nil); err != nil {
+			logger.L().Warn("delete kubernetes cron job failed", logger.Int("job_id", int(id)), logger.Error(err))
+		}
+	}
 	return l.svcCtx.DB.WithContext(ctx).Delete(&model.Job{}, id).Error
 }
 
-func (l *Logic) startJob(ctx context.Context, id uint) error {
+func (l *Logic) startJob(ctx context.Context, id uint) (string, error) {
 	var job model.Job
 	if err := l.svcCtx.DB.WithContext(ctx).First(&job, id).Error; err != nil {
-		return err
+		return "", err
 	}
+	return l.launchJob(ctx, &job, triggerManual, nil)
+}
 
-	now := time.Now()
-	job.Status = "running"
-	job.LastRun = &now
-	job.UpdatedAt = now
+// launchJob 为任务的每台目标主机创建执行记录并在后台执行, 返回本次运行的 ID。
+// k8s 任务在目标集群中创建一个 Job 执行。
+func (l *Logic) launchJob(ctx context.Context, job *model.Job, trigger string, scheduledAt *time.Time) (string, error) {
+	if job.Type == jobTypeK8s {
+		runID, execution, err := l.prepareK8sRun(ctx, job, trigger, scheduledAt)
+		if err != nil {
+			return "", err
+		}
+		go l.runK8sJob(context.Background(), *job, runID, execution, nil)
+		return runID, nil
+	}
+	runID, executions, nodes, err := l.prepareRun(ctx, job, trigger, scheduledAt)
+	if err != nil {
+		return "", err
+	}
+	go l.runJob(context.Background(), *job, runID, executions, nodes)
+	return runID, nil
+}
 
-	if err := l.svcCtx.DB.WithContext(ctx).Save(&job).Error; err != nil {
-		return err
+// prepareRun 为任务的每台目标主机创建执行记录, 返回本次运行的 ID、执行记录与目标主机。
+// 找不到或不满足运维条件 (维护中、离线等) 的主机记为 skipped, 不会执行命令。
+// 任务已有未结束且未失联的执行时返回 ErrJobRunning。
+func (l *Logic) prepareRun(ctx context.Context, job *model.Job, trigger string, scheduledAt *time.Time) (string, []model.JobExecution, map[uint]model.Node, error) {
+	hostIDs := parseHostIDs(job.HostIDs)
+	if strings.TrimSpace(job.Command) == "" || len(hostIDs) == 0 {
+		return "", nil, nil, ErrJobNotRunnable
+	}
+	now := time.Now()
+	var rows []model.Node
+	if err := l.svcCtx.DB.WithContext(ctx).Where("id IN ?", hostIDs).Find(&rows).Error; err != nil {
+		return "", nil, nil, err
+	}
+	nodes := make(map[uint]model.Node, len(rows))
+	for _, node := range rows {
+		nodes[uint(node.ID)] = node
 	}
 
 	// 创建执行记录
-	execution := model.JobExecution{
-		JobID:     id,
-		Status:    "running",
-		StartTime: now,
-		CreatedAt: now,
-	}
-	if err := l.svcCtx.DB.WithContext(ctx).Create(&execution).Error; err != nil {
-		return err
+	runID := uuid.NewString()
+	executions := make([]model.JobExecution, 0, len(hostIDs))
+	for _, hostID := range hostIDs {
+		execution := model.JobExecution{
+			JobID:       job.ID,
+			HostID:      hostID,
+			RunID:       runID,
+			Status:      "pending",
+			Trigger:     trigger,
+			ScheduledAt: scheduledAt,
+			StartTime:   now,
+			CreatedAt:   now,
+		}
+		node, ok := nodes[hostID]
+		reason := "host not found"
+		if ok {
+			execution.HostIP = node.IP
+			ok, reason = hostlogic.EvaluateOperationalEligibility(&node)
+		}
+		if !ok {
+			execution.Status = "skipped"
+			execution.ErrorMessage = reason
+			execution.EndTime = &now
+		}
+		executions = append(executions, execution)
+	}
+	if err := l.startRun(ctx, job, now, &executions); err != nil {
+		return "", nil, nil, err
 	}
 
 	// 记录日志
-	_ = l.svcCtx.DB.WithContext(ctx).Create(&model.JobLog{
-		JobID:       id,
-		ExecutionID: execution.ID,
-		Level:       "info",
-		Message:     fmt.Sprintf("Job %d started", id),
-		CreatedAt:   now,
+	message := fmt.Sprintf("Job %d started on %d hosts (run %s)", job.ID, len(hostIDs), runID)
+	if scheduledAt != nil {
+		message = fmt.Sprintf("Job %d started by %s for %s on %d hosts (run %s)", job.ID, trigger, scheduledAt.Format(time.RFC3339), len(hostIDs), runID)
+	}
+	l.jobLog(ctx, job.ID, 0, "info", message)
+	for _, execution := range executions {
+		if execution.Status == "skipped" {
+			l.jobLog(ctx, job.ID, execution.ID, "warn", fmt.Sprintf("Job %d skipped host %d: %s", job.ID, execution.HostID, execution.ErrorMessage))
+		}
+	}
+
+	return runID, executions, nodes, nil
+}
+
+// hasActiveExecution 判断任务是否有未结束的执行。超过任务超时与宽限时间仍未结束的执行视为已失联, 不再阻止新执行。
+func (l *Logic) hasActiveExecution(ctx context.Context, job *model.Job, now time.Time) (bool, error) {
+	var count int64
+	err := activeExecutions(l.svcCtx.DB.WithContext(ctx), job, now).Count(&count).Error
+	return count > 0, err
+}
+
+// activeExecutions 返回任务未结束且未失联的执行查询。
+func activeExecutions(db *gorm.DB, job *model.Job, now time.Time) *gorm.DB {
+	return db.Model(&model.JobExecution{}).
+		Where("job_id = ? AND status IN ? AND start_time > ?", job.ID, []string{"pending", "running", "stopping"}, now.Add(-jobTimeout(job)-executionStaleGrace))
+}
+
+// startRun 在同一事务中占用任务并写入执行记录: 仅当任务没有未结束且未失联的执行时才把任务置为 running,
+// 该条件更新会锁住任务行, 并发触发同一任务时只有一个能写入执行记录, 其余返回 ErrJobRunning。
+func (l *Logic) startRun(ctx context.Context, job *model.Job, now time.Time, executions any) error {
+	return l.svcCtx.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&model.Job{}).
+			Where("id = ? AND NOT EXISTS (?)", job.ID, activeExecutions(tx.Session(&gorm.Session{NewDB: true}), job, now).Select("1")).
+			Updates(map[string]any{
+				"status":     "running",
+				"last_run":   now,
+				"updated_at": now,
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrJobRunning
+		}
+		return tx.Create(executions).Error
+	})
+}
+
+// pauseJob 暂停任务的定时触发, 手动执行不受影响。
+func (l *Logic) pauseJob(ctx context.Context, id uint) (*model.Job, error) {
+	var job model.Job
+	if err := l.svcCtx.DB.WithContext(ctx).First(&job, id).Error; err != nil {
+		return nil, err
+	}
+	if err := l.svcCtx.DB.WithContext(ctx).Model(&job).Updates(map[string]any{
+		"paused":     true,
+		"updated_at": time.Now(),
+	}).Error; err != nil {
+		return nil, err
+	}
+	l.jobLog(ctx, id, 0, "info", fmt.Sprintf("Job %d paused", id))
+	return l.syncPaused(ctx, &job)
+}
+
+// resumeJob 恢复任务的定时触发。下次触发时间从当前时间重新计算, 暂停期间错过的触发不做补偿。
+func (l *Logic) resumeJob(ctx context.Context, id uint) (*model.Job, error) {
+	var job model.Job
+	if err := l.svcCtx.DB.WithContext(ctx).First(&job, id).Error; err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	next, err := nextRun(&job, now)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.svcCtx.DB.WithContext(ctx).Model(&job).Updates(map[string]any{
+		"paused":     false,
+		"next_run":   next,
+		"updated_at": now,
+	}).Error; err != nil {
+		return nil, err
+	}
+	l.jobLog(ctx, id, 0, "info", fmt.Sprintf("Job %d resumed", id))
+	return l.syncPaused(ctx, &job)
+}
+
+// syncPaused 返回暂停或恢复后的任务; k8s 任务同时挂起或恢复集群中的 CronJob。
+func (l *Logic) syncPaused(ctx context.Context, before *model.Job) (*model.Job, error) {
+	job, err := l.getJob(ctx, before.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.syncK8sCronJob(ctx, before, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// jobLog 记录一条任务日志, 写入失败只记录警告。
+func (l *Logic) jobLog(ctx context.Context, jobID, executionID uint, level, message string) {
+	err := l.svcCtx.DB.WithContext(ctx).Create(&model.JobLog{
+		JobID:       jobID,
+		ExecutionID: executionID,
+		Level:       level,
+		Message:     message,
+		CreatedAt:   time.Now(),
 	}).Error
+	if err != nil {
+		logger.L().Warn("write job log failed", logger.Error(err))
+	}
+}
+
+// scheduleLocation 校验任务的补偿策略并返回 cron 所用时区。
+func scheduleLocation(job *model.Job) (*time.Location, error) {
+	switch job.CatchUp {
+	case "", catchUpSkip, catchUpOnce, catchUpAll:
+	default:
+		return nil, fmt.Errorf("%w: unknown catch_up %q", ErrInvalidSchedule, job.CatchUp)
+	}
+	if job.Timezone == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(job.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+	}
+	return loc, nil
+}
 
-	// 模拟执行完成 (实际项目中应该由后台任务执行)
-	go l.simulateExecution(id, execution.ID)
+// jobSchedule 解析任务的 cron 表达式与时区。
+func jobSchedule(job *model.Job) (*utils.CronSchedule, *time.Location, error) {
+	loc, err := scheduleLocation(job)
+	if err != nil {
+		return nil, nil, err
+	}
+	sched, err := utils.ParseCron(job.Cron)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+	}
+	return sched, loc, nil
+}
 
-	return nil
+// nextRun 返回任务在 from 之后的下一次触发时间; 未配置 cron、五年内不会触发或由集群中的 CronJob 触发时返回 nil。
+func nextRun(job *model.Job, from time.Time) (*time.Time, error) {
+	if job.Cron == "" {
+		_, err := scheduleLocation(job)
+		return nil, err
+	}
+	sched, loc, err := jobSchedule(job)
+	if err != nil {
+		return nil, err
+	}
+	next := sched.Next(from.In(loc))
+	if next.IsZero() || job.Type == jobTypeK8s {
+		return nil, nil
+	}
+	return &next, nil
 }
 
+// stopJob 停止任务: 取消正在进行的运行并终止远程命令。
+// 运行在其他副本上时, 执行记录被标记为 stopping, 由该副本轮询后取消。
 func (l *Logic) stopJob(ctx context.Context, id uint) error {
 	var job model.Job
 	if err := l.svcCtx.DB.WithContext(ctx).First(&job, id).Error; err != nil {
@@ -175,20 +528,23 @@ func (l *Logic) stopJob(ctx context.Context, id uint) error {
 	}
 
 	now := time.Now()
-	job.Status = "stopped"
-	job.UpdatedAt = now
+	res := l.svcCtx.DB.WithContext(ctx).Model(&model.JobExecution{}).
+		Where("job_id = ? AND status IN ?", id, []string{"pending", "running"}).
+		Update("status", "stopping")
+	if res.Error != nil {
+		return res.Error
+	}
+	l.cancelRun(id)
 
-	if err := l.svcCtx.DB.WithContext(ctx).Save(&job).Error; err != nil {
+	if err := l.svcCtx.DB.WithContext(ctx).Model(&job).Updates(map[string]any{
+		"status":     "stopped",
+		"updated_at": now,
+	}).Error; err != nil {
 		return err
 	}
 
 	// 记录日志
-	_ = l.svcCtx.DB.WithContext(ctx).Create(&model.JobLog{
-		JobID:     id,
-		Level:     "info",
-		Message:   fmt.Sprintf("Job %d stopped", id),
-		CreatedAt: now,
-	}).Error
+	l.jobLog(ctx, id, 0, "info", fmt.Sprintf("Job %d stopped (%d executions canceled)", id, res.RowsAffected))
 
 	return nil
 }
@@ -236,34 +592,3 @@ func (l *Logic) getJobLogs(ctx context.Context, jobID uint, page, pageSize int)
 
 	return logs, total, nil
 }
-
-// simulateExecution 模拟任务执行 (实际项目中应该由后台 worker 执行)
-func (l *Logic) simulateExecution(jobID uint, executionID uint) {
-	time.Sleep(2 * time.Second)
-
-	ctx := context.Background()
-	now := time.Now()
-
-	// 更新执行记录
-	l.svcCtx.DB.WithContext(ctx).Model(&model.JobExecution{}).Where("id = ?", executionID).Updates(map[string]any{
-		"status":    "success",
-		"exit_code": 0,
-		"output":    "Task completed successfully",
-		"end_time":  now,
-	})
-
-	// 更新任务状态
-	l.svcCtx.DB.WithContext(ctx).Model(&model.Job{}).Where("id = ?", jobID).Updates(map[string]any{
-		"status":     "success",
-		"updated_at": now,
-	})
-
-	// 记录日志
-	l.svcCtx.DB.WithContext(ctx).Create(&model.JobLog{
-		JobID:       jobID,
-		ExecutionID: executionID,
-		Level:       "info",
-		Message:     fmt.Sprintf("Job %d completed successfully", jobID),
-		CreatedAt:   now,
-	})
-}
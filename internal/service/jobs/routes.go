@@ -2,9 +2,10 @@
 //
 // 本文件注册任务相关的 HTTP 路由，包括：
 //   - 任务 CRUD
-//   - 任务启停控制
-//   - 执行记录查询
+//   - 任务启停控制与定时触发的暂停/恢复
+//   - 执行记录查询与实时日志流
 //   - 日志查看
+//   - 任务编排 (按依赖执行的多步骤工作流) 的管理、运行与重试
 package jobs
 
 import (
@@ -16,6 +17,7 @@ import (
 // RegisterJobsHandlers 注册任务服务路由到 v1 组。
 func RegisterJobsHandlers(v1 *gin.RouterGroup, svcCtx *svc.ServiceContext) {
 	h := NewHandler(svcCtx)
+	h.StartScheduler()
 	g := v1.Group("/jobs", middleware.JWTAuth())
 	{
 		g.GET("", h.ListJobs)
@@ -25,7 +27,20 @@ func RegisterJobsHandlers(v1 *gin.RouterGroup, svcCtx *svc.ServiceContext) {
 		g.DELETE("/:id", h.DeleteJob)
 		g.POST("/:id/start", h.StartJob)
 		g.POST("/:id/stop", h.StopJob)
+		g.POST("/:id/pause", h.PauseJob)
+		g.POST("/:id/resume", h.ResumeJob)
 		g.GET("/:id/executions", h.GetJobExecutions)
+		g.GET("/:id/executions/:execution_id/logs/stream", h.StreamExecutionLogs)
 		g.GET("/:id/logs", h.GetJobLogs)
+
+		g.GET("/workflows", h.ListWorkflows)
+		g.POST("/workflows", h.CreateWorkflow)
+		g.GET("/workflows/:id", h.GetWorkflow)
+		g.PUT("/workflows/:id", h.UpdateWorkflow)
+		g.DELETE("/workflows/:id", h.DeleteWorkflow)
+		g.POST("/workflows/:id/runs", h.StartWorkflow)
+		g.GET("/workflows/:id/runs", h.ListWorkflowRuns)
+		g.GET("/workflows/:id/runs/:run_id", h.GetWorkflowRun)
+		g.POST("/workflows/:id/runs/:run_id/retry", h.RetryWorkflowRun)
 	}
 }
@@ -0,0 +1,258 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cy77cc/OpsPilot/internal/config"
+	"github.com/cy77cc/OpsPilot/internal/leaderlock"
+	"github.com/cy77cc/OpsPilot/internal/logger"
+	"github.com/cy77cc/OpsPilot/internal/model"
+	"github.com/cy77cc/OpsPilot/internal/utils"
+)
+
+const (
+	schedulerLockName = "jobs:scheduler"
+
+	defaultTickInterval = time.Second
+	defaultLockTTL      = 15 * time.Second
+	defaultMaxCatchUp   = 10
+
+	// missedThreshold 内的触发视为准时, 更早的触发按任务的补偿策略处理。
+	missedThreshold = time.Minute
+	// dueBatchSize 是每次检查处理的到期任务数。
+	dueBatchSize = 100
+	// maxDueScan 限制统计错过的触发时遍历的次数, 避免长时间停机后逐秒遍历。
+	maxDueScan = 100000
+)
+
+var schedulerOnce sync.Once
+
+// scheduler 按 cron 触发到期的任务。多副本部署时只有持有选主锁的副本执行检查。
+type scheduler struct {
+	logic      *Logic
+	lock       *leaderlock.Lock
+	tick       time.Duration
+	maxCatchUp int
+	// invalid 记录已告警过的无效调度, 避免每次检查重复告警。
+	invalid map[uint]string
+	// lastK8sSync 与 k8sSyncing 控制同步 CronJob 运行的频率, 避免集群响应慢时阻塞检查或重叠同步。
+	lastK8sSync time.Time
+	k8sSyncing  atomic.Bool
+	// lastWorkflowSweep 是上次检查失联编排运行的时间。
+	lastWorkflowSweep time.Time
+}
+
+func (l *Logic) newScheduler() *scheduler {
+	cfg := config.CFG.Jobs
+	s := &scheduler{logic: l, tick: cfg.TickInterval, maxCatchUp: cfg.MaxCatchUp, invalid: map[uint]string{}}
+	if s.tick <= 0 {
+		s.tick = defaultTickInterval
+	}
+	if s.maxCatchUp <= 0 {
+		s.maxCatchUp = defaultMaxCatchUp
+	}
+	ttl := cfg.LockTTL
+	if ttl <= 0 {
+		ttl = defaultLockTTL
+	}
+	s.lock = leaderlock.New(l.svcCtx.DB, l.svcCtx.Rdb, schedulerLockName, "", ttl)
+	return s
+}
+
+// StartScheduler 启动任务调度器, 每隔 jobs.tick_interval 触发到期的任务。
+// 未开启 jobs.enable 时不启动, 任务只能手动执行。
+func (l *Logic) StartScheduler(ctx context.Context) {
+	if !config.CFG.Jobs.Enable {
+		return
+	}
+	schedulerOnce.Do(func() {
+		go l.newScheduler().run(ctx)
+	})
+}
+
+func (s *scheduler) run(ctx context.Context) {
+	ticker := time.NewTicker(s.tick)
+	defer ticker.Stop()
+	leading := false
+	for {
+		ok, err := s.lock.TryAcquire(ctx)
+		if err != nil {
+			logger.L().Warn("acquire job scheduler lock failed", logger.Error(err))
+		}
+		if ok != leading {
+			leading = ok
+			msg := "job scheduler lost leadership"
+			if leading {
+				msg = "job scheduler became leader"
+			}
+			logger.L().Info(msg, logger.String("owner", s.lock.Owner()))
+		}
+		if leading {
+			s.runDue(ctx, time.Now())
+		}
+		select {
+		case <-ctx.Done():
+			if leading {
+				_ = s.lock.Release(context.Background())
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runDue 为新配置的任务计算下次触发时间, 并按优先级触发到期的任务。
+// k8s 任务由集群中的 CronJob 触发, 这里只定期同步其运行结果; 心跳超时的编排运行也在这里定期标记为失败。
+func (s *scheduler) runDue(ctx context.Context, now time.Time) {
+	if now.Sub(s.lastK8sSync) >= k8sSyncInterval && s.k8sSyncing.CompareAndSwap(false, true) {
+		s.lastK8sSync = now
+		go func() {
+			defer s.k8sSyncing.Store(false)
+			s.logic.syncK8sCronRuns(ctx)
+		}()
+	}
+	if now.Sub(s.lastWorkflowSweep) >= workflowHeartbeatInterval {
+		s.lastWorkflowSweep = now
+		s.logic.recoverWorkflowRuns(ctx, now)
+	}
+
+	db := s.logic.svcCtx.DB.WithContext(ctx)
+	var pending []model.Job
+	if err := db.Where("cron <> '' AND paused = ? AND next_run IS NULL AND type <> ?", false, jobTypeK8s).Limit(dueBatchSize).Find(&pending).Error; err != nil {
+		logger.L().Warn("load unscheduled jobs failed", logger.Error(err))
+		return
+	}
+	for i := range pending {
+		job := &pending[i]
+		next, err := nextRun(job, now)
+		if err != nil {
+			s.warnInvalid(job, err)
+			continue
+		}
+		if next != nil {
+			db.Model(&model.Job{}).Where("id = ? AND next_run IS NULL", job.ID).Update("next_run", next)
+		}
+	}
+
+	var due []model.Job
+	if err := db.Where("cron <> '' AND paused = ? AND next_run IS NOT NULL AND next_run <= ? AND type <> ?", false, now, jobTypeK8s).
+		Order("priority DESC, next_run ASC, id ASC").Limit(dueBatchSize).Find(&due).Error; err != nil {
+		logger.L().Warn("load due jobs failed", logger.Error(err))
+		return
+	}
+	for i := range due {
+		if err := s.fire(ctx, &due[i], now); err != nil {
+			logger.L().Warn("schedule job failed", logger.Int("job_id", int(due[i].ID)), logger.Error(err))
+		}
+	}
+}
+
+// fire 处理一个到期的任务: 推进 next_run 并按补偿策略与重叠规则创建执行。
+func (s *scheduler) fire(ctx context.Context, job *model.Job, now time.Time) error {
+	sched, loc, err := jobSchedule(job)
+	if err != nil {
+		s.warnInvalid(job, err)
+		return nil
+	}
+	delete(s.invalid, job.ID)
+	running, err := s.logic.hasActiveExecution(ctx, job, now)
+	if err != nil {
+		return err
+	}
+	recent, total, complete := dueRuns(sched, job.NextRun.In(loc), now, s.maxCatchUp)
+	if len(recent) == 0 {
+		return nil
+	}
+
+	if job.CatchUp == catchUpAll {
+		// 逐次补偿: 上次执行结束前不推进, 每次检查最多触发一次。
+		if running {
+			return nil
+		}
+		at := recent[0]
+		if ok, err := s.claim(ctx, job, sched.Next(at)); err != nil || !ok {
+			return err
+		}
+		if dropped := total - len(recent); dropped > 0 {
+			s.logic.jobLog(ctx, job.ID, 0, "warn", fmt.Sprintf("Job %d missed %d runs beyond max catch-up %d, skipped", job.ID, dropped, s.maxCatchUp))
+		}
+		return s.launch(ctx, job, at, now)
+	}
+
+	if ok, err := s.claim(ctx, job, sched.Next(now.In(loc))); err != nil || !ok {
+		return err
+	}
+	last := recent[len(recent)-1]
+	missed := total
+	var at *time.Time
+	if (complete && now.Sub(last) <= missedThreshold) || job.CatchUp == catchUpOnce {
+		at = &last
+		missed--
+	}
+	if missed > 0 {
+		s.logic.jobLog(ctx, job.ID, 0, "warn", fmt.Sprintf("Job %d missed %d runs, skipped (catch_up=%s)", job.ID, missed, job.CatchUp))
+	}
+	if at == nil {
+		return nil
+	}
+	if running {
+		s.logic.jobLog(ctx, job.ID, 0, "warn", fmt.Sprintf("Job %d run scheduled at %s skipped: previous execution still running", job.ID, at.Format(time.RFC3339)))
+		return nil
+	}
+	return s.launch(ctx, job, *at, now)
+}
+
+// claim 以条件更新把 next_run 从当前值推进到 next, 只有更新成功的一方触发本次执行。
+func (s *scheduler) claim(ctx context.Context, job *model.Job, next time.Time) (bool, error) {
+	var value *time.Time
+	if !next.IsZero() {
+		value = &next
+	}
+	res := s.logic.svcCtx.DB.WithContext(ctx).Model(&model.Job{}).
+		Where("id = ? AND next_run = ? AND paused = ?", job.ID, *job.NextRun, false).
+		Update("next_run", value)
+	return res.RowsAffected > 0, res.Error
+}
+
+func (s *scheduler) launch(ctx context.Context, job *model.Job, at, now time.Time) error {
+	trigger := triggerSchedule
+	if now.Sub(at) > missedThreshold {
+		trigger = triggerCatchUp
+	}
+	_, err := s.logic.launchJob(ctx, job, trigger, &at)
+	if errors.Is(err, ErrJobRunning) {
+		s.logic.jobLog(ctx, job.ID, 0, "warn", fmt.Sprintf("Job %d run scheduled at %s skipped: previous execution still running", job.ID, at.Format(time.RFC3339)))
+		return nil
+	}
+	return err
+}
+
+func (s *scheduler) warnInvalid(job *model.Job, err error) {
+	key := job.Cron + "|" + job.Timezone + "|" + job.CatchUp
+	if s.invalid[job.ID] == key {
+		return
+	}
+	s.invalid[job.ID] = key
+	logger.L().Warn("skip job with invalid schedule", logger.Int("job_id", int(job.ID)), logger.Error(err))
+}
+
+// dueRuns 遍历 [from, now] 内的触发时间, 返回最近的 keep 次与总次数。
+// 遍历超过 maxDueScan 次时停止, complete 为 false, 此时 recent 不包含最近的触发。
+func dueRuns(sched *utils.CronSchedule, from, now time.Time, keep int) (recent []time.Time, total int, complete bool) {
+	for t := from; !t.IsZero() && !t.After(now); t = sched.Next(t) {
+		if total >= maxDueScan {
+			return recent, total, false
+		}
+		total++
+		recent = append(recent, t)
+		if len(recent) > keep {
+			recent = recent[1:]
+		}
+	}
+	return recent, total, true
+}
@@ -0,0 +1,270 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cy77cc/OpsPilot/internal/model"
+	"github.com/cy77cc/OpsPilot/internal/svc"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newTestLogic(t *testing.T) *Logic {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:jobs_%s_%d?mode=memory&cache=shared", t.Name(), time.Now().UnixNano())), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	// 共享缓存的内存库在并发写入时直接返回 table is locked, 测试中串行访问。
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.SetMaxOpenConns(1)
+	}
+	if err := db.AutoMigrate(&model.Job{}, &model.JobExecution{}, &model.JobLog{}, &model.LeaderLock{}, &model.LogChunk{}, &model.LogArchive{}, &model.Node{},
+		&model.JobWorkflow{}, &model.JobWorkflowRun{}, &model.JobWorkflowStep{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	for _, node := range []model.Node{
+		{ID: 1, Name: "web-1", IP: "10.0.0.1", Status: "active"},
+		{ID: 2, Name: "web-2", IP: "10.0.0.2", Status: "active"},
+		{ID: 3, Name: "web-3", IP: "10.0.0.3", Status: "maintenance", MaintenanceReason: "kernel upgrade"},
+		{ID: 4, Name: "web-4", IP: "10.0.0.4", Status: "active"},
+	} {
+		if err := db.Create(&node).Error; err != nil {
+			t.Fatalf("seed node: %v", err)
+		}
+	}
+	l := NewLogic(&svc.ServiceContext{DB: db})
+	runners := &localRunners{}
+	l.dial = runners.dial
+	t.Cleanup(func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		for _, cancel := range l.running {
+			cancel()
+		}
+	})
+	return l
+}
+
+func newTestScheduler(l *Logic, maxCatchUp int) *scheduler {
+	s := l.newScheduler()
+	s.maxCatchUp = maxCatchUp
+	return s
+}
+
+// seedDueJob 创建任务并把 next_run 改为 nextRun, 模拟调度器停机期间错过的触发。
+func seedDueJob(t *testing.T, l *Logic, req createJobReq, nextRun time.Time) *model.Job {
+	t.Helper()
+	if req.Command == "" {
+		req.Command, req.HostIDs = "sleep 5", "1"
+	}
+	job, err := l.createJob(context.Background(), 1, req)
+	if err != nil {
+		t.Fatalf("create job %s: %v", req.Name, err)
+	}
+	if err := l.svcCtx.DB.Model(job).Update("next_run", nextRun).Error; err != nil {
+		t.Fatalf("seed next_run: %v", err)
+	}
+	job.NextRun = &nextRun
+	return job
+}
+
+func executions(t *testing.T, l *Logic, jobID uint) []model.JobExecution {
+	t.Helper()
+	rows := make([]model.JobExecution, 0)
+	if err := l.svcCtx.DB.Where("job_id = ?", jobID).Order("id ASC").Find(&rows).Error; err != nil {
+		t.Fatalf("list executions: %v", err)
+	}
+	return rows
+}
+
+func jobLogText(t *testing.T, l *Logic, jobID uint) string {
+	t.Helper()
+	rows := make([]model.JobLog, 0)
+	l.svcCtx.DB.Where("job_id = ?", jobID).Order("id ASC").Find(&rows)
+	msgs := make([]string, 0, len(rows))
+	for _, row := range rows {
+		msgs = append(msgs, row.Message)
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func TestSchedulerCatchUpPolicies(t *testing.T) {
+	l := newTestLogic(t)
+	ctx := context.Background()
+	s := newTestScheduler(l, 3)
+	now := time.Now().UTC()
+	minute := now.Truncate(time.Minute)
+	newYear := time.Date(now.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+
+	onTime := seedDueJob(t, l, createJobReq{Name: "on-time", Cron: "* * * * * *", Timezone: "UTC"}, now.Truncate(time.Second))
+	skip := seedDueJob(t, l, createJobReq{Name: "skip", Cron: "@yearly", Timezone: "UTC"}, newYear.AddDate(-3, 0, 0))
+	once := seedDueJob(t, l, createJobReq{Name: "once", Cron: "@yearly", Timezone: "UTC", CatchUp: catchUpOnce}, newYear.AddDate(-3, 0, 0))
+	all := seedDueJob(t, l, createJobReq{Name: "all", Cron: "0 * * * * *", Timezone: "UTC", CatchUp: catchUpAll, Priority: 10}, minute.Add(-5*time.Minute))
+	paused := seedDueJob(t, l, createJobReq{Name: "paused", Cron: "* * * * * *"}, now.Add(-time.Hour))
+	if _, err := l.pauseJob(ctx, paused.ID); err != nil {
+		t.Fatalf("pause: %v", err)
+	}
+
+	s.runDue(ctx, now)
+
+	if rows := executions(t, l, onTime.ID); len(rows) != 1 || rows[0].Trigger != triggerSchedule || !rows[0].ScheduledAt.Equal(*onTime.NextRun) {
+		t.Fatalf("expected one scheduled execution, got %+v", rows)
+	}
+	if rows := executions(t, l, skip.ID); len(rows) != 0 || !strings.Contains(jobLogText(t, l, skip.ID), "missed 4 runs, skipped") {
+		t.Fatalf("expected skip policy to drop missed runs, got %+v %q", rows, jobLogText(t, l, skip.ID))
+	}
+	if rows := executions(t, l, once.ID); len(rows) != 1 || rows[0].Trigger != triggerCatchUp || !rows[0].ScheduledAt.Equal(newYear) {
+		t.Fatalf("expected a single catch-up for the latest missed run, got %+v", rows)
+	}
+	if rows := executions(t, l, paused.ID); len(rows) != 0 {
+		t.Fatalf("paused job must not fire, got %+v", rows)
+	}
+	for _, id := range []uint{skip.ID, once.ID} {
+		job, _ := l.getJob(ctx, id)
+		if !job.NextRun.After(now) {
+			t.Fatalf("expected next_run to move past now, got %s", job.NextRun)
+		}
+	}
+
+	// all: 保留最近 3 次, 逐次补偿, 上次执行结束前不再触发。
+	rows := executions(t, l, all.ID)
+	if len(rows) != 1 || rows[0].Trigger != triggerCatchUp || !rows[0].ScheduledAt.Equal(minute.Add(-2*time.Minute)) ||
+		!strings.Contains(jobLogText(t, l, all.ID), "missed 3 runs beyond max catch-up 3") {
+		t.Fatalf("expected oldest kept run to fire first, got %+v %q", rows, jobLogText(t, l, all.ID))
+	}
+	s.runDue(ctx, now)
+	if rows := executions(t, l, all.ID); len(rows) != 1 {
+		t.Fatalf("expected catch-up to wait for the running execution, got %d", len(rows))
+	}
+	l.svcCtx.DB.Model(&model.JobExecution{}).Where("job_id = ?", all.ID).Update("status", "success")
+	s.runDue(ctx, now)
+	if rows := executions(t, l, all.ID); len(rows) != 2 || !rows[1].ScheduledAt.Equal(minute.Add(-time.Minute)) {
+		t.Fatalf("expected next catch-up after the previous run finished, got %+v", rows)
+	}
+}
+
+func TestPrepareRunAllowsOneConcurrentStart(t *testing.T) {
+	l := newTestLogic(t)
+	ctx := context.Background()
+	job := seedDueJob(t, l, createJobReq{Name: "concurrent", Cron: "0 0 * * * *", Timezone: "UTC"}, time.Now().Add(time.Hour))
+
+	const starts = 5
+	errs := make(chan error, starts)
+	var wg sync.WaitGroup
+	for i := 0; i < starts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, _, err := l.prepareRun(ctx, job, triggerManual, nil)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	started := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			started++
+		case !errors.Is(err, ErrJobRunning):
+			t.Fatalf("prepare run: %v", err)
+		}
+	}
+	if rows := executions(t, l, job.ID); started != 1 || len(rows) != len(parseHostIDs(job.HostIDs)) {
+		t.Fatalf("expected exactly one run to start, got %d starts and %d executions", started, len(rows))
+	}
+}
+
+func TestSchedulerPreventsOverlapAndDoubleFire(t *testing.T) {
+	l := newTestLogic(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+	job := seedDueJob(t, l, createJobReq{Name: "busy", Cron: "* * * * * *", Timezone: "UTC"}, now.Truncate(time.Second))
+
+	if _, err := l.startJob(ctx, job.ID); err != nil {
+		t.Fatalf("manual start: %v", err)
+	}
+	if _, err := l.startJob(ctx, job.ID); !errors.Is(err, ErrJobRunning) {
+		t.Fatalf("expected overlapping manual start to be rejected, got %v", err)
+	}
+	s := newTestScheduler(l, 3)
+	s.runDue(ctx, now)
+	if rows := executions(t, l, job.ID); len(rows) != 1 || !strings.Contains(jobLogText(t, l, job.ID), "previous execution still running") {
+		t.Fatalf("expected scheduled run to be skipped while running, got %+v", rows)
+	}
+	if cur, _ := l.getJob(ctx, job.ID); !cur.NextRun.After(now) {
+		t.Fatalf("expected skipped run to advance next_run, got %s", cur.NextRun)
+	}
+
+	// 超过超时与宽限时间的执行视为失联, 不再阻止新执行。
+	waitExecutionStatus(t, l, job.ID, "running")
+	l.svcCtx.DB.Model(&model.JobExecution{}).Where("job_id = ?", job.ID).Update("start_time", now.Add(-time.Hour))
+	if _, err := l.startJob(ctx, job.ID); err != nil {
+		t.Fatalf("expected stale execution not to block, got %v", err)
+	}
+
+	// 两个副本读到同一到期任务时, 只有推进 next_run 成功的一方触发。
+	other := seedDueJob(t, l, createJobReq{Name: "race", Cron: "* * * * * *", Timezone: "UTC"}, now.Truncate(time.Second))
+	a, b := newTestScheduler(l, 3), newTestScheduler(l, 3)
+	stale := *other
+	if err := a.fire(ctx, other, now); err != nil {
+		t.Fatalf("fire: %v", err)
+	}
+	if err := b.fire(ctx, &stale, now); err != nil {
+		t.Fatalf("fire: %v", err)
+	}
+	if rows := executions(t, l, other.ID); len(rows) != 1 {
+		t.Fatalf("expected a single execution across replicas, got %d", len(rows))
+	}
+}
+
+func TestJobScheduleValidationAndResume(t *testing.T) {
+	l := newTestLogic(t)
+	ctx := context.Background()
+
+	for _, req := range []createJobReq{
+		{Name: "bad-cron", Cron: "61 * * * *"},
+		{Name: "bad-tz", Cron: "0 9 * * *", Timezone: "Mars/Base"},
+		{Name: "bad-policy", Cron: "0 9 * * *", CatchUp: "twice"},
+	} {
+		if _, err := l.createJob(ctx, 1, req); !errors.Is(err, ErrInvalidSchedule) {
+			t.Fatalf("expected %s to be rejected, got %v", req.Name, err)
+		}
+	}
+
+	job, err := l.createJob(ctx, 1, createJobReq{Name: "report", Cron: "0 0 9 * * *", Timezone: "Asia/Shanghai"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	shanghai, _ := time.LoadLocation("Asia/Shanghai")
+	if job.NextRun == nil || job.NextRun.In(shanghai).Hour() != 9 || job.CatchUp != catchUpSkip {
+		t.Fatalf("expected next run at 09:00 Shanghai, got %+v", job)
+	}
+	if _, err := l.updateJob(ctx, job.ID, updateJobReq{Timezone: "Nowhere/City"}); !errors.Is(err, ErrInvalidSchedule) {
+		t.Fatalf("expected invalid timezone update to be rejected, got %v", err)
+	}
+	updated, err := l.updateJob(ctx, job.ID, updateJobReq{Cron: "30 8 * * *", Timezone: "UTC"})
+	if err != nil || updated.NextRun.UTC().Hour() != 8 || updated.NextRun.UTC().Minute() != 30 {
+		t.Fatalf("expected next run recomputed on update, got %+v %v", updated, err)
+	}
+
+	// 恢复时从当前时间重新计算, 暂停期间错过的触发不补偿。
+	if _, err := l.pauseJob(ctx, job.ID); err != nil {
+		t.Fatalf("pause: %v", err)
+	}
+	l.svcCtx.DB.Model(&model.Job{}).Where("id = ?", job.ID).Update("next_run", time.Now().Add(-48*time.Hour))
+	resumed, err := l.resumeJob(ctx, job.ID)
+	if err != nil || resumed.Paused || !resumed.NextRun.After(time.Now()) {
+		t.Fatalf("expected resumed job to schedule from now, got %+v %v", resumed, err)
+	}
+	if _, err := l.pauseJob(ctx, 999); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("expected missing job, got %v", err)
+	}
+}
@@ -1,29 +1,97 @@
 package jobs
 
+import "github.com/cy77cc/OpsPilot/internal/model"
+
 type createJobReq struct {
-	Name        string `json:"name" binding:"required"`
-	Type        string `json:"type"`
-	Command     string `json:"command"`
-	HostIDs     string `json:"host_ids"`
-	Cron        string `json:"cron"`
-	Timeout     int    `json:"timeout"`
-	Priority    int    `json:"priority"`
-	Description string `json:"description"`
+	Name        string   `json:"name" binding:"required"`
+	Type        string   `json:"type"`
+	Command     string   `json:"command"`
+	HostIDs     string   `json:"host_ids"`
+	ClusterID   uint     `json:"cluster_id"`
+	Namespace   string   `json:"namespace"`
+	Image       string   `json:"image"`
+	Args        []string `json:"args"` // k8s 任务的容器参数
+	Cron        string   `json:"cron"`
+	Timezone    string   `json:"timezone"`
+	CatchUp     string   `json:"catch_up"`
+	Timeout     int      `json:"timeout"`
+	Parallelism int      `json:"parallelism" binding:"omitempty,min=0"`
+	Priority    int      `json:"priority"`
+	Description string   `json:"description"`
 }
 
 type updateJobReq struct {
-	Name        string `json:"name"`
-	Type        string `json:"type"`
-	Command     string `json:"command"`
-	HostIDs     string `json:"host_ids"`
-	Cron        string `json:"cron"`
-	Status      string `json:"status"`
-	Timeout     int    `json:"timeout"`
-	Priority    int    `json:"priority"`
-	Description string `json:"description"`
+	Name        string   `json:"name"`
+	Type        string   `json:"type"`
+	Command     string   `json:"command"`
+	HostIDs     string   `json:"host_ids"`
+	ClusterID   uint     `json:"cluster_id"`
+	Namespace   string   `json:"namespace"`
+	Image       string   `json:"image"`
+	Args        []string `json:"args"` // k8s 任务的容器参数; 更新时为 nil 表示不修改
+	Cron        string   `json:"cron"`
+	Timezone    string   `json:"timezone"`
+	CatchUp     string   `json:"catch_up"`
+	Status      string   `json:"status"`
+	Timeout     int      `json:"timeout"`
+	Parallelism int      `json:"parallelism" binding:"omitempty,min=0"`
+	Priority    int      `json:"priority"`
+	Description string   `json:"description"`
 }
 
 type listJobsReq struct {
 	Page     int `form:"page" binding:"omitempty,min=1"`
 	PageSize int `form:"page_size" binding:"omitempty,min=1,max=100"`
 }
+
+// workflowStep 是任务编排中的一个步骤。
+type workflowStep struct {
+	Name       string            `json:"name"`
+	JobID      uint              `json:"job_id"`
+	DependsOn  []string          `json:"depends_on"`
+	When       string            `json:"when"`          // success (默认): 依赖全部成功; failure: 依赖失败或因上游失败被跳过; always: 依赖结束即执行
+	Retries    int               `json:"retries"`       // 失败后的重试次数
+	RetryDelay int               `json:"retry_delay"`   // 重试间隔 (秒)
+	Env        map[string]string `json:"env,omitempty"` // 执行前导出的环境变量, 值可引用变量
+}
+
+type createWorkflowReq struct {
+	Name        string         `json:"name" binding:"required"`
+	Description string         `json:"description"`
+	Steps       []workflowStep `json:"steps" binding:"required,min=1"`
+}
+
+type updateWorkflowReq struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Steps       []workflowStep `json:"steps"`
+}
+
+type startWorkflowReq struct {
+	Variables map[string]string `json:"variables"`
+}
+
+type retryWorkflowReq struct {
+	Step string `json:"step"` // 为空时从所有失败的步骤重试
+}
+
+// workflowRunGraph 是编排运行的步骤状态图。
+type workflowRunGraph struct {
+	Run   model.JobWorkflowRun `json:"run"`
+	Steps []workflowStepState  `json:"steps"`
+	Edges []workflowEdge       `json:"edges"`
+}
+
+type workflowStepState struct {
+	model.JobWorkflowStep
+	DependsOn []string          `json:"depends_on"`
+	When      string            `json:"when"`
+	Retries   int               `json:"retries"`
+	Outputs   map[string]string `json:"outputs"`
+}
+
+// workflowEdge 表示 To 依赖 From。
+type workflowEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
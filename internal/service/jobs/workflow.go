@@ -0,0 +1,1020 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cy77cc/OpsPilot/internal/logger"
+	"github.com/cy77cc/OpsPilot/internal/model"
+	"gorm.io/gorm"
+)
+
+const (
+	// 步骤的执行条件, 按依赖步骤的结果判断。
+	whenSuccess = "success"
+	whenFailure = "failure"
+	whenAlways  = "always"
+
+	maxStepRetries = 10
+
+	// workflowHeartbeatInterval 是执行运行的副本更新心跳的间隔,
+	// 心跳超过 workflowStaleAfter 未更新的运行视为副本已退出。
+	workflowHeartbeatInterval = 15 * time.Second
+	workflowStaleAfter        = 4 * workflowHeartbeatInterval
+)
+
+var (
+	// ErrInvalidWorkflow 表示编排的步骤定义无效, 如依赖成环、引用不存在的步骤或任务。
+	ErrInvalidWorkflow = errors.New("invalid workflow")
+	// ErrWorkflowNotRetryable 表示编排运行仍在进行或没有可重试的失败步骤。
+	ErrWorkflowNotRetryable = errors.New("workflow run cannot be retried")
+
+	stepNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+	envNamePattern  = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	// workflowRefPattern 匹配 ${{ vars.<name> }} 与 ${{ steps.<step>.outputs.<name> }} 形式的变量引用。
+	workflowRefPattern = regexp.MustCompile(`\$\{\{\s*([A-Za-z0-9_.-]+)\s*\}\}`)
+	// stepOutputPattern 匹配命令在标准输出中声明的步骤输出: 单独一行的 "::set-output name=value"。
+	stepOutputPattern = regexp.MustCompile(`(?m)^::set-output ([A-Za-z0-9_-]+)=(.*?)\r?$`)
+)
+
+func (l *Logic) listWorkflows(ctx context.Context, page, pageSize int) ([]model.JobWorkflow, int64, error) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 20
+	}
+
+	var total int64
+	if err := l.svcCtx.DB.WithContext(ctx).Model(&model.JobWorkflow{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var workflows []model.JobWorkflow
+	offset := (page - 1) * pageSize
+	if err := l.svcCtx.DB.WithContext(ctx).Order("id desc").Offset(offset).Limit(pageSize).Find(&workflows).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return workflows, total, nil
+}
+
+func (l *Logic) getWorkflow(ctx context.Context, id uint) (*model.JobWorkflow, error) {
+	var workflow model.JobWorkflow
+	if err := l.svcCtx.DB.WithContext(ctx).First(&workflow, id).Error; err != nil {
+		return nil, err
+	}
+	return &workflow, nil
+}
+
+func (l *Logic) createWorkflow(ctx context.Context, actor uint, req createWorkflowReq) (*model.JobWorkflow, error) {
+	steps, err := l.validateWorkflow(ctx, req.Steps)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := json.Marshal(steps)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	workflow := model.JobWorkflow{
+		Name:        strings.TrimSpace(req.Name),
+		Description: req.Description,
+		StepsJSON:   string(raw),
+		CreatedBy:   actor,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := l.svcCtx.DB.WithContext(ctx).Create(&workflow).Error; err != nil {
+		return nil, err
+	}
+	return &workflow, nil
+}
+
+// updateWorkflow 更新编排定义。已开始的运行使用启动时的步骤快照, 不受影响。
+func (l *Logic) updateWorkflow(ctx context.Context, id uint, req updateWorkflowReq) (*model.JobWorkflow, error) {
+	workflow, err := l.getWorkflow(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]any{
+		"updated_at": time.Now(),
+	}
+	if req.Name != "" {
+		updates["name"] = strings.TrimSpace(req.Name)
+	}
+	if req.Description != "" {
+		updates["description"] = req.Description
+	}
+	if req.Steps != nil {
+		steps, err := l.validateWorkflow(ctx, req.Steps)
+		if err != nil {
+			return nil, err
+		}
+		raw, err := json.Marshal(steps)
+		if err != nil {
+			return nil, err
+		}
+		updates["steps_json"] = string(raw)
+	}
+
+	if err := l.svcCtx.DB.WithContext(ctx).Model(workflow).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	return l.getWorkflow(ctx, id)
+}
+
+func (l *Logic) deleteWorkflow(ctx context.Context, id uint) error {
+	return l.svcCtx.DB.WithContext(ctx).Delete(&model.JobWorkflow{}, id).Error
+}
+
+// validateWorkflow 校验并规范化编排的步骤定义: 步骤名唯一, 依赖存在且不成环,
+// 环境变量只引用运行变量或上游步骤的输出, 步骤对应的任务存在。
+func (l *Logic) validateWorkflow(ctx context.Context, steps []workflowStep) ([]workflowStep, error) {
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("%w: at least one step is required", ErrInvalidWorkflow)
+	}
+	out := make([]workflowStep, 0, len(steps))
+	names := make(map[string]bool, len(steps))
+	jobIDs := make(map[uint]bool, len(steps))
+	for _, step := range steps {
+		step.Name = strings.TrimSpace(step.Name)
+		if !stepNamePattern.MatchString(step.Name) {
+			return nil, fmt.Errorf("%w: invalid step name %q", ErrInvalidWorkflow, step.Name)
+		}
+		if names[step.Name] {
+			return nil, fmt.Errorf("%w: duplicate step %s", ErrInvalidWorkflow, step.Name)
+		}
+		if step.JobID == 0 {
+			return nil, fmt.Errorf("%w: step %s has no job_id", ErrInvalidWorkflow, step.Name)
+		}
+		if step.When == "" {
+			step.When = whenSuccess
+		}
+		switch step.When {
+		case whenSuccess, whenFailure, whenAlways:
+		default:
+			return nil, fmt.Errorf("%w: step %s has unknown when %q", ErrInvalidWorkflow, step.Name, step.When)
+		}
+		if step.Retries < 0 || step.Retries > maxStepRetries {
+			return nil, fmt.Errorf("%w: step %s retries must be between 0 and %d", ErrInvalidWorkflow, step.Name, maxStepRetries)
+		}
+		if step.RetryDelay < 0 {
+			return nil, fmt.Errorf("%w: step %s retry_delay must not be negative", ErrInvalidWorkflow, step.Name)
+		}
+		for key := range step.Env {
+			if !envNamePattern.MatchString(key) {
+				return nil, fmt.Errorf("%w: step %s has invalid env name %q", ErrInvalidWorkflow, step.Name, key)
+			}
+		}
+		names[step.Name] = true
+		jobIDs[step.JobID] = true
+		out = append(out, step)
+	}
+
+	for i := range out {
+		deps := make([]string, 0, len(out[i].DependsOn))
+		seen := make(map[string]bool, len(out[i].DependsOn))
+		for _, dep := range out[i].DependsOn {
+			dep = strings.TrimSpace(dep)
+			if dep == out[i].Name || !names[dep] {
+				return nil, fmt.Errorf("%w: step %s depends on unknown step %q", ErrInvalidWorkflow, out[i].Name, dep)
+			}
+			if !seen[dep] {
+				seen[dep] = true
+				deps = append(deps, dep)
+			}
+		}
+		out[i].DependsOn = deps
+	}
+	if _, err := workflowOrder(out); err != nil {
+		return nil, err
+	}
+
+	ancestors := workflowAncestors(out)
+	// 同一任务不允许重叠执行, 引用同一任务的步骤之间必须有依赖关系, 否则可能并行执行而失败。
+	for i := range out {
+		for _, other := range out[i+1:] {
+			if out[i].JobID == other.JobID && !ancestors[out[i].Name][other.Name] && !ancestors[other.Name][out[i].Name] {
+				return nil, fmt.Errorf("%w: steps %s and %s run job %d and may run in parallel", ErrInvalidWorkflow, out[i].Name, other.Name, out[i].JobID)
+			}
+		}
+	}
+	for _, step := range out {
+		for _, value := range step.Env {
+			for _, match := range workflowRefPattern.FindAllStringSubmatch(value, -1) {
+				source, ok := parseWorkflowRef(match[1])
+				if !ok {
+					return nil, fmt.Errorf("%w: step %s has invalid reference %q", ErrInvalidWorkflow, step.Name, match[0])
+				}
+				if source != "" && !ancestors[step.Name][source] {
+					return nil, fmt.Errorf("%w: step %s references outputs of %s, which is not an upstream step", ErrInvalidWorkflow, step.Name, source)
+				}
+			}
+		}
+	}
+
+	ids := make([]uint, 0, len(jobIDs))
+	for id := range jobIDs {
+		ids = append(ids, id)
+	}
+	var found []uint
+	if err := l.svcCtx.DB.WithContext(ctx).Model(&model.Job{}).Where("id IN ?", ids).Pluck("id", &found).Error; err != nil {
+		return nil, err
+	}
+	exists := make(map[uint]bool, len(found))
+	for _, id := range found {
+		exists[id] = true
+	}
+	for _, step := range out {
+		if !exists[step.JobID] {
+			return nil, fmt.Errorf("%w: step %s references missing job %d", ErrInvalidWorkflow, step.Name, step.JobID)
+		}
+	}
+	return out, nil
+}
+
+// workflowOrder 返回步骤的拓扑顺序, 依赖允许时保持定义顺序; 依赖成环时返回 ErrInvalidWorkflow。
+func workflowOrder(steps []workflowStep) ([]workflowStep, error) {
+	pending := make(map[string]int, len(steps))
+	children := make(map[string][]string, len(steps))
+	for _, step := range steps {
+		pending[step.Name] = len(step.DependsOn)
+		for _, dep := range step.DependsOn {
+			children[dep] = append(children[dep], step.Name)
+		}
+	}
+	order := make([]workflowStep, 0, len(steps))
+	done := make(map[string]bool, len(steps))
+	for len(order) < len(steps) {
+		progressed := false
+		for _, step := range steps {
+			if done[step.Name] || pending[step.Name] > 0 {
+				continue
+			}
+			done[step.Name] = true
+			progressed = true
+			order = append(order, step)
+			for _, child := range children[step.Name] {
+				pending[child]--
+			}
+		}
+		if !progressed {
+			cycle := make([]string, 0)
+			for _, step := range steps {
+				if !done[step.Name] {
+					cycle = append(cycle, step.Name)
+				}
+			}
+			return nil, fmt.Errorf("%w: dependency cycle among steps %s", ErrInvalidWorkflow, strings.Join(cycle, ", "))
+		}
+	}
+	return order, nil
+}
+
+// workflowAncestors 返回每个步骤的全部上游步骤。steps 须不成环。
+func workflowAncestors(steps []workflowStep) map[string]map[string]bool {
+	order, _ := workflowOrder(steps)
+	ancestors := make(map[string]map[string]bool, len(order))
+	for _, step := range order {
+		set := make(map[string]bool)
+		for _, dep := range step.DependsOn {
+			set[dep] = true
+			for name := range ancestors[dep] {
+				set[name] = true
+			}
+		}
+		ancestors[step.Name] = set
+	}
+	return ancestors
+}
+
+// workflowDescendants 返回 from 中的步骤及其全部下游步骤。
+func workflowDescendants(steps []workflowStep, from []string) []string {
+	children := make(map[string][]string, len(steps))
+	for _, step := range steps {
+		for _, dep := range step.DependsOn {
+			children[dep] = append(children[dep], step.Name)
+		}
+	}
+	seen := make(map[string]bool, len(steps))
+	queue := append([]string(nil), from...)
+	out := make([]string, 0, len(steps))
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		out = append(out, name)
+		queue = append(queue, children[name]...)
+	}
+	return out
+}
+
+// parseWorkflowRef 解析变量引用 vars.<name> 或 steps.<step>.outputs.<name>, 返回引用输出的步骤 (运行变量为空)。
+func parseWorkflowRef(ref string) (string, bool) {
+	parts := strings.Split(ref, ".")
+	switch {
+	case len(parts) == 2 && parts[0] == "vars" && parts[1] != "":
+		return "", true
+	case len(parts) == 4 && parts[0] == "steps" && parts[2] == "outputs" && parts[1] != "" && parts[3] != "":
+		return parts[1], true
+	}
+	return "", false
+}
+
+// renderWorkflowVars 替换 text 中的变量引用, 替换值经 quote 处理 (为 nil 时原样替换); 引用未定义的变量时返回错误。
+func renderWorkflowVars(text string, scope map[string]string, quote func(string) string) (string, error) {
+	var missing []string
+	out := workflowRefPattern.ReplaceAllStringFunc(text, func(match string) string {
+		ref := workflowRefPattern.FindStringSubmatch(match)[1]
+		value, ok := scope[ref]
+		if !ok {
+			missing = append(missing, ref)
+			return match
+		}
+		if quote != nil {
+			return quote(value)
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("undefined variable %s", strings.Join(missing, ", "))
+	}
+	return out, nil
+}
+
+// shellQuote 把值转义为 shell 单引号字符串。
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// startWorkflow 以编排的当前定义启动一次运行, 各步骤在后台按依赖顺序执行。
+func (l *Logic) startWorkflow(ctx context.Context, id, actor uint, vars map[string]string) (*model.JobWorkflowRun, error) {
+	workflow, err := l.getWorkflow(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	for key := range vars {
+		if !stepNamePattern.MatchString(key) {
+			return nil, fmt.Errorf("%w: invalid variable name %q", ErrInvalidWorkflow, key)
+		}
+	}
+	var steps []workflowStep
+	if err := json.Unmarshal([]byte(workflow.StepsJSON), &steps); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidWorkflow, err)
+	}
+	// 步骤引用的任务可能在编排保存后被删除, 启动前重新校验。
+	if steps, err = l.validateWorkflow(ctx, steps); err != nil {
+		return nil, err
+	}
+	stepsJSON, err := json.Marshal(steps)
+	if err != nil {
+		return nil, err
+	}
+	if vars == nil {
+		vars = map[string]string{}
+	}
+	varsJSON, err := json.Marshal(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	run := model.JobWorkflowRun{
+		WorkflowID:    workflow.ID,
+		Status:        "running",
+		StepsJSON:     string(stepsJSON),
+		VariablesJSON: string(varsJSON),
+		StartTime:     now,
+		HeartbeatAt:   &now,
+		CreatedBy:     actor,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	err = l.svcCtx.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&run).Error; err != nil {
+			return err
+		}
+		rows := make([]model.JobWorkflowStep, 0, len(steps))
+		for _, step := range steps {
+			rows = append(rows, model.JobWorkflowStep{
+				WorkflowRunID: run.ID,
+				Name:          step.Name,
+				JobID:         step.JobID,
+				Status:        "pending",
+				CreatedAt:     now,
+				UpdatedAt:     now,
+			})
+		}
+		return tx.Create(&rows).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	go l.runWorkflow(run.ID)
+	return &run, nil
+}
+
+// retryWorkflowRun 从失败的步骤重新执行已结束的编排运行: 该步骤及其全部下游步骤重置为待执行,
+// 其余步骤的结果与输出保留。step 为空时从所有失败的步骤重试。
+func (l *Logic) retryWorkflowRun(ctx context.Context, workflowID, runID uint, step string) (*model.JobWorkflowRun, error) {
+	var run model.JobWorkflowRun
+	if err := l.svcCtx.DB.WithContext(ctx).Where("id = ? AND workflow_id = ?", runID, workflowID).First(&run).Error; err != nil {
+		return nil, err
+	}
+	if run.Status == "running" {
+		// 执行运行的副本已退出时, 先把运行标记为失败再重试。
+		stale, err := l.failStaleWorkflowRun(ctx, &run, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		if !stale {
+			return nil, fmt.Errorf("%w: run is still running", ErrWorkflowNotRetryable)
+		}
+	}
+	var defs []workflowStep
+	if err := json.Unmarshal([]byte(run.StepsJSON), &defs); err != nil {
+		return nil, err
+	}
+	steps, err := l.workflowSteps(ctx, run.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var from []string
+	if step != "" {
+		row, ok := steps[step]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown step %q", ErrWorkflowNotRetryable, step)
+		}
+		if row.Status != "failed" {
+			return nil, fmt.Errorf("%w: step %s is %s", ErrWorkflowNotRetryable, step, row.Status)
+		}
+		from = []string{step}
+	} else {
+		for _, def := range defs {
+			if row := steps[def.Name]; row != nil && row.Status == "failed" {
+				from = append(from, def.Name)
+			}
+		}
+		if len(from) == 0 {
+			return nil, fmt.Errorf("%w: no failed step", ErrWorkflowNotRetryable)
+		}
+	}
+
+	now := time.Now()
+	err = l.svcCtx.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&model.JobWorkflowRun{}).Where("id = ? AND status = ?", run.ID, run.Status).Updates(map[string]any{
+			"status":       "running",
+			"end_time":     nil,
+			"heartbeat_at": now,
+			"updated_at":   now,
+		})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return fmt.Errorf("%w: run is still running", ErrWorkflowNotRetryable)
+		}
+		return tx.Model(&model.JobWorkflowStep{}).
+			Where("workflow_run_id = ? AND name IN ?", run.ID, workflowDescendants(defs, from)).
+			Updates(map[string]any{
+				"status":        "pending",
+				"attempts":      0,
+				"job_run_id":    "",
+				"outputs_json":  "",
+				"error_message": "",
+				"start_time":    nil,
+				"end_time":      nil,
+				"updated_at":    now,
+			}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range from {
+		l.jobLog(ctx, steps[name].JobID, 0, "info", fmt.Sprintf("Workflow run %d retrying from step %s", run.ID, name))
+	}
+
+	go l.runWorkflow(run.ID)
+	return l.getWorkflowRunRow(ctx, run.ID)
+}
+
+func (l *Logic) listWorkflowRuns(ctx context.Context, workflowID uint, page, pageSize int) ([]model.JobWorkflowRun, int64, error) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 20
+	}
+
+	var total int64
+	if err := l.svcCtx.DB.WithContext(ctx).Model(&model.JobWorkflowRun{}).Where("workflow_id = ?", workflowID).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var runs []model.JobWorkflowRun
+	offset := (page - 1) * pageSize
+	if err := l.svcCtx.DB.WithContext(ctx).Where("workflow_id = ?", workflowID).Order("id desc").Offset(offset).Limit(pageSize).Find(&runs).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return runs, total, nil
+}
+
+func (l *Logic) getWorkflowRunRow(ctx context.Context, runID uint) (*model.JobWorkflowRun, error) {
+	var run model.JobWorkflowRun
+	if err := l.svcCtx.DB.WithContext(ctx).First(&run, runID).Error; err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// getWorkflowRun 返回编排运行的步骤状态图, 步骤按定义顺序排列。
+func (l *Logic) getWorkflowRun(ctx context.Context, workflowID, runID uint) (*workflowRunGraph, error) {
+	var run model.JobWorkflowRun
+	if err := l.svcCtx.DB.WithContext(ctx).Where("id = ? AND workflow_id = ?", runID, workflowID).First(&run).Error; err != nil {
+		return nil, err
+	}
+	var defs []workflowStep
+	if err := json.Unmarshal([]byte(run.StepsJSON), &defs); err != nil {
+		return nil, err
+	}
+	steps, err := l.workflowSteps(ctx, run.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	graph := &workflowRunGraph{Run: run, Steps: make([]workflowStepState, 0, len(defs)), Edges: make([]workflowEdge, 0)}
+	for _, def := range defs {
+		row := steps[def.Name]
+		if row == nil {
+			continue
+		}
+		state := workflowStepState{
+			JobWorkflowStep: *row,
+			DependsOn:       def.DependsOn,
+			When:            def.When,
+			Retries:         def.Retries,
+			Outputs:         stepOutputs(row),
+		}
+		if state.DependsOn == nil {
+			state.DependsOn = []string{}
+		}
+		graph.Steps = append(graph.Steps, state)
+		for _, dep := range def.DependsOn {
+			graph.Edges = append(graph.Edges, workflowEdge{From: dep, To: def.Name})
+		}
+	}
+	return graph, nil
+}
+
+// workflowSteps 返回编排运行的步骤, 按步骤名索引。
+func (l *Logic) workflowSteps(ctx context.Context, runID uint) (map[string]*model.JobWorkflowStep, error) {
+	var rows []model.JobWorkflowStep
+	if err := l.svcCtx.DB.WithContext(ctx).Where("workflow_run_id = ?", runID).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	steps := make(map[string]*model.JobWorkflowStep, len(rows))
+	for i := range rows {
+		steps[rows[i].Name] = &rows[i]
+	}
+	return steps, nil
+}
+
+func stepOutputs(row *model.JobWorkflowStep) map[string]string {
+	outputs := map[string]string{}
+	if row.OutputsJSON != "" {
+		_ = json.Unmarshal([]byte(row.OutputsJSON), &outputs)
+	}
+	return outputs
+}
+
+// runWorkflow 按依赖顺序执行编排运行中待执行的步骤, 互不依赖的步骤并行执行, 全部结束后汇总运行状态:
+// 任一步骤失败时运行失败, 否则成功。
+func (l *Logic) runWorkflow(runID uint) {
+	ctx := context.Background()
+	run, err := l.getWorkflowRunRow(ctx, runID)
+	if err != nil {
+		logger.L().Warn("load workflow run failed", logger.Int("run_id", int(runID)), logger.Error(err))
+		return
+	}
+	var defs []workflowStep
+	if err := json.Unmarshal([]byte(run.StepsJSON), &defs); err != nil {
+		logger.L().Warn("parse workflow run steps failed", logger.Int("run_id", int(runID)), logger.Error(err))
+		l.finishWorkflowRun(ctx, run.ID, "failed")
+		return
+	}
+	vars := map[string]string{}
+	if run.VariablesJSON != "" {
+		_ = json.Unmarshal([]byte(run.VariablesJSON), &vars)
+	}
+	order, err := workflowOrder(defs)
+	if err != nil {
+		l.finishWorkflowRun(ctx, run.ID, "failed")
+		return
+	}
+	byName := make(map[string]workflowStep, len(defs))
+	for _, def := range defs {
+		byName[def.Name] = def
+	}
+	ancestors := workflowAncestors(defs)
+	stop := l.heartbeatWorkflowRun(ctx, run.ID)
+	defer stop()
+
+	done := make(chan struct{}, len(defs))
+	active := 0
+	for {
+		progressed := false
+		steps, err := l.workflowSteps(ctx, run.ID)
+		if err != nil {
+			logger.L().Warn("load workflow steps failed", logger.Int("run_id", int(runID)), logger.Error(err))
+		} else {
+			for _, def := range order {
+				row := steps[def.Name]
+				if row == nil || row.Status != "pending" {
+					continue
+				}
+				ready, execute, reason := evaluateStep(def, byName, steps)
+				if !ready {
+					continue
+				}
+				if !execute {
+					if l.skipWorkflowStep(ctx, run.ID, row, reason) {
+						progressed = true
+					}
+					continue
+				}
+				now := time.Now()
+				res := l.svcCtx.DB.WithContext(ctx).Model(&model.JobWorkflowStep{}).
+					Where("id = ? AND status = ?", row.ID, "pending").
+					Updates(map[string]any{"status": "running", "start_time": now, "updated_at": now})
+				if res.Error != nil || res.RowsAffected == 0 {
+					continue
+				}
+				row.Status = "running"
+				active++
+				scope := workflowScope(vars, steps, ancestors[def.Name])
+				go func(def workflowStep, stepID uint) {
+					defer func() { done <- struct{}{} }()
+					l.runWorkflowStep(ctx, run.ID, def, stepID, scope)
+				}(def, row.ID)
+			}
+		}
+		if progressed {
+			continue
+		}
+		if active == 0 {
+			break
+		}
+		<-done
+		active--
+	}
+
+	steps, err := l.workflowSteps(ctx, run.ID)
+	status := "success"
+	if err != nil {
+		status = "failed"
+	}
+	for _, row := range steps {
+		if row.Status != "success" && row.Status != "skipped" {
+			status = "failed"
+		}
+	}
+	l.finishWorkflowRun(ctx, run.ID, status)
+}
+
+// evaluateStep 判断步骤的依赖是否都已结束, 以及按执行条件是否执行; 不执行时返回跳过原因。
+func evaluateStep(def workflowStep, defs map[string]workflowStep, steps map[string]*model.JobWorkflowStep) (ready, execute bool, reason string) {
+	for _, dep := range def.DependsOn {
+		row := steps[dep]
+		if row == nil || row.Status == "pending" || row.Status == "running" {
+			return false, false, ""
+		}
+	}
+	switch def.When {
+	case whenAlways:
+		return true, true, ""
+	case whenFailure:
+		for _, dep := range def.DependsOn {
+			if upstreamFailed(dep, defs, steps) {
+				return true, true, ""
+			}
+		}
+		return true, false, "no dependency failed"
+	default:
+		for _, dep := range def.DependsOn {
+			if status := steps[dep].Status; status != "success" {
+				return true, false, fmt.Sprintf("dependency %s %s", dep, status)
+			}
+		}
+		return true, true, ""
+	}
+}
+
+// upstreamFailed 判断步骤失败, 或因上游步骤失败而被跳过。
+func upstreamFailed(name string, defs map[string]workflowStep, steps map[string]*model.JobWorkflowStep) bool {
+	row := steps[name]
+	if row == nil {
+		return false
+	}
+	switch row.Status {
+	case "failed":
+		return true
+	case "skipped":
+		for _, dep := range defs[name].DependsOn {
+			if upstreamFailed(dep, defs, steps) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// workflowScope 返回步骤可引用的变量: 运行变量与上游步骤的输出。
+func workflowScope(vars map[string]string, steps map[string]*model.JobWorkflowStep, upstream map[string]bool) map[string]string {
+	scope := make(map[string]string, len(vars))
+	for key, value := range vars {
+		scope["vars."+key] = value
+	}
+	for name := range upstream {
+		row := steps[name]
+		if row == nil || row.Status != "success" {
+			continue
+		}
+		for key, value := range stepOutputs(row) {
+			scope["steps."+name+".outputs."+key] = value
+		}
+	}
+	return scope
+}
+
+// runWorkflowStep 执行一个步骤, 失败时按 retries 与 retry_delay 重试, 成功时保存步骤输出。
+func (l *Logic) runWorkflowStep(ctx context.Context, runID uint, def workflowStep, stepID uint, scope map[string]string) {
+	attempts := def.Retries + 1
+	var (
+		outputs map[string]string
+		err     error
+	)
+	for attempt := 1; attempt <= attempts; attempt++ {
+		l.svcCtx.DB.WithContext(ctx).Model(&model.JobWorkflowStep{}).Where("id = ?", stepID).
+			Updates(map[string]any{"attempts": attempt, "updated_at": time.Now()})
+		var jobRunID string
+		jobRunID, outputs, err = l.runWorkflowJob(ctx, def, scope)
+		if jobRunID != "" {
+			l.svcCtx.DB.WithContext(ctx).Model(&model.JobWorkflowStep{}).Where("id = ?", stepID).Update("job_run_id", jobRunID)
+		}
+		if err == nil {
+			break
+		}
+		if attempt < attempts {
+			l.jobLog(ctx, def.JobID, 0, "warn", fmt.Sprintf("Workflow run %d step %s attempt %d/%d failed: %v, retrying", runID, def.Name, attempt, attempts, err))
+			if waitErr := waitRetryDelay(ctx, time.Duration(def.RetryDelay)*time.Second); waitErr != nil {
+				err = fmt.Errorf("%v; retry canceled: %w", err, waitErr)
+				break
+			}
+		}
+	}
+
+	now := time.Now()
+	updates := map[string]any{"status": "success", "end_time": now, "updated_at": now, "error_message": ""}
+	level, message := "info", fmt.Sprintf("Workflow run %d step %s succeeded", runID, def.Name)
+	if err != nil {
+		updates["status"] = "failed"
+		updates["error_message"] = err.Error()
+		level, message = "error", fmt.Sprintf("Workflow run %d step %s failed: %v", runID, def.Name, err)
+	}
+	if len(outputs) > 0 {
+		raw, _ := json.Marshal(outputs)
+		updates["outputs_json"] = string(raw)
+	}
+	if err := l.svcCtx.DB.WithContext(ctx).Model(&model.JobWorkflowStep{}).Where("id = ?", stepID).Updates(updates).Error; err != nil {
+		logger.L().Warn("save workflow step failed", logger.Int("step_id", int(stepID)), logger.Error(err))
+	}
+	l.jobLog(ctx, def.JobID, 0, level, message)
+}
+
+// waitRetryDelay 等待重试间隔, ctx 结束时提前返回其错误。
+func waitRetryDelay(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// runWorkflowJob 以步骤的变量执行一次任务, 返回任务运行 ID 与各主机标准输出中声明的步骤输出
+// (多台主机声明同名输出时以后执行记录中的为准)。
+// 任务命令中的变量引用替换为 shell 转义后的值, 步骤的环境变量在命令前导出。
+func (l *Logic) runWorkflowJob(ctx context.Context, def workflowStep, scope map[string]string) (string, map[string]string, error) {
+	job, err := l.getJob(ctx, def.JobID)
+	if err != nil {
+		return "", nil, err
+	}
+	if job.Type == jobTypeK8s {
+		return l.runWorkflowK8sJob(ctx, job, def, scope)
+	}
+	if strings.TrimSpace(job.Command) == "" {
+		return "", nil, ErrJobNotRunnable
+	}
+	command, err := renderWorkflowVars(job.Command, scope, shellQuote)
+	if err != nil {
+		return "", nil, err
+	}
+	keys := make([]string, 0, len(def.Env))
+	for key := range def.Env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var exports strings.Builder
+	for _, key := range keys {
+		value, err := renderWorkflowVars(def.Env[key], scope, nil)
+		if err != nil {
+			return "", nil, err
+		}
+		fmt.Fprintf(&exports, "export %s=%s\n", key, shellQuote(value))
+	}
+	job.Command = exports.String() + command
+
+	runID, executions, nodes, err := l.prepareRun(ctx, job, triggerWorkflow, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	status := l.runJob(ctx, *job, runID, executions, nodes)
+	return l.runOutputs(ctx, job.ID, runID, status)
+}
+
+// runWorkflowK8sJob 以 Job 运行 k8s 任务的一个步骤: 命令与参数中的变量引用按值替换, 步骤的环境变量注入容器。
+// 命令行形式的命令经 shell 执行, 替换的值按 shell 引用。
+func (l *Logic) runWorkflowK8sJob(ctx context.Context, job *model.Job, def workflowStep, scope map[string]string) (string, map[string]string, error) {
+	command, err := k8sCommand(job.Command)
+	if err != nil {
+		return "", nil, err
+	}
+	if strings.HasPrefix(strings.TrimSpace(job.Command), "[") {
+		for i := range command {
+			if command[i], err = renderWorkflowVars(command[i], scope, nil); err != nil {
+				return "", nil, err
+			}
+		}
+		data, _ := json.Marshal(command)
+		job.Command = string(data)
+	} else if job.Command, err = renderWorkflowVars(job.Command, scope, shellQuote); err != nil {
+		return "", nil, err
+	}
+	args, err := k8sArgs(job.ArgsJSON)
+	if err != nil {
+		return "", nil, err
+	}
+	for i := range args {
+		if args[i], err = renderWorkflowVars(args[i], scope, nil); err != nil {
+			return "", nil, err
+		}
+	}
+	job.ArgsJSON = encodeK8sArgs(args)
+	env := make(map[string]string, len(def.Env))
+	for key, value := range def.Env {
+		if env[key], err = renderWorkflowVars(value, scope, nil); err != nil {
+			return "", nil, err
+		}
+	}
+
+	runID, execution, err := l.prepareK8sRun(ctx, job, triggerWorkflow, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	status := l.runK8sJob(ctx, *job, runID, execution, env)
+	return l.runOutputs(ctx, job.ID, runID, status)
+}
+
+// runOutputs 从一次任务运行的输出中解析步骤输出, 运行未成功时返回错误。
+func (l *Logic) runOutputs(ctx context.Context, jobID uint, runID, status string) (string, map[string]string, error) {
+	var rows []model.JobExecution
+	if err := l.svcCtx.DB.WithContext(ctx).Select("id", "output").Where("run_id = ?", runID).Order("id ASC").Find(&rows).Error; err != nil {
+		return runID, nil, err
+	}
+	outputs := map[string]string{}
+	for _, row := range rows {
+		for _, match := range stepOutputPattern.FindAllStringSubmatch(row.Output, -1) {
+			outputs[match[1]] = match[2]
+		}
+	}
+	if status != "success" {
+		return runID, outputs, fmt.Errorf("job %d run %s %s", jobID, runID, status)
+	}
+	return runID, outputs, nil
+}
+
+// skipWorkflowStep 把不满足执行条件的步骤标记为 skipped, 返回是否标记成功。
+func (l *Logic) skipWorkflowStep(ctx context.Context, runID uint, row *model.JobWorkflowStep, reason string) bool {
+	now := time.Now()
+	res := l.svcCtx.DB.WithContext(ctx).Model(&model.JobWorkflowStep{}).
+		Where("id = ? AND status = ?", row.ID, "pending").
+		Updates(map[string]any{"status": "skipped", "error_message": reason, "end_time": now, "updated_at": now})
+	if res.Error != nil {
+		logger.L().Warn("skip workflow step failed", logger.Int("step_id", int(row.ID)), logger.Error(res.Error))
+		return false
+	}
+	row.Status = "skipped"
+	l.jobLog(ctx, row.JobID, 0, "info", fmt.Sprintf("Workflow run %d step %s skipped: %s", runID, row.Name, reason))
+	return true
+}
+
+func (l *Logic) finishWorkflowRun(ctx context.Context, runID uint, status string) {
+	now := time.Now()
+	if err := l.svcCtx.DB.WithContext(ctx).Model(&model.JobWorkflowRun{}).Where("id = ?", runID).Updates(map[string]any{
+		"status":     status,
+		"end_time":   now,
+		"updated_at": now,
+	}).Error; err != nil {
+		logger.L().Warn("save workflow run failed", logger.Int("run_id", int(runID)), logger.Error(err))
+	}
+}
+
+// heartbeatWorkflowRun 定期更新运行的心跳, 直到调用返回的函数为止。
+func (l *Logic) heartbeatWorkflowRun(ctx context.Context, runID uint) func() {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(workflowHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			err := l.svcCtx.DB.WithContext(ctx).Model(&model.JobWorkflowRun{}).
+				Where("id = ? AND status = ?", runID, "running").
+				Update("heartbeat_at", time.Now()).Error
+			if err != nil && ctx.Err() == nil {
+				logger.L().Warn("update workflow run heartbeat failed", logger.Int("run_id", int(runID)), logger.Error(err))
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// recoverWorkflowRuns 把心跳超时的运行标记为失败。执行这些运行的副本已退出, 运行不会再推进,
+// 标记后可从中断的步骤重试。
+func (l *Logic) recoverWorkflowRuns(ctx context.Context, now time.Time) {
+	var runs []model.JobWorkflowRun
+	if err := l.svcCtx.DB.WithContext(ctx).
+		Where("status = ? AND COALESCE(heartbeat_at, updated_at) < ?", "running", now.Add(-workflowStaleAfter)).
+		Limit(dueBatchSize).Find(&runs).Error; err != nil {
+		logger.L().Warn("load stale workflow runs failed", logger.Error(err))
+		return
+	}
+	for i := range runs {
+		if _, err := l.failStaleWorkflowRun(ctx, &runs[i], now); err != nil {
+			logger.L().Warn("fail stale workflow run failed", logger.Int("run_id", int(runs[i].ID)), logger.Error(err))
+		}
+	}
+}
+
+// failStaleWorkflowRun 在运行的心跳超时时把运行标记为失败, 执行中的步骤记为中断失败; 返回是否标记成功。
+func (l *Logic) failStaleWorkflowRun(ctx context.Context, run *model.JobWorkflowRun, now time.Time) (bool, error) {
+	stale := false
+	var interrupted []model.JobWorkflowStep
+	err := l.svcCtx.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&model.JobWorkflowRun{}).
+			Where("id = ? AND status = ? AND COALESCE(heartbeat_at, updated_at) < ?", run.ID, "running", now.Add(-workflowStaleAfter)).
+			Updates(map[string]any{"status": "failed", "end_time": now, "updated_at": now})
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		stale = true
+		if err := tx.Where("workflow_run_id = ? AND status = ?", run.ID, "running").Find(&interrupted).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.JobWorkflowStep{}).
+			Where("workflow_run_id = ? AND status = ?", run.ID, "running").
+			Updates(map[string]any{"status": "failed", "error_message": "workflow run interrupted", "end_time": now, "updated_at": now}).Error
+	})
+	if err != nil || !stale {
+		return false, err
+	}
+	run.Status = "failed"
+	for _, row := range interrupted {
+		l.jobLog(ctx, row.JobID, 0, "error", fmt.Sprintf("Workflow run %d step %s interrupted: no heartbeat for %s", run.ID, row.Name, workflowStaleAfter))
+	}
+	return true, nil
+}
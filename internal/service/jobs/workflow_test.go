@@ -0,0 +1,304 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cy77cc/OpsPilot/internal/model"
+)
+
+// waitWorkflowRun 等待编排运行结束并返回步骤状态图。
+func waitWorkflowRun(t *testing.T, l *Logic, workflowID, runID uint) *workflowRunGraph {
+	t.Helper()
+	deadline := time.Now().Add(15 * time.Second)
+	for time.Now().Before(deadline) {
+		graph, err := l.getWorkflowRun(context.Background(), workflowID, runID)
+		if err == nil && graph.Run.Status != "running" {
+			return graph
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("workflow run %d did not finish", runID)
+	return nil
+}
+
+func stepStates(graph *workflowRunGraph) map[string]workflowStepState {
+	states := make(map[string]workflowStepState, len(graph.Steps))
+	for _, step := range graph.Steps {
+		states[step.Name] = step
+	}
+	return states
+}
+
+func mustCreateJob(t *testing.T, l *Logic, name, command, hosts string) uint {
+	t.Helper()
+	job, err := l.createJob(context.Background(), 1, createJobReq{Name: name, Command: command, HostIDs: hosts})
+	if err != nil {
+		t.Fatalf("create job %s: %v", name, err)
+	}
+	return job.ID
+}
+
+func TestWorkflowRunsDAGWithConditionsAndOutputs(t *testing.T) {
+	l := newTestLogic(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	trace := filepath.Join(dir, "trace")
+
+	drain := mustCreateJob(t, l, "drain", `echo "::set-output node=$HOST"; echo "::set-output ticket=CHG 42"; echo drain >> `+trace, "1")
+	patch := mustCreateJob(t, l, "patch", `echo "patch $NODE" ${{ vars.version }} "for $TICKET" >> `+trace+`; test ${{ vars.version }} != broken`, "2")
+	reboot := mustCreateJob(t, l, "reboot", `echo reboot >> `+trace, "2")
+	rollback := mustCreateJob(t, l, "rollback", `echo rollback >> `+trace, "2")
+	notify := mustCreateJob(t, l, "notify", `echo notify >> `+trace, "4")
+
+	workflow, err := l.createWorkflow(ctx, 1, createWorkflowReq{Name: "node-maintenance", Steps: []workflowStep{
+		{Name: "drain", JobID: drain},
+		{Name: "patch", JobID: patch, DependsOn: []string{"drain"}, Env: map[string]string{
+			"NODE":   "${{ steps.drain.outputs.node }}",
+			"TICKET": "${{ steps.drain.outputs.ticket }}",
+		}},
+		{Name: "reboot", JobID: reboot, DependsOn: []string{"patch"}},
+		{Name: "rollback", JobID: rollback, DependsOn: []string{"reboot"}, When: whenFailure},
+		{Name: "notify", JobID: notify, DependsOn: []string{"reboot", "rollback"}, When: whenAlways},
+	}})
+	if err != nil {
+		t.Fatalf("create workflow: %v", err)
+	}
+
+	run, err := l.startWorkflow(ctx, workflow.ID, 1, map[string]string{"version": "5.15"})
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	graph := waitWorkflowRun(t, l, workflow.ID, run.ID)
+	states := stepStates(graph)
+	if graph.Run.Status != "success" {
+		t.Fatalf("expected run to succeed, got %+v", states)
+	}
+	for name, want := range map[string]string{"drain": "success", "patch": "success", "reboot": "success", "rollback": "skipped", "notify": "success"} {
+		if states[name].Status != want {
+			t.Fatalf("expected step %s %s, got %+v", name, want, states[name])
+		}
+	}
+	if out := states["drain"].Outputs; out["node"] != "web-1" || out["ticket"] != "CHG 42" {
+		t.Fatalf("expected drain outputs, got %+v", out)
+	}
+	if states["patch"].JobRunID == "" || states["patch"].Attempts != 1 {
+		t.Fatalf("expected patch to record its job run, got %+v", states["patch"])
+	}
+	if len(graph.Edges) != 5 || states["notify"].When != whenAlways {
+		t.Fatalf("unexpected graph %+v", graph)
+	}
+	if raw, _ := os.ReadFile(trace); string(raw) != "drain\npatch web-1 5.15 for CHG 42\nreboot\nnotify\n" {
+		t.Fatalf("unexpected step order or variables %q", raw)
+	}
+	if rows := executions(t, l, patch); rows[0].Trigger != triggerWorkflow || rows[0].RunID != states["patch"].JobRunID {
+		t.Fatalf("expected workflow execution, got %+v", rows[0])
+	}
+
+	// 步骤失败: 下游按条件跳过, failure 分支执行, always 步骤照常执行。
+	os.Remove(trace)
+	run, _ = l.startWorkflow(ctx, workflow.ID, 1, map[string]string{"version": "broken"})
+	graph = waitWorkflowRun(t, l, workflow.ID, run.ID)
+	states = stepStates(graph)
+	if graph.Run.Status != "failed" || states["patch"].Status != "failed" || states["reboot"].Status != "skipped" ||
+		states["rollback"].Status != "success" || states["notify"].Status != "success" {
+		t.Fatalf("unexpected failure branch states %+v", states)
+	}
+	if states["reboot"].ErrorMessage != "dependency patch failed" {
+		t.Fatalf("expected skip reason, got %q", states["reboot"].ErrorMessage)
+	}
+	if raw, _ := os.ReadFile(trace); string(raw) != "drain\npatch web-1 broken for CHG 42\nrollback\nnotify\n" {
+		t.Fatalf("unexpected failure branch trace %q", raw)
+	}
+}
+
+func TestWorkflowStepRetriesAndRetryFromFailedStep(t *testing.T) {
+	l := newTestLogic(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	counter := filepath.Join(dir, "attempts")
+	ready := filepath.Join(dir, "ready")
+
+	// 前两次执行失败, 第三次成功。
+	flaky := mustCreateJob(t, l, "flaky", `n=$(cat `+counter+` 2>/dev/null || echo 0); echo $((n+1)) > `+counter+`; test "$n" -ge 2`, "1")
+	prepare := mustCreateJob(t, l, "prepare", `echo "::set-output token=abc"`, "1")
+	verify := mustCreateJob(t, l, "verify", `test -f `+ready+` && echo ::set-output checked=${{ steps.prepare.outputs.token }}`, "2")
+	finish := mustCreateJob(t, l, "finish", `echo "$CHECKED"`, "4")
+
+	workflow, err := l.createWorkflow(ctx, 1, createWorkflowReq{Name: "retries", Steps: []workflowStep{
+		{Name: "flaky", JobID: flaky, Retries: 2},
+		{Name: "prepare", JobID: prepare},
+		{Name: "verify", JobID: verify, DependsOn: []string{"prepare", "flaky"}},
+		{Name: "finish", JobID: finish, DependsOn: []string{"verify"}, Env: map[string]string{"CHECKED": "${{ steps.verify.outputs.checked }}"}},
+	}})
+	if err != nil {
+		t.Fatalf("create workflow: %v", err)
+	}
+	run, err := l.startWorkflow(ctx, workflow.ID, 1, nil)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	graph := waitWorkflowRun(t, l, workflow.ID, run.ID)
+	states := stepStates(graph)
+	if states["flaky"].Status != "success" || states["flaky"].Attempts != 3 || len(executions(t, l, flaky)) != 3 {
+		t.Fatalf("expected flaky step to succeed on the third attempt, got %+v", states["flaky"])
+	}
+	if graph.Run.Status != "failed" || states["verify"].Status != "failed" || states["finish"].Status != "skipped" {
+		t.Fatalf("expected verify to fail, got %+v", states)
+	}
+	if _, err := l.retryWorkflowRun(ctx, workflow.ID, run.ID, "prepare"); !errors.Is(err, ErrWorkflowNotRetryable) {
+		t.Fatalf("expected succeeded step not to be retryable, got %v", err)
+	}
+
+	prepareRun := states["prepare"].JobRunID
+	if err := os.WriteFile(ready, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	retried, err := l.retryWorkflowRun(ctx, workflow.ID, run.ID, "verify")
+	if err != nil || retried.Status != "running" {
+		t.Fatalf("retry: %+v %v", retried, err)
+	}
+	if _, err := l.retryWorkflowRun(ctx, workflow.ID, run.ID, ""); !errors.Is(err, ErrWorkflowNotRetryable) {
+		t.Fatalf("expected running run not to be retryable, got %v", err)
+	}
+	graph = waitWorkflowRun(t, l, workflow.ID, run.ID)
+	states = stepStates(graph)
+	if graph.Run.Status != "success" || states["verify"].Status != "success" || states["finish"].Status != "success" {
+		t.Fatalf("expected retry to complete the run, got %+v", states)
+	}
+	if states["prepare"].JobRunID != prepareRun || states["flaky"].Attempts != 3 {
+		t.Fatalf("expected upstream steps to be kept, got %+v", states)
+	}
+	if out := executions(t, l, finish); len(out) != 1 || out[0].Output != "abc\n" {
+		t.Fatalf("expected outputs of kept steps to flow after retry, got %+v", out)
+	}
+	if _, err := l.retryWorkflowRun(ctx, workflow.ID, run.ID, ""); !errors.Is(err, ErrWorkflowNotRetryable) {
+		t.Fatalf("expected successful run not to be retryable, got %v", err)
+	}
+}
+
+func TestWorkflowRecoversRunsWithoutHeartbeat(t *testing.T) {
+	l := newTestLogic(t)
+	ctx := context.Background()
+	first := mustCreateJob(t, l, "first", "echo first", "1")
+	second := mustCreateJob(t, l, "second", "echo second", "2")
+	workflow, err := l.createWorkflow(ctx, 1, createWorkflowReq{Name: "orphan", Steps: []workflowStep{
+		{Name: "first", JobID: first},
+		{Name: "second", JobID: second, DependsOn: []string{"first"}},
+	}})
+	if err != nil {
+		t.Fatalf("create workflow: %v", err)
+	}
+	// 模拟执行运行的副本退出: 运行与步骤停留在 running, 心跳不再更新。
+	orphan := func() *model.JobWorkflowRun {
+		beat := time.Now().Add(-2 * workflowStaleAfter)
+		run := model.JobWorkflowRun{WorkflowID: workflow.ID, Status: "running", StepsJSON: workflow.StepsJSON, StartTime: beat, HeartbeatAt: &beat}
+		if err := l.svcCtx.DB.Create(&run).Error; err != nil {
+			t.Fatalf("seed run: %v", err)
+		}
+		steps := []model.JobWorkflowStep{
+			{WorkflowRunID: run.ID, Name: "first", JobID: first, Status: "running", StartTime: &beat},
+			{WorkflowRunID: run.ID, Name: "second", JobID: second, Status: "pending"},
+		}
+		if err := l.svcCtx.DB.Create(&steps).Error; err != nil {
+			t.Fatalf("seed steps: %v", err)
+		}
+		return &run
+	}
+
+	swept := orphan()
+	newTestScheduler(l, 3).runDue(ctx, time.Now())
+	graph, err := l.getWorkflowRun(ctx, workflow.ID, swept.ID)
+	if err != nil {
+		t.Fatalf("get run: %v", err)
+	}
+	if states := stepStates(graph); graph.Run.Status != "failed" || states["first"].Status != "failed" || states["second"].Status != "pending" {
+		t.Fatalf("expected stale run to be marked failed, got %s %+v", graph.Run.Status, states)
+	}
+
+	// 调度器未运行时, 重试也能接管失联的运行。
+	retried := orphan()
+	if _, err := l.retryWorkflowRun(ctx, workflow.ID, retried.ID, ""); err != nil {
+		t.Fatalf("retry stale run: %v", err)
+	}
+	graph = waitWorkflowRun(t, l, workflow.ID, retried.ID)
+	if states := stepStates(graph); graph.Run.Status != "success" || states["first"].Status != "success" || states["second"].Status != "success" {
+		t.Fatalf("expected retried run to complete, got %s %+v", graph.Run.Status, states)
+	}
+}
+
+func TestWorkflowValidation(t *testing.T) {
+	l := newTestLogic(t)
+	ctx := context.Background()
+	job := mustCreateJob(t, l, "noop", "true", "1")
+
+	for name, steps := range map[string][]workflowStep{
+		"empty":      nil,
+		"cycle":      {{Name: "a", JobID: job, DependsOn: []string{"b"}}, {Name: "b", JobID: job, DependsOn: []string{"a"}}},
+		"self":       {{Name: "a", JobID: job, DependsOn: []string{"a"}}},
+		"unknown":    {{Name: "a", JobID: job, DependsOn: []string{"ghost"}}},
+		"duplicate":  {{Name: "a", JobID: job}, {Name: "a", JobID: job}},
+		"bad-name":   {{Name: "a b", JobID: job}},
+		"bad-when":   {{Name: "a", JobID: job, When: "sometimes"}},
+		"retries":    {{Name: "a", JobID: job, Retries: maxStepRetries + 1}},
+		"bad-env":    {{Name: "a", JobID: job, Env: map[string]string{"1X": "v"}}},
+		"bad-ref":    {{Name: "a", JobID: job, Env: map[string]string{"X": "${{ secrets.token }}"}}},
+		"downstream": {{Name: "a", JobID: job, Env: map[string]string{"X": "${{ steps.b.outputs.v }}"}}, {Name: "b", JobID: job, DependsOn: []string{"a"}}},
+		"no-job":     {{Name: "a", JobID: 999}},
+		"parallel":   {{Name: "a", JobID: job}, {Name: "b", JobID: job}},
+	} {
+		if _, err := l.createWorkflow(ctx, 1, createWorkflowReq{Name: name, Steps: steps}); !errors.Is(err, ErrInvalidWorkflow) {
+			t.Fatalf("expected %s workflow to be rejected, got %v", name, err)
+		}
+	}
+
+	workflow, err := l.createWorkflow(ctx, 1, createWorkflowReq{Name: "ok", Steps: []workflowStep{{Name: "a", JobID: job, DependsOn: []string{}}}})
+	if err != nil || !strings.Contains(workflow.StepsJSON, `"when":"success"`) {
+		t.Fatalf("expected defaults to be stored, got %+v %v", workflow, err)
+	}
+	// 编排保存后任务被删除: 启动时重新校验。
+	l.svcCtx.DB.Delete(&model.Job{}, job)
+	if _, err := l.startWorkflow(ctx, workflow.ID, 1, nil); !errors.Is(err, ErrInvalidWorkflow) {
+		t.Fatalf("expected start with a deleted job to be rejected, got %v", err)
+	}
+
+	// 引用未定义的变量时步骤失败。
+	echo := mustCreateJob(t, l, "echo", "echo ${{ vars.missing }}", "1")
+	workflow, _ = l.createWorkflow(ctx, 1, createWorkflowReq{Name: "undefined", Steps: []workflowStep{{Name: "a", JobID: echo}}})
+	run, err := l.startWorkflow(ctx, workflow.ID, 1, nil)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	graph := waitWorkflowRun(t, l, workflow.ID, run.ID)
+	if state := graph.Steps[0]; state.Status != "failed" || state.ErrorMessage != "undefined variable vars.missing" {
+		t.Fatalf("expected undefined variable to fail the step, got %+v", state)
+	}
+}
+
+func TestRenderWorkflowVars(t *testing.T) {
+	scope := map[string]string{"vars.name": "it's", "steps.a.outputs.v": "1"}
+	got, err := renderWorkflowVars("echo ${{vars.name}} ${{ steps.a.outputs.v }}", scope, shellQuote)
+	if err != nil || got != `echo 'it'\''s' '1'` {
+		t.Fatalf("unexpected render %q %v", got, err)
+	}
+	if _, err := renderWorkflowVars("${{ vars.x }} ${{ vars.y }}", scope, nil); err == nil || err.Error() != "undefined variable vars.x, vars.y" {
+		t.Fatalf("expected undefined variables, got %v", err)
+	}
+}
+
+func TestWaitRetryDelayStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	if err := waitRetryDelay(ctx, time.Hour); !errors.Is(err, context.Canceled) || time.Since(start) > time.Second {
+		t.Fatalf("expected canceled wait to return at once, got %v after %s", err, time.Since(start))
+	}
+	if err := waitRetryDelay(context.Background(), 0); err != nil {
+		t.Fatalf("expected zero delay to return nil, got %v", err)
+	}
+}
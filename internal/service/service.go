@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"io/fs"
 	"net/http"
 	"strings"
@@ -30,7 +31,7 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func Init(r *gin.Engine, serverCtx *svc.ServiceContext) {
+func Init(ctx context.Context, r *gin.Engine, serverCtx *svc.ServiceContext) {
 	r.Use(gin.Recovery(), middleware.ContextMiddleware(), middleware.Cors(), middleware.Logger())
 	r.GET("/api/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"status": "ok"})
@@ -45,7 +46,7 @@ func Init(r *gin.Engine, serverCtx *svc.ServiceContext) {
 	automation.RegisterAutomationHandlers(v1, serverCtx)
 	host.RegisterHostHandlers(v1, serverCtx)
 	cluster.RegisterClusterHandlers(v1, serverCtx)
-	deployment.RegisterDeploymentHandlers(v1, serverCtx)
+	deployment.RegisterDeploymentHandlers(ctx, v1, serverCtx)
 	monitoring.RegisterMonitoringHandlers(v1, serverCtx)
 	dashboard.RegisterDashboardHandlers(v1, serverCtx)
 	cmdb.RegisterCMDBHandlers(v1, serverCtx)
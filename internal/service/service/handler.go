@@ -30,7 +30,7 @@ func (h *Handler) Preview(c *gin.Context) {
 		httpx.BindErr(c, err)
 		return
 	}
-	resp, err := h.logic.Preview(req)
+	resp, err := h.logic.Preview(c.Request.Context(), req)
 	if err != nil {
 		httpx.Fail(c, xcode.ServerError, err.Error())
 		return
@@ -1,18 +1,21 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"io"
 	"strings"
 
+	"github.com/cy77cc/OpsPilot/internal/service/deployment/admission"
 	"gopkg.in/yaml.v3"
 )
 
-func (l *Logic) Preview(req RenderPreviewReq) (RenderPreviewResp, error) {
+func (l *Logic) Preview(ctx context.Context, req RenderPreviewReq) (RenderPreviewResp, error) {
 	req.Variables = normalizeStringMap(req.Variables)
 	if req.Mode == "custom" {
 		diagnostics := validateCustomYAML(req.Target, req.CustomYAML)
 		resolved, unresolved := resolveTemplateVars(req.CustomYAML, req.Variables, nil)
+		diagnostics = append(diagnostics, l.admissionDiagnostics(ctx, req, resolved)...)
 		return RenderPreviewResp{
 			RenderedYAML:   req.CustomYAML,
 			ResolvedYAML:   resolved,
@@ -27,6 +30,7 @@ func (l *Logic) Preview(req RenderPreviewReq) (RenderPreviewResp, error) {
 	}
 	resp.DetectedVars = detectTemplateVars(resp.RenderedYAML)
 	resp.ResolvedYAML, resp.UnresolvedVars = resolveTemplateVars(resp.RenderedYAML, req.Variables, nil)
+	resp.Diagnostics = append(resp.Diagnostics, l.admissionDiagnostics(ctx, req, resp.ResolvedYAML)...)
 	resp.ASTSummary = map[string]any{
 		"target": req.Target,
 		"docs":   strings.Count(resp.RenderedYAML, "\n---\n") + 1,
@@ -34,6 +38,27 @@ func (l *Logic) Preview(req RenderPreviewReq) (RenderPreviewResp, error) {
 	return resp, nil
 }
 
+// admissionDiagnostics 用部署准入策略检查预览清单, 让作者在编辑时就能看到违规。
+// enforce 违规以 error 级别返回, 发布时会被拒绝; warn 违规以 warning 级别返回。
+func (l *Logic) admissionDiagnostics(ctx context.Context, req RenderPreviewReq, manifest string) []RenderDiagnostic {
+	if l.svcCtx == nil || l.svcCtx.DB == nil || strings.TrimSpace(manifest) == "" {
+		return nil
+	}
+	res, err := admission.Check(ctx, l.svcCtx.DB, admission.Scope{ProjectID: req.ProjectID, Env: req.Env}, manifest)
+	if err != nil {
+		return []RenderDiagnostic{{Level: "warning", Code: "admission_unavailable", Message: err.Error()}}
+	}
+	out := make([]RenderDiagnostic, 0, len(res.Violations))
+	for _, v := range res.Violations {
+		level := "warning"
+		if v.Mode == admission.ModeEnforce {
+			level = "error"
+		}
+		out = append(out, RenderDiagnostic{Level: level, Code: "admission_" + v.Rule, Message: v.String()})
+	}
+	return out
+}
+
 func (l *Logic) Transform(req TransformReq) (TransformResp, error) {
 	res, err := renderFromStandard(req.ServiceName, req.ServiceType, req.Target, req.StandardConfig)
 	if err != nil {
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cy77cc/OpsPilot/internal/model"
+	"github.com/cy77cc/OpsPilot/internal/svc"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestPreviewReportsAdmissionViolations(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:renderadmission?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&model.Policy{}); err != nil {
+		t.Fatalf("auto migrate: %v", err)
+	}
+	db.Create(&model.Policy{Name: "no-latest", Type: model.PolicyTypeAdmission, Enabled: true, Config: map[string]any{
+		"mode": "enforce", "project_id": 9, "rules": []any{map[string]any{"type": "disallow_latest_tag"}},
+	}})
+	logic := NewLogic(&svc.ServiceContext{DB: db})
+	req := RenderPreviewReq{Mode: "custom", Target: "compose", CustomYAML: "services:\n  app:\n    image: nginx:{{tag}}\n", Variables: map[string]string{"tag": "latest"}, ProjectID: 9}
+
+	resp, err := logic.Preview(context.Background(), req)
+	if err != nil {
+		t.Fatalf("preview: %v", err)
+	}
+	found := false
+	for _, d := range resp.Diagnostics {
+		if d.Code == "admission_disallow_latest_tag" && d.Level == "error" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected enforced admission diagnostic, got %+v", resp.Diagnostics)
+	}
+
+	req.ProjectID = 10
+	resp, _ = logic.Preview(context.Background(), req)
+	for _, d := range resp.Diagnostics {
+		if d.Code == "admission_disallow_latest_tag" {
+			t.Fatalf("policy scoped to project 9 must not apply to project 10: %+v", d)
+		}
+	}
+}
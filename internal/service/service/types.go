@@ -54,6 +54,9 @@ type RenderPreviewReq struct {
 	ServiceType    string                 `json:"service_type"` // stateless/stateful
 	Variables      map[string]string      `json:"variables"`
 	ValidateOnly   bool                   `json:"validate_only"`
+	// ProjectID 与 Env 用于匹配部署准入策略的作用域, 未填写时只匹配全局策略。
+	ProjectID uint   `json:"project_id"`
+	Env       string `json:"env"`
 }
 
 type RenderDiagnostic struct {
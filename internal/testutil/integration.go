@@ -74,10 +74,15 @@ func autoMigrateAll(db *gorm.DB) error {
 		&model.DeploymentTargetNode{},
 		&model.DeploymentRelease{},
 		&model.DeploymentReleaseApproval{},
+		&model.DeploymentReleaseApprovalVote{},
+		&model.DeploymentFreezeWindow{},
+		&model.DeploymentTargetLock{},
+		&model.DeploymentReleaseHook{},
 		&model.DeploymentReleaseAudit{},
 		&model.ServiceGovernancePolicy{},
 		&model.AIOPSInspection{},
 		&model.Service{},
+		&model.ServiceVariableSet{},
 		&model.EnvironmentInstallJob{},
 		&model.EnvironmentInstallJobStep{},
 
@@ -87,6 +92,9 @@ func autoMigrateAll(db *gorm.DB) error {
 		// CICD
 		&model.CICDServiceCIConfig{},
 		&model.CICDServiceCIRun{},
+		&model.CICDServiceCIRunStep{},
+		&model.CICDWebhookDelivery{},
+		&model.CICDArtifact{},
 		&model.CICDDeploymentCDConfig{},
 		&model.CICDRelease{},
 		&model.CICDReleaseApproval{},
@@ -125,6 +133,14 @@ func autoMigrateAll(db *gorm.DB) error {
 		&model.Job{},
 		&model.JobExecution{},
 		&model.JobLog{},
+		&model.JobWorkflow{},
+		&model.JobWorkflowRun{},
+		&model.JobWorkflowStep{},
+		&model.LeaderLock{},
+
+		// Log streams
+		&model.LogChunk{},
+		&model.LogArchive{},
 
 		// Audit
 		&model.AuditLog{},
@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronNext(t *testing.T) {
+	base := time.Date(2026, 10, 16, 17, 59, 30, 0, time.UTC) // 周五
+	cases := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2026, 10, 16, 18, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2026, 10, 16, 18, 0, 0, 0, time.UTC)},
+		{"0 18 * * 5", time.Date(2026, 10, 16, 18, 0, 0, 0, time.UTC)},
+		{"30 9 * * 1-5", time.Date(2026, 10, 19, 9, 30, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 12 13 * 5", time.Date(2026, 10, 23, 12, 0, 0, 0, time.UTC)},
+		{"*/10 * * * * *", time.Date(2026, 10, 16, 17, 59, 40, 0, time.UTC)},
+		{"15 0 18 * * *", time.Date(2026, 10, 16, 18, 0, 15, 0, time.UTC)},
+	}
+	for _, tc := range cases {
+		s, err := ParseCron(tc.expr)
+		if err != nil {
+			t.Fatalf("ParseCron(%q): %v", tc.expr, err)
+		}
+		if got := s.Next(base); !got.Equal(tc.want) {
+			t.Fatalf("ParseCron(%q).Next = %s, want %s", tc.expr, got, tc.want)
+		}
+	}
+
+	// 按传入时间的时区计算, 夏令时切换当天不会重复或遗漏。
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("load timezone: %v", err)
+	}
+	s, _ := ParseCron("30 2 * * *")
+	got := s.Next(time.Date(2026, 3, 7, 12, 0, 0, 0, ny))
+	if want := time.Date(2026, 3, 9, 2, 30, 0, 0, ny); !got.Equal(want) {
+		t.Fatalf("expected skipped local time to move to next day, got %s want %s", got, want)
+	}
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "* * * * * * *", "60 * * * * *", "60 * * * *", "* 24 * * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Fatalf("expected ParseCron(%q) to fail", expr)
+		}
+	}
+}
@@ -44,6 +44,10 @@ func RunDevAutoMigrate(db *gorm.DB) error {
 		&model.DeploymentTargetNode{},
 		&model.DeploymentRelease{},
 		&model.DeploymentReleaseApproval{},
+		&model.DeploymentReleaseApprovalVote{},
+		&model.DeploymentFreezeWindow{},
+		&model.DeploymentTargetLock{},
+		&model.DeploymentReleaseHook{},
 		&model.DeploymentReleaseAudit{},
 		&model.ServiceGovernancePolicy{},
 		&model.AIOPSInspection{},
@@ -70,6 +74,9 @@ func RunDevAutoMigrate(db *gorm.DB) error {
 		&model.CMDBAudit{},
 		&model.CICDServiceCIConfig{},
 		&model.CICDServiceCIRun{},
+		&model.CICDServiceCIRunStep{},
+		&model.CICDWebhookDelivery{},
+		&model.CICDArtifact{},
 		&model.CICDDeploymentCDConfig{},
 		&model.CICDRelease{},
 		&model.CICDReleaseApproval{},
@@ -79,6 +86,15 @@ func RunDevAutoMigrate(db *gorm.DB) error {
 		&model.AutomationRun{},
 		&model.AutomationRunLog{},
 		&model.AutomationExecutionAudit{},
+		&model.LogChunk{},
+		&model.LogArchive{},
+		&model.Job{},
+		&model.JobExecution{},
+		&model.JobLog{},
+		&model.JobWorkflow{},
+		&model.JobWorkflowRun{},
+		&model.JobWorkflowStep{},
+		&model.LeaderLock{},
 		&model.TopologyAccessAudit{},
 		&model.AuditLog{},
 		&model.Policy{},
@@ -0,0 +1,31 @@
+-- +migrate Up
+SET @tbl_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.TABLES
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'deployment_targets'
+);
+SET @col_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'deployment_targets' AND COLUMN_NAME = 'verify_timeout_seconds'
+);
+SET @sql := IF(@tbl_exists = 1 AND @col_exists = 0,
+  'ALTER TABLE deployment_targets ADD COLUMN verify_timeout_seconds INT NOT NULL DEFAULT 300 AFTER readiness_status',
+  'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+-- +migrate Down
+SET @tbl_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.TABLES
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'deployment_targets'
+);
+SET @col_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'deployment_targets' AND COLUMN_NAME = 'verify_timeout_seconds'
+);
+SET @sql := IF(@tbl_exists = 1 AND @col_exists > 0,
+  'ALTER TABLE deployment_targets DROP COLUMN verify_timeout_seconds',
+  'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
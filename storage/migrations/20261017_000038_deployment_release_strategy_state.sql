@@ -0,0 +1,31 @@
+-- +migrate Up
+SET @tbl_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.TABLES
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'deployment_releases'
+);
+SET @col_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'deployment_releases' AND COLUMN_NAME = 'strategy_state_json'
+);
+SET @sql := IF(@tbl_exists = 1 AND @col_exists = 0,
+  'ALTER TABLE deployment_releases ADD COLUMN strategy_state_json LONGTEXT NULL AFTER verification_json',
+  'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+-- +migrate Down
+SET @tbl_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.TABLES
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'deployment_releases'
+);
+SET @col_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'deployment_releases' AND COLUMN_NAME = 'strategy_state_json'
+);
+SET @sql := IF(@tbl_exists = 1 AND @col_exists > 0,
+  'ALTER TABLE deployment_releases DROP COLUMN strategy_state_json',
+  'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
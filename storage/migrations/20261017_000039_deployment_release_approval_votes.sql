@@ -0,0 +1,54 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS deployment_release_approvals (
+  id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+  release_id BIGINT UNSIGNED NOT NULL,
+  ticket VARCHAR(96) NOT NULL,
+  decision VARCHAR(32) NOT NULL DEFAULT 'pending',
+  comment VARCHAR(1024) DEFAULT '',
+  requested_by BIGINT UNSIGNED DEFAULT 0,
+  approver_id BIGINT UNSIGNED DEFAULT 0,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  UNIQUE KEY uk_deployment_release_approvals_ticket (ticket),
+  KEY idx_deployment_release_approvals_release (release_id),
+  KEY idx_deployment_release_approvals_decision (decision),
+  KEY idx_deployment_release_approvals_created (created_at)
+);
+
+SET @col_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'deployment_release_approvals' AND COLUMN_NAME = 'required_approvals'
+);
+SET @sql := IF(@col_exists = 0,
+  'ALTER TABLE deployment_release_approvals ADD COLUMN required_approvals INT NOT NULL DEFAULT 1 AFTER approver_id, ADD COLUMN approved_count INT NOT NULL DEFAULT 0 AFTER required_approvals, ADD COLUMN policy_id BIGINT UNSIGNED DEFAULT 0 AFTER approved_count, ADD COLUMN rule_json LONGTEXT NULL AFTER policy_id, ADD KEY idx_deployment_release_approvals_policy (policy_id)',
+  'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+CREATE TABLE IF NOT EXISTS deployment_release_approval_votes (
+  id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+  approval_id BIGINT UNSIGNED NOT NULL,
+  release_id BIGINT UNSIGNED NOT NULL,
+  voter_id BIGINT UNSIGNED NOT NULL,
+  decision VARCHAR(32) NOT NULL,
+  comment VARCHAR(1024) DEFAULT '',
+  voter_roles VARCHAR(512) DEFAULT '',
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE KEY uk_release_approval_voter (approval_id, voter_id),
+  KEY idx_deployment_release_approval_votes_release (release_id)
+);
+
+-- +migrate Down
+DROP TABLE IF EXISTS deployment_release_approval_votes;
+
+SET @col_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'deployment_release_approvals' AND COLUMN_NAME = 'required_approvals'
+);
+SET @sql := IF(@col_exists > 0,
+  'ALTER TABLE deployment_release_approvals DROP KEY idx_deployment_release_approvals_policy, DROP COLUMN rule_json, DROP COLUMN policy_id, DROP COLUMN approved_count, DROP COLUMN required_approvals',
+  'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
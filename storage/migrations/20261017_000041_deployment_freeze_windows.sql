@@ -0,0 +1,39 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS deployment_freeze_windows (
+  id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+  name VARCHAR(128) NOT NULL,
+  reason VARCHAR(1024) DEFAULT '',
+  env VARCHAR(32) DEFAULT '',
+  project_id BIGINT UNSIGNED DEFAULT 0,
+  target_id BIGINT UNSIGNED DEFAULT 0,
+  window_type VARCHAR(16) NOT NULL,
+  start_at DATETIME NULL,
+  end_at DATETIME NULL,
+  cron VARCHAR(64) DEFAULT '',
+  duration_minutes INT DEFAULT 0,
+  timezone VARCHAR(64) DEFAULT '',
+  override_roles VARCHAR(512) DEFAULT '',
+  enabled TINYINT(1) NOT NULL DEFAULT 1,
+  created_by BIGINT UNSIGNED DEFAULT 0,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  KEY idx_deployment_freeze_windows_env (env),
+  KEY idx_deployment_freeze_windows_project (project_id),
+  KEY idx_deployment_freeze_windows_target (target_id)
+);
+
+INSERT INTO permissions (name, code, type, resource, action, description, status, create_time, update_time)
+SELECT '冻结窗口管理', 'deploy:freeze:write', 3, 'deploy', 'freeze:write', '管理变更冻结窗口', 1, UNIX_TIMESTAMP(), UNIX_TIMESTAMP()
+WHERE NOT EXISTS (SELECT 1 FROM permissions WHERE code = 'deploy:freeze:write');
+
+INSERT INTO permissions (name, code, type, resource, action, description, status, create_time, update_time)
+SELECT '冻结期紧急发布', 'deploy:freeze:override', 3, 'deploy', 'freeze:override', '在冻结窗口内发起紧急发布', 1, UNIX_TIMESTAMP(), UNIX_TIMESTAMP()
+WHERE NOT EXISTS (SELECT 1 FROM permissions WHERE code = 'deploy:freeze:override');
+
+-- +migrate Down
+DELETE FROM role_permissions WHERE permission_id IN (
+  SELECT id FROM permissions WHERE code IN ('deploy:freeze:write', 'deploy:freeze:override')
+);
+DELETE FROM permissions WHERE code IN ('deploy:freeze:write', 'deploy:freeze:override');
+
+DROP TABLE IF EXISTS deployment_freeze_windows;
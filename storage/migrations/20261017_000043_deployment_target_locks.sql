@@ -0,0 +1,25 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS deployment_target_locks (
+  id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+  target_id BIGINT UNSIGNED NOT NULL,
+  release_id BIGINT UNSIGNED NOT NULL,
+  owner VARCHAR(128) DEFAULT '',
+  acquired_at DATETIME NULL,
+  expires_at DATETIME NULL,
+  updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  UNIQUE KEY uk_deployment_target_locks_target (target_id),
+  KEY idx_deployment_target_locks_release (release_id),
+  KEY idx_deployment_target_locks_expires (expires_at)
+);
+
+INSERT INTO permissions (name, code, type, resource, action, description, status, create_time, update_time)
+SELECT '取消排队发布', 'deploy:release:cancel', 3, 'deploy', 'release:cancel', '取消部署目标队列中等待执行的发布', 1, UNIX_TIMESTAMP(), UNIX_TIMESTAMP()
+WHERE NOT EXISTS (SELECT 1 FROM permissions WHERE code = 'deploy:release:cancel');
+
+-- +migrate Down
+DELETE FROM role_permissions WHERE permission_id IN (
+  SELECT id FROM permissions WHERE code = 'deploy:release:cancel'
+);
+DELETE FROM permissions WHERE code = 'deploy:release:cancel';
+
+DROP TABLE IF EXISTS deployment_target_locks;
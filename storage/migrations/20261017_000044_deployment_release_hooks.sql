@@ -0,0 +1,31 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS deployment_release_hooks (
+  id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+  name VARCHAR(128) NOT NULL,
+  service_id BIGINT UNSIGNED DEFAULT 0,
+  target_id BIGINT UNSIGNED DEFAULT 0,
+  phase VARCHAR(16) NOT NULL,
+  kind VARCHAR(32) NOT NULL,
+  sort_order INT DEFAULT 0,
+  config_json LONGTEXT,
+  timeout_seconds INT DEFAULT 300,
+  on_failure VARCHAR(16) DEFAULT '',
+  enabled TINYINT(1) NOT NULL DEFAULT 1,
+  created_by BIGINT UNSIGNED DEFAULT 0,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  KEY idx_deployment_release_hooks_service (service_id),
+  KEY idx_deployment_release_hooks_target (target_id)
+);
+
+INSERT INTO permissions (name, code, type, resource, action, description, status, create_time, update_time)
+SELECT '发布钩子管理', 'deploy:hook:write', 3, 'deploy', 'hook:write', '管理发布前后钩子', 1, UNIX_TIMESTAMP(), UNIX_TIMESTAMP()
+WHERE NOT EXISTS (SELECT 1 FROM permissions WHERE code = 'deploy:hook:write');
+
+-- +migrate Down
+DELETE FROM role_permissions WHERE permission_id IN (
+  SELECT id FROM permissions WHERE code = 'deploy:hook:write'
+);
+DELETE FROM permissions WHERE code = 'deploy:hook:write';
+
+DROP TABLE IF EXISTS deployment_release_hooks;
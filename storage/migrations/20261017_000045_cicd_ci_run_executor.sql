@@ -0,0 +1,49 @@
+-- +migrate Up
+SET @tbl_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.TABLES
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'cicd_service_ci_runs'
+);
+SET @col_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'cicd_service_ci_runs' AND COLUMN_NAME = 'commit_sha'
+);
+SET @sql := IF(@tbl_exists = 1 AND @col_exists = 0,
+  'ALTER TABLE cicd_service_ci_runs ADD COLUMN branch VARCHAR(128) DEFAULT '''' AFTER triggered_at, ADD COLUMN commit_sha VARCHAR(64) DEFAULT '''' AFTER branch, ADD COLUMN artifact_ref VARCHAR(512) DEFAULT '''' AFTER commit_sha, ADD COLUMN runner VARCHAR(128) DEFAULT '''' AFTER artifact_ref, ADD COLUMN error_message TEXT NULL AFTER runner, ADD COLUMN started_at TIMESTAMP NULL AFTER error_message, ADD COLUMN finished_at TIMESTAMP NULL AFTER started_at, ADD COLUMN heartbeat_at TIMESTAMP NULL AFTER finished_at, ADD KEY idx_cicd_service_ci_runs_heartbeat_at (heartbeat_at)',
+  'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+CREATE TABLE IF NOT EXISTS cicd_service_ci_run_steps (
+  id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+  run_id BIGINT UNSIGNED NOT NULL,
+  seq INT NOT NULL DEFAULT 0,
+  name VARCHAR(128) NOT NULL,
+  command TEXT,
+  status VARCHAR(32) NOT NULL DEFAULT 'pending',
+  exit_code INT NOT NULL DEFAULT 0,
+  log LONGTEXT,
+  started_at TIMESTAMP NULL,
+  finished_at TIMESTAMP NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  KEY idx_cicd_ci_run_steps_run (run_id)
+);
+
+-- +migrate Down
+DROP TABLE IF EXISTS cicd_service_ci_run_steps;
+
+SET @tbl_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.TABLES
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'cicd_service_ci_runs'
+);
+SET @col_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'cicd_service_ci_runs' AND COLUMN_NAME = 'commit_sha'
+);
+SET @sql := IF(@tbl_exists = 1 AND @col_exists > 0,
+  'ALTER TABLE cicd_service_ci_runs DROP KEY idx_cicd_service_ci_runs_heartbeat_at, DROP COLUMN heartbeat_at, DROP COLUMN finished_at, DROP COLUMN started_at, DROP COLUMN error_message, DROP COLUMN runner, DROP COLUMN artifact_ref, DROP COLUMN commit_sha, DROP COLUMN branch',
+  'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
@@ -0,0 +1,87 @@
+-- +migrate Up
+SET @tbl_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.TABLES
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'cicd_service_ci_configs'
+);
+SET @col_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'cicd_service_ci_configs' AND COLUMN_NAME = 'webhook_secret'
+);
+SET @sql := IF(@tbl_exists = 1 AND @col_exists = 0,
+  'ALTER TABLE cicd_service_ci_configs ADD COLUMN tag_pattern VARCHAR(128) DEFAULT '''' AFTER artifact_target, ADD COLUMN webhook_secret VARCHAR(255) DEFAULT '''' AFTER tag_pattern',
+  'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @tbl_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.TABLES
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'cicd_service_ci_runs'
+);
+SET @col_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'cicd_service_ci_runs' AND COLUMN_NAME = 'webhook_delivery_id'
+);
+SET @sql := IF(@tbl_exists = 1 AND @col_exists = 0,
+  'ALTER TABLE cicd_service_ci_runs ADD COLUMN commit_author VARCHAR(128) DEFAULT '''' AFTER commit_sha, ADD COLUMN commit_message TEXT NULL AFTER commit_author, ADD COLUMN webhook_delivery_id BIGINT UNSIGNED NOT NULL DEFAULT 0 AFTER commit_message, ADD KEY idx_cicd_service_ci_runs_webhook_delivery_id (webhook_delivery_id)',
+  'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+CREATE TABLE IF NOT EXISTS cicd_webhook_deliveries (
+  id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+  provider VARCHAR(16) NOT NULL,
+  delivery_id VARCHAR(128) NOT NULL DEFAULT '',
+  event VARCHAR(64) DEFAULT '',
+  repo_url VARCHAR(512) DEFAULT '',
+  ref VARCHAR(255) DEFAULT '',
+  commit_sha VARCHAR(64) DEFAULT '',
+  author VARCHAR(128) DEFAULT '',
+  status VARCHAR(32) NOT NULL DEFAULT 'received',
+  detail VARCHAR(512) DEFAULT '',
+  headers_json LONGTEXT,
+  payload LONGTEXT,
+  verified_config_ids_json TEXT,
+  run_ids_json TEXT,
+  replay_of BIGINT UNSIGNED NOT NULL DEFAULT 0,
+  replayed_by BIGINT UNSIGNED NOT NULL DEFAULT 0,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  KEY idx_cicd_webhook_deliveries_delivery (provider, delivery_id),
+  KEY idx_cicd_webhook_deliveries_status (status),
+  KEY idx_cicd_webhook_deliveries_replay_of (replay_of)
+);
+
+-- +migrate Down
+DROP TABLE IF EXISTS cicd_webhook_deliveries;
+
+SET @tbl_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.TABLES
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'cicd_service_ci_runs'
+);
+SET @col_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'cicd_service_ci_runs' AND COLUMN_NAME = 'webhook_delivery_id'
+);
+SET @sql := IF(@tbl_exists = 1 AND @col_exists > 0,
+  'ALTER TABLE cicd_service_ci_runs DROP KEY idx_cicd_service_ci_runs_webhook_delivery_id, DROP COLUMN webhook_delivery_id, DROP COLUMN commit_message, DROP COLUMN commit_author',
+  'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @tbl_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.TABLES
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'cicd_service_ci_configs'
+);
+SET @col_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'cicd_service_ci_configs' AND COLUMN_NAME = 'webhook_secret'
+);
+SET @sql := IF(@tbl_exists = 1 AND @col_exists > 0,
+  'ALTER TABLE cicd_service_ci_configs DROP COLUMN webhook_secret, DROP COLUMN tag_pattern',
+  'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
@@ -0,0 +1,56 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS cicd_artifacts (
+  id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+  service_id BIGINT UNSIGNED NOT NULL,
+  ci_run_id BIGINT UNSIGNED NOT NULL,
+  kind VARCHAR(16) NOT NULL,
+  reference VARCHAR(512) NOT NULL,
+  digest VARCHAR(128) NOT NULL,
+  commit_sha VARCHAR(64) DEFAULT '',
+  branch VARCHAR(128) DEFAULT '',
+  author VARCHAR(128) DEFAULT '',
+  commit_message TEXT,
+  duration_ms BIGINT NOT NULL DEFAULT 0,
+  metadata_json LONGTEXT,
+  status VARCHAR(16) NOT NULL DEFAULT 'active',
+  expired_at TIMESTAMP NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  UNIQUE KEY uk_cicd_artifacts_run (ci_run_id),
+  KEY idx_cicd_artifacts_service (service_id),
+  KEY idx_cicd_artifacts_digest (digest),
+  KEY idx_cicd_artifacts_status (status)
+);
+
+SET @tbl_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.TABLES
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'deployment_releases'
+);
+SET @col_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'deployment_releases' AND COLUMN_NAME = 'artifact_id'
+);
+SET @sql := IF(@tbl_exists = 1 AND @col_exists = 0,
+  'ALTER TABLE deployment_releases ADD COLUMN artifact_id BIGINT UNSIGNED DEFAULT 0 AFTER ci_run_id, ADD COLUMN artifact_digest VARCHAR(128) DEFAULT '''' AFTER artifact_id, ADD COLUMN commit_sha VARCHAR(64) DEFAULT '''' AFTER artifact_digest, ADD KEY idx_deployment_releases_artifact_id (artifact_id)',
+  'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+-- +migrate Down
+SET @tbl_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.TABLES
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'deployment_releases'
+);
+SET @col_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'deployment_releases' AND COLUMN_NAME = 'artifact_id'
+);
+SET @sql := IF(@tbl_exists = 1 AND @col_exists > 0,
+  'ALTER TABLE deployment_releases DROP KEY idx_deployment_releases_artifact_id, DROP COLUMN commit_sha, DROP COLUMN artifact_digest, DROP COLUMN artifact_id',
+  'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+DROP TABLE IF EXISTS cicd_artifacts;
@@ -0,0 +1,61 @@
+-- +migrate Up
+SET @tbl_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.TABLES
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'cicd_service_ci_runs'
+);
+SET @col_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'cicd_service_ci_runs' AND COLUMN_NAME = 'pipeline_source'
+);
+SET @sql := IF(@tbl_exists = 1 AND @col_exists = 0,
+  'ALTER TABLE cicd_service_ci_runs ADD COLUMN ref_type VARCHAR(16) DEFAULT ''branch'' AFTER branch, ADD COLUMN pipeline_source VARCHAR(16) DEFAULT '''' AFTER error_message, ADD COLUMN pipeline_yaml MEDIUMTEXT NULL AFTER pipeline_source, ADD COLUMN pipeline_json MEDIUMTEXT NULL AFTER pipeline_yaml',
+  'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @tbl_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.TABLES
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'cicd_service_ci_run_steps'
+);
+SET @col_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'cicd_service_ci_run_steps' AND COLUMN_NAME = 'stage'
+);
+SET @sql := IF(@tbl_exists = 1 AND @col_exists = 0,
+  'ALTER TABLE cicd_service_ci_run_steps ADD COLUMN stage VARCHAR(64) DEFAULT '''' AFTER seq, ADD COLUMN kind VARCHAR(16) DEFAULT ''command'' AFTER stage, ADD COLUMN image VARCHAR(255) DEFAULT '''' AFTER name, ADD COLUMN approved_by BIGINT UNSIGNED NOT NULL DEFAULT 0 AFTER command',
+  'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+-- +migrate Down
+SET @tbl_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.TABLES
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'cicd_service_ci_run_steps'
+);
+SET @col_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'cicd_service_ci_run_steps' AND COLUMN_NAME = 'stage'
+);
+SET @sql := IF(@tbl_exists = 1 AND @col_exists > 0,
+  'ALTER TABLE cicd_service_ci_run_steps DROP COLUMN approved_by, DROP COLUMN image, DROP COLUMN kind, DROP COLUMN stage',
+  'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @tbl_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.TABLES
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'cicd_service_ci_runs'
+);
+SET @col_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'cicd_service_ci_runs' AND COLUMN_NAME = 'pipeline_source'
+);
+SET @sql := IF(@tbl_exists = 1 AND @col_exists > 0,
+  'ALTER TABLE cicd_service_ci_runs DROP COLUMN pipeline_json, DROP COLUMN pipeline_yaml, DROP COLUMN pipeline_source, DROP COLUMN ref_type',
+  'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
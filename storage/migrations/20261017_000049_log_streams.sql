@@ -0,0 +1,25 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS log_chunks (
+  id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+  stream VARCHAR(128) NOT NULL,
+  seq BIGINT NOT NULL,
+  last_seq BIGINT NOT NULL,
+  data MEDIUMTEXT,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE KEY uk_log_chunks_stream_seq (stream, seq),
+  KEY idx_log_chunks_stream_last (stream, last_seq)
+);
+
+CREATE TABLE IF NOT EXISTS log_archives (
+  id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+  stream VARCHAR(128) NOT NULL,
+  `lines` BIGINT NOT NULL DEFAULT 0,
+  size BIGINT NOT NULL DEFAULT 0,
+  content LONGTEXT,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE KEY uk_log_archives_stream (stream)
+);
+
+-- +migrate Down
+DROP TABLE IF EXISTS log_archives;
+DROP TABLE IF EXISTS log_chunks;
@@ -0,0 +1,61 @@
+-- +migrate Up
+SET @tbl_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.TABLES
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'cicd_deployment_cd_configs'
+);
+SET @col_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'cicd_deployment_cd_configs' AND COLUMN_NAME = 'auto_deploy'
+);
+SET @sql := IF(@tbl_exists = 1 AND @col_exists = 0,
+  'ALTER TABLE cicd_deployment_cd_configs ADD COLUMN service_id BIGINT UNSIGNED NOT NULL DEFAULT 0 AFTER approval_required, ADD COLUMN auto_deploy TINYINT(1) NOT NULL DEFAULT 0 AFTER service_id, ADD COLUMN auto_deploy_branches_json TEXT NULL AFTER auto_deploy, ADD COLUMN auto_deploy_tags_json TEXT NULL AFTER auto_deploy_branches_json, ADD INDEX idx_cicd_deployment_cd_configs_service_id (service_id)',
+  'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @tbl_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.TABLES
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'cicd_service_ci_runs'
+);
+SET @col_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'cicd_service_ci_runs' AND COLUMN_NAME = 'auto_deploy_json'
+);
+SET @sql := IF(@tbl_exists = 1 AND @col_exists = 0,
+  'ALTER TABLE cicd_service_ci_runs ADD COLUMN auto_deploy_json TEXT NULL AFTER pipeline_json',
+  'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+-- +migrate Down
+SET @tbl_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.TABLES
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'cicd_service_ci_runs'
+);
+SET @col_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'cicd_service_ci_runs' AND COLUMN_NAME = 'auto_deploy_json'
+);
+SET @sql := IF(@tbl_exists = 1 AND @col_exists > 0,
+  'ALTER TABLE cicd_service_ci_runs DROP COLUMN auto_deploy_json',
+  'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @tbl_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.TABLES
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'cicd_deployment_cd_configs'
+);
+SET @col_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'cicd_deployment_cd_configs' AND COLUMN_NAME = 'auto_deploy'
+);
+SET @sql := IF(@tbl_exists = 1 AND @col_exists > 0,
+  'ALTER TABLE cicd_deployment_cd_configs DROP INDEX idx_cicd_deployment_cd_configs_service_id, DROP COLUMN auto_deploy_tags_json, DROP COLUMN auto_deploy_branches_json, DROP COLUMN auto_deploy, DROP COLUMN service_id',
+  'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
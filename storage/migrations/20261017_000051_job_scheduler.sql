@@ -0,0 +1,108 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS jobs (
+  id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+  name VARCHAR(255) NOT NULL,
+  type VARCHAR(32) NOT NULL DEFAULT 'shell',
+  command TEXT NULL,
+  host_ids TEXT NULL,
+  cron VARCHAR(64) NULL,
+  timezone VARCHAR(64) DEFAULT '',
+  catch_up VARCHAR(16) NOT NULL DEFAULT 'skip',
+  paused TINYINT(1) NOT NULL DEFAULT 0,
+  status VARCHAR(32) NOT NULL DEFAULT 'pending',
+  timeout INT DEFAULT 300,
+  priority INT DEFAULT 0,
+  description TEXT NULL,
+  last_run DATETIME NULL,
+  next_run DATETIME NULL,
+  created_by BIGINT UNSIGNED NULL,
+  created_at DATETIME NULL,
+  updated_at DATETIME NULL,
+  KEY idx_jobs_next_run (next_run)
+);
+
+CREATE TABLE IF NOT EXISTS job_executions (
+  id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+  job_id BIGINT UNSIGNED NOT NULL,
+  host_id BIGINT UNSIGNED NULL,
+  host_ip VARCHAR(64) NULL,
+  status VARCHAR(32) NOT NULL DEFAULT 'pending',
+  trigger_type VARCHAR(16) NOT NULL DEFAULT 'manual',
+  scheduled_at DATETIME NULL,
+  exit_code INT NULL,
+  output TEXT NULL,
+  start_time DATETIME NULL,
+  end_time DATETIME NULL,
+  created_at DATETIME NULL,
+  KEY idx_job_executions_job_id (job_id)
+);
+
+CREATE TABLE IF NOT EXISTS job_logs (
+  id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+  job_id BIGINT UNSIGNED NOT NULL,
+  execution_id BIGINT UNSIGNED NULL,
+  level VARCHAR(16) DEFAULT 'info',
+  message TEXT NULL,
+  created_at DATETIME NULL,
+  KEY idx_job_logs_job_id (job_id),
+  KEY idx_job_logs_execution_id (execution_id)
+);
+
+-- 已由自动迁移创建的任务表补齐调度字段。
+SET @col_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'jobs' AND COLUMN_NAME = 'catch_up'
+);
+SET @sql := IF(@col_exists = 0,
+  'ALTER TABLE jobs ADD COLUMN timezone VARCHAR(64) DEFAULT '''' AFTER cron, ADD COLUMN catch_up VARCHAR(16) NOT NULL DEFAULT ''skip'' AFTER timezone, ADD COLUMN paused TINYINT(1) NOT NULL DEFAULT 0 AFTER catch_up, ADD INDEX idx_jobs_next_run (next_run)',
+  'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @col_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'job_executions' AND COLUMN_NAME = 'trigger_type'
+);
+SET @sql := IF(@col_exists = 0,
+  'ALTER TABLE job_executions ADD COLUMN trigger_type VARCHAR(16) NOT NULL DEFAULT ''manual'' AFTER status, ADD COLUMN scheduled_at DATETIME NULL AFTER trigger_type',
+  'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+CREATE TABLE IF NOT EXISTS leader_locks (
+  id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+  name VARCHAR(128) NOT NULL,
+  owner VARCHAR(128) DEFAULT '',
+  acquired_at DATETIME NULL,
+  expires_at DATETIME NULL,
+  updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  UNIQUE KEY uk_leader_locks_name (name),
+  KEY idx_leader_locks_expires (expires_at)
+);
+
+-- +migrate Down
+DROP TABLE IF EXISTS leader_locks;
+
+SET @col_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'job_executions' AND COLUMN_NAME = 'trigger_type'
+);
+SET @sql := IF(@col_exists > 0,
+  'ALTER TABLE job_executions DROP COLUMN scheduled_at, DROP COLUMN trigger_type',
+  'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @col_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'jobs' AND COLUMN_NAME = 'catch_up'
+);
+SET @sql := IF(@col_exists > 0,
+  'ALTER TABLE jobs DROP INDEX idx_jobs_next_run, DROP COLUMN paused, DROP COLUMN catch_up, DROP COLUMN timezone',
+  'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
@@ -0,0 +1,45 @@
+-- +migrate Up
+SET @col_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'jobs' AND COLUMN_NAME = 'parallelism'
+);
+SET @sql := IF(@col_exists = 0,
+  'ALTER TABLE jobs ADD COLUMN parallelism INT DEFAULT 0 AFTER timeout',
+  'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @col_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'job_executions' AND COLUMN_NAME = 'run_id'
+);
+SET @sql := IF(@col_exists = 0,
+  'ALTER TABLE job_executions ADD COLUMN run_id VARCHAR(64) NULL AFTER host_ip, ADD COLUMN stderr TEXT NULL AFTER output, ADD COLUMN error_message TEXT NULL AFTER stderr, ADD INDEX idx_job_executions_run_id (run_id)',
+  'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+-- +migrate Down
+SET @col_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'job_executions' AND COLUMN_NAME = 'run_id'
+);
+SET @sql := IF(@col_exists > 0,
+  'ALTER TABLE job_executions DROP INDEX idx_job_executions_run_id, DROP COLUMN error_message, DROP COLUMN stderr, DROP COLUMN run_id',
+  'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @col_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'jobs' AND COLUMN_NAME = 'parallelism'
+);
+SET @sql := IF(@col_exists > 0,
+  'ALTER TABLE jobs DROP COLUMN parallelism',
+  'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
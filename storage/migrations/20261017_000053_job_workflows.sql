@@ -0,0 +1,46 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS job_workflows (
+  id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+  name VARCHAR(255) NOT NULL,
+  description TEXT NULL,
+  steps_json LONGTEXT NULL,
+  created_by BIGINT UNSIGNED NULL,
+  created_at DATETIME NULL,
+  updated_at DATETIME NULL
+);
+
+CREATE TABLE IF NOT EXISTS job_workflow_runs (
+  id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+  workflow_id BIGINT UNSIGNED NOT NULL,
+  status VARCHAR(32) NOT NULL DEFAULT 'running',
+  steps_json LONGTEXT NULL,
+  variables_json TEXT NULL,
+  start_time DATETIME NULL,
+  end_time DATETIME NULL,
+  created_by BIGINT UNSIGNED NULL,
+  created_at DATETIME NULL,
+  updated_at DATETIME NULL,
+  KEY idx_job_workflow_runs_workflow_id (workflow_id)
+);
+
+CREATE TABLE IF NOT EXISTS job_workflow_steps (
+  id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+  workflow_run_id BIGINT UNSIGNED NOT NULL,
+  name VARCHAR(64) NOT NULL,
+  job_id BIGINT UNSIGNED NOT NULL,
+  status VARCHAR(32) NOT NULL DEFAULT 'pending',
+  attempts INT NOT NULL DEFAULT 0,
+  job_run_id VARCHAR(64) NULL,
+  outputs_json TEXT NULL,
+  error_message TEXT NULL,
+  start_time DATETIME NULL,
+  end_time DATETIME NULL,
+  created_at DATETIME NULL,
+  updated_at DATETIME NULL,
+  KEY idx_job_workflow_steps_workflow_run_id (workflow_run_id)
+);
+
+-- +migrate Down
+DROP TABLE IF EXISTS job_workflow_steps;
+DROP TABLE IF EXISTS job_workflow_runs;
+DROP TABLE IF EXISTS job_workflows;
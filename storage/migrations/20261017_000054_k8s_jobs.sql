@@ -0,0 +1,45 @@
+-- +migrate Up
+SET @col_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'jobs' AND COLUMN_NAME = 'cluster_id'
+);
+SET @sql := IF(@col_exists = 0,
+  'ALTER TABLE jobs ADD COLUMN cluster_id BIGINT UNSIGNED DEFAULT 0 AFTER host_ids, ADD COLUMN namespace VARCHAR(128) DEFAULT '''' AFTER cluster_id, ADD COLUMN image VARCHAR(512) DEFAULT '''' AFTER namespace, ADD COLUMN args_json TEXT NULL AFTER image',
+  'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @col_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'job_executions' AND COLUMN_NAME = 'k8s_job'
+);
+SET @sql := IF(@col_exists = 0,
+  'ALTER TABLE job_executions ADD COLUMN k8s_job VARCHAR(253) NULL AFTER host_ip',
+  'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+-- +migrate Down
+SET @col_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'job_executions' AND COLUMN_NAME = 'k8s_job'
+);
+SET @sql := IF(@col_exists > 0,
+  'ALTER TABLE job_executions DROP COLUMN k8s_job',
+  'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @col_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'jobs' AND COLUMN_NAME = 'cluster_id'
+);
+SET @sql := IF(@col_exists > 0,
+  'ALTER TABLE jobs DROP COLUMN args_json, DROP COLUMN image, DROP COLUMN namespace, DROP COLUMN cluster_id',
+  'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
@@ -0,0 +1,27 @@
+-- +migrate Up
+SET @col_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'deployment_releases' AND COLUMN_NAME = 'finished_at'
+);
+SET @sql := IF(@col_exists = 0,
+  'ALTER TABLE deployment_releases ADD COLUMN finished_at DATETIME(3) NULL AFTER commit_sha, ADD INDEX idx_deployment_releases_finished_at (finished_at)',
+  'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+-- 历史发布没有完成时间, 以最后更新时间近似。
+UPDATE deployment_releases SET finished_at = updated_at
+WHERE finished_at IS NULL AND status IN ('applied', 'failed', 'rejected', 'aborted', 'cancelled', 'rollback', 'rolled_back');
+
+-- +migrate Down
+SET @col_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'deployment_releases' AND COLUMN_NAME = 'finished_at'
+);
+SET @sql := IF(@col_exists > 0,
+  'ALTER TABLE deployment_releases DROP INDEX idx_deployment_releases_finished_at, DROP COLUMN finished_at',
+  'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
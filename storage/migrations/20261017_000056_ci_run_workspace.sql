@@ -0,0 +1,23 @@
+-- +migrate Up
+SET @col_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'cicd_service_ci_runs' AND COLUMN_NAME = 'workspace'
+);
+SET @sql := IF(@col_exists = 0,
+  'ALTER TABLE cicd_service_ci_runs ADD COLUMN workspace VARCHAR(512) NOT NULL DEFAULT '''' AFTER runner',
+  'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+-- +migrate Down
+SET @col_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'cicd_service_ci_runs' AND COLUMN_NAME = 'workspace'
+);
+SET @sql := IF(@col_exists > 0,
+  'ALTER TABLE cicd_service_ci_runs DROP COLUMN workspace',
+  'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
@@ -0,0 +1,23 @@
+-- +migrate Up
+SET @col_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'job_workflow_runs' AND COLUMN_NAME = 'heartbeat_at'
+);
+SET @sql := IF(@col_exists = 0,
+  'ALTER TABLE job_workflow_runs ADD COLUMN heartbeat_at DATETIME NULL AFTER end_time, ADD KEY idx_job_workflow_runs_heartbeat_at (heartbeat_at)',
+  'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+-- +migrate Down
+SET @col_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'job_workflow_runs' AND COLUMN_NAME = 'heartbeat_at'
+);
+SET @sql := IF(@col_exists > 0,
+  'ALTER TABLE job_workflow_runs DROP KEY idx_job_workflow_runs_heartbeat_at, DROP COLUMN heartbeat_at',
+  'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
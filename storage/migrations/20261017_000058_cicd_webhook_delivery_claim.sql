@@ -0,0 +1,23 @@
+-- +migrate Up
+SET @col_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'cicd_webhook_deliveries' AND COLUMN_NAME = 'claim_key'
+);
+SET @sql := IF(@col_exists = 0,
+  'ALTER TABLE cicd_webhook_deliveries ADD COLUMN claim_key VARCHAR(160) NULL AFTER run_ids_json, ADD UNIQUE KEY uk_cicd_webhook_deliveries_claim (claim_key)',
+  'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+-- +migrate Down
+SET @col_exists := (
+  SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'cicd_webhook_deliveries' AND COLUMN_NAME = 'claim_key'
+);
+SET @sql := IF(@col_exists > 0,
+  'ALTER TABLE cicd_webhook_deliveries DROP KEY uk_cicd_webhook_deliveries_claim, DROP COLUMN claim_key',
+  'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
@@ -1,5 +1,7 @@
 import apiService from '../api';
 import type { ApiResponse } from '../api';
+import { followLogStream } from './logStream';
+import type { LogStreamHandlers } from './logStream';
 
 export interface AutomationInventory {
   id: string;
@@ -53,4 +55,7 @@ export const automationApi = {
   async getRunLogs(id: string): Promise<ApiResponse<any[]>> {
     return apiService.get(`/automation/runs/${id}/logs`);
   },
+  followRunLogs(id: string, handlers: LogStreamHandlers, after = 0): () => void {
+    return followLogStream(`/automation/runs/${encodeURIComponent(id)}/logs/stream`, handlers, after);
+  },
 };
@@ -1,9 +1,11 @@
 import apiService from '../api';
 import type { ApiResponse, PaginatedResponse } from '../api';
+import { followLogStream } from './logStream';
+import type { LogStreamHandlers } from './logStream';
 
 export type TriggerMode = 'manual' | 'source-event' | 'both';
 export type TriggerType = 'manual' | 'source-event';
-export type ReleaseStatus = 'previewed' | 'pending_approval' | 'approved' | 'applying' | 'applied' | 'failed' | 'rejected' | 'rollback' | 'rolled_back' | 'executing' | 'succeeded';
+export type ReleaseStatus = 'previewed' | 'pending_approval' | 'approved' | 'applying' | 'verifying' | 'paused' | 'aborted' | 'applied' | 'failed' | 'rejected' | 'rollback' | 'rolled_back' | 'executing' | 'succeeded';
 
 export interface ServiceCIConfig {
   id: number;
@@ -12,6 +14,8 @@ export interface ServiceCIConfig {
   branch: string;
   build_steps: string[];
   artifact_target: string;
+  tag_pattern: string;
+  webhook_secret_set: boolean;
   trigger_mode: TriggerMode;
   status: string;
   updated_by: number;
@@ -24,13 +28,54 @@ export interface CIRunRecord {
   service_id: number;
   ci_config_id: number;
   trigger_type: TriggerType;
-  status: string;
+  status: 'queued' | 'running' | 'waiting' | 'succeeded' | 'failed' | string;
   reason: string;
   triggered_by: number;
   triggered_at: string;
+  branch: string;
+  ref_type: 'branch' | 'tag' | string;
+  commit_sha: string;
+  commit_author: string;
+  commit_message: string;
+  webhook_delivery_id: number;
+  artifact_ref: string;
+  runner: string;
+  error_message: string;
+  pipeline_source: 'file' | 'config' | '';
+  auto_deploys?: CIRunAutoDeploy[];
+  started_at?: string;
+  finished_at?: string;
   created_at: string;
 }
 
+export interface CIRunAutoDeploy {
+  cd_config_id: number;
+  deployment_id: number;
+  env: string;
+  runtime_type: string;
+  status: 'triggered' | 'skipped' | 'failed';
+  release_id?: number;
+  release_status?: string;
+  detail?: string;
+}
+
+export interface CIRunStep {
+  id: number;
+  run_id: number;
+  seq: number;
+  stage: string;
+  kind: 'clone' | 'command' | 'manual' | 'publish' | 'deploy';
+  name: string;
+  image?: string;
+  command: string;
+  status: 'pending' | 'running' | 'waiting' | 'succeeded' | 'failed' | 'skipped';
+  approved_by?: number;
+  exit_code: number;
+  log: string;
+  started_at?: string;
+  finished_at?: string;
+}
+
 export interface DeploymentCDConfig {
   id: number;
   deployment_id: number;
@@ -39,6 +84,10 @@ export interface DeploymentCDConfig {
   strategy: 'rolling' | 'blue-green' | 'canary';
   strategy_config: Record<string, any>;
   approval_required: boolean;
+  service_id: number;
+  auto_deploy: boolean;
+  auto_deploy_branches: string[];
+  auto_deploy_tags: string[];
   updated_by: number;
   created_at: string;
   updated_at: string;
@@ -62,6 +111,9 @@ export interface ReleaseRecord {
   trigger_source?: 'manual' | 'ci' | string;
   trigger_context?: any;
   ci_run_id?: number;
+  artifact_id?: number;
+  artifact_digest?: string;
+  commit_sha?: string;
   started_at?: string;
   finished_at?: string;
   created_at: string;
@@ -77,6 +129,72 @@ export interface ReleaseApproval {
   created_at: string;
 }
 
+export interface Artifact {
+  id: number;
+  service_id: number;
+  ci_run_id: number;
+  kind: 'image' | 'file';
+  reference: string;
+  digest: string;
+  pinned_ref: string;
+  commit_sha: string;
+  branch: string;
+  author: string;
+  commit_message: string;
+  duration_ms: number;
+  metadata?: any;
+  status: 'active' | 'expired';
+  expired_at?: string;
+  created_at: string;
+}
+
+export interface ReleaseChanges {
+  release_id: number;
+  previous_release_id: number;
+  from_commit: string;
+  to_commit: string;
+  range: string;
+  compare_url?: string;
+  artifacts: Artifact[];
+}
+
+export interface CIRunPipeline {
+  run_id: number;
+  source: 'file' | 'config' | '';
+  path?: string;
+  yaml?: string;
+  pipeline?: any;
+  error?: string;
+}
+
+export interface PipelineValidation {
+  valid: boolean;
+  pipeline?: any;
+  problems?: string[];
+}
+
+export type WebhookProvider = 'github' | 'gitlab' | 'gitea';
+
+export interface WebhookDelivery {
+  id: number;
+  provider: WebhookProvider;
+  delivery_id: string;
+  event: string;
+  repo_url: string;
+  ref: string;
+  commit_sha: string;
+  author: string;
+  status: 'received' | 'triggered' | 'ignored' | 'duplicate' | 'rejected' | 'invalid';
+  detail: string;
+  run_ids: number[];
+  verified_config_ids: number[];
+  replay_of: number;
+  replayed_by: number;
+  headers?: Record<string, string>;
+  payload?: string;
+  created_at: string;
+}
+
 export interface TimelineEvent {
   id: number;
   service_id: number;
@@ -99,6 +217,8 @@ export const cicdApi = {
     build_steps?: string[];
     artifact_target: string;
     trigger_mode: TriggerMode;
+    tag_pattern?: string;
+    webhook_secret?: string;
   }): Promise<ApiResponse<ServiceCIConfig>> {
     return apiService.put(`/cicd/services/${serviceId}/ci-config`, payload);
   },
@@ -115,6 +235,46 @@ export const cicdApi = {
     return apiService.get(`/cicd/services/${serviceId}/ci-runs`);
   },
 
+  listCIRunSteps(runId: number): Promise<ApiResponse<PaginatedResponse<CIRunStep>>> {
+    return apiService.get(`/cicd/ci-runs/${runId}/steps`);
+  },
+
+  getCIRunPipeline(runId: number): Promise<ApiResponse<CIRunPipeline>> {
+    return apiService.get(`/cicd/ci-runs/${runId}/pipeline`);
+  },
+
+  approveCIGate(runId: number, stepId: number, payload?: { comment?: string }): Promise<ApiResponse<CIRunStep>> {
+    return apiService.post(`/cicd/ci-runs/${runId}/steps/${stepId}/approve`, payload || {});
+  },
+
+  rejectCIGate(runId: number, stepId: number, payload?: { comment?: string }): Promise<ApiResponse<CIRunStep>> {
+    return apiService.post(`/cicd/ci-runs/${runId}/steps/${stepId}/reject`, payload || {});
+  },
+
+  validatePipeline(content: string): Promise<ApiResponse<PipelineValidation>> {
+    return apiService.post('/cicd/pipelines/validate', { content });
+  },
+
+  listWebhookDeliveries(params?: { provider?: WebhookProvider; status?: string; limit?: number }): Promise<ApiResponse<PaginatedResponse<WebhookDelivery>>> {
+    return apiService.get('/cicd/webhook-deliveries', { params });
+  },
+
+  getWebhookDelivery(id: number): Promise<ApiResponse<WebhookDelivery>> {
+    return apiService.get(`/cicd/webhook-deliveries/${id}`);
+  },
+
+  replayWebhookDelivery(id: number): Promise<ApiResponse<WebhookDelivery>> {
+    return apiService.post(`/cicd/webhook-deliveries/${id}/replay`);
+  },
+
+  listArtifacts(serviceId: number, params?: { status?: 'active' | 'expired'; limit?: number }): Promise<ApiResponse<PaginatedResponse<Artifact>>> {
+    return apiService.get(`/cicd/services/${serviceId}/artifacts`, { params });
+  },
+
+  getArtifact(id: number): Promise<ApiResponse<Artifact>> {
+    return apiService.get(`/cicd/artifacts/${id}`);
+  },
+
   getDeploymentCDConfig(deploymentId: number, env?: string, runtimeType?: 'k8s' | 'compose'): Promise<ApiResponse<DeploymentCDConfig>> {
     return apiService.get(`/cicd/deployments/${deploymentId}/cd-config`, { params: { env, runtime_type: runtimeType } });
   },
@@ -125,6 +285,10 @@ export const cicdApi = {
     strategy: 'rolling' | 'blue-green' | 'canary';
     strategy_config?: Record<string, any>;
     approval_required?: boolean;
+    service_id?: number;
+    auto_deploy?: boolean;
+    auto_deploy_branches?: string[];
+    auto_deploy_tags?: string[];
   }): Promise<ApiResponse<DeploymentCDConfig>> {
     return apiService.put(`/cicd/deployments/${deploymentId}/cd-config`, payload);
   },
@@ -135,6 +299,8 @@ export const cicdApi = {
     env: string;
     runtime_type?: 'k8s' | 'compose';
     version: string;
+    ci_run_id?: number;
+    artifact_id?: number;
   }): Promise<ApiResponse<ReleaseRecord>> {
     return apiService.post('/cicd/releases', payload);
   },
@@ -159,7 +325,15 @@ export const cicdApi = {
     return apiService.get(`/cicd/releases/${releaseId}/approvals`);
   },
 
+  getReleaseChanges(releaseId: number): Promise<ApiResponse<ReleaseChanges>> {
+    return apiService.get(`/cicd/releases/${releaseId}/changes`);
+  },
+
   getServiceTimeline(serviceId: number): Promise<ApiResponse<PaginatedResponse<TimelineEvent>>> {
     return apiService.get(`/cicd/services/${serviceId}/timeline`);
   },
+
+  followCIRunLogs(runId: number, handlers: LogStreamHandlers, after = 0): () => void {
+    return followLogStream(`/cicd/ci-runs/${runId}/logs/stream`, handlers, after);
+  },
 };
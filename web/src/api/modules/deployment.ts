@@ -36,6 +36,22 @@ export interface DeployTarget {
   updated_at: string;
 }
 
+export interface ReleaseInventoryItem {
+  group?: string;
+  version: string;
+  kind: string;
+  namespace?: string;
+  name: string;
+}
+
+export interface ReleaseObjectDiff {
+  object: ReleaseInventoryItem;
+  action: 'create' | 'change' | 'unchanged' | 'prune' | 'error' | 'missing';
+  changes?: Array<{ path: string; before?: unknown; after?: unknown }>;
+  truncated?: boolean;
+  error?: string;
+}
+
 export interface DeployRelease {
   id: number;
   unified_release_id?: number;
@@ -53,6 +69,11 @@ export interface DeployRelease {
   lifecycle_state?: string;
   diagnostics_json?: string;
   verification_json?: string;
+  strategy_state_json?: string;
+  inventory_json?: string;
+  pruned_json?: string;
+  template_snapshot?: string;
+  variables_json?: string;
   source_release_id?: number;
   target_revision?: string;
   service_name?: string;
@@ -177,6 +198,30 @@ export interface MetricsTrend {
   success_rate: number;
 }
 
+export interface DORAMetricsItem {
+  key: string;
+  name: string;
+  deployments: number;
+  deployment_frequency_per_day: number;
+  lead_time_seconds: number;
+  lead_time_samples: number;
+  change_attempts: number;
+  change_failures: number;
+  change_failure_rate: number;
+  time_to_restore_seconds: number;
+  restores: number;
+  unrestored: number;
+}
+
+export interface DORAMetrics {
+  group_by: 'service' | 'team' | 'env' | 'all';
+  window_days: number;
+  from: string;
+  to: string;
+  overall: DORAMetricsItem;
+  items: DORAMetricsItem[];
+}
+
 export interface TopologyService {
   id: number;
   name: string;
@@ -202,7 +247,7 @@ export interface DeploymentTopology {
 export interface Policy {
   id: number;
   name: string;
-  type: 'traffic' | 'resilience' | 'access' | 'slo';
+  type: 'traffic' | 'resilience' | 'access' | 'slo' | 'approval' | 'promotion' | 'admission';
   target_id: number;
   config: Record<string, any>;
   enabled: boolean;
@@ -210,6 +255,172 @@ export interface Policy {
   updated_at: string;
 }
 
+export interface AdmissionRule {
+  type: 'no_privileged' | 'require_resource_limits' | 'disallow_latest_tag' | 'allowed_registries' | 'required_labels';
+  mode?: 'warn' | 'enforce';
+  registries?: string[];
+  labels?: string[];
+}
+
+export interface AdmissionPolicyConfig {
+  mode: 'warn' | 'enforce';
+  project_id?: number;
+  env?: string;
+  rules: AdmissionRule[];
+}
+
+export interface ReleasePromotionReq {
+  target_id: number;
+  strategy?: string;
+  strategy_config?: Record<string, any>;
+  preview_token?: string;
+  emergency_override?: boolean;
+  override_reason?: string;
+}
+
+export interface ReleasePromotion {
+  source_release_id: number;
+  source_target_id: number;
+  revision_id: number;
+  from_env: string;
+  to_env: string;
+  path: string[];
+  policy_id?: number;
+  images: string[];
+  reapplied_variables: string[];
+}
+
+export interface TargetLockLease {
+  target_id: number;
+  release_id: number;
+  owner: string;
+  acquired_at: string;
+  expires_at: string;
+  backend: 'redis' | 'db';
+}
+
+export interface ReleaseQueueItem {
+  position: number;
+  release_id: number;
+  service_id: number;
+  status: string;
+  strategy: string;
+  trigger_source?: string;
+  operator: number;
+  created_at: string;
+  updated_at: string;
+}
+
+export interface TargetReleaseQueue {
+  target_id: number;
+  lock?: TargetLockLease;
+  running?: ReleaseQueueItem;
+  queued: ReleaseQueueItem[];
+}
+
+export interface FreezeWindow {
+  id: number;
+  name: string;
+  reason: string;
+  env: string;
+  project_id: number;
+  target_id: number;
+  window_type: 'one_off' | 'recurring';
+  start_at?: string;
+  end_at?: string;
+  cron: string;
+  duration_minutes: number;
+  timezone: string;
+  override_roles: string;
+  enabled: boolean;
+  created_by: number;
+  created_at: string;
+  updated_at: string;
+  active: boolean;
+  active_until?: string;
+}
+
+export interface FreezeWindowUpsertReq {
+  name: string;
+  reason?: string;
+  env?: string;
+  project_id?: number;
+  target_id?: number;
+  window_type: 'one_off' | 'recurring';
+  start_at?: string;
+  end_at?: string;
+  cron?: string;
+  duration_minutes?: number;
+  timezone?: string;
+  override_roles?: string[];
+  enabled?: boolean;
+}
+
+export interface ServiceDrift {
+  service_id: number;
+  service_name: string;
+  release_id: number;
+  drifted: boolean;
+  objects: ReleaseObjectDiff[];
+  finding_id?: number;
+}
+
+export interface TargetDrift {
+  target_id: number;
+  checked_at: string;
+  drifted: boolean;
+  services: ServiceDrift[];
+}
+
+export type ReleaseHookPhase = 'pre' | 'post';
+export type ReleaseHookKind = 'k8s_job' | 'ssh' | 'http' | 'wait';
+
+export interface ReleaseHookConfig {
+  template?: string;
+  namespace?: string;
+  command?: string;
+  node_ids?: number[];
+  url?: string;
+  method?: string;
+  headers?: Record<string, string>;
+  body?: string;
+  expect_status?: number[];
+  body_contains?: string;
+  resource?: string;
+  condition?: string;
+  interval_seconds?: number;
+}
+
+export interface ReleaseHook {
+  id: number;
+  name: string;
+  service_id: number;
+  target_id: number;
+  phase: ReleaseHookPhase;
+  kind: ReleaseHookKind;
+  sort_order: number;
+  config_json: string;
+  timeout_seconds: number;
+  on_failure: 'abort' | 'fail' | 'rollback' | 'ignore';
+  enabled: boolean;
+  created_by: number;
+  created_at: string;
+  updated_at: string;
+}
+
+export interface ReleaseHookUpsertReq {
+  name: string;
+  service_id?: number;
+  target_id?: number;
+  phase: ReleaseHookPhase;
+  kind: ReleaseHookKind;
+  sort_order?: number;
+  config: ReleaseHookConfig;
+  timeout_seconds?: number;
+  on_failure?: 'abort' | 'fail' | 'rollback' | 'ignore';
+  enabled?: boolean;
+}
+
 export const deploymentApi = {
   getTargets(): Promise<ApiResponse<PaginatedResponse<DeployTarget>>> {
     return apiService.get('/deploy/targets');
@@ -261,8 +472,9 @@ export const deploymentApi = {
     target_id: number;
     env?: string;
     strategy?: string;
+    strategy_config?: Record<string, any>;
     variables?: Record<string, string>;
-  }): Promise<ApiResponse<{ resolved_manifest: string; checks: Array<{ code: string; message: string; level: string }>; warnings: Array<{ code: string; message: string; level: string }>; runtime: string; preview_token?: string; preview_expires_at?: string }>> {
+  }): Promise<ApiResponse<{ resolved_manifest: string; checks: Array<{ code: string; message: string; level: string }>; warnings: Array<{ code: string; message: string; level: string }>; runtime: string; preview_token?: string; preview_expires_at?: string; prune_objects?: ReleaseInventoryItem[]; diff?: ReleaseObjectDiff[] }>> {
     return apiService.post('/deploy/releases/preview', payload);
   },
   applyRelease(payload: {
@@ -270,20 +482,80 @@ export const deploymentApi = {
     target_id: number;
     env?: string;
     strategy?: string;
+    strategy_config?: Record<string, any>;
     variables?: Record<string, string>;
     preview_token?: string;
-  }): Promise<ApiResponse<{ release_id: number; unified_release_id?: number; status: string; runtime_type: string; trigger_source?: string; trigger_context?: Record<string, any>; ci_run_id?: number; approval_required?: boolean; approval_ticket?: string; lifecycle_state?: string; reason_code?: string }>> {
+    emergency_override?: boolean;
+    override_reason?: string;
+  }): Promise<ApiResponse<{ release_id: number; unified_release_id?: number; status: string; runtime_type: string; trigger_source?: string; trigger_context?: Record<string, any>; ci_run_id?: number; approval_required?: boolean; approval_ticket?: string; required_approvals?: number; approval_source?: string; lifecycle_state?: string; reason_code?: string; queue_position?: number; lock_holder_release_id?: number }>> {
     return apiService.post('/deploy/releases/apply', payload);
   },
-  approveRelease(id: number, payload?: { comment?: string }): Promise<ApiResponse<{ release_id: number; unified_release_id?: number; status: string; runtime_type: string; trigger_source?: string; trigger_context?: Record<string, any>; ci_run_id?: number; lifecycle_state?: string }>> {
+  approveRelease(id: number, payload?: { comment?: string }): Promise<ApiResponse<{ release_id: number; unified_release_id?: number; status: string; runtime_type: string; trigger_source?: string; trigger_context?: Record<string, any>; ci_run_id?: number; approval_required?: boolean; approval_ticket?: string; required_approvals?: number; approved_count?: number; lifecycle_state?: string; queue_position?: number; lock_holder_release_id?: number }>> {
     return apiService.post(`/deploy/releases/${id}/approve`, payload || {});
   },
   rejectRelease(id: number, payload?: { comment?: string }): Promise<ApiResponse<{ release_id: number; unified_release_id?: number; status: string; runtime_type: string; trigger_source?: string; trigger_context?: Record<string, any>; ci_run_id?: number; lifecycle_state?: string }>> {
     return apiService.post(`/deploy/releases/${id}/reject`, payload || {});
   },
+  getReleaseApprovalVotes(id: number): Promise<ApiResponse<PaginatedResponse<{ id: number; approval_id: number; release_id: number; voter_id: number; decision: string; comment: string; voter_roles: string; created_at: string }>>> {
+    return apiService.get(`/deploy/releases/${id}/approval-votes`);
+  },
   rollbackRelease(id: number): Promise<ApiResponse<{ release_id: number; unified_release_id?: number; status: string; trigger_source?: string; trigger_context?: Record<string, any>; ci_run_id?: number }>> {
     return apiService.post(`/deploy/releases/${id}/rollback`);
   },
+  pauseRelease(id: number, payload?: { comment?: string }): Promise<ApiResponse<{ release_id: number; unified_release_id?: number; status: string; runtime_type: string; lifecycle_state?: string }>> {
+    return apiService.post(`/deploy/releases/${id}/pause`, payload || {});
+  },
+  promoteRelease(id: number, payload?: { comment?: string }): Promise<ApiResponse<{ release_id: number; unified_release_id?: number; status: string; runtime_type: string; lifecycle_state?: string }>> {
+    return apiService.post(`/deploy/releases/${id}/promote`, payload || {});
+  },
+  abortRelease(id: number, payload?: { comment?: string }): Promise<ApiResponse<{ release_id: number; unified_release_id?: number; status: string; runtime_type: string; lifecycle_state?: string }>> {
+    return apiService.post(`/deploy/releases/${id}/abort`, payload || {});
+  },
+  cancelRelease(id: number, payload?: { comment?: string }): Promise<ApiResponse<{ release_id: number; unified_release_id?: number; status: string; runtime_type: string; lifecycle_state?: string }>> {
+    return apiService.post(`/deploy/releases/${id}/cancel`, payload || {});
+  },
+  getTargetReleaseQueue(targetId: number): Promise<ApiResponse<TargetReleaseQueue>> {
+    return apiService.get(`/deploy/targets/${targetId}/queue`);
+  },
+  getTargetDrift(targetId: number): Promise<ApiResponse<TargetDrift>> {
+    return apiService.get(`/deploy/targets/${targetId}/drift`);
+  },
+  resyncTargetDrift(targetId: number, payload?: { service_id?: number }): Promise<ApiResponse<TargetDrift>> {
+    return apiService.post(`/deploy/targets/${targetId}/drift/resync`, payload ?? {});
+  },
+  previewReleasePromotion(id: number, payload: ReleasePromotionReq): Promise<ApiResponse<{ resolved_manifest: string; checks: Array<{ code: string; message: string; level: string }>; warnings: Array<{ code: string; message: string; level: string }>; runtime: string; preview_token?: string; preview_expires_at?: string; prune_objects?: ReleaseInventoryItem[]; diff?: ReleaseObjectDiff[]; promotion?: ReleasePromotion }>> {
+    return apiService.post(`/deploy/releases/${id}/promotion/preview`, payload);
+  },
+  applyReleasePromotion(id: number, payload: ReleasePromotionReq): Promise<ApiResponse<{ release_id: number; unified_release_id?: number; status: string; runtime_type: string; trigger_source?: string; trigger_context?: Record<string, any>; approval_required?: boolean; approval_ticket?: string; required_approvals?: number; approval_source?: string; lifecycle_state?: string; reason_code?: string }>> {
+    return apiService.post(`/deploy/releases/${id}/promotion/apply`, payload);
+  },
+  listFreezeWindows(params?: { env?: string; project_id?: number; target_id?: number }): Promise<ApiResponse<PaginatedResponse<FreezeWindow>>> {
+    return apiService.get('/deploy/freeze-windows', { params });
+  },
+  createFreezeWindow(payload: FreezeWindowUpsertReq): Promise<ApiResponse<FreezeWindow>> {
+    return apiService.post('/deploy/freeze-windows', payload);
+  },
+  updateFreezeWindow(id: number, payload: FreezeWindowUpsertReq): Promise<ApiResponse<FreezeWindow>> {
+    return apiService.put(`/deploy/freeze-windows/${id}`, payload);
+  },
+  deleteFreezeWindow(id: number): Promise<ApiResponse<void>> {
+    return apiService.delete(`/deploy/freeze-windows/${id}`);
+  },
+  checkFreeze(params: { service_id: number; target_id: number; env?: string }): Promise<ApiResponse<{ frozen: boolean; message?: string; windows: FreezeWindow[] }>> {
+    return apiService.get('/deploy/freeze-windows/check', { params });
+  },
+  listReleaseHooks(params?: { service_id?: number; target_id?: number; phase?: ReleaseHookPhase }): Promise<ApiResponse<PaginatedResponse<ReleaseHook>>> {
+    return apiService.get('/deploy/hooks', { params });
+  },
+  createReleaseHook(payload: ReleaseHookUpsertReq): Promise<ApiResponse<ReleaseHook>> {
+    return apiService.post('/deploy/hooks', payload);
+  },
+  updateReleaseHook(id: number, payload: ReleaseHookUpsertReq): Promise<ApiResponse<ReleaseHook>> {
+    return apiService.put(`/deploy/hooks/${id}`, payload);
+  },
+  deleteReleaseHook(id: number): Promise<ApiResponse<void>> {
+    return apiService.delete(`/deploy/hooks/${id}`);
+  },
   getReleases(params?: { service_id?: number; target_id?: number }): Promise<ApiResponse<PaginatedResponse<DeployRelease>>> {
     return apiService.get('/deploy/releases', { params });
   },
@@ -382,6 +654,9 @@ export const deploymentApi = {
   getMetricsTrends(params?: { range?: 'daily' | 'weekly' | 'monthly' }): Promise<ApiResponse<MetricsTrend[]>> {
     return apiService.get('/deploy/metrics/trends', { params });
   },
+  getDORAMetrics(params?: { group_by?: 'service' | 'team' | 'env' | 'all'; days?: number; service_id?: number; team_id?: number; env?: string }): Promise<ApiResponse<DORAMetrics>> {
+    return apiService.get('/deploy/metrics/dora', { params });
+  },
 
   // 部署拓扑
   getTopology(params?: { environment?: string }): Promise<ApiResponse<DeploymentTopology>> {
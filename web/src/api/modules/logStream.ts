@@ -0,0 +1,59 @@
+// 运行日志实时流 (CI 运行、任务执行、自动化运行共用)。
+// 服务端以 SSE 推送 lines/end/error 事件, 事件 id 为已推送的最后一行序号, 断线后浏览器自动携带 Last-Event-ID 续读。
+
+export interface LogLine {
+  seq: number;
+  text: string;
+}
+
+export interface LogStreamFrame {
+  type: 'lines' | 'end' | 'error';
+  offset: number;
+  lines?: LogLine[];
+  error?: string;
+}
+
+export interface LogStreamHandlers {
+  onLines: (lines: LogLine[], offset: number) => void;
+  onEnd?: (offset: number) => void;
+  onError?: (message: string) => void;
+}
+
+export const logStreamURL = (path: string, after = 0): string => {
+  const base = import.meta.env.VITE_API_BASE || '/api/v1';
+  const params = new URLSearchParams();
+  if (after > 0) params.set('after', String(after));
+  const token = localStorage.getItem('token');
+  if (token) params.set('token', token);
+  const query = params.toString();
+  return `${base}${path}${query ? `?${query}` : ''}`;
+};
+
+// followLogStream 从序号 after 之后开始跟随日志流, 返回关闭函数。
+export const followLogStream = (path: string, handlers: LogStreamHandlers, after = 0): (() => void) => {
+  const source = new EventSource(logStreamURL(path, after));
+  const parse = (event: MessageEvent): LogStreamFrame | null => {
+    try {
+      return JSON.parse(event.data) as LogStreamFrame;
+    } catch {
+      return null;
+    }
+  };
+  source.addEventListener('lines', (event) => {
+    const frame = parse(event as MessageEvent);
+    if (frame?.lines?.length) handlers.onLines(frame.lines, frame.offset);
+  });
+  source.addEventListener('end', (event) => {
+    const frame = parse(event as MessageEvent);
+    source.close();
+    handlers.onEnd?.(frame?.offset || 0);
+  });
+  source.addEventListener('error', (event) => {
+    const frame = (event as MessageEvent).data ? parse(event as MessageEvent) : null;
+    if (frame?.error) {
+      source.close();
+      handlers.onError?.(frame.error);
+    }
+  });
+  return () => source.close();
+};
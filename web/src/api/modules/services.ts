@@ -174,6 +174,8 @@ export interface RenderPreviewReq {
   custom_yaml?: string;
   variables?: Record<string, string>;
   validate_only?: boolean;
+  project_id?: number;
+  env?: string;
 }
 
 export interface RenderPreviewResp {
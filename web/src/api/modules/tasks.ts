@@ -1,5 +1,10 @@
 import apiService from '../api';
 import type { ApiResponse, PaginatedResponse } from '../api';
+import { followLogStream } from './logStream';
+import type { LogStreamHandlers } from './logStream';
+
+// skip 丢弃错过的触发, once 补偿一次, all 逐次补偿
+export type TaskCatchUp = 'skip' | 'once' | 'all';
 
 export interface Task {
   id: string;
@@ -7,10 +12,20 @@ export interface Task {
   type: string;
   status: string;
   schedule: string;
+  timezone?: string;
+  catchUp?: TaskCatchUp;
+  paused?: boolean;
   command?: string;
   hostIds?: string;
+  // k8s 任务: 目标集群、命名空间、镜像与容器参数
+  clusterId?: number;
+  namespace?: string;
+  image?: string;
+  args?: string[];
   description?: string;
   timeout?: number;
+  // 同时执行的主机数, 0 表示使用服务端默认值
+  parallelism?: number;
   priority?: number;
   lastRun?: string;
   nextRun?: string;
@@ -24,9 +39,16 @@ export interface TaskExecution {
   jobId: string;
   hostId?: string;
   hostIp?: string;
+  // k8s 任务对应的 Job 名称
+  k8sJob?: string;
   status: string;
+  runId?: string;
+  trigger?: 'manual' | 'schedule' | 'catchup';
+  scheduledAt?: string;
   exitCode?: number;
   output?: string;
+  stderr?: string;
+  errorMessage?: string;
   startTime?: string;
   endTime?: string;
   createdAt?: string;
@@ -41,6 +63,66 @@ export interface TaskLog {
   message: string;
 }
 
+// success 依赖全部成功时执行, failure 依赖失败时执行, always 依赖结束即执行
+export type TaskWorkflowWhen = 'success' | 'failure' | 'always';
+
+export interface TaskWorkflowStep {
+  name: string;
+  jobId: string;
+  dependsOn?: string[];
+  when?: TaskWorkflowWhen;
+  retries?: number;
+  retryDelay?: number;
+  // 值可引用 ${{ vars.<name> }} 与 ${{ steps.<step>.outputs.<name> }}
+  env?: Record<string, string>;
+}
+
+export interface TaskWorkflow {
+  id: string;
+  name: string;
+  description?: string;
+  steps: TaskWorkflowStep[];
+  createdAt: string;
+  updatedAt?: string;
+}
+
+export interface TaskWorkflowParams {
+  name?: string;
+  description?: string;
+  steps?: TaskWorkflowStep[];
+}
+
+export interface TaskWorkflowRun {
+  id: string;
+  workflowId: string;
+  status: string;
+  variables: Record<string, string>;
+  startTime?: string;
+  endTime?: string;
+}
+
+export interface TaskWorkflowStepState {
+  id: string;
+  name: string;
+  jobId: string;
+  status: string;
+  dependsOn: string[];
+  when: TaskWorkflowWhen;
+  retries: number;
+  attempts: number;
+  jobRunId?: string;
+  outputs: Record<string, string>;
+  errorMessage?: string;
+  startTime?: string;
+  endTime?: string;
+}
+
+export interface TaskWorkflowRunGraph {
+  run: TaskWorkflowRun;
+  steps: TaskWorkflowStepState[];
+  edges: Array<{ from: string; to: string }>;
+}
+
 export interface TaskListParams {
   page?: number;
   pageSize?: number;
@@ -50,10 +132,19 @@ export interface TaskCreateParams {
   name: string;
   type: string;
   schedule: string;
+  timezone?: string;
+  catchUp?: TaskCatchUp;
   command?: string;
   hostIds?: string;
+  // k8s 任务: 目标集群、命名空间、镜像与容器参数
+  clusterId?: number;
+  namespace?: string;
+  image?: string;
+  args?: string[];
   description?: string;
   timeout?: number;
+  // 同时执行的主机数, 0 表示使用服务端默认值
+  parallelism?: number;
   priority?: number;
 }
 
@@ -61,11 +152,20 @@ export interface TaskUpdateParams {
   name?: string;
   type?: string;
   schedule?: string;
+  timezone?: string;
+  catchUp?: TaskCatchUp;
   status?: string;
   command?: string;
   hostIds?: string;
+  // k8s 任务: 目标集群、命名空间、镜像与容器参数
+  clusterId?: number;
+  namespace?: string;
+  image?: string;
+  args?: string[];
   description?: string;
   timeout?: number;
+  // 同时执行的主机数, 0 表示使用服务端默认值
+  parallelism?: number;
   priority?: number;
 }
 
@@ -75,16 +175,35 @@ export interface TaskLogParams {
   level?: string;
 }
 
+const parseJSON = <T,>(raw: string | undefined, fallback: T): T => {
+  if (!raw) {
+    return fallback;
+  }
+  try {
+    return JSON.parse(raw) as T;
+  } catch {
+    return fallback;
+  }
+};
+
 const normalizeTask = (item: any): Task => ({
   id: String(item.id),
   name: item.name || '',
   type: item.type || '',
   status: item.status || 'pending',
   schedule: item.cron || item.schedule || '',
+  timezone: item.timezone || '',
+  catchUp: item.catch_up || 'skip',
+  paused: Boolean(item.paused),
   command: item.command || '',
   hostIds: item.host_ids || '',
+  clusterId: item.cluster_id || 0,
+  namespace: item.namespace || '',
+  image: item.image || '',
+  args: parseJSON<string[]>(item.args_json, []),
   description: item.description || '',
   timeout: item.timeout || 0,
+  parallelism: item.parallelism || 0,
   priority: item.priority || 0,
   createdAt: item.created_at || item.createdAt || '',
   updatedAt: item.updated_at || item.updatedAt || '',
@@ -98,9 +217,15 @@ const normalizeExecution = (item: any): TaskExecution => ({
   jobId: String(item.job_id || item.jobId || ''),
   hostId: item.host_id ? String(item.host_id) : '',
   hostIp: item.host_ip || '',
+  k8sJob: item.k8s_job || '',
   status: item.status || 'pending',
+  runId: item.run_id || '',
+  trigger: item.trigger || 'manual',
+  scheduledAt: item.scheduled_at || '',
   exitCode: item.exit_code,
   output: item.output || '',
+  stderr: item.stderr || '',
+  errorMessage: item.error_message || '',
   startTime: item.start_time || '',
   endTime: item.end_time || '',
   createdAt: item.created_at || '',
@@ -115,6 +240,43 @@ const normalizeLog = (item: any): TaskLog => ({
   message: item.message || '',
 });
 
+const normalizeWorkflow = (item: any): TaskWorkflow => ({
+  id: String(item.id),
+  name: item.name || '',
+  description: item.description || '',
+  steps: parseJSON<any[]>(item.steps_json, []).map((step) => ({
+    name: step.name,
+    jobId: String(step.job_id),
+    dependsOn: step.depends_on || [],
+    when: step.when || 'success',
+    retries: step.retries || 0,
+    retryDelay: step.retry_delay || 0,
+    env: step.env || {},
+  })),
+  createdAt: item.created_at || '',
+  updatedAt: item.updated_at || '',
+});
+
+const normalizeWorkflowRun = (item: any): TaskWorkflowRun => ({
+  id: String(item.id),
+  workflowId: String(item.workflow_id || ''),
+  status: item.status || 'running',
+  variables: parseJSON<Record<string, string>>(item.variables_json, {}),
+  startTime: item.start_time || '',
+  endTime: item.end_time || '',
+});
+
+const serializeWorkflowSteps = (steps?: TaskWorkflowStep[]) =>
+  steps?.map((step) => ({
+    name: step.name,
+    job_id: Number(step.jobId),
+    depends_on: step.dependsOn || [],
+    when: step.when || 'success',
+    retries: step.retries || 0,
+    retry_delay: step.retryDelay || 0,
+    env: step.env,
+  }));
+
 export const taskApi = {
   async getTaskList(params?: TaskListParams): Promise<ApiResponse<PaginatedResponse<Task>>> {
     const response = await apiService.get<any[]>('/jobs', {
@@ -145,11 +307,18 @@ export const taskApi = {
     const response = await apiService.post<any>('/jobs', {
       name: data.name,
       type: data.type,
-      command: data.command || `echo running ${data.name}`,
-      host_ids: data.hostIds || '1',
+      command: data.type === 'k8s' ? data.command || '' : data.command || `echo running ${data.name}`,
+      host_ids: data.type === 'k8s' ? '' : data.hostIds || '1',
+      cluster_id: data.clusterId || 0,
+      namespace: data.namespace || '',
+      image: data.image || '',
+      args: data.args || [],
       cron: data.schedule,
+      timezone: data.timezone || '',
+      catch_up: data.catchUp || 'skip',
       status: 'pending',
       timeout: data.timeout || 300,
+      parallelism: data.parallelism || 0,
       priority: data.priority || 0,
       description: data.description || '',
     });
@@ -172,9 +341,16 @@ export const taskApi = {
       type: merged.type,
       command: merged.command,
       host_ids: merged.hostIds,
+      cluster_id: merged.clusterId,
+      namespace: merged.namespace,
+      image: merged.image,
+      args: merged.args,
       cron: merged.schedule,
+      timezone: merged.timezone,
+      catch_up: merged.catchUp,
       status: merged.status,
       timeout: merged.timeout,
+      parallelism: merged.parallelism,
       priority: merged.priority,
       description: merged.description,
     });
@@ -189,7 +365,7 @@ export const taskApi = {
     return apiService.delete(`/jobs/${id}`);
   },
 
-  async startTask(id: string): Promise<ApiResponse<void>> {
+  async startTask(id: string): Promise<ApiResponse<{ message: string; run_id: string }>> {
     return apiService.post(`/jobs/${id}/start`);
   },
 
@@ -197,6 +373,22 @@ export const taskApi = {
     return apiService.post(`/jobs/${id}/stop`);
   },
 
+  async pauseTask(id: string): Promise<ApiResponse<Task>> {
+    const response = await apiService.post<any>(`/jobs/${id}/pause`);
+    return {
+      ...response,
+      data: normalizeTask(response.data),
+    };
+  },
+
+  async resumeTask(id: string): Promise<ApiResponse<Task>> {
+    const response = await apiService.post<any>(`/jobs/${id}/resume`);
+    return {
+      ...response,
+      data: normalizeTask(response.data),
+    };
+  },
+
   async getTaskExecutions(id: string, params?: TaskLogParams): Promise<ApiResponse<PaginatedResponse<TaskExecution>>> {
     const response = await apiService.get<any[]>(`/jobs/${id}/executions`, {
       params: {
@@ -231,4 +423,114 @@ export const taskApi = {
       },
     };
   },
+
+  followExecutionLogs(id: string, executionId: string, handlers: LogStreamHandlers, after = 0): () => void {
+    return followLogStream(`/jobs/${id}/executions/${executionId}/logs/stream`, handlers, after);
+  },
+
+  async getWorkflowList(params?: TaskListParams): Promise<ApiResponse<PaginatedResponse<TaskWorkflow>>> {
+    const response = await apiService.get<any[]>('/jobs/workflows', {
+      params: {
+        page: params?.page,
+        page_size: params?.pageSize,
+      },
+    });
+
+    return {
+      ...response,
+      data: {
+        list: (response.data || []).map(normalizeWorkflow),
+        total: response.total || 0,
+      },
+    };
+  },
+
+  async createWorkflow(data: TaskWorkflowParams): Promise<ApiResponse<TaskWorkflow>> {
+    const response = await apiService.post<any>('/jobs/workflows', {
+      name: data.name,
+      description: data.description || '',
+      steps: serializeWorkflowSteps(data.steps),
+    });
+    return {
+      ...response,
+      data: normalizeWorkflow(response.data),
+    };
+  },
+
+  async updateWorkflow(id: string, data: TaskWorkflowParams): Promise<ApiResponse<TaskWorkflow>> {
+    const response = await apiService.put<any>(`/jobs/workflows/${id}`, {
+      name: data.name,
+      description: data.description,
+      steps: serializeWorkflowSteps(data.steps),
+    });
+    return {
+      ...response,
+      data: normalizeWorkflow(response.data),
+    };
+  },
+
+  async deleteWorkflow(id: string): Promise<ApiResponse<void>> {
+    return apiService.delete(`/jobs/workflows/${id}`);
+  },
+
+  async startWorkflow(id: string, variables?: Record<string, string>): Promise<ApiResponse<TaskWorkflowRun>> {
+    const response = await apiService.post<any>(`/jobs/workflows/${id}/runs`, { variables: variables || {} });
+    return {
+      ...response,
+      data: normalizeWorkflowRun(response.data),
+    };
+  },
+
+  async getWorkflowRuns(id: string, params?: TaskListParams): Promise<ApiResponse<PaginatedResponse<TaskWorkflowRun>>> {
+    const response = await apiService.get<any[]>(`/jobs/workflows/${id}/runs`, {
+      params: {
+        page: params?.page,
+        page_size: params?.pageSize,
+      },
+    });
+
+    return {
+      ...response,
+      data: {
+        list: (response.data || []).map(normalizeWorkflowRun),
+        total: response.total || 0,
+      },
+    };
+  },
+
+  async getWorkflowRun(id: string, runId: string): Promise<ApiResponse<TaskWorkflowRunGraph>> {
+    const response = await apiService.get<any>(`/jobs/workflows/${id}/runs/${runId}`);
+    const graph = response.data || {};
+    return {
+      ...response,
+      data: {
+        run: normalizeWorkflowRun(graph.run || {}),
+        steps: (graph.steps || []).map((step: any) => ({
+          id: String(step.id),
+          name: step.name,
+          jobId: String(step.job_id),
+          status: step.status || 'pending',
+          dependsOn: step.depends_on || [],
+          when: step.when || 'success',
+          retries: step.retries || 0,
+          attempts: step.attempts || 0,
+          jobRunId: step.job_run_id || '',
+          outputs: step.outputs || {},
+          errorMessage: step.error_message || '',
+          startTime: step.start_time || '',
+          endTime: step.end_time || '',
+        })),
+        edges: graph.edges || [],
+      },
+    };
+  },
+
+  // step 为空时从所有失败的步骤重试
+  async retryWorkflowRun(id: string, runId: string, step?: string): Promise<ApiResponse<TaskWorkflowRun>> {
+    const response = await apiService.post<any>(`/jobs/workflows/${id}/runs/${runId}/retry`, { step: step || '' });
+    return {
+      ...response,
+      data: normalizeWorkflowRun(response.data),
+    };
+  },
 };
@@ -15,15 +15,18 @@ interface ReleaseStateFlowProps {
 
 const ReleaseStateFlow: React.FC<ReleaseStateFlowProps> = ({
   currentState,
-  states = ['pending_approval', 'approved', 'applying', 'applied'],
+  states = ['pending_approval', 'approved', 'applying', 'verifying', 'applied'],
 }) => {
   const stateConfig: Record<string, { icon: React.ReactNode; color: string; text: string }> = {
     pending_approval: { icon: <ClockCircleOutlined />, color: 'orange', text: '待审批' },
     approved: { icon: <CheckCircleOutlined />, color: 'blue', text: '已批准' },
     applying: { icon: <SyncOutlined spin />, color: 'processing', text: '部署中' },
+    verifying: { icon: <SyncOutlined spin />, color: 'processing', text: '验证中' },
+    paused: { icon: <ClockCircleOutlined />, color: 'warning', text: '已暂停' },
     applied: { icon: <CheckCircleOutlined />, color: 'success', text: '已完成' },
     failed: { icon: <CloseCircleOutlined />, color: 'error', text: '失败' },
     rejected: { icon: <CloseCircleOutlined />, color: 'default', text: '已拒绝' },
+    aborted: { icon: <CloseCircleOutlined />, color: 'default', text: '已中止' },
   };
 
   const getCurrentStep = () => {
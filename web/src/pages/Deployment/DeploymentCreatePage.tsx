@@ -20,7 +20,15 @@ import {
 import { useNavigate } from 'react-router-dom';
 import { Api } from '../../api';
 import type { ServiceItem } from '../../api/modules/services';
-import type { DeployTarget } from '../../api/modules/deployment';
+import type { DeployTarget, ReleaseObjectDiff } from '../../api/modules/deployment';
+
+const diffActionColor: Record<ReleaseObjectDiff['action'], string> = {
+  create: 'green',
+  change: 'blue',
+  unchanged: 'default',
+  prune: 'orange',
+  error: 'red',
+};
 
 const DeploymentCreatePage: React.FC = () => {
   const navigate = useNavigate();
@@ -31,6 +39,7 @@ const DeploymentCreatePage: React.FC = () => {
   const [previewManifest, setPreviewManifest] = useState('');
   const [previewWarnings, setPreviewWarnings] = useState<Array<{ code: string; message: string; level: string }>>([]);
   const [previewToken, setPreviewToken] = useState('');
+  const [previewDiff, setPreviewDiff] = useState<ReleaseObjectDiff[]>([]);
 
   const [form] = Form.useForm();
 
@@ -215,6 +224,28 @@ const DeploymentCreatePage: React.FC = () => {
             </div>
           )}
 
+          {previewDiff.length > 0 && (
+            <Card size="small" title="变更预览 (dry-run)" className="mt-4">
+              <div className="space-y-2">
+                {previewDiff.map((d) => (
+                  <div key={`${d.object.kind}/${d.object.namespace || ''}/${d.object.name}`}>
+                    <Space>
+                      <Tag color={diffActionColor[d.action]}>{d.action}</Tag>
+                      <span>{d.object.kind}/{d.object.namespace ? `${d.object.namespace}/` : ''}{d.object.name}</span>
+                    </Space>
+                    {d.error && <div className="text-red-500 text-xs mt-1">{d.error}</div>}
+                    {(d.changes || []).map((c) => (
+                      <div key={c.path} className="text-xs text-gray-500 ml-4 font-mono">
+                        {c.path}: {JSON.stringify(c.before ?? null)} → {JSON.stringify(c.after ?? null)}
+                      </div>
+                    ))}
+                    {d.truncated && <div className="text-xs text-gray-400 ml-4">…</div>}
+                  </div>
+                ))}
+              </div>
+            </Card>
+          )}
+
           {previewManifest && (
             <Card size="small" title="部署清单预览" className="mt-4">
               <pre className="bg-gray-50 p-4 rounded-lg text-sm overflow-auto max-h-96">
@@ -309,7 +340,11 @@ const DeploymentCreatePage: React.FC = () => {
 
       setPreviewManifest(resp.data.resolved_manifest || '');
       setPreviewToken(resp.data.preview_token || '');
-      setPreviewWarnings(resp.data.warnings || []);
+      setPreviewWarnings([
+        ...(resp.data.checks || []).filter((c) => c.level === 'error'),
+        ...(resp.data.warnings || []),
+      ]);
+      setPreviewDiff(resp.data.diff || []);
       message.success('预览成功');
     } catch (err) {
       message.error(err instanceof Error ? err.message : '预览失败');
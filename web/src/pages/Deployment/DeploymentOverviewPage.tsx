@@ -40,7 +40,7 @@ const DeploymentOverviewPage: React.FC = () => {
     load();
     // Poll for in-progress deployments
     const interval = setInterval(() => {
-      const hasInProgress = releases.some((r) => r.state === 'applying');
+      const hasInProgress = releases.some((r) => r.state === 'applying' || r.state === 'verifying');
       if (hasInProgress) {
         load();
       }
@@ -52,7 +52,7 @@ const DeploymentOverviewPage: React.FC = () => {
   const stats = useMemo(() => {
     const total = releases.length;
     const pendingApproval = releases.filter((r) => r.state === 'pending_approval').length;
-    const inProgress = releases.filter((r) => r.state === 'applying').length;
+    const inProgress = releases.filter((r) => r.state === 'applying' || r.state === 'verifying').length;
     const succeeded = releases.filter((r) => r.state === 'applied').length;
     const failed = releases.filter((r) => r.state === 'failed').length;
     const successRate = total > 0 ? Math.round((succeeded / total) * 100) : 0;
@@ -83,7 +83,7 @@ const DeploymentOverviewPage: React.FC = () => {
 
   // In-progress deployments
   const inProgressDeployments = useMemo(() => {
-    return releases.filter((r) => r.state === 'applying').slice(0, 5);
+    return releases.filter((r) => r.state === 'applying' || r.state === 'verifying').slice(0, 5);
   }, [releases]);
 
   const getStateConfig = (state: string) => {
@@ -91,6 +91,7 @@ const DeploymentOverviewPage: React.FC = () => {
       pending_approval: { icon: <ClockCircleOutlined />, color: 'orange', text: '待审批' },
       approved: { icon: <CheckCircleOutlined />, color: 'blue', text: '已批准' },
       applying: { icon: <SyncOutlined spin />, color: 'processing', text: '部署中' },
+      verifying: { icon: <SyncOutlined spin />, color: 'processing', text: '验证中' },
       applied: { icon: <CheckCircleOutlined />, color: 'success', text: '成功' },
       failed: { icon: <CloseCircleOutlined />, color: 'error', text: '失败' },
       rejected: { icon: <CloseCircleOutlined />, color: 'default', text: '已拒绝' },
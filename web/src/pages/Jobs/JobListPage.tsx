@@ -67,6 +67,7 @@ const JobListPage: React.FC = () => {
     success: { color: 'success', text: '成功' },
     failed: { color: 'error', text: '失败' },
     stopped: { color: 'default', text: '已停止' },
+    unknown: { color: 'default', text: '结果未知' },
   } as Record<string, { color: string; text: string }>), []);
 
   const columns = [